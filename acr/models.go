@@ -30,6 +30,8 @@ type ChangeableAttributes struct {
 	ListEnabled *bool `json:"listEnabled,omitempty"`
 	// ReadEnabled - Read enabled
 	ReadEnabled *bool `json:"readEnabled,omitempty"`
+	// QuarantineState - Quarantine state, only returned for the manifests of registries with quarantine enabled
+	QuarantineState *string `json:"quarantineState,omitempty"`
 }
 
 // DeletedRepository deleted repository
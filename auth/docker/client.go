@@ -4,12 +4,13 @@
 package docker
 
 import (
+	"fmt"
+
 	"github.com/Azure/acr-cli/auth"
 
 	"github.com/docker/cli/cli/config"
 	"github.com/docker/cli/cli/config/configfile"
 	"github.com/docker/cli/cli/config/credentials"
-	"github.com/pkg/errors"
 )
 
 // Client provides authentication operations for docker registries.
@@ -24,7 +25,7 @@ func NewClient(configPaths ...string) (auth.Client, error) {
 	for _, path := range configPaths {
 		cfg, err := loadConfigFile(path)
 		if err != nil {
-			return nil, errors.Wrap(err, path)
+			return nil, fmt.Errorf("%s: %w", path, err)
 		}
 		cfgs = append(cfgs, cfg)
 	}
@@ -0,0 +1,252 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newArtifactCmdLongMessage     = `acr artifact: inspect the artifacts of a repository.`
+	newArtifactTreeCmdLongMessage = `acr artifact tree: print the tree of an image, the children of an index and the artifacts attached to
+every manifest with the OCI referrers API (e.g. signatures, SBOMs and attestations), with their sizes. The size of a
+manifest includes its config and layers, layers shared by several manifests are counted for each of them.`
+	artifactTreeExampleMessage = `  - Show the tree of the hello-world:latest image of the example.azurecr.io registry
+    acr artifact tree -r example hello-world:latest
+
+  - Show the tree of a manifest referenced by digest
+    acr artifact tree -r example hello-world@sha256:<digest>`
+)
+
+// ociImageConfigContentType and dockerImageConfigContentType are the config media types of images, other config
+// media types identify the type of an artifact that predates the artifactType field.
+const (
+	ociImageConfigContentType    = "application/vnd.oci.image.config.v1+json"
+	dockerImageConfigContentType = "application/vnd.docker.container.image.v1+json"
+)
+
+// newArtifactCmd defines the artifact command, it only groups the artifact subcommands.
+func newArtifactCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "artifact",
+		Short: "Inspect the artifacts of a repository",
+		Long:  newArtifactCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Help()
+			return nil
+		},
+	}
+	cmd.AddCommand(newArtifactTreeCmd(out, rootParams))
+	return cmd
+}
+
+// newArtifactTreeCmd defines the artifact tree subcommand, it receives the image as <repository>:<tag> or
+// <repository>@<digest>.
+func newArtifactTreeCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "tree <repository>:<tag>",
+		Short:   "Print the tree of an image and the artifacts attached to it",
+		Long:    newArtifactTreeCmdLongMessage,
+		Example: artifactTreeExampleMessage,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registryName, err := rootParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, rootParams.username, rootParams.password, rootParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			return artifactTree(ctx, out, acrClient, loginURL, args[0])
+		},
+	}
+	return cmd
+}
+
+// artifactNode is a manifest of the tree of an image.
+type artifactNode struct {
+	Digest string
+	// Kind is index, image or the type of the artifact.
+	Kind     string
+	Platform string
+	// Size is the size of the manifest, its config and its layers.
+	Size      int64
+	Children  []*artifactNode
+	Referrers []*artifactNode
+}
+
+// artifactManifest contains the fields of images, indexes and artifacts needed to build the tree.
+type artifactManifest struct {
+	MediaType    string               `json:"mediaType"`
+	ArtifactType string               `json:"artifactType"`
+	Config       artifactDescriptor   `json:"config"`
+	Layers       []artifactDescriptor `json:"layers"`
+	Manifests    []artifactDescriptor `json:"manifests"`
+}
+
+// artifactDescriptor references a blob or a manifest.
+type artifactDescriptor struct {
+	MediaType    string         `json:"mediaType"`
+	ArtifactType string         `json:"artifactType"`
+	Digest       string         `json:"digest"`
+	Size         int64          `json:"size"`
+	Platform     *indexPlatform `json:"platform"`
+}
+
+// artifactTree prints the tree of the referenced image.
+func artifactTree(ctx context.Context, out io.Writer, acrClient api.AcrCLIClientInterface, loginURL string, reference string) error {
+	repoName, ref, isDigest, err := parseReference(reference)
+	if err != nil {
+		return err
+	}
+	digest := ref
+	if !isDigest {
+		manifestBytes, err := acrClient.GetManifest(ctx, repoName, ref)
+		if err != nil {
+			return fmt.Errorf("failed to get manifest of %s: %w", reference, err)
+		}
+		digest = computeDigest(manifestBytes)
+	}
+	root, err := buildArtifactNode(ctx, acrClient, repoName, digest, map[string]bool{})
+	if err != nil {
+		return err
+	}
+	label := fmt.Sprintf("%s/%s", loginURL, reference)
+	if !isDigest {
+		label += "@" + digest
+	}
+	fmt.Fprintf(out, "%s %s\n", label, describeArtifact(root))
+	printArtifactChildren(out, root, "")
+	return nil
+}
+
+// buildArtifactNode fetches a manifest, the manifests it references and the ones that reference it. Visited keeps
+// the digests already in the tree so that a referrer cycle does not loop forever.
+func buildArtifactNode(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digest string, visited map[string]bool) (*artifactNode, error) {
+	visited[digest] = true
+	manifestBytes, err := acrClient.GetManifest(ctx, repoName, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest %s: %w", digest, err)
+	}
+	var manifest artifactManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", digest, err)
+	}
+	node := &artifactNode{Digest: digest, Size: int64(len(manifestBytes))}
+	switch {
+	case len(manifest.ArtifactType) > 0:
+		node.Kind = manifest.ArtifactType
+	case manifest.MediaType == ociIndexContentType || manifest.MediaType == dockerManifestListContentType:
+		node.Kind = "index"
+	case len(manifest.Config.MediaType) > 0 && manifest.Config.MediaType != ociImageConfigContentType && manifest.Config.MediaType != dockerImageConfigContentType:
+		node.Kind = manifest.Config.MediaType
+	default:
+		node.Kind = "image"
+	}
+	node.Size += manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		node.Size += layer.Size
+	}
+	for _, descriptor := range manifest.Manifests {
+		if visited[descriptor.Digest] {
+			continue
+		}
+		child, err := buildArtifactNode(ctx, acrClient, repoName, descriptor.Digest, visited)
+		if err != nil {
+			return nil, err
+		}
+		if descriptor.Platform != nil {
+			child.Platform = descriptor.Platform.OS + "/" + descriptor.Platform.Architecture
+			if len(descriptor.Platform.Variant) > 0 {
+				child.Platform += "/" + descriptor.Platform.Variant
+			}
+		}
+		node.Children = append(node.Children, child)
+	}
+	referrers, err := getReferrers(ctx, acrClient, repoName, digest)
+	if err != nil {
+		return nil, err
+	}
+	for _, descriptor := range referrers {
+		if visited[descriptor.Digest] {
+			continue
+		}
+		referrer, err := buildArtifactNode(ctx, acrClient, repoName, descriptor.Digest, visited)
+		if err != nil {
+			return nil, err
+		}
+		node.Referrers = append(node.Referrers, referrer)
+	}
+	return node, nil
+}
+
+// getReferrers returns the descriptors of the manifests whose subject is the digest. Registries that do not implement
+// the referrers API keep them in an index tagged with the digest (the referrers tag schema).
+func getReferrers(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digest string) ([]artifactDescriptor, error) {
+	indexBytes, err := acrClient.GetReferrers(ctx, repoName, digest)
+	if err != nil {
+		if !api.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get referrers of %s: %w", digest, err)
+		}
+		indexBytes, err = acrClient.GetManifest(ctx, repoName, strings.Replace(digest, ":", "-", 1))
+		if err != nil {
+			if api.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to get referrers of %s: %w", digest, err)
+		}
+	}
+	var index artifactManifest
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse referrers of %s: %w", digest, err)
+	}
+	return index.Manifests, nil
+}
+
+// printArtifactChildren prints the children of an index and then the referrers of a node, every level is indented
+// with the prefix.
+func printArtifactChildren(out io.Writer, node *artifactNode, prefix string) {
+	nodes := append(append([]*artifactNode{}, node.Children...), node.Referrers...)
+	for i, child := range nodes {
+		branch, indent := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, indent = "└── ", "    "
+		}
+		label := child.Digest
+		if len(child.Platform) > 0 {
+			label += " " + child.Platform
+		}
+		fmt.Fprintf(out, "%s%s%s %s\n", prefix, branch, label, describeArtifact(child))
+		printArtifactChildren(out, child, prefix+indent)
+	}
+}
+
+// describeArtifact returns the kind and the size of a node, the size of an index includes the size of its children
+// and the size of any manifest includes the size of its referrers.
+func describeArtifact(node *artifactNode) string {
+	return fmt.Sprintf("(%s, %s)", node.Kind, units.HumanSize(float64(totalArtifactSize(node))))
+}
+
+// totalArtifactSize returns the size of a node and all its descendants.
+func totalArtifactSize(node *artifactNode) int64 {
+	size := node.Size
+	for _, child := range node.Children {
+		size += totalArtifactSize(child)
+	}
+	for _, referrer := range node.Referrers {
+		size += totalArtifactSize(referrer)
+	}
+	return size
+}
@@ -0,0 +1,53 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestArtifactTree verifies that the tree contains the children of an index and the referrers of every manifest.
+func TestArtifactTree(t *testing.T) {
+	assert := assert.New(t)
+	notFound := &api.StatusError{StatusCode: http.StatusNotFound, Message: "not found"}
+	amd64 := []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":1000},"layers":[{"size":2000000}]}`)
+	arm64 := []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":1000},"layers":[{"size":1000000}]}`)
+	signature := []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/vnd.cncf.notary.signature","config":{"size":2},"layers":[{"size":1000}]}`)
+	sbom := []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/spdx+json","size":2},"layers":[{"size":5000}]}`)
+	amd64Digest, arm64Digest, signatureDigest, sbomDigest := computeDigest(amd64), computeDigest(arm64), computeDigest(signature), computeDigest(sbom)
+	index := []byte(fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"digest":%q,"platform":{"os":"linux","architecture":"amd64"}},{"digest":%q,"platform":{"os":"linux","architecture":"arm64","variant":"v8"}}]}`, amd64Digest, arm64Digest))
+	indexDigest := computeDigest(index)
+	mockClient := &mocks.AcrCLIClientInterface{}
+	mockClient.On("GetManifest", testCtx, testRepo, "latest").Return(index, nil).Once()
+	for manifestDigest, manifestBytes := range map[string][]byte{indexDigest: index, amd64Digest: amd64, arm64Digest: arm64, signatureDigest: signature, sbomDigest: sbom} {
+		mockClient.On("GetManifest", testCtx, testRepo, manifestDigest).Return(manifestBytes, nil).Once()
+	}
+	// The registry implements the referrers API, the SBOM of the index is found with it.
+	mockClient.On("GetReferrers", testCtx, testRepo, indexDigest).Return([]byte(fmt.Sprintf(`{"manifests":[{"digest":%q}]}`, sbomDigest)), nil).Once()
+	mockClient.On("GetReferrers", testCtx, testRepo, amd64Digest).Return([]byte(`{"manifests":[]}`), nil).Once()
+	mockClient.On("GetReferrers", testCtx, testRepo, sbomDigest).Return([]byte(`{"manifests":[]}`), nil).Once()
+	// The signature of the arm64 image is found with the referrers tag schema.
+	mockClient.On("GetReferrers", testCtx, testRepo, arm64Digest).Return(nil, notFound).Once()
+	mockClient.On("GetManifest", testCtx, testRepo, "sha256-"+arm64Digest[len("sha256:"):]).Return([]byte(fmt.Sprintf(`{"manifests":[{"digest":%q}]}`, signatureDigest)), nil).Once()
+	mockClient.On("GetReferrers", testCtx, testRepo, signatureDigest).Return(nil, notFound).Once()
+	mockClient.On("GetManifest", testCtx, testRepo, "sha256-"+signatureDigest[len("sha256:"):]).Return(nil, notFound).Once()
+	out := &bytes.Buffer{}
+	err := artifactTree(testCtx, out, mockClient, testLoginURL, testRepo+":latest")
+	assert.Equal(nil, err, "Error should be nil")
+	expected := fmt.Sprintf(`%s/%s:latest@%s (index, 3.009MB)
+├── %s linux/amd64 (image, 2.001MB)
+├── %s linux/arm64/v8 (image, 1.002MB)
+│   └── %s (application/vnd.cncf.notary.signature, 1.16kB)
+└── %s (application/spdx+json, 5.141kB)
+`, testLoginURL, testRepo, indexDigest, amd64Digest, arm64Digest, signatureDigest, sbomDigest)
+	assert.Equal(expected, out.String())
+	mockClient.AssertExpectations(t)
+}
@@ -0,0 +1,30 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// cacheRules returns the cache rules of the registry read through Azure Resource Manager, the repositories they cache
+// are skipped by the purge. They are only read if the resource group of the registry is known and the include-cached
+// flag is not set, rules that cannot be read are only a warning.
+func (purgeParams *purgeParameters) cacheRules(ctx context.Context, warnings io.Writer) []api.CacheRule {
+	if purgeParams.includeCached || len(purgeParams.resourceGroup) == 0 {
+		return nil
+	}
+	managementClient, err := newManagementClient(purgeParams.rootParameters, purgeParams.subscription, purgeParams.resourceGroup)
+	if err == nil {
+		var rules []api.CacheRule
+		if rules, err = managementClient.ListCacheRules(ctx); err == nil {
+			return rules
+		}
+	}
+	fmt.Fprintf(warnings, "Warning: unable to read the cache rules of the registry, the cached repositories are not skipped: %v\n", err)
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/diagnose"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newCheckHealthCmdLongMessage = `acr check-health: diagnose the network path to a registry. It checks that the login server and
+the data endpoints resolve to addresses that can be used from this machine, which matters for registries behind Private
+Link, and that the registry firewall accepts connections from it. No credentials are needed.`
+	checkHealthExampleMessage = `  - Check that the example.azurecr.io registry can be reached
+    acr check-health -r example
+
+  - Also check the dedicated data endpoint of the registry in the West US region
+    acr check-health -r example --data-endpoint example.westus.data.azurecr.io
+`
+)
+
+// checkHealthParameters defines the parameters used by the check-health command.
+type checkHealthParameters struct {
+	*rootParameters
+	dataEndpoints []string
+}
+
+// newCheckHealthCmd defines the check-health command.
+func newCheckHealthCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	checkHealthParams := checkHealthParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "check-health",
+		Short:   "Diagnose the network path to a registry",
+		Long:    newCheckHealthCmdLongMessage,
+		Example: checkHealthExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registryName, err := checkHealthParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			return diagnoseNetwork(out, loginURL, checkHealthParams.dataEndpoints)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&checkHealthParams.dataEndpoints, "data-endpoint", nil, "A dedicated data endpoint of the registry to check (e.g. example.westus.data.azurecr.io), can be specified multiple times")
+	return cmd
+}
+
+// diagnoseNetwork prints the result of the network checks and returns an error if any of them failed.
+func diagnoseNetwork(out io.Writer, loginURL string, dataEndpoints []string) error {
+	checks := diagnose.New(net.DefaultResolver, api.HTTPClient()).Network(context.Background(), loginURL, dataEndpoints)
+	diagnose.Print(out, checks)
+	if failed := diagnose.Failed(checks); len(failed) > 0 {
+		return fmt.Errorf("%d network checks failed for %s", len(failed), loginURL)
+	}
+	return nil
+}
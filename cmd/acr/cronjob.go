@@ -0,0 +1,181 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Azure/acr-cli/version"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	newGenerateCronJobCmdLongMessage = `acr purge generate-cronjob: print a Kubernetes CronJob that runs a purge on a schedule.
+The arguments after -- are the flags of the purge, they are validated and embedded in the CronJob as they are. The
+credentials are read from a secret with username and password keys, so they never appear in the manifest.`
+	generateCronJobExampleMessage = `  - Purge the tags of hello-world older than 7 days every night at 2:00 with the credentials of the acr-purge secret
+    acr purge generate-cronjob -r example --schedule "0 2 * * *" --secret acr-purge -- --filter "hello-world:.*" --ago 7d --untagged | kubectl apply -f -
+`
+	// defaultCronJobImage is the repository of the acr-cli image, it is tagged with the version of the binary.
+	defaultCronJobImage = "mcr.microsoft.com/acr/acr-cli"
+	// The keys of the secret with the credentials of the registry.
+	cronJobUsernameKey = "username"
+	cronJobPasswordKey = "password"
+)
+
+// generateCronJobParameters defines the parameters used by the generate-cronjob command.
+type generateCronJobParameters struct {
+	*rootParameters
+	name      string
+	namespace string
+	schedule  string
+	image     string
+	secret    string
+}
+
+// The parts of a CronJob that are generated, the fields are in the order kubectl prints them.
+type cronJob struct {
+	APIVersion string          `yaml:"apiVersion"`
+	Kind       string          `yaml:"kind"`
+	Metadata   cronJobMetadata `yaml:"metadata"`
+	Spec       cronJobSpec     `yaml:"spec"`
+}
+
+type cronJobMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type cronJobSpec struct {
+	Schedule          string `yaml:"schedule"`
+	ConcurrencyPolicy string `yaml:"concurrencyPolicy"`
+	JobTemplate       struct {
+		Spec struct {
+			BackoffLimit int `yaml:"backoffLimit"`
+			Template     struct {
+				Spec cronJobPodSpec `yaml:"spec"`
+			} `yaml:"template"`
+		} `yaml:"spec"`
+	} `yaml:"jobTemplate"`
+}
+
+type cronJobPodSpec struct {
+	RestartPolicy string             `yaml:"restartPolicy"`
+	Containers    []cronJobContainer `yaml:"containers"`
+}
+
+type cronJobContainer struct {
+	Name  string       `yaml:"name"`
+	Image string       `yaml:"image"`
+	Args  []string     `yaml:"args"`
+	Env   []cronJobEnv `yaml:"env,omitempty"`
+}
+
+type cronJobEnv struct {
+	Name      string `yaml:"name"`
+	ValueFrom struct {
+		SecretKeyRef struct {
+			Name string `yaml:"name"`
+			Key  string `yaml:"key"`
+		} `yaml:"secretKeyRef"`
+	} `yaml:"valueFrom"`
+}
+
+// newGenerateCronJobCmd defines the generate-cronjob subcommand of the purge command.
+func newGenerateCronJobCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	cronJobParams := generateCronJobParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "generate-cronjob [flags] -- <purge flags>",
+		Short:   "Print a Kubernetes CronJob that runs a purge",
+		Long:    newGenerateCronJobCmdLongMessage,
+		Example: generateCronJobExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := validatePurgeArgs(args); err != nil {
+				return err
+			}
+			job := newCronJob(cronJobParams, args)
+			jobBytes, err := yaml.Marshal(job)
+			if err != nil {
+				return err
+			}
+			_, err = out.Write(jobBytes)
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&cronJobParams.name, "name", "acr-purge", "The name of the CronJob")
+	cmd.Flags().StringVar(&cronJobParams.namespace, "namespace", "", "The namespace of the CronJob, by default the one of the kubectl context it is applied with")
+	cmd.Flags().StringVar(&cronJobParams.schedule, "schedule", "", "The schedule of the purge in cron format, e.g. \"0 2 * * *\" every night at 2:00")
+	cmd.Flags().StringVar(&cronJobParams.image, "image", cronJobImage(), "The acr-cli image the CronJob runs")
+	cmd.Flags().StringVar(&cronJobParams.secret, "secret", "", "The secret with the username and password keys of the registry credentials, without it the purge authenticates like the image does by default (e.g. with a token file)")
+	cmd.MarkFlagRequired("schedule")
+	return cmd
+}
+
+// cronJobImage returns the acr-cli image of the version of the binary, or the latest image for development builds.
+func cronJobImage() string {
+	if len(version.Version) == 0 {
+		return defaultCronJobImage + ":latest"
+	}
+	return defaultCronJobImage + ":" + strings.TrimPrefix(version.Version, "v")
+}
+
+// validatePurgeArgs parses the flags of the purge with a new command so that a mistake is reported now instead of when
+// the CronJob runs. The credentials must come from the secret so that they are not stored in the manifest.
+func validatePurgeArgs(args []string) error {
+	if len(args) == 0 {
+		return errors.New("the flags of the purge are missing, specify them after --")
+	}
+	purgeCmd, _, err := newRootCmd(nil).Find([]string{"purge"})
+	if err != nil {
+		return err
+	}
+	if err := purgeCmd.ParseFlags(args); err != nil {
+		return fmt.Errorf("invalid purge flags: %w", err)
+	}
+	if len(purgeCmd.Flags().Args()) > 0 {
+		return fmt.Errorf("unexpected purge arguments %s", strings.Join(purgeCmd.Flags().Args(), " "))
+	}
+	for _, name := range []string{"username", "password"} {
+		if purgeCmd.Flags().Changed(name) {
+			return fmt.Errorf("the %s flag cannot be embedded in the CronJob, use the secret flag instead", name)
+		}
+	}
+	if !purgeCmd.Flags().Changed("filter") && !purgeCmd.Flags().Changed("filter-file") {
+		return errors.New("either the filter or the filter-file flag is required")
+	}
+	return nil
+}
+
+// newCronJob returns the CronJob that runs the purge with the args, the credentials are expanded by Kubernetes from the
+// environment variables of the secret.
+func newCronJob(params generateCronJobParameters, args []string) cronJob {
+	container := cronJobContainer{Name: "acr-purge", Image: params.image, Args: []string{"purge"}}
+	if len(params.registryName) > 0 {
+		container.Args = append(container.Args, "--registry", params.registryName)
+	}
+	container.Args = append(container.Args, args...)
+	if len(params.secret) > 0 {
+		for _, key := range []string{cronJobUsernameKey, cronJobPasswordKey} {
+			env := cronJobEnv{Name: "ACR_" + strings.ToUpper(key)}
+			env.ValueFrom.SecretKeyRef.Name = params.secret
+			env.ValueFrom.SecretKeyRef.Key = key
+			container.Env = append(container.Env, env)
+			container.Args = append(container.Args, "--"+key, fmt.Sprintf("$(%s)", env.Name))
+		}
+	}
+	job := cronJob{
+		APIVersion: "batch/v1",
+		Kind:       "CronJob",
+		Metadata:   cronJobMetadata{Name: params.name, Namespace: params.namespace},
+	}
+	job.Spec.Schedule = params.schedule
+	// A purge that takes longer than the schedule must not run twice at the same time.
+	job.Spec.ConcurrencyPolicy = "Forbid"
+	job.Spec.JobTemplate.Spec.Template.Spec = cronJobPodSpec{RestartPolicy: "Never", Containers: []cronJobContainer{container}}
+	return job
+}
@@ -0,0 +1,56 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestGenerateCronJob(t *testing.T) {
+	// First test, the CronJob should embed the registry, the purge flags and the credentials of the secret.
+	t.Run("GenerateCronJobTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		rootParams := &rootParameters{registryName: "example"}
+		cmd := newGenerateCronJobCmd(out, rootParams)
+		cmd.SetArgs([]string{"--schedule", "0 2 * * *", "--secret", "acr-creds", "--image", "acr-cli:test", "--", "--filter", "hello-world:.*", "--ago", "7d", "--untagged"})
+		err := cmd.Execute()
+		assert.Equal(nil, err, "Error should be nil")
+		var job cronJob
+		assert.Equal(nil, yaml.Unmarshal(out.Bytes(), &job))
+		assert.Equal("CronJob", job.Kind)
+		assert.Equal("acr-purge", job.Metadata.Name)
+		assert.Equal("0 2 * * *", job.Spec.Schedule)
+		podSpec := job.Spec.JobTemplate.Spec.Template.Spec
+		assert.Equal("Never", podSpec.RestartPolicy)
+		assert.Equal(1, len(podSpec.Containers))
+		container := podSpec.Containers[0]
+		assert.Equal("acr-cli:test", container.Image)
+		assert.Equal([]string{"purge", "--registry", "example", "--filter", "hello-world:.*", "--ago", "7d", "--untagged",
+			"--username", "$(ACR_USERNAME)", "--password", "$(ACR_PASSWORD)"}, container.Args)
+		assert.Equal(2, len(container.Env))
+		assert.Equal("ACR_PASSWORD", container.Env[1].Name)
+		assert.Equal("acr-creds", container.Env[1].ValueFrom.SecretKeyRef.Name)
+		assert.Equal("password", container.Env[1].ValueFrom.SecretKeyRef.Key)
+	})
+	// Second test, invalid purge flags and credentials in the flags should return an error.
+	t.Run("InvalidPurgeFlagsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		invalidArgs := [][]string{
+			{},
+			{"--ago", "7d"},
+			{"--filter", "hello-world:.*", "--unknown"},
+			{"--filter", "hello-world:.*", "--password", "secret"},
+			{"--filter", "hello-world:.*", "extra"},
+		}
+		for _, args := range invalidArgs {
+			assert.NotEqual(nil, validatePurgeArgs(args), "Error should not be nil for %v", args)
+		}
+		assert.Equal(nil, validatePurgeArgs([]string{"--filter-file", "filters.txt", "--dry-run"}), "Error should be nil")
+	})
+}
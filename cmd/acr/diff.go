@@ -0,0 +1,233 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newDiffCmdLongMessage = `acr diff: compare the tags of two repositories, of the same registry or of two registries.
+Every repository is a [<registry>/]<repository>, the repositories without a registry are in the registry of the
+registry flag. The tags that are only in the first repository are missing, the ones that are only in the second are
+extra and the ones that reference another digest are changed. It verifies that a replica or a promotion pipeline
+copied what it had to, or what a purge is about to delete from a copy. The repositories of another registry are read
+with the other-username and other-password flags, the password can also be set with the ACR_OTHER_PASSWORD
+environment variable. With the exit-code flag the command exits with 7 if the repositories differ.`
+	diffExampleMessage = `  - Compare the staging and the production repositories of the example registry
+    acr diff -r example staging/app prod/app
+
+  - Compare a repository with its copy in another registry, only the release tags
+    acr diff -r example app backup.azurecr.io/app --filter "^v.*" --other-username backup --other-password <password>
+
+  - Fail a pipeline if the repositories differ
+    acr diff -r example staging/app prod/app --exit-code`
+)
+
+// errDifferent is returned by a diff with the exit-code flag when the repositories differ.
+var errDifferent = errors.New("the repositories differ")
+
+// diffParameters defines the parameters used by the diff command.
+type diffParameters struct {
+	*rootParameters
+	filter        string
+	otherUsername string
+	otherPassword string
+	exitCode      bool
+	output        string
+}
+
+// diffTag is a tag and the digest it references, Other is the digest of the tag in the second repository if it
+// changed.
+type diffTag struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+	Other  string `json:"otherDigest,omitempty"`
+}
+
+// tagDiff is the result of the diff command.
+type tagDiff struct {
+	Repository string    `json:"repository"`
+	Other      string    `json:"other"`
+	Missing    []diffTag `json:"missing"`
+	Extra      []diffTag `json:"extra"`
+	Changed    []diffTag `json:"changed"`
+	Identical  int       `json:"identical"`
+}
+
+// different returns true if the repositories do not have the same tags with the same digests.
+func (d tagDiff) different() bool {
+	return len(d.Missing) > 0 || len(d.Extra) > 0 || len(d.Changed) > 0
+}
+
+// newDiffCmd defines the diff command.
+func newDiffCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	diffParams := diffParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "diff <repository> <other repository>",
+		Short:   "Compare the tags of two repositories",
+		Long:    newDiffCmdLongMessage,
+		Example: diffExampleMessage,
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printer, err := newPrinter(diffParams.output)
+			if err != nil {
+				return err
+			}
+			filter, err := regexp.Compile(diffParams.filter)
+			if err != nil {
+				return fmt.Errorf("invalid filter %q: %w", diffParams.filter, err)
+			}
+			otherPassword := diffParams.otherPassword
+			if len(otherPassword) == 0 {
+				otherPassword = os.Getenv("ACR_OTHER_PASSWORD")
+			}
+			ctx := context.Background()
+			sides := make([]map[string]string, 2)
+			names := make([]string, 2)
+			for i, arg := range args {
+				host, repoName := parseDiffRepository(arg)
+				client, loginURL, err := diffParams.tagLister(host, otherPassword)
+				if err != nil {
+					return err
+				}
+				names[i] = loginURL + "/" + repoName
+				if sides[i], err = listTagDigests(ctx, client, repoName, filter); err != nil {
+					return err
+				}
+			}
+			diff := diffTags(names[0], names[1], sides[0], sides[1])
+			if printer != nil {
+				if err := printer.print(out, diff); err != nil {
+					return err
+				}
+			} else {
+				printTagDiff(out, diff)
+			}
+			if diffParams.exitCode && diff.different() {
+				return errDifferent
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&diffParams.filter, "filter", ".*", "Only compare the tags that match this regular expression")
+	cmd.Flags().StringVar(&diffParams.otherUsername, "other-username", "", "The username of the registry of the repositories that are not in the registry of the registry flag")
+	cmd.Flags().StringVar(&diffParams.otherPassword, "other-password", "", "The password of the registry of the repositories that are not in the registry of the registry flag (env ACR_OTHER_PASSWORD)")
+	cmd.Flags().BoolVar(&diffParams.exitCode, "exit-code", false, "Exit with 7 if the repositories differ")
+	addOutputFlag(cmd, &diffParams.output)
+	return cmd
+}
+
+// parseDiffRepository splits a [<registry>/]<repository> like docker pull does, the registry is empty unless the first
+// component of the path is a host.
+func parseDiffRepository(value string) (string, string) {
+	if i := strings.Index(value, "/"); i > 0 {
+		host := value[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			return host, value[i+1:]
+		}
+	}
+	return "", value
+}
+
+// tagLister returns the client of the registry of a repository and its login URL. The repositories of the registry
+// of the registry flag are read with its credentials, the others with the other-username and other-password flags.
+func (p *diffParameters) tagLister(host string, otherPassword string) (api.TagLister, string, error) {
+	if len(host) == 0 || (len(p.registryName) > 0 && host == api.LoginURL(p.registryName)) {
+		registryName, err := p.GetRegistryName()
+		if err != nil {
+			return nil, "", err
+		}
+		loginURL := api.LoginURL(registryName)
+		client, err := api.GetAcrCLIClientWithAuth(loginURL, p.username, p.password, p.configs)
+		if err != nil {
+			return nil, "", err
+		}
+		return client, loginURL, nil
+	}
+	client, err := api.NewOCIClient(host, p.otherUsername, otherPassword, p.configs)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, host, nil
+}
+
+// listTagDigests returns the digest of every tag of the repository that matches the filter, by tag. A repository that
+// does not exist has no tags.
+func listTagDigests(ctx context.Context, client api.TagLister, repoName string, filter *regexp.Regexp) (map[string]string, error) {
+	digests := map[string]string{}
+	tagPager := api.NewTagPager(client, repoName, "")
+	for !tagPager.Done() {
+		resultTags, err := tagPager.Next(ctx)
+		if err != nil {
+			if errors.Is(err, api.ErrNotFound) {
+				return digests, nil
+			}
+			return nil, fmt.Errorf("failed to list the tags of %s: %w", repoName, err)
+		}
+		if resultTags == nil || resultTags.TagsAttributes == nil {
+			break
+		}
+		for _, tag := range *resultTags.TagsAttributes {
+			if tag.Name == nil || tag.Digest == nil || !filter.MatchString(*tag.Name) {
+				continue
+			}
+			digests[*tag.Name] = *tag.Digest
+		}
+	}
+	return digests, nil
+}
+
+// diffTags compares the tags of two repositories, the tags of every list are sorted by name.
+func diffTags(repository string, other string, tags map[string]string, otherTags map[string]string) tagDiff {
+	diff := tagDiff{Repository: repository, Other: other, Missing: []diffTag{}, Extra: []diffTag{}, Changed: []diffTag{}}
+	for name, digest := range tags {
+		otherDigest, ok := otherTags[name]
+		switch {
+		case !ok:
+			diff.Missing = append(diff.Missing, diffTag{Name: name, Digest: digest})
+		case otherDigest != digest:
+			diff.Changed = append(diff.Changed, diffTag{Name: name, Digest: digest, Other: otherDigest})
+		default:
+			diff.Identical++
+		}
+	}
+	for name, digest := range otherTags {
+		if _, ok := tags[name]; !ok {
+			diff.Extra = append(diff.Extra, diffTag{Name: name, Digest: digest})
+		}
+	}
+	for _, list := range [][]diffTag{diff.Missing, diff.Extra, diff.Changed} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	}
+	return diff
+}
+
+// printTagDiff prints the differences like a diff of the second repository against the first one.
+func printTagDiff(out io.Writer, diff tagDiff) {
+	fmt.Fprintf(out, "Comparing %s with %s\n", diff.Repository, diff.Other)
+	for _, tag := range diff.Missing {
+		fmt.Fprintf(out, "- %s (%s)\n", tag.Name, tag.Digest)
+	}
+	for _, tag := range diff.Extra {
+		fmt.Fprintf(out, "+ %s (%s)\n", tag.Name, tag.Digest)
+	}
+	for _, tag := range diff.Changed {
+		fmt.Fprintf(out, "~ %s (%s -> %s)\n", tag.Name, tag.Digest, tag.Other)
+	}
+	fmt.Fprintf(out, "\nNumber of missing tags: %d\n", len(diff.Missing))
+	fmt.Fprintf(out, "Number of extra tags: %d\n", len(diff.Extra))
+	fmt.Fprintf(out, "Number of changed tags: %d\n", len(diff.Changed))
+	fmt.Fprintf(out, "Number of identical tags: %d\n", diff.Identical)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/fakeacr"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDiff contains the tests for the comparison of the tags of two repositories.
+func TestDiff(t *testing.T) {
+	registry := fakeacr.NewRegistry("user", "password")
+	defer registry.Close()
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), "user", "password", nil)
+	assert.Equal(t, nil, err, "Error should be nil")
+	acrClient.AutorestClient.Sender = registry.HTTPClient()
+	now := time.Now().UTC()
+	v1 := registry.PushImage("staging/app", "v1", now)
+	registry.Tag("prod/app", "v1", v1, now)
+	v2 := registry.PushImage("staging/app", "v2", now)
+	registry.PushImage("prod/app", "v2", now)
+	v3 := registry.PushImage("staging/app", "v3", now)
+	old := registry.PushImage("prod/app", "v0", now)
+	registry.PushImage("staging/app", "latest", now)
+	filter := regexp.MustCompile("^v.*")
+	// First test, the repositories are split like docker pull does.
+	t.Run("ParseTest", func(t *testing.T) {
+		assert := assert.New(t)
+		host, repoName := parseDiffRepository("backup.azurecr.io/team/app")
+		assert.Equal("backup.azurecr.io", host)
+		assert.Equal("team/app", repoName)
+		host, repoName = parseDiffRepository("team/app")
+		assert.Equal("", host)
+		assert.Equal("team/app", repoName)
+		host, repoName = parseDiffRepository("localhost:5000/app")
+		assert.Equal("localhost:5000", host)
+		assert.Equal("app", repoName)
+	})
+	// Second test, the tags that match the filter are missing, extra, changed or identical.
+	t.Run("DiffTest", func(t *testing.T) {
+		assert := assert.New(t)
+		staging, err := listTagDigests(testCtx, acrClient, "staging/app", filter)
+		assert.Equal(nil, err, "Error should be nil")
+		prod, err := listTagDigests(testCtx, acrClient, "prod/app", filter)
+		assert.Equal(nil, err, "Error should be nil")
+		diff := diffTags("staging/app", "prod/app", staging, prod)
+		assert.Equal([]diffTag{{Name: "v3", Digest: v3}}, diff.Missing)
+		assert.Equal([]diffTag{{Name: "v0", Digest: old}}, diff.Extra)
+		assert.Equal([]diffTag{{Name: "v2", Digest: v2, Other: prod["v2"]}}, diff.Changed)
+		assert.Equal(1, diff.Identical)
+		assert.True(diff.different())
+		var out bytes.Buffer
+		printTagDiff(&out, diff)
+		assert.Contains(out.String(), "- v3 ("+v3+")\n")
+		assert.Contains(out.String(), "+ v0 ("+old+")\n")
+		assert.Contains(out.String(), "~ v2 ("+v2+" -> "+prod["v2"]+")\n")
+		assert.Contains(out.String(), "Number of identical tags: 1\n")
+	})
+	// Third test, a repository that does not exist has no tags and a repository compared with itself is identical.
+	t.Run("IdenticalTest", func(t *testing.T) {
+		assert := assert.New(t)
+		missing, err := listTagDigests(testCtx, acrClient, "missing/app", filter)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(map[string]string{}, missing)
+		staging, _ := listTagDigests(testCtx, acrClient, "staging/app", regexp.MustCompile(".*"))
+		diff := diffTags("staging/app", "staging/app", staging, staging)
+		assert.False(diff.different())
+		assert.Equal(4, diff.Identical)
+	})
+}
@@ -0,0 +1,213 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newDoctorCmdLongMessage = `acr doctor: check purge filters against a sample of the tags of a registry before a destructive run.
+Only the first page of tags of every repository is listed in each of the name, least recently updated and most
+recently updated orders, so large repositories are not enumerated. The share of the sampled tags every filter matches
+and the ages of the matching tags are reported, filters that match more than 95% of the sample are flagged as likely
+overbroad.`
+	doctorExampleMessage = `  - Check a filter of the hello-world repository of the example.azurecr.io registry
+    acr doctor -r example --filter "hello-world:^dev-.*"
+
+  - Also count the matching tags a purge with --ago 30d would consider
+    acr doctor -r example --filter "hello-world:^dev-.*" --ago 30d
+`
+	// overbroadShare is the share of the sampled tags above which a filter is flagged as likely overbroad.
+	overbroadShare = 0.95
+)
+
+// doctorParameters defines the parameters used by the doctor command.
+type doctorParameters struct {
+	*rootParameters
+	filters []string
+	ago     string
+	before  string
+	matchOn string
+	output  string
+}
+
+// doctorReport is the output of the doctor command.
+type doctorReport struct {
+	Registry string         `json:"registry"`
+	Samples  []filterSample `json:"samples"`
+}
+
+// filterSample describes how a filter matches the sampled tags of a repository. ExpiredTags counts the matching tags
+// updated before the cutoff, it is only set if a cutoff was specified.
+type filterSample struct {
+	Repository   string         `json:"repository"`
+	Filter       string         `json:"filter"`
+	SampledTags  int            `json:"sampledTags"`
+	MatchedTags  int            `json:"matchedTags"`
+	MatchedShare float64        `json:"matchedShare"`
+	ExpiredTags  *int           `json:"expiredTags,omitempty"`
+	Buckets      []tagAgeBucket `json:"buckets"`
+	Overbroad    bool           `json:"overbroad"`
+}
+
+// newDoctorCmd defines the doctor command.
+func newDoctorCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	doctorParams := doctorParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "doctor",
+		Short:   "Check purge filters against a sample of the tags",
+		Long:    newDoctorCmdLongMessage,
+		Example: doctorExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printer, err := newPrinter(doctorParams.output)
+			if err != nil {
+				return err
+			}
+			opts := purge.NewOptions()
+			opts.SetWarningsOutput(cmd.ErrOrStderr())
+			tagFilters, err := opts.GetTagFilters(doctorParams.filters, doctorParams.matchOn)
+			if err != nil {
+				return err
+			}
+			clock := purge.SystemClock()
+			var cutoff *time.Time
+			if len(doctorParams.ago) > 0 || len(doctorParams.before) > 0 {
+				cutoffTime, err := purge.Cutoff{Ago: doctorParams.ago, Before: doctorParams.before}.Time(clock)
+				if err != nil {
+					return err
+				}
+				cutoff = &cutoffTime
+			}
+			registryName, err := doctorParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, doctorParams.username, doctorParams.password, doctorParams.configs)
+			if err != nil {
+				return err
+			}
+			report := doctorReport{Registry: loginURL, Samples: []filterSample{}}
+			repoNames := []string{}
+			for repoName := range tagFilters {
+				repoNames = append(repoNames, repoName)
+			}
+			sort.Strings(repoNames)
+			for _, repoName := range repoNames {
+				sample, err := sampleFilter(context.Background(), acrClient, clock, repoName, tagFilters[repoName], doctorParams.matchOn, cutoff)
+				if err != nil {
+					return err
+				}
+				report.Samples = append(report.Samples, sample)
+			}
+			if printer != nil {
+				return printer.print(out, report)
+			}
+			return printDoctorReport(out, report)
+		},
+	}
+	cmd.Flags().StringArrayVarP(&doctorParams.filters, "filter", "f", nil, "Specify the repository and a regular expression filter for the tag name, like the filter flag of the purge command")
+	cmd.Flags().StringVar(&doctorParams.ago, "ago", "", "Also count the matching tags that were last updated before this duration, like the ago flag of the purge command")
+	cmd.Flags().StringVar(&doctorParams.before, "before", "", "Also count the matching tags that were last updated before this date, like the before flag of the purge command")
+	cmd.Flags().StringVar(&doctorParams.matchOn, "match-on", purge.MatchOnTag, "Whether the regular expression of the filter flag is matched against the tag name (tag) or against the digest the tag references (digest)")
+	addOutputFlag(cmd, &doctorParams.output)
+	cmd.MarkFlagRequired("filter")
+	return cmd
+}
+
+// sampleFilter lists the first page of tags of a repository in every order and matches the filter against them.
+func sampleFilter(ctx context.Context, acrClient api.TagLister, clock purge.Clock, repoName string, filter string, matchOn string, cutoff *time.Time) (filterSample, error) {
+	sample := filterSample{Repository: repoName, Filter: filter}
+	regex, err := regexp.Compile(filter)
+	if err != nil {
+		return sample, fmt.Errorf("invalid filter of %s: %w", repoName, err)
+	}
+	buckets, bounds, err := newTagAgeBuckets(clock)
+	if err != nil {
+		return sample, err
+	}
+	sample.Buckets = buckets
+	if cutoff != nil {
+		sample.ExpiredTags = new(int)
+	}
+	sampled := map[string]bool{}
+	for _, orderBy := range []string{"", api.OrderByTimeAsc, api.OrderByTimeDesc} {
+		resultTags, err := api.NewTagPager(acrClient, repoName, orderBy).Next(ctx)
+		if err != nil {
+			return sample, fmt.Errorf("failed to sample the tags of %s: %w", repoName, err)
+		}
+		if resultTags == nil || resultTags.TagsAttributes == nil {
+			continue
+		}
+		for _, tag := range *resultTags.TagsAttributes {
+			if sampled[*tag.Name] {
+				continue
+			}
+			sampled[*tag.Name] = true
+			if err := sample.add(tag, regex, matchOn, bounds, cutoff); err != nil {
+				return sample, fmt.Errorf("invalid last update time of %s:%s: %w", repoName, *tag.Name, err)
+			}
+		}
+	}
+	countOlderTags(sample.Buckets)
+	if sample.SampledTags > 0 {
+		sample.MatchedShare = float64(sample.MatchedTags) / float64(sample.SampledTags)
+	}
+	sample.Overbroad = sample.MatchedShare > overbroadShare
+	return sample, nil
+}
+
+// add counts a sampled tag and, if it matches the filter, its age.
+func (s *filterSample) add(tag acr.TagAttributesBase, regex *regexp.Regexp, matchOn string, bounds []time.Time, cutoff *time.Time) error {
+	s.SampledTags++
+	value := *tag.Name
+	if matchOn == purge.MatchOnDigest {
+		value = *tag.Digest
+	}
+	if !regex.MatchString(value) {
+		return nil
+	}
+	lastUpdateTime, err := time.Parse(time.RFC3339Nano, *tag.LastUpdateTime)
+	if err != nil {
+		return err
+	}
+	s.MatchedTags++
+	s.Buckets[tagAgeBucketIndex(bounds, lastUpdateTime)].Tags++
+	if cutoff != nil && lastUpdateTime.Before(*cutoff) {
+		*s.ExpiredTags++
+	}
+	return nil
+}
+
+// printDoctorReport writes the share of the sample every filter matches, the ages of the matching tags and a warning
+// for the overbroad filters.
+func printDoctorReport(out io.Writer, report doctorReport) error {
+	for i, sample := range report.Samples {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "The filter %s of the %q repository matches %d of %d sampled tags (%.1f%%)\n", sample.Filter, sample.Repository, sample.MatchedTags, sample.SampledTags, 100*sample.MatchedShare)
+		if sample.ExpiredTags != nil {
+			fmt.Fprintf(out, "%d of the matching tags were last updated before the cutoff\n", *sample.ExpiredTags)
+		}
+		if err := printTagAgeBuckets(out, sample.Buckets); err != nil {
+			return err
+		}
+		if sample.Overbroad {
+			fmt.Fprintf(out, "Warning: the filter matches more than %.0f%% of the sampled tags, it is likely overbroad\n", 100*overbroadShare)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleFilter(t *testing.T) {
+	now := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	clock := purge.FixedClock(now)
+	newTags := func(ages map[string]time.Duration, names ...string) *acr.RepositoryTagsType {
+		tags := []acr.TagAttributesBase{}
+		for _, name := range names {
+			tagName := name
+			lastUpdateTime := now.Add(-ages[name]).Format(time.RFC3339Nano)
+			tags = append(tags, acr.TagAttributesBase{Name: &tagName, Digest: &digest, LastUpdateTime: &lastUpdateTime})
+		}
+		return &acr.RepositoryTagsType{TagsAttributes: &tags}
+	}
+	ages := map[string]time.Duration{
+		"dev-1": 100 * 24 * time.Hour,
+		"dev-2": 40 * 24 * time.Hour,
+		"dev-3": time.Hour,
+		"main":  10 * 24 * time.Hour,
+	}
+	// First test, the first page of every order is sampled once per tag and the matching tags are counted by age.
+	t.Run("SampleTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(newTags(ages, "dev-1", "dev-2"), nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "timeasc", "").Return(newTags(ages, "dev-1", "dev-2"), nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "timedesc", "").Return(newTags(ages, "dev-3", "main"), nil).Once()
+		cutoff := now.Add(-30 * 24 * time.Hour)
+		sample, err := sampleFilter(testCtx, mockClient, clock, testRepo, "^dev-.*", purge.MatchOnTag, &cutoff)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(4, sample.SampledTags)
+		assert.Equal(3, sample.MatchedTags)
+		assert.Equal(0.75, sample.MatchedShare)
+		assert.Equal(2, *sample.ExpiredTags)
+		assert.Equal(false, sample.Overbroad)
+		assert.Equal(3, sample.Buckets[0].OlderTags)
+		assert.Equal(1, sample.Buckets[4].Tags)
+		out := &bytes.Buffer{}
+		assert.Equal(nil, printDoctorReport(out, doctorReport{Samples: []filterSample{sample}}))
+		assert.Contains(out.String(), "matches 3 of 4 sampled tags (75.0%)")
+		assert.NotContains(out.String(), "Warning")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, a filter that matches almost every sampled tag is flagged.
+	t.Run("OverbroadTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(newTags(ages, "dev-1", "main"), nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "timeasc", "").Return(newTags(ages, "dev-1"), nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "timedesc", "").Return(EmptyListTagsResult, nil).Once()
+		sample, err := sampleFilter(testCtx, mockClient, clock, testRepo, ".*", purge.MatchOnTag, nil)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(true, sample.Overbroad)
+		assert.Equal((*int)(nil), sample.ExpiredTags)
+		out := &bytes.Buffer{}
+		assert.Equal(nil, printDoctorReport(out, doctorReport{Samples: []filterSample{sample}}))
+		assert.Contains(out.String(), "likely overbroad")
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, if the tags cannot be listed an error should be returned.
+	t.Run("ListTagsErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(nil, errors.New("unauthorized")).Once()
+		_, err := sampleFilter(testCtx, mockClient, clock, testRepo, ".*", purge.MatchOnTag, nil)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,149 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/purge"
+	units "github.com/docker/go-units"
+)
+
+// printDryRun writes what a dry run would delete from a repository as a table, the tags that match the filter and are
+// older than the cutoff but are kept are listed with the reason. The rows to delete are red and the kept ones green
+// when colored is set.
+func printDryRun(out io.Writer, repoPlan *purge.RepositoryPlan, now time.Time, colored bool) error {
+	header := fmt.Sprintf("Repository %s", repoPlan.Name)
+	if colored {
+		header = colorBold + header + colorReset
+	}
+	fmt.Fprintln(out, header)
+	if len(repoPlan.Tags)+len(repoPlan.Manifests)+len(repoPlan.Kept) == 0 {
+		fmt.Fprintln(out, "  Nothing to delete")
+		return nil
+	}
+	t := newTable("  ", "ACTION", "TYPE", "REFERENCE", "AGE", "SIZE", "REASON")
+	for _, tag := range repoPlan.Tags {
+		t.addRow(colorRed, "delete", "tag", *tag.Name, formatAge(now, tag.LastUpdateTime), formatSize(repoPlan.Sizes, tag.Digest), formatCoTags(repoPlan.CoTags[*tag.Name]))
+	}
+	for _, kept := range repoPlan.Kept {
+		reason := kept.Reason
+		if coTags, ok := repoPlan.CoTags[*kept.Tag.Name]; ok {
+			reason += " (" + formatCoTags(coTags) + ")"
+		}
+		t.addRow(colorGreen, "keep", "tag", *kept.Tag.Name, formatAge(now, kept.Tag.LastUpdateTime), formatSize(repoPlan.Sizes, kept.Tag.Digest), reason)
+	}
+	for _, row := range manifestTree(repoPlan) {
+		t.addRow(colorRed, "delete", row.kind, row.prefix+*row.manifest.Digest, formatAge(now, row.manifest.LastUpdateTime), formatManifestSize(row.manifest))
+	}
+	if err := t.render(out, colored); err != nil {
+		return err
+	}
+	var freed int64
+	for _, manifest := range repoPlan.Manifests {
+		if manifest.ImageSize != nil {
+			freed += *manifest.ImageSize
+		}
+	}
+	total := fmt.Sprintf("Total: %d tags and %d manifests to delete", len(repoPlan.Tags), len(repoPlan.Manifests))
+	if freed > 0 {
+		total += fmt.Sprintf(" (%s)", units.HumanSize(float64(freed)))
+	}
+	if len(repoPlan.Kept) > 0 {
+		total += fmt.Sprintf(", %d tags kept", len(repoPlan.Kept))
+	}
+	if colored {
+		total = colorBold + total + colorReset
+	}
+	_, err := fmt.Fprintf(out, "  %s\n", total)
+	return err
+}
+
+// formatAge returns the time since the last update, or - if it is not known.
+func formatAge(now time.Time, lastUpdateTime *string) string {
+	if lastUpdateTime == nil {
+		return "-"
+	}
+	updated, err := time.Parse(time.RFC3339Nano, *lastUpdateTime)
+	if err != nil {
+		return "-"
+	}
+	return units.HumanDuration(now.Sub(updated))
+}
+
+// formatSize returns the size of the manifest a tag references, or - if it is not known.
+func formatSize(sizes map[string]int64, digest *string) string {
+	if digest == nil {
+		return "-"
+	}
+	size, ok := sizes[*digest]
+	if !ok {
+		return "-"
+	}
+	return units.HumanSize(float64(size))
+}
+
+// formatCoTags returns the tags that keep the manifest of a tag reachable once it is deleted, or an empty string if
+// there are none.
+func formatCoTags(coTags []string) string {
+	if len(coTags) == 0 {
+		return ""
+	}
+	return "also tagged " + strings.Join(coTags, ", ")
+}
+
+// formatManifestSize returns the size of a manifest, or - if it is not known.
+func formatManifestSize(manifest acr.ManifestAttributesBase) string {
+	if manifest.ImageSize == nil {
+		return "-"
+	}
+	return units.HumanSize(float64(*manifest.ImageSize))
+}
+
+// manifestTreeRow is a manifest of a dry run table, the referrers are indented under the manifest they refer to.
+type manifestTreeRow struct {
+	manifest acr.ManifestAttributesBase
+	kind     string
+	prefix   string
+}
+
+// manifestTree returns the manifests of a plan with the referrers that are deleted with them under the manifest they
+// refer to, the plan lists the referrers first because they are deleted first.
+func manifestTree(repoPlan *purge.RepositoryPlan) []manifestTreeRow {
+	manifests := map[string]acr.ManifestAttributesBase{}
+	isReferrer := map[string]bool{}
+	for _, manifest := range repoPlan.Manifests {
+		manifests[*manifest.Digest] = manifest
+	}
+	for _, referrers := range repoPlan.Referrers {
+		for _, referrer := range referrers {
+			isReferrer[referrer] = true
+		}
+	}
+	rows := []manifestTreeRow{}
+	var addReferrers func(digest string, prefix string)
+	addReferrers = func(digest string, prefix string) {
+		referrers := repoPlan.Referrers[digest]
+		for i, referrer := range referrers {
+			branch, indent := "├── ", "│   "
+			if i == len(referrers)-1 {
+				branch, indent = "└── ", "    "
+			}
+			rows = append(rows, manifestTreeRow{manifest: manifests[referrer], kind: "referrer", prefix: prefix + branch})
+			addReferrers(referrer, prefix+indent)
+		}
+	}
+	for _, manifest := range repoPlan.Manifests {
+		if isReferrer[*manifest.Digest] {
+			continue
+		}
+		rows = append(rows, manifestTreeRow{manifest: manifest, kind: "manifest"})
+		addReferrers(*manifest.Digest, "")
+	}
+	return rows
+}
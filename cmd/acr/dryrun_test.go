@@ -0,0 +1,113 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPrintDryRun contains the tests for the tables of the dry runs.
+func TestPrintDryRun(t *testing.T) {
+	now := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	updated := now.Add(-72 * time.Hour).Format(time.RFC3339Nano)
+	oldTag, lockedTag := "v1", "v2"
+	size := int64(1000)
+	repoPlan := &purge.RepositoryPlan{
+		Name: "hello-world",
+		Tags: []acr.TagAttributesBase{{Name: &oldTag, Digest: &digest, LastUpdateTime: &updated}},
+		Manifests: []acr.ManifestAttributesBase{{
+			Digest:         &digest,
+			LastUpdateTime: &updated,
+			ImageSize:      &size,
+		}},
+		Kept:  []purge.KeptTag{{Tag: acr.TagAttributesBase{Name: &lockedTag, Digest: &digest1, LastUpdateTime: &updated}, Reason: purge.KeepReasonLocked}},
+		Sizes: map[string]int64{digest: size},
+	}
+	// First test, the rows are aligned and grouped under the repository with the totals.
+	t.Run("PlainTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		assert.Equal(nil, printDryRun(out, repoPlan, now, false))
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Equal(6, len(lines))
+		assert.Equal("Repository hello-world", lines[0])
+		assert.Equal("  ACTION  TYPE      REFERENCE  AGE     SIZE  REASON", lines[1])
+		assert.Equal("  delete  tag       v1         3 days  1kB", lines[2])
+		assert.Equal("  keep    tag       v2         3 days  -     locked", lines[3])
+		assert.Equal("  delete  manifest  "+digest+"    3 days  1kB", lines[4])
+		assert.Equal("  Total: 1 tags and 1 manifests to delete (1kB), 1 tags kept", lines[5])
+		assert.NotContains(out.String(), "\x1b[")
+	})
+	// Second test, the rows to delete are red and the kept ones green.
+	t.Run("ColorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		assert.Equal(nil, printDryRun(out, repoPlan, now, true))
+		assert.Contains(out.String(), colorRed+"delete  tag")
+		assert.Contains(out.String(), colorGreen+"keep    tag")
+	})
+	// Third test, an empty repository is reported without a table.
+	t.Run("EmptyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		assert.Equal(nil, printDryRun(out, &purge.RepositoryPlan{Name: "empty"}, now, false))
+		assert.Equal("Repository empty\n  Nothing to delete\n", out.String())
+	})
+	// Fourth test, colors are never used when NO_COLOR is set or the output is not a terminal.
+	t.Run("NoColorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.False(useColor(&bytes.Buffer{}))
+		os.Setenv("NO_COLOR", "1")
+		defer os.Unsetenv("NO_COLOR")
+		assert.False(useColor(os.Stdout))
+	})
+	// Fifth test, the referrers deleted with a manifest are listed under it as a tree.
+	t.Run("ReferrersTest", func(t *testing.T) {
+		assert := assert.New(t)
+		subject, signature, sbom, sbomSignature := "sha:subject", "sha:signature", "sha:sbom", "sha:sbom-signature"
+		referrersPlan := &purge.RepositoryPlan{
+			Name: "hello-world",
+			Manifests: []acr.ManifestAttributesBase{
+				{Digest: &sbomSignature, LastUpdateTime: &updated},
+				{Digest: &signature, LastUpdateTime: &updated},
+				{Digest: &sbom, LastUpdateTime: &updated},
+				{Digest: &subject, LastUpdateTime: &updated},
+			},
+			Referrers: map[string][]string{subject: {signature, sbom}, sbom: {sbomSignature}},
+		}
+		out := &bytes.Buffer{}
+		assert.Equal(nil, printDryRun(out, referrersPlan, now, false))
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Equal(7, len(lines))
+		assert.Equal("  delete  manifest  sha:subject                 3 days  -", lines[2])
+		assert.Equal("  delete  referrer  ├── sha:signature           3 days  -", lines[3])
+		assert.Equal("  delete  referrer  └── sha:sbom                3 days  -", lines[4])
+		assert.Equal("  delete  referrer      └── sha:sbom-signature  3 days  -", lines[5])
+	})
+	// Sixth test, the other tags of the digests that are only partially untagged are listed as the reason.
+	t.Run("CoTagsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		releaseTag, partialTag := "v3", "v4"
+		coTagsPlan := &purge.RepositoryPlan{
+			Name:   "hello-world",
+			Tags:   []acr.TagAttributesBase{{Name: &releaseTag, Digest: &digest, LastUpdateTime: &updated}},
+			Kept:   []purge.KeptTag{{Tag: acr.TagAttributesBase{Name: &partialTag, Digest: &digest1, LastUpdateTime: &updated}, Reason: purge.KeepReasonPartialUntag}},
+			CoTags: map[string][]string{releaseTag: {"stable"}, partialTag: {"latest", "prod"}},
+		}
+		out := &bytes.Buffer{}
+		assert.Equal(nil, printDryRun(out, coTagsPlan, now, false))
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Equal(5, len(lines))
+		assert.Equal("  delete  tag   v3         3 days  -     also tagged stable", lines[2])
+		assert.Equal("  keep    tag   v4         3 days  -     partial untag (also tagged latest, prod)", lines[3])
+	})
+}
@@ -0,0 +1,80 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/Azure/acr-cli/cmd/worker"
+)
+
+// The exit codes of the acr-cli, they are documented in the README so scripts can tell the failures apart.
+const (
+	exitSuccess        = 0
+	exitError          = 1
+	exitNothingMatched = 2
+	exitPartialFailure = 3
+	exitAuthError      = 4
+	exitThrottled      = 5
+	exitMaxDeletes     = 6
+	exitDifferent      = 7
+)
+
+// errNothingMatched is returned by a purge that did not find any tag or manifest to delete.
+var errNothingMatched = errors.New("no tags or manifests matched the filters")
+
+// partialFailureError is returned when some deletions failed after others succeeded.
+type partialFailureError struct {
+	err error
+}
+
+// Error returns the message of the wrapped error.
+func (e *partialFailureError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *partialFailureError) Unwrap() error {
+	return e.err
+}
+
+// exitCode classifies the error returned by a command. An aborted or throttled request is reported before a rejected
+// credential because the token requests are throttled too.
+func exitCode(err error) int {
+	if err == nil {
+		return exitSuccess
+	}
+	if api.IsThrottled(err) {
+		return exitThrottled
+	}
+	if api.IsAuthError(err) {
+		return exitAuthError
+	}
+	// A purge that stopped at the maximum number of deletions did delete some tags, but it did not fail.
+	if errors.Is(err, purge.ErrMaxDeletes) {
+		return exitMaxDeletes
+	}
+	var partialFailure *partialFailureError
+	if errors.As(err, &partialFailure) {
+		return exitPartialFailure
+	}
+	if errors.Is(err, errNothingMatched) {
+		return exitNothingMatched
+	}
+	if errors.Is(err, errDifferent) {
+		return exitDifferent
+	}
+	return exitError
+}
+
+// purgeError marks the error of a purge as a partial failure if any tag or manifest was deleted before it, either in
+// the repositories purged before or by the workers whose statistics are stats.
+func purgeError(err error, deleted int, stats worker.Stats) error {
+	if deleted > 0 || stats.Jobs > stats.Failed {
+		return &partialFailureError{err: err}
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/Azure/acr-cli/cmd/worker"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExitCode contains the tests for the classification of the errors returned by the commands.
+func TestExitCode(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(exitSuccess, exitCode(nil))
+	assert.Equal(exitError, exitCode(errors.New("invalid flag")))
+	assert.Equal(exitNothingMatched, exitCode(errNothingMatched))
+	assert.Equal(exitPartialFailure, exitCode(purgeError(errors.New("failed to purge tags"), 1, worker.Stats{})))
+	assert.Equal(exitAuthError, exitCode(fmt.Errorf("failed to purge tags: %w", &api.StatusError{StatusCode: http.StatusUnauthorized})))
+	assert.Equal(exitThrottled, exitCode(&partialFailureError{err: &api.StatusError{StatusCode: http.StatusTooManyRequests}}))
+	assert.Equal(exitThrottled, exitCode(fmt.Errorf("failed to purge tags: %w", context.Canceled)))
+	assert.Equal(exitMaxDeletes, exitCode(purgeError(fmt.Errorf("failed to purge tags: %w", purge.ErrMaxDeletes), 10, worker.Stats{})))
+	assert.Equal(exitDifferent, exitCode(errDifferent))
+	// No deletion succeeded so the error is not a partial failure.
+	assert.Equal(exitError, exitCode(purgeError(errors.New("failed to purge tags"), 0, worker.Stats{})))
+}
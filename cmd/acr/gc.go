@@ -0,0 +1,123 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/Azure/acr-cli/cmd/worker"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newGCCmdLongMessage = `acr gc: delete the untagged manifests of every repository of a registry.
+No tag is deleted, a manifest is only deleted if it has no tags and it is not referenced by a manifest list that has
+tags, like with the untagged flag of the purge command. The repositories are listed through the catalog, so no filter
+is needed.`
+	gcExampleMessage = `  - Delete the untagged manifests of every repository in the example.azurecr.io registry
+    acr gc -r example
+
+  - Show which untagged manifests would be deleted without deleting them
+    acr gc -r example --dry-run
+
+  - Delete the untagged manifests adapting the number of concurrent deletions to the registry
+    acr gc -r example --concurrency auto
+`
+)
+
+// gcParameters defines the parameters used by the gc command.
+type gcParameters struct {
+	*rootParameters
+	dryRun      bool
+	concurrency string
+	// minAge protects the manifests pushed recently, like the children of a manifest list that is still being pushed.
+	minAge time.Duration
+}
+
+// newGCCmd defines the gc command.
+func newGCCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	gcParams := gcParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "gc",
+		Short:   "Delete the untagged manifests of every repository",
+		Long:    newGCCmdLongMessage,
+		Example: gcExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			numWorkers, err := parseConcurrency(gcParams.concurrency)
+			if err != nil {
+				return err
+			}
+			if gcParams.minAge < 0 {
+				return errors.New("the min-age value cannot be negative")
+			}
+			registryName, err := gcParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			// Only the ACR API lists the manifests that have no tags.
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, gcParams.username, gcParams.password, gcParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			clock := purge.SystemClock()
+			opts := purge.NewOptions()
+			opts.SetMinAge(clock, gcParams.minAge)
+			if !gcParams.dryRun {
+				if numWorkers == 0 {
+					purge.StartAutoscalingDispatcher(ctx, acrClient)
+				} else {
+					purge.StartDispatcher(ctx, acrClient, numWorkers)
+				}
+				defer purge.StopDispatcher()
+			}
+			summary, err := collectGarbage(ctx, out, acrClient, loginURL, gcParams.dryRun, opts)
+			fmt.Fprintf(out, "\nNumber of deleted manifests: %d\n", summary.Deleted)
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&gcParams.dryRun, "dry-run", false, "Only print the untagged manifests that would be deleted")
+	cmd.Flags().StringVar(&gcParams.concurrency, "concurrency", strconv.Itoa(defaultNumWorkers), "The number of concurrent deletions, auto adapts it to the latency and the throttling of the registry")
+	cmd.Flags().DurationVar(&gcParams.minAge, "min-age", defaultMinAge, "Never delete manifests updated less than this duration ago (e.g. 30m), so that the manifests of images that are still being pushed are kept, 0 disables it")
+	return cmd
+}
+
+// collectGarbage deletes the untagged manifests of every repository of the registry, if dryRun is set they are only
+// printed. The returned summary adds up the summaries of all the repositories, also when an error is returned.
+func collectGarbage(ctx context.Context, out io.Writer, acrClient api.AcrCLIClientInterface, loginURL string, dryRun bool, opts *purge.Options) (purge.Summary, error) {
+	total := purge.Summary{}
+	repoNames, err := listRepositories(ctx, acrClient)
+	if err != nil {
+		return total, err
+	}
+	for _, repoName := range repoNames {
+		summary := purge.Summary{}
+		if dryRun {
+			var manifests *[]acr.ManifestAttributesBase
+			manifests, err = purge.GetManifestsToDelete(ctx, acrClient, repoName, opts)
+			if err == nil {
+				for _, manifest := range *manifests {
+					fmt.Fprintf(out, "%s/%s@%s\n", loginURL, repoName, *manifest.Digest)
+				}
+				summary.Deleted = len(*manifests)
+			}
+		} else {
+			summary, err = purge.DanglingManifests(ctx, acrClient, loginURL, repoName, opts)
+		}
+		total.Add(summary)
+		if err != nil {
+			return total, purgeError(fmt.Errorf("failed to delete the untagged manifests of %s: %w", repoName, err), total.Deleted, worker.GetStats())
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCollectGarbage contains the tests for the gc command.
+func TestCollectGarbage(t *testing.T) {
+	// First test, the dry run prints the untagged manifests of every repository and keeps the tagged ones.
+	t.Run("DryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositories", testCtx, "").Return(&acr.Repositories{Names: &[]string{testRepo, "tagged"}}, nil).Once()
+		mockClient.On("GetAcrRepositories", testCtx, "tagged").Return(&acr.Repositories{}, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", digest2).Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "tagged", "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "tagged", "", digest).Return(EmptyListManifestsResult, nil).Once()
+		out := &bytes.Buffer{}
+		summary, err := collectGarbage(testCtx, out, mockClient, testLoginURL, true, purge.NewOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, summary.Deleted)
+		assert.Equal(testLoginURL+"/"+testRepo+"@"+digest1+"\n"+testLoginURL+"/"+testRepo+"@"+digest2+"\n", out.String())
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, an error while listing the manifests of a repository stops the gc and names the repository.
+	t.Run("ListManifestsErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositories", testCtx, "").Return(&acr.Repositories{Names: &[]string{testRepo}}, nil).Once()
+		mockClient.On("GetAcrRepositories", testCtx, testRepo).Return(&acr.Repositories{}, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(nil, errors.New("forbidden")).Once()
+		_, err := collectGarbage(testCtx, &bytes.Buffer{}, mockClient, testLoginURL, true, purge.NewOptions())
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), testRepo)
+		mockClient.AssertExpectations(t)
+	})
+}
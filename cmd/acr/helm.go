@@ -0,0 +1,199 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newHelmCmdLongMessage       = `acr helm: list and delete the versions of the Helm charts stored in a registry.`
+	newHelmListCmdLongMessage   = `acr helm list: outputs the versions of the Helm chart stored in a repository from the newest to the oldest`
+	newHelmDeleteCmdLongMessage = `acr helm delete: delete versions of the Helm chart stored in a repository, either the specified ones or all
+but the newest ones. The versions are ordered by semantic version, versions that are not semantic versions are only
+deleted when they are specified. The chart of a version is deleted unless another tag that is not deleted references it.`
+	helmDeleteExampleMessage = `  - Keep the 5 newest versions of the charts/hello-world chart
+    acr helm delete -r MyRegistry --repository charts/hello-world --keep 5
+
+  - Delete two versions of the chart
+    acr helm delete -r MyRegistry --repository charts/hello-world 0.1.0 0.2.0-rc.1`
+)
+
+// Besides the registry name and authentication information the repository of the chart is needed.
+type helmParameters struct {
+	*rootParameters
+	repoName string
+	output   string
+	keep     int
+	dryRun   bool
+}
+
+// The helm command lists and deletes the versions of a chart, a chart is stored in a repository named after it.
+func newHelmCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	helmParams := helmParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:   "helm",
+		Short: "Manage the Helm charts of a registry",
+		Long:  newHelmCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Help()
+			return nil
+		},
+	}
+
+	cmd.AddCommand(
+		newHelmListCmd(out, &helmParams),
+		newHelmDeleteCmd(out, &helmParams),
+	)
+	cmd.PersistentFlags().StringVar(&helmParams.repoName, "repository", "", "The repository of the chart (e.g. charts/hello-world)")
+	cmd.MarkPersistentFlagRequired("repository")
+
+	return cmd
+}
+
+// newHelmListCmd creates the helm list command.
+func newHelmListCmd(out io.Writer, helmParams *helmParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the versions of a Helm chart",
+		Long:  newHelmListCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printer, err := newPrinter(helmParams.output)
+			if err != nil {
+				return err
+			}
+			registryName, err := helmParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, helmParams.username, helmParams.password, helmParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			return listHelmCharts(ctx, out, acrClient, loginURL, helmParams.repoName, printer)
+		},
+	}
+	addOutputFlag(cmd, &helmParams.output)
+	return cmd
+}
+
+// helmChartList is the output of the helm list command when an output format is selected.
+type helmChartList struct {
+	Registry   string               `json:"registry"`
+	Repository string               `json:"repository"`
+	Versions   []purge.ChartVersion `json:"versions"`
+}
+
+// listHelmCharts prints the versions of the chart stored in the repository, newest first.
+func listHelmCharts(ctx context.Context, out io.Writer, acrClient api.ManifestLister, loginURL string, repoName string, printer *printer) error {
+	versions, err := purge.HelmChartVersions(ctx, acrClient, repoName)
+	if err != nil {
+		return err
+	}
+	if printer != nil {
+		return printer.print(out, helmChartList{Registry: loginURL, Repository: repoName, Versions: versions})
+	}
+	fmt.Fprintf(out, "Listing the versions of the Helm chart in the %q repository:\n", repoName)
+	for _, version := range versions {
+		fmt.Fprintf(out, "%s %s %s/%s@%s %s\n", version.Chart, version.Version, loginURL, repoName, version.Digest, version.LastUpdateTime)
+	}
+	return nil
+}
+
+// newHelmDeleteCmd creates the helm delete command, it receives the versions to delete as arguments unless the keep
+// flag is used.
+func newHelmDeleteCmd(out io.Writer, helmParams *helmParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "delete [versions]",
+		Short:   "Delete versions of a Helm chart",
+		Long:    newHelmDeleteCmdLongMessage,
+		Example: helmDeleteExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keepSet := cmd.Flags().Changed("keep")
+			if keepSet == (len(args) > 0) {
+				return errors.New("either the versions to delete or the keep flag have to be specified")
+			}
+			if keepSet && helmParams.keep < 1 {
+				return errors.New("the keep value has to be at least 1, specify the versions to delete them all")
+			}
+			registryName, err := helmParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, helmParams.username, helmParams.password, helmParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			return deleteHelmCharts(ctx, out, acrClient, loginURL, helmParams.repoName, args, helmParams.keep, helmParams.dryRun)
+		},
+	}
+	cmd.Flags().IntVar(&helmParams.keep, "keep", 0, "Delete all the versions of the chart except this number of the newest ones")
+	cmd.Flags().BoolVar(&helmParams.dryRun, "dry-run", false, "Print the versions that would be deleted without deleting them")
+	return cmd
+}
+
+// deleteHelmCharts deletes the specified versions of the chart, or all but the keep newest ones if no version is
+// specified. The manifest of a version is deleted if all its tags are deleted, otherwise only the tags are.
+func deleteHelmCharts(ctx context.Context, out io.Writer, acrClient api.AcrCLIClientInterface, loginURL string, repoName string, versionNames []string, keep int, dryRun bool) error {
+	versions, err := purge.HelmChartVersions(ctx, acrClient, repoName)
+	if err != nil {
+		return err
+	}
+	toDelete := []purge.ChartVersion{}
+	if len(versionNames) == 0 {
+		toDelete = purge.ChartVersionsToDelete(versions, keep)
+	}
+	for _, name := range versionNames {
+		found := false
+		for _, version := range versions {
+			if version.Version == name || version.Tag == name {
+				toDelete = append(toDelete, version)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("version %s of the chart in repository %s not found", name, repoName)
+		}
+	}
+
+	deletedTags := map[string]map[string]bool{}
+	for _, version := range toDelete {
+		if deletedTags[version.Digest] == nil {
+			deletedTags[version.Digest] = map[string]bool{}
+		}
+		deletedTags[version.Digest][version.Tag] = true
+	}
+	deletedManifests := map[string]bool{}
+	for _, version := range toDelete {
+		if dryRun {
+			fmt.Fprintf(out, "Would delete %s %s %s/%s:%s\n", version.Chart, version.Version, loginURL, repoName, version.Tag)
+			continue
+		}
+		if len(deletedTags[version.Digest]) == len(version.Tags) {
+			// Every tag of the manifest is deleted, so the chart itself is deleted with all of them.
+			if !deletedManifests[version.Digest] {
+				if _, err := acrClient.DeleteManifest(ctx, repoName, version.Digest); err != nil {
+					return fmt.Errorf("failed to delete version %s of the chart: %w", version.Version, err)
+				}
+				deletedManifests[version.Digest] = true
+			}
+		} else if _, err := acrClient.DeleteAcrTag(ctx, repoName, version.Tag); err != nil {
+			return fmt.Errorf("failed to delete version %s of the chart: %w", version.Version, err)
+		}
+		fmt.Fprintf(out, "Deleted %s %s %s/%s:%s\n", version.Chart, version.Version, loginURL, repoName, version.Tag)
+	}
+	return nil
+}
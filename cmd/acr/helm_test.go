@@ -0,0 +1,74 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteHelmCharts(t *testing.T) {
+	helmConfigMediaType := purge.HelmChartConfigMediaType
+	digests := []string{"sha:1", "sha:2", "sha:3"}
+	chartsResult := &acr.Manifests{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+			Digest:          &digests[0],
+			ConfigMediaType: &helmConfigMediaType,
+			Tags:            &[]string{"1.0.0"},
+		}, {
+			Digest:          &digests[1],
+			ConfigMediaType: &helmConfigMediaType,
+			Tags:            &[]string{"1.1.0", "stable"},
+		}, {
+			Digest:          &digests[2],
+			ConfigMediaType: &helmConfigMediaType,
+			Tags:            &[]string{"2.0.0"},
+		}},
+	}
+	emptyResult := &acr.Manifests{Registry: &testLoginURL, ImageName: &testRepo}
+	// First test, the older versions are deleted, the chart of a version is kept if another tag references it.
+	t.Run("KeepNewestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(chartsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:3").Return(emptyResult, nil).Once()
+		mockClient.On("DeleteAcrTag", testCtx, testRepo, "1.1.0").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteManifest", testCtx, testRepo, "sha:1").Return(&deletedResponse, nil).Once()
+		out := &bytes.Buffer{}
+		err := deleteHelmCharts(testCtx, out, mockClient, testLoginURL, testRepo, nil, 1, false)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("Deleted bar 1.1.0 foo.azurecr.io/bar:1.1.0\nDeleted bar 1.0.0 foo.azurecr.io/bar:1.0.0\n", out.String())
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, a dry run only prints the specified versions.
+	t.Run("DryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(chartsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:3").Return(emptyResult, nil).Once()
+		out := &bytes.Buffer{}
+		err := deleteHelmCharts(testCtx, out, mockClient, testLoginURL, testRepo, []string{"2.0.0"}, 0, true)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("Would delete bar 2.0.0 foo.azurecr.io/bar:2.0.0\n", out.String())
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, a version that does not exist should return an error before anything is deleted.
+	t.Run("VersionNotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(chartsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:3").Return(emptyResult, nil).Once()
+		err := deleteHelmCharts(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo, []string{"1.0.0", "3.0.0"}, 0, false)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,313 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newImageCmdLongMessage        = `acr image: inspect the images of a repository.`
+	newImageInspectCmdLongMessage = `acr image inspect: fetch the manifest and the config of an image and print the details of the config, like the
+labels, the environment, the entrypoint and the time it was created, and the layers with their sizes. The image of a
+platform is selected with the platform flag when the reference is an index of several images.`
+	imageInspectExampleMessage = `  - Inspect the hello-world:latest image of the example.azurecr.io registry
+    acr image inspect -r example hello-world:latest
+
+  - Inspect the linux/arm64 image of a multi-arch image and print it as JSON
+    acr image inspect -r example hello-world:latest --platform linux/arm64 -o json`
+)
+
+// imageParameters are the flags of the image inspect command.
+type imageParameters struct {
+	*rootParameters
+	platform string
+	output   string
+}
+
+// newImageCmd defines the image command, it only groups the image subcommands.
+func newImageCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	imageParams := imageParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:   "image",
+		Short: "Inspect the images of a repository",
+		Long:  newImageCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Help()
+			return nil
+		},
+	}
+	cmd.AddCommand(newImageInspectCmd(out, &imageParams))
+	return cmd
+}
+
+// newImageInspectCmd defines the image inspect subcommand, it receives the image as <repository>:<tag> or
+// <repository>@<digest>.
+func newImageInspectCmd(out io.Writer, imageParams *imageParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "inspect <repository>:<tag>",
+		Short:   "Print the config and the layers of an image",
+		Long:    newImageInspectCmdLongMessage,
+		Example: imageInspectExampleMessage,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printer, err := newPrinter(imageParams.output)
+			if err != nil {
+				return err
+			}
+			registryName, err := imageParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, imageParams.username, imageParams.password, imageParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			inspection, err := inspectImage(ctx, acrClient, loginURL, args[0], imageParams.platform)
+			if err != nil {
+				return err
+			}
+			if printer != nil {
+				return printer.print(out, inspection)
+			}
+			return printImageInspection(out, inspection)
+		},
+	}
+	cmd.Flags().StringVar(&imageParams.platform, "platform", "", "The platform of the image to inspect when the reference is an index, in the form os/arch[/variant] (e.g. linux/arm64)")
+	addOutputFlag(cmd, &imageParams.output)
+	return cmd
+}
+
+// imageInspection is the output of the image inspect command.
+type imageInspection struct {
+	Reference    string            `json:"reference"`
+	Digest       string            `json:"digest"`
+	MediaType    string            `json:"mediaType"`
+	Platform     string            `json:"platform"`
+	Created      string            `json:"created,omitempty"`
+	Author       string            `json:"author,omitempty"`
+	User         string            `json:"user,omitempty"`
+	WorkingDir   string            `json:"workingDir,omitempty"`
+	Entrypoint   []string          `json:"entrypoint"`
+	Cmd          []string          `json:"cmd"`
+	Env          []string          `json:"env"`
+	ExposedPorts []string          `json:"exposedPorts"`
+	Labels       map[string]string `json:"labels"`
+	Layers       []imageLayer      `json:"layers"`
+	// Size is the size of the config and the layers.
+	Size int64 `json:"size"`
+}
+
+// imageLayer is a layer of an image and the instruction that created it, if the history of the image has it.
+type imageLayer struct {
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+	CreatedBy string `json:"createdBy,omitempty"`
+}
+
+// imageConfig contains the fields of the docker and OCI image configs that are inspected.
+type imageConfig struct {
+	Created      string `json:"created"`
+	Author       string `json:"author"`
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant"`
+	Config       struct {
+		User         string              `json:"User"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+		Env          []string            `json:"Env"`
+		Entrypoint   []string            `json:"Entrypoint"`
+		Cmd          []string            `json:"Cmd"`
+		WorkingDir   string              `json:"WorkingDir"`
+		Labels       map[string]string   `json:"Labels"`
+	} `json:"config"`
+	History []struct {
+		CreatedBy  string `json:"created_by"`
+		EmptyLayer bool   `json:"empty_layer"`
+	} `json:"history"`
+}
+
+// inspectImage fetches the manifest of the reference, the image of the platform if it is an index, and its config.
+func inspectImage(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, reference string, platform string) (*imageInspection, error) {
+	repoName, ref, _, err := parseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	manifestBytes, err := acrClient.GetManifest(ctx, repoName, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest of %s: %w", reference, err)
+	}
+	var manifest artifactManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest of %s: %w", reference, err)
+	}
+	if manifest.MediaType == ociIndexContentType || manifest.MediaType == dockerManifestListContentType || len(manifest.Manifests) > 0 {
+		digest, err := selectPlatform(manifest.Manifests, platform, reference)
+		if err != nil {
+			return nil, err
+		}
+		manifestBytes, err = acrClient.GetManifest(ctx, repoName, digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get manifest %s: %w", digest, err)
+		}
+		manifest = artifactManifest{}
+		if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest %s: %w", digest, err)
+		}
+	}
+	if manifest.Config.MediaType != ociImageConfigContentType && manifest.Config.MediaType != dockerImageConfigContentType {
+		return nil, fmt.Errorf("%s is not an image, the media type of its config is %q", reference, manifest.Config.MediaType)
+	}
+	configBytes, err := acrClient.GetBlob(ctx, repoName, manifest.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the config of %s: %w", reference, err)
+	}
+	var config imageConfig
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the config of %s: %w", reference, err)
+	}
+
+	inspection := &imageInspection{
+		Reference:    fmt.Sprintf("%s/%s", loginURL, reference),
+		Digest:       computeDigest(manifestBytes),
+		MediaType:    manifest.MediaType,
+		Platform:     formatPlatform(config.OS, config.Architecture, config.Variant),
+		Created:      config.Created,
+		Author:       config.Author,
+		User:         config.Config.User,
+		WorkingDir:   config.Config.WorkingDir,
+		Entrypoint:   config.Config.Entrypoint,
+		Cmd:          config.Config.Cmd,
+		Env:          config.Config.Env,
+		ExposedPorts: []string{},
+		Labels:       config.Config.Labels,
+		Layers:       []imageLayer{},
+		Size:         manifest.Config.Size,
+	}
+	for port := range config.Config.ExposedPorts {
+		inspection.ExposedPorts = append(inspection.ExposedPorts, port)
+	}
+	sort.Strings(inspection.ExposedPorts)
+	// The history has an entry for every instruction, only the ones that are not empty created a layer.
+	createdBy := []string{}
+	for _, entry := range config.History {
+		if !entry.EmptyLayer {
+			createdBy = append(createdBy, entry.CreatedBy)
+		}
+	}
+	for i, layer := range manifest.Layers {
+		imageLayer := imageLayer{Digest: layer.Digest, MediaType: layer.MediaType, Size: layer.Size}
+		if len(createdBy) == len(manifest.Layers) {
+			imageLayer.CreatedBy = createdBy[i]
+		}
+		inspection.Layers = append(inspection.Layers, imageLayer)
+		inspection.Size += layer.Size
+	}
+	return inspection, nil
+}
+
+// selectPlatform returns the digest of the image of the platform in an index, the platform can be omitted if the index
+// only has one image.
+func selectPlatform(descriptors []artifactDescriptor, platform string, reference string) (string, error) {
+	platforms := []string{}
+	for _, descriptor := range descriptors {
+		if descriptor.Platform == nil {
+			continue
+		}
+		descriptorPlatform := formatPlatform(descriptor.Platform.OS, descriptor.Platform.Architecture, descriptor.Platform.Variant)
+		if descriptorPlatform == platform || (len(descriptor.Platform.Variant) > 0 && formatPlatform(descriptor.Platform.OS, descriptor.Platform.Architecture, "") == platform) {
+			return descriptor.Digest, nil
+		}
+		platforms = append(platforms, descriptorPlatform)
+	}
+	if len(platform) == 0 && len(descriptors) == 1 {
+		return descriptors[0].Digest, nil
+	}
+	if len(platform) == 0 {
+		return "", fmt.Errorf("%s is an index, select one of its platforms with the platform flag: %s", reference, strings.Join(platforms, ", "))
+	}
+	return "", fmt.Errorf("%s does not have an image for %s, its platforms are: %s", reference, platform, strings.Join(platforms, ", "))
+}
+
+// formatPlatform returns the platform in the form os/arch[/variant].
+func formatPlatform(os string, architecture string, variant string) string {
+	platform := os + "/" + architecture
+	if len(variant) > 0 {
+		platform += "/" + variant
+	}
+	return platform
+}
+
+// printImageInspection prints the details of the image config followed by the table of the layers.
+func printImageInspection(out io.Writer, inspection *imageInspection) error {
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"Reference", inspection.Reference},
+		{"Digest", inspection.Digest},
+		{"Platform", inspection.Platform},
+		{"Created", inspection.Created},
+		{"Author", inspection.Author},
+		{"User", inspection.User},
+		{"Working dir", inspection.WorkingDir},
+		{"Entrypoint", formatCommand(inspection.Entrypoint)},
+		{"Cmd", formatCommand(inspection.Cmd)},
+		{"Exposed ports", strings.Join(inspection.ExposedPorts, ", ")},
+		{"Size", units.HumanSize(float64(inspection.Size))},
+	}
+	for _, field := range fields {
+		if len(field.value) > 0 {
+			fmt.Fprintf(out, "%-15s%s\n", field.name+":", field.value)
+		}
+	}
+	if len(inspection.Env) > 0 {
+		fmt.Fprintln(out, "Env:")
+		for _, env := range inspection.Env {
+			fmt.Fprintf(out, "  %s\n", env)
+		}
+	}
+	if len(inspection.Labels) > 0 {
+		fmt.Fprintln(out, "Labels:")
+		keys := []string{}
+		for key := range inspection.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(out, "  %s=%s\n", key, inspection.Labels[key])
+		}
+	}
+	fmt.Fprintln(out, "Layers:")
+	t := newTable("  ", "DIGEST", "SIZE", "CREATED BY")
+	for _, layer := range inspection.Layers {
+		t.addRow(colorNone, layer.Digest, units.HumanSize(float64(layer.Size)), layer.CreatedBy)
+	}
+	return t.render(out, false)
+}
+
+// formatCommand returns the arguments of an entrypoint or a command as a JSON array, as they are written in a
+// Dockerfile, or an empty string if there are none.
+func formatCommand(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	formatted, err := json.Marshal(args)
+	if err != nil {
+		return strings.Join(args, " ")
+	}
+	return string(formatted)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestInspectImage contains the tests for the image inspect command.
+func TestInspectImage(t *testing.T) {
+	config := []byte(`{"created":"2020-01-15T12:00:00Z","architecture":"arm64","os":"linux","variant":"v8","config":{"User":"app","Env":["PATH=/usr/bin"],"Entrypoint":["/hello"],"Cmd":["--port","80"],"WorkingDir":"/app","ExposedPorts":{"80/tcp":{}},"Labels":{"org.opencontainers.image.source":"https://github.com/example/hello","maintainer":"example"}},"history":[{"created_by":"ADD rootfs /"},{"created_by":"ENV PATH=/usr/bin","empty_layer":true},{"created_by":"COPY hello /hello"}]}`)
+	configDigest := computeDigest(config)
+	image := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":%q,"size":%d},"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:aaa","size":2000000},{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:bbb","size":1000}]}`, configDigest, len(config)))
+	imageDigest := computeDigest(image)
+	index := []byte(fmt.Sprintf(`{"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"digest":"sha256:ccc","platform":{"os":"linux","architecture":"amd64"}},{"digest":%q,"platform":{"os":"linux","architecture":"arm64","variant":"v8"}}]}`, imageDigest))
+	// First test, the config of the image of the platform is inspected and printed.
+	t.Run("IndexTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", testCtx, testRepo, "latest").Return(index, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, imageDigest).Return(image, nil).Once()
+		mockClient.On("GetBlob", testCtx, testRepo, configDigest).Return(config, nil).Once()
+		inspection, err := inspectImage(testCtx, mockClient, testLoginURL, testRepo+":latest", "linux/arm64")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(imageDigest, inspection.Digest)
+		assert.Equal("linux/arm64/v8", inspection.Platform)
+		assert.Equal([]string{"80/tcp"}, inspection.ExposedPorts)
+		assert.Equal("example", inspection.Labels["maintainer"])
+		assert.Equal(2, len(inspection.Layers))
+		assert.Equal("COPY hello /hello", inspection.Layers[1].CreatedBy)
+		assert.Equal(int64(2001000+len(config)), inspection.Size)
+		out := &bytes.Buffer{}
+		assert.Equal(nil, printImageInspection(out, inspection))
+		assert.Contains(out.String(), "Entrypoint:    [\"/hello\"]\n")
+		assert.Contains(out.String(), "Labels:\n  maintainer=example\n  org.opencontainers.image.source=https://github.com/example/hello\n")
+		assert.Contains(out.String(), "  sha256:aaa  2MB   ADD rootfs /\n")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, an index of several images requires the platform flag.
+	t.Run("PlatformRequiredTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", testCtx, testRepo, "latest").Return(index, nil).Once()
+		_, err := inspectImage(testCtx, mockClient, testLoginURL, testRepo+":latest", "")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), "linux/amd64, linux/arm64/v8")
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, an artifact that is not an image cannot be inspected.
+	t.Run("NotImageTest", func(t *testing.T) {
+		assert := assert.New(t)
+		chart := []byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.cncf.helm.config.v1+json","digest":"sha256:ddd"}}`)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", testCtx, testRepo, "1.0.0").Return(chart, nil).Once()
+		_, err := inspectImage(testCtx, mockClient, testLoginURL, testRepo+":1.0.0", "")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), "is not an image")
+		mockClient.AssertExpectations(t)
+	})
+}
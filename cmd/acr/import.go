@@ -0,0 +1,362 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newImportCmdLongMessage = `acr import: import an image of another registry, e.g. Docker Hub or MCR, into the registry.
+The source is an image reference like the ones of docker pull, the images of Docker Hub can omit the registry and the
+library namespace. The target is a <repository>:<tag> of the registry, by default the repository and the tag of the
+source. With the resource group of the registry the image is imported with the import API of Azure Resource Manager,
+the registry copies it itself and the Azure credentials are read like in the token command. Otherwise the acr-cli
+copies every manifest and blob of the image with the credentials of the registry. The credentials of the source
+registry are only needed for private images, the password can also be set with the ACR_SOURCE_PASSWORD environment
+variable.`
+	importExampleMessage = `  - Import nginx:1.25 from Docker Hub into the example registry
+    acr import -r example --source docker.io/library/nginx:1.25 --target nginx:1.25
+
+  - Import an image of MCR with the import API of the registry
+    acr import -r example -g example-rg --source mcr.microsoft.com/dotnet/runtime:8.0
+
+  - Import a private image with the credentials of its registry
+    acr import -r example --source other.azurecr.io/app:v1 --target app:v1 --source-username other --source-password <password>`
+	// dockerHubRegistry is the registry of the images without a registry, dockerHubAPIHost is the host of its API.
+	dockerHubRegistry = "docker.io"
+	dockerHubAPIHost  = "registry-1.docker.io"
+	// dockerHubOfficialNamespace is the namespace of the official images of Docker Hub, e.g. library/nginx.
+	dockerHubOfficialNamespace = "library/"
+	// foreignLayerContentType is the media type of the layers that are not distributed by the registries, they are
+	// downloaded from their URLs instead.
+	foreignLayerContentType = "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip"
+)
+
+// importParameters defines the parameters used by the import command.
+type importParameters struct {
+	*rootParameters
+	source         string
+	target         string
+	sourceUsername string
+	sourcePassword string
+	subscription   string
+	resourceGroup  string
+	force          bool
+}
+
+// importSource is the parsed reference of the image to import.
+type importSource struct {
+	registry  string
+	repoName  string
+	reference string
+	isDigest  bool
+}
+
+// image returns the repository and the tag or the digest of the source, e.g. library/nginx:1.25.
+func (s importSource) image() string {
+	if s.isDigest {
+		return s.repoName + "@" + s.reference
+	}
+	return s.repoName + ":" + s.reference
+}
+
+// apiHost returns the host the API of the source registry is reached at.
+func (s importSource) apiHost() string {
+	if s.registry == dockerHubRegistry {
+		return dockerHubAPIHost
+	}
+	return s.registry
+}
+
+// artifactSource contains the methods used to read the image from the source registry.
+type artifactSource interface {
+	GetManifest(ctx context.Context, repoName string, reference string) ([]byte, error)
+	GetBlob(ctx context.Context, repoName string, digest string) ([]byte, error)
+}
+
+// artifactTarget contains the methods used to write the image to the registry.
+type artifactTarget interface {
+	GetManifest(ctx context.Context, repoName string, reference string) ([]byte, error)
+	PutBlob(ctx context.Context, repoName string, digest string, content []byte) error
+	PutManifest(ctx context.Context, repoName string, reference string, mediaType string, manifestBytes []byte) (*autorest.Response, error)
+}
+
+// blobMounter is implemented by the targets that can reference the blobs of another repository of the same registry
+// instead of copying them.
+type blobMounter interface {
+	mountBlob(ctx context.Context, repoName string, digest string) (bool, error)
+}
+
+// newImportCmd defines the import command.
+func newImportCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	importParams := importParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "import",
+		Short:   "Import an image of another registry",
+		Long:    newImportCmdLongMessage,
+		Example: importExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registryName, err := importParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			source, err := parseImportSource(importParams.source)
+			if err != nil {
+				return err
+			}
+			targetRepo, targetTag, err := importTarget(source, importParams.target)
+			if err != nil {
+				return err
+			}
+			sourcePassword := importParams.sourcePassword
+			if len(sourcePassword) == 0 {
+				sourcePassword = os.Getenv("ACR_SOURCE_PASSWORD")
+			}
+			ctx := context.Background()
+			if len(importParams.resourceGroup) > 0 {
+				managementClient, err := newManagementClient(importParams.rootParameters, importParams.subscription, importParams.resourceGroup)
+				if err != nil {
+					return err
+				}
+				managementSource := newManagementImportSource(source, importParams.sourceUsername, sourcePassword)
+				if err := managementClient.ImportImage(ctx, managementSource, []string{targetRepo + ":" + targetTag}, importParams.force); err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "Imported %s/%s to %s/%s:%s\n", source.registry, source.image(), loginURL, targetRepo, targetTag)
+				return nil
+			}
+			sourceClient, err := api.NewOCIClient(source.apiHost(), importParams.sourceUsername, sourcePassword, importParams.configs)
+			if err != nil {
+				return err
+			}
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, importParams.username, importParams.password, importParams.configs)
+			if err != nil {
+				return err
+			}
+			digest, err := copyImage(ctx, sourceClient, acrClient, source.repoName, source.reference, targetRepo, targetTag, importParams.force)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Imported %s/%s to %s/%s:%s (%s)\n", source.registry, source.image(), loginURL, targetRepo, targetTag, digest)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&importParams.source, "source", "", "The image to import, e.g. docker.io/library/nginx:1.25, nginx:1.25 or mcr.microsoft.com/dotnet/runtime@sha256:<digest>")
+	cmd.Flags().StringVar(&importParams.target, "target", "", "The <repository>:<tag> the image is imported to, by default the repository and the tag of the source")
+	cmd.Flags().StringVar(&importParams.sourceUsername, "source-username", "", "The username of the source registry")
+	cmd.Flags().StringVar(&importParams.sourcePassword, "source-password", "", "The password of the source registry (env ACR_SOURCE_PASSWORD)")
+	cmd.Flags().StringVar(&importParams.subscription, "subscription", "", "The subscription of the registry (env AZURE_SUBSCRIPTION_ID)")
+	cmd.Flags().StringVarP(&importParams.resourceGroup, "resource-group", "g", "", "The resource group of the registry, if set the image is imported with the import API of Azure Resource Manager")
+	cmd.Flags().BoolVar(&importParams.force, "force", false, "Move the target tag if it already references another image")
+	cmd.MarkFlagRequired("source")
+	return cmd
+}
+
+// parseImportSource parses an image reference like docker pull does: the registry is Docker Hub unless the first
+// component of the path is a host, the official images of Docker Hub are in the library namespace and the tag is
+// latest if there is neither a tag nor a digest.
+func parseImportSource(reference string) (importSource, error) {
+	source := importSource{registry: dockerHubRegistry}
+	path := reference
+	if i := strings.Index(reference, "/"); i > 0 {
+		host := reference[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			source.registry, path = host, reference[i+1:]
+		}
+	}
+	if source.registry == "index.docker.io" {
+		source.registry = dockerHubRegistry
+	}
+	name := path[strings.LastIndex(path, "/")+1:]
+	if !strings.Contains(path, "@") && !strings.Contains(name, ":") {
+		path += ":latest"
+	}
+	repoName, ref, isDigest, err := parseReference(path)
+	if err != nil {
+		return importSource{}, fmt.Errorf("invalid source %q: %w", reference, err)
+	}
+	if source.registry == dockerHubRegistry && !strings.Contains(repoName, "/") {
+		repoName = dockerHubOfficialNamespace + repoName
+	}
+	source.repoName, source.reference, source.isDigest = repoName, ref, isDigest
+	return source, nil
+}
+
+// importTarget returns the repository and the tag the source is imported to, by default the ones of the source without
+// the library namespace of Docker Hub.
+func importTarget(source importSource, target string) (string, string, error) {
+	if len(target) == 0 {
+		if source.isDigest {
+			return "", "", errors.New("the target flag is required to import an image by digest")
+		}
+		repoName := source.repoName
+		if source.registry == dockerHubRegistry {
+			repoName = strings.TrimPrefix(repoName, dockerHubOfficialNamespace)
+		}
+		return repoName, source.reference, nil
+	}
+	repoName, tag, isDigest, err := parseReference(target)
+	if err != nil {
+		return "", "", err
+	}
+	if isDigest {
+		return "", "", fmt.Errorf("invalid target %q, expected <repository>:<tag>", target)
+	}
+	return repoName, tag, nil
+}
+
+// newManagementImportSource returns the source of the import API, the credentials are only set if there is a password.
+func newManagementImportSource(source importSource, username string, password string) api.ImportSource {
+	managementSource := api.ImportSource{RegistryURI: source.registry, SourceImage: source.image()}
+	if len(password) > 0 {
+		managementSource.Credentials = &api.ImportSourceCredentials{Username: username, Password: password}
+	}
+	return managementSource
+}
+
+// copyImage copies the manifest of the reference with its blobs and, if it is an index, the manifests it references,
+// and tags it in the target repository. Unless force is set a target tag that references another manifest is an
+// error. It returns the digest of the copied manifest.
+func copyImage(ctx context.Context, source artifactSource, target artifactTarget, sourceRepo string, reference string, targetRepo string, targetTag string, force bool) (string, error) {
+	manifestBytes, err := getSourceManifest(ctx, source, sourceRepo, reference)
+	if err != nil {
+		return "", err
+	}
+	digest := computeDigest(manifestBytes)
+	if !force {
+		existingBytes, err := target.GetManifest(ctx, targetRepo, targetTag)
+		if err == nil && computeDigest(existingBytes) != digest {
+			return "", fmt.Errorf("%s:%s already references another image, use the force flag to move it", targetRepo, targetTag)
+		}
+		if err != nil && !errors.Is(err, api.ErrNotFound) {
+			return "", fmt.Errorf("failed to get manifest %s of %s: %w", targetTag, targetRepo, err)
+		}
+	}
+	// The images of an index usually share blobs, they are only copied once.
+	copiedBlobs := map[string]bool{}
+	if err := copyManifest(ctx, source, target, sourceRepo, manifestBytes, targetRepo, targetTag, copiedBlobs); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// getSourceManifest fetches a manifest of the source registry.
+func getSourceManifest(ctx context.Context, source artifactSource, repoName string, reference string) ([]byte, error) {
+	manifestBytes, err := source.GetManifest(ctx, repoName, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest %s of %s: %w", reference, repoName, err)
+	}
+	return manifestBytes, nil
+}
+
+// copyManifest copies what a manifest references before the manifest itself, so that the registry accepts it, and
+// pushes it with the target reference.
+func copyManifest(ctx context.Context, source artifactSource, target artifactTarget, sourceRepo string, manifestBytes []byte, targetRepo string, targetReference string, copiedBlobs map[string]bool) error {
+	digest := computeDigest(manifestBytes)
+	mediaType, err := manifestMediaType(manifestBytes)
+	if err != nil {
+		return fmt.Errorf("failed to copy manifest %s of %s: %w", digest, sourceRepo, err)
+	}
+	var manifest artifactManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return fmt.Errorf("failed to parse manifest %s of %s: %w", digest, sourceRepo, err)
+	}
+	for _, child := range manifest.Manifests {
+		childBytes, err := getSourceManifest(ctx, source, sourceRepo, child.Digest)
+		if err != nil {
+			return err
+		}
+		if err := copyManifest(ctx, source, target, sourceRepo, childBytes, targetRepo, child.Digest, copiedBlobs); err != nil {
+			return err
+		}
+	}
+	blobs := manifest.Layers
+	if len(manifest.Config.Digest) > 0 {
+		blobs = append([]artifactDescriptor{manifest.Config}, blobs...)
+	}
+	for _, blob := range blobs {
+		if copiedBlobs[blob.Digest] || blob.MediaType == foreignLayerContentType {
+			continue
+		}
+		if mounter, ok := target.(blobMounter); ok {
+			mounted, err := mounter.mountBlob(ctx, targetRepo, blob.Digest)
+			if err != nil {
+				return fmt.Errorf("failed to mount blob %s to %s: %w", blob.Digest, targetRepo, err)
+			}
+			if mounted {
+				copiedBlobs[blob.Digest] = true
+				continue
+			}
+		}
+		if err := copyBlob(ctx, source, target, sourceRepo, targetRepo, blob.Digest); err != nil {
+			return err
+		}
+		copiedBlobs[blob.Digest] = true
+	}
+	if _, err := target.PutManifest(ctx, targetRepo, targetReference, mediaType, manifestBytes); err != nil {
+		return fmt.Errorf("failed to push manifest %s to %s: %w", digest, targetRepo, err)
+	}
+	return nil
+}
+
+// copyBlob copies a blob of the source repository to the target repository. The blob is streamed into a chunked
+// upload when the source and the target support it, so that a layer of several gigabytes is never held in memory,
+// otherwise it is read and pushed with single requests.
+func copyBlob(ctx context.Context, source artifactSource, target artifactTarget, sourceRepo string, targetRepo string, digest string) error {
+	reader, canStream := source.(api.BlobReader)
+	uploader, canUpload := target.(api.BlobUploader)
+	if !canStream || !canUpload {
+		content, err := source.GetBlob(ctx, sourceRepo, digest)
+		if err != nil {
+			return fmt.Errorf("failed to get blob %s of %s: %w", digest, sourceRepo, err)
+		}
+		if err := target.PutBlob(ctx, targetRepo, digest, content); err != nil {
+			return fmt.Errorf("failed to push blob %s to %s: %w", digest, targetRepo, err)
+		}
+		return nil
+	}
+	content, err := reader.OpenBlob(ctx, sourceRepo, digest)
+	if err != nil {
+		return fmt.Errorf("failed to get blob %s of %s: %w", digest, sourceRepo, err)
+	}
+	defer content.Close()
+	if err := api.UploadBlobStream(ctx, uploader, targetRepo, digest, content, 0); err != nil {
+		return fmt.Errorf("failed to push blob %s to %s: %w", digest, targetRepo, err)
+	}
+	return nil
+}
+
+// manifestMediaType returns the media type of a manifest, the OCI manifests can omit it. The manifests of the schema
+// version 1 are signed for their repository and cannot be copied.
+func manifestMediaType(manifestBytes []byte) (string, error) {
+	var manifest struct {
+		SchemaVersion int               `json:"schemaVersion"`
+		MediaType     string            `json:"mediaType"`
+		Manifests     []json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return "", err
+	}
+	switch {
+	case manifest.SchemaVersion != 2:
+		return "", fmt.Errorf("unsupported manifest schema version %d", manifest.SchemaVersion)
+	case len(manifest.MediaType) > 0:
+		return manifest.MediaType, nil
+	case manifest.Manifests != nil:
+		return ociIndexContentType, nil
+	}
+	return ociManifestContentType, nil
+}
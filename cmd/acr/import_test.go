@@ -0,0 +1,142 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/fakeacr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyImage(t *testing.T) {
+	amd64Manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"digest":"sha256:c1"},"layers":[{"digest":"sha256:l1"},{"digest":"sha256:l2"}]}`)
+	arm64Manifest := []byte(`{"schemaVersion":2,"config":{"digest":"sha256:c2"},"layers":[{"digest":"sha256:l1"},{"mediaType":"` + foreignLayerContentType + `","digest":"sha256:l3"}]}`)
+	amd64Digest := computeDigest(amd64Manifest)
+	arm64Digest := computeDigest(arm64Manifest)
+	index := []byte(`{"schemaVersion":2,"manifests":[{"digest":"` + amd64Digest + `"},{"digest":"` + arm64Digest + `"}]}`)
+	notFound := &api.StatusError{StatusCode: http.StatusNotFound, Message: "not found"}
+	// First test, the images of an index are copied before the index and the blobs they share are copied once.
+	t.Run("CopyIndexTest", func(t *testing.T) {
+		assert := assert.New(t)
+		source := &mocks.AcrCLIClientInterface{}
+		target := &mocks.AcrCLIClientInterface{}
+		source.On("GetManifest", testCtx, "library/nginx", "1.25").Return(index, nil).Once()
+		source.On("GetManifest", testCtx, "library/nginx", amd64Digest).Return(amd64Manifest, nil).Once()
+		source.On("GetManifest", testCtx, "library/nginx", arm64Digest).Return(arm64Manifest, nil).Once()
+		target.On("GetManifest", testCtx, "nginx", "1.25").Return(nil, notFound).Once()
+		for _, digest := range []string{"sha256:c1", "sha256:l1", "sha256:l2", "sha256:c2"} {
+			source.On("GetBlob", testCtx, "library/nginx", digest).Return([]byte(digest), nil).Once()
+			target.On("PutBlob", testCtx, "nginx", digest, []byte(digest)).Return(nil).Once()
+		}
+		target.On("PutManifest", testCtx, "nginx", amd64Digest, dockerManifestContentType, amd64Manifest).Return(&autorest.Response{}, nil).Once()
+		target.On("PutManifest", testCtx, "nginx", arm64Digest, ociManifestContentType, arm64Manifest).Return(&autorest.Response{}, nil).Once()
+		target.On("PutManifest", testCtx, "nginx", "1.25", ociIndexContentType, index).Return(&autorest.Response{}, nil).Once()
+		digest, err := copyImage(testCtx, source, target, "library/nginx", "1.25", "nginx", "1.25", false)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(computeDigest(index), digest)
+		source.AssertExpectations(t)
+		target.AssertExpectations(t)
+	})
+	// Second test, a target tag that references another image is only moved with force.
+	t.Run("ExistingTargetTest", func(t *testing.T) {
+		assert := assert.New(t)
+		source := &mocks.AcrCLIClientInterface{}
+		target := &mocks.AcrCLIClientInterface{}
+		source.On("GetManifest", testCtx, "library/nginx", "1.25").Return(index, nil).Once()
+		target.On("GetManifest", testCtx, "nginx", "1.25").Return(amd64Manifest, nil).Once()
+		_, err := copyImage(testCtx, source, target, "library/nginx", "1.25", "nginx", "1.25", false)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		source.On("GetManifest", testCtx, "library/nginx", "1.25").Return([]byte(`{"schemaVersion":1}`), nil).Once()
+		_, err = copyImage(testCtx, source, target, "library/nginx", "1.25", "nginx", "1.25", true)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		source.On("GetManifest", testCtx, "library/nginx", "1.25").Return(nil, errors.New("unauthorized")).Once()
+		_, err = copyImage(testCtx, source, target, "library/nginx", "1.25", "nginx", "1.25", true)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		source.AssertExpectations(t)
+		target.AssertExpectations(t)
+	})
+	// Third test, between clients that can stream blobs the blobs are streamed into chunked uploads instead of being
+	// read in memory and pushed with a single request.
+	t.Run("StreamBlobsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		sourceRegistry := fakeacr.NewRegistry("user", "password")
+		defer sourceRegistry.Close()
+		targetRegistry := fakeacr.NewRegistry("user", "password")
+		defer targetRegistry.Close()
+		source, err := api.GetAcrCLIClientWithAuth(sourceRegistry.LoginURL(), "user", "password", nil)
+		assert.Equal(nil, err, "Error should be nil")
+		source.AutorestClient.Sender = sourceRegistry.HTTPClient()
+		target, err := api.GetAcrCLIClientWithAuth(targetRegistry.LoginURL(), "user", "password", nil)
+		assert.Equal(nil, err, "Error should be nil")
+		target.AutorestClient.Sender = targetRegistry.HTTPClient()
+		imageDigest := sourceRegistry.PushImage("library/nginx", "1.25", time.Now())
+		digest, err := copyImage(testCtx, source, target, "library/nginx", "1.25", "nginx", "1.25", false)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(imageDigest, digest)
+		assert.Equal([]string{"1.25"}, targetRegistry.Tags("nginx"))
+		manifestBytes, err := target.GetManifest(testCtx, "nginx", digest)
+		assert.Equal(nil, err, "Error should be nil")
+		var manifest artifactManifest
+		assert.Equal(nil, json.Unmarshal(manifestBytes, &manifest), "Error should be nil")
+		for _, descriptor := range append(manifest.Layers, manifest.Config) {
+			sourceBlob, _ := sourceRegistry.Blob(descriptor.Digest)
+			targetBlob, ok := targetRegistry.Blob(descriptor.Digest)
+			assert.True(ok)
+			assert.Equal(sourceBlob, targetBlob)
+		}
+		chunks := 0
+		for _, request := range targetRegistry.Requests() {
+			if strings.HasPrefix(request, http.MethodPatch+" /v2/nginx/blobs/uploads/") {
+				chunks++
+			}
+		}
+		assert.Equal(2, chunks)
+	})
+}
+
+func TestParseImportSource(t *testing.T) {
+	tables := []struct {
+		reference  string
+		registry   string
+		image      string
+		targetRepo string
+		targetTag  string
+	}{
+		{"docker.io/library/nginx:1.25", "docker.io", "library/nginx:1.25", "nginx", "1.25"},
+		{"nginx", "docker.io", "library/nginx:latest", "nginx", "latest"},
+		{"index.docker.io/bitnami/redis:7.2", "docker.io", "bitnami/redis:7.2", "bitnami/redis", "7.2"},
+		{"mcr.microsoft.com/dotnet/runtime:8.0", "mcr.microsoft.com", "dotnet/runtime:8.0", "dotnet/runtime", "8.0"},
+		{"localhost:5000/hello-world", "localhost:5000", "hello-world:latest", "hello-world", "latest"},
+		{"mcr.microsoft.com/hello-world@sha256:abc", "mcr.microsoft.com", "hello-world@sha256:abc", "", ""},
+	}
+	assert := assert.New(t)
+	for _, table := range tables {
+		source, err := parseImportSource(table.reference)
+		assert.Equal(nil, err, table.reference)
+		assert.Equal(table.registry, source.registry, table.reference)
+		assert.Equal(table.image, source.image(), table.reference)
+		targetRepo, targetTag, err := importTarget(source, "")
+		assert.Equal(len(table.targetRepo) > 0, err == nil, table.reference)
+		assert.Equal(table.targetRepo, targetRepo, table.reference)
+		assert.Equal(table.targetTag, targetTag, table.reference)
+	}
+	source, _ := parseImportSource("nginx:1.25")
+	assert.Equal("registry-1.docker.io", source.apiHost())
+	_, _, err := importTarget(source, "nginx@sha256:abc")
+	assert.NotEqual(nil, err, "Error should not be nil")
+	managementSource := newManagementImportSource(source, "user", "secret")
+	assert.Equal("docker.io", managementSource.RegistryURI)
+	assert.Equal("library/nginx:1.25", managementSource.SourceImage)
+	assert.Equal("secret", managementSource.Credentials.Password)
+	assert.Nil(newManagementImportSource(source, "", "").Credentials)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/spf13/cobra"
+)
+
+// orderByName lists the tags by name and the manifests by digest, it is the default order of the registry.
+const orderByName = "name"
+
+// listOptions are the order the tag list and manifest list commands list the registry in and the number of items
+// they stop after, 0 lists all of them.
+type listOptions struct {
+	orderBy string
+	limit   int
+}
+
+// addListFlags adds the orderby and limit flags to a list command.
+func addListFlags(cmd *cobra.Command, options *listOptions) {
+	cmd.Flags().StringVar(&options.orderBy, "orderby", orderByName, "The order of the list: name, timeasc (least recently updated first) or timedesc (most recently updated first)")
+	cmd.Flags().IntVar(&options.limit, "limit", 0, "Stop after listing this many items, 0 lists all of them")
+}
+
+// apiOrderBy validates the options and returns the orderby value of the ACR API, empty for the default order.
+func (options listOptions) apiOrderBy() (string, error) {
+	if options.limit < 0 {
+		return "", errors.New("the limit value cannot be negative")
+	}
+	switch options.orderBy {
+	case orderByName, "":
+		return "", nil
+	case api.OrderByTimeAsc, api.OrderByTimeDesc:
+		return options.orderBy, nil
+	}
+	return "", fmt.Errorf("invalid orderby %q, supported values are %s, %s and %s", options.orderBy, orderByName, api.OrderByTimeAsc, api.OrderByTimeDesc)
+}
+
+// reached returns true once count items were listed and the limit is set.
+func (options listOptions) reached(count int) bool {
+	return options.limit > 0 && count >= options.limit
+}
@@ -3,13 +3,21 @@
 
 package main
 
-import "os"
+import (
+	"context"
+	"os"
+	"time"
+)
 
 // The function of the main method is just to launch the root cobra command which is
 // used to launch the other commands.
 func main() {
 	cmd := newRootCmd(os.Args[1:])
-	if err := cmd.Execute(); err != nil {
-		os.Exit(1)
-	}
+	start := time.Now()
+	executed, err := cmd.ExecuteC()
+	// The exit code tells scripts whether nothing matched, some deletions failed or the registry rejected the
+	// credentials or throttled the requests.
+	code := exitCode(err)
+	reportUsage(context.Background(), "", executed, os.Args[1:], time.Since(start), code)
+	os.Exit(code)
 }
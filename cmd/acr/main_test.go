@@ -0,0 +1,188 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// All the variables used in the tests are defined here.
+var (
+	testCtx          = context.Background()
+	testLoginURL     = "foo.azurecr.io"
+	testRepo         = "bar"
+	notFoundResponse = autorest.Response{
+		Response: &http.Response{
+			StatusCode: 404,
+		},
+	}
+	deletedResponse = autorest.Response{
+		Response: &http.Response{
+			StatusCode: 200,
+		},
+	}
+	// Response for the GetAcrTags when the repository is not found.
+	notFoundTagResponse = &acr.RepositoryTagsType{
+		Response: notFoundResponse,
+	}
+	// Response for the GetAcrTags when there are no tags on the testRepo.
+	EmptyListTagsResult = &acr.RepositoryTagsType{
+		Registry:       &testLoginURL,
+		ImageName:      &testRepo,
+		TagsAttributes: nil,
+	}
+	tagName               = "latest"
+	digest                = "sha:abc"
+	multiArchDigest       = "sha:356"
+	deleteEnabled         = true
+	deleteDisabled        = false
+	lastUpdateTime        = time.Now().Add(-15 * time.Minute).UTC().Format(time.RFC3339Nano) //Creation time -15minutes from current time
+	invalidLastUpdateTime = "date"
+
+	OneTagResult = &acr.RepositoryTagsType{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{
+			{
+				Name:                 &tagName,
+				LastUpdateTime:       &lastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+				Digest:               &digest,
+			},
+		},
+	}
+
+	InvalidDateOneTagResult = &acr.RepositoryTagsType{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{
+			{
+				Name:                 &tagName,
+				LastUpdateTime:       &invalidLastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+				Digest:               &digest,
+			},
+		},
+	}
+
+	DeleteDisabledOneTagResult = &acr.RepositoryTagsType{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{
+			{
+				Name:                 &tagName,
+				LastUpdateTime:       &lastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteDisabled},
+				Digest:               &digest,
+			},
+		},
+	}
+	tagName1 = "v1"
+	tagName2 = "v2"
+	tagName3 = "v3"
+	tagName4 = "v4"
+
+	FourTagsResult = &acr.RepositoryTagsType{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{{
+			Name:                 &tagName1,
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest,
+		}, {
+			Name:                 &tagName2,
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest,
+		}, {
+			Name:                 &tagName3,
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &multiArchDigest,
+		}, {
+			Name:                 &tagName4,
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest,
+		}},
+	}
+
+	// Response for the GetAcrManifests when the repository is not found.
+	notFoundManifestResponse = &acr.Manifests{
+		Response: notFoundResponse,
+	}
+	// Response for the GetAcrManifests when there are no manifests on the testRepo.
+	EmptyListManifestsResult = &acr.Manifests{
+		Registry:            &testLoginURL,
+		ImageName:           &testRepo,
+		ManifestsAttributes: nil,
+	}
+	dockerV2MediaType     = "application/vnd.docker.distribution.manifest.v2+json"
+	manifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	singleManifestV2WithTagsResult = &acr.Manifests{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest,
+			MediaType:            &dockerV2MediaType,
+			Tags:                 &[]string{"latest"},
+		}},
+	}
+	digest1 = "sha:123"
+	digest2 = "sha:234"
+
+	doubleManifestV2WithoutTagsResult = &acr.Manifests{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest1,
+			MediaType:            &dockerV2MediaType,
+			Tags:                 nil,
+		}, {
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest2,
+			MediaType:            &dockerV2MediaType,
+			Tags:                 nil,
+		}},
+	}
+
+	singleMultiArchWithTagsResult = &acr.Manifests{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &multiArchDigest,
+			MediaType:            &manifestListMediaType,
+			Tags:                 &[]string{"v3"},
+		}},
+	}
+	multiArchBytes = []byte(`{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.docker.distribution.manifest.list.v2+json",
+		"manifests": [
+			{
+				"mediaType": "application/vnd.docker.image.manifest.v2+json",
+				"size": 7143,
+				"digest": "sha:123",
+				"platform": {
+					"architecture": "ppc64le",
+					"os": "linux"
+				}
+			}
+		]
+	}`)
+)
@@ -5,24 +5,53 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/Azure/acr-cli/acr"
 	"github.com/Azure/acr-cli/cmd/api"
-	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 const (
-	newManifestCmdLongMessage       = `acr manifest: list manifests and delete them individually.`
-	newManifestListCmdLongMessage   = `acr manifest list: outputs all the manifests that are inside a given repository`
-	newManifestDeleteCmdLongMessage = `acr manifest delete: delete a set of manifests inside the specified repository`
+	newManifestCmdLongMessage            = `acr manifest: list manifests and delete them individually.`
+	newManifestListCmdLongMessage        = `acr manifest list: outputs all the manifests that are inside a given repository`
+	newManifestDeleteCmdLongMessage      = `acr manifest delete: delete a set of manifests inside the specified repository`
+	newManifestCreateIndexCmdLongMessage = `acr manifest create-index: compose an OCI image index from manifests that already exist in the
+repository and push it with the specified tag. The platform of every manifest is read from its image config.`
+	createIndexExampleMessage = `  - Create a multi-arch image from an amd64 and an arm64 image
+    acr manifest create-index -r MyRegistry hello-world:latest --add hello-world@sha256:<amd64 digest> --add hello-world@sha256:<arm64 digest>
+
+  - Per-arch images can also be referenced by tag
+    acr manifest create-index -r MyRegistry hello-world:latest --add hello-world:amd64 --add hello-world:arm64`
+)
+
+// Media types used when composing an image index.
+const (
+	ociIndexContentType           = "application/vnd.oci.image.index.v1+json"
+	ociManifestContentType        = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestContentType     = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerManifestListContentType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	ociConfigContentType          = "application/vnd.oci.image.config.v1+json"
 )
 
 // Besides the registry name and authentication information only the repository is needed.
 type manifestParameters struct {
 	*rootParameters
 	repoName string
+	output   string
+}
+
+// checkRepository returns an error if the repository flag was not specified.
+func (manifestParams *manifestParameters) checkRepository() error {
+	if len(manifestParams.repoName) == 0 {
+		return errors.New(`required flag(s) "repository" not set`)
+	}
+	return nil
 }
 
 // The manifest command can be used to either list manifests or delete manifests inside a repository.
@@ -41,14 +70,16 @@ func newManifestCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
 
 	listManifestCmd := newManifestListCmd(out, &manifestParams)
 	deleteManifestCmd := newManifestDeleteCmd(out, &manifestParams)
+	createIndexCmd := newManifestCreateIndexCmd(out, &manifestParams)
 
 	cmd.AddCommand(
 		listManifestCmd,
 		deleteManifestCmd,
+		createIndexCmd,
 	)
+	// The repository is needed by the list and delete subcommands, they check that it was specified because the
+	// create-index subcommand receives the repository as part of its arguments.
 	cmd.PersistentFlags().StringVar(&manifestParams.repoName, "repository", "", "The repository name")
-	// Since the repository will be needed in either subcommand it is marked as a required flag
-	cmd.MarkPersistentFlagRequired("repository")
 
 	return cmd
 }
@@ -56,11 +87,19 @@ func newManifestCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
 // newManifestListCmd creates the manifest list command, it does not need any aditional parameters.
 // The registry interaction is done through the listManifests method
 func newManifestListCmd(out io.Writer, manifestParams *manifestParameters) *cobra.Command {
+	options := listOptions{}
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List manifests from a repository",
 		Long:  newManifestListCmdLongMessage,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := manifestParams.checkRepository(); err != nil {
+				return err
+			}
+			printer, err := newPrinter(manifestParams.output)
+			if err != nil {
+				return err
+			}
 			registryName, err := manifestParams.GetRegistryName()
 			if err != nil {
 				return err
@@ -72,41 +111,73 @@ func newManifestListCmd(out io.Writer, manifestParams *manifestParameters) *cobr
 				return err
 			}
 			ctx := context.Background()
-			err = listManifests(ctx, acrClient, loginURL, manifestParams.repoName)
+			err = listManifests(ctx, out, acrClient, loginURL, manifestParams.repoName, options, printer)
 			if err != nil {
 				return err
 			}
 			return nil
 		},
 	}
+	addOutputFlag(cmd, &manifestParams.output)
+	addListFlags(cmd, &options)
 	return cmd
 }
 
-// listManifests will do the http requests and print the digest of all the manifest in the selected repository.
-func listManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string) error {
-	lastManifestDigest := ""
-	resultManifests, err := acrClient.GetAcrManifests(ctx, repoName, "", lastManifestDigest)
+// manifestList is the output of the manifest list command when an output format is selected.
+type manifestList struct {
+	Registry   string                       `json:"registry"`
+	Repository string                       `json:"repository"`
+	Manifests  []acr.ManifestAttributesBase `json:"manifests"`
+}
+
+// listManifests will do the http requests and print the digest of all the manifest in the selected repository, in the
+// order of the options and up to their limit. If a printer is passed the manifests are collected and printed with it
+// instead.
+func listManifests(ctx context.Context, out io.Writer, acrClient api.ManifestLister, loginURL string, repoName string, options listOptions, printer *printer) error {
+	orderBy, err := options.apiOrderBy()
+	if err != nil {
+		return err
+	}
+	manifestPager := api.NewManifestPager(acrClient, repoName, orderBy)
+	resultManifests, err := manifestPager.Next(ctx)
 	if err != nil {
-		return errors.Wrap(err, "failed to list manifests")
+		return fmt.Errorf("failed to list manifests: %w", err)
 	}
 
-	fmt.Printf("Listing manifests for the %q repository:\n", repoName)
-	// A for loop is used because the GetAcrManifests method returns by default only 100 manifests and their attributes.
+	list := manifestList{Registry: loginURL, Repository: repoName, Manifests: []acr.ManifestAttributesBase{}}
+	if printer == nil {
+		fmt.Printf("Listing manifests for the %q repository:\n", repoName)
+	}
+	listed := 0
+	// A for loop is used because the registry returns by default only 100 manifests and their attributes in every page.
 	for resultManifests != nil && resultManifests.ManifestsAttributes != nil {
 		manifests := *resultManifests.ManifestsAttributes
 		for _, manifest := range manifests {
+			if options.reached(listed) {
+				break
+			}
+			listed++
+			if printer != nil {
+				list.Manifests = append(list.Manifests, manifest)
+				continue
+			}
 			manifestDigest := *manifest.Digest
 			fmt.Printf("%s/%s@%s\n", loginURL, repoName, manifestDigest)
 		}
-		// Since the GetAcrManifests supports pagination when supplied with the last digest that was returned the last manifest
-		// digest is saved, the manifest array contains at least one element because if it was empty the API would return
-		// a nil pointer instead of a pointer to a length 0 array.
-		lastManifestDigest = *manifests[len(manifests)-1].Digest
-		resultManifests, err = acrClient.GetAcrManifests(ctx, repoName, "", lastManifestDigest)
+		// Once the limit is reached the next page is not requested.
+		if options.reached(listed) {
+			break
+		}
+		// The pager follows the next page link returned by the registry, once there are no more pages the
+		// ManifestsAttributes of the result are nil.
+		resultManifests, err = manifestPager.Next(ctx)
 		if err != nil {
-			return errors.Wrap(err, "failed to list manifests")
+			return fmt.Errorf("failed to list manifests: %w", err)
 		}
 	}
+	if printer != nil {
+		return printer.print(out, list)
+	}
 	return nil
 }
 
@@ -118,6 +189,9 @@ func newManifestDeleteCmd(out io.Writer, manifestParams *manifestParameters) *co
 		Short: "Delete manifest from a repository",
 		Long:  newManifestDeleteCmdLongMessage,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := manifestParams.checkRepository(); err != nil {
+				return err
+			}
 			registryName, err := manifestParams.GetRegistryName()
 			if err != nil {
 				return err
@@ -140,14 +214,196 @@ func newManifestDeleteCmd(out io.Writer, manifestParams *manifestParameters) *co
 }
 
 // deleteManifests receives an array of manifests digest and deletes them using the supplied acrClient.
-func deleteManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string, args []string) error {
+func deleteManifests(ctx context.Context, acrClient api.ManifestDeleter, loginURL string, repoName string, args []string) error {
 	for i := 0; i < len(args); i++ {
 		_, err := acrClient.DeleteManifest(ctx, repoName, args[i])
 		if err != nil {
 			// If there is an error (this includes not found and not allowed operations) the deletion of the images is stopped and an error is returned.
-			return errors.Wrap(err, "failed to delete manifests")
+			return fmt.Errorf("failed to delete manifests: %w", err)
 		}
 		fmt.Printf("%s/%s@%s\n", loginURL, repoName, args[i])
 	}
 	return nil
 }
+
+// newManifestCreateIndexCmd defines the manifest create-index subcommand, it receives as an argument the repository
+// and tag of the index and the manifests it is composed of are specified with the add flag.
+func newManifestCreateIndexCmd(out io.Writer, manifestParams *manifestParameters) *cobra.Command {
+	var references []string
+	cmd := &cobra.Command{
+		Use:     "create-index <repository>:<tag>",
+		Short:   "Compose an image index from existing manifests",
+		Long:    newManifestCreateIndexCmdLongMessage,
+		Example: createIndexExampleMessage,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(references) == 0 {
+				return errors.New("at least one manifest has to be added with the add flag")
+			}
+			registryName, err := manifestParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, manifestParams.username, manifestParams.password, manifestParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			return createIndex(ctx, acrClient, loginURL, args[0], references)
+		},
+	}
+	cmd.Flags().StringArrayVar(&references, "add", nil, "A manifest to include in the index, specified as <repository>@<digest> or <repository>:<tag>, can be specified multiple times")
+	return cmd
+}
+
+// imageIndex is the OCI image index pushed by the create-index command.
+type imageIndex struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Manifests     []indexDescriptor `json:"manifests"`
+}
+
+// indexDescriptor references one of the manifests of an image index.
+type indexDescriptor struct {
+	MediaType string         `json:"mediaType"`
+	Digest    string         `json:"digest"`
+	Size      int64          `json:"size"`
+	Platform  *indexPlatform `json:"platform,omitempty"`
+}
+
+// indexPlatform is the platform of a manifest, it is read from the image config.
+type indexPlatform struct {
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+	Variant      string   `json:"variant,omitempty"`
+}
+
+// imageManifest contains the fields of a manifest needed to describe it inside an index.
+type imageManifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"config"`
+	Manifests []json.RawMessage `json:"manifests"`
+}
+
+// createIndex composes an OCI image index from the referenced manifests and pushes it to the target repository and tag.
+func createIndex(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, target string, references []string) error {
+	repoName, tag, isDigest, err := parseReference(target)
+	if err != nil {
+		return err
+	}
+	if isDigest {
+		return fmt.Errorf("the index %q has to be referenced by a tag", target)
+	}
+	index := imageIndex{SchemaVersion: 2, MediaType: ociIndexContentType, Manifests: []indexDescriptor{}}
+	platforms := map[string]string{}
+	for _, reference := range references {
+		descriptor, err := describeManifest(ctx, acrClient, repoName, reference)
+		if err != nil {
+			return err
+		}
+		// An index with two manifests for the same platform is ambiguous, clients would always pull the first one.
+		platformName := descriptor.Platform.OS + "/" + descriptor.Platform.Architecture
+		if len(descriptor.Platform.Variant) > 0 {
+			platformName += "/" + descriptor.Platform.Variant
+		}
+		if len(descriptor.Platform.OSVersion) > 0 {
+			platformName += ":" + descriptor.Platform.OSVersion
+		}
+		if previous, ok := platforms[platformName]; ok {
+			return fmt.Errorf("%s and %s are both %s images", previous, reference, platformName)
+		}
+		platforms[platformName] = reference
+		index.Manifests = append(index.Manifests, *descriptor)
+	}
+	indexBytes, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if _, err := acrClient.PutManifest(ctx, repoName, tag, ociIndexContentType, indexBytes); err != nil {
+		return fmt.Errorf("failed to push index: %w", err)
+	}
+	fmt.Printf("%s/%s:%s@%s\n", loginURL, repoName, tag, computeDigest(indexBytes))
+	return nil
+}
+
+// describeManifest fetches the referenced manifest and its config and returns the descriptor that is added to the index.
+// Indexes can only reference manifests that are in the same repository.
+func describeManifest(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, reference string) (*indexDescriptor, error) {
+	manifestRepo, manifestReference, isDigest, err := parseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	if manifestRepo != repoName {
+		return nil, fmt.Errorf("%s is not in the %s repository, an index can only reference manifests of its own repository", reference, repoName)
+	}
+	manifestBytes, err := acrClient.GetManifest(ctx, repoName, manifestReference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get manifest %s: %w", reference, err)
+	}
+	manifestDigest := computeDigest(manifestBytes)
+	// If the registry converted the manifest to another format the digest would not match the requested one.
+	if isDigest && manifestDigest != manifestReference {
+		return nil, fmt.Errorf("the registry returned the manifest %s instead of %s", manifestDigest, manifestReference)
+	}
+	var m imageManifest
+	if err := json.Unmarshal(manifestBytes, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", reference, err)
+	}
+	mediaType := m.MediaType
+	switch {
+	case mediaType == ociIndexContentType || mediaType == dockerManifestListContentType || m.Manifests != nil:
+		return nil, fmt.Errorf("%s is already an index, only image manifests can be added", reference)
+	case len(mediaType) == 0 && m.Config.MediaType == ociConfigContentType:
+		// The mediaType field is optional in OCI manifests.
+		mediaType = ociManifestContentType
+	case mediaType != ociManifestContentType && mediaType != dockerManifestContentType:
+		return nil, fmt.Errorf("%s has the unsupported media type %q", reference, mediaType)
+	}
+	configBytes, err := acrClient.GetBlob(ctx, repoName, m.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the config of %s: %w", reference, err)
+	}
+	var config indexPlatform
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the config of %s: %w", reference, err)
+	}
+	if len(config.OS) == 0 || len(config.Architecture) == 0 {
+		return nil, fmt.Errorf("the config of %s does not specify the os and architecture", reference)
+	}
+	return &indexDescriptor{
+		MediaType: mediaType,
+		Digest:    manifestDigest,
+		Size:      int64(len(manifestBytes)),
+		Platform:  &config,
+	}, nil
+}
+
+// parseReference splits a <repository>:<tag> or <repository>@<digest> reference, the third return value is true when
+// the reference is a digest.
+func parseReference(reference string) (string, string, bool, error) {
+	if i := strings.Index(reference, "@"); i >= 0 {
+		repoName, digest := reference[:i], reference[i+1:]
+		if len(repoName) == 0 || !strings.HasPrefix(digest, "sha256:") {
+			return "", "", false, fmt.Errorf("invalid reference %q, expected <repository>@sha256:<digest>", reference)
+		}
+		return repoName, digest, true, nil
+	}
+	// The tag starts after the last colon that is not part of the repository path, a colon before a slash belongs to
+	// a port number.
+	i := strings.LastIndex(reference, ":")
+	if i <= 0 || i == len(reference)-1 || strings.Contains(reference[i+1:], "/") {
+		return "", "", false, fmt.Errorf("invalid reference %q, expected <repository>:<tag> or <repository>@<digest>", reference)
+	}
+	return reference[:i], reference[i+1:], false, nil
+}
+
+// computeDigest returns the sha256 digest of the content in the format used by the registry.
+func computeDigest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
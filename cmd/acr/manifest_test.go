@@ -4,41 +4,54 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"testing"
 
 	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/go-autorest/autorest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestListManifests(t *testing.T) {
 	// First test, repository not found should return an error.
 	t.Run("RepositoryNotFoundTest", func(t *testing.T) {
 		assert := assert.New(t)
-		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient := &mocks.ManifestLister{}
 		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(notFoundManifestResponse, errors.New("testRepo not found")).Once()
-		err := listManifests(testCtx, mockClient, testLoginURL, testRepo)
+		err := listManifests(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo, listOptions{}, nil)
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
 	})
 	// Second test, if an error is returned on any GetAcrTags call an error should be returned.
 	t.Run("ErrorOnSecondPageTest", func(t *testing.T) {
 		assert := assert.New(t)
-		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient := &mocks.ManifestLister{}
 		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:abc").Return(nil, errors.New("unauthorized")).Once()
-		err := listManifests(testCtx, mockClient, testLoginURL, testRepo)
+		err := listManifests(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo, listOptions{}, nil)
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
 	})
 	// Third test, no errors
 	t.Run("ListThreeManifestsTest", func(t *testing.T) {
 		assert := assert.New(t)
-		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient := &mocks.ManifestLister{}
 		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:abc").Return(doubleManifestV2WithoutTagsResult, nil).Once()
 		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Once()
-		err := listManifests(testCtx, mockClient, testLoginURL, testRepo)
+		err := listManifests(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo, listOptions{}, nil)
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, the most recently updated manifests are listed up to the limit.
+	t.Run("OrderByAndLimitTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.ManifestLister{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "timedesc", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		err := listManifests(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo, listOptions{orderBy: "timedesc", limit: 1}, nil)
 		assert.Equal(nil, err, "Error should be nil")
 		mockClient.AssertExpectations(t)
 	})
@@ -49,7 +62,7 @@ func TestDeleteManifests(t *testing.T) {
 	// First test, manifest not found should return an error.
 	t.Run("ManifestNotFoundTest", func(t *testing.T) {
 		assert := assert.New(t)
-		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient := &mocks.ManifestDeleter{}
 		mockClient.On("DeleteManifest", testCtx, testRepo, "sha:123").Return(&notFoundResponse, errors.New("not found")).Once()
 		err := deleteManifests(testCtx, mockClient, testLoginURL, testRepo, args)
 		assert.NotEqual(nil, err, "Error should not be nil")
@@ -58,7 +71,7 @@ func TestDeleteManifests(t *testing.T) {
 	// Second test, three manifests deleted, regular behavior
 	t.Run("DeleteFiveManifestsTest", func(t *testing.T) {
 		assert := assert.New(t)
-		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient := &mocks.ManifestDeleter{}
 		mockClient.On("DeleteManifest", testCtx, testRepo, "sha:123").Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteManifest", testCtx, testRepo, "sha:124").Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteManifest", testCtx, testRepo, "sha:125").Return(&deletedResponse, nil).Once()
@@ -67,3 +80,90 @@ func TestDeleteManifests(t *testing.T) {
 		mockClient.AssertExpectations(t)
 	})
 }
+
+func TestCreateIndex(t *testing.T) {
+	amd64Manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"mediaType":"application/vnd.docker.container.image.v1+json","digest":"sha256:c1"}}`)
+	arm64Manifest := []byte(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:c2"}}`)
+	amd64Config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	arm64Config := []byte(`{"architecture":"arm64","os":"linux","variant":"v8"}`)
+	amd64Digest := computeDigest(amd64Manifest)
+	arm64Digest := computeDigest(arm64Manifest)
+	// First test, the index should reference both manifests with their platforms.
+	t.Run("CreateIndexTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", testCtx, testRepo, amd64Digest).Return(amd64Manifest, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "arm64").Return(arm64Manifest, nil).Once()
+		mockClient.On("GetBlob", testCtx, testRepo, "sha256:c1").Return(amd64Config, nil).Once()
+		mockClient.On("GetBlob", testCtx, testRepo, "sha256:c2").Return(arm64Config, nil).Once()
+		var pushed imageIndex
+		mockClient.On("PutManifest", testCtx, testRepo, "latest", ociIndexContentType, mock.Anything).Run(func(args mock.Arguments) {
+			assert.Equal(nil, json.Unmarshal(args.Get(4).([]byte), &pushed))
+		}).Return(&autorest.Response{}, nil).Once()
+		err := createIndex(testCtx, mockClient, testLoginURL, testRepo+":latest", []string{testRepo + "@" + amd64Digest, testRepo + ":arm64"})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(ociIndexContentType, pushed.MediaType)
+		assert.Equal(2, len(pushed.Manifests))
+		assert.Equal(dockerManifestContentType, pushed.Manifests[0].MediaType)
+		assert.Equal(amd64Digest, pushed.Manifests[0].Digest)
+		assert.Equal(int64(len(amd64Manifest)), pushed.Manifests[0].Size)
+		assert.Equal("amd64", pushed.Manifests[0].Platform.Architecture)
+		assert.Equal(ociManifestContentType, pushed.Manifests[1].MediaType)
+		assert.Equal(arm64Digest, pushed.Manifests[1].Digest)
+		assert.Equal("v8", pushed.Manifests[1].Platform.Variant)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, two manifests of the same platform should return an error before pushing anything.
+	t.Run("DuplicatePlatformTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", testCtx, testRepo, "a").Return(amd64Manifest, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "b").Return(amd64Manifest, nil).Once()
+		mockClient.On("GetBlob", testCtx, testRepo, "sha256:c1").Return(amd64Config, nil).Twice()
+		err := createIndex(testCtx, mockClient, testLoginURL, testRepo+":latest", []string{testRepo + ":a", testRepo + ":b"})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, manifests of other repositories, digests that do not match and nested indexes should return an error.
+	t.Run("InvalidManifestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		err := createIndex(testCtx, mockClient, testLoginURL, testRepo+":latest", []string{"other@" + amd64Digest})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.On("GetManifest", testCtx, testRepo, "sha256:abc").Return(amd64Manifest, nil).Once()
+		err = createIndex(testCtx, mockClient, testLoginURL, testRepo+":latest", []string{testRepo + "@sha256:abc"})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.On("GetManifest", testCtx, testRepo, "list").Return([]byte(`{"schemaVersion":2,"manifests":[]}`), nil).Once()
+		err = createIndex(testCtx, mockClient, testLoginURL, testRepo+":latest", []string{testRepo + ":list"})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		err = createIndex(testCtx, mockClient, testLoginURL, testRepo+"@"+amd64Digest, []string{testRepo + ":a"})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestParseReference(t *testing.T) {
+	tables := []struct {
+		reference string
+		repoName  string
+		ref       string
+		isDigest  bool
+		valid     bool
+	}{
+		{"hello-world:latest", "hello-world", "latest", false, true},
+		{"library/hello-world@sha256:abc", "library/hello-world", "sha256:abc", true, true},
+		{"localhost:5000/hello-world:v1", "localhost:5000/hello-world", "v1", false, true},
+		{"localhost:5000/hello-world", "", "", false, false},
+		{"hello-world", "", "", false, false},
+		{"hello-world@abc", "", "", false, false},
+		{":latest", "", "", false, false},
+	}
+	assert := assert.New(t)
+	for _, table := range tables {
+		repoName, ref, isDigest, err := parseReference(table.reference)
+		assert.Equal(table.valid, err == nil, table.reference)
+		assert.Equal(table.repoName, repoName, table.reference)
+		assert.Equal(table.ref, ref, table.reference)
+		assert.Equal(table.isDigest, isDigest, table.reference)
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+)
+
+// The output formats of the list commands and the purge summary, the text format is the default.
+const (
+	outputText       = "text"
+	outputJSON       = "json"
+	outputGoTemplate = "go-template="
+	outputJSONPath   = "jsonpath="
+)
+
+// printer writes the result of a command in the format selected with the output flag.
+type printer struct {
+	format   string
+	template *template.Template
+	jsonPath []jsonPathNode
+}
+
+// addOutputFlag adds the output flag to a command.
+func addOutputFlag(cmd *cobra.Command, output *string) {
+	cmd.Flags().StringVarP(output, "output", "o", outputText, "The output format: text, json, go-template=<template> (e.g. go-template='{{range .Tags}}{{.Name}} {{end}}') or jsonpath=<expression> (e.g. jsonpath='{.tags[*].name}')")
+}
+
+// newPrinter parses the output flag, a nil printer is returned for the text format so that the commands keep their
+// own text output.
+func newPrinter(output string) (*printer, error) {
+	switch {
+	case output == "" || output == outputText:
+		return nil, nil
+	case output == outputJSON:
+		return &printer{format: outputJSON}, nil
+	case strings.HasPrefix(output, outputGoTemplate):
+		tmpl, err := template.New("output").Parse(strings.TrimPrefix(output, outputGoTemplate))
+		if err != nil {
+			return nil, fmt.Errorf("invalid go-template: %w", err)
+		}
+		return &printer{format: outputGoTemplate, template: tmpl}, nil
+	case strings.HasPrefix(output, outputJSONPath):
+		nodes, err := parseJSONPath(strings.TrimPrefix(output, outputJSONPath))
+		if err != nil {
+			return nil, fmt.Errorf("invalid jsonpath: %w", err)
+		}
+		return &printer{format: outputJSONPath, jsonPath: nodes}, nil
+	}
+	return nil, fmt.Errorf("invalid output format %q, supported values are %q, %q, %q and %q", output, outputText, outputJSON, outputGoTemplate+"<template>", outputJSONPath+"<expression>")
+}
+
+// print writes the data. Go templates are executed against the data itself so they use the Go field names, while
+// jsonpath expressions are evaluated against its JSON form and use the JSON field names, as kubectl does.
+func (p *printer) print(out io.Writer, data interface{}) error {
+	switch p.format {
+	case outputGoTemplate:
+		return p.template.Execute(out, data)
+	case outputJSONPath:
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		return executeJSONPath(out, p.jsonPath, value, value)
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// jsonPathNode is a part of a jsonpath template: plain text, a quoted literal, a path whose values are printed or a
+// range over the values of a path.
+type jsonPathNode struct {
+	text    string
+	path    []string
+	nodes   []jsonPathNode
+	isPath  bool
+	isRange bool
+}
+
+// parseJSONPath parses a template like kubectl does, the expressions between braces are paths like .tags[*].name,
+// quoted literals like "\n" or {range .tags[*]}...{end} blocks and the rest is printed as is.
+func parseJSONPath(template string) ([]jsonPathNode, error) {
+	nodes, _, closed, err := parseJSONPathNodes(template)
+	if err != nil {
+		return nil, err
+	}
+	if closed {
+		return nil, errors.New("unexpected {end}")
+	}
+	return nodes, nil
+}
+
+// parseJSONPathNodes parses nodes until the end of the template or until an {end}, in which case closed is set and
+// the template after the {end} is returned.
+func parseJSONPathNodes(template string) (nodes []jsonPathNode, rest string, closed bool, err error) {
+	for len(template) > 0 {
+		start := strings.Index(template, "{")
+		if start < 0 {
+			nodes = append(nodes, jsonPathNode{text: template})
+			break
+		}
+		if start > 0 {
+			nodes = append(nodes, jsonPathNode{text: template[:start]})
+		}
+		end := closingBrace(template, start)
+		if end < 0 {
+			return nil, "", false, fmt.Errorf("unclosed expression %q", template[start:])
+		}
+		expression := strings.TrimSpace(template[start+1 : end])
+		template = template[end+1:]
+		switch {
+		case expression == "end":
+			return nodes, template, true, nil
+		case strings.HasPrefix(expression, `"`):
+			literal, err := strconv.Unquote(expression)
+			if err != nil {
+				return nil, "", false, fmt.Errorf("invalid literal %s", expression)
+			}
+			nodes = append(nodes, jsonPathNode{text: literal})
+		case strings.HasPrefix(expression, "range "):
+			path, err := parsePath(strings.TrimSpace(strings.TrimPrefix(expression, "range ")))
+			if err != nil {
+				return nil, "", false, err
+			}
+			inner, rest, closed, err := parseJSONPathNodes(template)
+			if err != nil {
+				return nil, "", false, err
+			}
+			if !closed {
+				return nil, "", false, errors.New("range is not closed with {end}")
+			}
+			nodes = append(nodes, jsonPathNode{path: path, nodes: inner, isRange: true})
+			template = rest
+		default:
+			path, err := parsePath(expression)
+			if err != nil {
+				return nil, "", false, err
+			}
+			nodes = append(nodes, jsonPathNode{path: path, isPath: true})
+		}
+	}
+	return nodes, "", false, nil
+}
+
+// closingBrace returns the index of the brace that closes the one at start, braces inside quotes are ignored.
+func closingBrace(template string, start int) int {
+	quoted := false
+	for i := start + 1; i < len(template); i++ {
+		switch template[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case '}':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parsePath splits a path like $.tags[*].name into its steps: field names, indexes and * for every element. A path
+// that starts with $ is evaluated against the whole document, otherwise against the current element of a range.
+func parsePath(expression string) ([]string, error) {
+	steps := []string{}
+	if strings.HasPrefix(expression, "$") {
+		steps = append(steps, "$")
+		expression = expression[1:]
+	} else if strings.HasPrefix(expression, "@") {
+		expression = expression[1:]
+	}
+	for len(expression) > 0 {
+		switch expression[0] {
+		case '.':
+			expression = expression[1:]
+			end := strings.IndexAny(expression, ".[")
+			if end < 0 {
+				end = len(expression)
+			}
+			if end > 0 {
+				steps = append(steps, expression[:end])
+			}
+			expression = expression[end:]
+		case '[':
+			end := strings.Index(expression, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in %q", expression)
+			}
+			step := expression[1:end]
+			switch {
+			case step == "*":
+				steps = append(steps, "[*]")
+			case len(step) > 1 && (step[0] == '\'' || step[0] == '"') && step[len(step)-1] == step[0]:
+				// A quoted name selects a field whose name cannot be written after a dot.
+				steps = append(steps, step[1:len(step)-1])
+			default:
+				if _, err := strconv.Atoi(step); err != nil {
+					return nil, fmt.Errorf("invalid index %q", step)
+				}
+				steps = append(steps, "["+step+"]")
+			}
+			expression = expression[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %q, the steps must start with . or [", expression)
+		}
+	}
+	return steps, nil
+}
+
+// executeJSONPath writes the nodes, the values of a path are separated by spaces.
+func executeJSONPath(out io.Writer, nodes []jsonPathNode, root interface{}, current interface{}) error {
+	for _, node := range nodes {
+		if !node.isPath && !node.isRange {
+			fmt.Fprint(out, node.text)
+			continue
+		}
+		values, err := evaluatePath(node.path, root, current)
+		if err != nil {
+			return err
+		}
+		if node.isPath {
+			texts := []string{}
+			for _, value := range values {
+				text, err := jsonPathText(value)
+				if err != nil {
+					return err
+				}
+				texts = append(texts, text)
+			}
+			fmt.Fprint(out, strings.Join(texts, " "))
+			continue
+		}
+		for _, value := range values {
+			if err := executeJSONPath(out, node.nodes, root, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evaluatePath returns the values a path selects.
+func evaluatePath(path []string, root interface{}, current interface{}) ([]interface{}, error) {
+	values := []interface{}{current}
+	for _, step := range path {
+		next := []interface{}{}
+		for _, value := range values {
+			switch {
+			case step == "$":
+				next = append(next, root)
+			case step == "[*]":
+				switch v := value.(type) {
+				case []interface{}:
+					next = append(next, v...)
+				case map[string]interface{}:
+					for _, element := range v {
+						next = append(next, element)
+					}
+				default:
+					return nil, errors.New("[*] can only be applied to lists and objects")
+				}
+			case strings.HasPrefix(step, "["):
+				list, ok := value.([]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s can only be applied to lists", step)
+				}
+				index, _ := strconv.Atoi(step[1 : len(step)-1])
+				if index < 0 {
+					index += len(list)
+				}
+				if index < 0 || index >= len(list) {
+					return nil, fmt.Errorf("index %s is out of range", step)
+				}
+				next = append(next, list[index])
+			default:
+				object, ok := value.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s can only be applied to objects", step)
+				}
+				element, ok := object[step]
+				if !ok {
+					return nil, fmt.Errorf("%s is not found", step)
+				}
+				next = append(next, element)
+			}
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// jsonPathText returns how a value is printed, strings and numbers as they are and lists and objects as JSON.
+func jsonPathText(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	raw, err := json.Marshal(value)
+	return string(raw), err
+}
@@ -0,0 +1,81 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPrinter contains the tests for the output formats of the list commands and the purge summary.
+func TestPrinter(t *testing.T) {
+	summary := purgeSummary{DeletedTags: 3, DeletedManifests: 2}
+	list := manifestList{Registry: "foo.azurecr.io", Repository: "bar"}
+	// First test, the text format does not need a printer and unknown formats are rejected.
+	t.Run("FormatTest", func(t *testing.T) {
+		assert := assert.New(t)
+		printer, err := newPrinter(outputText)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Nil(printer)
+		_, err = newPrinter("yaml")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		_, err = newPrinter("go-template={{.DeletedTags")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		_, err = newPrinter("jsonpath={range .tags[*]}{.name}")
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+	// Second test, go templates use the Go field names and json uses the JSON field names.
+	t.Run("GoTemplateTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		printer, _ := newPrinter("go-template={{.DeletedTags}}")
+		assert.Equal(nil, printer.print(out, summary), "Error should be nil")
+		assert.Equal("3", out.String())
+		out.Reset()
+		printer, _ = newPrinter(outputJSON)
+		assert.Equal(nil, printer.print(out, summary), "Error should be nil")
+		assert.Equal("{\n  \"deletedTags\": 3,\n  \"deletedManifests\": 2\n}\n", out.String())
+		out.Reset()
+		assert.Equal(nil, printer.print(out, purgeSummary{DeletedTags: 3, APICalls: &api.CallCounts{List: 2, Delete: 3}}), "Error should be nil")
+		assert.Contains(out.String(), "\"apiCalls\": {\n    \"list\": 2,\n    \"get\": 0,\n    \"delete\": 3,\n    \"other\": 0\n  }")
+	})
+	// Third test, jsonpath expressions select fields, indexes and every element, and range over lists.
+	t.Run("JSONPathTest", func(t *testing.T) {
+		assert := assert.New(t)
+		digest1, digest2 := "sha256:1", "sha256:2"
+		tags := []string{"v1", "latest"}
+		list.Manifests = []acr.ManifestAttributesBase{{Digest: &digest1, Tags: &tags}, {Digest: &digest2}}
+		tests := map[string]string{
+			"jsonpath={.deletedTags}/{$.deletedManifests}": "3/2",
+			"jsonpath=deleted {.deletedTags} tags":         "deleted 3 tags",
+		}
+		for expression, expected := range tests {
+			out := &bytes.Buffer{}
+			printer, err := newPrinter(expression)
+			assert.Equal(nil, err, "Error should be nil")
+			assert.Equal(nil, printer.print(out, summary), "Error should be nil")
+			assert.Equal(expected, out.String())
+		}
+		tests = map[string]string{
+			"jsonpath={.manifests[*].digest}":                                   "sha256:1 sha256:2",
+			"jsonpath={.manifests[-1].digest}":                                  "sha256:2",
+			"jsonpath={.manifests[0].tags}":                                     `["v1","latest"]`,
+			`jsonpath={range .manifests[*]}{$.repository}@{.digest}{"\n"}{end}`: "bar@sha256:1\nbar@sha256:2\n",
+			`jsonpath={range .manifests[0].tags[*]}{@}{","}{end}{['registry']}`: "v1,latest,foo.azurecr.io",
+		}
+		for expression, expected := range tests {
+			out := &bytes.Buffer{}
+			printer, err := newPrinter(expression)
+			assert.Equal(nil, err, "Error should be nil")
+			assert.Equal(nil, printer.print(out, list), "Error should be nil")
+			assert.Equal(expected, out.String(), expression)
+		}
+		printer, _ := newPrinter("jsonpath={.missing}")
+		assert.NotEqual(nil, printer.print(&bytes.Buffer{}, summary), "Error should not be nil")
+	})
+}
@@ -0,0 +1,88 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newPinCmdLongMessage = `acr pin: write a lockfile that pins the tags matching the filters to the digests they currently reference.
+GitOps repositories can deploy the pinned digests, and acr purge --keep-pinned never deletes them.`
+	pinExampleMessage = `  - Pin the tags of the repositories whose name starts with release- in the example.azurecr.io registry
+    acr pin -r example --filter "release-.*:.*" --out pins.json
+
+  - Keep the pinned images while purging the repositories
+    acr purge -r example --filter "release-.*:.*" --ago 30d --untagged --keep-pinned pins.json
+`
+)
+
+// pinParameters defines the parameters used by the pin command.
+type pinParameters struct {
+	*rootParameters
+	filters []string
+	out     string
+	format  string
+}
+
+// newPinCmd defines the pin command.
+func newPinCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	pinParams := pinParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "pin",
+		Short:   "Write a lockfile of tags and their digests",
+		Long:    newPinCmdLongMessage,
+		Example: pinExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registryName, err := pinParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, pinParams.username, pinParams.password, pinParams.configs)
+			if err != nil {
+				return err
+			}
+			opts := purge.NewOptions()
+			opts.SetWarningsOutput(cmd.ErrOrStderr())
+			lockfile, err := purge.NewLockfile(context.Background(), acrClient, purge.SystemClock(), loginURL, pinParams.filters, opts)
+			if err != nil {
+				return err
+			}
+			if len(pinParams.out) == 0 {
+				return purge.WriteLockfile(out, lockfile, pinParams.format)
+			}
+			file, err := os.Create(pinParams.out)
+			if err != nil {
+				return err
+			}
+			if err := purge.WriteLockfile(file, lockfile, pinParams.format); err != nil {
+				file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+			pinned := 0
+			for _, pins := range lockfile.Repositories {
+				pinned += len(pins)
+			}
+			fmt.Fprintf(out, "Lockfile with %d pinned tags written to %s\n", pinned, pinParams.out)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&pinParams.filters, "filter", "f", nil, "Specify the repository and a regular expression filter for the tag name, the matching tags are pinned")
+	cmd.Flags().StringVar(&pinParams.out, "out", "", "The path of the file where the lockfile will be written, the lockfile is printed if it is not set")
+	cmd.Flags().StringVar(&pinParams.format, "format", purge.LockfileFormatJSON, "The format of the lockfile, json or yaml")
+	cmd.MarkFlagRequired("filter")
+	return cmd
+}
@@ -0,0 +1,120 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newPolicyCmdLongMessage     = `acr policy: work with purge policies.`
+	newPolicyTestCmdLongMessage = `acr policy test: evaluate a purge policy against an inventory of tags and manifests described in a local file.
+Nothing is requested from a registry, the tags and manifests of the inventory that have an expect field are checked to
+be deleted or kept by the policy.`
+	policyTestExampleMessage = `  - Print what the policy in policy.yaml deletes from the tags and manifests of inventory.yaml
+    acr policy test --policy policy.yaml --inventory inventory.yaml
+
+    With a policy.yaml like
+      filters: ["hello-world:^v.*"]
+      ago: 30d
+      untagged: true
+    and an inventory.yaml like
+      now: "2020-01-15T00:00:00Z"
+      repositories:
+        hello-world:
+        - digest: sha256:1111
+          lastUpdateTime: "2019-11-01T00:00:00Z"
+          tags:
+          - name: v1
+            expect: delete
+        - digest: sha256:2222
+          lastUpdateTime: "2020-01-14T00:00:00Z"
+          tags:
+          - name: v2
+            expect: keep
+`
+)
+
+// policyTestParameters defines the parameters used by the policy test command.
+type policyTestParameters struct {
+	policy    string
+	inventory string
+	timezone  string
+}
+
+// newPolicyCmd defines the policy command.
+func newPolicyCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Work with purge policies",
+		Long:  newPolicyCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Help()
+			return nil
+		},
+	}
+	cmd.AddCommand(newPolicyTestCmd(out))
+	return cmd
+}
+
+// newPolicyTestCmd defines the policy test command.
+func newPolicyTestCmd(out io.Writer) *cobra.Command {
+	policyTestParams := policyTestParameters{}
+	cmd := &cobra.Command{
+		Use:     "test",
+		Short:   "Evaluate a purge policy against a local inventory",
+		Long:    newPolicyTestCmdLongMessage,
+		Example: policyTestExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			policy, err := purge.ReadPolicy(policyTestParams.policy)
+			if err != nil {
+				return err
+			}
+			if len(policyTestParams.timezone) > 0 {
+				policy.Timezone = policyTestParams.timezone
+			}
+			inventory, err := purge.ReadInventory(policyTestParams.inventory)
+			if err != nil {
+				return err
+			}
+			return testPolicy(context.Background(), out, policy, inventory)
+		},
+	}
+	cmd.Flags().StringVar(&policyTestParams.policy, "policy", "", "The YAML file of the policy, with the filters, ago, before, untagged, matchOn, onlySuperseded and artifactType fields")
+	cmd.Flags().StringVar(&policyTestParams.timezone, "timezone", "", "IANA name of the timezone of the time windows of the policy, it overrides the timezone field of the policy")
+	cmd.Flags().StringVar(&policyTestParams.inventory, "inventory", "", "The YAML file with the tags and manifests the policy is evaluated against")
+	cmd.MarkFlagRequired("policy")
+	cmd.MarkFlagRequired("inventory")
+	return cmd
+}
+
+// testPolicy prints what the policy deletes from the inventory and returns an error if any expectation of the
+// inventory is not met.
+func testPolicy(ctx context.Context, out io.Writer, policy purge.Policy, inventory *purge.Inventory) error {
+	plan, failures, err := purge.EvaluatePolicy(ctx, policy, inventory)
+	if err != nil {
+		return err
+	}
+	now := inventory.Clock().Now()
+	for i := range plan.Repositories {
+		if err := printDryRun(out, &plan.Repositories[i], now, useColor(out)); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "\nNumber of deleted tags: %d\n", plan.TagCount())
+	fmt.Fprintf(out, "Number of deleted manifests: %d\n", plan.ManifestCount())
+	if len(failures) > 0 {
+		fmt.Fprintln(out)
+		for _, failure := range failures {
+			fmt.Fprintf(out, "FAIL: %s\n", failure)
+		}
+		return fmt.Errorf("%d expectations of the inventory are not met", len(failures))
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/Azure/acr-cli/cmd/telemetry"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newPromoteCmdLongMessage = `acr promote: copy the tags of a repository that are old enough to another repository of the registry.
+The tags of the from repository that match its regular expression and were not updated for at least the min-age
+duration are tagged with the same name in the to repository, the blobs are mounted so nothing is downloaded. It is the
+counterpart of the purge in promotion-based retention: images are pushed to a staging repository that is purged
+aggressively, and the ones that survived the soak time are promoted to a repository that keeps them. The tags that are
+already promoted are skipped, a tag of the target that references another image is only moved with the force flag.`
+	promoteExampleMessage = `  - Promote the release candidates of staging/app that are at least 7 days old to prod/app
+    acr promote -r example --from "staging/app:^rc-.*" --to prod/app --min-age 7d
+
+  - Print what would be promoted without copying anything
+    acr promote -r example --from "staging/app:^rc-.*" --to prod/app --min-age 7d --dry-run`
+)
+
+// promoteParameters defines the parameters used by the promote command.
+type promoteParameters struct {
+	*rootParameters
+	from   string
+	to     string
+	minAge string
+	dryRun bool
+	force  bool
+}
+
+// promotion is a tag of the source repository that is old enough to be promoted and the digest it references.
+type promotion struct {
+	tag    string
+	digest string
+}
+
+// promoteClient contains the methods used to select and copy the tags within a registry.
+type promoteClient interface {
+	api.TagLister
+	artifactTarget
+	GetBlob(ctx context.Context, repoName string, digest string) ([]byte, error)
+	HeadManifest(ctx context.Context, repoName string, reference string) (string, error)
+}
+
+// newPromoteCmd defines the promote command.
+func newPromoteCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	promoteParams := promoteParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "promote",
+		Short:   "Copy the tags that are old enough to another repository",
+		Long:    newPromoteCmdLongMessage,
+		Example: promoteExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registryName, err := promoteParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			opts := purge.NewOptions()
+			opts.SetWarningsOutput(cmd.ErrOrStderr())
+			tagFilters, err := opts.GetTagFilters([]string{promoteParams.from}, purge.MatchOnTag)
+			if err != nil {
+				return fmt.Errorf("invalid from value %q, expected <repository>:<regex filter>: %w", promoteParams.from, err)
+			}
+			var sourceRepo, tagFilter string
+			// A single filter results in a single repository.
+			for repoName, repoFilter := range tagFilters {
+				sourceRepo, tagFilter = repoName, repoFilter
+			}
+			if sourceRepo == promoteParams.to {
+				return errors.New("the from and to repositories must be different")
+			}
+			filter, err := regexp.Compile(tagFilter)
+			if err != nil {
+				return fmt.Errorf("invalid filter of %s: %w", sourceRepo, err)
+			}
+			minAge, err := purge.ParseDuration(promoteParams.minAge)
+			if err != nil {
+				return fmt.Errorf("invalid min-age value %q: %w", promoteParams.minAge, err)
+			}
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, promoteParams.username, promoteParams.password, promoteParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			// ParseDuration returns a negative duration, the tags updated before the cutoff are old enough.
+			cutoff := purge.SystemClock().Now().Add(minAge)
+			promotions, err := selectPromotions(ctx, acrClient, sourceRepo, filter, cutoff)
+			if err != nil {
+				return err
+			}
+			return promoteTags(ctx, out, acrClient, loginURL, sourceRepo, promoteParams.to, promotions, promoteParams.dryRun, promoteParams.force)
+		},
+	}
+	cmd.Flags().StringVar(&promoteParams.from, "from", "", "The repository and a regular expression filter of the tags to promote, e.g. staging/app:^rc-.*")
+	cmd.Flags().StringVar(&promoteParams.to, "to", "", "The repository the tags are promoted to")
+	cmd.Flags().StringVar(&promoteParams.minAge, "min-age", "0d", "Only promote the tags that were not updated for at least this duration, e.g. 7d or 12h")
+	cmd.Flags().BoolVar(&promoteParams.dryRun, "dry-run", false, "Print the tags that would be promoted without copying them")
+	cmd.Flags().BoolVar(&promoteParams.force, "force", false, "Move the tags of the target repository that reference another image")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+// selectPromotions lists the tags of the repository that match the filter and were last updated before the cutoff.
+func selectPromotions(ctx context.Context, acrClient api.TagLister, repoName string, filter *regexp.Regexp, cutoff time.Time) ([]promotion, error) {
+	promotions := []promotion{}
+	tagPager := api.NewTagPager(acrClient, repoName, "")
+	for !tagPager.Done() {
+		resultTags, err := tagPager.Next(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the tags of %s: %w", repoName, err)
+		}
+		if resultTags == nil || resultTags.TagsAttributes == nil {
+			break
+		}
+		for _, tag := range *resultTags.TagsAttributes {
+			if tag.Name == nil || tag.Digest == nil || tag.LastUpdateTime == nil || !filter.MatchString(*tag.Name) {
+				continue
+			}
+			lastUpdateTime, err := time.Parse(time.RFC3339Nano, *tag.LastUpdateTime)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the last update time of %s:%s: %w", repoName, *tag.Name, err)
+			}
+			if lastUpdateTime.Before(cutoff) {
+				promotions = append(promotions, promotion{tag: *tag.Name, digest: *tag.Digest})
+			}
+		}
+	}
+	return promotions, nil
+}
+
+// promoteTags tags the digests of the promotions in the target repository. The tags that already reference the digest
+// are skipped, the ones that reference another image are reported and only moved with force. Every promotion is tried
+// even if another one failed.
+func promoteTags(ctx context.Context, out io.Writer, acrClient promoteClient, loginURL string, sourceRepo string, targetRepo string, promotions []promotion, dryRun bool, force bool) error {
+	var target artifactTarget = acrClient
+	if uploader, ok := acrClient.(api.BlobUploader); ok {
+		target = mountingTarget{artifactTarget: acrClient, BlobUploader: uploader, fromRepo: sourceRepo}
+	}
+	promoted, skipped := 0, 0
+	var failed []error
+	for _, p := range promotions {
+		existing, err := acrClient.HeadManifest(ctx, targetRepo, p.tag)
+		if err != nil {
+			failed = append(failed, fmt.Errorf("failed to get manifest %s of %s: %w", p.tag, targetRepo, err))
+			continue
+		}
+		if existing == p.digest {
+			skipped++
+			continue
+		}
+		if len(existing) > 0 && !force {
+			failed = append(failed, fmt.Errorf("%s:%s already references another image, use the force flag to move it", targetRepo, p.tag))
+			continue
+		}
+		if dryRun {
+			fmt.Fprintf(out, "Would promote %s/%s:%s to %s/%s:%s (%s)\n", loginURL, sourceRepo, p.tag, loginURL, targetRepo, p.tag, p.digest)
+			promoted++
+			continue
+		}
+		// The digest is copied instead of the tag in case the tag moved since it was listed.
+		if _, err := copyImage(ctx, acrClient, target, sourceRepo, p.digest, targetRepo, p.tag, true); err != nil {
+			failed = append(failed, err)
+			continue
+		}
+		fmt.Fprintf(out, "Promoted %s/%s:%s to %s/%s:%s (%s)\n", loginURL, sourceRepo, p.tag, loginURL, targetRepo, p.tag, p.digest)
+		promoted++
+	}
+	if dryRun {
+		fmt.Fprintf(out, "\nNumber of tags to promote: %d\n", promoted)
+	} else {
+		fmt.Fprintf(out, "\nNumber of promoted tags: %d\n", promoted)
+		telemetry.Count("promotedTags", promoted)
+	}
+	fmt.Fprintf(out, "Number of tags already promoted: %d\n", skipped)
+	if len(failed) > 0 {
+		for _, err := range failed {
+			fmt.Fprintf(out, "Error: %v\n", err)
+		}
+		return fmt.Errorf("failed to promote %d of %d tags: %w", len(failed), len(promotions), failed[0])
+	}
+	return nil
+}
+
+// mountingTarget is a target in the same registry as the source repository, its blobs are mounted from the source
+// repository instead of being downloaded and uploaded again, the blobs that cannot be mounted are uploaded in chunks.
+type mountingTarget struct {
+	artifactTarget
+	api.BlobUploader
+	fromRepo string
+}
+
+// mountBlob mounts a blob of the source repository, false is returned if the registry could not mount it. The upload
+// session the registry starts in that case is abandoned, the blob is uploaded in a new one.
+func (t mountingTarget) mountBlob(ctx context.Context, repoName string, digest string) (bool, error) {
+	upload, err := t.MountBlob(ctx, repoName, t.fromRepo, digest)
+	if err != nil {
+		return false, err
+	}
+	return upload == nil, nil
+}
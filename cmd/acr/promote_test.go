@@ -0,0 +1,82 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/fakeacr"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPromote contains the tests for the promotion of the tags that are old enough to another repository.
+func TestPromote(t *testing.T) {
+	registry := fakeacr.NewRegistry("user", "password")
+	defer registry.Close()
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), "user", "password", nil)
+	assert.Equal(t, nil, err, "Error should be nil")
+	acrClient.AutorestClient.Sender = registry.HTTPClient()
+	now := time.Now().UTC()
+	old := now.Add(-10 * 24 * time.Hour)
+	rc1 := registry.PushImage("staging/app", "rc-1", old)
+	amd64 := registry.PushImage("staging/app", "", old)
+	arm64 := registry.PushImage("staging/app", "", old)
+	multi := registry.PushIndex("staging/app", "rc-2", old, amd64, arm64)
+	registry.PushImage("staging/app", "rc-3", now.Add(-time.Hour))
+	registry.PushImage("staging/app", "v1", old)
+	filter := regexp.MustCompile("^rc-.*")
+	cutoff := now.Add(-7 * 24 * time.Hour)
+	// First test, only the matching tags older than the cutoff are selected.
+	t.Run("SelectTest", func(t *testing.T) {
+		assert := assert.New(t)
+		promotions, err := selectPromotions(testCtx, acrClient, "staging/app", filter, cutoff)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]promotion{{tag: "rc-1", digest: rc1}, {tag: "rc-2", digest: multi}}, promotions)
+	})
+	// Second test, a dry run prints the promotions without copying anything.
+	t.Run("DryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		promotions, _ := selectPromotions(testCtx, acrClient, "staging/app", filter, cutoff)
+		var out bytes.Buffer
+		assert.Equal(nil, promoteTags(testCtx, &out, acrClient, registry.LoginURL(), "staging/app", "prod/app", promotions, true, false), "Error should be nil")
+		assert.Contains(out.String(), "Number of tags to promote: 2")
+		assert.Equal([]string{}, registry.Tags("prod/app"))
+	})
+	// Third test, the images and the manifests of the index are copied with their blobs mounted, and a second
+	// promotion skips the tags that were already promoted.
+	t.Run("PromoteTest", func(t *testing.T) {
+		assert := assert.New(t)
+		promotions, _ := selectPromotions(testCtx, acrClient, "staging/app", filter, cutoff)
+		var out bytes.Buffer
+		assert.Equal(nil, promoteTags(testCtx, &out, acrClient, registry.LoginURL(), "staging/app", "prod/app", promotions, false, false), "Error should be nil")
+		assert.Contains(out.String(), "Number of promoted tags: 2")
+		assert.Equal([]string{"rc-1", "rc-2"}, registry.Tags("prod/app"))
+		assert.Len(registry.Manifests("prod/app"), 4)
+		for _, request := range registry.Requests() {
+			assert.False(strings.HasPrefix(request, "GET /v2/staging/app/blobs/"), "No blob should be downloaded: %s", request)
+		}
+		out.Reset()
+		assert.Equal(nil, promoteTags(testCtx, &out, acrClient, registry.LoginURL(), "staging/app", "prod/app", promotions, false, false), "Error should be nil")
+		assert.Contains(out.String(), "Number of promoted tags: 0")
+		assert.Contains(out.String(), "Number of tags already promoted: 2")
+	})
+	// Fourth test, a target tag that references another image is only moved with force, the other tags are promoted.
+	t.Run("ConflictTest", func(t *testing.T) {
+		assert := assert.New(t)
+		registry.PushImage("prod/app", "rc-1", now)
+		promotions, _ := selectPromotions(testCtx, acrClient, "staging/app", filter, cutoff)
+		var out bytes.Buffer
+		err := promoteTags(testCtx, &out, acrClient, registry.LoginURL(), "staging/app", "prod/app", promotions, false, false)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), "prod/app:rc-1 already references another image")
+		assert.Equal(nil, promoteTags(testCtx, &out, acrClient, registry.LoginURL(), "staging/app", "prod/app", promotions, false, true), "Error should be nil")
+		digest, _ := acrClient.HeadManifest(testCtx, "prod/app", "rc-1")
+		assert.Equal(rc1, digest)
+	})
+}
@@ -6,19 +6,22 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"math"
-	"net/http"
-	"regexp"
-	"strings"
-	"sync"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
 	"time"
 
-	"github.com/Azure/acr-cli/acr"
 	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/events"
+	"github.com/Azure/acr-cli/cmd/notify"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/Azure/acr-cli/cmd/sinks"
+	"github.com/Azure/acr-cli/cmd/telemetry"
 	"github.com/Azure/acr-cli/cmd/worker"
-	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -38,24 +41,201 @@ const (
   - Delete all tags older than 1 day in the example.azurecr.io registry inside the hello-world repository using the credentials found in 
     the C://Users/docker/config.json path
 	acr purge -r example --filter "hello-world:.*" --ago 1d --config C://Users/docker/config.json
+
+  - Delete all tags that reference a manifest whose digest begins with sha256:4f3e in the example.azurecr.io registry inside the hello-world repository
+	acr purge -r example --filter "hello-world:^sha256:4f3e" --ago 0d --match-on digest
+
+  - Show which tags and manifests would be deleted using the metadata stored in snap.db by the snapshot command
+	acr purge --filter "hello-world:.*" --ago 1d --untagged --dry-run --from-snapshot snap.db
+
+  - Delete all tags that begin with dev- and are older than 7 days, except the most recently updated image
+	acr purge -r example --filter "hello-world:^dev-.*" --ago 7d --only-superseded
+
+  - Delete all tags that were last updated before the 31st of January 2024 in the example.azurecr.io registry inside the hello-world repository
+	acr purge -r example --filter "hello-world:.*" --before 2024-01-31
+
+  - Show which tags would have been deleted by a purge that ran on the 1st of October 2019
+	acr purge -r example --filter "hello-world:.*" --ago 7d --dry-run --now 2019-10-01T00:00:00Z
+
+  - Show which tags would be deleted now that were not selected by the dry run that stored plan.json, and update it
+	acr purge -r example --filter "hello-world:.*" --ago 7d --dry-run --diff plan.json --save-plan plan.json
+
+  - Delete all tags older than 30 days of a registry that is not an ACR
+	acr purge -r ghcr.io --filter "example/hello-world:.*" --ago 30d --registry-type oci
+
+  - Delete tags selected by a list of generated filters, one per line
+	generate-filters | acr purge -r example --filter-file - --ago 30d
 `
 
-	defaultNumWorkers       = 6
-	manifestListContentType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	defaultNumWorkers = 6
+	// defaultGracePeriod is the time the consumers of a tag scheduled for deletion have to object before it is swept.
+	defaultGracePeriod = "7d"
+	// autoConcurrency is the value of the concurrency flag that adapts the number of concurrent deletions to the registry.
+	autoConcurrency = "auto"
+	// defaultSlowRequestThreshold is the latency above which deletions are logged unless specified otherwise.
+	defaultSlowRequestThreshold = 5 * time.Second
+	// defaultBatchSize is the maximum amount of tags deleted with a single request unless specified otherwise.
+	defaultBatchSize = 50
+	// defaultMinAge is the age under which tags and manifests are never deleted unless the force flag is set.
+	defaultMinAge = purge.DefaultMinAge
 )
 
 // purgeParameters defines the parameters that the purge command uses (including the registry name, username and password).
 type purgeParameters struct {
 	*rootParameters
-	ago      string
-	filters  []string
-	untagged bool
-	dryRun   bool
+	ago          string
+	before       string
+	filters      []string
+	filterFile   string
+	untagged     bool
+	untaggedAgo  string
+	dryRun       bool
+	fromSnapshot string
+	matchOn      string
+	now          string
+	diagnose     bool
+	registryType string
+	// manifestCacheDir keeps the manifest bodies between runs, they are always cached in memory during a run.
+	manifestCacheDir string
+	// maxBandwidth and maxDownloads limit the downloads of manifest and blob bodies, e.g. on small links at the edge.
+	maxBandwidth string
+	maxDownloads int
+	// savePlan and diff store the plan of a dry run and compare it with a previously stored plan.
+	savePlan string
+	diff     string
+	// slowRequestThreshold is the latency above which a deletion is logged.
+	slowRequestThreshold time.Duration
+	// verifyDigest checks that every tag still references the listed digest right before deleting it.
+	verifyDigest bool
+	// platforms are the platforms whose child manifests are removed from the indexes instead of deleting the tags.
+	platforms []string
+	// estimate only scans the registry and projects the requests and the runtime of the purge.
+	estimate bool
+	// batchSize is the maximum amount of tags deleted with a single request when the registry supports it.
+	batchSize int
+	// onlySuperseded keeps the most recent build of the matching tags even if it is older than the cutoff.
+	onlySuperseded bool
+	// output is the format of the summary.
+	output string
+	// progressFormat is text, or json to write the progress events to the standard output.
+	progressFormat string
+	// notifyWebhook is the URL the report of the purge is posted to.
+	notifyWebhook string
+	// deleteEmptyRepos deletes the repositories that have no manifests left after the purge.
+	deleteEmptyRepos bool
+	// skipPermissionCheck skips the check that the identity can delete before the purge starts.
+	skipPermissionCheck bool
+	// reportCSV is the path of the CSV file every deleted tag and manifest is written to.
+	reportCSV string
+	// reportHTML is the path of the static web page of the deleted tags and manifests.
+	reportHTML string
+	// eventSink is the Event Hub connection string or Storage queue URL an event is sent to for every deletion.
+	eventSink string
+	// stateFile is the path of the file the progress is checkpointed to so that an aborted purge can be resumed.
+	stateFile string
+	// minAge protects the tags and manifests updated recently whatever the cutoff is, force disables it.
+	minAge time.Duration
+	force  bool
+	// artifactType restricts the purge to the tags and manifests of an artifact type (e.g. helm).
+	artifactType string
+	// excludeLabels keeps the images whose config contains one of the labels.
+	excludeLabels []string
+	// pushedBy restricts the purge to the images pushed by one of the identities.
+	pushedBy []string
+	// keepPerGroup keeps the most recent tags of every value of the capture groups of the filters.
+	keepPerGroup int
+	// filterTimeout is the time the evaluation of the filters can take during the purge.
+	filterTimeout time.Duration
+	// markOnly schedules the deletion of the tags with tombstones, sweep deletes the tags scheduled more than the grace
+	// period ago.
+	markOnly    bool
+	sweep       bool
+	gracePeriod string
+	// concurrency is the number of concurrent deletions, or auto to adapt it to the latency and throttling of the registry.
+	concurrency string
+	// verify lists the purged repositories again to check that every deleted tag and manifest is gone.
+	verify bool
+	// checkSignatures keeps the signed images unless allowSigned is set, onlyUnsigned quietly restricts the purge to
+	// the unsigned images.
+	checkSignatures bool
+	allowSigned     bool
+	onlyUnsigned    bool
+	// keepPinned is the path of a lockfile written by acr pin, the digests it pins are never purged.
+	keepPinned string
+	// sku is the SKU of the registry, if it is not set it is read through Azure Resource Manager when the resource
+	// group is known. The concurrency and the pacing of the requests are adapted to its limits.
+	sku           string
+	subscription  string
+	resourceGroup string
+	// includeCached purges the repositories cached by the cache rules of the registry, they are skipped by default.
+	includeCached bool
+	// connectedRegistry is the resource ID of the connected registry that is purged, its sync state is checked first.
+	connectedRegistry string
+	// keepIfPresentIn is a registry whose digests are kept, it is reached with the reference credentials.
+	keepIfPresentIn   string
+	referenceUsername string
+	referencePassword string
+	// maxDeletes stops the purge once that many tags and manifests were queued for deletion, 0 means no limit.
+	maxDeletes int
+	// placeholders are the values of the placeholders of the repositories of the filters in the form name=v1,v2.
+	placeholders []string
+	// includeReferrers deletes the referrer chains of the untagged manifests that are deleted.
+	includeReferrers bool
+	// allowPartialUntag deletes the tags whose digest has other tags that are not deleted without looking for the other
+	// tags, keepPartialUntag keeps such tags. They are deleted with a warning otherwise.
+	allowPartialUntag bool
+	keepPartialUntag  bool
+	// timeWindows is a file of time windows that restrict when the repositories are purged and which tags are
+	// deleted, their days and hours are in the timezone.
+	timeWindows string
+	timezone    string
+	// reportOutput is the file, Storage blob or stdout the report of the run is written to when it finishes.
+	reportOutput string
 }
 
-// The WaitGroup is used to make sure that the http requests are finished before exiting the program, and also to limit the
-// amount of concurrent http calls to the defaultNumWorkers
-var wg sync.WaitGroup
+// purgeSummary is the summary of a purge printed when an output format is selected.
+type purgeSummary struct {
+	DeletedTags      int `json:"deletedTags"`
+	DeletedManifests int `json:"deletedManifests"`
+	TrimmedTags      int `json:"trimmedTags,omitempty"`
+	MarkedTags       int `json:"markedTags,omitempty"`
+	DeletedRepos     int `json:"deletedRepositories,omitempty"`
+	// Remaining are the deleted tags and manifests the verification found, it is only set with the verify flag.
+	Remaining []purge.Remaining `json:"remaining,omitempty"`
+	// APICalls are the requests sent to the registry by kind, it is not set if none was sent (e.g. with a snapshot).
+	APICalls *api.CallCounts `json:"apiCalls,omitempty"`
+}
+
+// purgeRun is a run of the purge command, its steps share the client, the options and the values parsed from the
+// flags through it.
+type purgeRun struct {
+	params *purgeParameters
+	out    io.Writer
+	// errOut is where the warnings of the run are written, the standard error of the command.
+	errOut  io.Writer
+	printer *printer
+	opts    *purge.Options
+	// numWorkers is the number of concurrent deletions, 0 adapts it to the latency and throttling of the registry.
+	numWorkers int
+	loginURL   string
+	acrClient  api.AcrCLIClientInterface
+	// dispatcher runs the deletions of the run, it is nil until the client is connected and with a snapshot.
+	dispatcher *worker.Dispatcher
+	// calls counts the requests of the run for the summary, the requests of other runs are not counted.
+	calls *api.CallCounter
+	// requestCounter counts the requests that reach the registry for the estimate flag, it is nil otherwise.
+	requestCounter *purge.RequestCounter
+	clock          purge.Clock
+	cutoff         purge.Cutoff
+	// filters are the filters of the flags and of the filter file with their placeholders, tagFilters are the regular
+	// expressions of every repository once the placeholders are expanded.
+	filters         []string
+	placeholders    map[string][]string
+	tagFilters      map[string]string
+	windows         []purge.TimeWindow
+	platforms       []purge.Platform
+	signaturePolicy string
+}
 
 // newPurgeCmd defines the purge command.
 func newPurgeCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
@@ -65,473 +245,1127 @@ func newPurgeCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
 		Short:   "Delete images from a registry.",
 		Long:    newPurgeCmdLongMessage,
 		Example: purgeExampleMessage,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			// This context is used for all the http requests.
-			ctx := context.Background()
-			registryName, err := purgeParams.GetRegistryName()
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			printer, err := newPrinter(purgeParams.output)
 			if err != nil {
 				return err
 			}
-			loginURL := api.LoginURL(registryName)
-			// An acrClient with authentication is generated, if the authentication cannot be resolved an error is returned.
-			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, purgeParams.username, purgeParams.password, purgeParams.configs)
+			// With the json progress format the standard output only contains the progress events, everything the
+			// purge prints as text goes to the standard error instead.
+			out := out
+			errOut := cmd.ErrOrStderr()
+			var progressOut io.Writer
+			switch purgeParams.progressFormat {
+			case outputText:
+			case outputJSON:
+				if printer != nil {
+					return errors.New("the progress-format flag cannot be json together with an output format other than text")
+				}
+				progressOut = out
+				out = errOut
+			default:
+				return fmt.Errorf("invalid progress format %q, supported values are %s and %s", purgeParams.progressFormat, outputText, outputJSON)
+			}
+			numWorkers, err := parseConcurrency(purgeParams.concurrency)
 			if err != nil {
 				return err
 			}
-			// In order to only have a fixed amount of http requests a dispatcher is started that will keep forwarding the jobs
-			// to the workers, which are goroutines that continuously fetch for tags/manifests to delete.
-			worker.StartDispatcher(ctx, &wg, acrClient, defaultNumWorkers)
-			// A map is used to keep the regex tags for every repository.
-			tagFilters := map[string][]string{}
-			for _, filter := range purgeParams.filters {
-				repoName, tagRegex, err := getRepositoryAndTagRegex(filter)
-				if err != nil {
+			// The flags of the purge are turned into the options of the run.
+			run := &purgeRun{params: &purgeParams, out: out, errOut: errOut, printer: printer, opts: purge.NewOptions(), numWorkers: numWorkers, calls: api.NewCallCounter()}
+			run.opts.SetOutput(out)
+			run.opts.SetWarningsOutput(errOut)
+			// This context is used for all the http requests, the API calls of the summary are the ones of this purge.
+			ctx := api.WithCallCounter(context.Background(), run.calls)
+			run.opts.SetCallCounter(run.calls)
+			if err := run.connect(ctx, cmd); err != nil {
+				return err
+			}
+			if run.dispatcher != nil {
+				defer run.dispatcher.Stop()
+			}
+			if run.clock, err = purgeParams.clock(); err != nil {
+				return err
+			}
+			run.opts.SetClock(run.clock)
+			// The events are stamped with the time they happen, even if the now flag is used. The error the purge
+			// fails with is the last event.
+			if progressOut != nil {
+				progress := purge.NewProgress(progressOut, purge.SystemClock())
+				run.opts.EnableProgress(progress)
+				defer func() {
+					if err != nil {
+						progress.Emit(purge.ProgressEvent{Event: purge.ProgressError, Error: err.Error()})
+					}
+					if progressErr := progress.Err(); progressErr != nil && err == nil {
+						err = fmt.Errorf("failed to write the progress events: %w", progressErr)
+					}
+				}()
+			}
+			if err := run.setCutoff(); err != nil {
+				return err
+			}
+			if err := run.setFilters(ctx); err != nil {
+				return err
+			}
+			if err := run.setOptions(); err != nil {
+				return err
+			}
+			if err := run.validate(); err != nil {
+				return err
+			}
+			if purgeParams.estimate {
+				// The automatic concurrency is estimated with the default number of workers.
+				if run.numWorkers == 0 {
+					run.numWorkers = defaultNumWorkers
+				}
+				return estimatePurge(ctx, out, run.acrClient, run.requestCounter, run.clock, run.loginURL, run.policy(), run.numWorkers, run.opts)
+			}
+			if len(purgeParams.savePlan) > 0 || len(purgeParams.diff) > 0 {
+				return dryRunPlan(ctx, out, run.acrClient, run.clock, run.loginURL, run.policy(), purgeParams.savePlan, purgeParams.diff, printer, run.opts)
+			}
+			// An identity that can only pull would otherwise fail with a 403 for every deletion of the workers.
+			if !purgeParams.dryRun && !purgeParams.skipPermissionCheck {
+				if err := purge.CheckPermissions(ctx, run.acrClient, run.repositories()); err != nil {
 					return err
 				}
-				if _, ok := tagFilters[repoName]; ok {
-					tagFilters[repoName] = append(tagFilters[repoName], tagRegex)
-				} else {
-					tagFilters[repoName] = []string{tagRegex}
+			}
+			// The rows of the CSV report are flushed even if the purge fails so that the report contains what was
+			// deleted before the failure.
+			if len(purgeParams.reportCSV) > 0 || len(purgeParams.reportHTML) > 0 {
+				finishReports, reportsErr := run.enableReports()
+				if reportsErr != nil {
+					return reportsErr
+				}
+				defer func() {
+					if reportsErr := finishReports(); reportsErr != nil && err == nil {
+						err = reportsErr
+					}
+				}()
+			}
+			publisher, err := run.enableEvents(ctx)
+			if err != nil {
+				return err
+			}
+			if publisher != nil {
+				defer func() {
+					if _, eventsErr := publisher.Close(); eventsErr != nil {
+						fmt.Fprintf(errOut, "Warning: %v\n", eventsErr)
+					}
+				}()
+			}
+			// The deleted tags and manifests are recorded to check that they are gone once the purge finishes.
+			var verifier *purge.Verifier
+			if purgeParams.verify {
+				verifier = purge.NewVerifier()
+				run.opts.EnableVerify(verifier)
+			}
+			// The progress is checkpointed to the state file, a purge started with the same state file and flags
+			// skips the repositories and the pages of tags that were already purged.
+			var purgeState *purge.State
+			if len(purgeParams.stateFile) > 0 {
+				if purgeState, err = purge.LoadState(purgeParams.stateFile, run.policy()); err != nil {
+					return err
 				}
+				run.opts.EnableState(purgeState)
 			}
 
-			// In order to print a summary of the deleted tags/manifests the counters get updated everytime a repo is purged.
-			deletedTagsCount := 0
-			deletedManifestsCount := 0
-			for repoName, listOfTagRegex := range tagFilters {
-				tagRegex := listOfTagRegex[0]
-				for i := 1; i < len(listOfTagRegex); i++ {
-					// To only iterate through a repo once a big regex filter is made of all the filters of a particular repo.
-					tagRegex = tagRegex + "|" + listOfTagRegex[i]
+			// In order to print a summary of the deleted tags/manifests the report gets updated everytime a repo is purged,
+			// it is also sent to the webhook when the purge finishes or fails.
+			report := notify.NewReport(run.loginURL, purgeParams.dryRun)
+			// The report is also kept in a file or a Storage blob, e.g. by the scheduled purges whose containers have no
+			// persistent volume. The target is opened first so that a wrong target fails before anything is deleted.
+			if len(purgeParams.reportOutput) > 0 {
+				reportWriter, reportErr := sinks.Open(purgeParams.reportOutput, "application/json", out)
+				if reportErr != nil {
+					return reportErr
 				}
-				if !purgeParams.dryRun {
-					singleDeletedTagsCount, err := purgeTags(ctx, acrClient, loginURL, repoName, purgeParams.ago, tagRegex)
-					if err != nil {
-						return errors.Wrap(err, "failed to purge tags")
-					}
-					singleDeletedManifestsCount := 0
-					// If the untagged flag is set then also manifests are deleted.
-					if purgeParams.untagged {
-						singleDeletedManifestsCount, err = purgeDanglingManifests(ctx, acrClient, loginURL, repoName)
-						if err != nil {
-							return errors.Wrap(err, "failed to purge manifests")
-						}
+				defer func() {
+					report.Finish(err)
+					if reportErr := writeRunReport(reportWriter, report); reportErr != nil && err == nil {
+						err = reportErr
 					}
-					// After every repository is purged the counters are updated.
-					deletedTagsCount += singleDeletedTagsCount
-					deletedManifestsCount += singleDeletedManifestsCount
-				} else {
-					// No tag or manifest will be deleted but the counters still will be updated.
-					singleDeletedTagsCount, singleDeletedManifestsCount, err := dryRunPurge(ctx, acrClient, loginURL, repoName, purgeParams.ago, tagRegex, purgeParams.untagged)
-					if err != nil {
-						return errors.Wrap(err, "failed to dry-run purge")
+				}()
+			}
+			if len(purgeParams.notifyWebhook) > 0 {
+				defer func() {
+					report.Finish(err)
+					if notifyErr := notify.Send(ctx, purgeParams.notifyWebhook, report); notifyErr != nil {
+						fmt.Fprintf(errOut, "Warning: %v\n", notifyErr)
 					}
-					deletedTagsCount += singleDeletedTagsCount
-					deletedManifestsCount += singleDeletedManifestsCount
-
+				}()
+			}
+			resumedRepos, err := run.purgeRepositories(ctx, report, purgeState)
+			if err != nil {
+				return err
+			}
+			// The purge finished so the next one starts from the beginning.
+			if purgeState != nil {
+				if err := purgeState.Remove(); err != nil {
+					return err
 				}
 			}
+			// The registry can accept a deletion and finish it later, so the deleted items are listed again.
+			var remaining []purge.Remaining
+			if verifier != nil {
+				remaining, err = verifier.Verify(ctx, run.acrClient, out)
+				if err != nil {
+					return run.purgeError(err, report.Changed())
+				}
+			}
+			telemetry.Count("deletedTags", report.DeletedTags)
+			telemetry.Count("deletedManifests", report.DeletedManifests)
+			telemetry.Count("deletedRepositories", report.DeletedRepos)
 			// After all repos have been purged the summary is printed.
-			fmt.Printf("\nNumber of deleted tags: %d\n", deletedTagsCount)
-			fmt.Printf("Number of deleted manifests: %d\n", deletedManifestsCount)
-
+			if err := run.printSummary(report, remaining, verifier); err != nil {
+				return err
+			}
+			if len(remaining) > 0 {
+				return run.purgeError(fmt.Errorf("%d deleted tags or manifests are still present", len(remaining)), report.Changed())
+			}
+			if report.Changed() == 0 && resumedRepos == 0 {
+				return errNothingMatched
+			}
 			return nil
 		},
 	}
 
 	cmd.Flags().BoolVar(&purgeParams.untagged, "untagged", false, "If the untagged flag is set all the manifests that do not have any tags associated to them will be also purged, except if they belong to a manifest list that contains at least one tag")
-	cmd.Flags().BoolVar(&purgeParams.dryRun, "dry-run", false, "If the dry-run flag is set no manifest or tag will be deleted, the output would be the same as if they were deleted")
-	cmd.Flags().StringVar(&purgeParams.ago, "ago", "", "The tags that were last updated before this duration will be deleted, the format is [number]d[string] where the first number represents an amount of days and the string is in a Go duration format (e.g. 2d3h6m selects images older than 2 days, 3 hours and 6 minutes)")
+	cmd.Flags().BoolVar(&purgeParams.dryRun, "dry-run", false, "If the dry-run flag is set no manifest or tag will be deleted, the tags and manifests that would be deleted are printed grouped by repository")
+	cmd.Flags().StringVar(&purgeParams.ago, "ago", "", "The tags that were last updated before this duration will be deleted, the format is a list of calendar units, y (years), mo (months), w (weeks) and d (days), followed by a Go duration (e.g. 2d3h6m selects images older than 2 days, 3 hours and 6 minutes and 1y6mo images older than a year and a half)")
+	cmd.Flags().StringVar(&purgeParams.before, "before", "", "The tags that were last updated before this date will be deleted, the format is 2006-01-02 (midnight UTC) or RFC3339 (e.g. 2024-01-31T08:00:00Z), it cannot be used together with the ago flag")
 	cmd.Flags().StringArrayVarP(&purgeParams.filters, "filter", "f", nil, "Specify the repository and a regular expression filter for the tag name, if a tag matches the filter and is older than the duration specified in ago it will be deleted")
+	cmd.Flags().StringVar(&purgeParams.filterFile, "filter-file", "", "Read the filters from a file with one <repository>:<regex filter> per line instead of the command line, use - to read them from stdin. Blank lines and lines that start with # are ignored")
 	cmd.Flags().StringArrayVarP(&purgeParams.configs, "config", "c", nil, "Authentication config paths (e.g. C://Users/docker/config.json)")
+	cmd.Flags().StringVar(&purgeParams.matchOn, "match-on", purge.MatchOnTag, "Whether the regular expression of the filter flag is matched against the tag name (tag) or against the digest the tag references (digest)")
+	cmd.Flags().StringVar(&purgeParams.fromSnapshot, "from-snapshot", "", "Evaluate the filters against a snapshot created with the snapshot command instead of the registry, requires the dry-run flag")
+	cmd.Flags().BoolVar(&purgeParams.onlySuperseded, "only-superseded", false, "Only delete a tag if another tag that matches the filter was updated more recently and references a different digest, this keeps the latest build even if it is older than the ago duration")
+	cmd.Flags().IntVar(&purgeParams.keepPerGroup, "keep-per-group", 0, "Keep the most recently updated tags of every value of the capture groups of the filter, e.g. 3 with the filter ^(?P<branch>.+)-\\d+$ keeps the 3 latest tags of every branch")
+	cmd.Flags().StringVar(&purgeParams.now, "now", "", "Measure the age of the tags from this RFC3339 time instead of the current time (e.g. 2019-10-01T00:00:00Z), useful to reproduce what a previous purge selected")
+	cmd.Flags().StringVar(&purgeParams.manifestCacheDir, "manifest-cache-dir", "", "Also store the manifest lists in this directory so that later runs do not fetch them again, they are always cached in memory during a run")
+	cmd.Flags().StringVar(&purgeParams.maxBandwidth, "max-bandwidth", "", "Limit the downloads of manifest and blob bodies to this many bytes per second on average, e.g. 10MB")
+	cmd.Flags().IntVar(&purgeParams.maxDownloads, "max-downloads", 0, "Limit the number of manifest and blob bodies downloaded concurrently, 0 does not limit it")
+	cmd.Flags().StringVar(&purgeParams.savePlan, "save-plan", "", "Store the tags and manifests the dry run selected in this file so that later dry runs can be compared against it with the diff flag, requires the dry-run flag")
+	cmd.Flags().StringVar(&purgeParams.diff, "diff", "", "Compare the dry run with a plan stored with the save-plan flag and show which candidates are new, which disappeared and which remain, requires the dry-run flag")
+	cmd.Flags().StringVar(&purgeParams.registryType, "registry-type", api.RegistryTypeAuto, "The type of the registry, acr uses the ACR APIs and oci only uses the OCI distribution API so that any compliant registry can be purged, auto detects it")
+	cmd.Flags().BoolVar(&purgeParams.diagnose, "diagnose", false, "Check the DNS resolution and firewall rules of the registry before purging and stop with an explanation if they would make the requests fail")
+	cmd.Flags().BoolVar(&purgeParams.verifyDigest, "verify-digest", false, "Check that every tag still references the digest it referenced when it was listed right before deleting it, the tags that were pushed again are skipped and reported")
+	cmd.Flags().DurationVar(&purgeParams.slowRequestThreshold, "slow-request-threshold", defaultSlowRequestThreshold, "Log every deletion that takes longer than this duration including its retries (e.g. 2s), 0 disables the logging")
+	cmd.Flags().StringArrayVar(&purgeParams.platforms, "platform", nil, "Instead of deleting the selected tags remove the child manifests of this platform (os/architecture[/variant], e.g. windows/amd64) from their indexes and push the trimmed index with the same tag, can be specified multiple times")
+	cmd.Flags().BoolVar(&purgeParams.estimate, "estimate", false, "Nothing is deleted, the registry is scanned to print the expected number of requests and runtime of the purge and to warn if it would be throttled")
+	cmd.Flags().IntVar(&purgeParams.batchSize, "batch-size", defaultBatchSize, "The maximum number of tags of a repository deleted with a single request if the registry supports batch deletion, 1 deletes every tag with its own request")
+	addOutputFlag(cmd, &purgeParams.output)
+	cmd.Flags().StringVar(&purgeParams.progressFormat, "progress-format", outputText, "The format of the progress, json writes an item-deleted, page-scanned or error event per line to the standard output as they happen (NDJSON) and the text of the purge to the standard error")
+	cmd.Flags().BoolVar(&purgeParams.deleteEmptyRepos, "delete-empty-repos", false, "After purging a repository delete it if it has no manifests left, every deleted repository is logged with the time of the deletion")
+	cmd.Flags().StringVar(&purgeParams.notifyWebhook, "notify-webhook", "", "Post the summary of the purge and the result of every repository as JSON to this URL when the purge finishes or fails (e.g. a Teams or Slack incoming webhook), failed requests are retried")
+	cmd.Flags().BoolVar(&purgeParams.skipPermissionCheck, "skip-permission-check", false, "Do not check that the identity can read and delete in the filtered repositories before purging, the check deletes a tag that does not exist in every repository")
+	cmd.Flags().StringVar(&purgeParams.eventSink, "event-sink", "", "Send a delete-tag or delete-manifest event for every deletion to an Event Hub, given by its connection string with an EntityPath, or to a Storage queue, given by its URL with a SAS token (env ACR_EVENT_SINK)")
+	cmd.Flags().StringVar(&purgeParams.reportCSV, "report-csv", "", "Write every deleted tag and manifest, or every one that would be deleted with the dry-run flag, to this CSV file with its repository, tag, digest, media type, size, last update time and result. Like the report-output flag it can also be the URL of a Storage blob")
+	cmd.Flags().StringVar(&purgeParams.reportHTML, "report-html", "", "Write a static web page of the deleted tags and manifests, or of the ones that would be deleted with the dry-run flag, to this file, with a table per repository and charts of their age and of the size of their images. Like the report-output flag it can also be the URL of a Storage blob")
+	cmd.Flags().StringVar(&purgeParams.reportOutput, "report-output", "", "Write the JSON report of the run (the one sent to the notify webhook) to this file, to the URL of an Azure Storage blob with a SAS token or to stdout with -, also when the purge fails. "+sinks.TimestampPlaceholder+" is replaced by the current time, e.g. report-{timestamp}.json")
+	cmd.Flags().StringVar(&purgeParams.stateFile, "state-file", "", "Checkpoint the progress of the purge to this file, if the purge is aborted running it again with the same state file and flags resumes where it left off. The file is removed when the purge finishes")
+	cmd.Flags().DurationVar(&purgeParams.minAge, "min-age", defaultMinAge, "Never delete tags or manifests updated less than this duration ago (e.g. 30m), even if the ago or before flags select them, so that images pushed while the purge runs are kept")
+	cmd.Flags().BoolVar(&purgeParams.force, "force", false, "Disable the min-age protection and delete everything the ago or before flags select, including images pushed moments ago")
+	cmd.Flags().StringArrayVar(&purgeParams.pushedBy, "pushed-by", nil, "Only purge the images pushed by this identity (e.g. the user principal name of a CI service), as recorded by ACR for Azure AD identities, can be specified multiple times")
+	cmd.Flags().StringArrayVar(&purgeParams.excludeLabels, "exclude-label", nil, "Never purge the images whose config contains this label, either key=value or only the key to match any value, can be specified multiple times")
+	cmd.Flags().StringVar(&purgeParams.artifactType, "artifact-type", "", "Only delete the tags and manifests of this type of artifact, helm only purges Helm charts and keeps the images stored in the same repositories")
+	cmd.Flags().DurationVar(&purgeParams.filterTimeout, "filter-timeout", 0, "Stop the purge with an error if evaluating the filters takes longer than this duration in total (e.g. 1m), 0 means no limit")
+	cmd.Flags().BoolVar(&purgeParams.markOnly, "mark-only", false, "Instead of deleting the selected tags attach a tombstone annotated with the current time to each of them, a purge with the sweep flag deletes them once the grace period is over. Deleting the tombstone cancels the deletion")
+	cmd.Flags().BoolVar(&purgeParams.sweep, "sweep", false, "Only delete the selected tags that were scheduled for deletion with the mark-only flag more than the grace period ago, and their tombstones")
+	cmd.Flags().BoolVar(&purgeParams.verify, "verify", false, "Once the deletions finish, list the purged repositories again and report the deleted tags and manifests that are still present, the purge fails if there are any")
+	cmd.Flags().StringVar(&purgeParams.gracePeriod, "grace-period", defaultGracePeriod, "How long before a sweep a tag has to be scheduled for deletion to be deleted, in the format of the ago flag")
+	cmd.Flags().StringVar(&purgeParams.concurrency, "concurrency", strconv.Itoa(defaultNumWorkers), "The number of concurrent deletions, auto starts with a few and adds more while the registry answers quickly and does not throttle the requests, and removes them as soon as it does")
+	cmd.Flags().StringVar(&purgeParams.keepIfPresentIn, "keep-if-present-in", "", "Keep the tags and manifests whose digest is present in the same repository of another registry, e.g. the production registry")
+	cmd.Flags().StringVar(&purgeParams.referenceUsername, "reference-username", "", "The username of the registry of the keep-if-present-in flag")
+	cmd.Flags().StringVar(&purgeParams.referencePassword, "reference-password", "", "The password of the registry of the keep-if-present-in flag (env ACR_REFERENCE_PASSWORD)")
+	cmd.Flags().StringArrayVar(&purgeParams.placeholders, "placeholder", nil, "The values of a placeholder of the repositories of the filters in the form <name>=<value>[,<value>...], e.g. team=frontend,backend for the filter {team}/app:^pr-.*. The placeholders without values match a path component of the repositories of the registry")
+	cmd.Flags().StringVar(&purgeParams.untaggedAgo, "untagged-ago", "", "Together with the untagged flag only delete the untagged manifests that were last updated before this duration ago (e.g. 1d), so that the manifests of a pipeline that are not tagged yet are kept")
+	cmd.Flags().BoolVar(&purgeParams.includeReferrers, "include-referrers", false, "Together with the untagged flag also delete the referrers of every deleted manifest (e.g. signatures, SBOMs and attestations) and their referrers recursively, before the manifest they refer to. A manifest whose referrers are tagged or locked is kept")
+	cmd.Flags().StringVar(&purgeParams.timeWindows, "time-windows", "", "YAML file of time windows that restrict when the repositories are purged (e.g. never during business hours) or which tags are deleted by the time they were created (e.g. only the ones created on weekends)")
+	cmd.Flags().StringVar(&purgeParams.timezone, "timezone", "", "IANA name of the timezone of the days and hours of the time windows, e.g. Europe/Paris, UTC if it is not set")
+	cmd.Flags().BoolVar(&purgeParams.allowPartialUntag, "allow-partial-untag", false, "Delete the tags whose digest has other tags that are not deleted without looking for the other tags, so without a warning and without the requests to find them")
+	cmd.Flags().BoolVar(&purgeParams.keepPartialUntag, "keep-partial-untag", false, "Keep the tags whose digest has other tags that are not deleted, the manifest would stay reachable through them. Such tags are deleted with a warning otherwise")
+	cmd.Flags().IntVar(&purgeParams.maxDeletes, "max-deletes", 0, "Stop the purge once this number of tags and manifests were queued for deletion, the tags and repositories that remain are reported and the exit code is 6, 0 means no limit")
+	cmd.Flags().StringVar(&purgeParams.keepPinned, "keep-pinned", "", "Keep the tags and manifests whose digest is pinned by a lockfile written by acr pin")
+	cmd.Flags().BoolVar(&purgeParams.checkSignatures, "check-signatures", false, "Look for the Notation and cosign signatures of every image selected for deletion and keep the signed images, the referrers of every candidate are listed")
+	cmd.Flags().BoolVar(&purgeParams.allowSigned, "allow-signed", false, "Delete the signed images found by the check-signatures flag anyway, they are still listed in the output")
+	cmd.Flags().BoolVar(&purgeParams.onlyUnsigned, "only-unsigned", false, "Only delete the images that have no Notation or cosign signature, the signed ones are skipped without a message")
+	cmd.Flags().StringVar(&purgeParams.sku, "sku", "", "The SKU of the registry, one of Basic, Standard or Premium. The default concurrency, the bound of the automatic concurrency and the pacing of the requests follow its limits and a warning is printed if the concurrency flag exceeds them")
+	cmd.Flags().StringVar(&purgeParams.subscription, "subscription", "", "The subscription of the registry (env AZURE_SUBSCRIPTION_ID), used with the resource-group flag")
+	cmd.Flags().StringVarP(&purgeParams.resourceGroup, "resource-group", "g", "", "The resource group of the registry, if it is set the cache rules and, unless the sku flag is set, the SKU are read through Azure Resource Manager. The Azure credentials are read like in the token command")
+	cmd.Flags().BoolVar(&purgeParams.includeCached, "include-cached", false, "Also purge the repositories cached by the cache rules of the registry, by default they are skipped when the resource-group flag is set")
+	cmd.Flags().StringVar(&purgeParams.connectedRegistry, "connected-registry", "", "Resource ID of the connected registry that is purged (/subscriptions/<subscription>/resourceGroups/<resource group>/providers/Microsoft.ContainerRegistry/registries/<parent>/connectedRegistries/<name>), a warning is printed if it is syncing with its parent or does not accept deletions. The Azure credentials are read like in the token command")
 	cmd.Flags().BoolP("help", "h", false, "Print usage")
-	cmd.MarkFlagRequired("filter")
-	cmd.MarkFlagRequired("ago")
+	cmd.AddCommand(newGenerateCronJobCmd(out, rootParams))
 	return cmd
 }
 
-// purgeTags deletes all tags that are older than the ago value and that match the tagFilter string.
-func purgeTags(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string, ago string, tagFilter string) (int, error) {
-	fmt.Printf("Deleting tags for repository: %s\n", repoName)
-	deletedTagsCount := 0
-	agoDuration, err := parseDuration(ago)
-	if err != nil {
-		return -1, err
+// connect creates the client of the registry or of the snapshot of the from-snapshot flag and starts the workers,
+// the concurrency and the pacing of the requests are adapted to the registry.
+func (run *purgeRun) connect(ctx context.Context, cmd *cobra.Command) error {
+	purgeParams := run.params
+	if len(purgeParams.fromSnapshot) > 0 {
+		// A snapshot can only be read, so it only makes sense to use it with the dry-run flag.
+		if !purgeParams.dryRun {
+			return errors.New("the from-snapshot flag can only be used together with the dry-run flag")
+		}
+		snapshot, err := api.LoadSnapshot(purgeParams.fromSnapshot)
+		if err != nil {
+			return err
+		}
+		run.loginURL = snapshot.LoginURL
+		run.acrClient = api.NewSnapshotClient(snapshot)
+		// The tags of a snapshot are stored in the order they were listed in.
+		run.opts.EnableTimeOrdering(false)
+		return nil
 	}
-	timeToCompare := time.Now().UTC()
-	// Since the parseDuration function returns a negative duration, it is added to the current duration in order to be able to easily compare
-	// with the LastUpdatedTime attribute a tag has.
-	timeToCompare = timeToCompare.Add(agoDuration)
-	tagRegex, err := regexp.Compile(tagFilter)
+	registryName, err := purgeParams.GetRegistryName()
 	if err != nil {
-		return -1, err
+		return err
 	}
-	lastTag := ""
-	tagsToDelete, lastTag, err := getTagsToDelete(ctx, acrClient, repoName, tagRegex, timeToCompare, "")
-	if err != nil {
-		return -1, err
-	}
-	// GetTagsToDelete will return an empty lastTag when there are no more tags.
-	for len(lastTag) > 0 {
-		for _, tag := range *tagsToDelete {
-			wg.Add(1)
-			// The purge job is queued, after a purge worker picks it up the tag will be deleted.
-			worker.QueuePurgeTag(loginURL, repoName, *tag.Name, *tag.Digest)
-			deletedTagsCount++
-		}
-		// To not overflow the error channel capacity the purgeTags function waits for a whole block of
-		// 100 jobs to be finished before continuing.
-		wg.Wait()
-		for len(worker.ErrorChannel) > 0 {
-			wErr := <-worker.ErrorChannel
-			if wErr.Error != nil {
-				return -1, wErr.Error
-			}
-		}
-		tagsToDelete, lastTag, err = getTagsToDelete(ctx, acrClient, repoName, tagRegex, timeToCompare, lastTag)
-		if err != nil {
-			return -1, err
+	run.loginURL = api.LoginURL(registryName)
+	// Network problems (e.g. Private Link or firewall rules) surface as generic errors, so they are
+	// diagnosed before anything else is done.
+	if purgeParams.diagnose {
+		if err := diagnoseNetwork(run.out, run.loginURL, nil); err != nil {
+			return err
 		}
 	}
-	return deletedTagsCount, nil
-}
-
-// getRepositoryAndTagRegex splits the strings that are in the form <repository>:<regex filter>
-func getRepositoryAndTagRegex(filter string) (string, string, error) {
-	repoAndRegex := strings.Split(filter, ":")
-	if len(repoAndRegex) != 2 {
-		return "", "", errors.New("unable to correctly parse filter flag")
+	if len(purgeParams.connectedRegistry) > 0 {
+		if err := checkConnectedRegistry(ctx, run.errOut, purgeParams.connectedRegistry); err != nil {
+			return err
+		}
 	}
-	return repoAndRegex[0], repoAndRegex[1], nil
-}
-
-// parseDuration analog to time.ParseDuration() but with days added.
-func parseDuration(ago string) (time.Duration, error) {
-	var days int
-	var durationString string
-	// The supported format is %d%s where the string is a valid go duration string.
-	if strings.Contains(ago, "d") {
-		if _, err := fmt.Sscanf(ago, "%dd%s", &days, &durationString); err != nil {
-			fmt.Sscanf(ago, "%dd", &days)
-			durationString = ""
+	registryType, err := api.DetectRegistryType(ctx, run.loginURL, purgeParams.registryType)
+	if err != nil {
+		return err
+	}
+	var acrClient api.AcrCLIClientInterface
+	if registryType == api.RegistryTypeOCI {
+		// Registries that are not ACRs are used through the OCI distribution API, it cannot list the
+		// manifests that have no tags.
+		if purgeParams.untagged {
+			return errors.New("the untagged flag is not supported for OCI registries because their manifests without tags cannot be listed")
 		}
+		acrClient, err = api.NewOCIClient(run.loginURL, purgeParams.username, purgeParams.password, purgeParams.configs)
 	} else {
-		days = 0
-		if _, err := fmt.Sscanf(ago, "%s", &durationString); err != nil {
-			return time.Duration(0), err
+		// An acrClient with authentication is generated, if the authentication cannot be resolved an error is returned.
+		acrClient, err = api.GetAcrCLIClientWithAuth(run.loginURL, purgeParams.username, purgeParams.password, purgeParams.configs)
+	}
+	if err != nil {
+		return err
+	}
+	// The ACR API lists the tags from the least recently updated, so the listing stops at the cutoff.
+	run.opts.EnableTimeOrdering(registryType != api.RegistryTypeOCI)
+	// The estimate counts the requests that reach the registry, so the counter is behind the cache.
+	if purgeParams.estimate {
+		run.requestCounter = purge.NewRequestCounter(acrClient)
+		acrClient = run.requestCounter
+	}
+	// The limiter is behind the cache so that the bodies that are already cached do not count.
+	if len(purgeParams.maxBandwidth) > 0 || purgeParams.maxDownloads > 0 {
+		limiter, err := newBandwidthLimiter(purgeParams.maxBandwidth, purgeParams.maxDownloads)
+		if err != nil {
+			return err
 		}
+		acrClient = api.NewBandwidthLimitedClient(acrClient, limiter)
 	}
-	// The number of days gets converted to hours.
-	duration := time.Duration(days) * 24 * time.Hour
-	if len(durationString) > 0 {
-		agoDuration, err := time.ParseDuration(durationString)
+	// The manifest lists read while selecting tags are read again while selecting untagged manifests, the
+	// cache makes sure each of them is only fetched once.
+	acrClient, err = api.NewManifestCache(acrClient, purgeParams.manifestCacheDir)
+	if err != nil {
+		return err
+	}
+	run.acrClient = acrClient
+	// The concurrency and the pacing of the requests of a registry whose SKU is known stay within its limits.
+	dispatcherOptions := worker.DispatcherOptions{SlowRequestThreshold: purgeParams.slowRequestThreshold}
+	if registryType != api.RegistryTypeOCI {
+		sku, err := purgeParams.registrySKU(ctx, run.errOut)
 		if err != nil {
-			return time.Duration(0), err
+			return err
+		}
+		if limits, ok := api.LimitsOf(sku); ok {
+			run.numWorkers = skuConcurrency(run.errOut, sku, run.numWorkers, cmd.Flags().Changed("concurrency"))
+			dispatcherOptions.MaxConcurrency = limits.MaxConcurrency
+			dispatcherOptions.CallsPerSecond = float64(limits.ReadOpsPerMinute) / 60
 		}
-		duration = duration + agoDuration
+		// The repositories of a pull-through cache are filled again on the next pull, they are not purged.
+		run.opts.SetCacheRules(purgeParams.cacheRules(ctx, run.errOut))
 	}
-	return (-1 * duration), nil
+	// In order to only have a fixed amount of http requests a dispatcher is started that will keep forwarding the jobs
+	// to the workers, which are goroutines that continuously fetch for tags/manifests to delete. The run has its own
+	// dispatcher so that its settings do not change the ones of other runs.
+	dispatcherOptions.Workers = run.numWorkers
+	run.dispatcher = worker.NewDispatcherWithOptions(ctx, run.acrClient, dispatcherOptions)
+	run.opts.SetDispatcher(run.dispatcher)
+	// A tag pushed again between the listing and its deletion references an image that was not selected.
+	run.opts.SetVerifyDigest(purgeParams.verifyDigest)
+	// Registries that support it delete a batch of tags with a single request instead of one per tag.
+	_, err = run.opts.EnableBatchDeletion(ctx, run.acrClient, purgeParams.batchSize)
+	return err
 }
 
-// getTagsToDelete gets all tags that should be deleted according to the ago flag and the filter flag, this will at most return 100 tags,
-// returns a pointer to a slice that contains the tags that will be deleted, the last tag obtained through the AcrListTags function
-// and an error in case it occurred, the fourth return value contains a map that is used to determine how many tags a manifest has
-func getTagsToDelete(ctx context.Context,
-	acrClient api.AcrCLIClientInterface,
-	repoName string,
-	filter *regexp.Regexp,
-	timeToCompare time.Time,
-	lastTag string) (*[]acr.TagAttributesBase, string, error) {
-
-	var matches bool
-	var lastUpdateTime time.Time
-	resultTags, err := acrClient.GetAcrTags(ctx, repoName, "", lastTag)
+// clock returns the clock the age of the tags is measured with, it is the current time unless the now flag is used to
+// reproduce a purge as it would have run at a different time.
+func (purgeParams *purgeParameters) clock() (purge.Clock, error) {
+	if len(purgeParams.now) == 0 {
+		return purge.SystemClock(), nil
+	}
+	now, err := time.Parse(time.RFC3339, purgeParams.now)
 	if err != nil {
-		if resultTags != nil && resultTags.StatusCode == http.StatusNotFound {
-			fmt.Printf("%s repository not found\n", repoName)
-			return nil, "", nil
-		}
-		// An empty lastTag string is returned so there will not be any tag purged.
-		return nil, "", err
-	}
-	newLastTag := ""
-	if resultTags != nil && resultTags.TagsAttributes != nil && len(*resultTags.TagsAttributes) > 0 {
-		tags := *resultTags.TagsAttributes
-		tagsToDelete := []acr.TagAttributesBase{}
-		for _, tag := range tags {
-			matches = filter.MatchString(*tag.Name)
-			if !matches {
-				// If a tag does not match the regex then it not added to the list no matter the LastUpdateTime
-				continue
-			}
-			lastUpdateTime, err = time.Parse(time.RFC3339Nano, *tag.LastUpdateTime)
-			if err != nil {
-				return nil, "", err
-			}
-			// If a tag did match the regex filter, is older than the specified duration and can be deleted then it is returned
-			// as a tag to delete.
-			if lastUpdateTime.Before(timeToCompare) && *(*tag.ChangeableAttributes).DeleteEnabled {
-				tagsToDelete = append(tagsToDelete, tag)
-			}
-		}
-		// The lastTag is updated to keep the for loop going.
-		newLastTag = *tags[len(tags)-1].Name
-		return &tagsToDelete, newLastTag, nil
+		return nil, fmt.Errorf("invalid now value: %w", err)
 	}
-	// In case there are no more tags return empty string as lastTag so that the purgeTags function stops
-	return nil, "", nil
+	return purge.FixedClock(now), nil
 }
 
-// purgeDanglingManifests deletes all manifests that do not have any tags associated with them.
-func purgeDanglingManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string) (int, error) {
-	fmt.Printf("Deleting manifests for repository: %s\n", repoName)
-	deletedManifestsCount := 0
-	// Contrary to getTagsToDelete, getManifestsToDelete gets all the Manifests at once, this was done because if there is a manifest that has no
-	// tag but is referenced by a multiarch manifest that has tags then it should not be deleted.
-	manifestsToDelete, err := getManifestsToDelete(ctx, acrClient, repoName)
+// setCutoff sets how old the tags and the untagged manifests have to be to be purged.
+func (run *purgeRun) setCutoff() error {
+	purgeParams := run.params
+	// Exactly one of the ago and before flags selects how old a tag has to be to be purged.
+	if len(purgeParams.ago) == 0 && len(purgeParams.before) == 0 {
+		return errors.New("either the ago or the before flag is required")
+	}
+	run.cutoff = purge.Cutoff{Ago: purgeParams.ago, Before: purgeParams.before}
+	cutoffTime, err := run.cutoff.Time(run.clock)
 	if err != nil {
-		return -1, err
-	}
-	i := 0
-	for _, manifest := range *manifestsToDelete {
-		wg.Add(1)
-		worker.QueuePurgeManifest(loginURL, repoName, *manifest.Digest)
-		deletedManifestsCount++
-		// Because the worker ErrorChannel has a capacity of 100 it has to periodically be checked for errors
-		if math.Mod(float64(i), 100) == 0 {
-			wg.Wait()
-			for len(worker.ErrorChannel) > 0 {
-				wErr := <-worker.ErrorChannel
-				if wErr.Error != nil {
-					return -1, wErr.Error
-				}
-			}
+		return err
+	}
+	// Images pushed while the purge runs are protected even if the cutoff is the current time.
+	minAge := purgeParams.minAge
+	if purgeParams.force {
+		minAge = 0
+	}
+	if minAge < 0 {
+		return errors.New("the min-age value cannot be negative")
+	}
+	if minUpdateTime := run.opts.SetMinAge(run.clock, minAge); !minUpdateTime.IsZero() && cutoffTime.After(minUpdateTime) {
+		fmt.Fprintf(run.errOut, "Warning: the tags and manifests updated in the last %s are kept because of the min-age flag, use the force flag to delete them\n", minAge)
+	}
+	if len(purgeParams.untaggedAgo) > 0 && !purgeParams.untagged {
+		return errors.New("the untagged-ago flag can only be used together with the untagged flag")
+	}
+	_, err = run.opts.SetUntaggedAgo(run.clock, purgeParams.untaggedAgo)
+	return err
+}
+
+// setFilters reads the filters of the flags and of the filter file and expands them into the regular expressions of
+// every repository, the repositories that are cached or outside of their time windows are left out.
+func (run *purgeRun) setFilters(ctx context.Context) error {
+	purgeParams := run.params
+	run.filters = purgeParams.filters
+	if len(purgeParams.filterFile) > 0 {
+		fileFilters, err := readFilterFile(purgeParams.filterFile, purgeParams.matchOn)
+		if err != nil {
+			return err
 		}
-		i++
+		run.filters = append(run.filters, fileFilters...)
+	}
+	if len(run.filters) == 0 {
+		return errors.New("either the filter or the filter-file flag is required")
 	}
-	// Wait for all the worker jobs to finish.
-	wg.Wait()
-	for len(worker.ErrorChannel) > 0 {
-		wErr := <-worker.ErrorChannel
-		if wErr.Error != nil {
-			return -1, wErr.Error
+	// The filters are kept with their placeholders in the policy so that the state of a purge does not depend
+	// on the repositories of the catalog.
+	placeholders, err := purge.ParsePlaceholders(purgeParams.placeholders)
+	if err != nil {
+		return err
+	}
+	run.placeholders = placeholders
+	expandedFilters, err := run.opts.ExpandFilters(ctx, run.acrClient, run.filters, run.placeholders, purgeParams.matchOn)
+	if err != nil {
+		return err
+	}
+	tagFilters, err := run.opts.GetTagFilters(expandedFilters, purgeParams.matchOn)
+	if err != nil {
+		return err
+	}
+	tagFilters = run.opts.WithoutCachedRepositories(tagFilters, run.errOut)
+	if len(purgeParams.timeWindows) > 0 {
+		if run.windows, err = purge.ReadTimeWindows(purgeParams.timeWindows); err != nil {
+			return err
 		}
 	}
-	return deletedManifestsCount, nil
+	if err := run.opts.SetTimeWindows(run.windows, purgeParams.timezone); err != nil {
+		return err
+	}
+	run.tagFilters = run.opts.WithoutClosedRepositories(tagFilters, run.clock.Now(), run.errOut)
+	// Every filter is benchmarked so that a filter that will be slow over many tags is reported before the
+	// purge starts, the filter-timeout flag turns it into an error once the purge has spent too long on it.
+	if purgeParams.filterTimeout < 0 {
+		return errors.New("the filter-timeout value cannot be negative")
+	}
+	if err := warnSlowFilters(run.errOut, run.tagFilters); err != nil {
+		return err
+	}
+	run.opts.SetFilterTimeout(purgeParams.filterTimeout)
+	return nil
 }
 
-// getManifestsToDelete gets all the manifests that should be deleted, this means that do not have any tag and that do not form part
-// of a manifest list that has tags referencing it.
-func getManifestsToDelete(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string) (*[]acr.ManifestAttributesBase, error) {
-	lastManifestDigest := ""
-	manifestsToDelete := []acr.ManifestAttributesBase{}
-	resultManifests, err := acrClient.GetAcrManifests(ctx, repoName, "", lastManifestDigest)
+// setOptions sets the options that select which of the candidates of the filters are kept and which are deleted.
+func (run *purgeRun) setOptions() error {
+	purgeParams := run.params
+	opts := run.opts
+	// The dry run tables show the size of the tags, so the manifests are listed to know them.
+	if purgeParams.dryRun && run.printer == nil {
+		opts.EnableDryRunSizes(true)
+	}
+	run.platforms = []purge.Platform{}
+	for _, value := range purgeParams.platforms {
+		platform, err := purge.ParsePlatform(value)
+		if err != nil {
+			return err
+		}
+		run.platforms = append(run.platforms, platform)
+	}
+	// Repositories that mix Helm charts and images can be purged of only one of them.
+	if err := opts.SetArtifactType(purgeParams.artifactType); err != nil {
+		return err
+	}
+	// Images with one of the labels are never purged, their configs are only fetched once per digest.
+	if err := opts.SetExcludeLabels(purgeParams.excludeLabels); err != nil {
+		return err
+	}
+	// The identity that pushed every candidate is read from the metadata of its manifest.
+	if err := opts.SetPushedBy(purgeParams.pushedBy); err != nil {
+		return err
+	}
+	if err := opts.SetKeepPerGroup(purgeParams.keepPerGroup); err != nil {
+		return err
+	}
+	// The referrers of every candidate are listed to find its Notation or cosign signatures.
+	signaturePolicy, err := purgeParams.signaturePolicy()
 	if err != nil {
-		if resultManifests != nil && resultManifests.StatusCode == http.StatusNotFound {
-			fmt.Printf("%s repository not found\n", repoName)
-			return &manifestsToDelete, nil
+		return err
+	}
+	if err := opts.SetSignaturePolicy(signaturePolicy); err != nil {
+		return err
+	}
+	run.signaturePolicy = signaturePolicy
+	// The digests pinned by a lockfile are deployed by GitOps repositories and are kept.
+	if len(purgeParams.keepPinned) > 0 {
+		lockfile, err := purge.ReadLockfile(purgeParams.keepPinned)
+		if err != nil {
+			return err
 		}
-		return nil, err
+		opts.SetPinned(lockfile)
 	}
-	// This will act as a set if a key is present then it should not be deleted because it is referenced by a multiarch manifest
-	// that will not be deleted
-	doNotDelete := map[string]bool{}
-	candidatesToDelete := []acr.ManifestAttributesBase{}
-	// Iterate over all manifests to discover multiarchitecture manifests
-	for resultManifests != nil && resultManifests.ManifestsAttributes != nil {
-		manifests := *resultManifests.ManifestsAttributes
-		for _, manifest := range manifests {
-			if *manifest.MediaType == manifestListContentType && manifest.Tags != nil {
-				// If a manifest list is found and it has tags then all the dependent digests are
-				// marked to not be deleted.
-				var manifestListBytes []byte
-				manifestListBytes, err = acrClient.GetManifest(ctx, repoName, *manifest.Digest)
-				if err != nil {
-					return nil, err
-				}
-				var manifestList multiArchManifest
-				err = json.Unmarshal(manifestListBytes, &manifestList)
-				if err != nil {
-					return nil, err
-				}
-				for _, dependentDigest := range manifestList.Manifests {
-					doNotDelete[dependentDigest.Digest] = true
-				}
-			} else if manifest.Tags == nil {
-				// If the manifest has no tags left it is a candidate for deletion
-				candidatesToDelete = append(candidatesToDelete, manifest)
-			}
+	// The digests that are present in the reference registry (e.g. production) are kept, the reference registry
+	// is reached with its own credentials.
+	if len(purgeParams.keepIfPresentIn) > 0 {
+		referenceLoginURL := api.LoginURL(purgeParams.keepIfPresentIn)
+		if referenceLoginURL == run.loginURL {
+			return errors.New("the keep-if-present-in registry cannot be the purged registry")
+		}
+		referencePassword := purgeParams.referencePassword
+		if len(referencePassword) == 0 {
+			referencePassword = os.Getenv("ACR_REFERENCE_PASSWORD")
 		}
-		lastManifestDigest = *manifests[len(manifests)-1].Digest
-		resultManifests, err = acrClient.GetAcrManifests(ctx, repoName, "", lastManifestDigest)
+		referenceClient, err := api.GetAcrCLIClientWithAuth(referenceLoginURL, purgeParams.referenceUsername, referencePassword, purgeParams.configs)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("failed to authenticate to %s: %w", referenceLoginURL, err)
 		}
+		opts.SetReferenceRegistry(referenceLoginURL, referenceClient)
 	}
-	// Remove all manifests that should not be deleted
-	for i := 0; i < len(candidatesToDelete); i++ {
-		if _, ok := doNotDelete[*candidatesToDelete[i].Digest]; !ok {
-			// if a manifest has no tags, is not part of a manifest list and can be deleted then it is added to the
-			// manifestToDelete array.
-			if *(*candidatesToDelete[i].ChangeableAttributes).DeleteEnabled {
-				manifestsToDelete = append(manifestsToDelete, candidatesToDelete[i])
-			}
+	// A filter that matches much more than expected only deletes up to the maximum before the purge stops.
+	if purgeParams.maxDeletes < 0 {
+		return errors.New("the max-deletes value cannot be negative")
+	}
+	opts.SetMaxDeletes(purgeParams.maxDeletes)
+	// The signatures, SBOMs and attestations of a deleted manifest would be left without their subject.
+	if purgeParams.includeReferrers && !purgeParams.untagged {
+		return errors.New("the include-referrers flag can only be used together with the untagged flag")
+	}
+	if purgeParams.includeReferrers && len(purgeParams.fromSnapshot) > 0 {
+		return errors.New("the include-referrers flag cannot be used together with the from-snapshot flag, snapshots do not contain the referrers")
+	}
+	opts.SetIncludeReferrers(purgeParams.includeReferrers)
+	return run.setAliasDetection()
+}
+
+// setAliasDetection sets how the tags whose digest has other tags that are not deleted are treated. Deleting them does
+// not delete their manifest, by default they are deleted with a warning and the dry run shows the other tags.
+func (run *purgeRun) setAliasDetection() error {
+	purgeParams := run.params
+	if purgeParams.allowPartialUntag && purgeParams.keepPartialUntag {
+		return errors.New("the allow-partial-untag flag cannot be used together with the keep-partial-untag flag")
+	}
+	run.opts.SetAliasDetection(!purgeParams.allowPartialUntag, purgeParams.keepPartialUntag)
+	return nil
+}
+
+// validate returns an error if flags that cannot be used together are set.
+func (run *purgeRun) validate() error {
+	purgeParams := run.params
+	if len(purgeParams.artifactType) > 0 && len(run.platforms) > 0 {
+		return errors.New("the artifact-type flag cannot be used together with the platform flag")
+	}
+	if len(purgeParams.stateFile) > 0 && (purgeParams.dryRun || purgeParams.estimate) {
+		return errors.New("the state-file flag cannot be used together with the dry-run or estimate flags")
+	}
+	if purgeParams.verify && (purgeParams.dryRun || purgeParams.estimate || purgeParams.markOnly) {
+		return errors.New("the verify flag cannot be used together with the dry-run, estimate or mark-only flags because nothing is deleted")
+	}
+	if len(purgeParams.reportCSV) > 0 && (purgeParams.estimate || len(purgeParams.savePlan) > 0 || len(purgeParams.diff) > 0) {
+		return errors.New("the report-csv flag cannot be used together with the estimate, save-plan or diff flags")
+	}
+	if len(purgeParams.reportHTML) > 0 && (purgeParams.estimate || len(purgeParams.savePlan) > 0 || len(purgeParams.diff) > 0) {
+		return errors.New("the report-html flag cannot be used together with the estimate, save-plan or diff flags")
+	}
+	// A two-phase purge schedules the deletion of the tags in one run and deletes them in a later one.
+	if purgeParams.markOnly || purgeParams.sweep {
+		if purgeParams.markOnly && purgeParams.sweep {
+			return errors.New("the mark-only and sweep flags cannot be used together")
+		}
+		if purgeParams.dryRun || purgeParams.estimate || len(run.platforms) > 0 {
+			return errors.New("the mark-only and sweep flags cannot be used together with the dry-run, estimate or platform flags")
+		}
+		if purgeParams.markOnly && purgeParams.untagged {
+			return errors.New("the mark-only flag cannot be used together with the untagged flag, the untagged manifests can be deleted by the sweep")
+		}
+		if _, err := (purge.Cutoff{Ago: purgeParams.gracePeriod}).Time(run.clock); err != nil {
+			return fmt.Errorf("invalid grace-period value: %w", err)
 		}
 	}
-	return &manifestsToDelete, nil
+	if purgeParams.estimate {
+		if len(purgeParams.fromSnapshot) > 0 || len(run.platforms) > 0 {
+			return errors.New("the estimate flag cannot be used together with the from-snapshot or platform flags")
+		}
+		return nil
+	}
+	if len(run.platforms) > 0 && (purgeParams.onlySuperseded || len(purgeParams.savePlan) > 0 || len(purgeParams.diff) > 0) {
+		return errors.New("the platform flag cannot be used together with the only-superseded, save-plan or diff flags")
+	}
+	if (len(purgeParams.savePlan) > 0 || len(purgeParams.diff) > 0) && !purgeParams.dryRun {
+		return errors.New("the save-plan and diff flags can only be used together with the dry-run flag")
+	}
+	return nil
 }
 
-// dryRunPurge outputs everything that would be deleted if the purge command was executed
-func dryRunPurge(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string, ago string, filter string, untagged bool) (int, int, error) {
-	deletedTagsCount := 0
-	deletedManifestsCount := 0
-	// In order to keep track if a manifest would get deleted a map is defined that as a  key has the manifest
-	// digest and as the value the number of tags (referencing said manifests) that were deleted.
-	deletedTags := map[string]int{}
-	fmt.Printf("Deleting tags for repository: %s\n", repoName)
-	agoDuration, err := parseDuration(ago)
-	if err != nil {
-		return -1, -1, err
+// policy returns the policy of the purge built from its flags, it is the policy of the estimate, of the stored plans
+// and of the state file.
+func (run *purgeRun) policy() purge.Policy {
+	purgeParams := run.params
+	return purge.Policy{
+		Filters:           run.filters,
+		Ago:               purgeParams.ago,
+		Before:            purgeParams.before,
+		Untagged:          purgeParams.untagged,
+		MatchOn:           purgeParams.matchOn,
+		OnlySuperseded:    purgeParams.onlySuperseded,
+		ArtifactType:      purgeParams.artifactType,
+		ExcludeLabels:     purgeParams.excludeLabels,
+		PushedBy:          purgeParams.pushedBy,
+		KeepPerGroup:      purgeParams.keepPerGroup,
+		Signatures:        run.signaturePolicy,
+		KeepPinned:        purgeParams.keepPinned,
+		KeepIfPresentIn:   purgeParams.keepIfPresentIn,
+		Placeholders:      run.placeholders,
+		IncludeReferrers:  purgeParams.includeReferrers,
+		AllowPartialUntag: purgeParams.allowPartialUntag,
+		KeepPartialUntag:  purgeParams.keepPartialUntag,
+		Windows:           run.windows,
+		Timezone:          purgeParams.timezone,
+		UntaggedAgo:       purgeParams.untaggedAgo,
 	}
-	timeToCompare := time.Now().UTC()
-	timeToCompare = timeToCompare.Add(agoDuration)
-	regex, err := regexp.Compile(filter)
+}
+
+// repositories returns the names of the repositories the filters select.
+func (run *purgeRun) repositories() []string {
+	repoNames := []string{}
+	for repoName := range run.tagFilters {
+		repoNames = append(repoNames, repoName)
+	}
+	return repoNames
+}
+
+// enableReports writes every deleted tag and manifest to the CSV report, the HTML report is made of the same rows.
+// The returned function flushes the CSV report and renders the HTML report, it has to be called when the purge
+// finishes or fails.
+func (run *purgeRun) enableReports() (func() error, error) {
+	purgeParams := run.params
+	var csvFile io.WriteCloser = nopWriteCloser{ioutil.Discard}
+	if len(purgeParams.reportCSV) > 0 {
+		var err error
+		if csvFile, err = sinks.Open(purgeParams.reportCSV, "text/csv", run.out); err != nil {
+			return nil, fmt.Errorf("failed to create the CSV report: %w", err)
+		}
+	}
+	csvReport, err := purge.NewCSVReport(csvFile)
 	if err != nil {
-		return -1, -1, err
+		csvFile.Close()
+		return nil, fmt.Errorf("failed to write the CSV report: %w", err)
+	}
+	run.opts.EnableCSVReport(csvReport)
+	var htmlReport *purge.HTMLReport
+	if len(purgeParams.reportHTML) > 0 {
+		htmlReport = purge.NewHTMLReport(run.loginURL, purgeParams.dryRun)
+		csvReport.AddHTMLReport(htmlReport)
+	}
+	return func() error {
+		var err error
+		if htmlReport != nil {
+			err = writeHTMLReport(purgeParams.reportHTML, run.out, htmlReport, run.clock.Now())
+		}
+		flushErr := csvReport.Flush()
+		if closeErr := csvFile.Close(); flushErr == nil {
+			flushErr = closeErr
+		}
+		if flushErr != nil && err == nil {
+			err = fmt.Errorf("failed to write the CSV report: %w", flushErr)
+		}
+		return err
+	}, nil
+}
+
+// enableEvents publishes every deleted tag and manifest while the purge runs, it returns nil if there is no event sink.
+// The event sink contains a secret, so it can also be set in the environment. The publisher has to be closed when the
+// purge finishes or fails so that the queued events are sent.
+func (run *purgeRun) enableEvents(ctx context.Context) (*events.Publisher, error) {
+	eventSink := run.params.eventSink
+	if len(eventSink) == 0 {
+		eventSink = os.Getenv("ACR_EVENT_SINK")
 	}
-	lastTag := ""
-	tagsToDelete, lastTag, err := getTagsToDelete(ctx, acrClient, repoName, regex, timeToCompare, "")
+	if len(eventSink) == 0 || run.params.dryRun {
+		return nil, nil
+	}
+	sink, err := events.NewSink(eventSink)
 	if err != nil {
-		return -1, -1, err
-	}
-	// The loop to get the deleted tags follows the same logic as the one in the purgeTags function
-	for len(lastTag) > 0 {
-		for _, tag := range *tagsToDelete {
-			// For every tag that would be deleted first check if it exists in the map, if it doesn't add a new key
-			// with value 1 and if it does just add 1 to the existent value.
-			if _, exists := deletedTags[*tag.Digest]; exists {
-				deletedTags[*tag.Digest]++
-			} else {
-				deletedTags[*tag.Digest] = 1
-			}
-			fmt.Printf("%s/%s:%s\n", loginURL, repoName, *tag.Name)
-			deletedTagsCount++
-		}
-		tagsToDelete, lastTag, err = getTagsToDelete(ctx, acrClient, repoName, regex, timeToCompare, lastTag)
-		if err != nil {
-			return -1, -1, err
+		return nil, err
+	}
+	publisher := events.NewPublisher(ctx, sink, run.loginURL)
+	run.opts.EnableEvents(publisher)
+	return publisher, nil
+}
+
+// purgeRepositories purges every repository of the filters and adds their results to the report, it returns the
+// number of repositories skipped because the state file records that they were purged before.
+func (run *purgeRun) purgeRepositories(ctx context.Context, report *notify.Report, purgeState *purge.State) (resumedRepos int, err error) {
+	// If the purge stops at the maximum number of deletions the repositories it did not get to are reported.
+	pendingRepos := map[string]bool{}
+	for repoName := range run.tagFilters {
+		pendingRepos[repoName] = true
+	}
+	defer func() {
+		if errors.Is(err, purge.ErrMaxDeletes) {
+			printMaxDeletesReached(run.out, run.opts.QueuedDeletes(), pendingRepos)
+		}
+	}()
+	for repoName, tagRegex := range run.tagFilters {
+		if purgeState != nil && purgeState.Repository(repoName).Done {
+			fmt.Fprintf(run.out, "Skipping repository %s, it was purged before\n", repoName)
+			resumedRepos++
+			delete(pendingRepos, repoName)
+			continue
+		}
+		if err := run.purgeRepository(ctx, repoName, tagRegex, report); err != nil {
+			return resumedRepos, err
+		}
+		delete(pendingRepos, repoName)
+		if purgeState != nil {
+			if err := purgeState.FinishRepository(repoName); err != nil {
+				return resumedRepos, err
+			}
 		}
 	}
-	if untagged {
-		fmt.Printf("Deleting manifests for repository: %s\n", repoName)
-		// The countMap contains a map that for every digest contains how many tags are referencing it.
-		countMap, err := countTagsByManifest(ctx, acrClient, repoName)
+	return resumedRepos, nil
+}
+
+// purgeRepository purges a repository the way the flags select and adds its result to the report, also when the
+// purge of the repository fails.
+func (run *purgeRun) purgeRepository(ctx context.Context, repoName string, tagRegex string, report *notify.Report) error {
+	purgeParams := run.params
+	acrClient, clock, loginURL, cutoff, opts := run.acrClient, run.clock, run.loginURL, run.cutoff, run.opts
+	result := notify.RepositoryResult{Name: repoName}
+	// repoPlan is the plan of a dry run, whether the repository would be left empty is decided from it.
+	var repoPlan *purge.RepositoryPlan
+	if len(run.platforms) > 0 {
+		// The tags are kept and only the child manifests of the platforms are removed from their indexes.
+		summary, err := purge.Platforms(ctx, acrClient, clock, loginURL, repoName, cutoff, tagRegex, purgeParams.matchOn, run.platforms, purgeParams.dryRun, opts)
+		result.TrimmedTags = summary.Deleted
 		if err != nil {
-			return -1, -1, err
+			return report.Fail(result, run.purgeError(fmt.Errorf("failed to trim indexes: %w", err), report.Changed()+result.TrimmedTags))
 		}
-		lastManifestDigest := ""
-		resultManifests, err := acrClient.GetAcrManifests(ctx, repoName, "", lastManifestDigest)
-		if err != nil {
-			if resultManifests != nil && resultManifests.StatusCode == http.StatusNotFound {
-				fmt.Printf("%s repository not found\n", repoName)
-				return 0, 0, nil
-			}
-			return -1, -1, err
-		}
-		// This will act as a set if a key is present then it should not be deleted because it is referenced by a multiarch manifest
-		// that will not be deleted
-		doNotDelete := map[string]bool{}
-		candidatesToDelete := []acr.ManifestAttributesBase{}
-		// Iterate over all manifests to discover multiarchitecture manifests
-		for resultManifests != nil && resultManifests.ManifestsAttributes != nil {
-			manifests := *resultManifests.ManifestsAttributes
-			for _, manifest := range manifests {
-				// If the manifest is manifest list and would not get deleted then mark it's dependant manifests as not deletable.
-				if *manifest.MediaType == manifestListContentType && (*countMap)[*manifest.Digest] != deletedTags[*manifest.Digest] {
-					var manifestListBytes []byte
-					manifestListBytes, err = acrClient.GetManifest(ctx, repoName, *manifest.Digest)
-					if err != nil {
-						return -1, -1, err
-					}
-					var manifestList multiArchManifest
-					err = json.Unmarshal(manifestListBytes, &manifestList)
-					if err != nil {
-						return -1, -1, err
-					}
-					for _, dependentDigest := range manifestList.Manifests {
-						doNotDelete[dependentDigest.Digest] = true
-					}
-				} else if (*countMap)[*manifest.Digest] == deletedTags[*manifest.Digest] {
-					// If the manifest has the same amount of tags as the amount of tags deleted then it is a candidate for deletion.
-					candidatesToDelete = append(candidatesToDelete, manifest)
-				}
+		// The removed child manifests have no references left, the untagged flag deletes them.
+		if purgeParams.untagged && !purgeParams.dryRun {
+			summary, err = purge.DanglingManifests(ctx, acrClient, loginURL, repoName, opts)
+			result.DeletedManifests = summary.Deleted
+			if err != nil {
+				return report.Fail(result, run.purgeError(fmt.Errorf("failed to purge manifests: %w", err), report.Changed()+result.TrimmedTags+result.DeletedManifests))
 			}
-			lastManifestDigest = *manifests[len(manifests)-1].Digest
-			resultManifests, err = acrClient.GetAcrManifests(ctx, repoName, "", lastManifestDigest)
+		}
+	} else if purgeParams.markOnly {
+		// The tags are only scheduled for deletion, a later purge with the sweep flag deletes them.
+		summary, err := purge.Mark(ctx, acrClient, clock, loginURL, repoName, cutoff, tagRegex, purgeParams.matchOn, purgeParams.onlySuperseded, opts)
+		result.MarkedTags = summary.Deleted
+		if err != nil {
+			return report.Fail(result, run.purgeError(fmt.Errorf("failed to schedule the deletion of tags: %w", err), report.Changed()+result.MarkedTags))
+		}
+	} else if !purgeParams.dryRun {
+		var summary purge.Summary
+		var err error
+		if purgeParams.sweep {
+			summary, err = purge.Sweep(ctx, acrClient, clock, loginURL, repoName, cutoff, tagRegex, purgeParams.matchOn, purgeParams.onlySuperseded, purge.Cutoff{Ago: purgeParams.gracePeriod}, opts)
+		} else {
+			summary, err = purge.Tags(ctx, acrClient, clock, loginURL, repoName, cutoff, tagRegex, purgeParams.matchOn, purgeParams.onlySuperseded, opts)
+		}
+		result.DeletedTags = summary.Deleted
+		if err != nil {
+			return report.Fail(result, run.purgeError(fmt.Errorf("failed to purge tags: %w", err), report.Changed()+result.DeletedTags))
+		}
+		// If the untagged flag is set then also manifests are deleted.
+		if purgeParams.untagged {
+			summary, err = purge.DanglingManifests(ctx, acrClient, loginURL, repoName, opts)
+			result.DeletedManifests = summary.Deleted
 			if err != nil {
-				return -1, -1, err
+				return report.Fail(result, run.purgeError(fmt.Errorf("failed to purge manifests: %w", err), report.Changed()+result.DeletedTags+result.DeletedManifests))
 			}
 		}
-		// Just print manifests that would be deleted.
-		for i := 0; i < len(candidatesToDelete); i++ {
-			if _, ok := doNotDelete[*candidatesToDelete[i].Digest]; !ok {
-				fmt.Printf("%s/%s@%s\n", loginURL, repoName, *candidatesToDelete[i].Digest)
-				deletedManifestsCount++
+	} else {
+		// No tag or manifest will be deleted but the counters still will be updated.
+		var err error
+		repoPlan, err = purge.DryRunPlan(ctx, acrClient, clock, repoName, cutoff, tagRegex, purgeParams.matchOn, purgeParams.onlySuperseded, purgeParams.untagged, opts)
+		if err != nil {
+			return report.Fail(result, fmt.Errorf("failed to dry-run purge: %w", err))
+		}
+		result.DeletedTags, result.DeletedManifests = len(repoPlan.Tags), len(repoPlan.Manifests)
+		if run.printer == nil {
+			if err := printDryRun(run.out, repoPlan, clock.Now(), useColor(run.out)); err != nil {
+				return err
 			}
 		}
 	}
+	if purgeParams.deleteEmptyRepos {
+		var err error
+		result.Deleted, err = purge.EmptyRepository(ctx, acrClient, loginURL, repoName, purgeParams.dryRun, repoPlan, opts)
+		if err != nil {
+			report.AddRepository(result)
+			return run.purgeError(fmt.Errorf("failed to delete empty repository: %w", err), report.Changed())
+		}
+	}
+	// After every repository is purged the counters are updated.
+	report.AddRepository(result)
+	return nil
+}
 
-	return deletedTagsCount, deletedManifestsCount, nil
+// printSummary prints the number of deleted tags, manifests and repositories of the purge in the output format, the
+// text summary also contains the statistics of the workers and the result of the verification.
+func (run *purgeRun) printSummary(report *notify.Report, remaining []purge.Remaining, verifier *purge.Verifier) error {
+	purgeParams := run.params
+	out := run.out
+	if run.printer != nil {
+		return run.printer.print(out, purgeSummary{DeletedTags: report.DeletedTags, DeletedManifests: report.DeletedManifests, TrimmedTags: report.TrimmedTags, MarkedTags: report.MarkedTags, DeletedRepos: report.DeletedRepos, Remaining: remaining, APICalls: apiCalls(run.calls)})
+	}
+	if len(run.platforms) > 0 {
+		fmt.Fprintf(out, "\nNumber of trimmed tags: %d\n", report.TrimmedTags)
+		fmt.Fprintf(out, "Number of deleted manifests: %d\n", report.DeletedManifests)
+	} else if purgeParams.markOnly {
+		fmt.Fprintf(out, "\nNumber of tags scheduled for deletion: %d\n", report.MarkedTags)
+	} else {
+		fmt.Fprintf(out, "\nNumber of deleted tags: %d\n", report.DeletedTags)
+		fmt.Fprintf(out, "Number of deleted manifests: %d\n", report.DeletedManifests)
+	}
+	if purgeParams.deleteEmptyRepos {
+		fmt.Fprintf(out, "Number of deleted repositories: %d\n", report.DeletedRepos)
+	}
+	if calls := apiCalls(run.calls); calls != nil {
+		fmt.Fprintf(out, "API calls: %s\n", calls)
+	}
+	if !purgeParams.dryRun {
+		printWorkerStats(out, run.stats())
+	}
+	if verifier != nil {
+		printVerification(out, run.loginURL, verifier.Deleted(), remaining)
+	}
+	return nil
+}
+
+// stats returns the statistics of the deletions of the run, they are empty if no dispatcher was started.
+func (run *purgeRun) stats() worker.Stats {
+	if run.dispatcher == nil {
+		return worker.Stats{}
+	}
+	return run.dispatcher.Stats()
+}
+
+// purgeError marks the error of the run as a partial failure if anything was deleted before it, see purgeError.
+func (run *purgeRun) purgeError(err error, deleted int) error {
+	return purgeError(err, deleted, run.stats())
 }
 
-// countTagsByManifest returns a map that for a given manifest digest contains the number of tags associated to it.
-func countTagsByManifest(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string) (*map[string]int, error) {
-	countMap := map[string]int{}
-	lastTag := ""
-	resultTags, err := acrClient.GetAcrTags(ctx, repoName, "", lastTag)
+// estimatePurge scans the registry to create the plan of the policy and prints how many requests executing it would
+// need and how long it would take, nothing is deleted.
+func estimatePurge(ctx context.Context, out io.Writer, acrClient api.AcrCLIClientInterface, requestCounter *purge.RequestCounter, clock purge.Clock, loginURL string, policy purge.Policy, numWorkers int, opts *purge.Options) error {
+	plan, err := purge.NewPlan(ctx, acrClient, clock, loginURL, policy, opts)
 	if err != nil {
-		if resultTags != nil && resultTags.StatusCode == http.StatusNotFound {
-			//Repository not found, will be handled in the GetAcrManifests call
-			return nil, nil
+		return fmt.Errorf("failed to scan the registry: %w", err)
+	}
+	scanRequests, scanDuration := requestCounter.Requests()
+	fmt.Fprintf(out, "Number of tags to delete: %d\n", plan.TagCount())
+	fmt.Fprintf(out, "Number of manifests to delete: %d\n", plan.ManifestCount())
+	purge.PrintEstimate(out, purge.NewEstimate(plan, scanRequests, scanDuration, numWorkers, opts))
+	return nil
+}
+
+// printWorkerStats prints the latency percentiles and the retries of the deletions, overall and for every worker, so
+// that a slow registry can be told apart from a single slow worker.
+func printWorkerStats(out io.Writer, stats worker.Stats) {
+	if stats.Jobs == 0 {
+		return
+	}
+	fmt.Fprintf(out, "Request latency: p50 %s, p95 %s, p99 %s, retries: %d\n", stats.P50.Round(time.Millisecond), stats.P95.Round(time.Millisecond), stats.P99.Round(time.Millisecond), stats.Retries)
+	for _, ws := range stats.Workers {
+		fmt.Fprintf(out, "  worker %d: %d requests, p50 %s, p95 %s, p99 %s, retries: %d\n", ws.ID, ws.Jobs, ws.P50.Round(time.Millisecond), ws.P95.Round(time.Millisecond), ws.P99.Round(time.Millisecond), ws.Retries)
+	}
+	if stats.Paced > 0 {
+		fmt.Fprintf(out, "%d requests were slowed down to stay within the rate limit of the registry\n", stats.Paced)
+	}
+	if stats.Deduplicated > 0 {
+		fmt.Fprintf(out, "%d duplicate manifest deletions were not sent\n", stats.Deduplicated)
+	}
+	if stats.DigestMismatches > 0 {
+		fmt.Fprintf(out, "%d tags were not deleted because they were pushed again after they were listed\n", stats.DigestMismatches)
+	}
+	if stats.PeakConcurrency > 0 {
+		fmt.Fprintf(out, "Automatic concurrency: %d concurrent requests at the end, %d at most\n", stats.Concurrency, stats.PeakConcurrency)
+	}
+}
+
+// apiCalls returns the requests counted so far, nil if none was sent or if they are not counted.
+func apiCalls(counter *api.CallCounter) *api.CallCounts {
+	if counter == nil {
+		return nil
+	}
+	calls := counter.Counts()
+	if calls.Total() == 0 {
+		return nil
+	}
+	return &calls
+}
+
+// printVerification prints whether the deleted tags and manifests are gone, and the ones that are still present.
+func printVerification(out io.Writer, loginURL string, deleted int, remaining []purge.Remaining) {
+	if len(remaining) == 0 {
+		fmt.Fprintf(out, "Verified that the %d deleted tags and manifests are gone\n", deleted)
+		return
+	}
+	fmt.Fprintf(out, "%d of the %d deleted tags and manifests are still present:\n", len(remaining), deleted)
+	for _, item := range remaining {
+		if len(item.Tag) > 0 {
+			fmt.Fprintf(out, "  %s/%s:%s: %s\n", loginURL, item.RepoName, item.Tag, item.Reason)
+		} else {
+			fmt.Fprintf(out, "  %s/%s@%s: %s\n", loginURL, item.RepoName, item.Digest, item.Reason)
+		}
+	}
+}
+
+// printMaxDeletesReached prints that the purge stopped at the maximum number of deletions and the repositories it did
+// not finish, the one it stopped in included.
+func printMaxDeletesReached(out io.Writer, queued int, pendingRepos map[string]bool) {
+	repoNames := []string{}
+	for repoName := range pendingRepos {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	fmt.Fprintf(out, "The purge stopped after %d deletions because of the max-deletes flag, %d repositories were not purged completely:\n", queued, len(repoNames))
+	for _, repoName := range repoNames {
+		fmt.Fprintf(out, "  %s\n", repoName)
+	}
+}
+
+// signaturePolicy returns the signature policy of the check-signatures, allow-signed and only-unsigned flags.
+func (purgeParams *purgeParameters) signaturePolicy() (string, error) {
+	switch {
+	case purgeParams.onlyUnsigned && purgeParams.allowSigned:
+		return "", errors.New("the only-unsigned flag cannot be used together with the allow-signed flag")
+	case purgeParams.onlyUnsigned:
+		return purge.SignaturesOnlyUnsigned, nil
+	case purgeParams.allowSigned && !purgeParams.checkSignatures:
+		return "", errors.New("the allow-signed flag requires the check-signatures flag")
+	case purgeParams.allowSigned:
+		return purge.SignaturesAllow, nil
+	case purgeParams.checkSignatures:
+		return purge.SignaturesProtect, nil
+	}
+	return "", nil
+}
+
+// checkConnectedRegistry warns on errOut if the connected registry is syncing with its parent or cannot accept the
+// deletions, the state is read through Azure Resource Manager. The purge goes on if the state cannot be read.
+func checkConnectedRegistry(ctx context.Context, errOut io.Writer, id string) error {
+	subscription, resourceGroup, parent, name, err := api.ParseConnectedRegistryID(id)
+	if err != nil {
+		return err
+	}
+	managementClient, err := api.NewManagementClient(subscription, resourceGroup, parent)
+	if err == nil {
+		var connectedRegistry *api.ConnectedRegistry
+		connectedRegistry, err = managementClient.GetConnectedRegistry(ctx, name)
+		if err == nil {
+			printSyncWarnings(errOut, connectedRegistry)
+			return nil
+		}
+	}
+	fmt.Fprintf(errOut, "Warning: unable to check the sync state of the connected registry %s: %v\n", name, err)
+	return nil
+}
+
+// printSyncWarnings prints the reasons why purging the connected registry now could fail or be undone.
+func printSyncWarnings(out io.Writer, connectedRegistry *api.ConnectedRegistry) {
+	for _, warning := range connectedRegistry.SyncWarnings() {
+		fmt.Fprintf(out, "Warning: %s\n", warning)
+	}
+	if syncProperties := connectedRegistry.Properties.Parent.SyncProperties; len(syncProperties.LastSyncTime) > 0 {
+		fmt.Fprintf(out, "The connected registry %s last synced at %s\n", connectedRegistry.Name, syncProperties.LastSyncTime)
+	}
+}
+
+// parseConcurrency returns the number of workers of the concurrency flag, or 0 if it is auto.
+func parseConcurrency(value string) (int, error) {
+	if value == autoConcurrency {
+		return 0, nil
+	}
+	numWorkers, err := strconv.Atoi(value)
+	if err != nil || numWorkers < 1 {
+		return 0, fmt.Errorf("invalid concurrency %q, expected a positive number or %s", value, autoConcurrency)
+	}
+	return numWorkers, nil
+}
+
+// newBandwidthLimiter creates the limiter of the max-bandwidth and max-downloads flags, an empty bandwidth does not
+// limit the rate.
+func newBandwidthLimiter(maxBandwidth string, maxDownloads int) (*api.BandwidthLimiter, error) {
+	if maxDownloads < 0 {
+		return nil, errors.New("the max-downloads value cannot be negative")
+	}
+	var bytesPerSecond int64
+	if len(maxBandwidth) > 0 {
+		var err error
+		if bytesPerSecond, err = api.ParseBandwidth(maxBandwidth); err != nil {
+			return nil, err
 		}
-		return nil, err
 	}
-	for resultTags != nil && resultTags.TagsAttributes != nil {
-		tags := *resultTags.TagsAttributes
-		for _, tag := range tags {
-			// if a digest already exists in the map then add 1 to the number of tags it has.
-			if _, exists := countMap[*tag.Digest]; exists {
-				countMap[*tag.Digest]++
-			} else {
-				countMap[*tag.Digest] = 1
+	return api.NewBandwidthLimiter(bytesPerSecond, maxDownloads), nil
+}
+
+// dryRunPlan prints the plan of the whole policy, compares it with a previous plan and stores it. The previous plan is
+// read before the new one is stored so that both flags can point to the same file.
+func dryRunPlan(ctx context.Context, out io.Writer, acrClient api.AcrCLIClientInterface, clock purge.Clock, loginURL string, policy purge.Policy, savePlan string, diff string, printer *printer, opts *purge.Options) error {
+	var previous *purge.Plan
+	if len(diff) > 0 {
+		var err error
+		previous, err = purge.ReadPlan(diff)
+		if err != nil {
+			return err
+		}
+	}
+	plan, err := purge.NewPlan(ctx, acrClient, clock, loginURL, policy, opts)
+	if err != nil {
+		return fmt.Errorf("failed to dry-run purge: %w", err)
+	}
+	if printer != nil {
+		if err := printer.print(out, purgeSummary{DeletedTags: plan.TagCount(), DeletedManifests: plan.ManifestCount(), APICalls: apiCalls(api.CallCounterFrom(ctx))}); err != nil {
+			return err
+		}
+	} else {
+		for i := range plan.Repositories {
+			if err := printDryRun(out, &plan.Repositories[i], clock.Now(), useColor(out)); err != nil {
+				return err
 			}
 		}
+		fmt.Fprintf(out, "\nNumber of deleted tags: %d\n", plan.TagCount())
+		fmt.Fprintf(out, "Number of deleted manifests: %d\n", plan.ManifestCount())
+	}
+	if previous != nil {
+		fmt.Fprintf(out, "\nChanges since %s:\n", diff)
+		purge.PrintDiff(out, purge.DiffPlans(previous, plan))
+	}
+	if len(savePlan) > 0 {
+		if err := purge.WritePlan(plan, savePlan); err != nil {
+			return fmt.Errorf("failed to save plan: %w", err)
+		}
+	}
+	if plan.TagCount()+plan.ManifestCount() == 0 {
+		return errNothingMatched
+	}
+	return nil
+}
+
+// readFilterFile reads the filters from the specified path, or from stdin if the path is -.
+func readFilterFile(path string, matchOn string) ([]string, error) {
+	if path == "-" {
+		return purge.ReadFilters(os.Stdin, matchOn)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open filter file: %w", err)
+	}
+	defer file.Close()
+	filters, err := purge.ReadFilters(file, matchOn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return filters, nil
+}
 
-		lastTag = *tags[len(tags)-1].Name
-		// Keep on iterating until the resultTags or resultTags.TagsAttributes is nil
-		resultTags, err = acrClient.GetAcrTags(ctx, repoName, "", lastTag)
+// warnSlowFilters prints a warning on errOut for every repository whose filter takes longer than
+// purge.SlowFilterThreshold to match a tag on average.
+func warnSlowFilters(errOut io.Writer, tagFilters map[string]string) error {
+	repoNames := []string{}
+	for repoName := range tagFilters {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	for _, repoName := range repoNames {
+		cost, err := purge.MatchCost(tagFilters[repoName])
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if cost > purge.SlowFilterThreshold {
+			fmt.Fprintf(errOut, "Warning: the filter of repository %s takes %s to match a tag, it will take %s for a million tags. Consider a more specific filter or the filter-timeout flag\n",
+				repoName, cost, (cost * 1000000).Round(time.Second))
 		}
 	}
-	return &countMap, nil
+	return nil
+}
+
+// nopWriteCloser is a writer that is not closed, e.g. the CSV report of an HTML report without the report-csv flag.
+type nopWriteCloser struct {
+	io.Writer
 }
 
-// In order to parse the content of a mutliarch manifest string the following structs were defined.
-type multiArchManifest struct {
-	Manifests     []manifest `json:"manifests"`
-	MediaType     string     `json:"mediaType"`
-	SchemaVersion int        `json:"schemaVersion"`
+// Close does nothing.
+func (nopWriteCloser) Close() error {
+	return nil
 }
 
-type manifest struct {
-	Digest    string   `json:"digest"`
-	MediaType string   `json:"mediaType"`
-	Platform  platform `json:"platform"`
-	Size      int64    `json:"size"`
+// writeHTMLReport renders the HTML report to the target of the report-html flag, the ages are relative to now.
+func writeHTMLReport(target string, out io.Writer, report *purge.HTMLReport, now time.Time) error {
+	w, err := sinks.Open(target, "text/html", out)
+	if err != nil {
+		return fmt.Errorf("failed to create the HTML report: %w", err)
+	}
+	if err := report.Render(w, now); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write the HTML report: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write the HTML report: %w", err)
+	}
+	return nil
 }
 
-type platform struct {
-	Architecture string `json:"architecture"`
-	Os           string `json:"os"`
+// writeRunReport writes the report of a run as indented JSON and closes the writer, which uploads the report if it is
+// a Storage blob.
+func writeRunReport(w io.WriteCloser, report *notify.Report) error {
+	reportBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		w.Close()
+		return err
+	}
+	if _, err := w.Write(append(reportBytes, '\n')); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write the report: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write the report: %w", err)
+	}
+	return nil
 }
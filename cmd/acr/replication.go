@@ -0,0 +1,226 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newReplicationCmdLongMessage       = `acr replication: check the geo-replications of a registry.`
+	newReplicationStatusCmdLongMessage = `acr replication status: report whether an artifact has replicated to every region of a geo-replicated registry.
+The regions are listed through Azure Resource Manager and the manifest is requested from the endpoint of every region,
+an artifact is replicated to a region once its endpoint returns the same digest as the login server. The command fails
+if any region does not have the artifact yet, so it can guard a deletion from the home region. The Azure credentials
+are read like in the token command.`
+	replicationStatusExampleMessage = `  - Check that hello-world:v1 replicated to every region of the example registry
+    acr replication status -r example -g example-rg hello-world:v1
+
+  - Print the status of every region as JSON
+    acr replication status -r example -g example-rg hello-world@sha256:<digest> -o json`
+)
+
+// The states of an artifact in a region.
+const (
+	regionReplicated = "replicated"
+	regionPending    = "pending"
+	regionError      = "error"
+)
+
+// replicationParameters are the flags of the replication command.
+type replicationParameters struct {
+	*rootParameters
+	subscription  string
+	resourceGroup string
+	output        string
+}
+
+// newReplicationCmd defines the replication command, it only groups the replication subcommands.
+func newReplicationCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	replicationParams := replicationParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:   "replication",
+		Short: "Check the geo-replications of a registry",
+		Long:  newReplicationCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Help()
+			return nil
+		},
+	}
+	cmd.AddCommand(newReplicationStatusCmd(out, &replicationParams))
+	cmd.PersistentFlags().StringVar(&replicationParams.subscription, "subscription", "", "The subscription of the registry (env AZURE_SUBSCRIPTION_ID)")
+	cmd.PersistentFlags().StringVarP(&replicationParams.resourceGroup, "resource-group", "g", "", "The resource group of the registry")
+	// The regions of the registry can only be listed through Azure Resource Manager.
+	cmd.MarkPersistentFlagRequired("resource-group")
+	return cmd
+}
+
+// newReplicationStatusCmd defines the replication status subcommand, it receives the artifact as <repository>:<tag> or
+// <repository>@<digest>.
+func newReplicationStatusCmd(out io.Writer, replicationParams *replicationParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "status <repository>:<tag>",
+		Short:   "Report whether an artifact replicated to every region",
+		Long:    newReplicationStatusCmdLongMessage,
+		Example: replicationStatusExampleMessage,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printer, err := newPrinter(replicationParams.output)
+			if err != nil {
+				return err
+			}
+			registryName, err := replicationParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			managementClient, err := newManagementClient(replicationParams.rootParameters, replicationParams.subscription, replicationParams.resourceGroup)
+			if err != nil {
+				return err
+			}
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, replicationParams.username, replicationParams.password, replicationParams.configs)
+			if err != nil {
+				return err
+			}
+			regional := func(endpoint string) manifestHeader {
+				return acrClient.RegionalClient(endpoint)
+			}
+			ctx := context.Background()
+			status, err := getReplicationStatus(ctx, managementClient, acrClient, regional, loginURL, args[0])
+			if err != nil {
+				return err
+			}
+			if printer != nil {
+				err = printer.print(out, status)
+			} else {
+				err = printReplicationStatus(out, status, useColor(out))
+			}
+			if err != nil {
+				return err
+			}
+			return replicationError(status)
+		},
+	}
+	addOutputFlag(cmd, &replicationParams.output)
+	return cmd
+}
+
+// replicationLister contains the ManagementClient method used by the replication command.
+type replicationLister interface {
+	ListReplications(ctx context.Context) ([]api.Replication, error)
+}
+
+// manifestHeader contains the AcrCLIClient method used to find the digest of the artifact in every region.
+type manifestHeader interface {
+	HeadManifest(ctx context.Context, repoName string, reference string) (string, error)
+}
+
+// replicationStatus is the output of the replication status command.
+type replicationStatus struct {
+	Reference  string         `json:"reference"`
+	Digest     string         `json:"digest"`
+	Replicated bool           `json:"replicated"`
+	Regions    []regionStatus `json:"regions"`
+}
+
+// regionStatus is the state of the artifact in a region, Status is the status of the replication itself (e.g. Ready).
+type regionStatus struct {
+	Region   string `json:"region"`
+	Endpoint string `json:"endpoint"`
+	Status   string `json:"status"`
+	State    string `json:"state"`
+	Digest   string `json:"digest,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// getReplicationStatus resolves the digest of the reference through the login server and compares it with the digest
+// the endpoint of every region returns.
+func getReplicationStatus(ctx context.Context, lister replicationLister, home manifestHeader, regional func(endpoint string) manifestHeader, loginURL string, reference string) (*replicationStatus, error) {
+	repoName, ref, _, err := parseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := home.HeadManifest(ctx, repoName, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the digest of %s: %w", reference, err)
+	}
+	if len(digest) == 0 {
+		return nil, fmt.Errorf("%s/%s not found", loginURL, reference)
+	}
+	replications, err := lister.ListReplications(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(replications, func(i, j int) bool { return replications[i].Location < replications[j].Location })
+	status := &replicationStatus{
+		Reference:  fmt.Sprintf("%s/%s", loginURL, reference),
+		Digest:     digest,
+		Replicated: true,
+		Regions:    []regionStatus{},
+	}
+	for _, replication := range replications {
+		region := regionStatus{
+			Region:   replication.Location,
+			Endpoint: api.RegionalEndpoint(loginURL, replication.Location),
+			Status:   replication.Properties.Status.DisplayStatus,
+			State:    regionReplicated,
+		}
+		if len(region.Status) == 0 {
+			region.Status = replication.Properties.ProvisioningState
+		}
+		region.Digest, err = regional(region.Endpoint).HeadManifest(ctx, repoName, ref)
+		switch {
+		case err != nil:
+			region.State = regionError
+			region.Error = err.Error()
+		case region.Digest != digest:
+			// The tag can still point to the previous digest in a region the push did not reach yet.
+			region.State = regionPending
+		}
+		if region.State != regionReplicated {
+			status.Replicated = false
+		}
+		status.Regions = append(status.Regions, region)
+	}
+	return status, nil
+}
+
+// printReplicationStatus prints the digest of the artifact and a table with its state in every region.
+func printReplicationStatus(out io.Writer, status *replicationStatus, colored bool) error {
+	fmt.Fprintf(out, "%-11s%s\n", "Reference:", status.Reference)
+	fmt.Fprintf(out, "%-11s%s\n", "Digest:", status.Digest)
+	t := newTable("", "REGION", "ENDPOINT", "REPLICATION", "STATE")
+	for _, region := range status.Regions {
+		color, state := colorGreen, region.State
+		if region.State != regionReplicated {
+			color = colorRed
+		}
+		if len(region.Error) > 0 {
+			state += ": " + region.Error
+		}
+		t.addRow(color, region.Region, region.Endpoint, region.Status, state)
+	}
+	return t.render(out, colored)
+}
+
+// replicationError returns an error if the artifact is missing from any region, so that scripts can wait for the
+// replication before deleting it.
+func replicationError(status *replicationStatus) error {
+	missing := 0
+	for _, region := range status.Regions {
+		if region.State != regionReplicated {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s is not replicated to %d of the %d regions", status.Reference, missing, len(status.Regions))
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeReplications lists the replications of a registry.
+type fakeReplications []api.Replication
+
+func (f fakeReplications) ListReplications(ctx context.Context) ([]api.Replication, error) {
+	return f, nil
+}
+
+// fakeManifestHeader returns the digest of every reference of an endpoint, err is returned for every reference if set.
+type fakeManifestHeader struct {
+	digests map[string]string
+	err     error
+}
+
+func (f *fakeManifestHeader) HeadManifest(ctx context.Context, repoName string, reference string) (string, error) {
+	return f.digests[repoName+":"+reference], f.err
+}
+
+// TestReplicationStatus contains the tests for the replication status command.
+func TestReplicationStatus(t *testing.T) {
+	replications := fakeReplications{}
+	for _, location := range []string{"westus", "eastus", "northeurope"} {
+		replication := api.Replication{Name: location, Location: location}
+		replication.Properties.Status.DisplayStatus = "Ready"
+		replications = append(replications, replication)
+	}
+	home := &fakeManifestHeader{digests: map[string]string{testRepo + ":v1": digest}}
+	endpoints := map[string]manifestHeader{
+		"foo.eastus.geo.azurecr.io":      home,
+		"foo.westus.geo.azurecr.io":      home,
+		"foo.northeurope.geo.azurecr.io": home,
+	}
+	regional := func(endpoint string) manifestHeader { return endpoints[endpoint] }
+	// First test, the artifact has the same digest in every region.
+	t.Run("ReplicatedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		status, err := getReplicationStatus(testCtx, replications, home, regional, testLoginURL, testRepo+":v1")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.True(status.Replicated)
+		assert.Equal(3, len(status.Regions))
+		assert.Equal("eastus", status.Regions[0].Region)
+		assert.Equal(nil, replicationError(status))
+	})
+	// Second test, a region that still has the previous digest is pending and a region that fails is an error.
+	t.Run("PendingTest", func(t *testing.T) {
+		assert := assert.New(t)
+		endpoints["foo.westus.geo.azurecr.io"] = &fakeManifestHeader{digests: map[string]string{testRepo + ":v1": digest1}}
+		endpoints["foo.northeurope.geo.azurecr.io"] = &fakeManifestHeader{err: errors.New("unreachable")}
+		status, err := getReplicationStatus(testCtx, replications, home, regional, testLoginURL, testRepo+":v1")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.False(status.Replicated)
+		assert.Equal(regionReplicated, status.Regions[0].State)
+		assert.Equal(regionError, status.Regions[1].State)
+		assert.Equal(regionPending, status.Regions[2].State)
+		out := &bytes.Buffer{}
+		assert.Equal(nil, printReplicationStatus(out, status, false))
+		assert.Contains(out.String(), "Digest:    "+digest+"\n")
+		assert.Contains(out.String(), "northeurope  foo.northeurope.geo.azurecr.io  Ready        error: unreachable\n")
+		err = replicationError(status)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), "not replicated to 2 of the 3 regions")
+	})
+	// Third test, an artifact missing from the login server is an error.
+	t.Run("NotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		_, err := getReplicationStatus(testCtx, replications, home, regional, testLoginURL, testRepo+":v2")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), "not found")
+	})
+}
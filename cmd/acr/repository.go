@@ -0,0 +1,175 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newRepositoryCmdLongMessage       = `acr repository: show and update the attributes of a repository.`
+	newRepositoryShowCmdLongMessage   = `acr repository show: outputs whether the repository can be deleted, written, listed and read`
+	newRepositoryUpdateCmdLongMessage = `acr repository update: change whether the repository can be deleted, written, listed and read.
+Only the attributes whose flags are specified are changed.`
+	repositoryUpdateExampleMessage = `  - Freeze the hello-world repository before a purge so that no image can be pushed or deleted
+    acr repository update -r example --repository hello-world --delete-enabled=false --write-enabled=false
+
+  - Unfreeze the hello-world repository after the purge
+    acr repository update -r example --repository hello-world --delete-enabled=true --write-enabled=true
+`
+)
+
+// repositoryParameters contains the repository and the attributes to change, the attributes whose flags are not
+// specified are not changed.
+type repositoryParameters struct {
+	*rootParameters
+	repoName      string
+	deleteEnabled bool
+	writeEnabled  bool
+	listEnabled   bool
+	readEnabled   bool
+}
+
+// newRepositoryCmd defines the repository command, the attributes can be shown or updated with the repository show
+// and repository update commands respectively.
+func newRepositoryCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	repositoryParams := repositoryParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:   "repository",
+		Short: "Manage the attributes of a repository",
+		Long:  newRepositoryCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Help()
+			return nil
+		},
+	}
+
+	cmd.AddCommand(
+		newRepositoryShowCmd(out, &repositoryParams),
+		newRepositoryUpdateCmd(out, &repositoryParams),
+	)
+	cmd.PersistentFlags().StringVar(&repositoryParams.repoName, "repository", "", "The repository name")
+	// Since the repository will be needed in either subcommand it is marked as a required flag
+	cmd.MarkPersistentFlagRequired("repository")
+
+	return cmd
+}
+
+// newRepositoryShowCmd defines the repository show subcommand.
+func newRepositoryShowCmd(out io.Writer, repositoryParams *repositoryParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the attributes of a repository",
+		Long:  newRepositoryShowCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registryName, err := repositoryParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, repositoryParams.username, repositoryParams.password, repositoryParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			return showRepository(ctx, acrClient, loginURL, repositoryParams.repoName)
+		},
+	}
+	return cmd
+}
+
+// newRepositoryUpdateCmd defines the repository update subcommand.
+func newRepositoryUpdateCmd(out io.Writer, repositoryParams *repositoryParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "update",
+		Short:   "Update the attributes of a repository",
+		Long:    newRepositoryUpdateCmdLongMessage,
+		Example: repositoryUpdateExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Only the attributes whose flags were specified are sent, the registry keeps the value of the rest.
+			attributes := &acr.ChangeableAttributes{}
+			if cmd.Flags().Changed("delete-enabled") {
+				attributes.DeleteEnabled = &repositoryParams.deleteEnabled
+			}
+			if cmd.Flags().Changed("write-enabled") {
+				attributes.WriteEnabled = &repositoryParams.writeEnabled
+			}
+			if cmd.Flags().Changed("list-enabled") {
+				attributes.ListEnabled = &repositoryParams.listEnabled
+			}
+			if cmd.Flags().Changed("read-enabled") {
+				attributes.ReadEnabled = &repositoryParams.readEnabled
+			}
+			if attributes.DeleteEnabled == nil && attributes.WriteEnabled == nil && attributes.ListEnabled == nil && attributes.ReadEnabled == nil {
+				return errors.New("at least one of the delete-enabled, write-enabled, list-enabled or read-enabled flags is required")
+			}
+			registryName, err := repositoryParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, repositoryParams.username, repositoryParams.password, repositoryParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			return updateRepository(ctx, acrClient, loginURL, repositoryParams.repoName, attributes)
+		},
+	}
+
+	cmd.Flags().BoolVar(&repositoryParams.deleteEnabled, "delete-enabled", true, "Whether the repository and its images can be deleted")
+	cmd.Flags().BoolVar(&repositoryParams.writeEnabled, "write-enabled", true, "Whether images can be pushed to the repository")
+	cmd.Flags().BoolVar(&repositoryParams.listEnabled, "list-enabled", true, "Whether the repository is included in the catalog")
+	cmd.Flags().BoolVar(&repositoryParams.readEnabled, "read-enabled", true, "Whether images can be pulled from the repository")
+	return cmd
+}
+
+// showRepository prints the changeable attributes of a repository.
+func showRepository(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string) error {
+	repoAttributes, err := acrClient.GetAcrRepositoryAttributes(ctx, repoName)
+	if err != nil {
+		if errors.Is(err, api.ErrNotFound) {
+			return fmt.Errorf("%s repository not found", repoName)
+		}
+		return fmt.Errorf("failed to get repository attributes: %w", err)
+	}
+	fmt.Printf("%s/%s\n", loginURL, repoName)
+	attributes := repoAttributes.ChangeableAttributes
+	if attributes == nil {
+		attributes = &acr.ChangeableAttributes{}
+	}
+	printAttribute("delete-enabled", attributes.DeleteEnabled)
+	printAttribute("write-enabled", attributes.WriteEnabled)
+	printAttribute("list-enabled", attributes.ListEnabled)
+	printAttribute("read-enabled", attributes.ReadEnabled)
+	return nil
+}
+
+// updateRepository changes the attributes of a repository and prints the resulting attributes.
+func updateRepository(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string, attributes *acr.ChangeableAttributes) error {
+	_, err := acrClient.UpdateAcrRepositoryAttributes(ctx, repoName, attributes)
+	if err != nil {
+		if errors.Is(err, api.ErrNotFound) {
+			return fmt.Errorf("%s repository not found", repoName)
+		}
+		return fmt.Errorf("failed to update repository attributes: %w", err)
+	}
+	return showRepository(ctx, acrClient, loginURL, repoName)
+}
+
+// printAttribute prints the value of an attribute, attributes the registry did not return are shown as unknown.
+func printAttribute(name string, value *bool) {
+	if value == nil {
+		fmt.Printf("  %s: unknown\n", name)
+		return
+	}
+	fmt.Printf("  %s: %t\n", name, *value)
+}
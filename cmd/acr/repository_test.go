@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateRepository(t *testing.T) {
+	disabled := false
+	enabled := true
+	attributes := &acr.ChangeableAttributes{DeleteEnabled: &disabled, WriteEnabled: &disabled}
+	// First test, repository not found should return an error.
+	t.Run("RepositoryNotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("UpdateAcrRepositoryAttributes", testCtx, testRepo, attributes).Return(&notFoundResponse, &api.StatusError{StatusCode: http.StatusNotFound, Message: "testRepo not found"}).Once()
+		err := updateRepository(testCtx, mockClient, testLoginURL, testRepo, attributes)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Equal("bar repository not found", err.Error())
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, the attributes are updated and the resulting attributes are shown.
+	t.Run("UpdateAttributesTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("UpdateAcrRepositoryAttributes", testCtx, testRepo, attributes).Return(&autorest.Response{}, nil).Once()
+		mockClient.On("GetAcrRepositoryAttributes", testCtx, testRepo).Return(&acr.RepositoryAttributes{
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &disabled, WriteEnabled: &disabled, ListEnabled: &enabled, ReadEnabled: &enabled},
+		}, nil).Once()
+		err := updateRepository(testCtx, mockClient, testLoginURL, testRepo, attributes)
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, if the attributes cannot be read after the update an error should be returned.
+	t.Run("ShowErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("UpdateAcrRepositoryAttributes", testCtx, testRepo, attributes).Return(&autorest.Response{}, nil).Once()
+		mockClient.On("GetAcrRepositoryAttributes", testCtx, testRepo).Return(nil, errors.New("unauthorized")).Once()
+		err := updateRepository(testCtx, mockClient, testLoginURL, testRepo, attributes)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -5,8 +5,14 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/version"
 	"github.com/spf13/cobra"
 )
 
@@ -16,6 +22,13 @@ type rootParameters struct {
 	username     string
 	password     string
 	configs      []string
+	transport    api.TransportOptions
+	apiVersion   string
+	authMode     string
+	tokenFile    string
+	plainHTTP    bool
+	pageSize     int
+	telemetry    bool
 }
 
 func newRootCmd(args []string) *cobra.Command {
@@ -28,6 +41,46 @@ func newRootCmd(args []string) *cobra.Command {
 
 To start working with the CLI, run acr --help`,
 		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Every request carries the version and the command that made it so that registry-side logs (e.g.
+			// throttling) can be correlated with the acr-cli.
+			api.SetUserAgent(version.UserAgent(strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name())))
+			if value, ok := os.LookupEnv("ACR_API_VERSION"); ok && !cmd.Flags().Changed("api-version") {
+				rootParams.apiVersion = value
+			}
+			if err := api.SetAPIVersion(rootParams.apiVersion); err != nil {
+				return err
+			}
+			if value, ok := os.LookupEnv("ACR_AUTH_MODE"); ok && !cmd.Flags().Changed("auth-mode") {
+				rootParams.authMode = value
+			}
+			if err := api.SetAuthMode(rootParams.authMode); err != nil {
+				return err
+			}
+			if value, ok := os.LookupEnv("ACR_TOKEN_FILE"); ok && !cmd.Flags().Changed("token-file") {
+				rootParams.tokenFile = value
+			}
+			api.SetTokenFile(rootParams.tokenFile)
+			if value, ok := os.LookupEnv("ACR_PLAIN_HTTP"); ok && !cmd.Flags().Changed("plain-http") {
+				plainHTTP, err := strconv.ParseBool(value)
+				if err != nil {
+					return fmt.Errorf("invalid ACR_PLAIN_HTTP value: %w", err)
+				}
+				rootParams.plainHTTP = plainHTTP
+			}
+			api.SetPlainHTTP(rootParams.plainHTTP)
+			if value, ok := os.LookupEnv("ACR_PAGE_SIZE"); ok && !cmd.Flags().Changed("page-size") {
+				pageSize, err := strconv.Atoi(value)
+				if err != nil {
+					return fmt.Errorf("invalid ACR_PAGE_SIZE value: %w", err)
+				}
+				rootParams.pageSize = pageSize
+			}
+			if err := api.SetPageSize(rootParams.pageSize); err != nil {
+				return err
+			}
+			return rootParams.configureTransport(cmd)
+		},
 	}
 
 	flags := cmd.PersistentFlags()
@@ -40,10 +93,48 @@ To start working with the CLI, run acr --help`,
 		newLogoutCmd(out),
 		newTagCmd(out, &rootParams),
 		newManifestCmd(out, &rootParams),
+		newSnapshotCmd(out, &rootParams),
+		newUsageCmd(out, &rootParams),
+		newServeCmd(out, &rootParams),
+		newCheckHealthCmd(out, &rootParams),
+		newRepositoryCmd(out, &rootParams),
+		newTokenCmd(out, &rootParams),
+		newArtifactCmd(out, &rootParams),
+		newHelmCmd(out, &rootParams),
+		newImageCmd(out, &rootParams),
+		newReplicationCmd(out, &rootParams),
+		newGCCmd(out, &rootParams),
+		newStatsCmd(out, &rootParams),
+		newPolicyCmd(out),
+		newPinCmd(out, &rootParams),
+		newDoctorCmd(out, &rootParams),
+		newImportCmd(out, &rootParams),
+		newPromoteCmd(out, &rootParams),
+		newDiffCmd(out, &rootParams),
+		newSbomCmd(out, &rootParams),
+		newTelemetryCmd(out),
 	)
 	cmd.PersistentFlags().StringVarP(&rootParams.registryName, "registry", "r", "", "Registry name")
 	cmd.PersistentFlags().StringVarP(&rootParams.username, "username", "u", "", "Registry username")
 	cmd.PersistentFlags().StringVarP(&rootParams.password, "password", "p", "", "Registry password")
+	defaultTransport := api.DefaultTransportOptions()
+	cmd.PersistentFlags().IntVar(&rootParams.transport.MaxIdleConns, "max-idle-conns", defaultTransport.MaxIdleConns, "Maximum number of idle connections kept open (env ACR_MAX_IDLE_CONNS)")
+	cmd.PersistentFlags().IntVar(&rootParams.transport.MaxIdleConnsPerHost, "max-idle-conns-per-host", defaultTransport.MaxIdleConnsPerHost, "Maximum number of idle connections kept open to the registry (env ACR_MAX_IDLE_CONNS_PER_HOST)")
+	cmd.PersistentFlags().IntVar(&rootParams.transport.MaxConnsPerHost, "max-conns-per-host", defaultTransport.MaxConnsPerHost, "Maximum number of connections to the registry, 0 means no limit (env ACR_MAX_CONNS_PER_HOST)")
+	cmd.PersistentFlags().DurationVar(&rootParams.transport.IdleConnTimeout, "idle-conn-timeout", defaultTransport.IdleConnTimeout, "How long an idle connection is kept open (env ACR_IDLE_CONN_TIMEOUT)")
+	cmd.PersistentFlags().StringVar(&rootParams.transport.TLSRenegotiation, "tls-renegotiation", defaultTransport.TLSRenegotiation, "TLS renegotiation support, one of never, once or freely (env ACR_TLS_RENEGOTIATION)")
+	cmd.PersistentFlags().StringVar(&rootParams.transport.CACert, "ca-cert", "", "PEM bundle of the certificate authorities trusted in addition to the system ones, e.g. the private CA of a connected registry (env ACR_CA_CERT)")
+	cmd.PersistentFlags().BoolVar(&rootParams.transport.InsecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Do not verify the TLS certificates of the registry, only for tests and trusted networks (env ACR_INSECURE_SKIP_TLS_VERIFY)")
+	cmd.PersistentFlags().BoolVar(&rootParams.transport.InsecureSkipTLSVerify, "insecure", false, "Shorthand for --insecure-skip-tls-verify")
+	cmd.PersistentFlags().BoolVar(&rootParams.plainHTTP, "plain-http", false, "Connect to the registry with http instead of https, e.g. a connected registry that is not exposed with TLS (env ACR_PLAIN_HTTP)")
+	cmd.PersistentFlags().StringVar(&rootParams.transport.Proxy, "proxy", "", "URL of the proxy of all the requests, e.g. http://proxy:3128, by default HTTPS_PROXY, HTTP_PROXY and NO_PROXY are used (env ACR_PROXY)")
+	cmd.PersistentFlags().StringVar(&rootParams.transport.ProxyUsername, "proxy-username", "", "Username of a proxy that requires basic auth (env ACR_PROXY_USERNAME)")
+	cmd.PersistentFlags().StringVar(&rootParams.transport.ProxyPassword, "proxy-password", "", "Password of a proxy that requires basic auth (env ACR_PROXY_PASSWORD)")
+	cmd.PersistentFlags().StringVar(&rootParams.apiVersion, "api-version", api.APIVersionAuto, "Version of the ACR API, auto uses the newest version the registry supports, "+api.LegacyAPIVersion+" works with older registries like Azure Stack (env ACR_API_VERSION)")
+	cmd.PersistentFlags().StringVar(&rootParams.authMode, "auth-mode", api.AuthModeAuto, "How to authenticate, one of "+strings.Join(api.AuthModes(), ", ")+", auto tries the username and password, the token file and the docker config in order (env ACR_AUTH_MODE)")
+	cmd.PersistentFlags().IntVar(&rootParams.pageSize, "page-size", 0, fmt.Sprintf("Number of tags, manifests or repositories listed in every request, by default it starts at %d and grows up to %d for large repositories (env ACR_PAGE_SIZE)", api.InitialPageSize, api.MaxPageSize))
+	cmd.PersistentFlags().BoolVar(&rootParams.telemetry, "telemetry", false, "Send anonymous usage metrics of this command, see acr telemetry (env ACR_TELEMETRY)")
+	cmd.PersistentFlags().StringVar(&rootParams.tokenFile, "token-file", "", "File containing an ACR refresh token, used by the token-file auth mode (env ACR_TOKEN_FILE)")
 	cmd.Flags().BoolP("help", "h", false, "Print usage")
 	cmd.Flags().StringArrayVarP(&rootParams.configs, "config", "c", nil, "Auth config paths")
 	// No parameter is marked as required because the registry could be inferred from a task context, same with username and password
@@ -64,3 +155,63 @@ func (rootParams *rootParameters) GetRegistryName() (string, error) {
 	return "", errors.New("unable to determine registry name, please use --registry flag")
 
 }
+
+// configureTransport sets up the connection pool used for all the registry requests, the settings that were not
+// specified through flags are read from environment variables.
+func (rootParams *rootParameters) configureTransport(cmd *cobra.Command) error {
+	intSettings := []struct {
+		flag   string
+		env    string
+		target *int
+	}{
+		{"max-idle-conns", "ACR_MAX_IDLE_CONNS", &rootParams.transport.MaxIdleConns},
+		{"max-idle-conns-per-host", "ACR_MAX_IDLE_CONNS_PER_HOST", &rootParams.transport.MaxIdleConnsPerHost},
+		{"max-conns-per-host", "ACR_MAX_CONNS_PER_HOST", &rootParams.transport.MaxConnsPerHost},
+	}
+	for _, setting := range intSettings {
+		if value, ok := os.LookupEnv(setting.env); ok && !cmd.Flags().Changed(setting.flag) {
+			intValue, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s value: %w", setting.env, err)
+			}
+			*setting.target = intValue
+		}
+	}
+	if value, ok := os.LookupEnv("ACR_IDLE_CONN_TIMEOUT"); ok && !cmd.Flags().Changed("idle-conn-timeout") {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid ACR_IDLE_CONN_TIMEOUT value: %w", err)
+		}
+		rootParams.transport.IdleConnTimeout = timeout
+	}
+	stringSettings := []struct {
+		flag   string
+		env    string
+		target *string
+	}{
+		{"tls-renegotiation", "ACR_TLS_RENEGOTIATION", &rootParams.transport.TLSRenegotiation},
+		{"ca-cert", "ACR_CA_CERT", &rootParams.transport.CACert},
+		{"proxy", "ACR_PROXY", &rootParams.transport.Proxy},
+		{"proxy-username", "ACR_PROXY_USERNAME", &rootParams.transport.ProxyUsername},
+		{"proxy-password", "ACR_PROXY_PASSWORD", &rootParams.transport.ProxyPassword},
+	}
+	for _, setting := range stringSettings {
+		if value, ok := os.LookupEnv(setting.env); ok && !cmd.Flags().Changed(setting.flag) {
+			*setting.target = value
+		}
+	}
+	if value, ok := os.LookupEnv("ACR_INSECURE_SKIP_TLS_VERIFY"); ok && !cmd.Flags().Changed("insecure-skip-tls-verify") && !cmd.Flags().Changed("insecure") {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid ACR_INSECURE_SKIP_TLS_VERIFY value: %w", err)
+		}
+		rootParams.transport.InsecureSkipTLSVerify = insecure
+	}
+	if rootParams.transport.InsecureSkipTLSVerify {
+		fmt.Fprintln(os.Stderr, "Warning: the TLS certificates of the registry are not verified")
+	}
+	// The fault injection has no flag because it is only meant for tests.
+	rootParams.transport.FaultInjection = os.Getenv(api.FaultInjectionEnv)
+	rootParams.transport.Debug = len(os.Getenv(api.DebugEnv)) > 0
+	return api.ConfigureTransport(rootParams.transport)
+}
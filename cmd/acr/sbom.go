@@ -0,0 +1,349 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newSbomCmdLongMessage       = `acr sbom: attach software bills of materials to images and download them.`
+	newSbomAttachCmdLongMessage = `acr sbom attach: push an SBOM file as an OCI referrer of an image, an untagged artifact whose subject is the
+image and whose artifact type is the media type of the SBOM. SPDX and CycloneDX JSON files are detected from their
+content, the type flag sets the type of other files. The artifact is found with the referrers API of the image, it is
+untagged and a purge with the include-referrers flag deletes it together with the image.`
+	newSbomDownloadCmdLongMessage = `acr sbom download: download the SBOM attached to an image, the latest one if several are attached. The
+content is verified against its digest and written to the file of the file flag, or to the standard output.`
+	sbomAttachExampleMessage = `  - Attach the SPDX SBOM of the hello-world:latest image of the example registry
+    acr sbom attach -r example hello-world:latest --file sbom.spdx.json
+
+  - Attach an SBOM of another format with its media type
+    acr sbom attach -r example hello-world@sha256:<digest> --file sbom.xml --type application/vnd.cyclonedx+xml`
+	sbomDownloadExampleMessage = `  - Download the SBOM of the hello-world:latest image of the example registry
+    acr sbom download -r example hello-world:latest --file sbom.json
+
+  - Print the CycloneDX SBOM of an image
+    acr sbom download -r example hello-world:latest --type cyclonedx`
+)
+
+// The media types of the SBOMs attach detects, they are the artifact types of the referrers download looks for when
+// no type is specified.
+const (
+	spdxContentType      = "application/spdx+json"
+	cyclonedxContentType = "application/vnd.cyclonedx+json"
+	// ociEmptyContentType is the media type of the empty config of artifacts that have no config.
+	ociEmptyContentType = "application/vnd.oci.empty.v1+json"
+	// Annotations of the SBOM artifacts, created is used to find the latest SBOM of an image.
+	annotationCreated = "org.opencontainers.image.created"
+	annotationTitle   = "org.opencontainers.image.title"
+)
+
+// ociEmptyConfig is the config of the SBOM artifacts.
+var ociEmptyConfig = []byte("{}")
+
+// errNoSbom is returned by download when no SBOM is attached to the image.
+var errNoSbom = errors.New("no SBOM is attached to the image")
+
+// sbomParameters defines the parameters used by the sbom subcommands.
+type sbomParameters struct {
+	*rootParameters
+	file      string
+	sbomType  string
+	chunkSize int
+}
+
+// sbomDescriptor is a descriptor of the manifest of an SBOM artifact.
+type sbomDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// sbomManifest is the manifest of an SBOM artifact, its only layer is the SBOM.
+type sbomManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType"`
+	Config        sbomDescriptor    `json:"config"`
+	Layers        []sbomDescriptor  `json:"layers"`
+	Subject       *sbomDescriptor   `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// newSbomCmd defines the sbom command, it only groups the sbom subcommands.
+func newSbomCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sbom",
+		Short: "Attach SBOMs to images and download them",
+		Long:  newSbomCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Help()
+			return nil
+		},
+	}
+	cmd.AddCommand(
+		newSbomAttachCmd(out, rootParams),
+		newSbomDownloadCmd(out, rootParams),
+	)
+	return cmd
+}
+
+// newSbomAttachCmd defines the sbom attach subcommand, it receives the image as <repository>:<tag> or
+// <repository>@<digest>.
+func newSbomAttachCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	sbomParams := sbomParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "attach <repository>:<tag>",
+		Short:   "Attach an SBOM to an image",
+		Long:    newSbomAttachCmdLongMessage,
+		Example: sbomAttachExampleMessage,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			content, err := ioutil.ReadFile(sbomParams.file)
+			if err != nil {
+				return fmt.Errorf("failed to read the SBOM: %w", err)
+			}
+			mediaType, err := sbomMediaType(sbomParams.sbomType, content)
+			if err != nil {
+				return err
+			}
+			acrClient, loginURL, err := sbomParams.client()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			return attachSbom(ctx, out, acrClient, loginURL, args[0], filepath.Base(sbomParams.file), mediaType, content, sbomParams.chunkSize, time.Now())
+		},
+	}
+	cmd.Flags().StringVarP(&sbomParams.file, "file", "f", "", "The SBOM file to attach")
+	cmd.Flags().StringVar(&sbomParams.sbomType, "type", "", "The type of the SBOM, spdx, cyclonedx or a media type, detected from the content by default")
+	cmd.Flags().IntVar(&sbomParams.chunkSize, "chunk-size", api.DefaultBlobChunkSize, "The size in bytes of the chunks the SBOM is uploaded in")
+	cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+// newSbomDownloadCmd defines the sbom download subcommand, it receives the image as <repository>:<tag> or
+// <repository>@<digest>.
+func newSbomDownloadCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	sbomParams := sbomParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "download <repository>:<tag>",
+		Short:   "Download the SBOM of an image",
+		Long:    newSbomDownloadCmdLongMessage,
+		Example: sbomDownloadExampleMessage,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			artifactTypes := []string{spdxContentType, cyclonedxContentType}
+			if len(sbomParams.sbomType) > 0 {
+				mediaType, err := sbomMediaType(sbomParams.sbomType, nil)
+				if err != nil {
+					return err
+				}
+				artifactTypes = []string{mediaType}
+			}
+			acrClient, _, err := sbomParams.client()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			content, err := downloadSbom(ctx, acrClient, args[0], artifactTypes)
+			if err != nil {
+				return err
+			}
+			if len(sbomParams.file) == 0 {
+				_, err := out.Write(content)
+				return err
+			}
+			if err := ioutil.WriteFile(sbomParams.file, content, 0644); err != nil {
+				return fmt.Errorf("failed to write the SBOM: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&sbomParams.file, "file", "f", "", "The file the SBOM is written to, the standard output by default")
+	cmd.Flags().StringVar(&sbomParams.sbomType, "type", "", "Only download an SBOM of this type, spdx, cyclonedx or a media type, any SPDX or CycloneDX SBOM by default")
+	return cmd
+}
+
+// client returns the client of the registry of the registry flag and its login URL.
+func (p *sbomParameters) client() (*api.AcrCLIClient, string, error) {
+	registryName, err := p.GetRegistryName()
+	if err != nil {
+		return nil, "", err
+	}
+	loginURL := api.LoginURL(registryName)
+	acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, p.username, p.password, p.configs)
+	if err != nil {
+		return nil, "", err
+	}
+	return acrClient, loginURL, nil
+}
+
+// sbomMediaType returns the media type of an SBOM of the type flag, spdx and cyclonedx are shorthands for their JSON
+// media types. Without a type the SPDX and CycloneDX JSON documents are detected from their content.
+func sbomMediaType(sbomType string, content []byte) (string, error) {
+	switch strings.ToLower(sbomType) {
+	case "spdx":
+		return spdxContentType, nil
+	case "cyclonedx":
+		return cyclonedxContentType, nil
+	case "":
+		var document struct {
+			SpdxVersion string `json:"spdxVersion"`
+			BomFormat   string `json:"bomFormat"`
+		}
+		if err := json.Unmarshal(content, &document); err == nil {
+			switch {
+			case len(document.SpdxVersion) > 0:
+				return spdxContentType, nil
+			case document.BomFormat == "CycloneDX":
+				return cyclonedxContentType, nil
+			}
+		}
+		return "", errors.New("the SBOM is neither an SPDX nor a CycloneDX JSON document, use the type flag to set its media type")
+	}
+	if !strings.Contains(sbomType, "/") {
+		return "", fmt.Errorf("invalid SBOM type %q, expected spdx, cyclonedx or a media type", sbomType)
+	}
+	return sbomType, nil
+}
+
+// attachSbom pushes the SBOM as an artifact whose subject is the referenced image. The SBOM is uploaded in chunks if
+// the client can, and skipped if the repository already has it.
+func attachSbom(ctx context.Context, out io.Writer, acrClient api.AcrCLIClientInterface, loginURL string, reference string, title string, mediaType string, content []byte, chunkSize int, created time.Time) error {
+	repoName, ref, _, err := parseReference(reference)
+	if err != nil {
+		return err
+	}
+	subjectBytes, err := acrClient.GetManifest(ctx, repoName, ref)
+	if err != nil {
+		return fmt.Errorf("failed to get manifest %s: %w", reference, err)
+	}
+	subjectMediaType, err := manifestMediaType(subjectBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse manifest %s: %w", reference, err)
+	}
+	subjectDigest := computeDigest(subjectBytes)
+	config := sbomDescriptor{MediaType: ociEmptyContentType, Digest: computeDigest(ociEmptyConfig), Size: int64(len(ociEmptyConfig))}
+	if err := acrClient.PutBlob(ctx, repoName, config.Digest, ociEmptyConfig); err != nil {
+		return fmt.Errorf("failed to push the config of the SBOM to %s: %w", repoName, err)
+	}
+	layer := sbomDescriptor{MediaType: mediaType, Digest: computeDigest(content), Size: int64(len(content)), Annotations: map[string]string{annotationTitle: title}}
+	if err := pushSbomBlob(ctx, acrClient, repoName, layer.Digest, content, chunkSize); err != nil {
+		return fmt.Errorf("failed to push the SBOM to %s: %w", repoName, err)
+	}
+	manifestBytes, err := json.Marshal(sbomManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestContentType,
+		ArtifactType:  mediaType,
+		Config:        config,
+		Layers:        []sbomDescriptor{layer},
+		Subject:       &sbomDescriptor{MediaType: subjectMediaType, Digest: subjectDigest, Size: int64(len(subjectBytes))},
+		Annotations:   map[string]string{annotationCreated: created.UTC().Format(time.RFC3339Nano)},
+	})
+	if err != nil {
+		return err
+	}
+	digest := computeDigest(manifestBytes)
+	if _, err := acrClient.PutManifest(ctx, repoName, digest, ociManifestContentType, manifestBytes); err != nil {
+		return fmt.Errorf("failed to push the SBOM artifact to %s: %w", repoName, err)
+	}
+	fmt.Fprintf(out, "Attached %s (%s) to %s/%s@%s as %s/%s@%s\n", title, mediaType, loginURL, repoName, subjectDigest, loginURL, repoName, digest)
+	return nil
+}
+
+// pushSbomBlob uploads the SBOM with the blob upload sessions of the client, or with a single request if it does not
+// have them.
+func pushSbomBlob(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digest string, content []byte, chunkSize int) error {
+	uploader, ok := acrClient.(api.BlobUploader)
+	if !ok {
+		return acrClient.PutBlob(ctx, repoName, digest, content)
+	}
+	if _, exists, err := uploader.HeadBlob(ctx, repoName, digest); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+	_, err := api.UploadBlob(ctx, uploader, repoName, digest, bytes.NewReader(content), int64(len(content)), chunkSize, nil)
+	return err
+}
+
+// downloadSbom returns the content of the latest SBOM of one of the artifact types attached to the referenced image,
+// the SBOMs are ordered by their created annotation.
+func downloadSbom(ctx context.Context, acrClient api.AcrCLIClientInterface, reference string, artifactTypes []string) ([]byte, error) {
+	repoName, ref, isDigest, err := parseReference(reference)
+	if err != nil {
+		return nil, err
+	}
+	subjectDigest := ref
+	if !isDigest {
+		subjectBytes, err := acrClient.GetManifest(ctx, repoName, ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get manifest %s: %w", reference, err)
+		}
+		subjectDigest = computeDigest(subjectBytes)
+	}
+	referrers, err := getReferrers(ctx, acrClient, repoName, subjectDigest)
+	if err != nil {
+		return nil, err
+	}
+	var latest *sbomManifest
+	var latestCreated time.Time
+	for _, referrer := range referrers {
+		if !isSbomType(artifactTypes, referrer.ArtifactType) {
+			continue
+		}
+		manifestBytes, err := acrClient.GetManifest(ctx, repoName, referrer.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the SBOM artifact %s: %w", referrer.Digest, err)
+		}
+		var m sbomManifest
+		if err := json.Unmarshal(manifestBytes, &m); err != nil {
+			return nil, fmt.Errorf("failed to parse the SBOM artifact %s: %w", referrer.Digest, err)
+		}
+		if len(m.Layers) == 0 {
+			continue
+		}
+		// An SBOM without a valid created annotation is older than all the others.
+		created, _ := time.Parse(time.RFC3339Nano, m.Annotations[annotationCreated])
+		if latest == nil || created.After(latestCreated) {
+			latest, latestCreated = &m, created
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("%s: %w", reference, errNoSbom)
+	}
+	layer := latest.Layers[0]
+	content, err := acrClient.GetBlob(ctx, repoName, layer.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the SBOM %s: %w", layer.Digest, err)
+	}
+	if computeDigest(content) != layer.Digest {
+		return nil, fmt.Errorf("the content of the SBOM does not match its digest %s", layer.Digest)
+	}
+	return content, nil
+}
+
+// isSbomType returns true if the artifact type is one of the types of SBOMs looked for.
+func isSbomType(artifactTypes []string, artifactType string) bool {
+	for _, t := range artifactTypes {
+		if t == artifactType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/fakeacr"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSbomMediaType contains the tests for the detection of the type of the SBOMs.
+func TestSbomMediaType(t *testing.T) {
+	// First test, the SPDX and CycloneDX JSON documents are detected from their content.
+	t.Run("DetectTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mediaType, err := sbomMediaType("", []byte(`{"spdxVersion":"SPDX-2.3","name":"app"}`))
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(spdxContentType, mediaType)
+		mediaType, err = sbomMediaType("", []byte(`{"bomFormat":"CycloneDX","specVersion":"1.5"}`))
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(cyclonedxContentType, mediaType)
+		_, err = sbomMediaType("", []byte(`<bom/>`))
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+	// Second test, the type flag takes precedence over the content.
+	t.Run("TypeTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mediaType, err := sbomMediaType("CycloneDX", []byte(`{"spdxVersion":"SPDX-2.3"}`))
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(cyclonedxContentType, mediaType)
+		mediaType, err = sbomMediaType("application/vnd.cyclonedx+xml", []byte(`<bom/>`))
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("application/vnd.cyclonedx+xml", mediaType)
+		_, err = sbomMediaType("syft", nil)
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+}
+
+// TestSbomAttachDownload contains the tests for the SBOMs attached to an image and downloaded again.
+func TestSbomAttachDownload(t *testing.T) {
+	registry := fakeacr.NewRegistry("user", "password")
+	defer registry.Close()
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), "user", "password", nil)
+	assert.Equal(t, nil, err, "Error should be nil")
+	acrClient.AutorestClient.Sender = registry.HTTPClient()
+	now := time.Now().UTC()
+	digest := registry.PushImage(testRepo, "latest", now)
+	registry.PushImage(testRepo, "other", now)
+	spdx := []byte(`{"spdxVersion":"SPDX-2.3","name":"v1"}`)
+	newerSpdx := []byte(`{"spdxVersion":"SPDX-2.3","name":"v2"}`)
+	cyclonedx := []byte(`{"bomFormat":"CycloneDX","specVersion":"1.5"}`)
+	// First test, the SBOM is an untagged referrer of the image.
+	t.Run("AttachTest", func(t *testing.T) {
+		assert := assert.New(t)
+		manifests := len(registry.Manifests(testRepo))
+		var out bytes.Buffer
+		err := attachSbom(testCtx, &out, acrClient, registry.LoginURL(), testRepo+":latest", "sbom.spdx.json", spdxContentType, spdx, 16, now.Add(-time.Hour))
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Contains(out.String(), "Attached sbom.spdx.json (application/spdx+json) to "+registry.LoginURL()+"/"+testRepo+"@"+digest)
+		assert.Equal([]string{"latest", "other"}, registry.Tags(testRepo))
+		assert.Equal(manifests+1, len(registry.Manifests(testRepo)))
+		referrers, err := getReferrers(testCtx, acrClient, testRepo, digest)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, len(referrers))
+		assert.Equal(spdxContentType, referrers[0].ArtifactType)
+		blob, ok := registry.Blob(computeDigest(spdx))
+		assert.True(ok)
+		assert.Equal(spdx, blob)
+	})
+	// Second test, the latest SBOM of the types looked for is downloaded.
+	t.Run("DownloadTest", func(t *testing.T) {
+		assert := assert.New(t)
+		var out bytes.Buffer
+		err := attachSbom(testCtx, &out, acrClient, registry.LoginURL(), testRepo+"@"+digest, "sbom.cdx.json", cyclonedxContentType, cyclonedx, 0, now)
+		assert.Equal(nil, err, "Error should be nil")
+		err = attachSbom(testCtx, &out, acrClient, registry.LoginURL(), testRepo+":latest", "sbom.spdx.json", spdxContentType, newerSpdx, 0, now.Add(-time.Minute))
+		assert.Equal(nil, err, "Error should be nil")
+		content, err := downloadSbom(testCtx, acrClient, testRepo+":latest", []string{spdxContentType, cyclonedxContentType})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(cyclonedx, content)
+		content, err = downloadSbom(testCtx, acrClient, testRepo+"@"+digest, []string{spdxContentType})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(newerSpdx, content)
+	})
+	// Third test, an image without SBOM returns errNoSbom.
+	t.Run("NoSbomTest", func(t *testing.T) {
+		assert := assert.New(t)
+		_, err := downloadSbom(testCtx, acrClient, testRepo+":other", []string{spdxContentType})
+		assert.True(errors.Is(err, errNoSbom))
+		_, err = downloadSbom(testCtx, acrClient, testRepo+":latest", []string{"application/vnd.cyclonedx+xml"})
+		assert.True(errors.Is(err, errNoSbom))
+	})
+}
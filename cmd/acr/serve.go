@@ -0,0 +1,121 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/Azure/acr-cli/cmd/server"
+	"github.com/spf13/cobra"
+)
+
+// shutdownTimeout is the time the server waits for the requests in flight when it stops.
+const shutdownTimeout = 30 * time.Second
+
+const (
+	newServeCmdLongMessage = `acr serve: expose the purge planner and executor of a registry through an HTTP API.
+A purge policy is submitted as a job, the server plans it without deleting anything and the plan has to be approved
+before the tags and manifests are deleted. The API contains the following endpoints:
+  POST /jobs                submit a policy, e.g. {"filters": ["hello-world:.*"], "ago": "7d", "untagged": true}
+  GET  /jobs                list all the jobs
+  GET  /jobs/{id}           get the status and progress of a job
+  GET  /jobs/{id}/plan      get the tags and manifests a planned job would delete
+  POST /jobs/{id}/approve   delete everything the plan of the job contains
+Like with the purge command, the tags and manifests updated in the last hour are never planned. When a job is approved
+its policy is planned again and only the tags and manifests of the approved plan that still reference the same digest
+and were not updated since are deleted, the plans older than the --plan-ttl flag cannot be approved.
+Every request has to send the token of the server in an "Authorization: Bearer <token>" header, the token is set with
+the --token flag or the ACR_SERVE_TOKEN environment variable. The server listens on the loopback interface unless
+another address is set. Jobs are only kept in memory, they are lost when the server stops, and the finished jobs are
+evicted once they are older than the --plan-ttl flag. On SIGINT or SIGTERM the server stops accepting requests and
+the running jobs stop after the block of tags and manifests being deleted.`
+	serveExampleMessage = `  - Serve the purge API of the example.azurecr.io registry on port 8080 of the loopback interface
+    ACR_SERVE_TOKEN=<token> acr serve -r example
+
+  - Serve the purge API of the example.azurecr.io registry on port 9090 of every interface
+    acr serve -r example --address :9090 --token <token>
+`
+)
+
+// serveParameters defines the parameters used by the serve command.
+type serveParameters struct {
+	*rootParameters
+	address string
+	token   string
+	planTTL time.Duration
+}
+
+// newServeCmd defines the serve command.
+func newServeCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	serveParams := serveParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "serve",
+		Short:   "Serve the purge API over HTTP",
+		Long:    newServeCmdLongMessage,
+		Example: serveExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token := serveParams.token
+			if len(token) == 0 {
+				token = os.Getenv("ACR_SERVE_TOKEN")
+			}
+			if len(token) == 0 {
+				return errors.New("a token is required, set it with --token or ACR_SERVE_TOKEN")
+			}
+			registryName, err := serveParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, serveParams.username, serveParams.password, serveParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			s, err := server.New(ctx, acrClient, loginURL, token)
+			if err != nil {
+				return err
+			}
+			s.SetPlanTTL(serveParams.planTTL)
+			purge.StartDispatcher(ctx, acrClient, defaultNumWorkers)
+			defer purge.StopDispatcher()
+			httpServer := &http.Server{Addr: serveParams.address, Handler: s}
+			stop := make(chan os.Signal, 1)
+			signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(stop)
+			serveErr := make(chan error, 1)
+			go func() {
+				serveErr <- httpServer.ListenAndServe()
+			}()
+			fmt.Fprintf(out, "Serving the purge API of %s on %s\n", loginURL, serveParams.address)
+			select {
+			case err = <-serveErr:
+			case <-stop:
+				fmt.Fprintln(out, "Stopping the server")
+				shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+				err = httpServer.Shutdown(shutdownCtx)
+				cancelShutdown()
+			}
+			// The running jobs are stopped before the dispatcher so that no deletion is cut in the middle.
+			cancel()
+			s.Wait()
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&serveParams.address, "address", "127.0.0.1:8080", "The address the HTTP server listens on")
+	cmd.Flags().StringVar(&serveParams.token, "token", "", "The bearer token the requests have to send, it can also be set with the ACR_SERVE_TOKEN environment variable")
+	cmd.Flags().DurationVar(&serveParams.planTTL, "plan-ttl", server.DefaultPlanTTL, "The time a plan can be approved for once it is created, older plans have to be submitted again")
+	return cmd
+}
@@ -0,0 +1,53 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// registrySKU returns the SKU of the sku flag or, if the resource group of the registry is known, the SKU read through
+// Azure Resource Manager. It is empty if the SKU is not known, a SKU that cannot be read is only a warning.
+func (purgeParams *purgeParameters) registrySKU(ctx context.Context, warnings io.Writer) (string, error) {
+	if len(purgeParams.sku) > 0 {
+		return api.ParseSKU(purgeParams.sku)
+	}
+	if len(purgeParams.resourceGroup) == 0 {
+		return "", nil
+	}
+	managementClient, err := newManagementClient(purgeParams.rootParameters, purgeParams.subscription, purgeParams.resourceGroup)
+	if err == nil {
+		var registry *api.RegistryResource
+		if registry, err = managementClient.GetRegistry(ctx); err == nil {
+			if sku, err := api.ParseSKU(registry.SKU.Name); err == nil {
+				return sku, nil
+			}
+			fmt.Fprintf(warnings, "Warning: the limits of the %s SKU of the registry are not known, the default concurrency is used\n", registry.SKU.Name)
+			return "", nil
+		}
+	}
+	fmt.Fprintf(warnings, "Warning: unable to read the SKU of the registry, the default concurrency is used: %v\n", err)
+	return "", nil
+}
+
+// skuConcurrency returns the number of workers of a purge of a registry of the SKU, the default one of the SKU unless
+// the concurrency flag was set. A concurrency the SKU is not likely to serve without throttling is kept with a
+// warning, 0 (the automatic concurrency) is bounded by the workers instead.
+func skuConcurrency(warnings io.Writer, sku string, numWorkers int, changed bool) int {
+	limits, ok := api.LimitsOf(sku)
+	if !ok || numWorkers == 0 {
+		return numWorkers
+	}
+	if !changed {
+		return limits.Concurrency
+	}
+	if numWorkers > limits.MaxConcurrency {
+		fmt.Fprintf(warnings, "Warning: a concurrency of %d is likely to exceed the %d write operations per minute of a %s registry and be throttled, %d or less is recommended\n", numWorkers, limits.WriteOpsPerMinute, sku, limits.MaxConcurrency)
+	}
+	return numWorkers
+}
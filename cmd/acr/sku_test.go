@@ -0,0 +1,51 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSKUConcurrency contains the tests for the concurrency of the purges of the registries of a known SKU.
+func TestSKUConcurrency(t *testing.T) {
+	// First test, without the concurrency flag the default concurrency of the SKU is used.
+	t.Run("DefaultTest", func(t *testing.T) {
+		assert := assert.New(t)
+		warnings := &bytes.Buffer{}
+		assert.Equal(2, skuConcurrency(warnings, api.SKUBasic, defaultNumWorkers, false))
+		assert.Equal(16, skuConcurrency(warnings, api.SKUPremium, defaultNumWorkers, false))
+		assert.Equal(defaultNumWorkers, skuConcurrency(warnings, "", defaultNumWorkers, false))
+		assert.Equal("", warnings.String())
+	})
+	// Second test, a concurrency over the limits of the SKU is kept with a warning.
+	t.Run("WarningTest", func(t *testing.T) {
+		assert := assert.New(t)
+		warnings := &bytes.Buffer{}
+		assert.Equal(20, skuConcurrency(warnings, api.SKUStandard, 20, true))
+		assert.Contains(warnings.String(), "a concurrency of 20 is likely to exceed the 500 write operations per minute of a Standard registry")
+		warnings.Reset()
+		assert.Equal(20, skuConcurrency(warnings, api.SKUPremium, 20, true))
+		assert.Equal(0, skuConcurrency(warnings, api.SKUBasic, 0, true))
+		assert.Equal("", warnings.String())
+	})
+	// Third test, the sku flag is parsed without reading the registry.
+	t.Run("FlagTest", func(t *testing.T) {
+		assert := assert.New(t)
+		purgeParams := purgeParameters{sku: "premium", resourceGroup: "rg"}
+		sku, err := purgeParams.registrySKU(context.Background(), &bytes.Buffer{})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(api.SKUPremium, sku)
+		purgeParams.sku = "gold"
+		_, err = purgeParams.registrySKU(context.Background(), &bytes.Buffer{})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		sku, err = (&purgeParameters{}).registrySKU(context.Background(), &bytes.Buffer{})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("", sku)
+	})
+}
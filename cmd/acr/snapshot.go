@@ -0,0 +1,69 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newSnapshotCmdLongMessage = `acr snapshot: download the tag and manifest metadata of a set of repositories into a local file.
+The file can later be used with acr purge --dry-run --from-snapshot to evaluate filters without querying the registry.`
+	snapshotExampleMessage = `  - Store the metadata of the hello-world and nginx repositories of the example.azurecr.io registry in snap.db
+    acr snapshot -r example --repository hello-world --repository nginx --out snap.db
+
+  - Evaluate a purge filter against the stored metadata
+    acr purge --filter "hello-world:.*" --ago 7d --untagged --dry-run --from-snapshot snap.db
+`
+)
+
+// snapshotParameters defines the parameters used by the snapshot command.
+type snapshotParameters struct {
+	*rootParameters
+	repoNames []string
+	out       string
+}
+
+// newSnapshotCmd defines the snapshot command.
+func newSnapshotCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	snapshotParams := snapshotParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "snapshot",
+		Short:   "Store registry metadata in a local file",
+		Long:    newSnapshotCmdLongMessage,
+		Example: snapshotExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registryName, err := snapshotParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, snapshotParams.username, snapshotParams.password, snapshotParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			snapshot, err := api.TakeSnapshot(ctx, acrClient, loginURL, snapshotParams.repoNames)
+			if err != nil {
+				return err
+			}
+			if err := api.WriteSnapshot(snapshot, snapshotParams.out); err != nil {
+				return err
+			}
+			fmt.Printf("Snapshot of %d repositories written to %s\n", len(snapshot.Repositories), snapshotParams.out)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&snapshotParams.repoNames, "repository", nil, "The repositories that will be included in the snapshot")
+	cmd.Flags().StringVar(&snapshotParams.out, "out", "", "The path of the file where the snapshot will be written")
+	cmd.MarkFlagRequired("repository")
+	cmd.MarkFlagRequired("out")
+	return cmd
+}
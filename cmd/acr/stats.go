@@ -0,0 +1,293 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/Azure/acr-cli/pkg/acrapi"
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newStatsCmdLongMessage     = `acr stats: show statistics of the contents of a registry to tune the purge policies.`
+	newStatsTagsCmdLongMessage = `acr stats tags: show how many tags of a repository were last updated in every age bucket
+(less than 1 day, 1 to 7 days, 7 to 30 days, 30 to 90 days, 90 to 365 days and more than 365 days). The older column
+counts the tags at least as old as the lower bound of the bucket, the tags a purge with that ago value would consider.`
+	newStatsLayersCmdLongMessage = `acr stats layers: estimate the layer storage a purge would make garbage-collectable.
+The manifests the purge would delete with the untagged flag are the candidates, the manifests of every repository of
+the registry are read and the layers that only the candidates reference are reported, the layers that any other
+manifest references stay in the registry after the purge. Nothing is deleted, but every manifest of the registry is
+read once, which can take a while for big registries.`
+	statsExampleMessage = `  - Show the ages of the tags of the hello-world repository in the example.azurecr.io registry
+    acr stats tags -r example --repository hello-world
+
+  - Show the number of tags a purge with --ago 30d would consider
+    acr stats tags -r example --repository hello-world -o jsonpath='{.buckets[3].olderTags}'
+`
+	statsLayersExampleMessage = `  - Estimate the storage freed by deleting the tags of hello-world older than 30 days and their manifests
+    acr stats layers -r example --filter "hello-world:.*" --ago 30d
+
+  - Print only the number of bytes that would become garbage-collectable
+    acr stats layers -r example --filter "hello-world:.*" --ago 30d -o jsonpath='{.orphanedBytes}'
+`
+	// histogramWidth is the width of the bar of the bucket with the most tags.
+	histogramWidth = 40
+)
+
+// tagAgeBuckets are the lower bounds of the age buckets, in the format of the ago flag of the purge command.
+var tagAgeBuckets = []string{"0d", "1d", "7d", "30d", "90d", "365d"}
+
+// statsParameters defines the parameters used by the stats command.
+type statsParameters struct {
+	*rootParameters
+	repoName string
+	output   string
+	// filters, ago and before select the candidates of the stats layers command like in the purge command.
+	filters []string
+	ago     string
+	before  string
+}
+
+// tagAgeStats is the output of the stats tags command.
+type tagAgeStats struct {
+	Registry   string         `json:"registry"`
+	Repository string         `json:"repository"`
+	Total      int            `json:"total"`
+	Buckets    []tagAgeBucket `json:"buckets"`
+}
+
+// tagAgeBucket counts the tags last updated between MinAge and MaxAge ago, MaxAge is empty for the last bucket.
+// OlderTags counts the tags that are at least MinAge old.
+type tagAgeBucket struct {
+	MinAge    string `json:"minAge"`
+	MaxAge    string `json:"maxAge,omitempty"`
+	Tags      int    `json:"tags"`
+	OlderTags int    `json:"olderTags"`
+}
+
+// newStatsCmd defines the stats command.
+func newStatsCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	statsParams := statsParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show statistics to tune the purge policies",
+		Long:  newStatsCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Help()
+			return nil
+		},
+	}
+	cmd.AddCommand(newStatsTagsCmd(out, &statsParams), newStatsLayersCmd(out, &statsParams))
+	return cmd
+}
+
+// newStatsTagsCmd defines the stats tags subcommand.
+func newStatsTagsCmd(out io.Writer, statsParams *statsParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "tags",
+		Short:   "Show a histogram of the ages of the tags of a repository",
+		Long:    newStatsTagsCmdLongMessage,
+		Example: statsExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(statsParams.repoName) == 0 {
+				return errors.New(`required flag(s) "repository" not set`)
+			}
+			printer, err := newPrinter(statsParams.output)
+			if err != nil {
+				return err
+			}
+			registryName, err := statsParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, statsParams.username, statsParams.password, statsParams.configs)
+			if err != nil {
+				return err
+			}
+			stats, err := getTagAgeStats(context.Background(), acrClient, purge.SystemClock(), statsParams.repoName)
+			if err != nil {
+				return err
+			}
+			stats.Registry = loginURL
+			if printer != nil {
+				return printer.print(out, stats)
+			}
+			return printTagAgeStats(out, stats)
+		},
+	}
+	cmd.Flags().StringVar(&statsParams.repoName, "repository", "", "The repository name")
+	addOutputFlag(cmd, &statsParams.output)
+	return cmd
+}
+
+// newStatsLayersCmd defines the stats layers subcommand.
+func newStatsLayersCmd(out io.Writer, statsParams *statsParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "layers",
+		Short:   "Estimate the layer storage a purge would make garbage-collectable",
+		Long:    newStatsLayersCmdLongMessage,
+		Example: statsLayersExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(statsParams.ago) == 0 && len(statsParams.before) == 0 {
+				return errors.New("either the ago or the before flag is required")
+			}
+			printer, err := newPrinter(statsParams.output)
+			if err != nil {
+				return err
+			}
+			registryName, err := statsParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, statsParams.username, statsParams.password, statsParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			// Only the deleted manifests free their layers, so the untagged manifests are always part of the plan.
+			policy := purge.Policy{Filters: statsParams.filters, Ago: statsParams.ago, Before: statsParams.before, Untagged: true}
+			plan, err := purge.NewPlan(ctx, acrClient, purge.SystemClock(), loginURL, policy, purge.NewOptions())
+			if err != nil {
+				return err
+			}
+			estimate, err := purge.EstimateOrphanedLayers(ctx, acrClient, plan)
+			if err != nil {
+				return err
+			}
+			if printer != nil {
+				return printer.print(out, estimate)
+			}
+			return printLayerEstimate(out, estimate)
+		},
+	}
+	cmd.Flags().StringArrayVarP(&statsParams.filters, "filter", "f", nil, "Specify the repository and a regular expression filter for the tag name, like in the purge command")
+	cmd.Flags().StringVar(&statsParams.ago, "ago", "", "The tags last updated before this duration are candidates, in the format of the purge command")
+	cmd.Flags().StringVar(&statsParams.before, "before", "", "The tags last updated before this date or time are candidates, in the format of the purge command")
+	addOutputFlag(cmd, &statsParams.output)
+	cmd.MarkFlagRequired("filter")
+	return cmd
+}
+
+// getTagAgeStats lists the tags of a repository and counts them by the age of their last update.
+func getTagAgeStats(ctx context.Context, acrClient api.TagLister, clock purge.Clock, repoName string) (tagAgeStats, error) {
+	stats := tagAgeStats{Repository: repoName}
+	buckets, bounds, err := newTagAgeBuckets(clock)
+	if err != nil {
+		return stats, err
+	}
+	stats.Buckets = buckets
+	tags := acrapi.NewTagIterator(acrClient, repoName, "")
+	for tags.Next(ctx) {
+		tag := tags.Tag()
+		lastUpdateTime, err := time.Parse(time.RFC3339Nano, *tag.LastUpdateTime)
+		if err != nil {
+			return stats, fmt.Errorf("invalid last update time of %s:%s: %w", repoName, *tag.Name, err)
+		}
+		stats.Buckets[tagAgeBucketIndex(bounds, lastUpdateTime)].Tags++
+		stats.Total++
+	}
+	if err := tags.Err(); err != nil {
+		return stats, fmt.Errorf("failed to list tags: %w", err)
+	}
+	countOlderTags(stats.Buckets)
+	return stats, nil
+}
+
+// newTagAgeBuckets returns the empty age buckets and the time of the lower bound of every bucket.
+func newTagAgeBuckets(clock purge.Clock) ([]tagAgeBucket, []time.Time, error) {
+	buckets := []tagAgeBucket{}
+	bounds := []time.Time{}
+	for i, minAge := range tagAgeBuckets {
+		bound, err := purge.Cutoff{Ago: minAge}.Time(clock)
+		if err != nil {
+			return nil, nil, err
+		}
+		bounds = append(bounds, bound)
+		bucket := tagAgeBucket{MinAge: minAge}
+		if i+1 < len(tagAgeBuckets) {
+			bucket.MaxAge = tagAgeBuckets[i+1]
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, bounds, nil
+}
+
+// tagAgeBucketIndex returns the bucket of a tag. The bounds go back in time, the tag belongs to the oldest bucket whose
+// lower bound it is older than, like the purge only considers the tags updated before the cutoff.
+func tagAgeBucketIndex(bounds []time.Time, lastUpdateTime time.Time) int {
+	for i := len(bounds) - 1; i > 0; i-- {
+		if lastUpdateTime.Before(bounds[i]) {
+			return i
+		}
+	}
+	return 0
+}
+
+// countOlderTags sets the number of tags at least as old as the lower bound of every bucket.
+func countOlderTags(buckets []tagAgeBucket) {
+	older := 0
+	for i := len(buckets) - 1; i >= 0; i-- {
+		older += buckets[i].Tags
+		buckets[i].OlderTags = older
+	}
+}
+
+// printTagAgeStats writes the buckets as a table with a bar proportional to the number of tags of every bucket.
+func printTagAgeStats(out io.Writer, stats tagAgeStats) error {
+	fmt.Fprintf(out, "Ages of the %d tags of the %q repository:\n", stats.Total, stats.Repository)
+	return printTagAgeBuckets(out, stats.Buckets)
+}
+
+// printTagAgeBuckets writes the buckets as a table with a bar proportional to the number of tags of every bucket.
+func printTagAgeBuckets(out io.Writer, buckets []tagAgeBucket) error {
+	most := 0
+	for _, bucket := range buckets {
+		if bucket.Tags > most {
+			most = bucket.Tags
+		}
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AGE\tTAGS\tOLDER\tHISTOGRAM")
+	for _, bucket := range buckets {
+		age := bucket.MinAge + "+"
+		if len(bucket.MaxAge) > 0 {
+			age = bucket.MinAge + "-" + bucket.MaxAge
+		}
+		bar := ""
+		if most > 0 {
+			bar = strings.Repeat("#", (bucket.Tags*histogramWidth+most-1)/most)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", age, bucket.Tags, bucket.OlderTags, bar)
+	}
+	return w.Flush()
+}
+
+// printLayerEstimate writes the totals of the estimate followed by a table of the repositories.
+func printLayerEstimate(out io.Writer, estimate *purge.LayerEstimate) error {
+	fmt.Fprintf(out, "Candidate manifests: %d\n", estimate.CandidateManifests)
+	fmt.Fprintf(out, "Layers referenced by the candidates: %d (%s)\n", estimate.CandidateLayers, units.HumanSize(float64(estimate.CandidateBytes)))
+	fmt.Fprintf(out, "Layers only referenced by the candidates: %d (%s)\n", estimate.OrphanedLayers, units.HumanSize(float64(estimate.OrphanedBytes)))
+	fmt.Fprintf(out, "Manifests read: %d\n", estimate.ScannedManifests)
+	if len(estimate.Repositories) == 0 {
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tCANDIDATES\tORPHANED LAYERS\tORPHANED SIZE")
+	for _, repo := range estimate.Repositories {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", repo.Name, repo.CandidateManifests, repo.OrphanedLayers, units.HumanSize(float64(repo.OrphanedBytes)))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,89 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTagAgeStats(t *testing.T) {
+	now := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	clock := purge.FixedClock(now)
+	// First test, the tags are counted in the bucket of their age and the older tags are accumulated.
+	t.Run("HistogramTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		ages := map[string]time.Duration{
+			"hour":      time.Hour,
+			"week":      7*24*time.Hour + time.Minute,
+			"month":     40 * 24 * time.Hour,
+			"quarter":   100 * 24 * time.Hour,
+			"two-years": 730 * 24 * time.Hour,
+		}
+		tags := []acr.TagAttributesBase{}
+		for _, name := range []string{"hour", "month", "quarter", "two-years", "week"} {
+			tagName := name
+			lastUpdateTime := now.Add(-ages[name]).Format(time.RFC3339Nano)
+			tags = append(tags, acr.TagAttributesBase{Name: &tagName, Digest: &digest, LastUpdateTime: &lastUpdateTime})
+		}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(&acr.RepositoryTagsType{TagsAttributes: &tags}, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "week").Return(EmptyListTagsResult, nil).Once()
+		stats, err := getTagAgeStats(testCtx, mockClient, clock, testRepo)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(5, stats.Total)
+		counts := []int{}
+		older := []int{}
+		for _, bucket := range stats.Buckets {
+			counts = append(counts, bucket.Tags)
+			older = append(older, bucket.OlderTags)
+		}
+		assert.Equal([]int{1, 0, 1, 1, 1, 1}, counts)
+		assert.Equal([]int{5, 4, 4, 3, 2, 1}, older)
+		assert.Equal("365d", stats.Buckets[5].MinAge)
+		assert.Equal("", stats.Buckets[5].MaxAge)
+		out := &bytes.Buffer{}
+		assert.Equal(nil, printTagAgeStats(out, stats))
+		assert.Contains(out.String(), "30d-90d")
+		assert.Contains(out.String(), "365d+")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, if the tags cannot be listed an error should be returned.
+	t.Run("ListTagsErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(nil, errors.New("unauthorized")).Once()
+		_, err := getTagAgeStats(testCtx, mockClient, clock, testRepo)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestPrintLayerEstimate(t *testing.T) {
+	// First test, the totals are printed followed by the table of the repositories.
+	t.Run("TableTest", func(t *testing.T) {
+		assert := assert.New(t)
+		estimate := &purge.LayerEstimate{
+			CandidateManifests: 2,
+			CandidateLayers:    3,
+			CandidateBytes:     3000,
+			OrphanedLayers:     1,
+			OrphanedBytes:      2000,
+			ScannedManifests:   5,
+			Repositories:       []purge.RepositoryLayerEstimate{{Name: testRepo, CandidateManifests: 2, OrphanedLayers: 1, OrphanedBytes: 2000}},
+		}
+		out := &bytes.Buffer{}
+		assert.Equal(nil, printLayerEstimate(out, estimate))
+		assert.Contains(out.String(), "Layers only referenced by the candidates: 1 (2kB)")
+		assert.Contains(out.String(), "ORPHANED SIZE")
+		assert.Contains(out.String(), testRepo)
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// The colors of the table rows, they are ANSI escape sequences.
+const (
+	colorNone  = ""
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorBold  = "\x1b[1m"
+	colorReset = "\x1b[0m"
+)
+
+// table renders rows aligned in columns, a row can be colored as a whole. Contrary to a tabwriter the width of the
+// columns is computed without the escape sequences of the colors.
+type table struct {
+	headers []string
+	rows    []tableRow
+	indent  string
+}
+
+// tableRow is a row of a table and its color.
+type tableRow struct {
+	cells []string
+	color string
+}
+
+// newTable creates a table with the headers, the columns are as wide as their widest cell.
+func newTable(indent string, headers ...string) *table {
+	return &table{headers: headers, indent: indent}
+}
+
+// addRow adds a row, a missing cell is empty.
+func (t *table) addRow(color string, cells ...string) {
+	t.rows = append(t.rows, tableRow{cells: cells, color: color})
+}
+
+// render writes the headers and the rows, the colors are only written if colored is set.
+func (t *table) render(out io.Writer, colored bool) error {
+	widths := make([]int, len(t.headers))
+	for i, header := range t.headers {
+		widths[i] = utf8.RuneCountInString(header)
+	}
+	for _, row := range t.rows {
+		for i := 0; i < len(row.cells) && i < len(widths); i++ {
+			if width := utf8.RuneCountInString(row.cells[i]); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+	if err := t.renderRow(out, tableRow{cells: t.headers, color: colorBold}, widths, colored); err != nil {
+		return err
+	}
+	for _, row := range t.rows {
+		if err := t.renderRow(out, row, widths, colored); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderRow writes a row with every cell padded to the width of its column, the last column is not padded.
+func (t *table) renderRow(out io.Writer, row tableRow, widths []int, colored bool) error {
+	cells := make([]string, len(widths))
+	for i := range widths {
+		cell := ""
+		if i < len(row.cells) {
+			cell = row.cells[i]
+		}
+		if i < len(widths)-1 {
+			cell += strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		}
+		cells[i] = cell
+	}
+	line := strings.TrimRight(strings.Join(cells, "  "), " ")
+	if colored && len(row.color) > 0 {
+		line = row.color + line + colorReset
+	}
+	_, err := fmt.Fprintf(out, "%s%s\n", t.indent, line)
+	return err
+}
+
+// useColor returns true if the output is a terminal and the NO_COLOR environment variable (https://no-color.org) is
+// not set.
+func useColor(out io.Writer) bool {
+	if len(os.Getenv("NO_COLOR")) > 0 || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -5,24 +5,46 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 
+	"github.com/Azure/acr-cli/acr"
 	"github.com/Azure/acr-cli/cmd/api"
-	"github.com/pkg/errors"
+	"github.com/Azure/acr-cli/cmd/purge"
 	"github.com/spf13/cobra"
 )
 
 const (
-	newTagCmdLongMessage       = `acr tag: list tags and untag them individually.`
-	newTagListCmdLongMessage   = `acr tag list: outputs all the tags that are inside a given repository`
-	newTagDeleteCmdLongMessage = `acr tag delete: delete a set of tags inside the specified repository`
+	newTagCmdLongMessage     = `acr tag: list tags and untag them individually.`
+	newTagListCmdLongMessage = `acr tag list: outputs all the tags that are inside a given repository. The show flag adds columns
+with the time every tag was created, whether its image is signed with Notation or cosign (found with the referrers
+API) and the quarantine state of its image, to review what matters for the retention of the tags in one place.`
+	newTagDeleteCmdLongMessage  = `acr tag delete: delete a set of tags inside the specified repository`
+	newTagResolveCmdLongMessage = `acr tag resolve: list the tags that reference a digest, or the digest of a tag and all the tags that
+reference the same digest. Useful to know which tags go away before deleting a manifest.`
+	tagResolveExampleMessage = `  - List the tags that reference a digest
+    acr tag resolve -r MyRegistry hello-world@sha256:<digest>
+
+  - List the digest of a tag and the other tags that reference it
+    acr tag resolve -r MyRegistry hello-world:latest`
 )
 
 // Besides the registry name and authentication information only the repository is needed.
 type tagParameters struct {
 	*rootParameters
 	repoName string
+	output   string
+}
+
+// checkRepository returns an error if the repository flag was not specified.
+func (tagParams *tagParameters) checkRepository() error {
+	if len(tagParams.repoName) == 0 {
+		return errors.New(`required flag(s) "repository" not set`)
+	}
+	return nil
 }
 
 // The tag command can be used to either list tags or delete tags inside a repository.
@@ -41,14 +63,16 @@ func newTagCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
 
 	listTagCmd := newTagListCmd(out, &tagParams)
 	deleteTagCmd := newTagDeleteCmd(out, &tagParams)
+	resolveTagCmd := newTagResolveCmd(out, &tagParams)
 
 	cmd.AddCommand(
 		listTagCmd,
 		deleteTagCmd,
+		resolveTagCmd,
 	)
+	// The repository is needed by the list and delete subcommands, they check that it was specified because the
+	// resolve subcommand receives the repository as part of its arguments.
 	cmd.PersistentFlags().StringVar(&tagParams.repoName, "repository", "", "The repository name")
-	// Since the repository will be needed in either subcommand it is marked as a required flag
-	cmd.MarkPersistentFlagRequired("repository")
 
 	return cmd
 }
@@ -56,11 +80,24 @@ func newTagCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
 // newTagListCmd creates tag list command, it does not need any aditional parameters.
 // The registry interaction is done through the listTags method
 func newTagListCmd(out io.Writer, tagParams *tagParameters) *cobra.Command {
+	options := listOptions{}
+	var show []string
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List tags from a repository",
 		Long:  newTagListCmdLongMessage,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := tagParams.checkRepository(); err != nil {
+				return err
+			}
+			printer, err := newPrinter(tagParams.output)
+			if err != nil {
+				return err
+			}
+			columns, err := parseTagColumns(show)
+			if err != nil {
+				return err
+			}
 			registryName, err := tagParams.GetRegistryName()
 			if err != nil {
 				return err
@@ -72,44 +109,223 @@ func newTagListCmd(out io.Writer, tagParams *tagParameters) *cobra.Command {
 				return err
 			}
 			ctx := context.Background()
-			err = listTags(ctx, acrClient, loginURL, tagParams.repoName)
+			err = listTags(ctx, out, acrClient, loginURL, tagParams.repoName, options, columns, printer)
 			if err != nil {
 				return err
 			}
 			return nil
 		},
 	}
+	addOutputFlag(cmd, &tagParams.output)
+	addListFlags(cmd, &options)
+	cmd.Flags().StringSliceVar(&show, "show", nil, "Extra columns to show, any of created, signed (resolved with the referrers of every tag) and quarantine (resolved from the manifests of the repository)")
 	return cmd
 }
 
-// listTagss will do the http requests and print the digest of all the tags in the selected repository.
-func listTags(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string) error {
-	lastTag := ""
-	resultTags, err := acrClient.GetAcrTags(ctx, repoName, "", lastTag)
+// The columns of the show flag of the tag list command.
+const (
+	tagColumnCreated    = "created"
+	tagColumnSigned     = "signed"
+	tagColumnQuarantine = "quarantine"
+)
+
+// tagColumns are the extra columns of the tag list command, in the order of the show flag.
+type tagColumns []string
+
+// parseTagColumns validates the values of the show flag.
+func parseTagColumns(show []string) (tagColumns, error) {
+	columns := tagColumns{}
+	for _, column := range show {
+		column = strings.ToLower(strings.TrimSpace(column))
+		switch column {
+		case tagColumnCreated, tagColumnSigned, tagColumnQuarantine:
+			if !columns.has(column) {
+				columns = append(columns, column)
+			}
+		default:
+			return nil, fmt.Errorf("invalid column %q, supported values are %s, %s and %s", column, tagColumnCreated, tagColumnSigned, tagColumnQuarantine)
+		}
+	}
+	return columns, nil
+}
+
+// has returns true if the column is shown.
+func (columns tagColumns) has(column string) bool {
+	for _, c := range columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// tagList is the output of the tag list command when an output format is selected.
+type tagList struct {
+	Registry   string      `json:"registry"`
+	Repository string      `json:"repository"`
+	Tags       []listedTag `json:"tags"`
+}
+
+// listedTag is a tag of the tag list command. With the signed column Signed is whether a Notation or cosign signature
+// refers to the image, with the quarantine column QuarantineState is the state of the image if it has one.
+type listedTag struct {
+	acr.TagAttributesBase
+	QuarantineState string `json:"quarantineState,omitempty"`
+}
+
+// listTagss will do the http requests and print the digest of all the tags in the selected repository, in the order
+// of the options and up to their limit. If a printer is passed the tags are collected and printed with it instead.
+// With extra columns the tags are printed as a table once they are all listed, the signed and quarantine columns need
+// a client that can read the referrers and the manifests.
+func listTags(ctx context.Context, out io.Writer, acrClient api.TagLister, loginURL string, repoName string, options listOptions, columns tagColumns, printer *printer) error {
+	orderBy, err := options.apiOrderBy()
+	if err != nil {
+		return err
+	}
+	resolver, err := newTagAttributeResolver(ctx, acrClient, repoName, columns)
 	if err != nil {
-		return errors.Wrap(err, "failed to list tags")
+		return err
+	}
+	tagPager := api.NewTagPager(acrClient, repoName, orderBy)
+	resultTags, err := tagPager.Next(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list tags: %w", err)
 	}
 
-	fmt.Printf("Listing tags for the %q repository:\n", repoName)
-	// A for loop is used because the GetAcrTags method returns by default only 100 tags and their attributes.
+	list := tagList{Registry: loginURL, Repository: repoName, Tags: []listedTag{}}
+	if printer == nil {
+		fmt.Printf("Listing tags for the %q repository:\n", repoName)
+	}
+	listed := 0
+	// A for loop is used because the registry returns by default only 100 tags and their attributes in every page.
 	for resultTags != nil && resultTags.TagsAttributes != nil {
 		tags := *resultTags.TagsAttributes
 		for _, tag := range tags {
+			if options.reached(listed) {
+				break
+			}
+			listed++
+			if printer != nil || len(columns) > 0 {
+				entry, err := resolver.resolve(ctx, tag)
+				if err != nil {
+					return err
+				}
+				list.Tags = append(list.Tags, entry)
+				continue
+			}
 			tagName := *tag.Name
 			fmt.Printf("%s/%s:%s\n", loginURL, repoName, tagName)
 		}
-		// Since the GetAcrTags supports pagination when supplied with the last digest that was returned the last tag name
-		// digest is saved, the tag array contains at least one element because if it was empty the API would return
-		// a nil pointer instead of a pointer to a length 0 array.
-		lastTag = *tags[len(tags)-1].Name
-		resultTags, err = acrClient.GetAcrTags(ctx, repoName, "", lastTag)
+		// Once the limit is reached the next page is not requested.
+		if options.reached(listed) {
+			break
+		}
+		// The pager follows the next page link returned by the registry, once there are no more pages the
+		// TagsAttributes of the result are nil.
+		resultTags, err = tagPager.Next(ctx)
 		if err != nil {
 			return err
 		}
 	}
+	if printer != nil {
+		return printer.print(out, list)
+	}
+	if len(columns) > 0 {
+		return printTagTable(out, list, columns)
+	}
 	return nil
 }
 
+// tagAttributeResolver resolves the extended attributes of the tags for the columns of the show flag.
+type tagAttributeResolver struct {
+	acrClient  api.AcrCLIClientInterface
+	repoName   string
+	columns    tagColumns
+	quarantine map[string]string
+}
+
+// newTagAttributeResolver checks that the client can resolve the columns. The quarantine states are read from the
+// manifests of the repository, which are all listed once.
+func newTagAttributeResolver(ctx context.Context, acrClient api.TagLister, repoName string, columns tagColumns) (*tagAttributeResolver, error) {
+	resolver := &tagAttributeResolver{repoName: repoName, columns: columns}
+	if !columns.has(tagColumnSigned) && !columns.has(tagColumnQuarantine) {
+		return resolver, nil
+	}
+	client, ok := acrClient.(api.AcrCLIClientInterface)
+	if !ok {
+		return nil, errors.New("the signed and quarantine columns cannot be resolved with this client")
+	}
+	resolver.acrClient = client
+	if !columns.has(tagColumnQuarantine) {
+		return resolver, nil
+	}
+	resolver.quarantine = map[string]string{}
+	manifestPager := api.NewManifestPager(client, repoName, "")
+	for !manifestPager.Done() {
+		resultManifests, err := manifestPager.Next(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the manifests of %s: %w", repoName, err)
+		}
+		if resultManifests == nil || resultManifests.ManifestsAttributes == nil {
+			break
+		}
+		for _, manifest := range *resultManifests.ManifestsAttributes {
+			if manifest.Digest != nil && manifest.ChangeableAttributes != nil && manifest.ChangeableAttributes.QuarantineState != nil {
+				resolver.quarantine[*manifest.Digest] = *manifest.ChangeableAttributes.QuarantineState
+			}
+		}
+	}
+	return resolver, nil
+}
+
+// resolve returns the tag with the attributes of the columns.
+func (r *tagAttributeResolver) resolve(ctx context.Context, tag acr.TagAttributesBase) (listedTag, error) {
+	entry := listedTag{TagAttributesBase: tag}
+	if tag.Digest == nil {
+		return entry, nil
+	}
+	if r.columns.has(tagColumnSigned) {
+		signed, err := purge.IsSigned(ctx, r.acrClient, r.repoName, *tag.Digest)
+		if err != nil {
+			return entry, err
+		}
+		entry.Signed = &signed
+	}
+	if r.columns.has(tagColumnQuarantine) {
+		entry.QuarantineState = r.quarantine[*tag.Digest]
+	}
+	return entry, nil
+}
+
+// printTagTable prints the tags with their extra columns, the attributes that are not known are printed as -.
+func printTagTable(out io.Writer, list tagList, columns tagColumns) error {
+	headers := []string{"TAG"}
+	for _, column := range columns {
+		headers = append(headers, strings.ToUpper(column))
+	}
+	t := newTable("", headers...)
+	for _, tag := range list.Tags {
+		cells := []string{fmt.Sprintf("%s/%s:%s", list.Registry, list.Repository, *tag.Name)}
+		for _, column := range columns {
+			value := "-"
+			switch {
+			case column == tagColumnCreated && tag.CreatedTime != nil:
+				value = *tag.CreatedTime
+			case column == tagColumnSigned && tag.Signed != nil:
+				value = "no"
+				if *tag.Signed {
+					value = "yes"
+				}
+			case column == tagColumnQuarantine && len(tag.QuarantineState) > 0:
+				value = tag.QuarantineState
+			}
+			cells = append(cells, value)
+		}
+		t.addRow(colorNone, cells...)
+	}
+	return t.render(out, useColor(out))
+}
+
 // newTagDeleteCmd defines the tag delete subcommand, it receives as an argument an array of tag digests.
 // The delete functionality of this command is implemented in the deleteTags function.
 func newTagDeleteCmd(out io.Writer, tagParams *tagParameters) *cobra.Command {
@@ -118,6 +334,9 @@ func newTagDeleteCmd(out io.Writer, tagParams *tagParameters) *cobra.Command {
 		Short: "Delete tags from a repository",
 		Long:  newTagDeleteCmdLongMessage,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := tagParams.checkRepository(); err != nil {
+				return err
+			}
 			registryName, err := tagParams.GetRegistryName()
 			if err != nil {
 				return err
@@ -140,14 +359,119 @@ func newTagDeleteCmd(out io.Writer, tagParams *tagParameters) *cobra.Command {
 }
 
 // deleteTags receives an array of tags digest and deletes them using the supplied acrClient.
-func deleteTags(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string, args []string) error {
+func deleteTags(ctx context.Context, acrClient api.TagDeleter, loginURL string, repoName string, args []string) error {
 	for i := 0; i < len(args); i++ {
 		_, err := acrClient.DeleteAcrTag(ctx, repoName, args[i])
 		if err != nil {
 			// If there is an error (this includes not found and not allowed operations) the deletion of the tags is stopped and an error is returned.
-			return errors.Wrap(err, "failed to delete tags")
+			return fmt.Errorf("failed to delete tags: %w", err)
 		}
 		fmt.Printf("%s/%s:%s\n", loginURL, repoName, args[i])
 	}
 	return nil
 }
+
+// newTagResolveCmd defines the tag resolve subcommand, it receives as an argument a digest or a tag of a repository.
+func newTagResolveCmd(out io.Writer, tagParams *tagParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "resolve <repository>@<digest> | <repository>:<tag>",
+		Short:   "List the tags that reference a digest",
+		Long:    newTagResolveCmdLongMessage,
+		Example: tagResolveExampleMessage,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printer, err := newPrinter(tagParams.output)
+			if err != nil {
+				return err
+			}
+			registryName, err := tagParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, tagParams.username, tagParams.password, tagParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			return resolveTags(ctx, out, acrClient, loginURL, args[0], printer)
+		},
+	}
+	addOutputFlag(cmd, &tagParams.output)
+	return cmd
+}
+
+// tagResolution is the output of the tag resolve command when an output format is selected.
+type tagResolution struct {
+	Registry   string   `json:"registry"`
+	Repository string   `json:"repository"`
+	Digest     string   `json:"digest"`
+	Tags       []string `json:"tags"`
+}
+
+// resolveTags prints the tags that reference the digest of the reference, if the reference is a tag its digest is
+// looked up first. The tags of the repository are listed once and grouped by the digest they reference.
+func resolveTags(ctx context.Context, out io.Writer, acrClient api.TagLister, loginURL string, reference string, printer *printer) error {
+	repoName, ref, isDigest, err := parseReference(reference)
+	if err != nil {
+		return err
+	}
+	tagsByDigest, err := countTagsByDigest(ctx, acrClient, repoName)
+	if err != nil {
+		return err
+	}
+	digest := ref
+	if !isDigest {
+		digest = ""
+		for tagDigest, tags := range tagsByDigest {
+			for _, tag := range tags {
+				if tag == ref {
+					digest = tagDigest
+				}
+			}
+		}
+		if len(digest) == 0 {
+			return fmt.Errorf("tag %s not found in repository %s", ref, repoName)
+		}
+	}
+
+	resolution := tagResolution{Registry: loginURL, Repository: repoName, Digest: digest, Tags: tagsByDigest[digest]}
+	if resolution.Tags == nil {
+		resolution.Tags = []string{}
+	}
+	sort.Strings(resolution.Tags)
+	if printer != nil {
+		return printer.print(out, resolution)
+	}
+	if len(resolution.Tags) == 0 {
+		fmt.Fprintf(out, "No tags reference %s/%s@%s\n", loginURL, repoName, digest)
+		return nil
+	}
+	fmt.Fprintf(out, "Tags referencing %s/%s@%s:\n", loginURL, repoName, digest)
+	for _, tag := range resolution.Tags {
+		fmt.Fprintf(out, "%s/%s:%s\n", loginURL, repoName, tag)
+	}
+	return nil
+}
+
+// countTagsByDigest lists all the tags of a repository and groups their names by the digest they reference.
+func countTagsByDigest(ctx context.Context, acrClient api.TagLister, repoName string) (map[string][]string, error) {
+	tagsByDigest := map[string][]string{}
+	tagPager := api.NewTagPager(acrClient, repoName, "")
+	for !tagPager.Done() {
+		resultTags, err := tagPager.Next(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		if resultTags == nil || resultTags.TagsAttributes == nil {
+			break
+		}
+		for _, tag := range *resultTags.TagsAttributes {
+			if tag.Name == nil || tag.Digest == nil {
+				continue
+			}
+			tagsByDigest[*tag.Digest] = append(tagsByDigest[*tag.Digest], *tag.Name)
+		}
+	}
+	return tagsByDigest, nil
+}
@@ -4,9 +4,16 @@
 package main
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
 	"testing"
 
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
 	"github.com/Azure/acr-cli/cmd/mocks"
 	"github.com/stretchr/testify/assert"
 )
@@ -15,31 +22,124 @@ func TestListTags(t *testing.T) {
 	// First test, repository not found should return an error.
 	t.Run("RepositoryNotFoundTest", func(t *testing.T) {
 		assert := assert.New(t)
-		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient := &mocks.TagLister{}
 		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(notFoundTagResponse, errors.New("testRepo not found")).Once()
-		err := listTags(testCtx, mockClient, testLoginURL, testRepo)
+		err := listTags(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo, listOptions{}, nil, nil)
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
 	})
 	// Second test, if an error is returned on any GetAcrTags call an error should be returned.
 	t.Run("ErrorOnSecondPageTest", func(t *testing.T) {
 		assert := assert.New(t)
-		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient := &mocks.TagLister{}
 		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
 		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(nil, errors.New("unauthorized")).Once()
-		err := listTags(testCtx, mockClient, testLoginURL, testRepo)
+		err := listTags(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo, listOptions{}, nil, nil)
 		assert.NotEqual(nil, err, "Error should not be nil")
 		mockClient.AssertExpectations(t)
 	})
 	// Third test, no errors
 	t.Run("ListFiveTagsTest", func(t *testing.T) {
 		assert := assert.New(t)
-		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		err := listTags(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo, listOptions{}, nil, nil)
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, the tags of every page are printed with the selected output format.
+	t.Run("OutputFormatTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
 		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
 		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(FourTagsResult, nil).Once()
 		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
-		err := listTags(testCtx, mockClient, testLoginURL, testRepo)
+		printer, err := newPrinter("jsonpath={.tags[*].name}")
+		assert.Equal(nil, err, "Error should be nil")
+		out := &bytes.Buffer{}
+		err = listTags(testCtx, out, mockClient, testLoginURL, testRepo, listOptions{}, nil, printer)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("latest v1 v2 v3 v4", out.String())
+		mockClient.AssertExpectations(t)
+	})
+	// Fifth test, the order is passed to the registry and the listing stops at the limit without requesting more pages.
+	t.Run("OrderByAndLimitTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "timeasc", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "timeasc", "latest").Return(FourTagsResult, nil).Once()
+		printer, err := newPrinter("jsonpath={.tags[*].name}")
+		assert.Equal(nil, err, "Error should be nil")
+		out := &bytes.Buffer{}
+		err = listTags(testCtx, out, mockClient, testLoginURL, testRepo, listOptions{orderBy: "timeasc", limit: 3}, nil, printer)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("latest v1 v2", out.String())
+		mockClient.AssertExpectations(t)
+	})
+	// Sixth test, unknown orders and negative limits should return an error.
+	t.Run("InvalidOptionsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		err := listTags(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo, listOptions{orderBy: "size"}, nil, nil)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		err = listTags(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo, listOptions{limit: -1}, nil, nil)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		_, err = parseTagColumns([]string{"created", "size"})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		// The signed and quarantine columns need a client that reads the referrers and the manifests.
+		err = listTags(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo, listOptions{}, tagColumns{tagColumnSigned}, nil)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Seventh test, the extra columns are resolved from the referrers and the manifests and printed as a table.
+	t.Run("ShowColumnsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		signedName, unsignedName := "v1", "v2"
+		signedDigest, unsignedDigest := "sha256:7a91c5", "sha256:7a91c6"
+		created, passed := "2021-03-01T10:00:00Z", "Passed"
+		tags := &acr.RepositoryTagsType{TagsAttributes: &[]acr.TagAttributesBase{
+			{Name: &signedName, Digest: &signedDigest, CreatedTime: &created},
+			{Name: &unsignedName, Digest: &unsignedDigest},
+		}}
+		manifests := &acr.Manifests{ManifestsAttributes: &[]acr.ManifestAttributesBase{
+			{Digest: &signedDigest, ChangeableAttributes: &acr.ChangeableAttributes{QuarantineState: &passed}},
+			{Digest: &unsignedDigest, ChangeableAttributes: &acr.ChangeableAttributes{}},
+		}}
+		notFound := &api.StatusError{StatusCode: http.StatusNotFound, Message: "not found"}
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(manifests, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", unsignedDigest).Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(tags, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", unsignedName).Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, signedDigest).Return([]byte(`{"manifests":[{"artifactType":"application/vnd.cncf.notary.signature"}]}`), nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, unsignedDigest).Return([]byte(`{"manifests":[]}`), nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha256-7a91c6.sig").Return(nil, notFound).Once()
+		columns, err := parseTagColumns([]string{"created", "Signed", "quarantine", "created"})
+		assert.Equal(nil, err, "Error should be nil")
+		out := &bytes.Buffer{}
+		err = listTags(testCtx, out, mockClient, testLoginURL, testRepo, listOptions{}, columns, nil)
+		assert.Equal(nil, err, "Error should be nil")
+		expected := fmt.Sprintf(`TAG%s  CREATED               SIGNED  QUARANTINE
+%s/%s:v1  2021-03-01T10:00:00Z  yes     Passed
+%s/%s:v2  -                     no      -
+`, strings.Repeat(" ", len(testLoginURL)+len(testRepo)+1), testLoginURL, testRepo, testLoginURL, testRepo)
+		assert.Equal(expected, out.String())
+		// The JSON output contains the resolved attributes.
+		printer, err := newPrinter("jsonpath={.tags[0].signed}/{.tags[0].quarantineState}")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(manifests, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", unsignedDigest).Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(tags, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", unsignedName).Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, signedDigest).Return([]byte(`{"manifests":[{"artifactType":"application/vnd.cncf.notary.signature"}]}`), nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, unsignedDigest).Return([]byte(`{"manifests":[]}`), nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha256-7a91c6.sig").Return(nil, notFound).Once()
+		out.Reset()
+		err = listTags(testCtx, out, mockClient, testLoginURL, testRepo, listOptions{}, columns, printer)
 		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("true/Passed", out.String())
 		mockClient.AssertExpectations(t)
 	})
 }
@@ -49,7 +149,7 @@ func TestDeleteTags(t *testing.T) {
 	// First test, tag not found should return an error.
 	t.Run("TagNotFoundTest", func(t *testing.T) {
 		assert := assert.New(t)
-		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient := &mocks.TagDeleter{}
 		mockClient.On("DeleteAcrTag", testCtx, testRepo, "latest").Return(&notFoundResponse, errors.New("not found")).Once()
 		err := deleteTags(testCtx, mockClient, testLoginURL, testRepo, args)
 		assert.NotEqual(nil, err, "Error should not be nil")
@@ -58,7 +158,7 @@ func TestDeleteTags(t *testing.T) {
 	// Second test, five tags deleted, regular behavior
 	t.Run("DeleteFiveTagsTest", func(t *testing.T) {
 		assert := assert.New(t)
-		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient := &mocks.TagDeleter{}
 		mockClient.On("DeleteAcrTag", testCtx, testRepo, "latest").Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteAcrTag", testCtx, testRepo, "v1").Return(&deletedResponse, nil).Once()
 		mockClient.On("DeleteAcrTag", testCtx, testRepo, "v2").Return(&deletedResponse, nil).Once()
@@ -69,3 +169,43 @@ func TestDeleteTags(t *testing.T) {
 		mockClient.AssertExpectations(t)
 	})
 }
+
+func TestResolveTags(t *testing.T) {
+	// First test, the tags that reference the digest of a tag are printed with the selected output format.
+	t.Run("ResolveTagTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		printer, err := newPrinter("jsonpath={.digest} {.tags[*]}")
+		assert.Equal(nil, err, "Error should be nil")
+		out := &bytes.Buffer{}
+		err = resolveTags(testCtx, out, mockClient, testLoginURL, testRepo+":v1", printer)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("sha:abc latest v1 v2 v4", out.String())
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, a digest that no tag references is reported.
+	t.Run("UntaggedDigestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		out := &bytes.Buffer{}
+		err := resolveTags(testCtx, out, mockClient, testLoginURL, testRepo+"@sha256:0000", nil)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("No tags reference foo.azurecr.io/bar@sha256:0000\n", out.String())
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, a tag that does not exist should return an error.
+	t.Run("TagNotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		err := resolveTags(testCtx, ioutil.Discard, mockClient, testLoginURL, testRepo+":v9", nil)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
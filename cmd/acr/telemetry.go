@@ -0,0 +1,185 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/telemetry"
+	"github.com/Azure/acr-cli/version"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newTelemetryCmdLongMessage = `acr telemetry: manage the anonymous usage metrics sent to the maintainers.
+The telemetry is off unless it is enabled with acr telemetry enable, the --telemetry flag or ACR_TELEMETRY=true, and
+ACR_TELEMETRY=false turns it off regardless of the rest. Only the command, the names of the flags that were set, the
+duration, counts like the number of deleted tags and the class of the error are sent, never the names of registries,
+repositories or tags, nor the values of the flags.`
+	newTelemetryStatusCmdLongMessage  = `acr telemetry status: print whether the usage metrics are sent and why.`
+	newTelemetryEnableCmdLongMessage  = `acr telemetry enable: send anonymous usage metrics of every command.`
+	newTelemetryDisableCmdLongMessage = `acr telemetry disable: stop sending usage metrics.`
+)
+
+// newTelemetryCmd defines the telemetry command.
+func newTelemetryCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "telemetry",
+		Short: "Manage the anonymous usage metrics",
+		Long:  newTelemetryCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Help()
+			return nil
+		},
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "status",
+			Short: "Print whether the usage metrics are sent",
+			Long:  newTelemetryStatusCmdLongMessage,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				flag, _ := cmd.Flags().GetBool("telemetry")
+				return printTelemetryStatus(out, flag)
+			},
+		},
+		&cobra.Command{
+			Use:   "enable",
+			Short: "Send anonymous usage metrics",
+			Long:  newTelemetryEnableCmdLongMessage,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return setTelemetry(out, true)
+			},
+		},
+		&cobra.Command{
+			Use:   "disable",
+			Short: "Stop sending usage metrics",
+			Long:  newTelemetryDisableCmdLongMessage,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return setTelemetry(out, false)
+			},
+		},
+	)
+	return cmd
+}
+
+// printTelemetryStatus prints whether the telemetry is enabled, what decided it and where the setting is saved.
+func printTelemetryStatus(out io.Writer, flag bool) error {
+	settings, err := telemetry.Load()
+	if err != nil {
+		return err
+	}
+	enabled, source, err := telemetry.Enabled(flag, settings)
+	if err != nil {
+		return err
+	}
+	state := "disabled"
+	if enabled {
+		state = "enabled"
+	}
+	fmt.Fprintf(out, "Telemetry: %s (%s)\n", state, source)
+	if path, err := telemetry.SettingsFile(); err == nil {
+		fmt.Fprintf(out, "Settings: %s\n", path)
+	}
+	if enabled && len(telemetry.Key()) == 0 {
+		fmt.Fprintln(out, "No instrumentation key is configured in this build, nothing is sent")
+	}
+	return nil
+}
+
+// setTelemetry saves the opt-in, the installation id is kept so that enabling it again does not count a new user.
+func setTelemetry(out io.Writer, enabled bool) error {
+	settings, err := telemetry.Load()
+	if err != nil {
+		return err
+	}
+	settings.Enabled = enabled
+	if _, err := telemetry.Save(settings); err != nil {
+		return err
+	}
+	if enabled {
+		fmt.Fprintln(out, "Telemetry enabled, anonymous usage metrics are sent after every command")
+	} else {
+		fmt.Fprintln(out, "Telemetry disabled")
+	}
+	if _, ok := os.LookupEnv(telemetry.EnvVar); ok {
+		fmt.Fprintf(out, "%s is set and takes precedence over this setting\n", telemetry.EnvVar)
+	}
+	return nil
+}
+
+// errorClasses are the classes of the errors reported by the telemetry, the exit codes without the messages.
+var errorClasses = map[int]string{
+	exitError:          "error",
+	exitNothingMatched: "nothing-matched",
+	exitPartialFailure: "partial-failure",
+	exitAuthError:      "auth",
+	exitThrottled:      "throttled",
+	exitMaxDeletes:     "max-deletes",
+	exitDifferent:      "different",
+}
+
+// reportUsage sends the usage of the command that ran if the telemetry is enabled. The failures are ignored, the
+// telemetry must not change the result of a command. The telemetry commands are not reported.
+func reportUsage(ctx context.Context, endpoint string, cmd *cobra.Command, args []string, duration time.Duration, code int) {
+	if cmd == nil || cmd == cmd.Root() || strings.HasPrefix(cmd.CommandPath(), cmd.Root().Name()+" telemetry") {
+		return
+	}
+	settings, err := telemetry.Load()
+	if err != nil {
+		return
+	}
+	flag, _ := cmd.Flags().GetBool("telemetry")
+	if enabled, _, err := telemetry.Enabled(flag, settings); err != nil || !enabled {
+		return
+	}
+	info := version.Get()
+	_ = telemetry.Send(ctx, endpoint, telemetry.Key(), settings.ID, telemetry.Event{
+		Command:    strings.TrimSpace(strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name())),
+		Flags:      flagNames(cmd, args),
+		Duration:   duration,
+		ErrorClass: errorClasses[code],
+		Counts:     telemetry.Counts(),
+		Version:    info.Version,
+		Platform:   info.Platform,
+	})
+}
+
+// flagNames returns the sorted names of the flags found in the arguments of the command, the values are left out.
+func flagNames(cmd *cobra.Command, args []string) []string {
+	seen := map[string]bool{}
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			continue
+		}
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if len(name) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(arg, "--") {
+			// Shorthands can be combined, e.g. -hv, the first one is enough to find the flag.
+			if flag := cmd.Flags().ShorthandLookup(name[:1]); flag != nil {
+				seen[flag.Name] = true
+			}
+			continue
+		}
+		if flag := cmd.Flags().Lookup(name); flag != nil {
+			seen[flag.Name] = true
+		}
+	}
+	names := []string{}
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
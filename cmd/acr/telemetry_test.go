@@ -0,0 +1,98 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTelemetry contains the tests for the telemetry commands and the usage reported after a command.
+func TestTelemetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telemetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer telemetry.SetSettingsFile("")
+	telemetry.SetSettingsFile(filepath.Join(dir, "telemetry.json"))
+	defer func(value string, ok bool) {
+		if ok {
+			os.Setenv(telemetry.EnvVar, value)
+		}
+	}(os.LookupEnv(telemetry.EnvVar))
+	os.Unsetenv(telemetry.EnvVar)
+	var events []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var received []map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&received)
+		events = append(events, received...)
+	}))
+	defer server.Close()
+	defer func(key string) { telemetry.InstrumentationKey = key }(telemetry.InstrumentationKey)
+	telemetry.InstrumentationKey = "key"
+	run := func(args ...string) string {
+		cmd := newRootCmd(args)
+		out := &bytes.Buffer{}
+		cmd.SetOut(out)
+		cmd.SetArgs(args)
+		executed, err := cmd.ExecuteC()
+		assert.Equal(t, nil, err, "Error should be nil")
+		reportUsage(testCtx, server.URL, executed, args, time.Second, exitCode(err))
+		return out.String()
+	}
+	// First test, the status tells the telemetry is disabled by default and nothing is reported.
+	t.Run("DisabledTest", func(t *testing.T) {
+		assert := assert.New(t)
+		var out bytes.Buffer
+		assert.Equal(nil, printTelemetryStatus(&out, false), "Error should be nil")
+		assert.Contains(out.String(), "Telemetry: disabled (default)")
+		run("version")
+		assert.Len(events, 0)
+	})
+	// Second test, the --telemetry flag reports a single command with the names of its flags but not their values.
+	t.Run("FlagTest", func(t *testing.T) {
+		assert := assert.New(t)
+		run("version", "--telemetry", "--registry", "secret.azurecr.io")
+		assert.Len(events, 1)
+		body, _ := json.Marshal(events)
+		assert.NotContains(string(body), "secret")
+		properties := events[0]["data"].(map[string]interface{})["baseData"].(map[string]interface{})["properties"].(map[string]interface{})
+		assert.Equal("version", properties["command"])
+		assert.Equal("registry,telemetry", properties["flags"])
+		assert.Equal("success", properties["result"])
+		events = nil
+	})
+	// Third test, enable and disable save the opt-in and the telemetry commands themselves are not reported.
+	t.Run("EnableDisableTest", func(t *testing.T) {
+		assert := assert.New(t)
+		setTelemetry(ioutil.Discard, true)
+		var out bytes.Buffer
+		assert.Equal(nil, printTelemetryStatus(&out, false), "Error should be nil")
+		assert.Contains(out.String(), "Telemetry: enabled (acr telemetry enable)")
+		run("version")
+		assert.Len(events, 1)
+		run("telemetry", "status")
+		assert.Len(events, 1)
+		setTelemetry(ioutil.Discard, false)
+		run("version")
+		assert.Len(events, 1)
+	})
+	// Fourth test, the error is reported by its class.
+	t.Run("ErrorClassTest", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal("throttled", errorClasses[exitThrottled])
+		assert.Equal("", errorClasses[exitSuccess])
+	})
+}
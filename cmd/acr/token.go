@@ -0,0 +1,255 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newTokenCmdLongMessage = `acr token: create, list and delete repository-scoped tokens.
+The tokens are managed through Azure Resource Manager, the credentials of a service principal are read from the
+AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET environment variables, if they are not set the account
+the Azure CLI is logged in with is used.`
+	newTokenCreateCmdLongMessage = `acr token create: create a token that can only work with the specified repositories.
+A scope map named <token>-scope-map is created with the actions for every repository and a password is generated,
+by default the actions are the ones the purge command needs.`
+	newTokenListCmdLongMessage   = `acr token list: list the tokens of a registry`
+	newTokenDeleteCmdLongMessage = `acr token delete: delete a token, the scope map created together with it is also deleted`
+	tokenCreateExampleMessage    = `  - Create a token that can only purge the hello-world repository and whose password expires in 30 days
+    acr token create -r example -g example-rg --name purge-hello-world --repository hello-world --expiration-in-days 30
+
+  - Create a token that can only pull from the hello-world and the hello-world-dev repositories
+    acr token create -r example -g example-rg --name pull-hello-world --repository hello-world --repository hello-world-dev --action content/read
+`
+)
+
+// purgeActions are the repository actions the purge command needs.
+var purgeActions = []string{"content/delete", "content/read", "metadata/read", "metadata/write"}
+
+// tokenParameters defines the parameters that the token command uses.
+type tokenParameters struct {
+	*rootParameters
+	subscription     string
+	resourceGroup    string
+	name             string
+	repositories     []string
+	actions          []string
+	expirationInDays int
+}
+
+// newTokenCmd defines the token command.
+func newTokenCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	tokenParams := tokenParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage repository-scoped tokens",
+		Long:  newTokenCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.Help()
+			return nil
+		},
+	}
+
+	cmd.AddCommand(
+		newTokenCreateCmd(out, &tokenParams),
+		newTokenListCmd(out, &tokenParams),
+		newTokenDeleteCmd(out, &tokenParams),
+	)
+	cmd.PersistentFlags().StringVar(&tokenParams.subscription, "subscription", "", "The subscription of the registry (env AZURE_SUBSCRIPTION_ID)")
+	cmd.PersistentFlags().StringVarP(&tokenParams.resourceGroup, "resource-group", "g", "", "The resource group of the registry")
+	// The resource group is needed by every subcommand to find the registry in Azure Resource Manager.
+	cmd.MarkPersistentFlagRequired("resource-group")
+	return cmd
+}
+
+// newTokenCreateCmd defines the token create subcommand.
+func newTokenCreateCmd(out io.Writer, tokenParams *tokenParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "create",
+		Short:   "Create a repository-scoped token",
+		Long:    newTokenCreateCmdLongMessage,
+		Example: tokenCreateExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(tokenParams.repositories) == 0 {
+				return errors.New("at least one repository is required")
+			}
+			if tokenParams.expirationInDays < 0 {
+				return errors.New("the expiration-in-days flag cannot be negative")
+			}
+			client, err := tokenParams.managementClient()
+			if err != nil {
+				return err
+			}
+			var expiry time.Time
+			if tokenParams.expirationInDays > 0 {
+				expiry = time.Now().AddDate(0, 0, tokenParams.expirationInDays)
+			}
+			ctx := context.Background()
+			return createToken(ctx, out, client, tokenParams.name, scopeMapActions(tokenParams.repositories, tokenParams.actions), expiry)
+		},
+	}
+	cmd.Flags().StringVar(&tokenParams.name, "name", "", "The name of the token, it is also the username")
+	cmd.Flags().StringArrayVar(&tokenParams.repositories, "repository", nil, "A repository the token can work with, can be specified multiple times")
+	cmd.Flags().StringSliceVar(&tokenParams.actions, "action", purgeActions, "The actions the token can perform on the repositories, any of content/read, content/write, content/delete, metadata/read and metadata/write")
+	cmd.Flags().IntVar(&tokenParams.expirationInDays, "expiration-in-days", 0, "The number of days after which the password expires, 0 means it never expires")
+	cmd.MarkFlagRequired("name")
+	return cmd
+}
+
+// newTokenListCmd defines the token list subcommand.
+func newTokenListCmd(out io.Writer, tokenParams *tokenParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the tokens of a registry",
+		Long:  newTokenListCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := tokenParams.managementClient()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			return listTokens(ctx, out, client)
+		},
+	}
+	return cmd
+}
+
+// newTokenDeleteCmd defines the token delete subcommand.
+func newTokenDeleteCmd(out io.Writer, tokenParams *tokenParameters) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete a token",
+		Long:  newTokenDeleteCmdLongMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := tokenParams.managementClient()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			return deleteToken(ctx, out, client, tokenParams.name)
+		},
+	}
+	cmd.Flags().StringVar(&tokenParams.name, "name", "", "The name of the token")
+	cmd.MarkFlagRequired("name")
+	return cmd
+}
+
+// managementClient creates the client for the registry of the token command.
+func (tokenParams *tokenParameters) managementClient() (*api.ManagementClient, error) {
+	return newManagementClient(tokenParams.rootParameters, tokenParams.subscription, tokenParams.resourceGroup)
+}
+
+// newManagementClient creates the client for the registry, the subscription can also be set with an environment
+// variable.
+func newManagementClient(rootParams *rootParameters, subscription string, resourceGroup string) (*api.ManagementClient, error) {
+	registryName, err := rootParams.GetRegistryName()
+	if err != nil {
+		return nil, err
+	}
+	if len(subscription) == 0 {
+		subscription = os.Getenv("AZURE_SUBSCRIPTION_ID")
+	}
+	if len(subscription) == 0 {
+		return nil, errors.New("unable to determine the subscription, please use --subscription flag")
+	}
+	return api.NewManagementClient(subscription, resourceGroup, registryName)
+}
+
+// tokenManager contains the ManagementClient methods used by the token command.
+type tokenManager interface {
+	CreateScopeMap(ctx context.Context, name string, description string, actions []string) (*api.ScopeMap, error)
+	DeleteScopeMap(ctx context.Context, name string) error
+	CreateToken(ctx context.Context, name string, scopeMapID string) (*api.Token, error)
+	GetToken(ctx context.Context, name string) (*api.Token, error)
+	ListTokens(ctx context.Context) ([]api.Token, error)
+	DeleteToken(ctx context.Context, name string) error
+	GenerateCredentials(ctx context.Context, tokenID string, expiry time.Time) (*api.TokenCredentials, error)
+}
+
+// scopeMapActions returns the scope map actions that allow the actions on every repository.
+func scopeMapActions(repositories []string, actions []string) []string {
+	scopeActions := []string{}
+	for _, repoName := range repositories {
+		for _, action := range actions {
+			scopeActions = append(scopeActions, "repositories/"+repoName+"/"+action)
+		}
+	}
+	return scopeActions
+}
+
+// scopeMapName returns the name of the scope map created together with a token.
+func scopeMapName(tokenName string) string {
+	return tokenName + "-scope-map"
+}
+
+// createToken creates the scope map and the token, generates a password and prints the credentials.
+func createToken(ctx context.Context, out io.Writer, client tokenManager, name string, actions []string, expiry time.Time) error {
+	scopeMap, err := client.CreateScopeMap(ctx, scopeMapName(name), "Created by acr token create for "+name, actions)
+	if err != nil {
+		return err
+	}
+	token, err := client.CreateToken(ctx, name, scopeMap.ID)
+	if err != nil {
+		return err
+	}
+	credentials, err := client.GenerateCredentials(ctx, token.ID, expiry)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Token: %s\n", name)
+	fmt.Fprintf(out, "Scope map: %s\n", scopeMapName(name))
+	for _, action := range actions {
+		fmt.Fprintf(out, "  %s\n", action)
+	}
+	fmt.Fprintf(out, "Username: %s\n", credentials.Username)
+	password := credentials.Passwords[0]
+	fmt.Fprintf(out, "Password: %s\n", password.Value)
+	if len(password.Expiry) > 0 {
+		fmt.Fprintf(out, "Expires: %s\n", password.Expiry)
+	}
+	return nil
+}
+
+// listTokens prints the name, status, creation date and scope map of every token.
+func listTokens(ctx context.Context, out io.Writer, client tokenManager) error {
+	tokens, err := client.ListTokens(ctx)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		scopeMapID := token.Properties.ScopeMapID
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", token.Name, token.Properties.Status, token.Properties.CreationDate, scopeMapID[strings.LastIndex(scopeMapID, "/")+1:])
+	}
+	return nil
+}
+
+// deleteToken deletes a token and, if it was created by createToken, its scope map.
+func deleteToken(ctx context.Context, out io.Writer, client tokenManager, name string) error {
+	token, err := client.GetToken(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := client.DeleteToken(ctx, name); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Deleted token %s\n", name)
+	// Scope maps that were not created together with the token could be used by other tokens, so they are kept.
+	if strings.HasSuffix(token.Properties.ScopeMapID, "/scopeMaps/"+scopeMapName(name)) {
+		if err := client.DeleteScopeMap(ctx, scopeMapName(name)); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Deleted scope map %s\n", scopeMapName(name))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTokenManager keeps the scope maps and tokens in memory.
+type fakeTokenManager struct {
+	scopeMaps map[string][]string
+	tokens    map[string]string
+}
+
+func (f *fakeTokenManager) CreateScopeMap(ctx context.Context, name string, description string, actions []string) (*api.ScopeMap, error) {
+	f.scopeMaps[name] = actions
+	return &api.ScopeMap{ID: "/registries/example/scopeMaps/" + name, Name: name}, nil
+}
+
+func (f *fakeTokenManager) DeleteScopeMap(ctx context.Context, name string) error {
+	delete(f.scopeMaps, name)
+	return nil
+}
+
+func (f *fakeTokenManager) CreateToken(ctx context.Context, name string, scopeMapID string) (*api.Token, error) {
+	f.tokens[name] = scopeMapID
+	return f.GetToken(ctx, name)
+}
+
+func (f *fakeTokenManager) GetToken(ctx context.Context, name string) (*api.Token, error) {
+	return &api.Token{ID: "/registries/example/tokens/" + name, Name: name, Properties: api.TokenProperties{ScopeMapID: f.tokens[name], Status: "enabled"}}, nil
+}
+
+func (f *fakeTokenManager) ListTokens(ctx context.Context) ([]api.Token, error) {
+	tokens := []api.Token{}
+	for name := range f.tokens {
+		token, _ := f.GetToken(ctx, name)
+		tokens = append(tokens, *token)
+	}
+	return tokens, nil
+}
+
+func (f *fakeTokenManager) DeleteToken(ctx context.Context, name string) error {
+	delete(f.tokens, name)
+	return nil
+}
+
+func (f *fakeTokenManager) GenerateCredentials(ctx context.Context, tokenID string, expiry time.Time) (*api.TokenCredentials, error) {
+	return &api.TokenCredentials{Username: "purge", Passwords: []api.TokenPassword{{Name: "password1", Value: "secret", Expiry: expiry.Format(time.RFC3339)}}}, nil
+}
+
+// TestToken contains the tests for the token create, list and delete commands.
+func TestToken(t *testing.T) {
+	ctx := context.Background()
+	manager := &fakeTokenManager{scopeMaps: map[string][]string{}, tokens: map[string]string{}}
+	// First test, the scope map gets the actions of every repository and the credentials are printed.
+	t.Run("CreateTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		actions := scopeMapActions([]string{"hello", "world"}, []string{"content/read", "content/delete"})
+		assert.Equal([]string{"repositories/hello/content/read", "repositories/hello/content/delete", "repositories/world/content/read", "repositories/world/content/delete"}, actions)
+		err := createToken(ctx, out, manager, "purge", actions, time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(actions, manager.scopeMaps["purge-scope-map"])
+		assert.Equal("/registries/example/scopeMaps/purge-scope-map", manager.tokens["purge"])
+		assert.Contains(out.String(), "Username: purge\nPassword: secret\nExpires: 2020-01-01T00:00:00Z\n")
+	})
+	// Second test, the tokens are listed with the name of their scope map.
+	t.Run("ListTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		assert.Equal(nil, listTokens(ctx, out, manager), "Error should be nil")
+		assert.Equal("purge\tenabled\t\tpurge-scope-map\n", out.String())
+	})
+	// Third test, the scope map created with the token is deleted but other scope maps are kept.
+	t.Run("DeleteTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		manager.tokens["shared"] = "/registries/example/scopeMaps/_repositories_pull"
+		manager.scopeMaps["_repositories_pull"] = []string{}
+		assert.Equal(nil, deleteToken(ctx, out, manager, "purge"), "Error should be nil")
+		assert.Equal(nil, deleteToken(ctx, out, manager, "shared"), "Error should be nil")
+		assert.Equal(0, len(manager.tokens))
+		assert.Equal(map[string][]string{"_repositories_pull": {}}, manager.scopeMaps)
+		assert.Equal("Deleted token purge\nDeleted scope map purge-scope-map\nDeleted token shared\n", out.String())
+	})
+}
@@ -0,0 +1,164 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+const (
+	newUsageCmdLongMessage = `acr usage: report the tag count, manifest count and storage used by every repository of a registry.
+The total size is the sum of the sizes of all the manifests of a repository, the unique size only counts the manifests
+that are not present in any other repository, so it approximates the storage that purging the repository would free.`
+	usageExampleMessage = `  - Show the usage of all the repositories in the example.azurecr.io registry
+    acr usage -r example
+
+  - Show the 10 repositories that use the most storage in the example.azurecr.io registry
+    acr usage -r example --top 10
+`
+)
+
+// usageParameters defines the parameters used by the usage command.
+type usageParameters struct {
+	*rootParameters
+	top int
+}
+
+// repositoryUsage contains the storage usage of a single repository.
+type repositoryUsage struct {
+	name          string
+	tagCount      int
+	manifestCount int
+	totalBytes    int64
+	uniqueBytes   int64
+}
+
+// newUsageCmd defines the usage command.
+func newUsageCmd(out io.Writer, rootParams *rootParameters) *cobra.Command {
+	usageParams := usageParameters{rootParameters: rootParams}
+	cmd := &cobra.Command{
+		Use:     "usage",
+		Short:   "Report storage usage by repository",
+		Long:    newUsageCmdLongMessage,
+		Example: usageExampleMessage,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registryName, err := usageParams.GetRegistryName()
+			if err != nil {
+				return err
+			}
+			loginURL := api.LoginURL(registryName)
+			acrClient, err := api.GetAcrCLIClientWithAuth(loginURL, usageParams.username, usageParams.password, usageParams.configs)
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+			usages, err := getRegistryUsage(ctx, acrClient)
+			if err != nil {
+				return err
+			}
+			if usageParams.top > 0 && usageParams.top < len(usages) {
+				usages = usages[:usageParams.top]
+			}
+			return printRegistryUsage(out, usages)
+		},
+	}
+
+	cmd.Flags().IntVar(&usageParams.top, "top", 0, "Only show the specified number of repositories that use the most storage, 0 shows all of them")
+	return cmd
+}
+
+// getRegistryUsage iterates over every repository of the registry and returns their usage sorted by total size, the biggest first.
+func getRegistryUsage(ctx context.Context, acrClient api.AcrCLIClientInterface) ([]repositoryUsage, error) {
+	repoNames, err := listRepositories(ctx, acrClient)
+	if err != nil {
+		return nil, err
+	}
+	usages := []repositoryUsage{}
+	// For every digest the repositories that contain it are kept, the size of a manifest is only unique to a
+	// repository when no other repository contains the same digest.
+	digestRepos := map[string]map[string]bool{}
+	digestSizes := map[string]int64{}
+	for _, repoName := range repoNames {
+		usage := repositoryUsage{name: repoName}
+		manifestPager := api.NewManifestPager(acrClient, repoName, "")
+		resultManifests, err := manifestPager.Next(ctx)
+		if err != nil {
+			if errors.Is(err, api.ErrNotFound) {
+				// The repository was deleted after the catalog was listed.
+				continue
+			}
+			return nil, fmt.Errorf("failed to list manifests: %w", err)
+		}
+		for resultManifests != nil && resultManifests.ManifestsAttributes != nil {
+			manifests := *resultManifests.ManifestsAttributes
+			for _, manifest := range manifests {
+				usage.manifestCount++
+				if manifest.Tags != nil {
+					usage.tagCount += len(*manifest.Tags)
+				}
+				if manifest.ImageSize != nil {
+					usage.totalBytes += *manifest.ImageSize
+					digestSizes[*manifest.Digest] = *manifest.ImageSize
+				}
+				if _, ok := digestRepos[*manifest.Digest]; !ok {
+					digestRepos[*manifest.Digest] = map[string]bool{}
+				}
+				digestRepos[*manifest.Digest][repoName] = true
+			}
+			resultManifests, err = manifestPager.Next(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list manifests: %w", err)
+			}
+		}
+		usages = append(usages, usage)
+	}
+	for i := range usages {
+		for digest, repos := range digestRepos {
+			if len(repos) == 1 && repos[usages[i].name] {
+				usages[i].uniqueBytes += digestSizes[digest]
+			}
+		}
+	}
+	sort.SliceStable(usages, func(i, j int) bool {
+		return usages[i].totalBytes > usages[j].totalBytes
+	})
+	return usages, nil
+}
+
+// listRepositories returns the names of all the repositories inside a registry.
+func listRepositories(ctx context.Context, acrClient api.AcrCLIClientInterface) ([]string, error) {
+	repoNames := []string{}
+	repoPager := api.NewRepositoryPager(acrClient)
+	resultRepos, err := repoPager.Next(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %w", err)
+	}
+	for resultRepos != nil && resultRepos.Names != nil && len(*resultRepos.Names) > 0 {
+		repoNames = append(repoNames, *resultRepos.Names...)
+		resultRepos, err = repoPager.Next(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repositories: %w", err)
+		}
+	}
+	return repoNames, nil
+}
+
+// printRegistryUsage writes the usage of every repository as a table.
+func printRegistryUsage(out io.Writer, usages []repositoryUsage) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tTAGS\tMANIFESTS\tTOTAL SIZE\tUNIQUE SIZE")
+	for _, usage := range usages {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", usage.name, usage.tagCount, usage.manifestCount, units.HumanSize(float64(usage.totalBytes)), units.HumanSize(float64(usage.uniqueBytes)))
+	}
+	return w.Flush()
+}
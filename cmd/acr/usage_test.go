@@ -0,0 +1,63 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRegistryUsage(t *testing.T) {
+	// First test, if the catalog cannot be listed an error should be returned.
+	t.Run("ListRepositoriesErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositories", testCtx, "").Return(nil, errors.New("unauthorized")).Once()
+		_, err := getRegistryUsage(testCtx, mockClient)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, the shared manifest should not count as unique storage for either repository, and the result should be
+	// sorted by the total size.
+	t.Run("TwoRepositoriesTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositories", testCtx, "").Return(&acr.Repositories{Names: &[]string{"small", "big"}}, nil).Once()
+		mockClient.On("GetAcrRepositories", testCtx, "big").Return(&acr.Repositories{}, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "small", "", "").Return(sizedManifestsResult(digest), nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "small", "", digest).Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "big", "", "").Return(sizedManifestsResult(digest, digest1), nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "big", "", digest1).Return(EmptyListManifestsResult, nil).Once()
+		usages, err := getRegistryUsage(testCtx, mockClient)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, len(usages))
+		assert.Equal("big", usages[0].name)
+		assert.Equal(2, usages[0].manifestCount)
+		assert.Equal(2, usages[0].tagCount)
+		assert.Equal(int64(200), usages[0].totalBytes)
+		assert.Equal(int64(100), usages[0].uniqueBytes)
+		assert.Equal("small", usages[1].name)
+		assert.Equal(int64(0), usages[1].uniqueBytes)
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// sizedManifestsResult returns a page of tagged manifests of 100 bytes each.
+func sizedManifestsResult(digests ...string) *acr.Manifests {
+	size := int64(100)
+	manifests := []acr.ManifestAttributesBase{}
+	for i := range digests {
+		manifests = append(manifests, acr.ManifestAttributesBase{
+			Digest:    &digests[i],
+			ImageSize: &size,
+			MediaType: &dockerV2MediaType,
+			Tags:      &[]string{"latest"},
+		})
+	}
+	return &acr.Manifests{ManifestsAttributes: &manifests}
+}
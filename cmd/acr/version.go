@@ -6,14 +6,16 @@ package main
 import (
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/Azure/acr-cli/cmd/api"
 	"github.com/Azure/acr-cli/version"
 	"github.com/spf13/cobra"
 )
 
 const (
 	versionLongMessage = `
-Prints version information
+Prints version information, including the commit the binary was built from and the registry APIs it uses
 `
 )
 
@@ -23,8 +25,13 @@ func newVersionCmd(out io.Writer) *cobra.Command {
 		Short: "Print version information",
 		Long:  versionLongMessage,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			fmt.Printf(`Version: %s, Revision: %s
-`, version.Version, version.Revision)
+			info := version.Get()
+			fmt.Printf(`Version: %s
+Commit: %s
+Go version: %s
+Platform: %s
+API versions: %s
+`, info.Version, info.Revision, info.GoVersion, info.Platform, strings.Join(api.APIVersions(), ", "))
 			return nil
 		},
 	}
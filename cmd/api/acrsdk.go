@@ -6,25 +6,48 @@ package api
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"strings"
 	"time"
 
 	// The autorest generated SDK is used, this file is just a wrapper to it.
 	acrapi "github.com/Azure/acr-cli/acr"
-	dockerAuth "github.com/Azure/acr-cli/auth/docker"
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/dgrijalva/jwt-go"
-	"github.com/pkg/errors"
 )
 
 // Constants that are used throughout this file.
 const (
 	prefixHTTPS           = "https://"
+	prefixHTTP            = "http://"
 	registryURL           = ".azurecr.io"
 	manifestTagFetchCount = 100
 	manifestV2ContentType = "application/vnd.docker.distribution.manifest.v2+json"
+	// ociIndexContentType is the media type of the index returned by the referrers API.
+	ociIndexContentType = "application/vnd.oci.image.index.v1+json"
+	// manifestAcceptHeader lists every manifest format the acr-cli understands, without it the registry would only
+	// return Docker v2 manifests and OCI manifests would not be found.
+	manifestAcceptHeader = manifestV2ContentType +
+		", application/vnd.docker.distribution.manifest.list.v2+json" +
+		", application/vnd.oci.image.manifest.v1+json" +
+		", application/vnd.oci.image.index.v1+json"
+	// tokenScope is the scope requested for ACR access tokens, it allows working with any repository and listing the catalog.
+	tokenScope = "repository:*:* registry:catalog:*"
+	// capabilitiesHeader lists the optional APIs a registry supports, batchTagDeleteCapability is the one that
+	// deletes several tags of a repository in a single request.
+	capabilitiesHeader       = "X-Ms-Acr-Capabilities"
+	batchTagDeleteCapability = "tag-batch-delete"
+	// tagFilterAPIVersion is the first version of the ACR API that lists only the tags whose name starts with the
+	// value of the tagNameParameter.
+	tagFilterAPIVersion = "2021-07-01"
+	tagNameParameter    = "name"
+	// dockerContentDigestHeader is the digest of the manifest the registry returns, or stored for a push.
+	dockerContentDigestHeader = "Docker-Content-Digest"
 )
 
 // The AcrCLIClient is the struct that will be in charge of doing the http requests to the registry.
@@ -39,35 +62,71 @@ type AcrCLIClient struct {
 	// accessTokenExp refers to the expiration time for the access token, it is in a unix time format represented by a
 	// 64 bit integer.
 	accessTokenExp int64
+	// apiVersion is the version of the ACR API sent in the requests, empty for LegacyAPIVersion.
+	apiVersion string
 }
 
 // LoginURL returns the FQDN for a registry.
 func LoginURL(registryName string) string {
 	// TODO: if the registry is in another cloud (i.e. dogfood) a full FQDN for the registry should be specified.
-	if strings.Contains(registryName, ".") {
+	// Connected registries are reached through a host and port (e.g. localhost:8080) that is not an azurecr.io domain.
+	if strings.Contains(registryName, ".") || strings.Contains(registryName, ":") || registryName == "localhost" {
 		return registryName
 	}
 	return registryName + registryURL
 }
 
-// LoginURLWithPrefix return the hostname of a registry.
+// LoginURLWithPrefix return the hostname of a registry, prefixed with https:// or with http:// if SetPlainHTTP was
+// called.
 func LoginURLWithPrefix(loginURL string) string {
-	urlWithPrefix := loginURL
-	if !strings.HasPrefix(loginURL, prefixHTTPS) {
-		urlWithPrefix = prefixHTTPS + loginURL
+	if strings.HasPrefix(loginURL, prefixHTTPS) || strings.HasPrefix(loginURL, prefixHTTP) {
+		return loginURL
 	}
-	return urlWithPrefix
+	if plainHTTP {
+		return prefixHTTP + loginURL
+	}
+	return prefixHTTPS + loginURL
+}
+
+// userAgent identifies the acr-cli in the requests, it is prepended to the User-Agent of the generated client.
+var userAgent string
+
+// SetUserAgent sets the User-Agent of the AcrCLIClients created afterwards, e.g. acr-cli/1.0.0 purge.
+func SetUserAgent(ua string) {
+	userAgent = ua
+}
+
+// APIVersions returns the registry APIs the client uses, the version of the ACR API is the one the generated
+// client was created from.
+func APIVersions() []string {
+	versions := []string{"registry/v2"}
+	for _, product := range strings.Fields(acrapi.UserAgent()) {
+		if strings.HasPrefix(product, "acr/") {
+			versions = append(versions, product)
+		}
+	}
+	return versions
 }
 
 // newAcrCLIClient creates a client that does not have any authentication.
 func newAcrCLIClient(loginURL string) AcrCLIClient {
 	loginURLPrefix := LoginURLWithPrefix(loginURL)
-	return AcrCLIClient{
-		AutorestClient: acrapi.NewWithoutDefaults(loginURLPrefix),
+	autorestClient := acrapi.NewWithoutDefaults(loginURLPrefix)
+	// All the clients share the same connection pool.
+	autorestClient.Sender = httpClient
+	if len(userAgent) > 0 {
+		autorestClient.UserAgent = userAgent + " " + autorestClient.UserAgent
+	}
+	client := AcrCLIClient{
+		AutorestClient: autorestClient,
 		// The manifestTagFetchCount is set to the default which is 100
 		manifestTagFetchCount: manifestTagFetchCount,
 		loginURL:              loginURL,
 	}
+	if apiVersion != APIVersionAuto {
+		client.setAPIVersion(apiVersion)
+	}
+	return client
 }
 
 // newAcrCLIClientWithBasicAuth creates a client that uses basic authentication.
@@ -81,7 +140,7 @@ func newAcrCLIClientWithBasicAuth(loginURL string, username string, password str
 func newAcrCLIClientWithBearerAuth(loginURL string, refreshToken string) (AcrCLIClient, error) {
 	newAcrCLIClient := newAcrCLIClient(loginURL)
 	ctx := context.Background()
-	accessTokenResponse, err := newAcrCLIClient.AutorestClient.GetAcrAccessToken(ctx, loginURL, "repository:*:*", refreshToken)
+	accessTokenResponse, err := newAcrCLIClient.AutorestClient.GetAcrAccessToken(ctx, loginURL, tokenScope, refreshToken)
 	if err != nil {
 		return newAcrCLIClient, err
 	}
@@ -100,44 +159,41 @@ func newAcrCLIClientWithBearerAuth(loginURL string, refreshToken string) (AcrCLI
 	return newAcrCLIClient, nil
 }
 
-// GetAcrCLIClientWithAuth obtains a client that has authentication for making ACR http requests
+// GetAcrCLIClientWithAuth obtains a client that has authentication for making ACR http requests, the credential is
+// resolved by the providers of the auth mode set with SetAuthMode.
 func GetAcrCLIClientWithAuth(loginURL string, username string, password string, configs []string) (*AcrCLIClient, error) {
-	if username == "" && password == "" {
-		// If both username and password are empty then the docker config file will be used, it can be found in the default
-		// location or in a location specified by the configs string array
-		client, err := dockerAuth.NewClient(configs...)
-		if err != nil {
-			return nil, errors.Wrap(err, "error resolving authentication")
-		}
-		username, password, err = client.GetCredential(loginURL)
-		if err != nil {
-			return nil, errors.Wrap(err, "error resolving authentication")
-		}
-	}
-	// If the password is empty then the authentication failed.
-	if password == "" {
-		return nil, errors.New("unable to resolve authentication, missing identity token or password")
+	chain := NewAuthChain(authMode, AuthOptions{Username: username, Password: password, Configs: configs, TokenFile: tokenFile})
+	credential, err := ResolveCredential(context.Background(), chain, loginURL)
+	if err != nil {
+		return nil, err
 	}
 	var acrClient AcrCLIClient
-	if username == "" {
+	switch {
+	case len(credential.Password) == 0:
+		// Only the anonymous provider resolves an empty credential.
+		acrClient = newAcrCLIClient(loginURL)
+	case len(credential.Username) == 0:
 		// If the username is empty an ACR refresh token was used.
-		var err error
-		acrClient, err = newAcrCLIClientWithBearerAuth(loginURL, password)
+		acrClient, err = newAcrCLIClientWithBearerAuth(loginURL, credential.Password)
 		if err != nil {
-			return nil, errors.Wrap(err, "error resolving authentication")
+			return nil, newAuthError(err, "error resolving authentication")
 		}
-		return &acrClient, nil
+	default:
+		// if both the username and password were specified basic authentication can be assumed.
+		acrClient = newAcrCLIClientWithBasicAuth(loginURL, credential.Username, credential.Password)
+	}
+	if apiVersion == APIVersionAuto {
+		// If the registry cannot be reached the legacy version is kept, the next request reports the actual error.
+		_, _ = acrClient.NegotiateAPIVersion(context.Background())
 	}
-	// if both the username and password were specified basic authentication can be assumed.
-	acrClient = newAcrCLIClientWithBasicAuth(loginURL, username, password)
 	return &acrClient, nil
 }
 
 // refreshAcrCLIClientToken obtains a new token and gets its expiration time.
 func refreshAcrCLIClientToken(ctx context.Context, c *AcrCLIClient) error {
-	accessTokenResponse, err := c.AutorestClient.GetAcrAccessToken(ctx, c.loginURL, "repository:*:*", c.token.RefreshToken)
+	accessTokenResponse, err := c.AutorestClient.GetAcrAccessToken(ctx, c.loginURL, tokenScope, c.token.RefreshToken)
 	if err != nil {
-		return err
+		return newAuthError(err, "unable to refresh the access token")
 	}
 	token := &adal.Token{
 		AccessToken:  *accessTokenResponse.AccessToken,
@@ -178,6 +234,26 @@ func (c *AcrCLIClient) isExpired() bool {
 	return (time.Now().Add(5 * time.Minute)).Unix() > c.accessTokenExp
 }
 
+// pageSize returns the n parameter of a list request, the size asked for by the pager or manifestTagFetchCount.
+func (c *AcrCLIClient) pageSize(ctx context.Context) *int32 {
+	n := int32(pageSize(ctx, int(c.manifestTagFetchCount)))
+	return &n
+}
+
+// GetAcrRepositories list the repositories of the registry, the repositories are returned in lexical order after last.
+func (c *AcrCLIClient) GetAcrRepositories(ctx context.Context, last string) (*acrapi.Repositories, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	repositories, err := c.AutorestClient.GetAcrRepositories(ctx, last, c.pageSize(ctx))
+	if err != nil {
+		return &repositories, classifyError(err, PermissionCatalog, "")
+	}
+	return &repositories, nil
+}
+
 // GetAcrTags list the tags of a repository with their attributes.
 func (c *AcrCLIClient) GetAcrTags(ctx context.Context, repoName string, orderBy string, last string) (*acrapi.RepositoryTagsType, error) {
 	if c.isExpired() {
@@ -185,14 +261,69 @@ func (c *AcrCLIClient) GetAcrTags(ctx context.Context, repoName string, orderBy
 			return nil, err
 		}
 	}
-	tags, err := c.AutorestClient.GetAcrTags(ctx, repoName, last, &c.manifestTagFetchCount, orderBy, "")
+	tags, err := c.AutorestClient.GetAcrTags(ctx, repoName, last, c.pageSize(ctx), orderBy, "")
 	if err != nil {
 		// tags might contain information such as status codes, so it a pointer to it is returned instead of nil.
-		return &tags, err
+		return &tags, classifyError(err, PermissionMetadataRead, repoName)
 	}
 	return &tags, nil
 }
 
+// TagPrefixLister is implemented by the clients that can ask the registry to list only the tags whose name starts
+// with a prefix, so that the tags that cannot match a filter are not transferred.
+type TagPrefixLister interface {
+	SupportsTagPrefixFilter() bool
+	GetAcrTagsWithPrefix(ctx context.Context, repoName string, orderBy string, last string, prefix string) (*acrapi.RepositoryTagsType, error)
+}
+
+// SupportsTagPrefixFilter returns true if the version of the ACR API the client uses filters the tags by name.
+func (c *AcrCLIClient) SupportsTagPrefixFilter() bool {
+	return APIVersionAtLeast(c.APIVersion(), tagFilterAPIVersion)
+}
+
+// GetAcrTagsWithPrefix lists the tags of a repository whose name starts with the prefix, it should only be used if
+// SupportsTagPrefixFilter returned true, older registries ignore the filter.
+func (c *AcrCLIClient) GetAcrTagsWithPrefix(ctx context.Context, repoName string, orderBy string, last string, prefix string) (*acrapi.RepositoryTagsType, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	var tags acrapi.RepositoryTagsType
+	req, err := c.AutorestClient.GetAcrTagsPreparer(ctx, repoName, last, c.pageSize(ctx), orderBy, "")
+	if err != nil {
+		return &tags, autorest.NewErrorWithError(err, "acr.BaseClient", "GetAcrTagsWithPrefix", nil, "Failure preparing request")
+	}
+	query := req.URL.Query()
+	query.Set(tagNameParameter, prefix)
+	req.URL.RawQuery = query.Encode()
+	resp, err := c.AutorestClient.GetAcrTagsSender(req)
+	if err != nil {
+		tags.Response = autorest.Response{Response: resp}
+		return &tags, autorest.NewErrorWithError(err, "acr.BaseClient", "GetAcrTagsWithPrefix", resp, "Failure sending request")
+	}
+	tags, err = c.AutorestClient.GetAcrTagsResponder(resp)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "GetAcrTagsWithPrefix", resp, "Failure responding to request")
+		return &tags, classifyError(err, PermissionMetadataRead, repoName)
+	}
+	return &tags, nil
+}
+
+// DeleteAcrRepository deletes a repository with all its tags and manifests.
+func (c *AcrCLIClient) DeleteAcrRepository(ctx context.Context, repoName string) (*autorest.Response, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	deleted, err := c.AutorestClient.DeleteAcrRepository(ctx, repoName)
+	if err != nil {
+		return &deleted.Response, classifyError(err, PermissionDelete, repoName)
+	}
+	return &deleted.Response, nil
+}
+
 // DeleteAcrTag deletes the tag by reference.
 func (c *AcrCLIClient) DeleteAcrTag(ctx context.Context, repoName string, reference string) (*autorest.Response, error) {
 	if c.isExpired() {
@@ -202,7 +333,7 @@ func (c *AcrCLIClient) DeleteAcrTag(ctx context.Context, repoName string, refere
 	}
 	resp, err := c.AutorestClient.DeleteAcrTag(ctx, repoName, reference)
 	if err != nil {
-		return &resp, err
+		return &resp, classifyError(err, PermissionDelete, repoName)
 	}
 	return &resp, nil
 }
@@ -214,9 +345,9 @@ func (c *AcrCLIClient) GetAcrManifests(ctx context.Context, repoName string, ord
 			return nil, err
 		}
 	}
-	manifests, err := c.AutorestClient.GetAcrManifests(ctx, repoName, last, &c.manifestTagFetchCount, orderBy)
+	manifests, err := c.AutorestClient.GetAcrManifests(ctx, repoName, last, c.pageSize(ctx), orderBy)
 	if err != nil {
-		return &manifests, err
+		return &manifests, classifyError(err, PermissionMetadataRead, repoName)
 	}
 	return &manifests, nil
 }
@@ -230,7 +361,7 @@ func (c *AcrCLIClient) DeleteManifest(ctx context.Context, repoName string, refe
 	}
 	resp, err := c.AutorestClient.DeleteManifest(ctx, repoName, reference)
 	if err != nil {
-		return &resp, err
+		return &resp, classifyError(err, PermissionDelete, repoName)
 	}
 	return &resp, nil
 }
@@ -244,7 +375,7 @@ func (c *AcrCLIClient) GetManifest(ctx context.Context, repoName string, referen
 		}
 	}
 	var result acrapi.SetObject
-	req, err := c.AutorestClient.GetManifestPreparer(ctx, repoName, reference, manifestV2ContentType)
+	req, err := c.AutorestClient.GetManifestPreparer(ctx, repoName, reference, manifestAcceptHeader)
 	if err != nil {
 		err = autorest.NewErrorWithError(err, "acr.BaseClient", "GetManifest", nil, "Failure preparing request")
 		return nil, err
@@ -254,7 +385,7 @@ func (c *AcrCLIClient) GetManifest(ctx context.Context, repoName string, referen
 	if err != nil {
 		result.Response = autorest.Response{Response: resp}
 		err = autorest.NewErrorWithError(err, "acr.BaseClient", "GetManifest", resp, "Failure sending request")
-		return nil, err
+		return nil, dataEndpointError(err)
 	}
 
 	var manifestBytes []byte
@@ -270,17 +401,417 @@ func (c *AcrCLIClient) GetManifest(ctx context.Context, repoName string, referen
 	_, err = c.AutorestClient.GetManifestResponder(resp)
 	if err != nil {
 		err = autorest.NewErrorWithError(err, "acr.BaseClient", "GetManifest", resp, "Failure responding to request")
-		return nil, err
+		return nil, classifyError(err, PermissionContentRead, repoName)
 	}
 
+	// The body is read before it is decoded so the exact bytes the registry sent can be verified.
+	if err := verifyManifestDigest(repoName, reference, manifestBytes); err != nil {
+		return nil, err
+	}
 	return manifestBytes, nil
 }
 
-// AcrCLIClientInterface defines the required methods that the acr-cli will need to use.
-type AcrCLIClientInterface interface {
+// RegionalEndpoint returns the endpoint of a geo-replicated registry in a region, e.g. example.westus.geo.azurecr.io
+// for the example.azurecr.io registry and the westus region.
+func RegionalEndpoint(loginURL string, location string) string {
+	registryName, suffix := loginURL, ""
+	if i := strings.Index(loginURL, "."); i >= 0 {
+		registryName, suffix = loginURL[:i], loginURL[i:]
+	}
+	return registryName + "." + strings.ToLower(strings.ReplaceAll(location, " ", "")) + ".geo" + suffix
+}
+
+// RegionalClient returns a copy of the client that sends its requests to another endpoint of the registry, e.g. a
+// regional endpoint, the tokens are still requested to the login server.
+func (c *AcrCLIClient) RegionalClient(endpoint string) *AcrCLIClient {
+	regional := *c
+	if !strings.Contains(endpoint, "://") {
+		endpoint = LoginURLWithPrefix(endpoint)
+	}
+	regional.AutorestClient.LoginURI = endpoint
+	return &regional
+}
+
+// HeadManifest returns the digest of the manifest a reference points to without fetching the manifest, the digest is
+// empty if the manifest does not exist.
+func (c *AcrCLIClient) HeadManifest(ctx context.Context, repoName string, reference string) (string, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return "", err
+		}
+	}
+	req, err := c.AutorestClient.GetManifestPreparer(ctx, repoName, reference, manifestAcceptHeader)
+	if err != nil {
+		return "", autorest.NewErrorWithError(err, "acr.BaseClient", "HeadManifest", nil, "Failure preparing request")
+	}
+	req.Method = http.MethodHead
+	resp, err := c.AutorestClient.GetManifestSender(req)
+	if err != nil {
+		return "", autorest.NewErrorWithError(err, "acr.BaseClient", "HeadManifest", resp, "Failure sending request")
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return "", nil
+	}
+	if _, err := c.AutorestClient.GetManifestResponder(resp); err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "HeadManifest", resp, "Failure responding to request")
+		return "", classifyError(err, PermissionContentRead, repoName)
+	}
+	return resp.Header.Get(dockerContentDigestHeader), nil
+}
+
+// GetAcrRepositoryAttributes returns the attributes of a repository, including whether it can be deleted, written, listed and read.
+func (c *AcrCLIClient) GetAcrRepositoryAttributes(ctx context.Context, repoName string) (*acrapi.RepositoryAttributes, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	attributes, err := c.AutorestClient.GetAcrRepositoryAttributes(ctx, repoName)
+	if err != nil {
+		return &attributes, classifyError(err, PermissionMetadataRead, repoName)
+	}
+	return &attributes, nil
+}
+
+// ManifestAttributesGetter is implemented by the clients that can return the attributes of a single manifest, including
+// its tags, so that the tags of a digest are known without listing all the tags of the repository.
+type ManifestAttributesGetter interface {
+	GetAcrManifestAttributes(ctx context.Context, repoName string, reference string) (*acrapi.ManifestAttributes, error)
+}
+
+// GetAcrManifestAttributes returns the attributes of a manifest, including its tags.
+func (c *AcrCLIClient) GetAcrManifestAttributes(ctx context.Context, repoName string, reference string) (*acrapi.ManifestAttributes, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	attributes, err := c.AutorestClient.GetAcrManifestAttributes(ctx, repoName, reference)
+	if err != nil {
+		return nil, classifyError(err, PermissionMetadataRead, repoName)
+	}
+	return &attributes, nil
+}
+
+// GetManifestMetadata returns the value of a metadata of a manifest, the metadata API stores extended attributes
+// (e.g. the identity that pushed the manifest) that the listings of tags and manifests do not return.
+func (c *AcrCLIClient) GetManifestMetadata(ctx context.Context, repoName string, reference string, metadata string) (interface{}, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	value, err := c.AutorestClient.GetAcrManifestMetadata(ctx, repoName, reference, metadata)
+	if err != nil {
+		return nil, classifyError(err, PermissionMetadataRead, repoName)
+	}
+	return value.Value, nil
+}
+
+// UpdateAcrRepositoryAttributes changes the attributes of a repository, the attributes that are nil are not modified.
+func (c *AcrCLIClient) UpdateAcrRepositoryAttributes(ctx context.Context, repoName string, value *acrapi.ChangeableAttributes) (*autorest.Response, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.AutorestClient.UpdateAcrRepositoryAttributes(ctx, repoName, value)
+	if err != nil {
+		return &resp, classifyError(err, PermissionMetadataWrite, repoName)
+	}
+	return &resp, nil
+}
+
+// GetBlob fetches a blob (e.g. the config of an image) and returns it as a byte array.
+func (c *AcrCLIClient) GetBlob(ctx context.Context, repoName string, digest string) ([]byte, error) {
+	content, err := c.OpenBlob(ctx, repoName, digest)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return ioutil.ReadAll(content)
+}
+
+// OpenBlob fetches a blob and returns its content as it is received, it has to be closed. The layers of the images
+// are read with it so that they are not held in memory.
+func (c *AcrCLIClient) OpenBlob(ctx context.Context, repoName string, digest string) (io.ReadCloser, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	req, err := c.AutorestClient.GetBlobPreparer(ctx, repoName, digest)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "GetBlob", nil, "Failure preparing request")
+		return nil, err
+	}
+
+	// The registry redirects the request to the storage of the blob or to its dedicated data endpoint, the http
+	// client follows the redirect.
+	resp, err := c.AutorestClient.GetBlobSender(req)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "GetBlob", resp, "Failure sending request")
+		return nil, dataEndpointError(err)
+	}
+	if resp.StatusCode == http.StatusOK && resp.Body != nil {
+		return resp.Body, nil
+	}
+
+	// The generated responder cannot be used because it unmarshals the body as a JSON string.
+	err = autorest.Respond(
+		resp,
+		c.AutorestClient.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByClosing())
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "GetBlob", resp, "Failure responding to request")
+		return nil, classifyError(err, PermissionContentRead, repoName)
+	}
+	return ioutil.NopCloser(bytes.NewReader(nil)), nil
+}
+
+// PutManifest uploads the manifest bytes exactly as they are and tags them with the reference, contrary to the
+// CreateManifest method of the generated client the media type can be chosen and the bytes are not re-encoded so
+// the digest of the manifest is known beforehand (see ManifestDigest). The reference can also be that digest, the
+// digest the registry returns is checked against it.
+func (c *AcrCLIClient) PutManifest(ctx context.Context, repoName string, reference string, mediaType string, manifestBytes []byte) (*autorest.Response, error) {
+	if err := checkPushReference(repoName, reference, manifestBytes); err != nil {
+		return nil, err
+	}
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	urlParameters := map[string]interface{}{
+		"url": c.AutorestClient.LoginURI,
+	}
+	pathParameters := map[string]interface{}{
+		"name":      autorest.Encode("path", repoName),
+		"reference": autorest.Encode("path", reference),
+	}
+	preparer := autorest.CreatePreparer(
+		autorest.AsContentType(mediaType),
+		autorest.AsPut(),
+		autorest.WithCustomBaseURL("{url}", urlParameters),
+		autorest.WithPathParameters("/v2/{name}/manifests/{reference}", pathParameters),
+		autorest.WithString(string(manifestBytes)))
+	req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "PutManifest", nil, "Failure preparing request")
+		return nil, err
+	}
+
+	resp, err := c.AutorestClient.CreateManifestSender(req)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "PutManifest", resp, "Failure sending request")
+		return &autorest.Response{Response: resp}, err
+	}
+
+	err = autorest.Respond(
+		resp,
+		c.AutorestClient.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusCreated),
+		autorest.ByClosing())
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "PutManifest", resp, "Failure responding to request")
+		return &autorest.Response{Response: resp}, classifyError(err, PermissionContentWrite, repoName)
+	}
+	return &autorest.Response{Response: resp}, verifyPushedDigest(repoName, manifestBytes, resp)
+}
+
+// PutBlob uploads a small blob with a single request after starting the upload session, the content must match the
+// digest. It is used to push the configs of the artifacts the acr-cli creates, UploadBlob uploads large blobs.
+func (c *AcrCLIClient) PutBlob(ctx context.Context, repoName string, digest string, content []byte) error {
+	upload, err := c.StartBlobUpload(ctx, repoName)
+	if err != nil {
+		return err
+	}
+	return c.CompleteBlobUpload(ctx, upload, digest, content)
+}
+
+// GetReferrers returns the image index the registry builds with the manifests whose subject is the digest (e.g.
+// signatures, SBOMs and attestations), registries that do not implement the OCI referrers API answer 404.
+func (c *AcrCLIClient) GetReferrers(ctx context.Context, repoName string, digest string) ([]byte, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	urlParameters := map[string]interface{}{
+		"url": c.AutorestClient.LoginURI,
+	}
+	pathParameters := map[string]interface{}{
+		"name":   autorest.Encode("path", repoName),
+		"digest": autorest.Encode("path", digest),
+	}
+	preparer := autorest.CreatePreparer(
+		autorest.AsGet(),
+		autorest.WithCustomBaseURL("{url}", urlParameters),
+		autorest.WithPathParameters("/v2/{name}/referrers/{digest}", pathParameters),
+		autorest.WithHeader("Accept", ociIndexContentType))
+	req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "acr.BaseClient", "GetReferrers", nil, "Failure preparing request")
+	}
+	resp, err := autorest.SendWithSender(c.AutorestClient, req,
+		autorest.DoRetryForStatusCodes(c.AutorestClient.RetryAttempts, c.AutorestClient.RetryDuration, autorest.StatusCodesForRetry...))
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "acr.BaseClient", "GetReferrers", resp, "Failure sending request")
+	}
+	var referrersBytes []byte
+	if resp.Body != nil {
+		referrersBytes, err = ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewBuffer(referrersBytes))
+	err = autorest.Respond(
+		resp,
+		c.AutorestClient.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByClosing())
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "GetReferrers", resp, "Failure responding to request")
+		return nil, classifyError(err, PermissionContentRead, repoName)
+	}
+	return referrersBytes, nil
+}
+
+// SupportsBatchTagDelete returns true if the registry advertises the batch tag deletion API in the capabilities
+// header of the /v2/ endpoint. The header is also returned when the request is not authorized.
+func (c *AcrCLIClient) SupportsBatchTagDelete(ctx context.Context) (bool, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return false, err
+		}
+	}
+	urlParameters := map[string]interface{}{
+		"url": c.AutorestClient.LoginURI,
+	}
+	preparer := autorest.CreatePreparer(
+		autorest.AsGet(),
+		autorest.WithCustomBaseURL("{url}", urlParameters),
+		autorest.WithPath("/v2/"))
+	req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		return false, autorest.NewErrorWithError(err, "acr.BaseClient", "SupportsBatchTagDelete", nil, "Failure preparing request")
+	}
+	resp, err := autorest.SendWithSender(c.AutorestClient, req,
+		autorest.DoRetryForStatusCodes(c.AutorestClient.RetryAttempts, c.AutorestClient.RetryDuration, autorest.StatusCodesForRetry...))
+	if err != nil {
+		return false, autorest.NewErrorWithError(err, "acr.BaseClient", "SupportsBatchTagDelete", resp, "Failure sending request")
+	}
+	autorest.Respond(resp, autorest.ByDiscardingBody(), autorest.ByClosing())
+	for _, value := range resp.Header[http.CanonicalHeaderKey(capabilitiesHeader)] {
+		for _, capability := range strings.Split(value, ",") {
+			if strings.TrimSpace(capability) == batchTagDeleteCapability {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// DeleteAcrTags deletes a set of tags of a repository with a single request, it should only be used if
+// SupportsBatchTagDelete returned true. The registry either deletes all the tags or none of them.
+func (c *AcrCLIClient) DeleteAcrTags(ctx context.Context, repoName string, tags []string) (*autorest.Response, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	urlParameters := map[string]interface{}{
+		"url": c.AutorestClient.LoginURI,
+	}
+	pathParameters := map[string]interface{}{
+		"name": autorest.Encode("path", repoName),
+	}
+	preparer := autorest.CreatePreparer(
+		autorest.AsContentType("application/json; charset=utf-8"),
+		autorest.AsPost(),
+		autorest.WithCustomBaseURL("{url}", urlParameters),
+		autorest.WithPathParameters("/acr/v1/{name}/_tags/_batchDelete", pathParameters),
+		autorest.WithJSON(batchTagDeleteRequest{Tags: tags}))
+	req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "DeleteAcrTags", nil, "Failure preparing request")
+		return nil, err
+	}
+
+	resp, err := autorest.SendWithSender(c.AutorestClient, req,
+		autorest.DoRetryForStatusCodes(c.AutorestClient.RetryAttempts, c.AutorestClient.RetryDuration, autorest.StatusCodesForRetry...))
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "DeleteAcrTags", resp, "Failure sending request")
+		return &autorest.Response{Response: resp}, err
+	}
+
+	err = autorest.Respond(
+		resp,
+		c.AutorestClient.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusAccepted),
+		autorest.ByClosing())
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", "DeleteAcrTags", resp, "Failure responding to request")
+	}
+	return &autorest.Response{Response: resp}, classifyError(err, PermissionDelete, repoName)
+}
+
+// batchTagDeleteRequest is the body of a batch tag deletion.
+type batchTagDeleteRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// TagLister lists the tags of a repository one page at a time.
+type TagLister interface {
 	GetAcrTags(ctx context.Context, repoName string, orderBy string, last string) (*acrapi.RepositoryTagsType, error)
+}
+
+// TagDeleter deletes a tag of a repository.
+type TagDeleter interface {
 	DeleteAcrTag(ctx context.Context, repoName string, reference string) (*autorest.Response, error)
+}
+
+// ManifestLister lists the manifests of a repository one page at a time.
+type ManifestLister interface {
 	GetAcrManifests(ctx context.Context, repoName string, orderBy string, last string) (*acrapi.Manifests, error)
+}
+
+// ManifestDeleter deletes a manifest of a repository.
+type ManifestDeleter interface {
 	DeleteManifest(ctx context.Context, repoName string, reference string) (*autorest.Response, error)
+}
+
+// ManifestFetcher fetches a manifest of a repository by tag or digest.
+type ManifestFetcher interface {
 	GetManifest(ctx context.Context, repoName string, reference string) ([]byte, error)
 }
+
+// ManifestHeader resolves the digest of a manifest without fetching it, the digest is empty if it does not exist.
+type ManifestHeader interface {
+	HeadManifest(ctx context.Context, repoName string, reference string) (string, error)
+}
+
+// AcrCLIClientInterface defines the required methods that the acr-cli will need to use, the functions that only
+// need some of them take the smaller interfaces it is made of.
+type AcrCLIClientInterface interface {
+	TagLister
+	TagDeleter
+	ManifestLister
+	ManifestDeleter
+	ManifestFetcher
+	ManifestHeader
+	GetAcrRepositories(ctx context.Context, last string) (*acrapi.Repositories, error)
+	DeleteAcrRepository(ctx context.Context, repoName string) (*autorest.Response, error)
+	DeleteAcrTags(ctx context.Context, repoName string, tags []string) (*autorest.Response, error)
+	SupportsBatchTagDelete(ctx context.Context) (bool, error)
+	GetReferrers(ctx context.Context, repoName string, digest string) ([]byte, error)
+	GetBlob(ctx context.Context, repoName string, digest string) ([]byte, error)
+	PutManifest(ctx context.Context, repoName string, reference string, mediaType string, manifestBytes []byte) (*autorest.Response, error)
+	PutBlob(ctx context.Context, repoName string, digest string, content []byte) error
+	GetAcrRepositoryAttributes(ctx context.Context, repoName string) (*acrapi.RepositoryAttributes, error)
+	GetManifestMetadata(ctx context.Context, repoName string, reference string, metadata string) (interface{}, error)
+	UpdateAcrRepositoryAttributes(ctx context.Context, repoName string, value *acrapi.ChangeableAttributes) (*autorest.Response, error)
+}
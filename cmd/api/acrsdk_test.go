@@ -3,7 +3,15 @@
 
 package api
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
 
 func TestLoginURLWithPrefix(t *testing.T) {
 	expectedReturn := "https://registry.azurecr.io"
@@ -58,3 +66,168 @@ func TestGetExpiration(t *testing.T) {
 		t.Fatal("Expected error while parsing token, got nil")
 	}
 }
+
+func TestSetUserAgent(t *testing.T) {
+	defer SetUserAgent("")
+	SetUserAgent("acr-cli/1.0.0 purge")
+	client := newAcrCLIClient("registry.azurecr.io")
+	if !strings.HasPrefix(client.AutorestClient.UserAgent, "acr-cli/1.0.0 purge ") {
+		t.Fatalf("User-Agent incorrect, got %s, expected it to start with acr-cli/1.0.0 purge", client.AutorestClient.UserAgent)
+	}
+	versions := APIVersions()
+	if len(versions) != 2 || !strings.HasPrefix(versions[1], "acr/") {
+		t.Fatalf("APIVersions incorrect, got %v", versions)
+	}
+}
+
+func TestBatchTagDelete(t *testing.T) {
+	ctx := context.Background()
+	deleted := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/" && r.Method == http.MethodGet:
+			w.Header().Set("X-Ms-Acr-Capabilities", "referrers, tag-batch-delete")
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/acr/v1/hello/_tags/_batchDelete" && r.Method == http.MethodPost:
+			var body batchTagDeleteRequest
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			deleted = append(deleted, body.Tags...)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := newAcrCLIClient("registry.azurecr.io")
+	client.AutorestClient.LoginURI = server.URL
+	supported, err := client.SupportsBatchTagDelete(ctx)
+	if err != nil || !supported {
+		t.Fatalf("SupportsBatchTagDelete incorrect, got %t and %v, expected true", supported, err)
+	}
+	if _, err := client.DeleteAcrTags(ctx, "hello", []string{"v1", "v2"}); err != nil {
+		t.Fatalf("Expected no error while deleting tags, got %v", err)
+	}
+	if strings.Join(deleted, ",") != "v1,v2" {
+		t.Fatalf("Deleted tags incorrect, got %v, expected [v1 v2]", deleted)
+	}
+	resp, err := client.DeleteAcrTags(ctx, "missing", []string{"v1"})
+	if err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatal("Expected not found error while deleting tags of a missing repository")
+	}
+	client.AutorestClient.LoginURI = server.URL + "/missing"
+	supported, err = client.SupportsBatchTagDelete(ctx)
+	if err != nil || supported {
+		t.Fatalf("SupportsBatchTagDelete incorrect, got %t and %v, expected false", supported, err)
+	}
+}
+
+func TestRegionalEndpoint(t *testing.T) {
+	endpoint := RegionalEndpoint("registry.azurecr.io", "West US")
+	if endpoint != "registry.westus.geo.azurecr.io" {
+		t.Fatalf("RegionalEndpoint incorrect, got %s, expected registry.westus.geo.azurecr.io", endpoint)
+	}
+}
+
+func TestHeadManifest(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/hello/manifests/v1" && r.Method == http.MethodHead:
+			w.Header().Set("Docker-Content-Digest", "sha256:abc")
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/hello/manifests/v2":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	home := newAcrCLIClient("registry.azurecr.io")
+	client := home.RegionalClient(server.URL)
+	if home.AutorestClient.LoginURI != "https://registry.azurecr.io" {
+		t.Fatalf("RegionalClient changed the endpoint of the original client to %s", home.AutorestClient.LoginURI)
+	}
+	digest, err := client.HeadManifest(ctx, "hello", "v1")
+	if err != nil || digest != "sha256:abc" {
+		t.Fatalf("HeadManifest incorrect, got %s and %v, expected sha256:abc", digest, err)
+	}
+	digest, err = client.HeadManifest(ctx, "hello", "v2")
+	if err != nil || len(digest) > 0 {
+		t.Fatalf("HeadManifest of a missing manifest incorrect, got %s and %v, expected no digest", digest, err)
+	}
+	if _, err := client.HeadManifest(ctx, "hello", "v3"); err == nil {
+		t.Fatal("Expected error while getting a manifest the registry fails to return")
+	}
+}
+
+func TestPutBlob(t *testing.T) {
+	ctx := context.Background()
+	uploaded := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/hello/blobs/uploads/" && r.Method == http.MethodPost:
+			w.Header().Set("Location", "/v2/hello/blobs/uploads/session?state=abc")
+			w.WriteHeader(http.StatusAccepted)
+		case r.URL.Path == "/v2/hello/blobs/uploads/session" && r.Method == http.MethodPut:
+			if r.URL.Query().Get("state") != "abc" || r.URL.Query().Get("digest") != "sha256:abc" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			uploaded = string(body)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	home := newAcrCLIClient("registry.azurecr.io")
+	client := home.RegionalClient(server.URL)
+	if err := client.PutBlob(ctx, "hello", "sha256:abc", []byte("{}")); err != nil || uploaded != "{}" {
+		t.Fatalf("PutBlob incorrect, uploaded %q and got %v, expected {}", uploaded, err)
+	}
+	if err := client.PutBlob(ctx, "world", "sha256:abc", []byte("{}")); err == nil {
+		t.Fatal("Expected error while uploading to a repository the registry rejects")
+	}
+}
+
+func TestPutManifest(t *testing.T) {
+	ctx := context.Background()
+	manifest := []byte(`{"schemaVersion":2}`)
+	digest := ManifestDigest(manifest)
+	contentType := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/hello/manifests/v1" && r.Method == http.MethodPut:
+			contentType = r.Header.Get("Content-Type")
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Docker-Content-Digest", ManifestDigest(body))
+			w.WriteHeader(http.StatusCreated)
+		case r.URL.Path == "/v2/hello/manifests/v2" && r.Method == http.MethodPut:
+			// The registry stored the manifest with different bytes.
+			w.Header().Set("Docker-Content-Digest", ManifestDigest([]byte("{}")))
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	home := newAcrCLIClient("registry.azurecr.io")
+	client := home.RegionalClient(server.URL)
+	resp, err := client.PutManifest(ctx, "hello", "v1", ociIndexContentType, manifest)
+	if err != nil || resp.StatusCode != http.StatusCreated || contentType != ociIndexContentType {
+		t.Fatalf("PutManifest incorrect, got %v with content type %s, expected a 201 with %s", err, contentType, ociIndexContentType)
+	}
+	if _, err := client.PutManifest(ctx, "hello", "v2", ociIndexContentType, manifest); !IsDigestMismatch(err) {
+		t.Fatalf("Expected a digest mismatch while pushing a manifest stored with another digest, got %v", err)
+	}
+	if _, err := client.PutManifest(ctx, "hello", ManifestDigest([]byte("{}")), ociIndexContentType, manifest); err == nil {
+		t.Fatal("Expected error while pushing a manifest by a digest that is not its own")
+	}
+	if _, err := client.PutManifest(ctx, "world", digest, ociIndexContentType, manifest); err == nil {
+		t.Fatal("Expected error while pushing to a repository the registry rejects")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// The values accepted for the version of the ACR API. With APIVersionAuto the newest version both the acr-cli and the
+// registry support is negotiated, LegacyAPIVersion is the version the generated client was created from and the only
+// one older registries (e.g. Azure Stack) understand, the requests made with it carry no api-version parameter.
+const (
+	APIVersionAuto   = "auto"
+	LegacyAPIVersion = "2019-07-15-preview"
+	// supportedVersionsHeader lists the versions of the ACR API a registry supports, like the capabilities header it
+	// is returned by the /v2/ endpoint.
+	supportedVersionsHeader = "Api-Supported-Versions"
+	apiVersionParameter     = "api-version"
+)
+
+// knownAPIVersions are the versions of the ACR API the acr-cli can use, from the newest to the oldest.
+var knownAPIVersions = []string{"2021-07-01", "2019-08-15", LegacyAPIVersion}
+
+// apiVersionRegex matches the format of the versions of the Azure APIs, e.g. 2021-07-01 or 2019-07-15-preview.
+var apiVersionRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(-preview)?$`)
+
+// apiVersion is the version used by the AcrCLIClients created afterwards, APIVersionAuto or a pinned version.
+var apiVersion = APIVersionAuto
+
+// SetAPIVersion pins the version of the ACR API used by the AcrCLIClients created afterwards, APIVersionAuto
+// negotiates it with the registry. A pinned version does not need to be known by the acr-cli so that newer registries
+// can be tried out.
+func SetAPIVersion(version string) error {
+	if version != APIVersionAuto && !apiVersionRegex.MatchString(version) {
+		return fmt.Errorf("invalid api-version %s, it should be %s or a version like %s", version, APIVersionAuto, knownAPIVersions[0])
+	}
+	apiVersion = version
+	return nil
+}
+
+// APIVersionAtLeast returns true if the version is the same as or newer than min, a preview is older than the release
+// of the same day.
+func APIVersionAtLeast(version string, min string) bool {
+	if len(version) < 10 || len(min) < 10 || version[:10] != min[:10] {
+		return version >= min
+	}
+	return !strings.HasSuffix(version, "-preview") || strings.HasSuffix(min, "-preview")
+}
+
+// APIVersion returns the version of the ACR API the client uses.
+func (c *AcrCLIClient) APIVersion() string {
+	if len(c.apiVersion) == 0 {
+		return LegacyAPIVersion
+	}
+	return c.apiVersion
+}
+
+// setAPIVersion makes the client send the version in every request to the ACR API.
+func (c *AcrCLIClient) setAPIVersion(version string) {
+	c.apiVersion = version
+	sender := c.AutorestClient.Sender
+	if versioned, ok := sender.(apiVersionSender); ok {
+		sender = versioned.sender
+	}
+	if version == LegacyAPIVersion {
+		c.AutorestClient.Sender = sender
+		return
+	}
+	c.AutorestClient.Sender = apiVersionSender{sender: sender, version: version}
+}
+
+// NegotiateAPIVersion picks the newest version of the ACR API supported by both the acr-cli and the registry, the
+// registry lists the versions it supports in a header of the /v2/ endpoint. Registries that do not return the header
+// only support LegacyAPIVersion.
+func (c *AcrCLIClient) NegotiateAPIVersion(ctx context.Context) (string, error) {
+	urlParameters := map[string]interface{}{
+		"url": c.AutorestClient.LoginURI,
+	}
+	preparer := autorest.CreatePreparer(
+		autorest.AsGet(),
+		autorest.WithCustomBaseURL("{url}", urlParameters),
+		autorest.WithPath("/v2/"))
+	req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		return "", autorest.NewErrorWithError(err, "acr.BaseClient", "NegotiateAPIVersion", nil, "Failure preparing request")
+	}
+	// The header is also returned when the request is not authorized, so no token is needed.
+	resp, err := autorest.SendWithSender(c.AutorestClient, req,
+		autorest.DoRetryForStatusCodes(c.AutorestClient.RetryAttempts, c.AutorestClient.RetryDuration, autorest.StatusCodesForRetry...))
+	if err != nil {
+		return "", autorest.NewErrorWithError(err, "acr.BaseClient", "NegotiateAPIVersion", resp, "Failure sending request")
+	}
+	autorest.Respond(resp, autorest.ByDiscardingBody(), autorest.ByClosing())
+	supported := map[string]bool{}
+	for _, value := range resp.Header[http.CanonicalHeaderKey(supportedVersionsHeader)] {
+		for _, version := range strings.Split(value, ",") {
+			supported[strings.TrimSpace(version)] = true
+		}
+	}
+	version := LegacyAPIVersion
+	for _, known := range knownAPIVersions {
+		if supported[known] {
+			version = known
+			break
+		}
+	}
+	c.setAPIVersion(version)
+	return version, nil
+}
+
+// apiVersionSender adds the api-version parameter to the requests to the ACR API, the requests to the distribution
+// API and to the token endpoint are not versioned.
+type apiVersionSender struct {
+	sender  autorest.Sender
+	version string
+}
+
+// Do sends the request with the api-version parameter.
+func (s apiVersionSender) Do(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.URL.Path, "/acr/") {
+		query := req.URL.Query()
+		if len(query.Get(apiVersionParameter)) == 0 {
+			query.Set(apiVersionParameter, s.version)
+			req.URL.RawQuery = query.Encode()
+		}
+	}
+	return s.sender.Do(req)
+}
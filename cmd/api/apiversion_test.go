@@ -0,0 +1,97 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	ctx := context.Background()
+	supported := ""
+	queries := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries[r.URL.Path] = r.URL.Query().Get("api-version")
+		if len(supported) > 0 {
+			w.Header().Set("Api-Supported-Versions", supported)
+		}
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/acr/v1/hello/_tags":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"registry":"registry.azurecr.io","imageName":"hello","tags":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	// The newest version known by both sides is used, the versions the acr-cli does not know are ignored.
+	supported = "2019-08-15, 2021-07-01, 2099-01-01"
+	client := newAcrCLIClient("registry.azurecr.io")
+	client.AutorestClient.LoginURI = server.URL
+	version, err := client.NegotiateAPIVersion(ctx)
+	if err != nil || version != "2021-07-01" || client.APIVersion() != "2021-07-01" {
+		t.Fatalf("NegotiateAPIVersion incorrect, got %s and %v, expected 2021-07-01", version, err)
+	}
+	if _, err := client.GetAcrTags(ctx, "hello", "", ""); err != nil {
+		t.Fatalf("Expected no error while listing tags, got %v", err)
+	}
+	if queries["/acr/v1/hello/_tags"] != "2021-07-01" || len(queries["/v2/"]) > 0 {
+		t.Fatalf("api-version parameters incorrect, got %v", queries)
+	}
+
+	// A registry that does not advertise any version only supports the legacy one, no parameter is sent.
+	supported = ""
+	client = newAcrCLIClient("registry.azurecr.io")
+	client.AutorestClient.LoginURI = server.URL
+	version, err = client.NegotiateAPIVersion(ctx)
+	if err != nil || version != LegacyAPIVersion {
+		t.Fatalf("NegotiateAPIVersion incorrect, got %s and %v, expected %s", version, err, LegacyAPIVersion)
+	}
+	if _, err := client.GetAcrTags(ctx, "hello", "", ""); err != nil {
+		t.Fatalf("Expected no error while listing tags, got %v", err)
+	}
+	if len(queries["/acr/v1/hello/_tags"]) > 0 {
+		t.Fatalf("Expected no api-version parameter, got %s", queries["/acr/v1/hello/_tags"])
+	}
+}
+
+func TestSetAPIVersion(t *testing.T) {
+	defer SetAPIVersion(APIVersionAuto)
+	if err := SetAPIVersion("latest"); err == nil {
+		t.Fatal("Expected error while setting an invalid api-version")
+	}
+	if err := SetAPIVersion("2019-08-15"); err != nil {
+		t.Fatalf("Expected no error while pinning the api-version, got %v", err)
+	}
+	client := newAcrCLIClient("registry.azurecr.io")
+	if client.APIVersion() != "2019-08-15" {
+		t.Fatalf("APIVersion incorrect, got %s, expected the pinned 2019-08-15", client.APIVersion())
+	}
+}
+
+func TestAPIVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version  string
+		min      string
+		expected bool
+	}{
+		{"2021-07-01", "2019-08-15", true},
+		{"2019-08-15", "2021-07-01", false},
+		{"2021-07-01", "2021-07-01", true},
+		{"2021-07-01-preview", "2021-07-01", false},
+		{"2021-07-01", "2021-07-01-preview", true},
+		{LegacyAPIVersion, "2019-08-15", false},
+	}
+	for _, test := range tests {
+		if APIVersionAtLeast(test.version, test.min) != test.expected {
+			t.Fatalf("APIVersionAtLeast(%s, %s) incorrect, expected %t", test.version, test.min, test.expected)
+		}
+	}
+}
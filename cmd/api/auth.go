@@ -0,0 +1,275 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	dockerAuth "github.com/Azure/acr-cli/auth/docker"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// The modes accepted by SetAuthMode, every mode but AuthModeAuto uses a single provider. AuthModeAuto tries the
+// providers of autoAuthModes in order and uses the first one that has a credential for the registry.
+const (
+	AuthModeAuto         = "auto"
+	AuthModeBasic        = "basic"
+	AuthModeDockerConfig = "docker-config"
+	AuthModeAAD          = "aad"
+	AuthModeTokenFile    = "token-file"
+	AuthModeAnonymous    = "anonymous"
+	// aadExchangeGrantType exchanges an AAD access token for an ACR refresh token.
+	aadExchangeGrantType = "access_token"
+)
+
+// Credential is what an AuthProvider resolves for a registry. An empty Username means that Password is an ACR refresh
+// token, an empty Password means that the requests are anonymous.
+type Credential struct {
+	Username string
+	Password string
+}
+
+// AuthOptions are the settings of the command line the providers can read, e.g. the username and password flags.
+type AuthOptions struct {
+	Username  string
+	Password  string
+	Configs   []string
+	TokenFile string
+}
+
+// AuthProvider resolves the credential for a registry. A provider that has no credential for the registry returns
+// false so that the next provider of the chain is tried, an error stops the chain.
+type AuthProvider interface {
+	Name() string
+	Credential(ctx context.Context, loginURL string) (Credential, bool, error)
+}
+
+// authProviders creates the provider of every auth mode, new mechanisms (e.g. workload identity) are added with
+// RegisterAuthProvider and work with every command.
+var authProviders = map[string]func(AuthOptions) AuthProvider{
+	AuthModeBasic:        func(options AuthOptions) AuthProvider { return basicProvider{options.Username, options.Password} },
+	AuthModeDockerConfig: func(options AuthOptions) AuthProvider { return dockerConfigProvider{options.Configs} },
+	AuthModeAAD:          func(options AuthOptions) AuthProvider { return aadProvider{tokenProvider: getAADTokenProvider} },
+	AuthModeTokenFile:    func(options AuthOptions) AuthProvider { return tokenFileProvider{options.TokenFile} },
+	AuthModeAnonymous:    func(options AuthOptions) AuthProvider { return anonymousProvider{} },
+}
+
+// autoAuthModes are the providers AuthModeAuto tries, in order. The AAD and anonymous providers are only used when they
+// are asked for because they would hide a missing login.
+var autoAuthModes = []string{AuthModeBasic, AuthModeTokenFile, AuthModeDockerConfig}
+
+// authMode and tokenFile are used by the clients created afterwards.
+var (
+	authMode  = AuthModeAuto
+	tokenFile string
+)
+
+// RegisterAuthProvider adds an auth mode, if auto is set the provider is also tried by AuthModeAuto after the others.
+func RegisterAuthProvider(mode string, newProvider func(AuthOptions) AuthProvider, auto bool) {
+	authProviders[mode] = newProvider
+	if auto {
+		autoAuthModes = append(autoAuthModes, mode)
+	}
+}
+
+// AuthModes returns the accepted auth modes, sorted.
+func AuthModes() []string {
+	modes := []string{AuthModeAuto}
+	for mode := range authProviders {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+// SetAuthMode sets how the clients created afterwards authenticate, AuthModeAuto tries the usual providers in order.
+func SetAuthMode(mode string) error {
+	if _, ok := authProviders[mode]; !ok && mode != AuthModeAuto {
+		return fmt.Errorf("invalid auth-mode %s, it should be one of %s", mode, strings.Join(AuthModes(), ", "))
+	}
+	authMode = mode
+	return nil
+}
+
+// SetTokenFile sets the file the token-file provider reads the ACR refresh token from.
+func SetTokenFile(path string) {
+	tokenFile = path
+}
+
+// NewAuthChain returns the providers of the auth mode, in the order they are tried.
+func NewAuthChain(mode string, options AuthOptions) []AuthProvider {
+	modes := []string{mode}
+	if mode == AuthModeAuto {
+		modes = autoAuthModes
+	}
+	chain := []AuthProvider{}
+	for _, m := range modes {
+		if newProvider, ok := authProviders[m]; ok {
+			chain = append(chain, newProvider(options))
+		}
+	}
+	return chain
+}
+
+// ResolveCredential returns the credential of the first provider of the chain that has one for the registry.
+func ResolveCredential(ctx context.Context, chain []AuthProvider, loginURL string) (Credential, error) {
+	names := []string{}
+	for _, provider := range chain {
+		credential, ok, err := provider.Credential(ctx, loginURL)
+		if err != nil {
+			return Credential{}, newAuthError(err, "error resolving authentication with "+provider.Name())
+		}
+		if ok {
+			return credential, nil
+		}
+		names = append(names, provider.Name())
+	}
+	return Credential{}, &AuthError{err: fmt.Errorf("unable to resolve authentication, missing identity token or password (tried %s)", strings.Join(names, ", "))}
+}
+
+// basicProvider uses the username and password flags, a password without username is an ACR refresh token.
+type basicProvider struct {
+	username string
+	password string
+}
+
+// Name returns the auth mode of the provider.
+func (p basicProvider) Name() string {
+	return AuthModeBasic
+}
+
+// Credential returns the flags if the password was specified.
+func (p basicProvider) Credential(ctx context.Context, loginURL string) (Credential, bool, error) {
+	if len(p.password) == 0 {
+		if len(p.username) > 0 {
+			return Credential{}, false, errors.New("a password is required with the username")
+		}
+		return Credential{}, false, nil
+	}
+	return Credential{Username: p.username, Password: p.password}, true, nil
+}
+
+// dockerConfigProvider reads the credentials stored by docker login or acr login, from the default location or from
+// the configs.
+type dockerConfigProvider struct {
+	configs []string
+}
+
+// Name returns the auth mode of the provider.
+func (p dockerConfigProvider) Name() string {
+	return AuthModeDockerConfig
+}
+
+// Credential returns the credential stored for the registry.
+func (p dockerConfigProvider) Credential(ctx context.Context, loginURL string) (Credential, bool, error) {
+	client, err := dockerAuth.NewClient(p.configs...)
+	if err != nil {
+		return Credential{}, false, err
+	}
+	username, password, err := client.GetCredential(loginURL)
+	if err != nil {
+		return Credential{}, false, err
+	}
+	return Credential{Username: username, Password: password}, len(password) > 0, nil
+}
+
+// tokenFileProvider reads an ACR refresh token from a file, e.g. one kept up to date by a sidecar. The file is read
+// every time a client is created so that a rotated token is picked up.
+type tokenFileProvider struct {
+	path string
+}
+
+// Name returns the auth mode of the provider.
+func (p tokenFileProvider) Name() string {
+	return AuthModeTokenFile
+}
+
+// Credential returns the refresh token of the file, if a file was specified.
+func (p tokenFileProvider) Credential(ctx context.Context, loginURL string) (Credential, bool, error) {
+	if len(p.path) == 0 {
+		return Credential{}, false, nil
+	}
+	content, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return Credential{}, false, fmt.Errorf("failed to read the token file: %w", err)
+	}
+	token := strings.TrimSpace(string(content))
+	if len(token) == 0 {
+		return Credential{}, false, fmt.Errorf("the token file %s is empty", p.path)
+	}
+	return Credential{Password: token}, true, nil
+}
+
+// aadProvider exchanges an Azure Active Directory token, of the service principal of the AZURE_TENANT_ID,
+// AZURE_CLIENT_ID and AZURE_CLIENT_SECRET environment variables or of the Azure CLI, for an ACR refresh token.
+type aadProvider struct {
+	tokenProvider func(env azure.Environment) (adal.OAuthTokenProvider, error)
+}
+
+// Name returns the auth mode of the provider.
+func (p aadProvider) Name() string {
+	return AuthModeAAD
+}
+
+// Credential returns the ACR refresh token the registry issued for the AAD token, the token is requested from the
+// cloud of the registry.
+func (p aadProvider) Credential(ctx context.Context, loginURL string) (Credential, bool, error) {
+	tokenProvider, err := p.tokenProvider(cloudEnvironment(loginURL))
+	if err != nil {
+		return Credential{}, false, err
+	}
+	if refresher, ok := tokenProvider.(adal.RefresherWithContext); ok {
+		if err := refresher.EnsureFreshWithContext(ctx); err != nil {
+			return Credential{}, false, fmt.Errorf("failed to get an Azure Active Directory token: %w", err)
+		}
+	}
+	client := newAcrCLIClient(loginURL)
+	refreshToken, err := client.AutorestClient.GetAcrRefreshTokenFromExchange(ctx, aadExchangeGrantType, loginURL, os.Getenv("AZURE_TENANT_ID"), "", tokenProvider.OAuthToken())
+	if err != nil {
+		return Credential{}, false, fmt.Errorf("failed to exchange the Azure Active Directory token: %w", err)
+	}
+	if refreshToken.RefreshToken == nil {
+		return Credential{}, false, errors.New("the registry did not return a refresh token")
+	}
+	return Credential{Password: *refreshToken.RefreshToken}, true, nil
+}
+
+// sovereignClouds are the clouds other than the public cloud whose registries have their own DNS suffix.
+var sovereignClouds = []azure.Environment{azure.ChinaCloud, azure.USGovernmentCloud}
+
+// cloudEnvironment returns the cloud of a registry from the DNS suffix of its login server, e.g. the China cloud for
+// example.azurecr.cn. The registries of the public cloud and the ones reached through another host, e.g. a connected
+// registry, are in the public cloud.
+func cloudEnvironment(loginURL string) azure.Environment {
+	host := strings.ToLower(loginURL)
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	for _, env := range sovereignClouds {
+		if strings.HasSuffix(host, "."+env.ContainerRegistryDNSSuffix) {
+			return env
+		}
+	}
+	return azure.PublicCloud
+}
+
+// anonymousProvider makes the requests without credentials, only registries that allow anonymous access answer them.
+type anonymousProvider struct{}
+
+// Name returns the auth mode of the provider.
+func (p anonymousProvider) Name() string {
+	return AuthModeAnonymous
+}
+
+// Credential returns an empty credential.
+func (p anonymousProvider) Credential(ctx context.Context, loginURL string) (Credential, bool, error) {
+	return Credential{}, true, nil
+}
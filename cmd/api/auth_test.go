@@ -0,0 +1,153 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+func TestResolveCredential(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenPath := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenPath, []byte("refresh-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The docker config has no credential for the registry, so it is skipped by the chain.
+	configPath := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(`{"auths":{}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flags are used before the token file.
+	chain := NewAuthChain(AuthModeAuto, AuthOptions{Username: "user", Password: "pass", Configs: []string{configPath}, TokenFile: tokenPath})
+	credential, err := ResolveCredential(ctx, chain, "registry.azurecr.io")
+	if err != nil || credential != (Credential{Username: "user", Password: "pass"}) {
+		t.Fatalf("ResolveCredential incorrect, got %v and %v, expected the flags", credential, err)
+	}
+
+	// Without flags the token file is read, the token is a refresh token.
+	chain = NewAuthChain(AuthModeAuto, AuthOptions{Configs: []string{configPath}, TokenFile: tokenPath})
+	credential, err = ResolveCredential(ctx, chain, "registry.azurecr.io")
+	if err != nil || credential != (Credential{Password: "refresh-token"}) {
+		t.Fatalf("ResolveCredential incorrect, got %v and %v, expected the refresh token of the file", credential, err)
+	}
+
+	// A username without password is an error instead of falling through to the next provider.
+	chain = NewAuthChain(AuthModeAuto, AuthOptions{Username: "user", Configs: []string{configPath}, TokenFile: tokenPath})
+	if _, err := ResolveCredential(ctx, chain, "registry.azurecr.io"); err == nil {
+		t.Fatal("Expected error while resolving a username without password")
+	}
+
+	// The anonymous mode resolves an empty credential even if the flags are set.
+	chain = NewAuthChain(AuthModeAnonymous, AuthOptions{Username: "user", Password: "pass"})
+	credential, err = ResolveCredential(ctx, chain, "registry.azurecr.io")
+	if err != nil || credential != (Credential{}) {
+		t.Fatalf("ResolveCredential incorrect, got %v and %v, expected an empty credential", credential, err)
+	}
+
+	// A chain without credentials returns an AuthError that names the providers that were tried.
+	chain = NewAuthChain(AuthModeTokenFile, AuthOptions{})
+	_, err = ResolveCredential(ctx, chain, "registry.azurecr.io")
+	if _, ok := err.(*AuthError); !ok || !strings.Contains(err.Error(), AuthModeTokenFile) {
+		t.Fatalf("Expected an AuthError naming the token-file provider, got %v", err)
+	}
+}
+
+func TestAADProvider(t *testing.T) {
+	ctx := context.Background()
+	var form map[string]string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/exchange" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		r.ParseForm()
+		form = map[string]string{"grant_type": r.PostForm.Get("grant_type"), "access_token": r.PostForm.Get("access_token")}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"refresh_token":"acr-refresh-token"}`))
+	}))
+	defer server.Close()
+	defer func(client *http.Client) { httpClient = client }(httpClient)
+	httpClient = server.Client()
+	loginURL := strings.TrimPrefix(server.URL, "https://")
+
+	provider := aadProvider{tokenProvider: func(env azure.Environment) (adal.OAuthTokenProvider, error) {
+		return &adal.Token{AccessToken: "aad-token"}, nil
+	}}
+	credential, ok, err := provider.Credential(ctx, loginURL)
+	if err != nil || !ok || credential != (Credential{Password: "acr-refresh-token"}) {
+		t.Fatalf("Credential incorrect, got %v, %t and %v, expected the exchanged refresh token", credential, ok, err)
+	}
+	if form["grant_type"] != "access_token" || form["access_token"] != "aad-token" {
+		t.Fatalf("Exchange request incorrect, got %v", form)
+	}
+
+	// The AAD token errors are not hidden by the chain.
+	provider = aadProvider{tokenProvider: func(env azure.Environment) (adal.OAuthTokenProvider, error) {
+		return nil, errors.New("not logged in")
+	}}
+	if _, err := ResolveCredential(ctx, []AuthProvider{provider}, loginURL); err == nil {
+		t.Fatal("Expected error while resolving without an AAD token")
+	}
+}
+
+func TestCloudEnvironment(t *testing.T) {
+	tables := []struct {
+		loginURL string
+		cloud    string
+	}{
+		{"example.azurecr.io", azure.PublicCloud.Name},
+		{"example.azurecr.cn", azure.ChinaCloud.Name},
+		{"example.eastus.data.azurecr.us", azure.USGovernmentCloud.Name},
+		{"Example.AzureCR.us:443", azure.USGovernmentCloud.Name},
+		{"localhost:8080", azure.PublicCloud.Name},
+	}
+	for _, table := range tables {
+		if env := cloudEnvironment(table.loginURL); env.Name != table.cloud {
+			t.Fatalf("Cloud of %s incorrect, got %s, expected %s", table.loginURL, env.Name, table.cloud)
+		}
+	}
+
+	// The AAD token is requested from the cloud of the registry.
+	var requested string
+	provider := aadProvider{tokenProvider: func(env azure.Environment) (adal.OAuthTokenProvider, error) {
+		requested = env.Name
+		return nil, errors.New("not logged in")
+	}}
+	provider.Credential(context.Background(), "example.azurecr.cn")
+	if requested != azure.ChinaCloud.Name {
+		t.Fatalf("Cloud of the AAD token incorrect, got %s, expected %s", requested, azure.ChinaCloud.Name)
+	}
+}
+
+func TestSetAuthMode(t *testing.T) {
+	defer SetAuthMode(AuthModeAuto)
+	if err := SetAuthMode("kerberos"); err == nil {
+		t.Fatal("Expected error while setting an invalid auth-mode")
+	}
+	if err := SetAuthMode(AuthModeAnonymous); err != nil {
+		t.Fatalf("Expected no error while setting the anonymous auth-mode, got %v", err)
+	}
+	// The anonymous client has no authorizer.
+	client, err := GetAcrCLIClientWithAuth("localhost:1", "", "", nil)
+	if err != nil || client.AutorestClient.Authorizer != nil {
+		t.Fatalf("GetAcrCLIClientWithAuth incorrect, got %v, expected an anonymous client", err)
+	}
+}
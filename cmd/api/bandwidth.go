@@ -0,0 +1,138 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	units "github.com/docker/go-units"
+)
+
+// BandwidthLimiter caps the number of concurrent downloads of manifest and blob bodies and the bytes downloaded per
+// second, so that resolving thousands of manifests does not saturate a small link. Every download calls Acquire before
+// it starts and Release with its size once it is done, the size is only known afterwards so the rate is an average
+// over consecutive downloads. A single limiter can be shared by every client of a process.
+type BandwidthLimiter struct {
+	// bytesPerSecond is the average rate of the downloads, 0 if it is not limited.
+	bytesPerSecond float64
+	// slots has a slot for every download that can run concurrently, it is nil if their number is not limited.
+	slots chan struct{}
+	mu    sync.Mutex
+	// next is when the bytes downloaded so far are within the rate, downloads wait until then to start.
+	next time.Time
+}
+
+// NewBandwidthLimiter creates a limiter of the bytes downloaded per second and of the concurrent downloads, 0 does not
+// limit either of them.
+func NewBandwidthLimiter(bytesPerSecond int64, maxDownloads int) *BandwidthLimiter {
+	l := &BandwidthLimiter{bytesPerSecond: float64(bytesPerSecond)}
+	if maxDownloads > 0 {
+		l.slots = make(chan struct{}, maxDownloads)
+	}
+	return l
+}
+
+// ParseBandwidth parses a rate like 10MB or 512KB/s into bytes per second, the units are decimal.
+func ParseBandwidth(value string) (int64, error) {
+	bytesPerSecond, err := units.FromHumanSize(strings.TrimSuffix(strings.TrimSpace(value), "/s"))
+	if err != nil || bytesPerSecond <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q, expected a positive size per second like 10MB", value)
+	}
+	return bytesPerSecond, nil
+}
+
+// Acquire waits for a download slot and for the previous downloads to be within the rate.
+func (l *BandwidthLimiter) Acquire(ctx context.Context) error {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if delay := l.delay(time.Now()); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			l.release()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Release records the size of a finished download and frees its slot, it must be called once for every successful
+// Acquire, with 0 if the download failed.
+func (l *BandwidthLimiter) Release(size int) {
+	l.record(size, time.Now())
+	l.release()
+}
+
+// release frees a download slot.
+func (l *BandwidthLimiter) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// delay returns how long a download must wait to start.
+func (l *BandwidthLimiter) delay(now time.Time) time.Duration {
+	if l.bytesPerSecond <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.next.Sub(now)
+}
+
+// record pushes back the start of the next downloads by the time the bytes take at the rate.
+func (l *BandwidthLimiter) record(size int, now time.Time) {
+	if l.bytesPerSecond <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(size) / l.bytesPerSecond * float64(time.Second)))
+}
+
+// BandwidthLimitedClient wraps an AcrCLIClientInterface and downloads the bodies of the manifests and blobs through a
+// limiter, the other requests are small and are sent as they are.
+type BandwidthLimitedClient struct {
+	AcrCLIClientInterface
+	limiter *BandwidthLimiter
+}
+
+// NewBandwidthLimitedClient creates a client whose downloads go through the limiter.
+func NewBandwidthLimitedClient(client AcrCLIClientInterface, limiter *BandwidthLimiter) *BandwidthLimitedClient {
+	return &BandwidthLimitedClient{AcrCLIClientInterface: client, limiter: limiter}
+}
+
+// GetManifest downloads the body of a manifest once the limiter allows it.
+func (c *BandwidthLimitedClient) GetManifest(ctx context.Context, repoName string, reference string) ([]byte, error) {
+	if err := c.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	manifestBytes, err := c.AcrCLIClientInterface.GetManifest(ctx, repoName, reference)
+	c.limiter.Release(len(manifestBytes))
+	return manifestBytes, err
+}
+
+// GetBlob downloads a blob once the limiter allows it.
+func (c *BandwidthLimitedClient) GetBlob(ctx context.Context, repoName string, digest string) ([]byte, error) {
+	if err := c.limiter.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	blobBytes, err := c.AcrCLIClientInterface.GetBlob(ctx, repoName, digest)
+	c.limiter.Release(len(blobBytes))
+	return blobBytes, err
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBandwidthLimiter contains the tests for the limits of the downloads.
+func TestBandwidthLimiter(t *testing.T) {
+	ctx := context.Background()
+	// First test, the rates are parsed with decimal units and an optional per second suffix.
+	t.Run("ParseBandwidthTest", func(t *testing.T) {
+		assert := assert.New(t)
+		bytesPerSecond, err := ParseBandwidth("10MB")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(int64(10000000), bytesPerSecond)
+		bytesPerSecond, err = ParseBandwidth("512KB/s")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(int64(512000), bytesPerSecond)
+		for _, value := range []string{"", "fast", "0", "-1MB"} {
+			_, err = ParseBandwidth(value)
+			assert.NotEqual(nil, err, value)
+		}
+	})
+	// Second test, the downloads are delayed by the time their bytes take at the rate.
+	t.Run("RateTest", func(t *testing.T) {
+		assert := assert.New(t)
+		limiter := NewBandwidthLimiter(1000, 0)
+		now := time.Now()
+		assert.Equal(true, limiter.delay(now) <= 0)
+		limiter.record(500, now)
+		assert.Equal(500*time.Millisecond, limiter.delay(now))
+		limiter.record(1000, now)
+		assert.Equal(1500*time.Millisecond, limiter.delay(now))
+		assert.Equal(true, limiter.delay(now.Add(2*time.Second)) <= 0)
+		unlimited := NewBandwidthLimiter(0, 0)
+		unlimited.record(1000000, now)
+		assert.Equal(time.Duration(0), unlimited.delay(now))
+	})
+	// Third test, a download waits for a free slot until the context is done.
+	t.Run("SlotsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		limiter := NewBandwidthLimiter(0, 1)
+		assert.Equal(nil, limiter.Acquire(ctx), "Error should be nil")
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.NotEqual(nil, limiter.Acquire(timeoutCtx), "Error should not be nil")
+		limiter.Release(0)
+		assert.Equal(nil, limiter.Acquire(ctx), "Error should be nil")
+		limiter.Release(0)
+	})
+	// Fourth test, the client downloads the bodies through the limiter.
+	t.Run("ClientTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", ctx, "hello", "latest").Return([]byte("manifest"), nil).Once()
+		mockClient.On("GetBlob", ctx, "hello", "sha256:config").Return([]byte("config"), nil).Once()
+		limiter := NewBandwidthLimiter(1000000, 1)
+		client := NewBandwidthLimitedClient(mockClient, limiter)
+		manifestBytes, err := client.GetManifest(ctx, "hello", "latest")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]byte("manifest"), manifestBytes)
+		blobBytes, err := client.GetBlob(ctx, "hello", "sha256:config")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]byte("config"), blobBytes)
+		assert.Equal(0, len(limiter.slots))
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,304 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// DefaultBlobChunkSize is the size of the chunks UploadBlob sends when no chunk size is specified.
+const DefaultBlobChunkSize = 8 << 20
+
+// BlobUpload is an upload session of a blob. It only contains strings and numbers so that it can be saved, e.g. as
+// JSON, and passed again to UploadBlob to resume the upload of a large layer after a failure.
+type BlobUpload struct {
+	RepoName string `json:"repository"`
+	// Location is the URL the next chunk is sent to, the registry returns a new one after every request.
+	Location string `json:"location"`
+	// Offset is the number of bytes the registry received so far.
+	Offset int64 `json:"offset"`
+}
+
+// BlobUploader is implemented by the clients that can check, mount and upload the blobs of a repository, the
+// building blocks of copying and pushing images.
+type BlobUploader interface {
+	HeadBlob(ctx context.Context, repoName string, digest string) (int64, bool, error)
+	MountBlob(ctx context.Context, repoName string, fromRepo string, digest string) (*BlobUpload, error)
+	StartBlobUpload(ctx context.Context, repoName string) (*BlobUpload, error)
+	ResumeBlobUpload(ctx context.Context, upload *BlobUpload) error
+	UploadBlobChunk(ctx context.Context, upload *BlobUpload, chunk []byte) error
+	CompleteBlobUpload(ctx context.Context, upload *BlobUpload, digest string, content []byte) error
+}
+
+// BlobReader is implemented by the clients that can stream a blob instead of returning it as a byte array, the layers
+// of several gigabytes are copied with it.
+type BlobReader interface {
+	OpenBlob(ctx context.Context, repoName string, digest string) (io.ReadCloser, error)
+}
+
+// UploadBlob uploads the size bytes of a blob in chunks of chunkSize (DefaultBlobChunkSize if it is 0) and completes
+// the upload, the content must match the digest. A nil upload starts a new session, otherwise the session is resumed
+// from the offset the registry reports, so the upload returned with an error can be passed again to continue it.
+func UploadBlob(ctx context.Context, client BlobUploader, repoName string, digest string, content io.ReaderAt, size int64, chunkSize int, upload *BlobUpload) (*BlobUpload, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultBlobChunkSize
+	}
+	var err error
+	if upload == nil {
+		if upload, err = client.StartBlobUpload(ctx, repoName); err != nil {
+			return nil, err
+		}
+	} else if err = client.ResumeBlobUpload(ctx, upload); err != nil {
+		return upload, err
+	}
+	for upload.Offset < size {
+		length := int64(chunkSize)
+		if upload.Offset+length > size {
+			length = size - upload.Offset
+		}
+		chunk := make([]byte, length)
+		if _, err := content.ReadAt(chunk, upload.Offset); err != nil && !errors.Is(err, io.EOF) {
+			return upload, fmt.Errorf("failed to read the blob %s: %w", digest, err)
+		}
+		if err := client.UploadBlobChunk(ctx, upload, chunk); err != nil {
+			return upload, err
+		}
+	}
+	return upload, client.CompleteBlobUpload(ctx, upload, digest, nil)
+}
+
+// UploadBlobStream uploads a blob read from content in chunks of chunkSize (DefaultBlobChunkSize if it is 0) and
+// completes the upload, the content must match the digest. Only one chunk is held in memory, so a blob streamed from
+// another registry can be of any size.
+func UploadBlobStream(ctx context.Context, client BlobUploader, repoName string, digest string, content io.Reader, chunkSize int) error {
+	if chunkSize <= 0 {
+		chunkSize = DefaultBlobChunkSize
+	}
+	upload, err := client.StartBlobUpload(ctx, repoName)
+	if err != nil {
+		return err
+	}
+	chunk := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(content, chunk)
+		if n > 0 {
+			if err := client.UploadBlobChunk(ctx, upload, chunk[:n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the blob %s: %w", digest, err)
+		}
+	}
+	return client.CompleteBlobUpload(ctx, upload, digest, nil)
+}
+
+// HeadBlob returns the size of a blob of the repository, the second return value is false if the blob does not exist.
+func (c *AcrCLIClient) HeadBlob(ctx context.Context, repoName string, digest string) (int64, bool, error) {
+	resp, err := c.sendBlobRequest(ctx, "HeadBlob", repoName, PermissionContentRead, []autorest.PrepareDecorator{
+		autorest.AsHead(),
+		c.blobPath(repoName, "/blobs/{digest}", map[string]interface{}{"digest": autorest.Encode("path", digest)}),
+	}, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return 0, false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, false, nil
+	}
+	return resp.ContentLength, true, nil
+}
+
+// MountBlob makes a blob of fromRepo available in the repository without uploading it, the registry copies its
+// reference. It returns nil if the blob was mounted, if the registry cannot mount it (e.g. the blob is not in fromRepo)
+// it returns the upload session the registry started instead.
+func (c *AcrCLIClient) MountBlob(ctx context.Context, repoName string, fromRepo string, digest string) (*BlobUpload, error) {
+	resp, err := c.sendBlobRequest(ctx, "MountBlob", repoName, PermissionContentWrite, []autorest.PrepareDecorator{
+		autorest.AsPost(),
+		c.blobPath(repoName, "/blobs/uploads/", nil),
+		autorest.WithQueryParameters(map[string]interface{}{
+			"mount": autorest.Encode("query", digest),
+			"from":  autorest.Encode("query", fromRepo),
+		}),
+	}, http.StatusCreated, http.StatusAccepted)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusCreated {
+		return nil, nil
+	}
+	return newBlobUpload(repoName, resp)
+}
+
+// StartBlobUpload starts an upload session in the repository.
+func (c *AcrCLIClient) StartBlobUpload(ctx context.Context, repoName string) (*BlobUpload, error) {
+	resp, err := c.sendBlobRequest(ctx, "StartBlobUpload", repoName, PermissionContentWrite, []autorest.PrepareDecorator{
+		autorest.AsPost(),
+		c.blobPath(repoName, "/blobs/uploads/", nil),
+	}, http.StatusAccepted)
+	if err != nil {
+		return nil, err
+	}
+	return newBlobUpload(repoName, resp)
+}
+
+// ResumeBlobUpload asks the registry how many bytes of the upload it received, the chunks that follow start there.
+func (c *AcrCLIClient) ResumeBlobUpload(ctx context.Context, upload *BlobUpload) error {
+	resp, err := c.sendBlobRequest(ctx, "ResumeBlobUpload", upload.RepoName, PermissionContentWrite, []autorest.PrepareDecorator{
+		autorest.AsGet(),
+		autorest.WithBaseURL(upload.Location),
+	}, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	upload.Offset = 0
+	upload.update(resp, 0)
+	return nil
+}
+
+// UploadBlobChunk sends the chunk that starts at the offset of the upload.
+func (c *AcrCLIClient) UploadBlobChunk(ctx context.Context, upload *BlobUpload, chunk []byte) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+	resp, err := c.sendBlobRequest(ctx, "UploadBlobChunk", upload.RepoName, PermissionContentWrite, []autorest.PrepareDecorator{
+		autorest.AsPatch(),
+		autorest.WithBaseURL(upload.Location),
+		autorest.AsContentType("application/octet-stream"),
+		autorest.WithHeader("Content-Range", fmt.Sprintf("%d-%d", upload.Offset, upload.Offset+int64(len(chunk))-1)),
+		autorest.WithString(string(chunk)),
+	}, http.StatusAccepted)
+	if err != nil {
+		return err
+	}
+	upload.update(resp, int64(len(chunk)))
+	return nil
+}
+
+// CompleteBlobUpload finishes the upload with the content that was not sent in chunks, which can be empty, the
+// registry checks that all the bytes it received match the digest. The digest the registry returns is checked too.
+func (c *AcrCLIClient) CompleteBlobUpload(ctx context.Context, upload *BlobUpload, digest string, content []byte) error {
+	location, err := withQuery(upload.Location, "digest", digest)
+	if err != nil {
+		return fmt.Errorf("failed to complete the upload of %s@%s: %w", upload.RepoName, digest, err)
+	}
+	decorators := []autorest.PrepareDecorator{
+		autorest.AsPut(),
+		autorest.WithBaseURL(location),
+		autorest.AsContentType("application/octet-stream"),
+	}
+	if len(content) > 0 {
+		decorators = append(decorators, autorest.WithString(string(content)))
+	}
+	resp, err := c.sendBlobRequest(ctx, "CompleteBlobUpload", upload.RepoName, PermissionContentWrite, decorators, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	upload.Offset += int64(len(content))
+	if stored := resp.Header.Get(dockerContentDigestHeader); isDigest(stored) && isDigest(digest) && stored != digest {
+		return fmt.Errorf("integrity check failed: the registry stored the blob uploaded to %s as %s instead of %s", upload.RepoName, stored, digest)
+	}
+	return nil
+}
+
+// blobPath returns the decorator of the URL of a path of the repository, e.g. /blobs/{digest} with its parameters.
+func (c *AcrCLIClient) blobPath(repoName string, path string, parameters map[string]interface{}) autorest.PrepareDecorator {
+	pathParameters := map[string]interface{}{"name": autorest.Encode("path", repoName)}
+	for key, value := range parameters {
+		pathParameters[key] = value
+	}
+	return autorest.WithPathParameters("/v2/{name}"+path, pathParameters)
+}
+
+// sendBlobRequest sends a request of the blob APIs, the response is returned with its body closed and an error is
+// returned unless the status code is one of codes. The chunks of an upload are not retried since the registry may
+// have received part of them, the upload is resumed instead.
+func (c *AcrCLIClient) sendBlobRequest(ctx context.Context, operation string, repoName string, permission string, decorators []autorest.PrepareDecorator, codes ...int) (*http.Response, error) {
+	if c.isExpired() {
+		if err := refreshAcrCLIClientToken(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	decorators = append([]autorest.PrepareDecorator{autorest.WithCustomBaseURL("{url}", map[string]interface{}{"url": c.AutorestClient.LoginURI})}, decorators...)
+	req, err := autorest.CreatePreparer(decorators...).Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		return nil, autorest.NewErrorWithError(err, "acr.BaseClient", operation, nil, "Failure preparing request")
+	}
+	sendDecorators := []autorest.SendDecorator{}
+	if req.Method != http.MethodPatch {
+		sendDecorators = append(sendDecorators, autorest.DoRetryForStatusCodes(c.AutorestClient.RetryAttempts, c.AutorestClient.RetryDuration, autorest.StatusCodesForRetry...))
+	}
+	resp, err := autorest.SendWithSender(c.AutorestClient, req, sendDecorators...)
+	if err == nil {
+		err = autorest.Respond(resp, c.AutorestClient.ByInspecting(), azure.WithErrorUnlessStatusCode(codes...), autorest.ByClosing())
+	}
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "acr.BaseClient", operation, resp, "Failure sending request")
+		return resp, classifyError(err, permission, repoName)
+	}
+	return resp, nil
+}
+
+// newBlobUpload returns the upload session the registry started, its location is in the Location header.
+func newBlobUpload(repoName string, resp *http.Response) (*BlobUpload, error) {
+	location, err := resp.Location()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the upload to %s: %w", repoName, err)
+	}
+	return &BlobUpload{RepoName: repoName, Location: location.String()}, nil
+}
+
+// update moves the upload after a request that sent sent bytes, the registry returns the location of the next request
+// and the range of bytes it received, which takes precedence over the bytes that were sent.
+func (u *BlobUpload) update(resp *http.Response, sent int64) {
+	if location, err := resp.Location(); err == nil {
+		u.Location = location.String()
+	}
+	if received, ok := parseUploadRange(resp.Header.Get("Range")); ok {
+		u.Offset = received
+		return
+	}
+	u.Offset += sent
+}
+
+// parseUploadRange returns the number of bytes of a Range header of an upload like 0-1023, 0-0 is returned by the
+// registries for an empty upload so it is read as no bytes.
+func parseUploadRange(value string) (int64, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(strings.TrimSpace(value), "bytes="), "-", 2)
+	if len(parts) != 2 || parts[0] != "0" {
+		return 0, false
+	}
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || end < 0 {
+		return 0, false
+	}
+	if end == 0 {
+		return 0, true
+	}
+	return end + 1, true
+}
+
+// withQuery returns the URL with a query parameter set.
+func withQuery(rawURL string, key string, value string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := parsed.Query()
+	query.Set(key, value)
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/fakeacr"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBlobUpload contains the tests for the checks, mounts and uploads of blobs against a fake registry.
+func TestBlobUpload(t *testing.T) {
+	ctx := context.Background()
+	registry := fakeacr.NewRegistry("user", "password")
+	defer registry.Close()
+	client, err := GetAcrCLIClientWithAuth(registry.LoginURL(), "user", "password", nil)
+	assert.Equal(t, nil, err, "Error should be nil")
+	client.AutorestClient.Sender = registry.HTTPClient()
+	content := []byte(strings.Repeat("layer", 5))
+	digest := fakeacr.Digest(content)
+	// First test, a blob is uploaded in chunks and can be found afterwards.
+	t.Run("UploadTest", func(t *testing.T) {
+		assert := assert.New(t)
+		_, exists, err := client.HeadBlob(ctx, "hello", digest)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(false, exists)
+		upload, err := UploadBlob(ctx, client, "hello", digest, bytes.NewReader(content), int64(len(content)), 10, nil)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(int64(len(content)), upload.Offset)
+		blob, _ := registry.Blob(digest)
+		assert.Equal(content, blob)
+		size, exists, err := client.HeadBlob(ctx, "hello", digest)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(true, exists)
+		assert.Equal(int64(len(content)), size)
+	})
+	// Second test, an upload continues from the bytes the registry received, even if the offset was lost.
+	t.Run("ResumeTest", func(t *testing.T) {
+		assert := assert.New(t)
+		resumed := []byte(strings.Repeat("resumed", 4))
+		upload, err := client.StartBlobUpload(ctx, "hello")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(nil, client.UploadBlobChunk(ctx, upload, resumed[:12]))
+		assert.Equal(int64(12), upload.Offset)
+		upload.Offset = 0
+		upload, err = UploadBlob(ctx, client, "hello", fakeacr.Digest(resumed), bytes.NewReader(resumed), int64(len(resumed)), 5, upload)
+		assert.Equal(nil, err, "Error should be nil")
+		blob, _ := registry.Blob(fakeacr.Digest(resumed))
+		assert.Equal(resumed, blob)
+	})
+	// Third test, a stored blob is mounted, an unknown one starts an upload session instead.
+	t.Run("MountTest", func(t *testing.T) {
+		assert := assert.New(t)
+		upload, err := client.MountBlob(ctx, "copy", "hello", digest)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal((*BlobUpload)(nil), upload)
+		upload, err = client.MountBlob(ctx, "copy", "hello", fakeacr.Digest([]byte("unknown")))
+		assert.Equal(nil, err, "Error should be nil")
+		assert.NotEqual((*BlobUpload)(nil), upload)
+		assert.Equal(nil, client.CompleteBlobUpload(ctx, upload, fakeacr.Digest([]byte("unknown")), []byte("unknown")))
+		_, exists, _ := client.HeadBlob(ctx, "copy", fakeacr.Digest([]byte("unknown")))
+		assert.Equal(true, exists)
+	})
+	// Fourth test, the registry rejects the content that does not match the digest.
+	t.Run("DigestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		_, err := UploadBlob(ctx, client, "hello", fakeacr.Digest([]byte("other")), bytes.NewReader(content), int64(len(content)), 0, nil)
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+	// Fifth test, a blob opened as a stream is uploaded in chunks to another repository.
+	t.Run("StreamTest", func(t *testing.T) {
+		assert := assert.New(t)
+		streamed := []byte(strings.Repeat("streamed", 4))
+		assert.Equal(nil, UploadBlobStream(ctx, client, "hello", fakeacr.Digest(streamed), bytes.NewReader(streamed), 10))
+		blob, err := client.OpenBlob(ctx, "hello", fakeacr.Digest(streamed))
+		assert.Equal(nil, err, "Error should be nil")
+		defer blob.Close()
+		copied, _ := ioutil.ReadAll(blob)
+		assert.Equal(streamed, copied)
+		_, err = client.OpenBlob(ctx, "hello", fakeacr.Digest([]byte("missing")))
+		assert.True(errors.Is(err, ErrNotFound))
+	})
+}
+
+// TestParseUploadRange contains the tests for the ranges of bytes received by an upload.
+func TestParseUploadRange(t *testing.T) {
+	tables := []struct {
+		value    string
+		received int64
+		ok       bool
+	}{
+		{"0-1023", 1024, true},
+		{"bytes=0-9", 10, true},
+		{"0-0", 0, true},
+		{"10-20", 0, false},
+		{"", 0, false},
+	}
+	assert := assert.New(t)
+	for _, table := range tables {
+		received, ok := parseUploadRange(table.value)
+		assert.Equal(table.received, received, table.value)
+		assert.Equal(table.ok, ok, table.value)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// digestPrefix is the algorithm of the digests whose manifests can be cached.
+const digestPrefix = "sha256:"
+
+// ManifestCache wraps an AcrCLIClientInterface and keeps the body of every manifest fetched by digest, so that the
+// manifest lists that are read while selecting tags are not fetched again while selecting untagged manifests.
+// Manifests are immutable so a body can be reused as long as it is fetched through its digest, manifests fetched
+// by tag always go to the registry. If a directory is specified the bodies are also stored there and reused by
+// later runs.
+type ManifestCache struct {
+	AcrCLIClientInterface
+	dir    string
+	mu     sync.Mutex
+	bodies map[string][]byte
+}
+
+// NewManifestCache creates a cache in front of the client, dir can be empty to only keep the bodies in memory.
+func NewManifestCache(client AcrCLIClientInterface, dir string) (*ManifestCache, error) {
+	if len(dir) > 0 {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create the manifest cache directory: %w", err)
+		}
+	}
+	return &ManifestCache{AcrCLIClientInterface: client, dir: dir, bodies: map[string][]byte{}}, nil
+}
+
+// GetManifest returns the cached body of the manifest if the reference is a digest that was already fetched.
+func (c *ManifestCache) GetManifest(ctx context.Context, repoName string, reference string) ([]byte, error) {
+	if !isDigest(reference) {
+		return c.AcrCLIClientInterface.GetManifest(ctx, repoName, reference)
+	}
+	if manifestBytes, ok := c.get(reference); ok {
+		return manifestBytes, nil
+	}
+	manifestBytes, err := c.AcrCLIClientInterface.GetManifest(ctx, repoName, reference)
+	if err != nil {
+		return nil, err
+	}
+	c.put(reference, manifestBytes)
+	return manifestBytes, nil
+}
+
+// DeleteManifest deletes the manifest and forgets its body, a deleted manifest is not needed again during the run.
+func (c *ManifestCache) DeleteManifest(ctx context.Context, repoName string, reference string) (*autorest.Response, error) {
+	c.mu.Lock()
+	delete(c.bodies, reference)
+	c.mu.Unlock()
+	return c.AcrCLIClientInterface.DeleteManifest(ctx, repoName, reference)
+}
+
+// get looks for the body in memory and then in the cache directory. Bodies read from the directory are only used
+// if they still match their digest.
+func (c *ManifestCache) get(digest string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if manifestBytes, ok := c.bodies[digest]; ok {
+		return manifestBytes, true
+	}
+	if len(c.dir) == 0 {
+		return nil, false
+	}
+	manifestBytes, err := ioutil.ReadFile(c.path(digest))
+	if err != nil || sha256Digest(manifestBytes) != digest {
+		return nil, false
+	}
+	c.bodies[digest] = manifestBytes
+	return manifestBytes, true
+}
+
+// put stores the body in memory and, if it matches its digest, in the cache directory. Failing to write the file
+// only means the manifest will be fetched again in the next run, so the error is ignored.
+func (c *ManifestCache) put(digest string, manifestBytes []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bodies[digest] = manifestBytes
+	if len(c.dir) > 0 && sha256Digest(manifestBytes) == digest {
+		_ = ioutil.WriteFile(c.path(digest), manifestBytes, 0600)
+	}
+}
+
+// isDigest returns true if the reference is a sha256 digest, which also guarantees it can be used as a file name.
+func isDigest(reference string) bool {
+	hex := strings.TrimPrefix(reference, digestPrefix)
+	if len(hex) != 2*sha256.Size || len(hex) == len(reference) {
+		return false
+	}
+	for _, r := range hex {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// path returns the file that stores the body of a manifest, the digest is validated by the callers.
+func (c *ManifestCache) path(digest string) string {
+	return filepath.Join(c.dir, strings.TrimPrefix(digest, digestPrefix))
+}
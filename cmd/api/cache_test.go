@@ -0,0 +1,63 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestManifestCache contains the tests for the cache of manifest bodies.
+func TestManifestCache(t *testing.T) {
+	ctx := context.Background()
+	body := []byte(`{"schemaVersion":2,"manifests":[]}`)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	// First test, a manifest fetched by digest is only fetched once, manifests fetched by tag are never cached.
+	t.Run("MemoryTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", ctx, "hello", digest).Return(body, nil).Once()
+		mockClient.On("GetManifest", ctx, "hello", "latest").Return(body, nil).Twice()
+		cache, err := NewManifestCache(mockClient, "")
+		assert.Equal(nil, err, "Error should be nil")
+		for i := 0; i < 2; i++ {
+			manifestBytes, err := cache.GetManifest(ctx, "hello", digest)
+			assert.Equal(nil, err, "Error should be nil")
+			assert.Equal(body, manifestBytes)
+			_, err = cache.GetManifest(ctx, "hello", "latest")
+			assert.Equal(nil, err, "Error should be nil")
+		}
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, the bodies stored in the cache directory are reused by a new cache unless they were modified.
+	t.Run("DirectoryTest", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "manifests")
+		assert.Equal(nil, err, "Error should be nil")
+		defer os.RemoveAll(dir)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifest", ctx, "hello", digest).Return(body, nil).Twice()
+		cache, _ := NewManifestCache(mockClient, dir)
+		_, err = cache.GetManifest(ctx, "hello", digest)
+		assert.Equal(nil, err, "Error should be nil")
+		cache, _ = NewManifestCache(mockClient, dir)
+		manifestBytes, err := cache.GetManifest(ctx, "hello", digest)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(body, manifestBytes)
+		// A modified file does not match the digest anymore, so the manifest is fetched again.
+		assert.Equal(nil, ioutil.WriteFile(cache.path(digest), []byte("{}"), 0600))
+		cache, _ = NewManifestCache(mockClient, dir)
+		manifestBytes, err = cache.GetManifest(ctx, "hello", digest)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(body, manifestBytes)
+		mockClient.AssertExpectations(t)
+	})
+}
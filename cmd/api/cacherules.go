@@ -0,0 +1,58 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// cacheRulesAPIVersion is the first stable version of the ACR resource provider with cache rules.
+const cacheRulesAPIVersion = "2023-07-01"
+
+// CacheRule makes a repository of the registry a pull-through cache of a repository of another registry, e.g. the
+// target repository library/nginx caches docker.io/library/nginx. A target repository that ends with a wildcard, e.g.
+// library/*, caches all the repositories under it.
+type CacheRule struct {
+	ID         string              `json:"id,omitempty"`
+	Name       string              `json:"name,omitempty"`
+	Properties CacheRuleProperties `json:"properties"`
+}
+
+// CacheRuleProperties contains the source and the target repositories of a cache rule.
+type CacheRuleProperties struct {
+	SourceRepository        string `json:"sourceRepository"`
+	TargetRepository        string `json:"targetRepository"`
+	CredentialSetResourceID string `json:"credentialSetResourceId,omitempty"`
+	ProvisioningState       string `json:"provisioningState,omitempty"`
+}
+
+// Matches returns true if the repository is cached by the rule.
+func (r CacheRule) Matches(repoName string) bool {
+	target := r.Properties.TargetRepository
+	if prefix := strings.TrimSuffix(target, "*"); prefix != target {
+		return strings.HasPrefix(repoName, prefix)
+	}
+	return repoName == target
+}
+
+// ListCacheRules returns the cache rules of the registry.
+func (c *ManagementClient) ListCacheRules(ctx context.Context) ([]CacheRule, error) {
+	rules := []CacheRule{}
+	next := c.registryID + "/cacheRules?api-version=" + cacheRulesAPIVersion
+	for len(next) > 0 {
+		var page struct {
+			Value    []CacheRule `json:"value"`
+			NextLink string      `json:"nextLink"`
+		}
+		if _, err := c.do(ctx, http.MethodGet, next, nil, &page); err != nil {
+			return nil, fmt.Errorf("failed to list cache rules: %w", err)
+		}
+		rules = append(rules, page.Value...)
+		next = page.NextLink
+	}
+	return rules, nil
+}
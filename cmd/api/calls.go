@@ -0,0 +1,113 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// CallCounts are the requests sent to the registries, every attempt of a retried request is counted so that they can
+// be compared with the throttling quotas of the registry.
+type CallCounts struct {
+	// List is the number of requests that list repositories, tags, manifests or referrers.
+	List int `json:"list"`
+	// Get is the number of requests that read a single manifest, blob or attribute.
+	Get int `json:"get"`
+	// Delete is the number of requests that delete a tag, a manifest or a repository.
+	Delete int `json:"delete"`
+	// Other is the number of the rest of the requests, e.g. the token exchanges and the pushes.
+	Other int `json:"other"`
+}
+
+// Total returns the number of requests of every kind.
+func (c CallCounts) Total() int {
+	return c.List + c.Get + c.Delete + c.Other
+}
+
+// String describes the counts for the summary of a command.
+func (c CallCounts) String() string {
+	return fmt.Sprintf("%d list, %d get, %d delete, %d other", c.List, c.Get, c.Delete, c.Other)
+}
+
+// CallCounter counts the requests sent with the contexts it is attached to with WithCallCounter, e.g. the requests of
+// a single purge while other purges run in the same process.
+type CallCounter struct {
+	mu    sync.Mutex
+	value CallCounts
+}
+
+// NewCallCounter returns a counter that has not counted any request.
+func NewCallCounter() *CallCounter {
+	return &CallCounter{}
+}
+
+// Counts returns the number of requests counted so far by kind.
+func (c *CallCounter) Counts() CallCounts {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// callCounterKey is the key of the CallCounter of a context.
+type callCounterKey struct{}
+
+// WithCallCounter returns a context whose requests are counted by the counter, a nil counter does not count them.
+func WithCallCounter(ctx context.Context, counter *CallCounter) context.Context {
+	return context.WithValue(ctx, callCounterKey{}, counter)
+}
+
+// CallCounterFrom returns the counter of the requests sent with the context, nil if they are not counted.
+func CallCounterFrom(ctx context.Context) *CallCounter {
+	counter, _ := ctx.Value(callCounterKey{}).(*CallCounter)
+	return counter
+}
+
+// listPathSuffixes are the suffixes of the paths of the ACR and OCI APIs that list repositories, tags or manifests.
+var listPathSuffixes = []string{"/_catalog", "/_tags", "/_manifests", "/tags/list"}
+
+// count counts a request by its method and path.
+func (c *CallCounter) count(req *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch req.Method {
+	case http.MethodDelete:
+		c.value.Delete++
+		return
+	case http.MethodGet, http.MethodHead:
+		path := strings.TrimSuffix(req.URL.Path, "/")
+		if strings.HasPrefix(path, "/oauth2/") {
+			break
+		}
+		if strings.Contains(path, "/referrers/") {
+			c.value.List++
+			return
+		}
+		for _, suffix := range listPathSuffixes {
+			if strings.HasSuffix(path, suffix) {
+				c.value.List++
+				return
+			}
+		}
+		c.value.Get++
+		return
+	}
+	c.value.Other++
+}
+
+// callCounter counts every request with the counter of its context before sending it.
+type callCounter struct {
+	next http.RoundTripper
+}
+
+// RoundTrip counts the request and sends it.
+func (c *callCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if counter := CallCounterFrom(req.Context()); counter != nil {
+		counter.count(req)
+	}
+	return c.next.RoundTrip(req)
+}
@@ -0,0 +1,64 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCallCounts contains the tests for the requests counted by kind.
+func TestCallCounts(t *testing.T) {
+	// First test, the requests are classified by their method and path.
+	t.Run("ClassifyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		counter := NewCallCounter()
+		requests := map[string]string{
+			"/acr/v1/_catalog":                 http.MethodGet,
+			"/acr/v1/hello-world/_tags":        http.MethodGet,
+			"/acr/v1/hello-world/_manifests/":  http.MethodGet,
+			"/v2/hello-world/tags/list":        http.MethodGet,
+			"/v2/hello-world/referrers/sha:1":  http.MethodGet,
+			"/v2/hello-world/manifests/latest": http.MethodHead,
+			"/v2/hello-world/blobs/sha:2":      http.MethodGet,
+			"/acr/v1/hello-world/_tags/v1":     http.MethodDelete,
+			"/v2/hello-world/manifests/sha:3":  http.MethodDelete,
+			"/oauth2/token":                    http.MethodGet,
+			"/oauth2/exchange":                 http.MethodPost,
+			"/v2/hello-world/manifests/v2":     http.MethodPut,
+		}
+		for path, method := range requests {
+			req, err := http.NewRequest(method, "https://foo.azurecr.io"+path, nil)
+			assert.Equal(nil, err, "Error should be nil")
+			counter.count(req)
+		}
+		calls := counter.Counts()
+		assert.Equal(CallCounts{List: 5, Get: 2, Delete: 2, Other: 3}, calls)
+		assert.Equal(12, calls.Total())
+		assert.Equal("5 list, 2 get, 2 delete, 3 other", calls.String())
+	})
+	// Second test, the requests of the http client are counted by the counter of their context, the other requests
+	// are not counted.
+	t.Run("CounterTest", func(t *testing.T) {
+		assert := assert.New(t)
+		counter := NewCallCounter()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+		client, err := newHTTPClient(DefaultTransportOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/acr/v1/hello-world/_tags", nil)
+		assert.Equal(nil, err, "Error should be nil")
+		_, err = client.Do(req.WithContext(WithCallCounter(context.Background(), counter)))
+		assert.Equal(nil, err, "Error should be nil")
+		_, err = client.Get(server.URL + "/acr/v1/hello-world/_tags")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(CallCounts{List: 1}, counter.Counts())
+	})
+}
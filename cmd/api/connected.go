@@ -0,0 +1,102 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The connection states and modes of a connected registry, an on-premises registry that syncs with a cloud registry.
+const (
+	ConnectionStateOnline    = "Online"
+	ConnectionStateOffline   = "Offline"
+	ConnectionStateSyncing   = "Syncing"
+	ConnectionStateUnhealthy = "Unhealthy"
+	ConnectedModeReadOnly    = "ReadOnly"
+	ConnectedModeMirror      = "Mirror"
+	// connectedRegistryAPIVersion is the first version of the ACR resource provider with connected registries.
+	connectedRegistryAPIVersion = "2021-06-01-preview"
+)
+
+// plainHTTP makes the clients created afterwards connect to the registry without TLS.
+var plainHTTP bool
+
+// SetPlainHTTP makes the clients created afterwards use http instead of https, e.g. for a connected registry that
+// is not exposed with TLS.
+func SetPlainHTTP(enabled bool) {
+	plainHTTP = enabled
+}
+
+// registryScheme returns the scheme used to connect to the registries.
+func registryScheme() string {
+	if plainHTTP {
+		return "http"
+	}
+	return "https"
+}
+
+// ConnectedRegistry is an on-premises registry that syncs the repositories of its parent, a cloud registry or
+// another connected registry.
+type ConnectedRegistry struct {
+	ID         string                      `json:"id,omitempty"`
+	Name       string                      `json:"name,omitempty"`
+	Properties ConnectedRegistryProperties `json:"properties"`
+}
+
+// ConnectedRegistryProperties contains the state of a connected registry and of its sync with the parent.
+type ConnectedRegistryProperties struct {
+	Mode             string `json:"mode,omitempty"`
+	ConnectionState  string `json:"connectionState,omitempty"`
+	LastActivityTime string `json:"lastActivityTime,omitempty"`
+	Parent           struct {
+		SyncProperties struct {
+			Schedule     string `json:"schedule,omitempty"`
+			SyncWindow   string `json:"syncWindow,omitempty"`
+			LastSyncTime string `json:"lastSyncTime,omitempty"`
+		} `json:"syncProperties"`
+	} `json:"parent"`
+}
+
+// ParseConnectedRegistryID splits the resource ID of a connected registry, /subscriptions/<subscription>/
+// resourceGroups/<resource group>/providers/Microsoft.ContainerRegistry/registries/<parent>/connectedRegistries/<name>.
+func ParseConnectedRegistryID(id string) (subscription string, resourceGroup string, registryName string, name string, err error) {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	if len(parts) != 10 || !strings.EqualFold(parts[0], "subscriptions") || !strings.EqualFold(parts[2], "resourceGroups") ||
+		!strings.EqualFold(parts[4], "providers") || !strings.EqualFold(parts[5], "Microsoft.ContainerRegistry") ||
+		!strings.EqualFold(parts[6], "registries") || !strings.EqualFold(parts[8], "connectedRegistries") {
+		return "", "", "", "", fmt.Errorf("invalid connected registry ID %s, the format is /subscriptions/<subscription>/resourceGroups/<resource group>/providers/Microsoft.ContainerRegistry/registries/<parent>/connectedRegistries/<name>", id)
+	}
+	return parts[1], parts[3], parts[7], parts[9], nil
+}
+
+// GetConnectedRegistry returns a connected registry of the registry.
+func (c *ManagementClient) GetConnectedRegistry(ctx context.Context, name string) (*ConnectedRegistry, error) {
+	var connectedRegistry ConnectedRegistry
+	path := c.registryID + "/connectedRegistries/" + url.PathEscape(name) + "?api-version=" + connectedRegistryAPIVersion
+	if _, err := c.do(ctx, http.MethodGet, path, nil, &connectedRegistry); err != nil {
+		return nil, fmt.Errorf("failed to get connected registry %s: %w", name, err)
+	}
+	return &connectedRegistry, nil
+}
+
+// SyncWarnings explains why deleting from the connected registry now could fail or be undone, it is empty when the
+// connected registry is online and not syncing.
+func (r *ConnectedRegistry) SyncWarnings() []string {
+	warnings := []string{}
+	switch r.Properties.ConnectionState {
+	case ConnectionStateSyncing:
+		warnings = append(warnings, "the connected registry "+r.Name+" is syncing with its parent, the artifacts being synced can be pushed again after they are deleted")
+	case ConnectionStateOffline, ConnectionStateUnhealthy:
+		warnings = append(warnings, "the connected registry "+r.Name+" is "+strings.ToLower(r.Properties.ConnectionState)+", the requests to it may fail")
+	}
+	switch r.Properties.Mode {
+	case ConnectedModeReadOnly, ConnectedModeMirror:
+		warnings = append(warnings, "the connected registry "+r.Name+" is in "+r.Properties.Mode+" mode, it does not accept deletions, purge its parent instead")
+	}
+	return warnings
+}
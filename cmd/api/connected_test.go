@@ -0,0 +1,91 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+func TestPlainHTTP(t *testing.T) {
+	defer SetPlainHTTP(false)
+	if loginURL := LoginURL("localhost:8080"); loginURL != "localhost:8080" {
+		t.Fatalf("LoginURL incorrect, got %s, expected localhost:8080", loginURL)
+	}
+	SetPlainHTTP(true)
+	if prefixed := LoginURLWithPrefix("localhost:8080"); prefixed != "http://localhost:8080" {
+		t.Fatalf("LoginURLWithPrefix incorrect, got %s, expected http://localhost:8080", prefixed)
+	}
+	if prefixed := LoginURLWithPrefix("https://registry.azurecr.io"); prefixed != "https://registry.azurecr.io" {
+		t.Fatalf("LoginURLWithPrefix incorrect, got %s, expected the scheme to be kept", prefixed)
+	}
+
+	// A connected registry without TLS is reached with a client token through basic auth.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "client-token" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"registry":"localhost","imageName":"hello","tags":[]}`))
+	}))
+	defer server.Close()
+	defer SetAPIVersion(APIVersionAuto)
+	SetAPIVersion(LegacyAPIVersion)
+	client, err := GetAcrCLIClientWithAuth(strings.TrimPrefix(server.URL, "http://"), "client-token", "secret", nil)
+	if err != nil {
+		t.Fatalf("Expected no error while creating the client, got %v", err)
+	}
+	if _, err := client.GetAcrTags(context.Background(), "hello", "", ""); err != nil {
+		t.Fatalf("Expected no error while listing tags over http, got %v", err)
+	}
+}
+
+func TestConnectedRegistry(t *testing.T) {
+	id := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ContainerRegistry/registries/parent/connectedRegistries/edge"
+	subscription, resourceGroup, parent, name, err := ParseConnectedRegistryID(id)
+	if err != nil || subscription != "sub" || resourceGroup != "rg" || parent != "parent" || name != "edge" {
+		t.Fatalf("ParseConnectedRegistryID incorrect, got %s, %s, %s, %s and %v", subscription, resourceGroup, parent, name, err)
+	}
+	if _, _, _, _, err := ParseConnectedRegistryID("/subscriptions/sub/resourceGroups/rg"); err == nil {
+		t.Fatal("Expected error while parsing an ID that is not a connected registry")
+	}
+
+	state := ConnectionStateSyncing
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != id || r.URL.Query().Get("api-version") != connectedRegistryAPIVersion {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"name":"edge","properties":{"mode":"ReadWrite","connectionState":%q,"parent":{"syncProperties":{"lastSyncTime":"2021-07-01T00:00:00Z"}}}}`, state)
+	}))
+	defer server.Close()
+	client := newManagementClient(server.URL, autorest.NullAuthorizer{}, "sub", "rg", "parent")
+	connectedRegistry, err := client.GetConnectedRegistry(context.Background(), "edge")
+	if err != nil {
+		t.Fatalf("Expected no error while getting the connected registry, got %v", err)
+	}
+	if warnings := connectedRegistry.SyncWarnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "syncing") {
+		t.Fatalf("SyncWarnings incorrect, got %v, expected a warning about the sync", warnings)
+	}
+	if connectedRegistry.Properties.Parent.SyncProperties.LastSyncTime != "2021-07-01T00:00:00Z" {
+		t.Fatalf("Last sync time incorrect, got %s", connectedRegistry.Properties.Parent.SyncProperties.LastSyncTime)
+	}
+
+	state = ConnectionStateOnline
+	connectedRegistry, err = client.GetConnectedRegistry(context.Background(), "edge")
+	if err != nil || len(connectedRegistry.SyncWarnings()) != 0 {
+		t.Fatalf("Expected no warnings for an online connected registry, got %v", err)
+	}
+	connectedRegistry.Properties.Mode = ConnectedModeReadOnly
+	if warnings := connectedRegistry.SyncWarnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "ReadOnly") {
+		t.Fatalf("SyncWarnings incorrect, got %v, expected a warning about the mode", warnings)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// dataEndpointSuffix is the domain of the dedicated data endpoints of the registries, the data endpoint of a region
+// is <registry>.<region>.data.azurecr.io.
+const dataEndpointSuffix = ".data.azurecr.io"
+
+// maxRedirects is the number of redirects followed before a request fails, as the default http client does.
+const maxRedirects = 10
+
+// dataEndpoints contains the data endpoints the registries redirected requests to.
+var dataEndpoints = struct {
+	mu    sync.Mutex
+	hosts map[string]bool
+}{hosts: map[string]bool{}}
+
+// isDataEndpoint returns true if the host is a dedicated data endpoint of a registry.
+func isDataEndpoint(host string) bool {
+	return strings.HasSuffix(strings.ToLower(hostname(host)), dataEndpointSuffix)
+}
+
+// hostname removes the port from a host.
+func hostname(host string) string {
+	return (&url.URL{Host: host}).Hostname()
+}
+
+// followRedirect is the redirect policy of the http client. When dedicated data endpoints are enabled the registry
+// advertises the data endpoint of the region by redirecting the requests for content (e.g. blobs) to it, the data
+// endpoint is recorded and the request is sent to it without the credentials of the registry since the redirect
+// already authorizes it.
+func followRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if isDataEndpoint(req.URL.Host) {
+		dataEndpoints.mu.Lock()
+		dataEndpoints.hosts[hostname(req.URL.Host)] = true
+		dataEndpoints.mu.Unlock()
+		req.Header.Del("Authorization")
+	}
+	return nil
+}
+
+// DataEndpoints returns the data endpoints the registries redirected requests to so far, sorted by name.
+func DataEndpoints() []string {
+	dataEndpoints.mu.Lock()
+	defer dataEndpoints.mu.Unlock()
+	hosts := []string{}
+	for host := range dataEndpoints.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// dataEndpointError explains a request that failed because a data endpoint the registry redirected it to could not be
+// reached, usually because a firewall only allows the login server. Other errors are returned as they are.
+func dataEndpointError(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) && !errors.As(originalError(err), &urlErr) {
+		return err
+	}
+	target, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil || !isDataEndpoint(target.Host) {
+		return err
+	}
+	return fmt.Errorf("the registry redirected the request to its dedicated data endpoint %s, which cannot be reached. "+
+		"Allow it in the firewall and the network rules (acr check-health --data-endpoint %s checks it): %w", target.Hostname(), target.Hostname(), err)
+}
@@ -0,0 +1,43 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDataEndpoints contains the tests for the redirects of the registry to its dedicated data endpoints.
+func TestDataEndpoints(t *testing.T) {
+	// First test, a redirect to a data endpoint is recorded and the credentials of the registry are not sent to it.
+	t.Run("RedirectTest", func(t *testing.T) {
+		assert := assert.New(t)
+		via, _ := http.NewRequest(http.MethodGet, "https://foo.azurecr.io/v2/bar/blobs/sha256:abc", nil)
+		req, _ := http.NewRequest(http.MethodGet, "https://foo.westus.data.azurecr.io/v2/bar/blobs/sha256:abc?sig=123", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		assert.Equal(nil, followRedirect(req, []*http.Request{via}), "Error should be nil")
+		assert.Equal("", req.Header.Get("Authorization"))
+		assert.Contains(DataEndpoints(), "foo.westus.data.azurecr.io")
+		// Other redirects are not recorded.
+		other, _ := http.NewRequest(http.MethodGet, "https://foo.blob.core.windows.net/blob?sig=123", nil)
+		assert.Equal(nil, followRedirect(other, []*http.Request{via}), "Error should be nil")
+		assert.NotContains(DataEndpoints(), "foo.blob.core.windows.net")
+		assert.NotEqual(nil, followRedirect(req, make([]*http.Request, maxRedirects)), "Error should not be nil")
+	})
+	// Second test, a data endpoint that cannot be reached is named in the error.
+	t.Run("ErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		dataErr := &url.Error{Op: "Get", URL: "https://foo.westus.data.azurecr.io/v2/bar/blobs/sha256:abc?sig=123", Err: errors.New("i/o timeout")}
+		err := dataEndpointError(autorest.NewErrorWithError(dataErr, "acr.BaseClient", "GetBlob", nil, "Failure sending request"))
+		assert.True(strings.Contains(err.Error(), "acr check-health --data-endpoint foo.westus.data.azurecr.io"))
+		loginErr := &url.Error{Op: "Get", URL: "https://foo.azurecr.io/v2/bar/blobs/sha256:abc", Err: errors.New("i/o timeout")}
+		assert.Equal(error(loginErr), dataEndpointError(loginErr))
+	})
+}
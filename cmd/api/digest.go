@@ -0,0 +1,85 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// DigestMismatchError is returned when the body the registry returned for a manifest requested by digest does not
+// have that digest, the content was corrupted or tampered with on its way and must not be used.
+type DigestMismatchError struct {
+	Repository string
+	Expected   string
+	Actual     string
+	// Pushed is set if the digest is the one the registry returned for a manifest that was pushed.
+	Pushed bool
+}
+
+// Error returns the requested and the actual digests.
+func (e *DigestMismatchError) Error() string {
+	if e.Pushed {
+		return fmt.Sprintf("integrity check failed: the registry stored the manifest pushed to %s as %s instead of %s", e.Repository, e.Actual, e.Expected)
+	}
+	return fmt.Sprintf("integrity check failed: the registry returned a manifest with digest %s for %s@%s", e.Actual, e.Repository, e.Expected)
+}
+
+// IsDigestMismatch returns true if the error is caused by a manifest whose body does not match its digest.
+func IsDigestMismatch(err error) bool {
+	var mismatchErr *DigestMismatchError
+	return errors.As(err, &mismatchErr)
+}
+
+// ManifestDigest returns the digest of the manifest bytes, the digest the registry stores them with when they are
+// pushed exactly as they are.
+func ManifestDigest(manifestBytes []byte) string {
+	return sha256Digest(manifestBytes)
+}
+
+// sha256Digest returns the sha256 digest of the content.
+func sha256Digest(content []byte) string {
+	return fmt.Sprintf("%s%x", digestPrefix, sha256.Sum256(content))
+}
+
+// verifyManifestDigest checks that the body of a manifest matches the reference it was requested with. Manifests
+// requested by tag cannot be verified, and neither can digests of other algorithms than sha256.
+func verifyManifestDigest(repoName string, reference string, manifestBytes []byte) error {
+	if !isDigest(reference) {
+		return nil
+	}
+	if actual := sha256Digest(manifestBytes); actual != reference {
+		return &DigestMismatchError{Repository: repoName, Expected: reference, Actual: actual}
+	}
+	return nil
+}
+
+// checkPushReference checks that a manifest pushed by digest has that digest, the registry would reject it.
+func checkPushReference(repoName string, reference string, manifestBytes []byte) error {
+	if !isDigest(reference) {
+		return nil
+	}
+	if actual := sha256Digest(manifestBytes); actual != reference {
+		return fmt.Errorf("failed to push the manifest %s@%s, the digest of the manifest is %s", repoName, reference, actual)
+	}
+	return nil
+}
+
+// verifyPushedDigest checks that the Docker-Content-Digest the registry returned for a pushed manifest is the digest
+// of the bytes that were sent. Registries that do not return the header, or use another algorithm, are trusted.
+func verifyPushedDigest(repoName string, manifestBytes []byte, resp *http.Response) error {
+	if resp == nil {
+		return nil
+	}
+	pushed := resp.Header.Get(dockerContentDigestHeader)
+	if !isDigest(pushed) {
+		return nil
+	}
+	if expected := sha256Digest(manifestBytes); pushed != expected {
+		return &DigestMismatchError{Repository: repoName, Expected: expected, Actual: pushed, Pushed: true}
+	}
+	return nil
+}
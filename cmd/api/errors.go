@@ -0,0 +1,247 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// The sentinels of the classes of errors that the callers handle differently, e.g. a purge skips a repository that
+// is not found but stops when it is throttled. The errors of the clients match them with errors.Is.
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrThrottled = errors.New("throttled")
+	ErrAuth      = errors.New("authentication failed")
+)
+
+// AuthError is returned when the credentials of the registry cannot be resolved or are rejected.
+type AuthError struct {
+	err error
+}
+
+// newAuthError wraps an authentication error with a message.
+func newAuthError(err error, message string) *AuthError {
+	return &AuthError{err: fmt.Errorf("%s: %w", message, err)}
+}
+
+// Error returns the message of the wrapped error.
+func (e *AuthError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *AuthError) Unwrap() error {
+	return e.err
+}
+
+// Is makes the authentication errors match ErrAuth.
+func (e *AuthError) Is(target error) bool {
+	return target == ErrAuth
+}
+
+// StatusError is returned by the clients that do not use the generated client when the registry answers with an
+// error status.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+// Error returns the message of the registry.
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// Is matches the sentinel of the status code.
+func (e *StatusError) Is(target error) bool {
+	return isStatusSentinel(e.StatusCode, target)
+}
+
+// ErrorKind is the class of an error returned by the registry.
+type ErrorKind string
+
+// The kinds of the errors that the registry returns and that the user can act on.
+const (
+	KindNotFound     ErrorKind = "NotFound"
+	KindForbidden    ErrorKind = "Forbidden"
+	KindUnauthorized ErrorKind = "Unauthorized"
+	KindThrottled    ErrorKind = "Throttled"
+)
+
+// The permissions needed by the operations of the client, they match the actions of the ACR scope maps.
+const (
+	PermissionMetadataRead  = "metadata read"
+	PermissionMetadataWrite = "metadata write"
+	PermissionContentRead   = "content read"
+	PermissionContentWrite  = "content write"
+	PermissionDelete        = "delete"
+	PermissionCatalog       = "catalog listing"
+)
+
+// RegistryError is an error the registry returned for an operation on a repository, its message tells the user what
+// to do about it (e.g. which permission is missing).
+type RegistryError struct {
+	Kind       ErrorKind
+	StatusCode int
+	Permission string
+	Repository string
+	err        error
+}
+
+// Error returns the guidance followed by the message of the registry.
+func (e *RegistryError) Error() string {
+	target := "the registry"
+	if len(e.Repository) > 0 {
+		target = fmt.Sprintf("repository %s", e.Repository)
+	}
+	var guidance string
+	switch e.Kind {
+	case KindNotFound:
+		guidance = fmt.Sprintf("%s or the requested artifact was not found", target)
+	case KindForbidden:
+		guidance = fmt.Sprintf("missing %s permission on %s", e.Permission, target)
+	case KindUnauthorized:
+		guidance = fmt.Sprintf("the credentials were rejected for %s, log in again or check that the token has not expired", target)
+	case KindThrottled:
+		guidance = fmt.Sprintf("the requests to %s were throttled, retry later or reduce the number of concurrent requests", target)
+	}
+	return fmt.Sprintf("%s: %v", guidance, e.err)
+}
+
+// Unwrap returns the error of the registry.
+func (e *RegistryError) Unwrap() error {
+	return e.err
+}
+
+// Is matches the sentinel of the status code.
+func (e *RegistryError) Is(target error) bool {
+	return isStatusSentinel(e.StatusCode, target)
+}
+
+// isStatusSentinel returns true if the target is the sentinel of the class of the status code.
+func isStatusSentinel(statusCode int, target error) bool {
+	switch statusCode {
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return target == ErrAuth
+	case http.StatusTooManyRequests:
+		return target == ErrThrottled
+	}
+	return false
+}
+
+// classifyError wraps the errors of the registry that the user can act on in a RegistryError, the permission is the
+// one the operation needs. Other errors are returned as they are.
+func classifyError(err error, permission string, repoName string) error {
+	if err == nil {
+		return nil
+	}
+	return classifyStatus(err, StatusCode(err), permission, repoName)
+}
+
+// ResponseError classifies the error of an operation with the status code of the response returned with it when the
+// error does not carry one, e.g. the errors of the implementations of the client interfaces that are not generated, so
+// that errors.Is matches the sentinels whatever client returned it.
+func ResponseError(err error, resp *autorest.Response, permission string, repoName string) error {
+	if err == nil || StatusCode(err) != 0 || resp == nil || resp.Response == nil {
+		return err
+	}
+	return classifyStatus(err, resp.StatusCode, permission, repoName)
+}
+
+// classifyStatus wraps the error in a RegistryError if the status code is one the user can act on.
+func classifyStatus(err error, statusCode int, permission string, repoName string) error {
+	var kind ErrorKind
+	switch statusCode {
+	case http.StatusNotFound:
+		kind = KindNotFound
+	case http.StatusForbidden:
+		kind = KindForbidden
+	case http.StatusUnauthorized:
+		kind = KindUnauthorized
+	case http.StatusTooManyRequests:
+		kind = KindThrottled
+	default:
+		return err
+	}
+	return &RegistryError{Kind: kind, StatusCode: statusCode, Permission: permission, Repository: repoName, err: err}
+}
+
+// IsNotFound returns true if the registry did not find the repository or the artifact.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || isStatusSentinel(StatusCode(err), ErrNotFound)
+}
+
+// IsForbidden returns true if the credentials lack the permission the operation needs.
+func IsForbidden(err error) bool {
+	return StatusCode(err) == http.StatusForbidden
+}
+
+// StatusCode returns the HTTP status code of the error returned by the registry, or 0 if the error does not carry one.
+func StatusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	var registryErr *RegistryError
+	if errors.As(err, &registryErr) {
+		return registryErr.StatusCode
+	}
+	var requestErr *azure.RequestError
+	if errors.As(err, &requestErr) {
+		return detailedStatusCode(requestErr.DetailedError)
+	}
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		return detailedStatusCode(detailedErr)
+	}
+	return 0
+}
+
+// detailedStatusCode returns the status code of an autorest error, or the one of its response if it has none.
+func detailedStatusCode(err autorest.DetailedError) int {
+	if statusCode, ok := err.StatusCode.(int); ok && statusCode != 0 {
+		return statusCode
+	}
+	if err.Response != nil {
+		return err.Response.StatusCode
+	}
+	return 0
+}
+
+// IsAuthError returns true if the credentials could not be resolved or the registry rejected them.
+func IsAuthError(err error) bool {
+	return errors.Is(err, ErrAuth) || isStatusSentinel(StatusCode(err), ErrAuth)
+}
+
+// IsThrottled returns true if the registry kept throttling the request after it was retried, or if the request was
+// aborted because its context was canceled or timed out.
+func IsThrottled(err error) bool {
+	if errors.Is(err, ErrThrottled) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || isStatusSentinel(StatusCode(err), ErrThrottled) {
+		return true
+	}
+	// The autorest errors of the aborted requests wrap the error of their context.
+	original := originalError(err)
+	return original != nil && IsThrottled(original)
+}
+
+// originalError returns the error wrapped by the autorest error of the chain, or nil if there is none. The autorest
+// errors do not implement Unwrap, so errors.Is and errors.As do not look behind them.
+func originalError(err error) error {
+	var requestErr *azure.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.Original
+	}
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		return detailedErr.Original
+	}
+	return nil
+}
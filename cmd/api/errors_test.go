@@ -0,0 +1,98 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestErrors contains the tests for the classification of the errors returned by the clients.
+func TestErrors(t *testing.T) {
+	// First test, the status code is found in the generated client errors and in the errors of the OCI client.
+	t.Run("StatusCodeTest", func(t *testing.T) {
+		assert := assert.New(t)
+		detailed := autorest.NewErrorWithError(errors.New("denied"), "acr.BaseClient", "DeleteAcrTag", &http.Response{StatusCode: http.StatusForbidden}, "Failure responding to request")
+		assert.Equal(http.StatusForbidden, StatusCode(fmt.Errorf("failed to purge tags: %w", detailed)))
+		requestError := &azure.RequestError{DetailedError: autorest.DetailedError{StatusCode: http.StatusTooManyRequests}}
+		assert.Equal(http.StatusTooManyRequests, StatusCode(requestError))
+		assert.Equal(http.StatusNotFound, StatusCode(fmt.Errorf("failed: %w", &StatusError{StatusCode: http.StatusNotFound})))
+		assert.Equal(0, StatusCode(errors.New("failed")))
+		assert.Equal(0, StatusCode(nil))
+	})
+	// Second test, credentials that could not be resolved or were rejected are auth errors.
+	t.Run("AuthErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		err := newAuthError(errors.New("no credentials"), "error resolving authentication")
+		assert.Equal("error resolving authentication: no credentials", err.Error())
+		assert.True(IsAuthError(fmt.Errorf("failed to get client: %w", err)))
+		assert.True(IsAuthError(&StatusError{StatusCode: http.StatusUnauthorized}))
+		assert.False(IsAuthError(&StatusError{StatusCode: http.StatusNotFound}))
+		assert.False(IsAuthError(errors.New("failed")))
+	})
+	// Third test, throttled and aborted requests are found behind the autorest and url errors.
+	t.Run("ThrottledTest", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.True(IsThrottled(&StatusError{StatusCode: http.StatusTooManyRequests}))
+		aborted := autorest.NewErrorWithError(&url.Error{Op: "Delete", URL: "https://foo.azurecr.io", Err: context.DeadlineExceeded}, "acr.BaseClient", "DeleteManifest", nil, "Failure sending request")
+		assert.True(IsThrottled(fmt.Errorf("failed to purge manifests: %w", aborted)))
+		assert.True(IsThrottled(context.Canceled))
+		assert.False(IsThrottled(errors.New("failed")))
+	})
+	// Fourth test, the errors the user can act on are classified and tell which permission is missing.
+	t.Run("ClassifyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		forbidden := autorest.NewErrorWithError(errors.New("denied"), "acr.BaseClient", "GetAcrTags", &http.Response{StatusCode: http.StatusForbidden}, "Failure responding to request")
+		err := classifyError(forbidden, PermissionMetadataRead, "hello-world")
+		registryErr, ok := err.(*RegistryError)
+		assert.True(ok)
+		assert.Equal(KindForbidden, registryErr.Kind)
+		assert.True(strings.HasPrefix(err.Error(), "missing metadata read permission on repository hello-world: "))
+		assert.True(IsForbidden(fmt.Errorf("failed to purge tags: %w", err)))
+		assert.True(IsAuthError(err))
+		notFound := classifyError(&StatusError{StatusCode: http.StatusNotFound, Message: "not found"}, PermissionCatalog, "")
+		assert.Equal("the registry or the requested artifact was not found: not found", notFound.Error())
+		assert.True(IsNotFound(notFound))
+		assert.Equal(KindThrottled, classifyError(&StatusError{StatusCode: http.StatusTooManyRequests}, PermissionDelete, "hello-world").(*RegistryError).Kind)
+		assert.Equal(KindUnauthorized, classifyError(&StatusError{StatusCode: http.StatusUnauthorized}, PermissionDelete, "hello-world").(*RegistryError).Kind)
+		other := errors.New("failed")
+		assert.Equal(other, classifyError(other, PermissionDelete, "hello-world"))
+		assert.Equal(nil, classifyError(nil, PermissionDelete, "hello-world"))
+	})
+	// Fifth test, the errors of the clients match the sentinels of their class with errors.Is.
+	t.Run("SentinelTest", func(t *testing.T) {
+		assert := assert.New(t)
+		notFound := classifyError(&StatusError{StatusCode: http.StatusNotFound}, PermissionMetadataRead, "hello-world")
+		assert.True(errors.Is(fmt.Errorf("failed to purge tags: %w", notFound), ErrNotFound))
+		assert.False(errors.Is(notFound, ErrThrottled))
+		assert.True(errors.Is(&StatusError{StatusCode: http.StatusTooManyRequests}, ErrThrottled))
+		assert.True(errors.Is(&StatusError{StatusCode: http.StatusForbidden}, ErrAuth))
+		assert.True(errors.Is(newAuthError(errors.New("no credentials"), "error resolving authentication"), ErrAuth))
+		var registryErr *RegistryError
+		assert.True(errors.As(fmt.Errorf("failed to purge tags: %w", notFound), &registryErr))
+		assert.Equal(KindNotFound, registryErr.Kind)
+	})
+	// Sixth test, an error without a status code is classified with the status code of its response.
+	t.Run("ResponseErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		resp := &autorest.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}
+		err := ResponseError(errors.New("hello-world not found"), resp, PermissionDelete, "hello-world")
+		assert.True(errors.Is(err, ErrNotFound))
+		classified := classifyError(&StatusError{StatusCode: http.StatusNotFound}, PermissionDelete, "hello-world")
+		assert.Equal(classified, ResponseError(classified, resp, PermissionDelete, "hello-world"))
+		other := errors.New("failed")
+		assert.Equal(other, ResponseError(other, &autorest.Response{Response: &http.Response{StatusCode: http.StatusInternalServerError}}, PermissionDelete, "hello-world"))
+		assert.Equal(other, ResponseError(other, nil, PermissionDelete, "hello-world"))
+		assert.Equal(nil, ResponseError(nil, resp, PermissionDelete, "hello-world"))
+	})
+}
@@ -0,0 +1,147 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FaultInjectionEnv is the environment variable that enables the fault injection, it is only meant to validate the
+// retries and the handling of failed deletions in tests (e.g. throttle=0.2,timeout=0.05,error=0.1,seed=1,limit=100).
+const FaultInjectionEnv = "ACR_FAULT_INJECTION"
+
+// faultInjector fails a share of the requests before they reach the registry. Every request is throttled with the
+// throttle probability, otherwise it times out with the timeout probability, otherwise it fails with a 500 with the
+// error probability.
+type faultInjector struct {
+	next     http.RoundTripper
+	throttle float64
+	timeout  float64
+	failure  float64
+	// limit is the maximum number of faults injected, 0 means no limit. ACR throttles until the load goes down, so
+	// throttled requests are retried until they succeed and a limit makes sure that they eventually do.
+	limit    int
+	mu       sync.Mutex
+	random   *rand.Rand
+	injected int
+}
+
+// parseFaultInjection parses a comma separated list of key=value settings, the keys are throttle, timeout and error
+// with a probability between 0 and 1, seed for the random number generator and limit for the maximum number of faults.
+func parseFaultInjection(spec string, next http.RoundTripper) (*faultInjector, error) {
+	injector := &faultInjector{next: next}
+	seed := int64(1)
+	for _, setting := range strings.Split(spec, ",") {
+		setting = strings.TrimSpace(setting)
+		if len(setting) == 0 {
+			continue
+		}
+		parts := strings.SplitN(setting, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid %s setting %q, expected key=value", FaultInjectionEnv, setting)
+		}
+		key, value := parts[0], parts[1]
+		var err error
+		switch key {
+		case "throttle":
+			injector.throttle, err = parseProbability(value)
+		case "timeout":
+			injector.timeout, err = parseProbability(value)
+		case "error":
+			injector.failure, err = parseProbability(value)
+		case "seed":
+			seed, err = strconv.ParseInt(value, 10, 64)
+		case "limit":
+			injector.limit, err = strconv.Atoi(value)
+			if err == nil && injector.limit < 0 {
+				err = errors.New("the limit cannot be negative")
+			}
+		default:
+			err = errors.New("unknown key, the supported keys are throttle, timeout, error, seed and limit")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s setting %q: %w", FaultInjectionEnv, setting, err)
+		}
+	}
+	injector.random = rand.New(rand.NewSource(seed))
+	return injector, nil
+}
+
+// parseProbability parses a number between 0 and 1.
+func parseProbability(value string) (float64, error) {
+	probability, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if probability < 0 || probability > 1 {
+		return 0, errors.New("the probability has to be between 0 and 1")
+	}
+	return probability, nil
+}
+
+// RoundTrip injects a fault or sends the request to the registry.
+func (f *faultInjector) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	fault := ""
+	if f.limit == 0 || f.injected < f.limit {
+		switch {
+		case f.random.Float64() < f.throttle:
+			fault = "throttle"
+		case f.random.Float64() < f.timeout:
+			fault = "timeout"
+		case f.random.Float64() < f.failure:
+			fault = "error"
+		}
+		if len(fault) > 0 {
+			f.injected++
+		}
+	}
+	f.mu.Unlock()
+
+	switch fault {
+	case "throttle":
+		return injectedResponse(req, http.StatusTooManyRequests, `{"errors":[{"code":"TOOMANYREQUESTS","message":"injected fault"}]}`, "1"), nil
+	case "timeout":
+		return nil, injectedTimeoutError{}
+	case "error":
+		return injectedResponse(req, http.StatusInternalServerError, `{"errors":[{"code":"UNKNOWN","message":"injected fault"}]}`, ""), nil
+	}
+	return f.next.RoundTrip(req)
+}
+
+// injectedResponse creates the response of an injected fault.
+func injectedResponse(req *http.Request, statusCode int, body string, retryAfter string) *http.Response {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if len(retryAfter) > 0 {
+		header.Set("Retry-After", retryAfter)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// injectedTimeoutError is the error of an injected timeout, it is a temporary network error like the timeouts of the
+// transport so it is retried the same way.
+type injectedTimeoutError struct{}
+
+func (injectedTimeoutError) Error() string   { return "injected fault: i/o timeout" }
+func (injectedTimeoutError) Timeout() bool   { return true }
+func (injectedTimeoutError) Temporary() bool { return true }
@@ -0,0 +1,95 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultInjection(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	// First test, the settings are validated.
+	t.Run("ParseTest", func(t *testing.T) {
+		assert := assert.New(t)
+		injector, err := parseFaultInjection("throttle=0.5, timeout=0.1,error=1,seed=7,limit=3", http.DefaultTransport)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0.5, injector.throttle)
+		assert.Equal(0.1, injector.timeout)
+		assert.Equal(1.0, injector.failure)
+		assert.Equal(3, injector.limit)
+		for _, spec := range []string{"throttle", "throttle=2", "error=x", "limit=-1", "crash=1"} {
+			_, err := parseFaultInjection(spec, http.DefaultTransport)
+			assert.NotEqual(nil, err, spec)
+		}
+		_, err = newHTTPClient(TransportOptions{FaultInjection: "timeout=5"})
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+	// Second test, the injected faults do not reach the registry and stop at the limit.
+	t.Run("LimitTest", func(t *testing.T) {
+		assert := assert.New(t)
+		atomic.StoreInt32(&requests, 0)
+		client, err := newHTTPClient(TransportOptions{FaultInjection: "throttle=1,limit=1"})
+		assert.Equal(nil, err, "Error should be nil")
+		resp, err := client.Get(server.URL)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal("1", resp.Header.Get("Retry-After"))
+		assert.Equal(int32(0), atomic.LoadInt32(&requests))
+		resp, err = client.Get(server.URL)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(http.StatusAccepted, resp.StatusCode)
+		assert.Equal(int32(1), atomic.LoadInt32(&requests))
+	})
+	// Third test, the client retries injected timeouts and server errors until the request reaches the registry.
+	t.Run("RetryTest", func(t *testing.T) {
+		assert := assert.New(t)
+		atomic.StoreInt32(&requests, 0)
+		client := newAcrCLIClient("registry.azurecr.io")
+		sender, err := newHTTPClient(TransportOptions{FaultInjection: "timeout=1,error=1,limit=2"})
+		assert.Equal(nil, err, "Error should be nil")
+		client.AutorestClient.Sender = sender
+		client.AutorestClient.LoginURI = server.URL
+		client.AutorestClient.RetryDuration = time.Millisecond
+		_, err = client.DeleteAcrTags(context.Background(), "hello", []string{"v1"})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(int32(1), atomic.LoadInt32(&requests))
+		// Without a limit the retries are exhausted and the error is returned.
+		sender, err = newHTTPClient(TransportOptions{FaultInjection: "error=1"})
+		assert.Equal(nil, err, "Error should be nil")
+		client.AutorestClient.Sender = sender
+		resp, err := client.DeleteAcrTags(context.Background(), "hello", []string{"v1"})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+		assert.Equal(int32(1), atomic.LoadInt32(&requests))
+	})
+	// Fourth test, the requests that reach the registry are still counted with fault injection enabled, the injected
+	// faults are not.
+	t.Run("CallCounterTest", func(t *testing.T) {
+		assert := assert.New(t)
+		counter := NewCallCounter()
+		ctx := WithCallCounter(context.Background(), counter)
+		client, err := newHTTPClient(TransportOptions{FaultInjection: "throttle=1,limit=1"})
+		assert.Equal(nil, err, "Error should be nil")
+		for i := 0; i < 2; i++ {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/acr/v1/hello-world/_tags", nil)
+			assert.Equal(nil, err, "Error should be nil")
+			resp, err := client.Do(req.WithContext(ctx))
+			assert.Equal(nil, err, "Error should be nil")
+			resp.Body.Close()
+		}
+		assert.Equal(CallCounts{List: 1}, counter.Counts())
+	})
+}
@@ -0,0 +1,459 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// Constants used to manage the registry through Azure Resource Manager.
+const (
+	// managementAPIVersion is the first version of the ACR resource provider with tokens and scope maps.
+	managementAPIVersion = "2019-05-01-preview"
+	// provisioningSucceeded and provisioningFailed are the terminal provisioning states, besides Canceled.
+	provisioningSucceeded = "Succeeded"
+	provisioningFailed    = "Failed"
+	provisioningCanceled  = "Canceled"
+)
+
+// managementPollInterval is how long the client waits between checks of a long running operation.
+var managementPollInterval = 2 * time.Second
+
+// ManagementClient manages the resources of a registry (e.g. tokens and scope maps) through Azure Resource Manager,
+// contrary to the AcrCLIClient it needs Azure credentials instead of registry credentials.
+type ManagementClient struct {
+	baseURI    string
+	registryID string
+	authorizer autorest.Authorizer
+	client     *http.Client
+}
+
+// ScopeMap is a set of repository actions that can be assigned to tokens.
+type ScopeMap struct {
+	ID         string             `json:"id,omitempty"`
+	Name       string             `json:"name,omitempty"`
+	Properties ScopeMapProperties `json:"properties"`
+}
+
+// ScopeMapProperties contains the actions of a scope map, e.g. repositories/hello-world/content/read.
+type ScopeMapProperties struct {
+	Description       string   `json:"description,omitempty"`
+	Actions           []string `json:"actions"`
+	ProvisioningState string   `json:"provisioningState,omitempty"`
+}
+
+// Token is a registry credential whose permissions are the actions of its scope map.
+type Token struct {
+	ID         string          `json:"id,omitempty"`
+	Name       string          `json:"name,omitempty"`
+	Properties TokenProperties `json:"properties"`
+}
+
+// TokenProperties contains the scope map and the status of a token.
+type TokenProperties struct {
+	ScopeMapID        string `json:"scopeMapId"`
+	Status            string `json:"status,omitempty"`
+	CreationDate      string `json:"creationDate,omitempty"`
+	ProvisioningState string `json:"provisioningState,omitempty"`
+}
+
+// TokenCredentials contains the username and the passwords generated for a token.
+type TokenCredentials struct {
+	Username  string          `json:"username"`
+	Passwords []TokenPassword `json:"passwords"`
+}
+
+// TokenPassword is a password of a token, the value is only returned when it is generated.
+type TokenPassword struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Expiry string `json:"expiry,omitempty"`
+}
+
+// Replication is a region the content of a geo-replicated registry is replicated to, the home region of the registry
+// is also listed as a replication.
+type Replication struct {
+	ID         string                `json:"id,omitempty"`
+	Name       string                `json:"name,omitempty"`
+	Location   string                `json:"location"`
+	Properties ReplicationProperties `json:"properties"`
+}
+
+// ReplicationProperties contains the status of a replication.
+type ReplicationProperties struct {
+	ProvisioningState string `json:"provisioningState,omitempty"`
+	Status            struct {
+		DisplayStatus string `json:"displayStatus,omitempty"`
+		Message       string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+// ImportSource is an image of another registry imported with ImportImage, e.g. the registry docker.io and the image
+// library/nginx:1.25. The credentials are only needed for private images.
+type ImportSource struct {
+	RegistryURI string                   `json:"registryUri"`
+	SourceImage string                   `json:"sourceImage"`
+	Credentials *ImportSourceCredentials `json:"credentials,omitempty"`
+}
+
+// ImportSourceCredentials are the credentials of the registry of an ImportSource.
+type ImportSourceCredentials struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password"`
+}
+
+// NewManagementClient creates a client for the registry in the specified subscription and resource group. The
+// credentials of a service principal are read from the AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET
+// environment variables, if they are not set the account the Azure CLI is logged in with is used.
+func NewManagementClient(subscriptionID string, resourceGroup string, registryName string) (*ManagementClient, error) {
+	env := azure.PublicCloud
+	authorizer, err := getManagementAuthorizer(env)
+	if err != nil {
+		return nil, err
+	}
+	return newManagementClient(env.ResourceManagerEndpoint, authorizer, subscriptionID, resourceGroup, registryName), nil
+}
+
+// newManagementClient creates a client that sends its requests to baseURI.
+func newManagementClient(baseURI string, authorizer autorest.Authorizer, subscriptionID string, resourceGroup string, registryName string) *ManagementClient {
+	// The management plane identifies the registry by its resource name, not by its login server.
+	if i := strings.Index(registryName, "."); i >= 0 {
+		registryName = registryName[:i]
+	}
+	return &ManagementClient{
+		baseURI: strings.TrimSuffix(baseURI, "/"),
+		registryID: "/subscriptions/" + url.PathEscape(subscriptionID) +
+			"/resourceGroups/" + url.PathEscape(resourceGroup) +
+			"/providers/Microsoft.ContainerRegistry/registries/" + url.PathEscape(registryName),
+		authorizer: authorizer,
+		client:     httpClient,
+	}
+}
+
+// getManagementAuthorizer authenticates with a service principal if its environment variables are set and with the
+// Azure CLI otherwise.
+func getManagementAuthorizer(env azure.Environment) (autorest.Authorizer, error) {
+	tokenProvider, err := getAADTokenProvider(env)
+	if err != nil {
+		return nil, err
+	}
+	return autorest.NewBearerAuthorizer(tokenProvider), nil
+}
+
+// getAADTokenProvider returns an Azure Resource Manager token of the service principal of the AZURE_TENANT_ID,
+// AZURE_CLIENT_ID and AZURE_CLIENT_SECRET environment variables, or of the account the Azure CLI is logged in with.
+func getAADTokenProvider(env azure.Environment) (adal.OAuthTokenProvider, error) {
+	tenantID := os.Getenv("AZURE_TENANT_ID")
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
+	if len(tenantID) > 0 && len(clientID) > 0 && len(clientSecret) > 0 {
+		oauthConfig, err := adal.NewOAuthConfig(env.ActiveDirectoryEndpoint, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		spt, err := adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, env.ResourceManagerEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate the service principal: %w", err)
+		}
+		// The token requests go through the same proxy as the registry requests.
+		spt.SetSender(httpClient)
+		return spt, nil
+	}
+	out, err := exec.Command("az", "account", "get-access-token", "--resource", env.ResourceManagerEndpoint, "--output", "json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get an Azure Resource Manager token, set AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET or log in with az login: %w", err)
+	}
+	var cliToken struct {
+		AccessToken string `json:"accessToken"`
+	}
+	if err := json.Unmarshal(out, &cliToken); err != nil {
+		return nil, fmt.Errorf("failed to parse the Azure CLI token: %w", err)
+	}
+	return &adal.Token{AccessToken: cliToken.AccessToken}, nil
+}
+
+// CreateScopeMap creates or replaces a scope map and waits until it is provisioned.
+func (c *ManagementClient) CreateScopeMap(ctx context.Context, name string, description string, actions []string) (*ScopeMap, error) {
+	body := ScopeMap{Properties: ScopeMapProperties{Description: description, Actions: actions}}
+	path := c.registryID + "/scopeMaps/" + url.PathEscape(name)
+	var scopeMap ScopeMap
+	if _, err := c.do(ctx, http.MethodPut, path, body, &scopeMap); err != nil {
+		return nil, fmt.Errorf("failed to create scope map %s: %w", name, err)
+	}
+	if err := c.waitForProvisioning(ctx, path, &scopeMap, func() string { return scopeMap.Properties.ProvisioningState }); err != nil {
+		return nil, fmt.Errorf("failed to create scope map %s: %w", name, err)
+	}
+	return &scopeMap, nil
+}
+
+// DeleteScopeMap deletes a scope map, a scope map that does not exist is not an error.
+func (c *ManagementClient) DeleteScopeMap(ctx context.Context, name string) error {
+	return c.delete(ctx, c.registryID+"/scopeMaps/"+url.PathEscape(name))
+}
+
+// CreateToken creates or replaces an enabled token that uses the scope map and waits until it is provisioned.
+func (c *ManagementClient) CreateToken(ctx context.Context, name string, scopeMapID string) (*Token, error) {
+	body := Token{Properties: TokenProperties{ScopeMapID: scopeMapID, Status: "enabled"}}
+	path := c.registryID + "/tokens/" + url.PathEscape(name)
+	var token Token
+	if _, err := c.do(ctx, http.MethodPut, path, body, &token); err != nil {
+		return nil, fmt.Errorf("failed to create token %s: %w", name, err)
+	}
+	if err := c.waitForProvisioning(ctx, path, &token, func() string { return token.Properties.ProvisioningState }); err != nil {
+		return nil, fmt.Errorf("failed to create token %s: %w", name, err)
+	}
+	return &token, nil
+}
+
+// GetToken returns a token.
+func (c *ManagementClient) GetToken(ctx context.Context, name string) (*Token, error) {
+	var token Token
+	if _, err := c.do(ctx, http.MethodGet, c.registryID+"/tokens/"+url.PathEscape(name), nil, &token); err != nil {
+		return nil, fmt.Errorf("failed to get token %s: %w", name, err)
+	}
+	return &token, nil
+}
+
+// ListTokens returns all the tokens of the registry.
+func (c *ManagementClient) ListTokens(ctx context.Context) ([]Token, error) {
+	tokens := []Token{}
+	next := c.registryID + "/tokens"
+	for len(next) > 0 {
+		var page struct {
+			Value    []Token `json:"value"`
+			NextLink string  `json:"nextLink"`
+		}
+		if _, err := c.do(ctx, http.MethodGet, next, nil, &page); err != nil {
+			return nil, fmt.Errorf("failed to list tokens: %w", err)
+		}
+		tokens = append(tokens, page.Value...)
+		next = page.NextLink
+	}
+	return tokens, nil
+}
+
+// DeleteToken deletes a token and waits until it is gone so that its scope map can be deleted afterwards, a token
+// that does not exist is not an error.
+func (c *ManagementClient) DeleteToken(ctx context.Context, name string) error {
+	path := c.registryID + "/tokens/" + url.PathEscape(name)
+	if err := c.delete(ctx, path); err != nil {
+		return err
+	}
+	for {
+		_, err := c.do(ctx, http.MethodGet, path, nil, nil)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete token %s: %w", name, err)
+		}
+		if err := sleep(ctx, managementPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// GenerateCredentials generates a password for a token, an expiry of zero generates a password that never expires.
+func (c *ManagementClient) GenerateCredentials(ctx context.Context, tokenID string, expiry time.Time) (*TokenCredentials, error) {
+	body := struct {
+		TokenID string `json:"tokenId"`
+		Name    string `json:"name"`
+		Expiry  string `json:"expiry,omitempty"`
+	}{TokenID: tokenID, Name: "password1"}
+	if !expiry.IsZero() {
+		body.Expiry = expiry.UTC().Format(time.RFC3339)
+	}
+	var credentials TokenCredentials
+	resp, err := c.do(ctx, http.MethodPost, c.registryID+"/generateCredentials", body, &credentials)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate credentials: %w", err)
+	}
+	// The credentials are generated asynchronously, the result is available at the location of the operation.
+	location := resp.Header.Get("Location")
+	for resp.StatusCode == http.StatusAccepted && len(location) > 0 {
+		if err := sleep(ctx, managementPollInterval); err != nil {
+			return nil, err
+		}
+		if resp, err = c.do(ctx, http.MethodGet, location, nil, &credentials); err != nil {
+			return nil, fmt.Errorf("failed to generate credentials: %w", err)
+		}
+	}
+	if len(credentials.Passwords) == 0 {
+		return nil, errors.New("failed to generate credentials, no password was returned")
+	}
+	return &credentials, nil
+}
+
+// ImportImage imports an image of another registry with the target tags and waits until the import is done, the
+// registry copies the image itself so it never goes through the client. If force is set the target tags are moved
+// even if they already reference another image.
+func (c *ManagementClient) ImportImage(ctx context.Context, source ImportSource, targetTags []string, force bool) error {
+	body := struct {
+		Source     ImportSource `json:"source"`
+		TargetTags []string     `json:"targetTags"`
+		Mode       string       `json:"mode"`
+	}{Source: source, TargetTags: targetTags, Mode: "NoForce"}
+	if force {
+		body.Mode = "Force"
+	}
+	resp, err := c.do(ctx, http.MethodPost, c.registryID+"/importImage", body, nil)
+	if err != nil {
+		return fmt.Errorf("failed to import %s: %w", source.SourceImage, err)
+	}
+	// The import runs asynchronously, it is done when its location stops answering that it was accepted.
+	location := resp.Header.Get("Location")
+	for resp.StatusCode == http.StatusAccepted && len(location) > 0 {
+		if err := sleep(ctx, managementPollInterval); err != nil {
+			return err
+		}
+		if resp, err = c.do(ctx, http.MethodGet, location, nil, nil); err != nil {
+			return fmt.Errorf("failed to import %s: %w", source.SourceImage, err)
+		}
+	}
+	return nil
+}
+
+// ListReplications returns the replications of the registry, including the one of its home region.
+func (c *ManagementClient) ListReplications(ctx context.Context) ([]Replication, error) {
+	replications := []Replication{}
+	next := c.registryID + "/replications"
+	for len(next) > 0 {
+		var page struct {
+			Value    []Replication `json:"value"`
+			NextLink string        `json:"nextLink"`
+		}
+		if _, err := c.do(ctx, http.MethodGet, next, nil, &page); err != nil {
+			return nil, fmt.Errorf("failed to list replications: %w", err)
+		}
+		replications = append(replications, page.Value...)
+		next = page.NextLink
+	}
+	return replications, nil
+}
+
+// waitForProvisioning polls a resource until its provisioning state is terminal, state returns the provisioning
+// state of the last response decoded into result.
+func (c *ManagementClient) waitForProvisioning(ctx context.Context, path string, result interface{}, state func() string) error {
+	for {
+		switch state() {
+		case provisioningSucceeded, "":
+			return nil
+		case provisioningFailed, provisioningCanceled:
+			return fmt.Errorf("provisioning state is %s", state())
+		}
+		if err := sleep(ctx, managementPollInterval); err != nil {
+			return err
+		}
+		if _, err := c.do(ctx, http.MethodGet, path, nil, result); err != nil {
+			return err
+		}
+	}
+}
+
+// delete sends a DELETE request, a resource that is not found is considered deleted.
+func (c *ManagementClient) delete(ctx context.Context, path string) error {
+	if _, err := c.do(ctx, http.MethodDelete, path, nil, nil); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// do sends a request to Azure Resource Manager, the path can also be an absolute URL (e.g. a nextLink). The JSON
+// body of a successful response is decoded into result if it is not nil. A StatusError is returned if the status code
+// is not a success so that errors.Is matches the sentinel of the status, the response is returned with it.
+func (c *ManagementClient) do(ctx context.Context, method string, path string, body interface{}, result interface{}) (*http.Response, error) {
+	target := path
+	if !strings.HasPrefix(path, "https://") && !strings.HasPrefix(path, "http://") {
+		target = c.baseURI + path
+	}
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	query := parsed.Query()
+	if len(query.Get("api-version")) == 0 {
+		query.Set("api-version", managementAPIVersion)
+		parsed.RawQuery = query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(bodyBytes)
+	}
+	req, err := http.NewRequest(method, parsed.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+	if len(userAgent) > 0 {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	req, err = autorest.Prepare(req.WithContext(ctx), c.authorizer.WithAuthorization())
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize request: %w", err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, &StatusError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("%s %s failed with status %s: %s", method, parsed.Path, resp.Status, managementErrorMessage(respBytes))}
+	}
+	if result != nil && len(respBytes) > 0 {
+		if err := json.Unmarshal(respBytes, result); err != nil {
+			return resp, fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// managementErrorMessage returns the message of an Azure Resource Manager error body.
+func managementErrorMessage(body []byte) string {
+	var armError struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &armError); err != nil || len(armError.Error.Code) == 0 {
+		return strings.TrimSpace(string(body))
+	}
+	return armError.Error.Code + ": " + armError.Error.Message
+}
+
+// sleep waits for the duration unless the context is done first.
+func sleep(ctx context.Context, duration time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+		return nil
+	}
+}
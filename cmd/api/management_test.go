@@ -0,0 +1,181 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestManagementClient runs the client against a fake Azure Resource Manager that provisions resources asynchronously.
+func TestManagementClient(t *testing.T) {
+	defer func(interval time.Duration) { managementPollInterval = interval }(managementPollInterval)
+	managementPollInterval = 0
+	ctx := context.Background()
+	registryID := "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ContainerRegistry/registries/example"
+	resources := map[string]map[string]interface{}{}
+	polls := map[string]int{}
+	var imported map[string]interface{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The cache rules are only available in a newer version of the API.
+		if version := r.URL.Query().Get("api-version"); version != managementAPIVersion && !(strings.HasPrefix(r.URL.Path, registryID+"/cacheRules") && version == cacheRulesAPIVersion) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut:
+			var resource map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&resource)
+			resource["id"] = r.URL.Path
+			resource["name"] = r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+			resource["properties"].(map[string]interface{})["provisioningState"] = "Creating"
+			resources[r.URL.Path] = resource
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(resource)
+		case r.Method == http.MethodGet && r.URL.Path == registryID+"/tokens":
+			tokens := []interface{}{}
+			for path, resource := range resources {
+				if strings.Contains(path, "/tokens/") {
+					tokens = append(tokens, resource)
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"value": tokens})
+		case r.Method == http.MethodGet && r.URL.Path == registryID+"/replications":
+			fmt.Fprint(w, `{"value":[{"name":"eastus","location":"eastus","properties":{"provisioningState":"Succeeded","status":{"displayStatus":"Ready"}}}],"nextLink":"`+server.URL+registryID+`/replications2"}`)
+		case r.Method == http.MethodGet && r.URL.Path == registryID+"/replications2":
+			fmt.Fprint(w, `{"value":[{"name":"westus","location":"westus","properties":{"provisioningState":"Updating","status":{"displayStatus":"Syncing"}}}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == registryID+"/cacheRules":
+			fmt.Fprint(w, `{"value":[{"name":"nginx","properties":{"sourceRepository":"docker.io/library/nginx","targetRepository":"library/nginx"}}],"nextLink":"`+server.URL+registryID+`/cacheRules2?api-version=`+cacheRulesAPIVersion+`"}`)
+		case r.Method == http.MethodGet && r.URL.Path == registryID+"/cacheRules2":
+			fmt.Fprint(w, `{"value":[{"name":"mcr","properties":{"sourceRepository":"mcr.microsoft.com/*","targetRepository":"mcr/*"}}]}`)
+		case r.Method == http.MethodGet && r.URL.Path == registryID:
+			fmt.Fprint(w, `{"id":"`+registryID+`","name":"example","location":"eastus","sku":{"name":"Premium","tier":"Premium"}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/operations/import":
+			// The import is done after being polled twice.
+			if polls[r.URL.Path]++; polls[r.URL.Path] < 2 {
+				w.Header().Set("Location", server.URL+"/operations/import?api-version="+managementAPIVersion)
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == "/operations/credentials":
+			fmt.Fprint(w, `{"username":"purge","passwords":[{"name":"password1","value":"secret"}]}`)
+		case r.Method == http.MethodGet:
+			resource, ok := resources[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error":{"code":"ResourceNotFound","message":"not found"}}`)
+				return
+			}
+			// The resources are provisioned after being polled once.
+			polls[r.URL.Path]++
+			resource["properties"].(map[string]interface{})["provisioningState"] = "Succeeded"
+			json.NewEncoder(w).Encode(resource)
+		case r.Method == http.MethodPost && r.URL.Path == registryID+"/generateCredentials":
+			w.Header().Set("Location", server.URL+"/operations/credentials?api-version="+managementAPIVersion)
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPost && r.URL.Path == registryID+"/importImage":
+			json.NewDecoder(r.Body).Decode(&imported)
+			w.Header().Set("Location", server.URL+"/operations/import?api-version="+managementAPIVersion)
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodDelete:
+			if _, ok := resources[r.URL.Path]; !ok {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			delete(resources, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+	client := newManagementClient(server.URL, autorest.NullAuthorizer{}, "sub", "rg", "example.azurecr.io")
+	// First test, the scope map and the token are created and the client waits until they are provisioned.
+	t.Run("CreateTest", func(t *testing.T) {
+		assert := assert.New(t)
+		scopeMap, err := client.CreateScopeMap(ctx, "purge-scope-map", "", []string{"repositories/hello/content/delete"})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(registryID+"/scopeMaps/purge-scope-map", scopeMap.ID)
+		assert.Equal("Succeeded", scopeMap.Properties.ProvisioningState)
+		token, err := client.CreateToken(ctx, "purge", scopeMap.ID)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(scopeMap.ID, token.Properties.ScopeMapID)
+		assert.Equal(1, polls[token.ID])
+		credentials, err := client.GenerateCredentials(ctx, token.ID, time.Time{})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("purge", credentials.Username)
+		assert.Equal("secret", credentials.Passwords[0].Value)
+	})
+	// Second test, the tokens are listed.
+	t.Run("ListTest", func(t *testing.T) {
+		assert := assert.New(t)
+		tokens, err := client.ListTokens(ctx)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, len(tokens))
+		assert.Equal("purge", tokens[0].Name)
+	})
+	// Third test, the token is deleted and the error of a missing token is reported.
+	t.Run("DeleteTest", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal(nil, client.DeleteToken(ctx, "purge"), "Error should be nil")
+		assert.Equal(nil, client.DeleteScopeMap(ctx, "purge-scope-map"), "Error should be nil")
+		assert.Equal(0, len(resources))
+		_, err := client.GetToken(ctx, "purge")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), "ResourceNotFound: not found")
+	})
+	// Fourth test, the replications are listed following the next links.
+	t.Run("ListReplicationsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		replications, err := client.ListReplications(ctx)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, len(replications))
+		assert.Equal("eastus", replications[0].Location)
+		assert.Equal("Syncing", replications[1].Properties.Status.DisplayStatus)
+	})
+	// Fifth test, the SKU of the registry is read from its resource.
+	t.Run("GetRegistryTest", func(t *testing.T) {
+		assert := assert.New(t)
+		registry, err := client.GetRegistry(ctx)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("example", registry.Name)
+		assert.Equal(SKUPremium, registry.SKU.Name)
+	})
+	// Sixth test, an image is imported with the credentials of its registry and the client waits until it is done.
+	t.Run("ImportImageTest", func(t *testing.T) {
+		assert := assert.New(t)
+		source := ImportSource{RegistryURI: "docker.io", SourceImage: "library/nginx:1.25", Credentials: &ImportSourceCredentials{Username: "user", Password: "secret"}}
+		err := client.ImportImage(ctx, source, []string{"nginx:1.25"}, false)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, polls["/operations/import"])
+		assert.Equal("NoForce", imported["mode"])
+		assert.Equal([]interface{}{"nginx:1.25"}, imported["targetTags"])
+		importedSource := imported["source"].(map[string]interface{})
+		assert.Equal("library/nginx:1.25", importedSource["sourceImage"])
+		assert.Equal("secret", importedSource["credentials"].(map[string]interface{})["password"])
+	})
+	// Seventh test, the cache rules of every page are listed and match the repositories they cache.
+	t.Run("ListCacheRulesTest", func(t *testing.T) {
+		assert := assert.New(t)
+		rules, err := client.ListCacheRules(ctx)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Len(rules, 2)
+		assert.Equal("docker.io/library/nginx", rules[0].Properties.SourceRepository)
+		assert.True(rules[0].Matches("library/nginx"))
+		assert.False(rules[0].Matches("library/nginx-unprivileged"))
+		assert.True(rules[1].Matches("mcr/dotnet/runtime"))
+		assert.False(rules[1].Matches("mcrapps/hello"))
+	})
+}
@@ -0,0 +1,573 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	acrapi "github.com/Azure/acr-cli/acr"
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// The values accepted for the registry type, auto detects whether the registry is an ACR.
+const (
+	RegistryTypeAuto = "auto"
+	RegistryTypeACR  = "acr"
+	RegistryTypeOCI  = "oci"
+)
+
+// acrDomains are the suffixes of the login servers of ACR registries in the public and sovereign clouds.
+var acrDomains = []string{".azurecr.io", ".azurecr.cn", ".azurecr.us", ".azurecr.de"}
+
+// createdAnnotation is the annotation that contains the creation time of an image.
+const createdAnnotation = "org.opencontainers.image.created"
+
+// DetectRegistryType resolves the auto registry type. ACR login servers are recognized by their domain, other
+// registries are ACRs if their token endpoint is the ACR one (e.g. registries with a custom domain).
+func DetectRegistryType(ctx context.Context, loginURL string, registryType string) (string, error) {
+	switch registryType {
+	case RegistryTypeACR, RegistryTypeOCI:
+		return registryType, nil
+	case RegistryTypeAuto, "":
+	default:
+		return "", fmt.Errorf("invalid registry type %q, supported values are %q, %q and %q", registryType, RegistryTypeAuto, RegistryTypeACR, RegistryTypeOCI)
+	}
+	for _, domain := range acrDomains {
+		if strings.HasSuffix(loginURL, domain) {
+			return RegistryTypeACR, nil
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, LoginURLWithPrefix(loginURL)+"/v2/", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("unable to detect the registry type: %w", err)
+	}
+	resp.Body.Close()
+	if scheme, params := parseChallenge(resp.Header.Get("WWW-Authenticate")); scheme == "bearer" && strings.HasSuffix(params["realm"], "/oauth2/token") {
+		return RegistryTypeACR, nil
+	}
+	return RegistryTypeOCI, nil
+}
+
+// OCIClient implements the AcrCLIClientInterface with the APIs of the OCI distribution specification, so it can be
+// used with any compliant registry. The registry does not report when a tag was updated, the creation time of the
+// image it references is used instead. Manifests without tags cannot be listed and repositories have no attributes.
+type OCIClient struct {
+	loginURL string
+	scheme   string
+	client   *http.Client
+	username string
+	password string
+	pageSize int
+
+	mu sync.Mutex
+	// tokens contains the bearer token obtained for every scope, useBasic is set if the registry asked for basic auth.
+	tokens   map[string]string
+	useBasic bool
+	// createdTimes contains the creation time of every manifest that was inspected, manifests are immutable.
+	createdTimes map[string]string
+}
+
+// NewOCIClient creates a client for a registry that is not an ACR, the credentials are resolved the same way as for
+// an ACR. If no credentials are found the requests are anonymous.
+func NewOCIClient(loginURL string, username string, password string, configs []string) (*OCIClient, error) {
+	chain := NewAuthChain(authMode, AuthOptions{Username: username, Password: password, Configs: configs, TokenFile: tokenFile})
+	credential, err := ResolveCredential(context.Background(), chain, loginURL)
+	if err != nil {
+		if authMode != AuthModeAuto {
+			return nil, err
+		}
+		// Public repositories can be read anonymously, so missing credentials are not an error.
+		credential = Credential{}
+	}
+	return newOCIClient(loginURL, registryScheme(), httpClient, credential.Username, credential.Password), nil
+}
+
+// newOCIClient creates an OCIClient that connects to the registry with the specified scheme and http client.
+func newOCIClient(loginURL string, scheme string, client *http.Client, username string, password string) *OCIClient {
+	return &OCIClient{
+		loginURL:     loginURL,
+		scheme:       scheme,
+		client:       client,
+		username:     username,
+		password:     password,
+		pageSize:     manifestTagFetchCount,
+		tokens:       map[string]string{},
+		createdTimes: map[string]string{},
+	}
+}
+
+// GetAcrRepositories returns a page of the catalog of the registry.
+func (c *OCIClient) GetAcrRepositories(ctx context.Context, last string) (*acrapi.Repositories, error) {
+	query := url.Values{"n": {fmt.Sprint(pageSize(ctx, c.pageSize))}}
+	if len(last) > 0 {
+		query.Set("last", last)
+	}
+	var result acrapi.Repositories
+	resp, err := c.do(ctx, http.MethodGet, "/v2/_catalog?"+query.Encode(), nil, "registry:catalog:*", "", nil)
+	result.Response = autorest.Response{Response: resp}
+	if err != nil {
+		return &result, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return &result, fmt.Errorf("failed to parse catalog: %w", err)
+	}
+	return &result, nil
+}
+
+// GetAcrTags returns a page of tags, the digest and creation time of every tag are obtained from its manifest. Tags
+// are listed in lexical order, the order by argument is ignored.
+func (c *OCIClient) GetAcrTags(ctx context.Context, repoName string, orderBy string, last string) (*acrapi.RepositoryTagsType, error) {
+	query := url.Values{"n": {fmt.Sprint(pageSize(ctx, c.pageSize))}}
+	if len(last) > 0 {
+		query.Set("last", last)
+	}
+	var result acrapi.RepositoryTagsType
+	resp, err := c.do(ctx, http.MethodGet, "/v2/"+repoName+"/tags/list?"+query.Encode(), nil, pullScope(repoName), "", nil)
+	result.Response = autorest.Response{Response: resp}
+	if err != nil {
+		return &result, err
+	}
+	defer resp.Body.Close()
+	var tagList struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tagList); err != nil {
+		return &result, fmt.Errorf("failed to parse tag list: %w", err)
+	}
+	if len(tagList.Tags) == 0 {
+		return &result, nil
+	}
+	deleteEnabled := true
+	tags := []acrapi.TagAttributesBase{}
+	for i := range tagList.Tags {
+		manifestBytes, digest, err := c.getManifest(ctx, repoName, tagList.Tags[i])
+		if err != nil {
+			return &result, fmt.Errorf("failed to get manifest of %s:%s: %w", repoName, tagList.Tags[i], err)
+		}
+		created, err := c.createdTime(ctx, repoName, digest, manifestBytes)
+		if err != nil {
+			return &result, err
+		}
+		tags = append(tags, acrapi.TagAttributesBase{
+			Name:           &tagList.Tags[i],
+			Digest:         &digest,
+			CreatedTime:    &created,
+			LastUpdateTime: &created,
+			// The distribution API cannot lock images, so every tag can be deleted.
+			ChangeableAttributes: &acrapi.ChangeableAttributes{DeleteEnabled: &deleteEnabled, WriteEnabled: &deleteEnabled},
+		})
+	}
+	result.TagsAttributes = &tags
+	return &result, nil
+}
+
+// DeleteAcrRepository always fails, the distribution API cannot delete repositories.
+func (c *OCIClient) DeleteAcrRepository(ctx context.Context, repoName string) (*autorest.Response, error) {
+	return nil, errors.New("deleting repositories is not supported by the OCI distribution API")
+}
+
+// DeleteAcrTag deletes a tag without deleting the manifest it references, registries that do not implement tag
+// deletion return an error.
+func (c *OCIClient) DeleteAcrTag(ctx context.Context, repoName string, reference string) (*autorest.Response, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/v2/"+repoName+"/manifests/"+reference, nil, deleteScope(repoName), "", nil)
+	if resp != nil && (resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusMethodNotAllowed) {
+		return &autorest.Response{Response: resp}, fmt.Errorf("the registry does not support deleting the tag %s:%s without deleting its manifest", repoName, reference)
+	}
+	return c.close(resp, err)
+}
+
+// DeleteAcrTags always fails, the distribution API deletes a single reference per request.
+func (c *OCIClient) DeleteAcrTags(ctx context.Context, repoName string, tags []string) (*autorest.Response, error) {
+	return nil, errors.New("batch tag deletion is not supported by the OCI distribution API")
+}
+
+// SupportsBatchTagDelete returns false, the distribution API deletes a single reference per request.
+func (c *OCIClient) SupportsBatchTagDelete(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+// GetAcrManifests always fails, the distribution API can only list tags.
+func (c *OCIClient) GetAcrManifests(ctx context.Context, repoName string, orderBy string, last string) (*acrapi.Manifests, error) {
+	return nil, errors.New("listing manifests is not supported by the OCI distribution API")
+}
+
+// DeleteManifest deletes a manifest using the digest as a reference.
+func (c *OCIClient) DeleteManifest(ctx context.Context, repoName string, reference string) (*autorest.Response, error) {
+	resp, err := c.do(ctx, http.MethodDelete, "/v2/"+repoName+"/manifests/"+reference, nil, deleteScope(repoName), "", nil)
+	return c.close(resp, err)
+}
+
+// GetManifest fetches a manifest and returns it as a byte array.
+func (c *OCIClient) GetManifest(ctx context.Context, repoName string, reference string) ([]byte, error) {
+	manifestBytes, _, err := c.getManifest(ctx, repoName, reference)
+	return manifestBytes, err
+}
+
+// HeadManifest returns the digest of the manifest a reference points to without fetching the manifest, the digest is
+// empty if the manifest does not exist.
+func (c *OCIClient) HeadManifest(ctx context.Context, repoName string, reference string) (string, error) {
+	header := http.Header{"Accept": {manifestAcceptHeader}}
+	resp, err := c.do(ctx, http.MethodHead, "/v2/"+repoName+"/manifests/"+reference, header, pullScope(repoName), "", nil)
+	if err != nil {
+		if IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get(dockerContentDigestHeader), nil
+}
+
+// GetReferrers returns the image index of the manifests whose subject is the digest.
+func (c *OCIClient) GetReferrers(ctx context.Context, repoName string, digest string) ([]byte, error) {
+	header := http.Header{"Accept": {ociIndexContentType}}
+	resp, err := c.do(ctx, http.MethodGet, "/v2/"+repoName+"/referrers/"+digest, header, pullScope(repoName), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// GetBlob fetches a blob and returns it as a byte array.
+func (c *OCIClient) GetBlob(ctx context.Context, repoName string, digest string) ([]byte, error) {
+	content, err := c.OpenBlob(ctx, repoName, digest)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return ioutil.ReadAll(content)
+}
+
+// OpenBlob fetches a blob and returns its content as it is received, it has to be closed.
+func (c *OCIClient) OpenBlob(ctx context.Context, repoName string, digest string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/v2/"+repoName+"/blobs/"+digest, nil, pullScope(repoName), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// PutManifest uploads the manifest bytes exactly as they are and tags them with the reference, the digest the
+// registry returns is checked like for an ACR.
+func (c *OCIClient) PutManifest(ctx context.Context, repoName string, reference string, mediaType string, manifestBytes []byte) (*autorest.Response, error) {
+	if err := checkPushReference(repoName, reference, manifestBytes); err != nil {
+		return nil, err
+	}
+	resp, err := c.close(c.do(ctx, http.MethodPut, "/v2/"+repoName+"/manifests/"+reference, nil, pushScope(repoName), mediaType, manifestBytes))
+	if err != nil {
+		return resp, err
+	}
+	return resp, verifyPushedDigest(repoName, manifestBytes, resp.Response)
+}
+
+// PutBlob uploads a small blob with a single request after starting the upload session.
+func (c *OCIClient) PutBlob(ctx context.Context, repoName string, digest string, content []byte) error {
+	resp, err := c.do(ctx, http.MethodPost, "/v2/"+repoName+"/blobs/uploads/", nil, pushScope(repoName), "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	location, err := resp.Location()
+	if err != nil {
+		return fmt.Errorf("failed to start the upload of %s@%s: %w", repoName, digest, err)
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+	_, err = c.close(c.do(ctx, http.MethodPut, location.RequestURI(), nil, pushScope(repoName), "application/octet-stream", content))
+	return err
+}
+
+// GetAcrRepositoryAttributes always fails, repositories have no attributes in the distribution API.
+func (c *OCIClient) GetAcrRepositoryAttributes(ctx context.Context, repoName string) (*acrapi.RepositoryAttributes, error) {
+	return nil, errors.New("repository attributes are not supported by the OCI distribution API")
+}
+
+// GetManifestMetadata always fails, manifests have no metadata in the distribution API.
+func (c *OCIClient) GetManifestMetadata(ctx context.Context, repoName string, reference string, metadata string) (interface{}, error) {
+	return nil, errors.New("manifest metadata is not supported by the OCI distribution API")
+}
+
+// UpdateAcrRepositoryAttributes always fails, repositories have no attributes in the distribution API.
+func (c *OCIClient) UpdateAcrRepositoryAttributes(ctx context.Context, repoName string, value *acrapi.ChangeableAttributes) (*autorest.Response, error) {
+	return nil, errors.New("repository attributes are not supported by the OCI distribution API")
+}
+
+// getManifest fetches a manifest and returns its body and digest.
+func (c *OCIClient) getManifest(ctx context.Context, repoName string, reference string) ([]byte, string, error) {
+	header := http.Header{"Accept": {manifestAcceptHeader}}
+	resp, err := c.do(ctx, http.MethodGet, "/v2/"+repoName+"/manifests/"+reference, header, pullScope(repoName), "", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	manifestBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := verifyManifestDigest(repoName, reference, manifestBytes); err != nil {
+		return nil, "", err
+	}
+	digest := resp.Header.Get(dockerContentDigestHeader)
+	if len(digest) == 0 {
+		digest = sha256Digest(manifestBytes)
+	}
+	return manifestBytes, digest, nil
+}
+
+// createdTime returns when the image of a manifest was created in RFC3339 format. The created annotation is used if
+// present, otherwise the creation time of the config, indexes use the time of their first manifest. Images without
+// a creation time are treated as if they were just created so that they are never old enough to be purged.
+func (c *OCIClient) createdTime(ctx context.Context, repoName string, digest string, manifestBytes []byte) (string, error) {
+	c.mu.Lock()
+	created, ok := c.createdTimes[digest]
+	c.mu.Unlock()
+	if ok {
+		return created, nil
+	}
+	var manifest struct {
+		Annotations map[string]string `json:"annotations"`
+		Config      struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Manifests []struct {
+			Digest string `json:"digest"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return "", fmt.Errorf("failed to parse manifest %s: %w", digest, err)
+	}
+	created = manifest.Annotations[createdAnnotation]
+	switch {
+	case len(created) > 0:
+	case len(manifest.Config.Digest) > 0:
+		configBytes, err := c.GetBlob(ctx, repoName, manifest.Config.Digest)
+		if err != nil {
+			return "", fmt.Errorf("failed to get the config of %s: %w", digest, err)
+		}
+		var config struct {
+			Created string `json:"created"`
+		}
+		if err := json.Unmarshal(configBytes, &config); err == nil {
+			created = config.Created
+		}
+	case len(manifest.Manifests) > 0:
+		childBytes, childDigest, err := c.getManifest(ctx, repoName, manifest.Manifests[0].Digest)
+		if err != nil {
+			return "", fmt.Errorf("failed to get the manifests of %s: %w", digest, err)
+		}
+		if created, err = c.createdTime(ctx, repoName, childDigest, childBytes); err != nil {
+			return "", err
+		}
+	}
+	if _, err := time.Parse(time.RFC3339Nano, created); err != nil {
+		created = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	c.mu.Lock()
+	c.createdTimes[digest] = created
+	c.mu.Unlock()
+	return created, nil
+}
+
+// do sends a request to the registry and authenticates it as the registry asks in its challenge. An error is
+// returned if the status code is not a success, the response is returned too so the status code can be checked.
+func (c *OCIClient) do(ctx context.Context, method string, path string, header http.Header, scope string, contentType string, body []byte) (*http.Response, error) {
+	resp, err := c.send(ctx, method, path, header, scope, contentType, body)
+	if err != nil {
+		return nil, dataEndpointError(err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authenticate(ctx, challenge, scope); err != nil {
+			return nil, &AuthError{err: err}
+		}
+		if resp, err = c.send(ctx, method, path, header, scope, contentType, body); err != nil {
+			return nil, dataEndpointError(err)
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return resp, &StatusError{
+			StatusCode: resp.StatusCode,
+			Message:    fmt.Sprintf("%s %s failed with status %s: %s", method, path, resp.Status, registryErrorMessage(resp.Body)),
+		}
+	}
+	return resp, nil
+}
+
+// send sends a single request with the credentials obtained so far.
+func (c *OCIClient) send(ctx context.Context, method string, path string, header http.Header, scope string, contentType string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.scheme+"://"+c.loginURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if len(userAgent) > 0 {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	c.mu.Lock()
+	if token, ok := c.tokens[scope]; ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if c.useBasic {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	c.mu.Unlock()
+	return c.client.Do(req.WithContext(ctx))
+}
+
+// authenticate answers a challenge, basic challenges use the credentials directly and bearer challenges exchange
+// them for a token of the requested scope.
+func (c *OCIClient) authenticate(ctx context.Context, challenge string, scope string) error {
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if len(c.password) == 0 {
+			return fmt.Errorf("the registry %s requires credentials", c.loginURL)
+		}
+		c.mu.Lock()
+		c.useBasic = true
+		c.mu.Unlock()
+		return nil
+	case "bearer":
+	default:
+		return fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	query := url.Values{}
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	req, err := http.NewRequest(http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if len(c.password) > 0 {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to get token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get token for %s, status %s", scope, resp.Status)
+	}
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return fmt.Errorf("failed to parse token: %w", err)
+	}
+	token := tokenResponse.Token
+	if len(token) == 0 {
+		token = tokenResponse.AccessToken
+	}
+	c.mu.Lock()
+	c.tokens[scope] = token
+	c.mu.Unlock()
+	return nil
+}
+
+// close closes the body of a response and wraps it in an autorest response.
+func (c *OCIClient) close(resp *http.Response, err error) (*autorest.Response, error) {
+	if resp != nil && err == nil {
+		resp.Body.Close()
+	}
+	return &autorest.Response{Response: resp}, err
+}
+
+// parseChallenge parses a WWW-Authenticate header (e.g. Bearer realm="https://auth.example.com/token",service="example")
+// and returns the lower case scheme and the parameters.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	challenge = strings.TrimSpace(challenge)
+	i := strings.Index(challenge, " ")
+	if i < 0 {
+		return strings.ToLower(challenge), params
+	}
+	scheme := strings.ToLower(challenge[:i])
+	rest := challenge[i+1:]
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
+
+// registryErrorMessage returns the message of the first error of a registry error response.
+func registryErrorMessage(body io.Reader) string {
+	content, err := ioutil.ReadAll(io.LimitReader(body, 64*1024))
+	if err != nil {
+		return err.Error()
+	}
+	var registryErrors struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(content, &registryErrors); err != nil || len(registryErrors.Errors) == 0 {
+		return strings.TrimSpace(string(content))
+	}
+	return registryErrors.Errors[0].Message
+}
+
+// pullScope, pushScope and deleteScope return the token scopes needed to read, write and delete in a repository.
+func pullScope(repoName string) string {
+	return "repository:" + repoName + ":pull"
+}
+
+func pushScope(repoName string) string {
+	return "repository:" + repoName + ":pull,push"
+}
+
+func deleteScope(repoName string) string {
+	return "repository:" + repoName + ":delete"
+}
@@ -0,0 +1,151 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseChallenge contains the tests for the parsing of WWW-Authenticate headers.
+func TestParseChallenge(t *testing.T) {
+	assert := assert.New(t)
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="example.com",scope="repository:a/b:pull,push"`)
+	assert.Equal("bearer", scheme)
+	assert.Equal("https://auth.example.com/token", params["realm"])
+	assert.Equal("example.com", params["service"])
+	assert.Equal("repository:a/b:pull,push", params["scope"])
+	scheme, params = parseChallenge(`Basic realm=registry`)
+	assert.Equal("basic", scheme)
+	assert.Equal("registry", params["realm"])
+	scheme, _ = parseChallenge("")
+	assert.Equal("", scheme)
+}
+
+// TestOCIClient runs the client against a registry that only implements the distribution API with token authentication.
+func TestOCIClient(t *testing.T) {
+	ctx := context.Background()
+	configBody := `{"created":"2019-10-01T00:00:00Z","architecture":"amd64","os":"linux"}`
+	configDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(configBody)))
+	manifestBody := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"` + configDigest + `"}}`
+	manifestDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifestBody)))
+	annotatedBody := `{"schemaVersion":2,"annotations":{"org.opencontainers.image.created":"2020-01-01T00:00:00Z"},"config":{"digest":"` + configDigest + `"}}`
+	deleted := []string{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"token":"%s"}`, r.URL.Query().Get("scope"))
+			return
+		}
+		scope := "repository:hello:pull"
+		if r.Method == http.MethodDelete {
+			scope = "repository:hello:delete"
+		}
+		if r.Header.Get("Authorization") != "Bearer "+scope {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="%s"`, server.URL, scope))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v2/hello/tags/list" && r.URL.Query().Get("last") == "":
+			w.Header().Set("Link", `</v2/hello/tags/list?last=v1&n=100>; rel="next"`)
+			fmt.Fprint(w, `{"name":"hello","tags":["v1"]}`)
+		case r.URL.Path == "/v2/hello/tags/list" && r.URL.Query().Get("last") == "v1":
+			fmt.Fprint(w, `{"name":"hello","tags":["v2"]}`)
+		case r.URL.Path == "/v2/hello/manifests/v1" && r.Method == http.MethodGet:
+			w.Header().Set("Docker-Content-Digest", manifestDigest)
+			fmt.Fprint(w, manifestBody)
+		case strings.HasPrefix(r.URL.Path, "/v2/hello/manifests/sha256:") && r.Method == http.MethodGet:
+			// Every digest returns the same body, so only the digest of the body matches it.
+			fmt.Fprint(w, manifestBody)
+		case r.URL.Path == "/v2/hello/manifests/v2" && r.Method == http.MethodGet:
+			fmt.Fprint(w, annotatedBody)
+		case r.URL.Path == "/v2/hello/blobs/"+configDigest:
+			fmt.Fprint(w, configBody)
+		case r.Method == http.MethodDelete && r.URL.Path == "/v2/hello/manifests/v1":
+			deleted = append(deleted, "v1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[{"code":"NAME_UNKNOWN","message":"repository name not known to registry"}]}`)
+		}
+	}))
+	defer server.Close()
+	loginURL := strings.TrimPrefix(server.URL, "http://")
+	// First test, the tags are listed through the pager with their digests and creation times.
+	t.Run("ListTagsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		client := newOCIClient(loginURL, "http", server.Client(), "user", "secret")
+		pager := NewTagPager(client, "hello", "")
+		first, err := pager.Next(ctx)
+		assert.Equal(nil, err, "Error should be nil")
+		tags := *first.TagsAttributes
+		assert.Equal("v1", *tags[0].Name)
+		assert.Equal(manifestDigest, *tags[0].Digest)
+		assert.Equal("2019-10-01T00:00:00Z", *tags[0].LastUpdateTime)
+		assert.Equal(true, *tags[0].ChangeableAttributes.DeleteEnabled)
+		assert.Equal(false, pager.Done())
+		second, err := pager.Next(ctx)
+		assert.Equal(nil, err, "Error should be nil")
+		tags = *second.TagsAttributes
+		assert.Equal("v2", *tags[0].Name)
+		assert.Equal(fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(annotatedBody))), *tags[0].Digest)
+		assert.Equal("2020-01-01T00:00:00Z", *tags[0].LastUpdateTime)
+		assert.Equal(true, pager.Done())
+	})
+	// Second test, a repository that does not exist returns the not found status and the message of the registry.
+	t.Run("NotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		client := newOCIClient(loginURL, "http", server.Client(), "user", "secret")
+		result, err := client.GetAcrTags(ctx, "hello", "", "missing")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), "repository name not known to registry")
+		assert.Equal(http.StatusNotFound, result.StatusCode)
+	})
+	// Third test, tags are deleted with the delete scope and registries that cannot delete tags return an error.
+	t.Run("DeleteTagTest", func(t *testing.T) {
+		assert := assert.New(t)
+		client := newOCIClient(loginURL, "http", server.Client(), "user", "secret")
+		_, err := client.DeleteAcrTag(ctx, "hello", "v1")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{"v1"}, deleted)
+		_, err = client.DeleteAcrTag(ctx, "hello", "v2")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		_, err = client.GetAcrManifests(ctx, "hello", "", "")
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+	// Fourth test, wrong credentials are reported.
+	t.Run("UnauthorizedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		client := newOCIClient(loginURL, "http", server.Client(), "user", "wrong")
+		_, err := client.GetManifest(ctx, "hello", "v1")
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+	// Fifth test, a manifest requested by digest is only returned if its body matches the digest.
+	t.Run("DigestMismatchTest", func(t *testing.T) {
+		assert := assert.New(t)
+		client := newOCIClient(loginURL, "http", server.Client(), "user", "secret")
+		manifestBytes, err := client.GetManifest(ctx, "hello", manifestDigest)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(manifestBody, string(manifestBytes))
+		otherDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(annotatedBody)))
+		_, err = client.GetManifest(ctx, "hello", otherDigest)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.True(IsDigestMismatch(err))
+		assert.Contains(err.Error(), "integrity check failed")
+	})
+}
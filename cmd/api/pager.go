@@ -0,0 +1,300 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	acrapi "github.com/Azure/acr-cli/acr"
+)
+
+// The orders the ACR API can list the tags and manifests in, by default they are listed by name or digest.
+const (
+	OrderByTimeAsc  = "timeasc"
+	OrderByTimeDesc = "timedesc"
+)
+
+// pageCursor keeps track of where the next page of a list operation starts. The registry returns the location of
+// the next page in a RFC 5988 Link header (e.g. </acr/v1/hello/_tags?last=v2&n=100>; rel="next") and omits the
+// header in the last page. When the result does not come from an http response (e.g. snapshots) the last element of
+// the page is used instead and the listing ends with the first empty page. A registry that does not return Link
+// headers at all (e.g. behind a proxy that drops them) is listed the same way as long as its pages are full.
+type pageCursor struct {
+	last string
+	done bool
+	// linked is set once a page had a next link, from then on a page without one is the last page.
+	linked bool
+	// bySize is set while the registry returns no links, the listing then ends with a page that has fewer elements
+	// than were asked for.
+	bySize bool
+}
+
+// advance moves the cursor after a page was received, lastElement is the name or digest of the last element of the
+// page and it is empty when the page did not contain any element. full is true if the page contains as many elements
+// as were asked for.
+func (c *pageCursor) advance(resp *http.Response, lastElement string, full bool) {
+	if len(lastElement) == 0 {
+		// An empty page always finishes the listing, this also protects against links that point to the same page.
+		c.done = true
+		return
+	}
+	if resp == nil {
+		c.last = lastElement
+		return
+	}
+	last, ok := nextLast(resp.Header.Get("Link"))
+	if ok {
+		c.linked = true
+		c.last = last
+		return
+	}
+	if c.linked || !full {
+		c.done = true
+		return
+	}
+	// The registry did not return any link so far and the page is full, so there might be more pages after the last
+	// element of the page.
+	c.bySize = true
+	c.last = lastElement
+}
+
+// nextLast returns the value of the last query parameter of the link with the next relation, the second return value
+// is false if there is no next link.
+func nextLast(header string) (string, bool) {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		isNext := false
+		for _, param := range parts[1:] {
+			if strings.Replace(strings.TrimSpace(param), " ", "", -1) == `rel="next"` {
+				isNext = true
+			}
+		}
+		if !isNext {
+			continue
+		}
+		nextURL, err := url.Parse(strings.Trim(target, "<>"))
+		if err != nil {
+			return "", false
+		}
+		last := nextURL.Query().Get("last")
+		return last, len(last) > 0
+	}
+	return "", false
+}
+
+// httpResponse returns the http response inside an autorest response, it is nil when the result was not obtained
+// through an http request.
+func httpResponse(resp *http.Response) *http.Response {
+	if resp == nil || resp.Header == nil {
+		return nil
+	}
+	return resp
+}
+
+// TagPager iterates over the pages of tags of a repository.
+type TagPager struct {
+	client   TagLister
+	repoName string
+	orderBy  string
+	// prefix is the prefix of the names of the tags the registry returns, empty when the registry lists all the tags.
+	prefix string
+	cursor pageCursor
+	size   pageSizer
+	listed int
+}
+
+// NewTagPager creates a pager that lists the tags of a repository, the first call to Next returns the first page.
+func NewTagPager(client TagLister, repoName string, orderBy string) *TagPager {
+	return &TagPager{client: client, repoName: repoName, orderBy: orderBy}
+}
+
+// RepoName returns the repository the pager lists.
+func (p *TagPager) RepoName() string {
+	return p.repoName
+}
+
+// Done returns true when there are no more pages.
+func (p *TagPager) Done() bool {
+	return p.cursor.done
+}
+
+// Listed returns the number of tags returned by Next so far.
+func (p *TagPager) Listed() int {
+	return p.listed
+}
+
+// Cursor returns where the next page of tags starts, it is empty before the first page.
+func (p *TagPager) Cursor() string {
+	return p.cursor.last
+}
+
+// Seek makes the next page start after the tag returned by Cursor, it is used to resume a listing.
+func (p *TagPager) Seek(last string) {
+	p.cursor.last = last
+}
+
+// OrderBy returns the order the tags are listed in, it is empty for the default order of the registry.
+func (p *TagPager) OrderBy() string {
+	return p.orderBy
+}
+
+// FilterByPrefix makes the registry only return the tags whose name starts with the prefix, it returns false if the
+// client or the registry cannot filter the tags, in that case all the tags are still listed.
+func (p *TagPager) FilterByPrefix(prefix string) bool {
+	lister, ok := p.client.(TagPrefixLister)
+	if len(prefix) == 0 || !ok || !lister.SupportsTagPrefixFilter() {
+		return false
+	}
+	p.prefix = prefix
+	return true
+}
+
+// Stop finishes the listing, the following calls to Next return an empty page.
+func (p *TagPager) Stop() {
+	p.cursor.done = true
+}
+
+// Next returns the next page of tags, the TagsAttributes of the result are nil when there are no more tags. If an
+// error occurs the result is still returned and the pager is done, a repository that does not exist matches
+// ErrNotFound.
+func (p *TagPager) Next(ctx context.Context) (*acrapi.RepositoryTagsType, error) {
+	if p.cursor.done {
+		return &acrapi.RepositoryTagsType{}, nil
+	}
+	var resultTags *acrapi.RepositoryTagsType
+	var err error
+	ctx = p.size.context(ctx)
+	if len(p.prefix) > 0 {
+		resultTags, err = p.client.(TagPrefixLister).GetAcrTagsWithPrefix(ctx, p.repoName, p.orderBy, p.cursor.last, p.prefix)
+	} else {
+		resultTags, err = p.client.GetAcrTags(ctx, p.repoName, p.orderBy, p.cursor.last)
+	}
+	if err != nil || resultTags == nil {
+		p.cursor.done = true
+		if resultTags != nil {
+			err = ResponseError(err, &resultTags.Response, PermissionMetadataRead, p.repoName)
+		}
+		return resultTags, err
+	}
+	lastTag := ""
+	pageLength := 0
+	if resultTags.TagsAttributes != nil && len(*resultTags.TagsAttributes) > 0 {
+		tags := *resultTags.TagsAttributes
+		lastTag = *tags[len(tags)-1].Name
+		pageLength = len(tags)
+		p.listed += len(tags)
+	}
+	p.cursor.advance(httpResponse(resultTags.Response.Response), lastTag, pageLength >= p.size.current())
+	p.size.advance(pageLength, p.cursor)
+	return resultTags, nil
+}
+
+// ManifestPager iterates over the pages of manifests of a repository.
+type ManifestPager struct {
+	client   ManifestLister
+	repoName string
+	orderBy  string
+	cursor   pageCursor
+	size     pageSizer
+	listed   int
+}
+
+// NewManifestPager creates a pager that lists the manifests of a repository, the first call to Next returns the first page.
+func NewManifestPager(client ManifestLister, repoName string, orderBy string) *ManifestPager {
+	return &ManifestPager{client: client, repoName: repoName, orderBy: orderBy}
+}
+
+// RepoName returns the repository the pager lists.
+func (p *ManifestPager) RepoName() string {
+	return p.repoName
+}
+
+// Done returns true when there are no more pages.
+func (p *ManifestPager) Done() bool {
+	return p.cursor.done
+}
+
+// Listed returns the number of manifests returned by Next so far.
+func (p *ManifestPager) Listed() int {
+	return p.listed
+}
+
+// Next returns the next page of manifests, the ManifestsAttributes of the result are nil when there are no more manifests.
+// If an error occurs the result is still returned and the pager is done, a repository that does not exist matches
+// ErrNotFound.
+func (p *ManifestPager) Next(ctx context.Context) (*acrapi.Manifests, error) {
+	if p.cursor.done {
+		return &acrapi.Manifests{}, nil
+	}
+	resultManifests, err := p.client.GetAcrManifests(p.size.context(ctx), p.repoName, p.orderBy, p.cursor.last)
+	if err != nil || resultManifests == nil {
+		p.cursor.done = true
+		if resultManifests != nil {
+			err = ResponseError(err, &resultManifests.Response, PermissionMetadataRead, p.repoName)
+		}
+		return resultManifests, err
+	}
+	lastManifestDigest := ""
+	pageLength := 0
+	if resultManifests.ManifestsAttributes != nil && len(*resultManifests.ManifestsAttributes) > 0 {
+		manifests := *resultManifests.ManifestsAttributes
+		lastManifestDigest = *manifests[len(manifests)-1].Digest
+		pageLength = len(manifests)
+		p.listed += len(manifests)
+	}
+	p.cursor.advance(httpResponse(resultManifests.Response.Response), lastManifestDigest, pageLength >= p.size.current())
+	p.size.advance(pageLength, p.cursor)
+	return resultManifests, nil
+}
+
+// RepositoryPager iterates over the pages of repositories of a registry.
+type RepositoryPager struct {
+	client AcrCLIClientInterface
+	cursor pageCursor
+	size   pageSizer
+}
+
+// NewRepositoryPager creates a pager that lists the repositories of a registry, the first call to Next returns the first page.
+func NewRepositoryPager(client AcrCLIClientInterface) *RepositoryPager {
+	return &RepositoryPager{client: client}
+}
+
+// Done returns true when there are no more pages.
+func (p *RepositoryPager) Done() bool {
+	return p.cursor.done
+}
+
+// Next returns the next page of repositories, the Names of the result are nil when there are no more repositories.
+func (p *RepositoryPager) Next(ctx context.Context) (*acrapi.Repositories, error) {
+	if p.cursor.done {
+		return &acrapi.Repositories{}, nil
+	}
+	resultRepos, err := p.client.GetAcrRepositories(p.size.context(ctx), p.cursor.last)
+	if err != nil || resultRepos == nil {
+		p.cursor.done = true
+		if resultRepos != nil {
+			err = ResponseError(err, &resultRepos.Response, PermissionCatalog, "")
+		}
+		return resultRepos, err
+	}
+	lastRepo := ""
+	pageLength := 0
+	if resultRepos.Names != nil && len(*resultRepos.Names) > 0 {
+		names := *resultRepos.Names
+		lastRepo = names[len(names)-1]
+		pageLength = len(names)
+	}
+	p.cursor.advance(httpResponse(resultRepos.Response.Response), lastRepo, pageLength >= p.size.current())
+	if resultRepos.Names != nil {
+		p.size.advance(len(*resultRepos.Names), p.cursor)
+	}
+	return resultRepos, nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	acrapi "github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNextLast contains the tests for the parsing of the Link header.
+func TestNextLast(t *testing.T) {
+	tables := []struct {
+		header string
+		last   string
+		ok     bool
+	}{
+		{`</acr/v1/hello/_tags?last=v2&n=100&orderby=>; rel="next"`, "v2", true},
+		{`</v2/_catalog?last=a%2Fb&n=100>; rel=next, </v2/_catalog?last=z>; rel="next"`, "z", true},
+		{`</acr/v1/hello/_tags?last=v2&n=100>; rel="prev"`, "", false},
+		{`</acr/v1/hello/_tags?n=100>; rel="next"`, "", false},
+		{"", "", false},
+	}
+	assert := assert.New(t)
+	for _, table := range tables {
+		last, ok := nextLast(table.header)
+		assert.Equal(table.last, last, table.header)
+		assert.Equal(table.ok, ok, table.header)
+	}
+}
+
+// TestTagPager contains the tests for the TagPager, the ManifestPager and RepositoryPager share the same cursor.
+func TestTagPager(t *testing.T) {
+	ctx := context.Background()
+	tagNames := []string{"v1", "v2"}
+	page := func(link string, names ...string) *acrapi.RepositoryTagsType {
+		result := &acrapi.RepositoryTagsType{}
+		if len(names) > 0 {
+			tags := []acrapi.TagAttributesBase{}
+			for i := range names {
+				tags = append(tags, acrapi.TagAttributesBase{Name: &names[i]})
+			}
+			result.TagsAttributes = &tags
+		}
+		if link != "none" {
+			header := http.Header{}
+			if len(link) > 0 {
+				header.Set("Link", link)
+			}
+			result.Response = autorest.Response{Response: &http.Response{StatusCode: http.StatusOK, Header: header}}
+		}
+		return result
+	}
+	// First test, when the registry returns Link headers the last value of the link is used and the listing ends
+	// with the first page that has no link, without requesting an extra empty page.
+	t.Run("LinkHeaderTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", ctx, "hello", "", "").Return(page(`</acr/v1/hello/_tags?last=cursor&n=100>; rel="next"`, tagNames[0]), nil).Once()
+		mockClient.On("GetAcrTags", ctx, "hello", "", "cursor").Return(page("", tagNames[1]), nil).Once()
+		pager := NewTagPager(mockClient, "hello", "")
+		result, err := pager.Next(ctx)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("v1", *(*result.TagsAttributes)[0].Name)
+		assert.Equal(false, pager.Done())
+		result, err = pager.Next(ctx)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("v2", *(*result.TagsAttributes)[0].Name)
+		assert.Equal(true, pager.Done())
+		result, err = pager.Next(ctx)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal((*[]acrapi.TagAttributesBase)(nil), result.TagsAttributes)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, without an http response the last element of every page is used until an empty page is returned.
+	t.Run("LastElementTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", ctx, "hello", "timedesc", "").Return(page("none", tagNames...), nil).Once()
+		mockClient.On("GetAcrTags", ctx, "hello", "timedesc", "v2").Return(page("none"), nil).Once()
+		pager := NewTagPager(mockClient, "hello", "timedesc")
+		count := 0
+		for !pager.Done() {
+			result, err := pager.Next(ctx)
+			assert.Equal(nil, err, "Error should be nil")
+			if result.TagsAttributes != nil {
+				count += len(*result.TagsAttributes)
+			}
+		}
+		assert.Equal(2, count)
+		assert.Equal(count, pager.Listed())
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, when the registry does not return Link headers the last element of every full page is used until a
+	// page that is not full is returned.
+	t.Run("NoLinkHeaderTest", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal(nil, SetPageSize(1), "Error should be nil")
+		defer SetPageSize(0)
+		pageCtx := withPageSize(ctx, 1)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", pageCtx, "hello", "", "").Return(page("", tagNames[0]), nil).Once()
+		mockClient.On("GetAcrTags", pageCtx, "hello", "", "v1").Return(page("", tagNames[1]), nil).Once()
+		mockClient.On("GetAcrTags", pageCtx, "hello", "", "v2").Return(page(""), nil).Once()
+		pager := NewTagPager(mockClient, "hello", "")
+		names := []string{}
+		for !pager.Done() {
+			result, err := pager.Next(ctx)
+			assert.Equal(nil, err, "Error should be nil")
+			if result.TagsAttributes != nil {
+				for _, tag := range *result.TagsAttributes {
+					names = append(names, *tag.Name)
+				}
+			}
+		}
+		assert.Equal(tagNames, names)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, an error finishes the listing and the result is still returned.
+	t.Run("ErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		notFound := &acrapi.RepositoryTagsType{Response: autorest.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}}
+		mockClient.On("GetAcrTags", ctx, "hello", "", "").Return(notFound, errors.New("not found")).Once()
+		pager := NewTagPager(mockClient, "hello", "")
+		result, err := pager.Next(ctx)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Equal(http.StatusNotFound, result.StatusCode)
+		assert.Equal(true, pager.Done())
+		mockClient.AssertExpectations(t)
+	})
+	// Fifth test, a pager that seeks to the cursor of another pager continues the listing where the other one was.
+	t.Run("SeekTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", ctx, "hello", "", "").Return(page(`</acr/v1/hello/_tags?last=cursor&n=100>; rel="next"`, tagNames[0]), nil).Once()
+		mockClient.On("GetAcrTags", ctx, "hello", "", "cursor").Return(page("", tagNames[1]), nil).Once()
+		pager := NewTagPager(mockClient, "hello", "")
+		assert.Equal("", pager.Cursor())
+		_, err := pager.Next(ctx)
+		assert.Equal(nil, err, "Error should be nil")
+		resumed := NewTagPager(mockClient, "hello", "")
+		resumed.Seek(pager.Cursor())
+		result, err := resumed.Next(ctx)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("v2", *(*result.TagsAttributes)[0].Name)
+		mockClient.AssertExpectations(t)
+	})
+	// Sixth test, with the adaptive size the pages of a registry that does not return Link headers keep the initial
+	// size, so that a registry that caps the size of its pages is still listed until its last page.
+	t.Run("NoLinkHeaderAdaptiveTest", func(t *testing.T) {
+		assert := assert.New(t)
+		names := []string{}
+		for i := 0; i < 2*InitialPageSize+1; i++ {
+			names = append(names, fmt.Sprintf("v%03d", i))
+		}
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", ctx, "hello", "", "").Return(page("", names[:InitialPageSize]...), nil).Once()
+		mockClient.On("GetAcrTags", ctx, "hello", "", names[InitialPageSize-1]).Return(page("", names[InitialPageSize:2*InitialPageSize]...), nil).Once()
+		mockClient.On("GetAcrTags", ctx, "hello", "", names[2*InitialPageSize-1]).Return(page("", names[2*InitialPageSize:]...), nil).Once()
+		pager := NewTagPager(mockClient, "hello", "")
+		for !pager.Done() {
+			_, err := pager.Next(ctx)
+			assert.Equal(nil, err, "Error should be nil")
+		}
+		assert.Equal(len(names), pager.Listed())
+		mockClient.AssertExpectations(t)
+	})
+}
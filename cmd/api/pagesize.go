@@ -0,0 +1,88 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// The bounds of the number of elements the pagers ask for in every page (the n parameter of the list APIs). The
+// listings start with small pages, so that small repositories are listed with a single small request, and the size
+// doubles every time a page comes back full and there are more pages, so that repositories with millions of tags
+// are listed with fewer requests. The size is kept on registries that do not return Link headers, since a registry
+// that caps the size of its pages would return a page shorter than asked for and end the listing early.
+const (
+	InitialPageSize = manifestTagFetchCount
+	MaxPageSize     = 1000
+)
+
+// fixedPageSize is the size of every page set with SetPageSize, 0 makes the pagers adapt the size.
+var fixedPageSize int
+
+// SetPageSize makes the pagers ask for pages of n elements instead of adapting the size to the repository, 0 restores
+// the adaptive size.
+func SetPageSize(n int) error {
+	if n < 0 || n > MaxPageSize {
+		return fmt.Errorf("invalid page size %d, it should be between 1 and %d, or 0 to adapt it", n, MaxPageSize)
+	}
+	fixedPageSize = n
+	return nil
+}
+
+// pageSizeKey is the key of the page size in the context of a list request.
+type pageSizeKey struct{}
+
+// withPageSize returns a context that makes the clients ask for pages of n elements.
+func withPageSize(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, pageSizeKey{}, n)
+}
+
+// pageSize returns the number of elements of the page asked for in the context, or defaultSize if a client is called
+// outside of a pager.
+func pageSize(ctx context.Context, defaultSize int) int {
+	if n, ok := ctx.Value(pageSizeKey{}).(int); ok && n > 0 {
+		return n
+	}
+	return defaultSize
+}
+
+// pageSizer is the size of the pages of a pager.
+type pageSizer struct {
+	size int
+}
+
+// current returns the number of elements to ask for in the next page.
+func (s *pageSizer) current() int {
+	if fixedPageSize > 0 {
+		return fixedPageSize
+	}
+	if s.size == 0 {
+		return InitialPageSize
+	}
+	return s.size
+}
+
+// context returns the context of the request of the next page, the clients ask for InitialPageSize elements when the
+// context does not have a page size.
+func (s *pageSizer) context(ctx context.Context) context.Context {
+	if n := s.current(); n != InitialPageSize {
+		return withPageSize(ctx, n)
+	}
+	return ctx
+}
+
+// advance doubles the size after a full page that is followed by more pages, a registry that returns fewer elements
+// than asked for keeps the size, and so does a registry without Link headers because the cursor ends the listing
+// with the first short page.
+func (s *pageSizer) advance(listed int, cursor pageCursor) {
+	size := s.current()
+	if fixedPageSize > 0 || cursor.done || cursor.bySize || listed < size {
+		return
+	}
+	s.size = size * 2
+	if s.size > MaxPageSize {
+		s.size = MaxPageSize
+	}
+}
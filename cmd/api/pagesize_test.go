@@ -0,0 +1,67 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	acrapi "github.com/Azure/acr-cli/acr"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPageSize contains the tests for the size of the pages requested by the pagers.
+func TestPageSize(t *testing.T) {
+	ctx := context.Background()
+	defer SetPageSize(0)
+	tags := []acrapi.TagAttributesBase{}
+	for i := 0; i < 700; i++ {
+		name := fmt.Sprintf("v%03d", i)
+		tags = append(tags, acrapi.TagAttributesBase{Name: &name})
+	}
+	client := NewSnapshotClient(&Snapshot{Repositories: map[string]*RepositorySnapshot{"hello": {Tags: tags}}})
+	// pageLengths lists all the tags of the repository and returns the number of tags of every page.
+	pageLengths := func() []int {
+		lengths := []int{}
+		pager := NewTagPager(client, "hello", "")
+		for !pager.Done() {
+			result, err := pager.Next(ctx)
+			assert.Equal(t, nil, err, "Error should be nil")
+			if result.TagsAttributes != nil {
+				lengths = append(lengths, len(*result.TagsAttributes))
+			}
+		}
+		return lengths
+	}
+	// First test, the size of the pages doubles while they are full.
+	t.Run("AdaptiveTest", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal([]int{100, 200, 400}, pageLengths())
+	})
+	// Second test, the size never exceeds MaxPageSize.
+	t.Run("MaxTest", func(t *testing.T) {
+		assert := assert.New(t)
+		s := pageSizer{}
+		for i := 0; i < 10; i++ {
+			s.advance(s.current(), pageCursor{})
+		}
+		assert.Equal(MaxPageSize, s.current())
+		s.advance(10, pageCursor{})
+		assert.Equal(MaxPageSize, s.current())
+	})
+	// Third test, a page size set with SetPageSize is used for every page.
+	t.Run("FixedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal(nil, SetPageSize(250))
+		assert.Equal([]int{250, 250, 200}, pageLengths())
+		assert.Equal(nil, SetPageSize(0))
+	})
+	// Fourth test, the page size should not exceed MaxPageSize.
+	t.Run("InvalidTest", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.NotEqual(nil, SetPageSize(MaxPageSize+1), "Error should not be nil")
+		assert.NotEqual(nil, SetPageSize(-1), "Error should not be nil")
+	})
+}
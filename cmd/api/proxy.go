@@ -0,0 +1,106 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// proxyFunc is the type of the Proxy function of an http.Transport.
+type proxyFunc func(*http.Request) (*url.URL, error)
+
+// newProxyFunc returns the proxy of every request. Without an explicit proxy the HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY environment variables are used, an explicit proxy still skips the hosts listed in NO_PROXY. The username
+// and password, if set, replace the credentials of the proxy URL and are sent to the proxy with basic auth.
+func newProxyFunc(proxy string, username string, password string) (proxyFunc, error) {
+	var userinfo *url.Userinfo
+	if len(username) > 0 {
+		userinfo = url.UserPassword(username, password)
+	}
+	if len(proxy) == 0 {
+		if userinfo == nil {
+			return http.ProxyFromEnvironment, nil
+		}
+		return withProxyUser(http.ProxyFromEnvironment, userinfo), nil
+	}
+	if !strings.Contains(proxy, "://") {
+		// A proxy without scheme, like proxy:3128, is an http proxy as for the environment variables.
+		proxy = "http://" + proxy
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %s: %w", proxy, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy scheme %s, supported schemes are http, https and socks5", proxyURL.Scheme)
+	}
+	if len(proxyURL.Host) == 0 {
+		return nil, fmt.Errorf("invalid proxy %s, missing host", proxy)
+	}
+	if userinfo != nil {
+		proxyURL.User = userinfo
+	}
+	noProxy := os.Getenv("NO_PROXY")
+	if len(noProxy) == 0 {
+		noProxy = os.Getenv("no_proxy")
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if matchesNoProxy(req.URL.Hostname(), noProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+// withProxyUser returns the proxy of the proxy function with the credentials of userinfo. The proxy function can return
+// the same URL for every request (http.ProxyFromEnvironment caches it), so the URL is copied instead of changed in
+// place by the requests of every worker at the same time.
+func withProxyUser(proxy proxyFunc, userinfo *url.Userinfo) proxyFunc {
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := proxy(req)
+		if proxyURL == nil {
+			return proxyURL, err
+		}
+		withUser := *proxyURL
+		withUser.User = userinfo
+		return &withUser, err
+	}
+}
+
+// matchesNoProxy returns true if the host is listed in noProxy, a comma separated list of hosts, domains (that match
+// their subdomains too), IP addresses and CIDR ranges, or * for every host.
+func matchesNoProxy(host string, noProxy string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if len(entry) == 0 {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if ip != nil {
+			if _, cidr, err := net.ParseCIDR(entry); err == nil && cidr.Contains(ip) {
+				return true
+			}
+		}
+		// The port of an entry is ignored.
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		entry = strings.TrimPrefix(entry, "*")
+		if host == strings.TrimPrefix(entry, ".") || strings.HasSuffix(host, "."+strings.TrimPrefix(entry, ".")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugEnv is the environment variable that enables the debug logs of the requests, like the remaining rate limit
+// quota of the registry.
+const DebugEnv = "ACR_DEBUG"
+
+// The rate limit headers, ACR returns the remaining calls of the current second and other registries use the
+// RateLimit headers of the IETF draft (e.g. RateLimit-Remaining: 76;w=21600).
+const (
+	headerACRRemainingCalls  = "x-ms-ratelimit-remaining-calls-per-second"
+	headerRateLimitLimit     = "RateLimit-Limit"
+	headerRateLimitRemaining = "RateLimit-Remaining"
+	headerRateLimitReset     = "RateLimit-Reset"
+)
+
+// lowQuotaShare is the share of the limit below which the requests are paced, when the limit is not known the requests
+// are paced once fewer than lowQuotaCalls calls remain.
+const (
+	lowQuotaShare = 0.1
+	lowQuotaCalls = 5
+)
+
+// RateLimit is the rate limit quota the registry reported in its last response.
+type RateLimit struct {
+	// Remaining is the number of calls that can still be made in the window.
+	Remaining float64
+	// Limit is the number of calls allowed in the window, 0 if it is not known.
+	Limit float64
+	// Window is the time until the quota is reset.
+	Window time.Duration
+	// Observed is when the response was received, the zero time means that the registry did not report a quota.
+	Observed time.Time
+	// acr is set if the quota is the remaining calls per second reported by ACR, which does not report its limit.
+	acr bool
+}
+
+// WithCallsPerSecond returns the quota with the number of calls per second allowed by an ACR, e.g. from the limits of
+// its SKU, so that the requests are paced once a share of the calls remain instead of a fixed number. The quotas of
+// other registries, which report their limit, are returned unchanged, as well as every quota if calls is 0.
+func (r RateLimit) WithCallsPerSecond(calls float64) RateLimit {
+	if r.acr && calls > 0 {
+		r.Limit = calls
+	}
+	return r
+}
+
+// rateLimit is the last quota reported by the registry to any request of the process.
+var rateLimit struct {
+	mu    sync.Mutex
+	value RateLimit
+}
+
+// GetRateLimit returns the last rate limit quota reported by the registry.
+func GetRateLimit() RateLimit {
+	rateLimit.mu.Lock()
+	defer rateLimit.mu.Unlock()
+	return rateLimit.value
+}
+
+// resetRateLimit forgets the quota reported by the registry.
+func resetRateLimit() {
+	rateLimit.mu.Lock()
+	defer rateLimit.mu.Unlock()
+	rateLimit.value = RateLimit{}
+}
+
+// Pace returns how long a request should wait so that the remaining calls are spread over the rest of the window
+// instead of being throttled with a 429, it is 0 while the quota is not low or once the window is over.
+func (r RateLimit) Pace(now time.Time) time.Duration {
+	if r.Observed.IsZero() || r.Window <= 0 {
+		return 0
+	}
+	left := r.Window - now.Sub(r.Observed)
+	if left <= 0 {
+		return 0
+	}
+	low := float64(lowQuotaCalls)
+	if r.Limit > 0 {
+		low = r.Limit * lowQuotaShare
+	}
+	if r.Remaining > low {
+		return 0
+	}
+	return time.Duration(float64(left) / (r.Remaining + 1))
+}
+
+// rateLimitRecorder records the rate limit headers of every response and logs them in debug mode.
+type rateLimitRecorder struct {
+	next  http.RoundTripper
+	debug bool
+}
+
+// RoundTrip sends the request and records the quota of the response.
+func (r *rateLimitRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	if value, ok := parseRateLimit(resp.Header, time.Now()); ok {
+		rateLimit.mu.Lock()
+		rateLimit.value = value
+		rateLimit.mu.Unlock()
+		if r.debug {
+			fmt.Fprintf(os.Stderr, "DEBUG: %s %s %d, rate limit remaining %s\n", req.Method, req.URL.Path, resp.StatusCode, value)
+		}
+	}
+	return resp, err
+}
+
+// String describes the quota for the debug logs.
+func (r RateLimit) String() string {
+	description := strconv.FormatFloat(r.Remaining, 'f', -1, 64)
+	if r.Limit > 0 {
+		description += " of " + strconv.FormatFloat(r.Limit, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%s calls, resets in %s", description, r.Window)
+}
+
+// parseRateLimit reads the rate limit headers of a response, it returns false if there are none.
+func parseRateLimit(header http.Header, now time.Time) (RateLimit, bool) {
+	if value := header.Get(headerACRRemainingCalls); len(value) > 0 {
+		remaining, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return RateLimit{}, false
+		}
+		return RateLimit{Remaining: remaining, Window: time.Second, Observed: now, acr: true}, true
+	}
+	value := header.Get(headerRateLimitRemaining)
+	if len(value) == 0 {
+		return RateLimit{}, false
+	}
+	remaining, window, err := parseRateLimitValue(value)
+	if err != nil {
+		return RateLimit{}, false
+	}
+	result := RateLimit{Remaining: remaining, Window: window, Observed: now}
+	if limit, limitWindow, err := parseRateLimitValue(header.Get(headerRateLimitLimit)); err == nil {
+		result.Limit = limit
+		if result.Window == 0 {
+			result.Window = limitWindow
+		}
+	}
+	// The reset header is the number of seconds until the quota is reset, it is more precise than the window.
+	if reset, err := strconv.ParseFloat(strings.TrimSpace(header.Get(headerRateLimitReset)), 64); err == nil && reset >= 0 {
+		result.Window = time.Duration(reset * float64(time.Second))
+	}
+	return result, true
+}
+
+// parseRateLimitValue parses a value like 100;w=3600 into the number of calls and the window.
+func parseRateLimitValue(value string) (float64, time.Duration, error) {
+	parts := strings.Split(value, ";")
+	calls, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	var window time.Duration
+	for _, parameter := range parts[1:] {
+		parameter = strings.TrimSpace(parameter)
+		if strings.HasPrefix(parameter, "w=") {
+			seconds, err := strconv.ParseFloat(strings.TrimPrefix(parameter, "w="), 64)
+			if err != nil {
+				return 0, 0, err
+			}
+			window = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return calls, window, nil
+}
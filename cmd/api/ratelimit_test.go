@@ -0,0 +1,78 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRateLimit contains the tests for the rate limit headers of the registry.
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	// First test, the remaining calls per second of ACR are parsed.
+	t.Run("ACRHeaderTest", func(t *testing.T) {
+		assert := assert.New(t)
+		header := http.Header{}
+		header.Set(headerACRRemainingCalls, "166.5")
+		result, ok := parseRateLimit(header, now)
+		assert.True(ok)
+		assert.Equal(RateLimit{Remaining: 166.5, Window: time.Second, Observed: now, acr: true}, result)
+		// The limit is only known from the SKU of the registry.
+		assert.Equal(200.0, result.WithCallsPerSecond(200).Limit)
+		assert.Equal(0.0, result.WithCallsPerSecond(0).Limit)
+	})
+	// Second test, the RateLimit headers are parsed with their window and the reset overrides the window.
+	t.Run("DraftHeadersTest", func(t *testing.T) {
+		assert := assert.New(t)
+		header := http.Header{}
+		header.Set(headerRateLimitLimit, "100;w=21600")
+		header.Set(headerRateLimitRemaining, "76;w=21600")
+		result, ok := parseRateLimit(header, now)
+		assert.True(ok)
+		assert.Equal(RateLimit{Remaining: 76, Limit: 100, Window: 6 * time.Hour, Observed: now}, result)
+		assert.Equal(100.0, result.WithCallsPerSecond(200).Limit)
+		header.Set(headerRateLimitReset, "30")
+		result, _ = parseRateLimit(header, now)
+		assert.Equal(30*time.Second, result.Window)
+		_, ok = parseRateLimit(http.Header{}, now)
+		assert.False(ok)
+		header.Set(headerRateLimitRemaining, "many")
+		_, ok = parseRateLimit(header, now)
+		assert.False(ok)
+	})
+	// Third test, the requests are only paced when the quota is low and until the window is over.
+	t.Run("PaceTest", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal(time.Duration(0), RateLimit{}.Pace(now))
+		plenty := RateLimit{Remaining: 50, Limit: 100, Window: 10 * time.Second, Observed: now}
+		assert.Equal(time.Duration(0), plenty.Pace(now))
+		low := RateLimit{Remaining: 4, Limit: 100, Window: 10 * time.Second, Observed: now}
+		assert.Equal(2*time.Second, low.Pace(now))
+		assert.Equal(time.Second, low.Pace(now.Add(5*time.Second)))
+		assert.Equal(time.Duration(0), low.Pace(now.Add(10*time.Second)))
+		unknownLimit := RateLimit{Remaining: 1, Window: time.Second, Observed: now}
+		assert.Equal(500*time.Millisecond, unknownLimit.Pace(now))
+	})
+	// Fourth test, the quota of the responses is recorded by the http client.
+	t.Run("RecorderTest", func(t *testing.T) {
+		assert := assert.New(t)
+		defer resetRateLimit()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headerACRRemainingCalls, "3")
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+		client, err := newHTTPClient(DefaultTransportOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		_, err = client.Get(server.URL)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(3.0, GetRateLimit().Remaining)
+		assert.Equal(time.Second, GetRateLimit().Window)
+	})
+}
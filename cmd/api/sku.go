@@ -0,0 +1,77 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The SKUs (service tiers) of a registry.
+const (
+	SKUBasic    = "Basic"
+	SKUStandard = "Standard"
+	SKUPremium  = "Premium"
+)
+
+// SKULimits are the throughput limits of a SKU and the number of concurrent deletions of a purge that stays within
+// them.
+type SKULimits struct {
+	// ReadOpsPerMinute and WriteOpsPerMinute are the operations the registry serves per minute before it throttles the
+	// requests, deletions count as writes.
+	ReadOpsPerMinute  int
+	WriteOpsPerMinute int
+	// Concurrency is the default number of concurrent deletions, above MaxConcurrency the deletions are likely to be
+	// throttled. MaxConcurrency also bounds the automatic concurrency.
+	Concurrency    int
+	MaxConcurrency int
+}
+
+// skuLimits contains the limits of every SKU, the throughput is the one documented for ACR.
+var skuLimits = map[string]SKULimits{
+	SKUBasic:    {ReadOpsPerMinute: 1000, WriteOpsPerMinute: 100, Concurrency: 2, MaxConcurrency: 4},
+	SKUStandard: {ReadOpsPerMinute: 3000, WriteOpsPerMinute: 500, Concurrency: 6, MaxConcurrency: 12},
+	SKUPremium:  {ReadOpsPerMinute: 10000, WriteOpsPerMinute: 2000, Concurrency: 16, MaxConcurrency: 32},
+}
+
+// ParseSKU returns the SKU of a name like basic or Premium, an error is returned if the SKU is not known.
+func ParseSKU(name string) (string, error) {
+	for sku := range skuLimits {
+		if strings.EqualFold(sku, name) {
+			return sku, nil
+		}
+	}
+	return "", fmt.Errorf("unknown SKU %q, it should be one of %s, %s or %s", name, SKUBasic, SKUStandard, SKUPremium)
+}
+
+// LimitsOf returns the limits of a SKU, the second return value is false if the SKU is not known.
+func LimitsOf(sku string) (SKULimits, bool) {
+	limits, ok := skuLimits[sku]
+	return limits, ok
+}
+
+// RegistryResource is the Azure Resource Manager resource of a registry.
+type RegistryResource struct {
+	ID       string      `json:"id,omitempty"`
+	Name     string      `json:"name,omitempty"`
+	Location string      `json:"location,omitempty"`
+	SKU      RegistrySKU `json:"sku"`
+}
+
+// RegistrySKU is the SKU of a registry, the name and the tier are the same for the current SKUs, e.g. Premium.
+type RegistrySKU struct {
+	Name string `json:"name"`
+	Tier string `json:"tier,omitempty"`
+}
+
+// GetRegistry returns the resource of the registry.
+func (c *ManagementClient) GetRegistry(ctx context.Context) (*RegistryResource, error) {
+	var registry RegistryResource
+	if _, err := c.do(ctx, http.MethodGet, c.registryID, nil, &registry); err != nil {
+		return nil, fmt.Errorf("failed to get registry: %w", err)
+	}
+	return &registry, nil
+}
@@ -0,0 +1,310 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	acrapi "github.com/Azure/acr-cli/acr"
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// manifestListContentType is the media type of the manifests whose bodies are stored inside a snapshot.
+const manifestListContentType = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+// Snapshot is an offline copy of the tag and manifest metadata of a set of repositories, it is used
+// to evaluate purge policies without doing any http request to the registry.
+type Snapshot struct {
+	LoginURL     string                         `json:"loginUrl"`
+	CreatedTime  string                         `json:"createdTime"`
+	Repositories map[string]*RepositorySnapshot `json:"repositories"`
+}
+
+// RepositorySnapshot contains the metadata of a single repository in the same order the registry returned it.
+type RepositorySnapshot struct {
+	Tags      []acrapi.TagAttributesBase      `json:"tags"`
+	Manifests []acrapi.ManifestAttributesBase `json:"manifests"`
+	// ManifestLists contains the bodies of the manifest lists of the repository indexed by digest, they are
+	// needed to know which manifests are referenced by a multiarch manifest.
+	ManifestLists map[string][]byte `json:"manifestLists"`
+}
+
+// TakeSnapshot downloads the tag and manifest metadata of the specified repositories. Repositories that do not
+// exist are not included in the snapshot.
+func TakeSnapshot(ctx context.Context, acrClient AcrCLIClientInterface, loginURL string, repoNames []string) (*Snapshot, error) {
+	snapshot := &Snapshot{
+		LoginURL:     loginURL,
+		CreatedTime:  time.Now().UTC().Format(time.RFC3339Nano),
+		Repositories: map[string]*RepositorySnapshot{},
+	}
+	for _, repoName := range repoNames {
+		repoSnapshot := &RepositorySnapshot{
+			Tags:          []acrapi.TagAttributesBase{},
+			Manifests:     []acrapi.ManifestAttributesBase{},
+			ManifestLists: map[string][]byte{},
+		}
+		tagPager := NewTagPager(acrClient, repoName, "")
+		resultTags, err := tagPager.Next(ctx)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to snapshot tags of %s: %w", repoName, err)
+		}
+		for resultTags != nil && resultTags.TagsAttributes != nil {
+			repoSnapshot.Tags = append(repoSnapshot.Tags, *resultTags.TagsAttributes...)
+			resultTags, err = tagPager.Next(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to snapshot tags of %s: %w", repoName, err)
+			}
+		}
+		manifestPager := NewManifestPager(acrClient, repoName, "")
+		resultManifests, err := manifestPager.Next(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot manifests of %s: %w", repoName, err)
+		}
+		for resultManifests != nil && resultManifests.ManifestsAttributes != nil {
+			manifests := *resultManifests.ManifestsAttributes
+			for _, manifest := range manifests {
+				if manifest.MediaType != nil && *manifest.MediaType == manifestListContentType {
+					manifestBytes, err := acrClient.GetManifest(ctx, repoName, *manifest.Digest)
+					if err != nil {
+						return nil, fmt.Errorf("failed to snapshot manifest %s: %w", *manifest.Digest, err)
+					}
+					repoSnapshot.ManifestLists[*manifest.Digest] = manifestBytes
+				}
+			}
+			repoSnapshot.Manifests = append(repoSnapshot.Manifests, manifests...)
+			resultManifests, err = manifestPager.Next(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to snapshot manifests of %s: %w", repoName, err)
+			}
+		}
+		snapshot.Repositories[repoName] = repoSnapshot
+	}
+	return snapshot, nil
+}
+
+// WriteSnapshot stores a snapshot in the specified path.
+func WriteSnapshot(snapshot *Snapshot, path string) error {
+	snapshotBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, snapshotBytes, 0600)
+}
+
+// LoadSnapshot reads a snapshot previously stored with WriteSnapshot.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	snapshotBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(snapshotBytes, &snapshot); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	if snapshot.Repositories == nil {
+		snapshot.Repositories = map[string]*RepositorySnapshot{}
+	}
+	return &snapshot, nil
+}
+
+// SnapshotClient serves the metadata stored in a snapshot through the AcrCLIClientInterface, it paginates
+// the results the same way the registry does. Since a snapshot is read-only every delete operation fails.
+type SnapshotClient struct {
+	snapshot *Snapshot
+	// manifestTagFetchCount refers to how many tags or manifests are returned in a single page.
+	manifestTagFetchCount int
+}
+
+// NewSnapshotClient creates a client that reads from the specified snapshot.
+func NewSnapshotClient(snapshot *Snapshot) *SnapshotClient {
+	return &SnapshotClient{
+		snapshot:              snapshot,
+		manifestTagFetchCount: manifestTagFetchCount,
+	}
+}
+
+// notFoundResponse mimics the response the registry returns when a repository or a manifest does not exist.
+func notFoundResponse() autorest.Response {
+	return autorest.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}
+}
+
+// GetAcrRepositories returns the page of repositories stored in the snapshot that follows the last repository.
+func (c *SnapshotClient) GetAcrRepositories(ctx context.Context, last string) (*acrapi.Repositories, error) {
+	repoNames := []string{}
+	for repoName := range c.snapshot.Repositories {
+		if repoName > last {
+			repoNames = append(repoNames, repoName)
+		}
+	}
+	sort.Strings(repoNames)
+	result := &acrapi.Repositories{}
+	if len(repoNames) > 0 {
+		if n := pageSize(ctx, c.manifestTagFetchCount); len(repoNames) > n {
+			repoNames = repoNames[:n]
+		}
+		result.Names = &repoNames
+	}
+	return result, nil
+}
+
+// GetAcrTags returns the page of tags that follows the last tag.
+func (c *SnapshotClient) GetAcrTags(ctx context.Context, repoName string, orderBy string, last string) (*acrapi.RepositoryTagsType, error) {
+	repoSnapshot, ok := c.snapshot.Repositories[repoName]
+	if !ok {
+		return &acrapi.RepositoryTagsType{Response: notFoundResponse()}, fmt.Errorf("repository %s not found in snapshot", repoName)
+	}
+	start := 0
+	if len(last) > 0 {
+		for i, tag := range repoSnapshot.Tags {
+			if *tag.Name == last {
+				start = i + 1
+				break
+			}
+		}
+	}
+	result := &acrapi.RepositoryTagsType{
+		Registry:  &c.snapshot.LoginURL,
+		ImageName: &repoName,
+	}
+	// Same as the registry, an empty page is represented by a nil TagsAttributes.
+	if start < len(repoSnapshot.Tags) {
+		end := start + pageSize(ctx, c.manifestTagFetchCount)
+		if end > len(repoSnapshot.Tags) {
+			end = len(repoSnapshot.Tags)
+		}
+		page := repoSnapshot.Tags[start:end]
+		result.TagsAttributes = &page
+	}
+	return result, nil
+}
+
+// GetAcrManifests returns the page of manifests that follows the last manifest digest.
+func (c *SnapshotClient) GetAcrManifests(ctx context.Context, repoName string, orderBy string, last string) (*acrapi.Manifests, error) {
+	repoSnapshot, ok := c.snapshot.Repositories[repoName]
+	if !ok {
+		return &acrapi.Manifests{Response: notFoundResponse()}, fmt.Errorf("repository %s not found in snapshot", repoName)
+	}
+	start := 0
+	if len(last) > 0 {
+		for i, manifest := range repoSnapshot.Manifests {
+			if *manifest.Digest == last {
+				start = i + 1
+				break
+			}
+		}
+	}
+	result := &acrapi.Manifests{
+		Registry:  &c.snapshot.LoginURL,
+		ImageName: &repoName,
+	}
+	if start < len(repoSnapshot.Manifests) {
+		end := start + pageSize(ctx, c.manifestTagFetchCount)
+		if end > len(repoSnapshot.Manifests) {
+			end = len(repoSnapshot.Manifests)
+		}
+		page := repoSnapshot.Manifests[start:end]
+		result.ManifestsAttributes = &page
+	}
+	return result, nil
+}
+
+// GetManifest returns the body of a manifest list stored in the snapshot.
+func (c *SnapshotClient) GetManifest(ctx context.Context, repoName string, reference string) ([]byte, error) {
+	if repoSnapshot, ok := c.snapshot.Repositories[repoName]; ok {
+		if manifestBytes, ok := repoSnapshot.ManifestLists[reference]; ok {
+			return manifestBytes, nil
+		}
+	}
+	return nil, fmt.Errorf("manifest %s@%s not found in snapshot", repoName, reference)
+}
+
+// HeadManifest returns the digest of the manifest a tag or a digest of the snapshot points to, the digest is empty if
+// the snapshot does not contain it.
+func (c *SnapshotClient) HeadManifest(ctx context.Context, repoName string, reference string) (string, error) {
+	repoSnapshot, ok := c.snapshot.Repositories[repoName]
+	if !ok {
+		return "", nil
+	}
+	for _, tag := range repoSnapshot.Tags {
+		if tag.Name != nil && tag.Digest != nil && *tag.Name == reference {
+			return *tag.Digest, nil
+		}
+	}
+	for _, manifest := range repoSnapshot.Manifests {
+		if manifest.Digest != nil && *manifest.Digest == reference {
+			return reference, nil
+		}
+	}
+	return "", nil
+}
+
+// DeleteAcrRepository always fails because snapshots are read-only.
+func (c *SnapshotClient) DeleteAcrRepository(ctx context.Context, repoName string) (*autorest.Response, error) {
+	return nil, errors.New("unable to delete repositories of a snapshot")
+}
+
+// DeleteAcrTag always fails because snapshots are read-only.
+func (c *SnapshotClient) DeleteAcrTag(ctx context.Context, repoName string, reference string) (*autorest.Response, error) {
+	return nil, errors.New("unable to delete tags from a snapshot")
+}
+
+// DeleteAcrTags always fails because snapshots are read-only.
+func (c *SnapshotClient) DeleteAcrTags(ctx context.Context, repoName string, tags []string) (*autorest.Response, error) {
+	return nil, errors.New("unable to delete tags from a snapshot")
+}
+
+// SupportsBatchTagDelete returns false, snapshots are read-only.
+func (c *SnapshotClient) SupportsBatchTagDelete(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+// DeleteManifest always fails because snapshots are read-only.
+func (c *SnapshotClient) DeleteManifest(ctx context.Context, repoName string, reference string) (*autorest.Response, error) {
+	return nil, errors.New("unable to delete manifests from a snapshot")
+}
+
+// GetBlob always fails because snapshots only contain metadata.
+func (c *SnapshotClient) GetBlob(ctx context.Context, repoName string, digest string) ([]byte, error) {
+	return nil, fmt.Errorf("blob %s@%s not found in snapshot", repoName, digest)
+}
+
+// GetReferrers always fails because snapshots do not contain the referrers of the manifests.
+func (c *SnapshotClient) GetReferrers(ctx context.Context, repoName string, digest string) ([]byte, error) {
+	return nil, fmt.Errorf("referrers of %s@%s not found in snapshot", repoName, digest)
+}
+
+// PutManifest always fails because snapshots are read-only.
+func (c *SnapshotClient) PutManifest(ctx context.Context, repoName string, reference string, mediaType string, manifestBytes []byte) (*autorest.Response, error) {
+	return nil, errors.New("unable to push manifests to a snapshot")
+}
+
+// PutBlob always fails because snapshots are read-only.
+func (c *SnapshotClient) PutBlob(ctx context.Context, repoName string, digest string, content []byte) error {
+	return errors.New("unable to push blobs to a snapshot")
+}
+
+// GetAcrRepositoryAttributes always fails because snapshots do not contain the repository attributes.
+func (c *SnapshotClient) GetAcrRepositoryAttributes(ctx context.Context, repoName string) (*acrapi.RepositoryAttributes, error) {
+	return nil, fmt.Errorf("attributes of %s not found in snapshot", repoName)
+}
+
+// GetManifestMetadata always fails because snapshots do not contain the metadata of the manifests.
+func (c *SnapshotClient) GetManifestMetadata(ctx context.Context, repoName string, reference string, metadata string) (interface{}, error) {
+	return nil, fmt.Errorf("metadata %s of %s@%s not found in snapshot", metadata, repoName, reference)
+}
+
+// UpdateAcrRepositoryAttributes always fails because snapshots are read-only.
+func (c *SnapshotClient) UpdateAcrRepositoryAttributes(ctx context.Context, repoName string, value *acrapi.ChangeableAttributes) (*autorest.Response, error) {
+	return nil, errors.New("unable to update repositories of a snapshot")
+}
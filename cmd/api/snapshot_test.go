@@ -0,0 +1,117 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	acrapi "github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeSnapshot(t *testing.T) {
+	ctx := context.Background()
+	tagName := "latest"
+	digest := "sha:abc"
+	listDigest := "sha:356"
+	v2MediaType := "application/vnd.docker.distribution.manifest.v2+json"
+	listMediaType := manifestListContentType
+	tags := &acrapi.RepositoryTagsType{TagsAttributes: &[]acrapi.TagAttributesBase{{Name: &tagName, Digest: &digest}}}
+	manifests := &acrapi.Manifests{ManifestsAttributes: &[]acrapi.ManifestAttributesBase{
+		{Digest: &digest, MediaType: &v2MediaType},
+		{Digest: &listDigest, MediaType: &listMediaType},
+	}}
+	// First test, tags, manifests and manifest list bodies should be stored and missing repositories skipped.
+	t.Run("SnapshotTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", ctx, "bar", "", "").Return(tags, nil).Once()
+		mockClient.On("GetAcrTags", ctx, "bar", "", "latest").Return(&acrapi.RepositoryTagsType{}, nil).Once()
+		mockClient.On("GetAcrManifests", ctx, "bar", "", "").Return(manifests, nil).Once()
+		mockClient.On("GetManifest", ctx, "bar", listDigest).Return([]byte("{}"), nil).Once()
+		mockClient.On("GetAcrManifests", ctx, "bar", "", listDigest).Return(&acrapi.Manifests{}, nil).Once()
+		notFound := &acrapi.RepositoryTagsType{Response: autorest.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}}
+		mockClient.On("GetAcrTags", ctx, "missing", "", "").Return(notFound, errors.New("not found")).Once()
+		snapshot, err := TakeSnapshot(ctx, mockClient, "foo.azurecr.io", []string{"bar", "missing"})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, len(snapshot.Repositories))
+		assert.Equal(1, len(snapshot.Repositories["bar"].Tags))
+		assert.Equal(2, len(snapshot.Repositories["bar"].Manifests))
+		assert.Equal([]byte("{}"), snapshot.Repositories["bar"].ManifestLists[listDigest])
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, errors other than a 404 should be returned.
+	t.Run("ErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", ctx, "bar", "", "").Return(nil, errors.New("unauthorized")).Once()
+		_, err := TakeSnapshot(ctx, mockClient, "foo.azurecr.io", []string{"bar"})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestSnapshotClient(t *testing.T) {
+	ctx := context.Background()
+	repoSnapshot := &RepositorySnapshot{ManifestLists: map[string][]byte{"sha:1": []byte("{}")}}
+	for i := 0; i < 150; i++ {
+		name := fmt.Sprintf("v%d", i)
+		digest := fmt.Sprintf("sha:%d", i)
+		repoSnapshot.Tags = append(repoSnapshot.Tags, acrapi.TagAttributesBase{Name: &name, Digest: &digest})
+		repoSnapshot.Manifests = append(repoSnapshot.Manifests, acrapi.ManifestAttributesBase{Digest: &digest})
+	}
+	snapshot := &Snapshot{LoginURL: "foo.azurecr.io", Repositories: map[string]*RepositorySnapshot{"bar": repoSnapshot}}
+
+	// First test, the stored metadata should be paginated the same way the registry does it.
+	t.Run("PaginationTest", func(t *testing.T) {
+		assert := assert.New(t)
+		client := NewSnapshotClient(snapshot)
+		resultTags, err := client.GetAcrTags(ctx, "bar", "", "")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(100, len(*resultTags.TagsAttributes))
+		resultTags, _ = client.GetAcrTags(ctx, "bar", "", "v99")
+		assert.Equal(50, len(*resultTags.TagsAttributes))
+		resultTags, _ = client.GetAcrTags(ctx, "bar", "", "v149")
+		assert.Nil(resultTags.TagsAttributes)
+		resultManifests, _ := client.GetAcrManifests(ctx, "bar", "", "sha:99")
+		assert.Equal(50, len(*resultManifests.ManifestsAttributes))
+	})
+	// Second test, unknown repositories should return a 404 and deletes should always fail.
+	t.Run("NotFoundAndReadOnlyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		client := NewSnapshotClient(snapshot)
+		resultTags, err := client.GetAcrTags(ctx, "missing", "", "")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Equal(http.StatusNotFound, resultTags.StatusCode)
+		_, err = client.GetManifest(ctx, "bar", "sha:2")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		_, err = client.DeleteAcrTag(ctx, "bar", "v1")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		_, err = client.DeleteManifest(ctx, "bar", "sha:1")
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+	// Third test, a written snapshot should be loaded back without changes.
+	t.Run("WriteAndLoadTest", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "snapshot")
+		assert.Equal(nil, err, "Error should be nil")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "snap.db")
+		assert.Equal(nil, WriteSnapshot(snapshot, path))
+		loaded, err := LoadSnapshot(path)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(snapshot.LoginURL, loaded.LoginURL)
+		assert.Equal(150, len(loaded.Repositories["bar"].Tags))
+		assert.Equal([]byte("{}"), loaded.Repositories["bar"].ManifestLists["sha:1"])
+	})
+}
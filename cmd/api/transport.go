@@ -0,0 +1,180 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"time"
+)
+
+// The values accepted for the TLS renegotiation setting.
+const (
+	TLSRenegotiateNever  = "never"
+	TLSRenegotiateOnce   = "once"
+	TLSRenegotiateFreely = "freely"
+)
+
+// TransportOptions contains the settings of the connection pool that is shared by all the requests to the registry.
+type TransportOptions struct {
+	// MaxIdleConns is the maximum number of idle connections kept open across all hosts.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost is the maximum number of idle connections kept open to a single host, it should be at
+	// least the number of concurrent requests, otherwise connections are closed and reopened all the time.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the total number of connections to a single host, 0 means no limit.
+	MaxConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept open.
+	IdleConnTimeout time.Duration
+	// TLSRenegotiation is never, once or freely.
+	TLSRenegotiation string
+	// CACert is the path of a PEM bundle of certificate authorities trusted in addition to the ones of the system, e.g.
+	// the private CA of an air-gapped registry.
+	CACert string
+	// InsecureSkipTLSVerify accepts any certificate, it is only meant for tests and trusted networks.
+	InsecureSkipTLSVerify bool
+	// Proxy is the URL of the proxy of all the requests, including the token exchanges. When it is empty the
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are used.
+	Proxy string
+	// ProxyUsername and ProxyPassword are sent to proxies that require basic auth.
+	ProxyUsername string
+	ProxyPassword string
+	// FaultInjection makes a share of the requests fail before they reach the registry, the format is described in
+	// FaultInjectionEnv. It is only meant for tests.
+	FaultInjection string
+	// Debug logs the rate limit quota the registry reports in every response.
+	Debug bool
+}
+
+// DefaultTransportOptions returns the settings used when none are specified.
+func DefaultTransportOptions() TransportOptions {
+	return TransportOptions{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 32,
+		MaxConnsPerHost:     0,
+		IdleConnTimeout:     90 * time.Second,
+		TLSRenegotiation:    TLSRenegotiateNever,
+	}
+}
+
+// httpClient is shared by all the AcrCLIClients so that connections are reused between requests, when the autorest
+// client has no Sender it creates a new transport for every request.
+var httpClient = mustNewHTTPClient(DefaultTransportOptions())
+
+// ConfigureTransport replaces the http client used by the AcrCLIClients created afterwards.
+func ConfigureTransport(options TransportOptions) error {
+	client, err := newHTTPClient(options)
+	if err != nil {
+		return err
+	}
+	httpClient = client
+	return nil
+}
+
+// HTTPClient returns the http client shared by the AcrCLIClients, it can be used for requests that do not go through
+// the generated client.
+func HTTPClient() *http.Client {
+	return httpClient
+}
+
+// newHTTPClient creates an http client with a transport tuned with the specified options, HTTP/2 is attempted
+// even though a custom TLS configuration is used.
+func newHTTPClient(options TransportOptions) (*http.Client, error) {
+	if options.MaxIdleConns < 0 || options.MaxIdleConnsPerHost < 0 || options.MaxConnsPerHost < 0 || options.IdleConnTimeout < 0 {
+		return nil, errors.New("the connection pool settings cannot be negative")
+	}
+	var err error
+	var renegotiation tls.RenegotiationSupport
+	switch options.TLSRenegotiation {
+	case TLSRenegotiateNever, "":
+		renegotiation = tls.RenegotiateNever
+	case TLSRenegotiateOnce:
+		renegotiation = tls.RenegotiateOnceAsClient
+	case TLSRenegotiateFreely:
+		renegotiation = tls.RenegotiateFreelyAsClient
+	default:
+		return nil, fmt.Errorf("invalid TLS renegotiation value %q, supported values are %q, %q and %q",
+			options.TLSRenegotiation, TLSRenegotiateNever, TLSRenegotiateOnce, TLSRenegotiateFreely)
+	}
+	rootCAs, err := loadCACert(options.CACert)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := newProxyFunc(options.Proxy, options.ProxyUsername, options.ProxyPassword)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          options.MaxIdleConns,
+		MaxIdleConnsPerHost:   options.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       options.MaxConnsPerHost,
+		IdleConnTimeout:       options.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig: &tls.Config{
+			MinVersion:    tls.VersionTLS12,
+			Renegotiation: renegotiation,
+			RootCAs:       rootCAs,
+			// The verification is only skipped when it is asked for.
+			InsecureSkipVerify: options.InsecureSkipTLSVerify, //nolint:gosec
+		},
+	}
+	// The requests are counted behind the fault injection so that only the ones that reach the registry are counted,
+	// the injected faults never reach it.
+	var roundTripper http.RoundTripper = &callCounter{next: transport}
+	if len(options.FaultInjection) > 0 {
+		roundTripper, err = parseFaultInjection(options.FaultInjection, roundTripper)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// The quota is recorded from the responses of the registry, the injected faults do not report one.
+	roundTripper = &rateLimitRecorder{next: roundTripper, debug: options.Debug}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Jar: jar, Transport: roundTripper, CheckRedirect: followRedirect}, nil
+}
+
+// loadCACert returns the certificate authorities of the system together with the ones of the PEM bundle, nil (the
+// system ones) if no bundle is specified.
+func loadCACert(path string) (*x509.CertPool, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CA certificates: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificate found in %s", path)
+	}
+	return pool, nil
+}
+
+// mustNewHTTPClient is used to create the default client, the default options are always valid.
+func mustNewHTTPClient(options TransportOptions) *http.Client {
+	client, err := newHTTPClient(options)
+	if err != nil {
+		panic(err)
+	}
+	return client
+}
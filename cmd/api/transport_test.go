@@ -0,0 +1,114 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package api
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNewHTTPClient contains the tests for the creation of the tuned http client.
+func TestNewHTTPClient(t *testing.T) {
+	// First test, the options should be applied to the transport.
+	t.Run("OptionsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		client, err := newHTTPClient(TransportOptions{
+			MaxIdleConns:        10,
+			MaxIdleConnsPerHost: 5,
+			MaxConnsPerHost:     8,
+			IdleConnTimeout:     time.Minute,
+			TLSRenegotiation:    TLSRenegotiateOnce,
+		})
+		assert.Equal(nil, err, "Error should be nil")
+		transport := baseTransport(client.Transport)
+		assert.Equal(10, transport.MaxIdleConns)
+		assert.Equal(5, transport.MaxIdleConnsPerHost)
+		assert.Equal(8, transport.MaxConnsPerHost)
+		assert.Equal(time.Minute, transport.IdleConnTimeout)
+		assert.Equal(tls.RenegotiateOnceAsClient, transport.TLSClientConfig.Renegotiation)
+		assert.Equal(true, transport.ForceAttemptHTTP2)
+	})
+	// Second test, invalid options should return an error.
+	t.Run("InvalidOptionsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		options := DefaultTransportOptions()
+		options.TLSRenegotiation = "always"
+		_, err := newHTTPClient(options)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		options = DefaultTransportOptions()
+		options.MaxConnsPerHost = -1
+		assert.NotEqual(nil, ConfigureTransport(options), "Error should not be nil")
+	})
+	// Third test, the clients created after configuring the transport should share the new http client.
+	t.Run("SharedClientTest", func(t *testing.T) {
+		assert := assert.New(t)
+		defer ConfigureTransport(DefaultTransportOptions())
+		options := DefaultTransportOptions()
+		options.MaxIdleConnsPerHost = 64
+		assert.Equal(nil, ConfigureTransport(options), "Error should be nil")
+		first := newAcrCLIClient("foo.azurecr.io")
+		second := newAcrCLIClient("bar.azurecr.io")
+		assert.Equal(httpClient, first.AutorestClient.Sender)
+		assert.Equal(first.AutorestClient.Sender, second.AutorestClient.Sender)
+		assert.Equal(64, baseTransport(httpClient.Transport).MaxIdleConnsPerHost)
+	})
+	// Fourth test, a registry with a private CA is trusted with the CA bundle or without verification.
+	t.Run("CACertTest", func(t *testing.T) {
+		assert := assert.New(t)
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		dir, err := ioutil.TempDir("", "ca")
+		assert.Equal(nil, err, "Error should be nil")
+		defer os.RemoveAll(dir)
+		caPath := filepath.Join(dir, "ca.pem")
+		caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		assert.Equal(nil, ioutil.WriteFile(caPath, caPEM, 0600), "Error should be nil")
+		for _, test := range []struct {
+			options TransportOptions
+			trusted bool
+		}{
+			{TransportOptions{}, false},
+			{TransportOptions{CACert: caPath}, true},
+			{TransportOptions{InsecureSkipTLSVerify: true}, true},
+		} {
+			client, err := newHTTPClient(test.options)
+			assert.Equal(nil, err, "Error should be nil")
+			resp, err := client.Get(server.URL)
+			assert.Equal(test.trusted, err == nil, "%+v", test.options)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}
+		_, err = newHTTPClient(TransportOptions{CACert: filepath.Join(dir, "missing.pem")})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Equal(nil, ioutil.WriteFile(caPath, []byte("not a certificate"), 0600), "Error should be nil")
+		_, err = newHTTPClient(TransportOptions{CACert: caPath})
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+}
+
+// baseTransport returns the transport wrapped by the rate limit recorder, the fault injector and the call counter.
+func baseTransport(roundTripper http.RoundTripper) *http.Transport {
+	if recorder, ok := roundTripper.(*rateLimitRecorder); ok {
+		roundTripper = recorder.next
+	}
+	if injector, ok := roundTripper.(*faultInjector); ok {
+		roundTripper = injector.next
+	}
+	if counter, ok := roundTripper.(*callCounter); ok {
+		roundTripper = counter.next
+	}
+	return roundTripper.(*http.Transport)
+}
@@ -0,0 +1,199 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package diagnose checks the network path to a registry. Registries that are only reachable through Private Link or
+// that have firewall rules reject requests with generic errors, these checks explain why a request failed and what
+// has to be changed.
+package diagnose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// privateLinkZone is part of the canonical name of registries that have a private endpoint.
+const privateLinkZone = ".privatelink."
+
+// privateNetworks contains the address ranges a private endpoint can have.
+var privateNetworks = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+
+// Resolver resolves host names, it is satisfied by *net.Resolver.
+type Resolver interface {
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// Check is the result of a single diagnostic.
+type Check struct {
+	Name    string
+	OK      bool
+	Message string
+}
+
+// String formats the check as a line of the diagnosis report.
+func (c Check) String() string {
+	status := "OK"
+	if !c.OK {
+		status = "FAIL"
+	}
+	return fmt.Sprintf("[%s] %s: %s", status, c.Name, c.Message)
+}
+
+// Diagnoser runs the network checks against a registry.
+type Diagnoser struct {
+	resolver Resolver
+	client   *http.Client
+	scheme   string
+}
+
+// New creates a Diagnoser that resolves names with the resolver and sends requests with the client.
+func New(resolver Resolver, client *http.Client) *Diagnoser {
+	return &Diagnoser{resolver: resolver, client: client, scheme: "https"}
+}
+
+// Network checks that the login server and the data endpoints resolve to addresses that can be used from this
+// machine and that the registry accepts connections from it.
+func (d *Diagnoser) Network(ctx context.Context, loginURL string, dataEndpoints []string) []Check {
+	loginCheck, resolved := d.resolve(ctx, loginURL)
+	checks := []Check{loginCheck}
+	for _, dataEndpoint := range dataEndpoints {
+		check, _ := d.resolve(ctx, dataEndpoint)
+		checks = append(checks, check)
+	}
+	// If the login server cannot be resolved there is no point in trying to connect to it.
+	if resolved {
+		checks = append(checks, d.connect(ctx, loginURL))
+	}
+	return checks
+}
+
+// Failed returns the checks that did not pass.
+func Failed(checks []Check) []Check {
+	failed := []Check{}
+	for _, check := range checks {
+		if !check.OK {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// Print writes one line per check.
+func Print(out io.Writer, checks []Check) {
+	for _, check := range checks {
+		fmt.Fprintln(out, check)
+	}
+}
+
+// resolve checks the DNS resolution of a host, a registry with a private endpoint has a canonical name in the
+// privatelink zone and only works from outside the virtual network if that name resolves to the private address.
+// The second return value is false if the host could not be resolved at all.
+func (d *Diagnoser) resolve(ctx context.Context, host string) (Check, bool) {
+	check := Check{Name: "dns " + host}
+	addresses, err := d.resolver.LookupHost(ctx, host)
+	if err != nil || len(addresses) == 0 {
+		check.Message = fmt.Sprintf("unable to resolve %s (%v), check the DNS servers of this machine", host, err)
+		return check, false
+	}
+	cname, _ := d.resolver.LookupCNAME(ctx, host)
+	privateLink := strings.Contains(cname, privateLinkZone)
+	private := allPrivate(addresses)
+	switch {
+	case privateLink && !private:
+		check.Message = fmt.Sprintf("%s has a private endpoint (%s) but resolves to the public address %s, the registry will reject "+
+			"requests that do not come through the private endpoint. Link the privatelink.azurecr.io private DNS zone to the "+
+			"network of this machine or point its DNS to a resolver that can see the zone", host, strings.TrimSuffix(cname, "."), addresses[0])
+	case private:
+		check.OK = true
+		check.Message = fmt.Sprintf("resolves to the private endpoint address %s", addresses[0])
+	default:
+		check.OK = true
+		check.Message = fmt.Sprintf("resolves to the public address %s", addresses[0])
+	}
+	return check, true
+}
+
+// connect sends an anonymous request to the registry, a registry that accepts connections answers with 401
+// Unauthorized while the firewall answers with 403 Forbidden.
+func (d *Diagnoser) connect(ctx context.Context, loginURL string) Check {
+	check := Check{Name: "connect " + loginURL}
+	req, err := http.NewRequest(http.MethodGet, d.scheme+"://"+loginURL+"/v2/", nil)
+	if err != nil {
+		check.Message = err.Error()
+		return check
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		check.Message = fmt.Sprintf("unable to connect (%v), a firewall, proxy or network security group might be blocking "+
+			"outbound connections to port 443", err)
+		return check
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusUnauthorized:
+		check.OK = true
+		check.Message = "the registry accepts connections from this machine"
+	case http.StatusForbidden:
+		check.Message = fmt.Sprintf("the registry firewall denied the request (%s), add the public address of this machine to the "+
+			"network rules of the registry or connect through its private endpoint", errorMessage(resp.Body))
+	default:
+		check.Message = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+	return check
+}
+
+// errorMessage returns the message of the first error of a registry error response.
+func errorMessage(body io.Reader) string {
+	content, err := ioutil.ReadAll(io.LimitReader(body, 64*1024))
+	if err != nil {
+		return err.Error()
+	}
+	var registryErrors struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(content, &registryErrors); err != nil || len(registryErrors.Errors) == 0 {
+		return strings.TrimSpace(string(content))
+	}
+	return registryErrors.Errors[0].Message
+}
+
+// allPrivate returns true if every address is in a private range.
+func allPrivate(addresses []string) bool {
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return false
+		}
+		isPrivate := false
+		for _, network := range privateNetworks {
+			if network.Contains(ip) {
+				isPrivate = true
+			}
+		}
+		if !isPrivate {
+			return false
+		}
+	}
+	return true
+}
+
+// mustParseCIDRs is used to create the list of private networks, the ranges are always valid.
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
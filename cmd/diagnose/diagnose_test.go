@@ -0,0 +1,88 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package diagnose
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeResolver returns fixed answers for every host.
+type fakeResolver struct {
+	cnames    map[string]string
+	addresses map[string][]string
+}
+
+func (r fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return r.cnames[host], nil
+}
+
+func (r fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addresses, ok := r.addresses[host]; ok {
+		return addresses, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+// TestNetwork contains the tests for the network diagnosis.
+func TestNetwork(t *testing.T) {
+	ctx := context.Background()
+	// First test, the private link name resolves to a public address and the firewall rejects the request.
+	t.Run("PrivateLinkOutsideNetworkTest", func(t *testing.T) {
+		assert := assert.New(t)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":[{"code":"DENIED","message":"client with IP '1.2.3.4' is not allowed access"}]}`))
+		}))
+		defer server.Close()
+		loginURL := strings.TrimPrefix(server.URL, "http://")
+		resolver := fakeResolver{
+			cnames:    map[string]string{loginURL: "foo.privatelink.azurecr.io."},
+			addresses: map[string][]string{loginURL: {"20.1.2.3"}},
+		}
+		d := New(resolver, server.Client())
+		d.scheme = "http"
+		checks := d.Network(ctx, loginURL, nil)
+		assert.Equal(2, len(checks))
+		assert.Equal(2, len(Failed(checks)))
+		assert.Contains(checks[0].Message, "privatelink.azurecr.io private DNS zone")
+		assert.Contains(checks[1].Message, "is not allowed access")
+	})
+	// Second test, a private endpoint address and a registry that asks for credentials pass every check.
+	t.Run("PrivateEndpointTest", func(t *testing.T) {
+		assert := assert.New(t)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+		loginURL := strings.TrimPrefix(server.URL, "http://")
+		resolver := fakeResolver{
+			cnames: map[string]string{loginURL: "foo.privatelink.azurecr.io."},
+			addresses: map[string][]string{
+				loginURL:                     {"10.0.0.4"},
+				"foo.westus.data.azurecr.io": {"10.0.0.5"},
+			},
+		}
+		d := New(resolver, server.Client())
+		d.scheme = "http"
+		checks := d.Network(ctx, loginURL, []string{"foo.westus.data.azurecr.io"})
+		assert.Equal(3, len(checks))
+		assert.Equal(0, len(Failed(checks)))
+	})
+	// Third test, a name that cannot be resolved fails and no connection is attempted.
+	t.Run("UnresolvedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		d := New(fakeResolver{}, http.DefaultClient)
+		checks := d.Network(ctx, "foo.azurecr.io", nil)
+		assert.Equal(1, len(checks))
+		assert.Equal(false, checks[0].OK)
+		assert.Equal(true, strings.HasPrefix(checks[0].String(), "[FAIL] dns foo.azurecr.io"))
+	})
+}
@@ -0,0 +1,149 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package events publishes an event for every tag and manifest a purge deletes to an Azure Event Hub or an Azure
+// Storage queue, so that other systems (e.g. caches or SBOM databases) can react to a purge while it runs.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The operations of the events.
+const (
+	OpDeleteTag      = "delete-tag"
+	OpDeleteManifest = "delete-manifest"
+)
+
+// Event is a tag or a manifest deleted from a registry, Tag is empty for a manifest and Digest is empty for a tag.
+type Event struct {
+	Op         string    `json:"op"`
+	Registry   string    `json:"registry"`
+	Repository string    `json:"repository"`
+	Tag        string    `json:"tag,omitempty"`
+	Digest     string    `json:"digest,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// Sink sends a batch of events to a destination.
+type Sink interface {
+	Send(ctx context.Context, events []Event) error
+}
+
+// maxAttempts is the number of times a batch is sent before it is dropped.
+const maxAttempts = 3
+
+// maxBatchSize is the number of events sent together at most.
+const maxBatchSize = 100
+
+// bufferSize is the number of events that can wait to be sent before Publish blocks.
+const bufferSize = 10000
+
+// retryDelay is the delay before the first retry, it doubles after every attempt. flushInterval is how long an event
+// waits at most for other events to be sent with.
+var (
+	retryDelay    = time.Second
+	flushInterval = time.Second
+)
+
+// Publisher sends the published events to a sink in the background, in batches.
+type Publisher struct {
+	sink     Sink
+	registry string
+	events   chan Event
+	done     chan struct{}
+	// sent, dropped and err are only read after done is closed.
+	sent    int
+	dropped int
+	err     error
+}
+
+// NewPublisher creates a publisher of the events of a registry and starts sending them, Close must be called to
+// send the last events.
+func NewPublisher(ctx context.Context, sink Sink, registry string) *Publisher {
+	p := &Publisher{sink: sink, registry: registry, events: make(chan Event, bufferSize), done: make(chan struct{})}
+	go p.run(ctx)
+	return p
+}
+
+// Publish queues the event of a deleted tag or manifest, it can be called concurrently.
+func (p *Publisher) Publish(op string, repoName string, tag string, digest string) {
+	p.events <- Event{Op: op, Registry: p.registry, Repository: repoName, Tag: tag, Digest: digest, Time: time.Now().UTC()}
+}
+
+// Close sends the queued events and stops the publisher, it returns the number of events sent and the first error
+// that made the publisher drop events.
+func (p *Publisher) Close() (int, error) {
+	close(p.events)
+	<-p.done
+	if p.err != nil {
+		return p.sent, fmt.Errorf("failed to send %d events: %w", p.dropped, p.err)
+	}
+	return p.sent, nil
+}
+
+// run sends the events in batches of maxBatchSize, or every flushInterval if fewer events were published.
+func (p *Publisher) run(ctx context.Context) {
+	defer close(p.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := []Event{}
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := send(ctx, p.sink, batch); err != nil {
+			if p.err == nil {
+				p.err = err
+			}
+			p.dropped += len(batch)
+		} else {
+			p.sent += len(batch)
+		}
+		batch = []Event{}
+	}
+	for {
+		select {
+		case event, ok := <-p.events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= maxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send sends a batch to the sink. Requests that fail, are throttled or get a server error are retried with an
+// exponential backoff.
+func send(ctx context.Context, sink Sink, batch []Event) error {
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		err := sink.Send(ctx, batch)
+		if err == nil || attempt == maxAttempts {
+			return err
+		}
+		if errors.As(err, &permanentError{}) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// permanentError is an error that is not retried because sending the events again would fail the same way.
+type permanentError struct {
+	error
+}
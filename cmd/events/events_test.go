@@ -0,0 +1,124 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package events
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEvents contains the tests for the sinks and the publisher of the events of a purge.
+func TestEvents(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = 0
+	ctx := context.Background()
+	// First test, the events are sent to the Event Hub of the connection string as a batch with a shared access signature.
+	t.Run("EventHubTest", func(t *testing.T) {
+		assert := assert.New(t)
+		var path, contentType, authorization string
+		var messages []struct{ Body string }
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, contentType, authorization = r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+			json.NewDecoder(r.Body).Decode(&messages)
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer server.Close()
+		sink, err := NewSink("Endpoint=" + server.URL + "/;SharedAccessKeyName=send;SharedAccessKey=c2VjcmV0;EntityPath=purges")
+		assert.Equal(nil, err, "Error should be nil")
+		publisher := NewPublisher(ctx, sink, "foo.azurecr.io")
+		publisher.Publish(OpDeleteTag, "hello", "v1", "")
+		publisher.Publish(OpDeleteManifest, "hello", "", "sha256:abc")
+		sent, err := publisher.Close()
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, sent)
+		assert.Equal("/purges/messages", path)
+		assert.Equal(eventHubContentType, contentType)
+		assert.True(strings.HasPrefix(authorization, "SharedAccessSignature sr="), authorization)
+		assert.Contains(authorization, "&skn=send")
+		assert.Equal(2, len(messages))
+		var event Event
+		assert.Equal(nil, json.Unmarshal([]byte(messages[1].Body), &event))
+		assert.Equal(Event{Op: OpDeleteManifest, Registry: "foo.azurecr.io", Repository: "hello", Digest: "sha256:abc", Time: event.Time}, event)
+	})
+	// Second test, every event is a base64 encoded message of the Storage queue and server errors are retried.
+	t.Run("QueueTest", func(t *testing.T) {
+		assert := assert.New(t)
+		var mu sync.Mutex
+		attempts := 0
+		events := []Event{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			if attempts == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			assert.Equal("/purges/messages", r.URL.Path)
+			assert.Equal("token", r.URL.Query().Get("sig"))
+			var message struct {
+				MessageText string
+			}
+			xml.NewDecoder(r.Body).Decode(&message)
+			eventBytes, _ := base64.StdEncoding.DecodeString(message.MessageText)
+			var event Event
+			json.Unmarshal(eventBytes, &event)
+			events = append(events, event)
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer server.Close()
+		sink, err := NewSink(server.URL + "/purges?sv=2018-03-28&sig=token")
+		assert.Equal(nil, err, "Error should be nil")
+		publisher := NewPublisher(ctx, sink, "foo.azurecr.io")
+		publisher.Publish(OpDeleteTag, "hello", "v1", "")
+		sent, err := publisher.Close()
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, sent)
+		assert.Equal(2, attempts)
+		assert.Equal("v1", events[0].Tag)
+		assert.Equal(OpDeleteTag, events[0].Op)
+	})
+	// Third test, client errors are not retried and the dropped events are reported by Close.
+	t.Run("PermanentErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+		sink, err := NewSink(server.URL + "/purges?sig=expired")
+		assert.Equal(nil, err, "Error should be nil")
+		publisher := NewPublisher(ctx, sink, "foo.azurecr.io")
+		publisher.Publish(OpDeleteTag, "hello", "v1", "")
+		sent, err := publisher.Close()
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Equal(0, sent)
+		assert.Equal(1, attempts)
+	})
+	// Fourth test, invalid sinks should return an error.
+	t.Run("InvalidSinkTest", func(t *testing.T) {
+		assert := assert.New(t)
+		for _, target := range []string{
+			"Endpoint=sb://foo.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=c2VjcmV0",
+			"Endpoint=;SharedAccessKeyName=send;SharedAccessKey=c2VjcmV0;EntityPath=purges",
+			"https://foo.queue.core.windows.net/purges",
+			"https://foo.queue.core.windows.net/?sig=token",
+			"ftp://foo/purges?sig=token",
+		} {
+			_, err := NewSink(target)
+			assert.NotEqual(nil, err, target)
+		}
+	})
+}
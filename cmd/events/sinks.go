@@ -0,0 +1,169 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// eventHubContentType is the content type of a batch of events sent to an Event Hub.
+	eventHubContentType = "application/vnd.microsoft.servicebus.json"
+	// eventHubTokenValidity is how long the shared access signatures created for an Event Hub are valid.
+	eventHubTokenValidity = time.Hour
+	// queueAPIVersion is the version of the Azure Storage API used to send the messages of a queue.
+	queueAPIVersion = "2018-03-28"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// NewSink returns the sink of a target, either the connection string of an Event Hub with its entity path
+// (Endpoint=sb://<namespace>.servicebus.windows.net/;SharedAccessKeyName=<name>;SharedAccessKey=<key>;EntityPath=<hub>)
+// or the URL of a Storage queue with a shared access signature that allows adding messages
+// (https://<account>.queue.core.windows.net/<queue>?<sas>).
+func NewSink(target string) (Sink, error) {
+	if strings.HasPrefix(target, "Endpoint=") {
+		return newEventHubSink(target)
+	}
+	queueURL, err := url.Parse(target)
+	if err != nil || (queueURL.Scheme != "https" && queueURL.Scheme != "http") || len(strings.Trim(queueURL.Path, "/")) == 0 {
+		return nil, errors.New("invalid event sink, expected the connection string of an Event Hub or the URL of a Storage queue")
+	}
+	if len(queueURL.Query().Get("sig")) == 0 {
+		return nil, errors.New("invalid event sink, the URL of a Storage queue must contain a shared access signature")
+	}
+	messagesURL := *queueURL
+	messagesURL.Path = strings.TrimSuffix(queueURL.Path, "/") + "/messages"
+	return &queueSink{messagesURL: messagesURL.String()}, nil
+}
+
+// eventHubSink sends the events to an Event Hub through its REST API, authenticated with a shared access key.
+type eventHubSink struct {
+	// resource is the URL of the Event Hub the shared access signatures are created for.
+	resource string
+	keyName  string
+	key      string
+}
+
+// newEventHubSink parses the connection string of an Event Hub.
+func newEventHubSink(connectionString string) (*eventHubSink, error) {
+	values := map[string]string{}
+	for _, part := range strings.Split(connectionString, ";") {
+		if keyValue := strings.SplitN(part, "=", 2); len(keyValue) == 2 {
+			values[keyValue[0]] = keyValue[1]
+		}
+	}
+	endpoint, err := url.Parse(values["Endpoint"])
+	if err != nil || len(endpoint.Host) == 0 {
+		return nil, errors.New("invalid event sink, the connection string of the Event Hub has no valid Endpoint")
+	}
+	for _, key := range []string{"SharedAccessKeyName", "SharedAccessKey", "EntityPath"} {
+		if len(values[key]) == 0 {
+			return nil, fmt.Errorf("invalid event sink, the connection string of the Event Hub has no %s", key)
+		}
+	}
+	// The sb scheme of the connection strings is reached over https.
+	scheme := endpoint.Scheme
+	if scheme == "sb" {
+		scheme = "https"
+	}
+	return &eventHubSink{
+		resource: fmt.Sprintf("%s://%s/%s", scheme, endpoint.Host, values["EntityPath"]),
+		keyName:  values["SharedAccessKeyName"],
+		key:      values["SharedAccessKey"],
+	}, nil
+}
+
+// token returns a shared access signature for the Event Hub that expires at the specified time.
+func (s *eventHubSink) token(expiry time.Time) string {
+	resource := url.QueryEscape(strings.ToLower(s.resource))
+	se := strconv.FormatInt(expiry.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(s.key))
+	mac.Write([]byte(resource + "\n" + se))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s", resource, url.QueryEscape(signature), se, url.QueryEscape(s.keyName))
+}
+
+// Send sends the events as a single batch.
+func (s *eventHubSink) Send(ctx context.Context, events []Event) error {
+	messages := []struct {
+		Body string
+	}{}
+	for _, event := range events {
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			return permanentError{err}
+		}
+		messages = append(messages, struct{ Body string }{string(eventBytes)})
+	}
+	body, err := json.Marshal(messages)
+	if err != nil {
+		return permanentError{err}
+	}
+	req, err := http.NewRequest(http.MethodPost, s.resource+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", eventHubContentType)
+	req.Header.Set("Authorization", s.token(time.Now().Add(eventHubTokenValidity)))
+	return do(ctx, req, "Event Hub")
+}
+
+// queueSink sends the events to a Storage queue, one message per event because a queue cannot receive batches.
+type queueSink struct {
+	messagesURL string
+}
+
+// Send sends every event as a message whose text is the base64 encoded event.
+func (s *queueSink) Send(ctx context.Context, events []Event) error {
+	for _, event := range events {
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			return permanentError{err}
+		}
+		body := "<QueueMessage><MessageText>" + base64.StdEncoding.EncodeToString(eventBytes) + "</MessageText></QueueMessage>"
+		req, err := http.NewRequest(http.MethodPost, s.messagesURL, strings.NewReader(body))
+		if err != nil {
+			return permanentError{err}
+		}
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("x-ms-version", queueAPIVersion)
+		if err := do(ctx, req, "Storage queue"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends a request to a sink, the errors that cannot be fixed by retrying it are permanent.
+func do(ctx context.Context, req *http.Request, sinkName string) error {
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	err = fmt.Errorf("the %s answered with status %s: %s", sinkName, resp.Status, bytes.TrimSpace(message))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return permanentError{err}
+}
@@ -0,0 +1,655 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package fakeacr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// capabilitiesHeader advertises the optional APIs of the registry and supportedVersionsHeader the versions of the ACR
+// API, like ACR does on the /v2/ endpoint.
+const (
+	capabilitiesHeader      = "X-Ms-Acr-Capabilities"
+	supportedVersionsHeader = "Api-Supported-Versions"
+)
+
+// serveHTTP authenticates the request and routes it to its handler.
+func (r *Registry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	latency := r.latency
+	r.mu.Unlock()
+	// The latency is waited without holding the lock so that the requests are slow but not serialized.
+	time.Sleep(latency)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+
+	if req.URL.Path == "/oauth2/token" && req.Method == http.MethodPost {
+		r.serveToken(w, req)
+		return
+	}
+	if r.batchDelete {
+		w.Header().Set(capabilitiesHeader, "tag-batch-delete")
+	}
+	if len(r.apiVersions) > 0 {
+		w.Header().Set(supportedVersionsHeader, strings.Join(r.apiVersions, ", "))
+	}
+	if version := req.URL.Query().Get("api-version"); len(version) > 0 && !r.supportsAPIVersion(version) {
+		writeError(w, http.StatusBadRequest, "UNSUPPORTED", "unsupported api-version "+version)
+		return
+	}
+	if !r.authorized(req) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="https://%s/oauth2/token",service="%s"`, req.Host, req.Host))
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	path := req.URL.Path
+	switch {
+	case path == "/v2/":
+		w.WriteHeader(http.StatusOK)
+	case path == "/acr/v1/_catalog" && req.Method == http.MethodGet:
+		r.serveCatalog(w, req)
+	case strings.HasPrefix(path, "/acr/v1/"):
+		r.serveACR(w, req, strings.TrimPrefix(path, "/acr/v1/"))
+	case strings.HasPrefix(path, "/v2/"):
+		r.serveV2(w, req, strings.TrimPrefix(path, "/v2/"))
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+	}
+}
+
+// supportsAPIVersion returns true if the registry accepts the version of the ACR API.
+func (r *Registry) supportsAPIVersion(version string) bool {
+	for _, supported := range r.apiVersions {
+		if supported == version {
+			return true
+		}
+	}
+	return false
+}
+
+// authorized returns true if the request has the credentials of the registry or an access token it issued.
+func (r *Registry) authorized(req *http.Request) bool {
+	if username, password, ok := req.BasicAuth(); ok {
+		return username == r.username && password == r.password
+	}
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token, err := jwt.Parse(strings.TrimPrefix(header, "Bearer "), func(*jwt.Token) (interface{}, error) {
+		return r.signingKey, nil
+	})
+	return err == nil && token.Valid
+}
+
+// serveToken exchanges the password, used as refresh token, for an access token valid for an hour.
+func (r *Registry) serveToken(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil || req.PostForm.Get("refresh_token") != r.password {
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "invalid refresh token")
+		return
+	}
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix(), "sub": r.username}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(r.signingKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "UNKNOWN", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, acr.AccessToken{AccessToken: &accessToken})
+}
+
+// serveCatalog lists the repositories.
+func (r *Registry) serveCatalog(w http.ResponseWriter, req *http.Request) {
+	names := r.repositoryNames()
+	start, end := r.page(names, req)
+	page := names[start:end]
+	r.setNextLink(w, req, page, end < len(names))
+	writeJSON(w, http.StatusOK, acr.Repositories{Names: &page})
+}
+
+// serveACR handles the requests of the ACR API, path is the part after /acr/v1/.
+func (r *Registry) serveACR(w http.ResponseWriter, req *http.Request, path string) {
+	if i := strings.Index(path, "/_tags"); i > 0 {
+		repoName, rest := path[:i], strings.TrimPrefix(path[i+len("/_tags"):], "/")
+		repo, ok := r.repositories[repoName]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository "+repoName+" not found")
+			return
+		}
+		switch {
+		case rest == "" && req.Method == http.MethodGet:
+			r.serveTags(w, req, repoName, repo)
+		case rest == "_batchDelete" && req.Method == http.MethodPost && r.batchDelete:
+			r.serveBatchDelete(w, req, repo)
+		case rest != "" && req.Method == http.MethodDelete:
+			r.serveDeleteTag(w, repo, rest)
+		default:
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		}
+		return
+	}
+	if i := strings.Index(path, "/_manifests"); i > 0 {
+		repoName := path[:i]
+		repo, ok := r.repositories[repoName]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository "+repoName+" not found")
+			return
+		}
+		reference := strings.TrimPrefix(path[i+len("/_manifests"):], "/")
+		switch {
+		case req.Method != http.MethodGet:
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		case reference == "":
+			r.serveManifests(w, req, repoName, repo)
+		default:
+			r.serveManifestAttributes(w, req, repoName, repo, reference)
+		}
+		return
+	}
+	repo, ok := r.repositories[path]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository "+path+" not found")
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, r.repositoryAttributes(path, repo))
+	case http.MethodPatch:
+		var attributes acr.ChangeableAttributes
+		if err := json.NewDecoder(req.Body).Decode(&attributes); err != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+			return
+		}
+		if attributes.DeleteEnabled != nil {
+			repo.deleteEnabled = *attributes.DeleteEnabled
+		}
+		if attributes.WriteEnabled != nil {
+			repo.writeEnabled = *attributes.WriteEnabled
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		if !repo.deleteEnabled {
+			writeError(w, http.StatusMethodNotAllowed, "DENIED", "the repository is locked")
+			return
+		}
+		manifests := []string{}
+		for digest := range repo.manifests {
+			manifests = append(manifests, digest)
+		}
+		tags := []string{}
+		for name := range repo.tags {
+			tags = append(tags, name)
+		}
+		delete(r.repositories, path)
+		writeJSON(w, http.StatusAccepted, acr.DeletedRepository{ManifestsDeleted: &manifests, TagsDeleted: &tags})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+// serveTags lists the tags of a repository, by name or by last update time.
+func (r *Registry) serveTags(w http.ResponseWriter, req *http.Request, repoName string, repo *repository) {
+	// Like the newer versions of the ACR API, the tags can be filtered by the prefix of their name.
+	prefix := req.URL.Query().Get("name")
+	tags := []*tag{}
+	for _, t := range repo.tags {
+		if strings.HasPrefix(t.name, prefix) {
+			tags = append(tags, t)
+		}
+	}
+	orderBy := req.URL.Query().Get("orderby")
+	sort.Slice(tags, func(i, j int) bool {
+		if orderBy == "timeasc" && !tags[i].lastUpdateTime.Equal(tags[j].lastUpdateTime) {
+			return tags[i].lastUpdateTime.Before(tags[j].lastUpdateTime)
+		}
+		if orderBy == "timedesc" && !tags[i].lastUpdateTime.Equal(tags[j].lastUpdateTime) {
+			return tags[i].lastUpdateTime.After(tags[j].lastUpdateTime)
+		}
+		return tags[i].name < tags[j].name
+	})
+	names := []string{}
+	for _, t := range tags {
+		names = append(names, t.name)
+	}
+	start, end := r.page(names, req)
+	attributes := []acr.TagAttributesBase{}
+	for _, t := range tags[start:end] {
+		name, digest, lastUpdateTime, deleteEnabled := t.name, t.digest, formatTime(t.lastUpdateTime), t.deleteEnabled
+		attributes = append(attributes, acr.TagAttributesBase{
+			Name:                 &name,
+			Digest:               &digest,
+			CreatedTime:          &lastUpdateTime,
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+		})
+	}
+	r.setNextLink(w, req, names[start:end], end < len(names))
+	registry := req.Host
+	writeJSON(w, http.StatusOK, acr.RepositoryTagsType{Registry: &registry, ImageName: &repoName, TagsAttributes: &attributes})
+}
+
+// serveManifests lists the manifests of a repository sorted by digest with the tags that reference them.
+func (r *Registry) serveManifests(w http.ResponseWriter, req *http.Request, repoName string, repo *repository) {
+	digests := []string{}
+	for digest := range repo.manifests {
+		digests = append(digests, digest)
+	}
+	sort.Strings(digests)
+	tagsByDigest := map[string][]string{}
+	for _, t := range repo.tags {
+		tagsByDigest[t.digest] = append(tagsByDigest[t.digest], t.name)
+	}
+	start, end := r.page(digests, req)
+	attributes := []acr.ManifestAttributesBase{}
+	for _, digest := range digests[start:end] {
+		attributes = append(attributes, manifestAttributes(repo.manifests[digest], tagsByDigest[digest]))
+	}
+	r.setNextLink(w, req, digests[start:end], end < len(digests))
+	registry := req.Host
+	writeJSON(w, http.StatusOK, acr.Manifests{Registry: &registry, ImageName: &repoName, ManifestsAttributes: &attributes})
+}
+
+// serveManifestAttributes returns the attributes of a single manifest of a repository, by digest.
+func (r *Registry) serveManifestAttributes(w http.ResponseWriter, req *http.Request, repoName string, repo *repository, digest string) {
+	m, ok := repo.manifests[digest]
+	if !ok {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest "+digest+" not found")
+		return
+	}
+	var tags []string
+	for _, t := range repo.tags {
+		if t.digest == digest {
+			tags = append(tags, t.name)
+		}
+	}
+	attribute := manifestAttributes(m, tags)
+	registry := req.Host
+	writeJSON(w, http.StatusOK, acr.ManifestAttributes{Registry: &registry, ImageName: &repoName, ManifestAttributes: &attribute})
+}
+
+// manifestAttributes returns the attributes of a manifest with its tags.
+func manifestAttributes(m *manifest, tags []string) acr.ManifestAttributesBase {
+	manifestDigest, mediaType, configMediaType, size := m.digest, m.mediaType, m.configMediaType, m.size
+	lastUpdateTime, deleteEnabled := formatTime(m.lastUpdateTime), m.deleteEnabled
+	attribute := acr.ManifestAttributesBase{
+		Digest:               &manifestDigest,
+		ImageSize:            &size,
+		CreatedTime:          &lastUpdateTime,
+		LastUpdateTime:       &lastUpdateTime,
+		MediaType:            &mediaType,
+		ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+	}
+	if len(configMediaType) > 0 {
+		attribute.ConfigMediaType = &configMediaType
+	}
+	// Like ACR the tags are omitted for the manifests without tags.
+	if len(tags) > 0 {
+		sort.Strings(tags)
+		attribute.Tags = &tags
+	}
+	return attribute
+}
+
+// serveDeleteTag deletes a tag, the manifest it references is kept.
+func (r *Registry) serveDeleteTag(w http.ResponseWriter, repo *repository, tagName string) {
+	t, ok := repo.tags[tagName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "TAG_UNKNOWN", "tag "+tagName+" not found")
+		return
+	}
+	if !t.deleteEnabled || !repo.deleteEnabled {
+		writeError(w, http.StatusMethodNotAllowed, "DENIED", "the tag is locked")
+		return
+	}
+	delete(repo.tags, tagName)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serveBatchDelete deletes all the tags of the request or none of them.
+func (r *Registry) serveBatchDelete(w http.ResponseWriter, req *http.Request, repo *repository) {
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
+		return
+	}
+	for _, tagName := range body.Tags {
+		t, ok := repo.tags[tagName]
+		if !ok {
+			writeError(w, http.StatusNotFound, "TAG_UNKNOWN", "tag "+tagName+" not found")
+			return
+		}
+		if !t.deleteEnabled || !repo.deleteEnabled {
+			writeError(w, http.StatusMethodNotAllowed, "DENIED", "the tag "+tagName+" is locked")
+			return
+		}
+	}
+	for _, tagName := range body.Tags {
+		delete(repo.tags, tagName)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serveV2 handles the requests of the distribution API, path is the part after /v2/.
+func (r *Registry) serveV2(w http.ResponseWriter, req *http.Request, path string) {
+	for _, kind := range []string{"/manifests/", "/blobs/", "/referrers/"} {
+		i := strings.LastIndex(path, kind)
+		if i <= 0 {
+			continue
+		}
+		repoName, reference := path[:i], path[i+len(kind):]
+		if kind == "/manifests/" && req.Method == http.MethodPut {
+			r.servePutManifest(w, req, repoName, reference)
+			return
+		}
+		// The blobs are shared by the repositories, so they can be read and uploaded before the repository exists.
+		if kind == "/blobs/" {
+			r.serveBlob(w, req, repoName, reference)
+			return
+		}
+		repo, ok := r.repositories[repoName]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository "+repoName+" not found")
+			return
+		}
+		switch {
+		case kind == "/manifests/" && (req.Method == http.MethodGet || req.Method == http.MethodHead):
+			// The body of the responses to HEAD requests is discarded by the server.
+			r.serveGetManifest(w, repo, reference)
+		case kind == "/manifests/" && req.Method == http.MethodDelete:
+			r.serveDeleteManifest(w, repo, reference)
+		case kind == "/referrers/" && req.Method == http.MethodGet:
+			r.serveReferrers(w, repo, reference)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		}
+		return
+	}
+	writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+}
+
+// serveBlob returns a blob or handles the requests of its upload sessions, reference is the part after /blobs/.
+func (r *Registry) serveBlob(w http.ResponseWriter, req *http.Request, repoName string, reference string) {
+	if id := strings.TrimPrefix(reference, "uploads/"); id != reference {
+		r.serveUpload(w, req, repoName, id)
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+		return
+	}
+	blob, ok := r.blobs[reference]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob "+reference+" not found")
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", reference)
+	w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(blob)
+}
+
+// serveUpload starts, mounts, resumes, continues and completes the uploads of blobs. Every response of a session
+// carries its location and the range of bytes received so far.
+func (r *Registry) serveUpload(w http.ResponseWriter, req *http.Request, repoName string, id string) {
+	if len(id) == 0 {
+		if req.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+			return
+		}
+		// A blob that is already stored is mounted, otherwise a session is started like for a plain upload.
+		if digest := req.URL.Query().Get("mount"); len(digest) > 0 {
+			if _, ok := r.blobs[digest]; ok {
+				w.Header().Set("Location", "/v2/"+repoName+"/blobs/"+digest)
+				w.Header().Set("Docker-Content-Digest", digest)
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		r.uploaded++
+		id = strconv.Itoa(r.uploaded)
+		r.uploads[id] = &upload{repoName: repoName}
+		writeUploadHeaders(w, repoName, id, 0)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	u, ok := r.uploads[id]
+	if !ok || u.repoName != repoName {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "upload "+id+" not found")
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		writeUploadHeaders(w, repoName, id, len(u.data))
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPatch:
+		// A chunk has to start where the previous one ended.
+		if contentRange := req.Header.Get("Content-Range"); len(contentRange) > 0 && !strings.HasPrefix(contentRange, fmt.Sprintf("%d-", len(u.data))) {
+			writeUploadHeaders(w, repoName, id, len(u.data))
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID", "the chunk does not start at "+strconv.Itoa(len(u.data)))
+			return
+		}
+		u.data = append(u.data, body...)
+		writeUploadHeaders(w, repoName, id, len(u.data))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		data := append(u.data, body...)
+		digest := req.URL.Query().Get("digest")
+		if Digest(data) != digest {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "the digest does not match the uploaded content")
+			return
+		}
+		r.blobs[digest] = data
+		delete(r.uploads, id)
+		w.Header().Set("Location", "/v2/"+repoName+"/blobs/"+digest)
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "method not allowed")
+	}
+}
+
+// writeUploadHeaders sets the location of an upload session and the range of the received bytes, which is 0-0 when
+// nothing was received yet.
+func writeUploadHeaders(w http.ResponseWriter, repoName string, id string, received int) {
+	end := received - 1
+	if end < 0 {
+		end = 0
+	}
+	w.Header().Set("Location", "/v2/"+repoName+"/blobs/uploads/"+id)
+	w.Header().Set("Range", fmt.Sprintf("0-%d", end))
+	w.Header().Set("Docker-Upload-UUID", id)
+}
+
+// resolve returns the manifest referenced by a tag or a digest.
+func resolve(repo *repository, reference string) (*manifest, bool) {
+	if t, ok := repo.tags[reference]; ok {
+		reference = t.digest
+	}
+	m, ok := repo.manifests[reference]
+	return m, ok
+}
+
+// serveGetManifest returns the body of a manifest.
+func (r *Registry) serveGetManifest(w http.ResponseWriter, repo *repository, reference string) {
+	m, ok := resolve(repo, reference)
+	if !ok {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest "+reference+" not found")
+		return
+	}
+	w.Header().Set("Content-Type", m.mediaType)
+	w.Header().Set("Docker-Content-Digest", m.digest)
+	w.WriteHeader(http.StatusOK)
+	w.Write(m.body)
+}
+
+// servePutManifest stores a manifest, it is tagged if the reference is not a digest.
+func (r *Registry) servePutManifest(w http.ResponseWriter, req *http.Request, repoName string, reference string) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+		return
+	}
+	if repo, ok := r.repositories[repoName]; ok && !repo.writeEnabled {
+		writeError(w, http.StatusMethodNotAllowed, "DENIED", "the repository is locked")
+		return
+	}
+	tagName := reference
+	if strings.HasPrefix(reference, "sha256:") {
+		if Digest(body) != reference {
+			writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "the digest does not match the manifest")
+			return
+		}
+		tagName = ""
+	}
+	digest := r.putManifest(repoName, tagName, req.Header.Get("Content-Type"), body, time.Now().UTC())
+	// The header tells the clients that the registry implements the referrers API.
+	if subject := r.repositories[repoName].manifests[digest].subject; len(subject) > 0 {
+		w.Header().Set("OCI-Subject", subject)
+	}
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// serveDeleteManifest deletes a manifest and the tags that reference it.
+func (r *Registry) serveDeleteManifest(w http.ResponseWriter, repo *repository, digest string) {
+	m, ok := repo.manifests[digest]
+	if !ok {
+		writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest "+digest+" not found")
+		return
+	}
+	if !m.deleteEnabled || !repo.deleteEnabled {
+		writeError(w, http.StatusMethodNotAllowed, "DENIED", "the manifest is locked")
+		return
+	}
+	delete(repo.manifests, digest)
+	for name, t := range repo.tags {
+		if t.digest == digest {
+			delete(repo.tags, name)
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serveReferrers returns an image index with the manifests whose subject is the digest.
+func (r *Registry) serveReferrers(w http.ResponseWriter, repo *repository, digest string) {
+	digests := []string{}
+	for _, m := range repo.manifests {
+		if m.subject == digest {
+			digests = append(digests, m.digest)
+		}
+	}
+	sort.Strings(digests)
+	descriptors := []string{}
+	for _, referrer := range digests {
+		m := repo.manifests[referrer]
+		// The artifact type of the manifests without one is the media type of their config.
+		artifactType := m.artifactType
+		if len(artifactType) == 0 {
+			artifactType = m.configMediaType
+		}
+		descriptors = append(descriptors, fmt.Sprintf(`{"mediaType":%q,"artifactType":%q,"size":%d,"digest":%q}`, m.mediaType, artifactType, len(m.body), m.digest))
+	}
+	w.Header().Set("Content-Type", OCIIndexMediaType)
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"schemaVersion":2,"mediaType":%q,"manifests":[%s]}`, OCIIndexMediaType, strings.Join(descriptors, ","))
+}
+
+// repositoryAttributes returns the attributes of a repository.
+func (r *Registry) repositoryAttributes(repoName string, repo *repository) acr.RepositoryAttributes {
+	createdTime := formatTime(repo.createdTime)
+	manifestCount, tagCount := int32(len(repo.manifests)), int32(len(repo.tags))
+	deleteEnabled, writeEnabled, enabled := repo.deleteEnabled, repo.writeEnabled, true
+	registry := r.LoginURL()
+	return acr.RepositoryAttributes{
+		Registry:       &registry,
+		ImageName:      &repoName,
+		CreatedTime:    &createdTime,
+		LastUpdateTime: &createdTime,
+		ManifestCount:  &manifestCount,
+		TagCount:       &tagCount,
+		ChangeableAttributes: &acr.ChangeableAttributes{
+			DeleteEnabled: &deleteEnabled,
+			WriteEnabled:  &writeEnabled,
+			ListEnabled:   &enabled,
+			ReadEnabled:   &enabled,
+		},
+	}
+}
+
+// page returns the bounds of the page of keys that starts after the last query parameter, keys are in the order of
+// the listing. The page has at most the n query parameter and the page size of the registry elements.
+func (r *Registry) page(keys []string, req *http.Request) (int, int) {
+	query := req.URL.Query()
+	size := r.pageSize
+	if n, err := strconv.Atoi(query.Get("n")); err == nil && n > 0 && n < size {
+		size = n
+	}
+	start := 0
+	if last := query.Get("last"); len(last) > 0 {
+		found := false
+		for i, key := range keys {
+			if key == last {
+				start, found = i+1, true
+				break
+			}
+		}
+		// The last element is usually gone because it was deleted after the previous page was listed, the listings
+		// in lexical order continue after it. The listings by time continue with the remaining elements.
+		if !found && sort.StringsAreSorted(keys) {
+			start = sort.Search(len(keys), func(i int) bool { return keys[i] > last })
+		}
+	}
+	end := start + size
+	if end > len(keys) {
+		end = len(keys)
+	}
+	return start, end
+}
+
+// setNextLink adds the link to the next page, like ACR it is omitted in the last page.
+func (r *Registry) setNextLink(w http.ResponseWriter, req *http.Request, page []string, more bool) {
+	if !more || len(page) == 0 {
+		return
+	}
+	query := req.URL.Query()
+	query.Set("last", page[len(page)-1])
+	next := url.URL{Path: req.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+}
+
+// formatTime formats a time like the attributes returned by ACR.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes an error in the format of the distribution API.
+func writeError(w http.ResponseWriter, statusCode int, code string, message string) {
+	writeJSON(w, statusCode, acr.Errors{Errors: &[]acr.ErrorInfo{{Code: &code, Message: &message}}})
+}
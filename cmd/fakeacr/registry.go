@@ -0,0 +1,340 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package fakeacr is an in-process registry that implements enough of the ACR (/acr/v1) and the OCI distribution
+// (/v2) APIs to test commands end-to-end without mocking every request: tags and manifests with their attributes,
+// paging, deletions, referrers and the authentication challenges.
+package fakeacr
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Media types of the manifests pushed with PushImage and PushIndex.
+const (
+	DockerManifestMediaType     = "application/vnd.docker.distribution.manifest.v2+json"
+	DockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	DockerImageConfigMediaType  = "application/vnd.docker.container.image.v1+json"
+	OCIIndexMediaType           = "application/vnd.oci.image.index.v1+json"
+)
+
+// defaultPageSize is the maximum number of elements of a page, the client can ask for less with the n parameter.
+const defaultPageSize = 100
+
+// Registry is a fake registry served over TLS, the zero value is not usable, use NewRegistry.
+type Registry struct {
+	server   *httptest.Server
+	username string
+	password string
+	// signingKey signs the access tokens the registry issues.
+	signingKey []byte
+
+	mu           sync.Mutex
+	repositories map[string]*repository
+	blobs        map[string][]byte
+	uploads      map[string]*upload
+	uploaded     int
+	pageSize     int
+	batchDelete  bool
+	apiVersions  []string
+	requests     []string
+	pushed       int
+	// latency is the time every request waits before it is served.
+	latency time.Duration
+}
+
+// repository contains the manifests by digest and the tags by name of a repository.
+type repository struct {
+	manifests     map[string]*manifest
+	tags          map[string]*tag
+	createdTime   time.Time
+	deleteEnabled bool
+	writeEnabled  bool
+}
+
+// manifest is a manifest stored in the registry.
+type manifest struct {
+	digest          string
+	mediaType       string
+	artifactType    string
+	configMediaType string
+	subject         string
+	body            []byte
+	size            int64
+	lastUpdateTime  time.Time
+	deleteEnabled   bool
+}
+
+// upload is an upload session of a blob, the bytes received so far are kept until the upload is completed.
+type upload struct {
+	repoName string
+	data     []byte
+}
+
+// tag references a manifest of its repository.
+type tag struct {
+	name           string
+	digest         string
+	lastUpdateTime time.Time
+	deleteEnabled  bool
+}
+
+// NewRegistry starts a registry that accepts the username and password with basic authentication and as refresh
+// token, Close has to be called to stop it.
+func NewRegistry(username string, password string) *Registry {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	r := &Registry{
+		username:     username,
+		password:     password,
+		signingKey:   key,
+		repositories: map[string]*repository{},
+		blobs:        map[string][]byte{},
+		uploads:      map[string]*upload{},
+		pageSize:     defaultPageSize,
+	}
+	r.server = httptest.NewTLSServer(http.HandlerFunc(r.serveHTTP))
+	return r
+}
+
+// Close stops the registry.
+func (r *Registry) Close() {
+	r.server.Close()
+}
+
+// LoginURL returns the host and port of the registry, it is used like the login server of an ACR.
+func (r *Registry) LoginURL() string {
+	return strings.TrimPrefix(r.server.URL, "https://")
+}
+
+// HTTPClient returns an http client that trusts the certificate of the registry.
+func (r *Registry) HTTPClient() *http.Client {
+	return r.server.Client()
+}
+
+// SetPageSize changes the maximum number of elements of a page so that paging can be tested with a few elements.
+func (r *Registry) SetPageSize(pageSize int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pageSize = pageSize
+}
+
+// EnableBatchDelete makes the registry advertise and implement the batch tag deletion API.
+func (r *Registry) EnableBatchDelete() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batchDelete = true
+}
+
+// SetAPIVersions makes the registry advertise and accept the versions of the ACR API, by default only the requests
+// without api-version parameter are accepted like in older registries.
+func (r *Registry) SetAPIVersions(versions ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apiVersions = versions
+}
+
+// SetLatency makes every request wait before it is served, like a slow registry. The requests wait at the same time,
+// so concurrent requests overlap.
+func (r *Registry) SetLatency(latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latency = latency
+}
+
+// Requests returns the requests the registry received as "METHOD path", in the order they were received.
+func (r *Registry) Requests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.requests...)
+}
+
+// PushManifest stores a manifest in a repository, it is tagged with tag unless tag is empty, and returns its digest.
+// The repository is created if it does not exist.
+func (r *Registry) PushManifest(repoName string, tagName string, mediaType string, body []byte, lastUpdateTime time.Time) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.putManifest(repoName, tagName, mediaType, body, lastUpdateTime)
+}
+
+// PushImage pushes a small image with a config and a layer that are unique to it, it is tagged with tag unless tag is
+// empty. It returns the digest of the manifest.
+func (r *Registry) PushImage(repoName string, tagName string, lastUpdateTime time.Time) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pushed++
+	config := []byte(fmt.Sprintf(`{"architecture":"amd64","os":"linux","id":%d}`, r.pushed))
+	layer := []byte(fmt.Sprintf("layer %d", r.pushed))
+	r.blobs[Digest(config)] = config
+	r.blobs[Digest(layer)] = layer
+	body := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"mediaType":%q,"size":%d,"digest":%q},"layers":[{"mediaType":"application/vnd.docker.image.rootfs.diff.tar.gzip","size":%d,"digest":%q}]}`,
+		DockerManifestMediaType, DockerImageConfigMediaType, len(config), Digest(config), len(layer), Digest(layer)))
+	return r.putManifest(repoName, tagName, DockerManifestMediaType, body, lastUpdateTime)
+}
+
+// PushIndex pushes a manifest list that references manifests of the repository, it is tagged with tag unless tag is
+// empty. It returns the digest of the manifest list.
+func (r *Registry) PushIndex(repoName string, tagName string, lastUpdateTime time.Time, digests ...string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	descriptors := []string{}
+	for _, digest := range digests {
+		size := 0
+		if repo, ok := r.repositories[repoName]; ok && repo.manifests[digest] != nil {
+			size = len(repo.manifests[digest].body)
+		}
+		descriptors = append(descriptors, fmt.Sprintf(`{"mediaType":%q,"size":%d,"digest":%q,"platform":{"architecture":"amd64","os":"linux"}}`,
+			DockerManifestMediaType, size, digest))
+	}
+	body := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"manifests":[%s]}`, DockerManifestListMediaType, strings.Join(descriptors, ",")))
+	return r.putManifest(repoName, tagName, DockerManifestListMediaType, body, lastUpdateTime)
+}
+
+// Tag points a tag to a manifest of the repository.
+func (r *Registry) Tag(repoName string, tagName string, digest string, lastUpdateTime time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repository(repoName)
+	repo.tags[tagName] = &tag{name: tagName, digest: digest, lastUpdateTime: lastUpdateTime, deleteEnabled: true}
+}
+
+// Lock disables the deletion of a tag, or of a manifest if reference is a digest, like az acr repository update
+// --delete-enabled false.
+func (r *Registry) Lock(repoName string, reference string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo := r.repository(repoName)
+	if m, ok := repo.manifests[reference]; ok {
+		m.deleteEnabled = false
+	}
+	if t, ok := repo.tags[reference]; ok {
+		t.deleteEnabled = false
+	}
+}
+
+// Tags returns the names of the tags of a repository, sorted.
+func (r *Registry) Tags(repoName string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := []string{}
+	if repo, ok := r.repositories[repoName]; ok {
+		for name := range repo.tags {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Manifests returns the digests of the manifests of a repository, sorted.
+func (r *Registry) Manifests(repoName string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	digests := []string{}
+	if repo, ok := r.repositories[repoName]; ok {
+		for digest := range repo.manifests {
+			digests = append(digests, digest)
+		}
+	}
+	sort.Strings(digests)
+	return digests
+}
+
+// Blob returns the content of a blob, the second return value is false if the blob does not exist. Like in the
+// storage of ACR the blobs are shared by all the repositories.
+func (r *Registry) Blob(digest string) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	blob, ok := r.blobs[digest]
+	return blob, ok
+}
+
+// Repositories returns the names of the repositories, sorted.
+func (r *Registry) Repositories() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.repositoryNames()
+}
+
+// Digest returns the sha256 digest of content.
+func Digest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+// repository returns a repository, it is created if it does not exist. The lock has to be held.
+func (r *Registry) repository(repoName string) *repository {
+	repo, ok := r.repositories[repoName]
+	if !ok {
+		repo = &repository{
+			manifests:     map[string]*manifest{},
+			tags:          map[string]*tag{},
+			createdTime:   time.Now().UTC(),
+			deleteEnabled: true,
+			writeEnabled:  true,
+		}
+		r.repositories[repoName] = repo
+	}
+	return repo
+}
+
+// repositoryNames returns the sorted names of the repositories. The lock has to be held.
+func (r *Registry) repositoryNames() []string {
+	names := []string{}
+	for name := range r.repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// putManifest stores a manifest and tags it. The lock has to be held.
+func (r *Registry) putManifest(repoName string, tagName string, mediaType string, body []byte, lastUpdateTime time.Time) string {
+	repo := r.repository(repoName)
+	digest := Digest(body)
+	var parsed struct {
+		ArtifactType string `json:"artifactType"`
+		Config       struct {
+			MediaType string `json:"mediaType"`
+			Size      int64  `json:"size"`
+		} `json:"config"`
+		Layers []struct {
+			Size int64 `json:"size"`
+		} `json:"layers"`
+		Subject *struct {
+			Digest string `json:"digest"`
+		} `json:"subject"`
+	}
+	json.Unmarshal(body, &parsed)
+	m := &manifest{
+		digest:          digest,
+		mediaType:       mediaType,
+		artifactType:    parsed.ArtifactType,
+		configMediaType: parsed.Config.MediaType,
+		body:            body,
+		size:            int64(len(body)) + parsed.Config.Size,
+		lastUpdateTime:  lastUpdateTime,
+		deleteEnabled:   true,
+	}
+	for _, layer := range parsed.Layers {
+		m.size += layer.Size
+	}
+	if parsed.Subject != nil {
+		m.subject = parsed.Subject.Digest
+	}
+	repo.manifests[digest] = m
+	if len(tagName) > 0 {
+		repo.tags[tagName] = &tag{name: tagName, digest: digest, lastUpdateTime: lastUpdateTime, deleteEnabled: true}
+	}
+	return digest
+}
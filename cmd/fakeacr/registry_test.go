@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package fakeacr
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry("user", "password")
+	defer registry.Close()
+	client := registry.HTTPClient()
+	baseURL := "https://" + registry.LoginURL()
+	for _, tag := range []string{"c", "a", "b"} {
+		registry.PushImage("hello/world", tag, time.Now())
+	}
+	// First test, the requests without credentials are challenged.
+	t.Run("ChallengeTest", func(t *testing.T) {
+		assert := assert.New(t)
+		resp, err := client.Get(baseURL + "/v2/")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(http.StatusUnauthorized, resp.StatusCode)
+		assert.True(strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Bearer realm="))
+	})
+	// Second test, the password is exchanged for an access token that authorizes the requests.
+	t.Run("TokenTest", func(t *testing.T) {
+		assert := assert.New(t)
+		resp, err := client.PostForm(baseURL+"/oauth2/token", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"password"}})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		var token struct {
+			AccessToken string `json:"access_token"`
+		}
+		assert.Equal(nil, json.NewDecoder(resp.Body).Decode(&token))
+		req, _ := http.NewRequest(http.MethodGet, baseURL+"/v2/", nil)
+		req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		resp, err = client.Do(req)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(http.StatusOK, resp.StatusCode)
+	})
+	// Third test, the tags are listed in pages linked with the Link header.
+	t.Run("PagingTest", func(t *testing.T) {
+		assert := assert.New(t)
+		registry.SetPageSize(2)
+		defer registry.SetPageSize(defaultPageSize)
+		req, _ := http.NewRequest(http.MethodGet, baseURL+"/acr/v1/hello%2Fworld/_tags", nil)
+		req.SetBasicAuth("user", "password")
+		resp, err := client.Do(req)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(`</acr/v1/hello/world/_tags?last=b>; rel="next"`, resp.Header.Get("Link"))
+		req, _ = http.NewRequest(http.MethodGet, baseURL+"/acr/v1/hello%2Fworld/_tags?last=b", nil)
+		req.SetBasicAuth("user", "password")
+		resp, err = client.Do(req)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("", resp.Header.Get("Link"))
+		var tags struct {
+			Tags []struct {
+				Name string `json:"name"`
+			} `json:"tags"`
+		}
+		assert.Equal(nil, json.NewDecoder(resp.Body).Decode(&tags))
+		assert.Equal(1, len(tags.Tags))
+		assert.Equal("c", tags.Tags[0].Name)
+	})
+	// Fourth test, the registry advertises the versions of the ACR API it supports and rejects the others.
+	t.Run("APIVersionTest", func(t *testing.T) {
+		assert := assert.New(t)
+		registry.SetAPIVersions("2021-07-01")
+		defer registry.SetAPIVersions()
+		resp, err := client.Get(baseURL + "/v2/")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("2021-07-01", resp.Header.Get("Api-Supported-Versions"))
+		for version, status := range map[string]int{"2021-07-01": http.StatusOK, "2019-08-15": http.StatusBadRequest} {
+			req, _ := http.NewRequest(http.MethodGet, baseURL+"/acr/v1/hello%2Fworld/_tags?api-version="+version, nil)
+			req.SetBasicAuth("user", "password")
+			resp, err = client.Do(req)
+			assert.Equal(nil, err, "Error should be nil")
+			assert.Equal(status, resp.StatusCode)
+		}
+	})
+	// Fifth test, the requests wait for the latency at the same time instead of one after the other.
+	t.Run("LatencyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		latency := 100 * time.Millisecond
+		registry.SetLatency(latency)
+		defer registry.SetLatency(0)
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp, err := client.Get(baseURL + "/v2/")
+				assert.Equal(nil, err, "Error should be nil")
+				resp.Body.Close()
+			}()
+		}
+		wg.Wait()
+		elapsed := time.Since(start)
+		assert.True(elapsed >= latency, "The requests should wait for the latency")
+		assert.True(elapsed < 4*latency, "The requests should not wait one after the other")
+	})
+}
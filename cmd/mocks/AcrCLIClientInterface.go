@@ -13,6 +13,29 @@ type AcrCLIClientInterface struct {
 	mock.Mock
 }
 
+// DeleteAcrRepository provides a mock function with given fields: ctx, repoName
+func (_m *AcrCLIClientInterface) DeleteAcrRepository(ctx context.Context, repoName string) (*autorest.Response, error) {
+	ret := _m.Called(ctx, repoName)
+
+	var r0 *autorest.Response
+	if rf, ok := ret.Get(0).(func(context.Context, string) *autorest.Response); ok {
+		r0 = rf(ctx, repoName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*autorest.Response)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, repoName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteAcrTag provides a mock function with given fields: ctx, repoName, reference
 func (_m *AcrCLIClientInterface) DeleteAcrTag(ctx context.Context, repoName string, reference string) (*autorest.Response, error) {
 	ret := _m.Called(ctx, repoName, reference)
@@ -36,6 +59,29 @@ func (_m *AcrCLIClientInterface) DeleteAcrTag(ctx context.Context, repoName stri
 	return r0, r1
 }
 
+// DeleteAcrTags provides a mock function with given fields: ctx, repoName, tags
+func (_m *AcrCLIClientInterface) DeleteAcrTags(ctx context.Context, repoName string, tags []string) (*autorest.Response, error) {
+	ret := _m.Called(ctx, repoName, tags)
+
+	var r0 *autorest.Response
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) *autorest.Response); ok {
+		r0 = rf(ctx, repoName, tags)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*autorest.Response)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string) error); ok {
+		r1 = rf(ctx, repoName, tags)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteManifest provides a mock function with given fields: ctx, repoName, reference
 func (_m *AcrCLIClientInterface) DeleteManifest(ctx context.Context, repoName string, reference string) (*autorest.Response, error) {
 	ret := _m.Called(ctx, repoName, reference)
@@ -82,6 +128,52 @@ func (_m *AcrCLIClientInterface) GetAcrManifests(ctx context.Context, repoName s
 	return r0, r1
 }
 
+// GetAcrRepositories provides a mock function with given fields: ctx, last
+func (_m *AcrCLIClientInterface) GetAcrRepositories(ctx context.Context, last string) (*acr.Repositories, error) {
+	ret := _m.Called(ctx, last)
+
+	var r0 *acr.Repositories
+	if rf, ok := ret.Get(0).(func(context.Context, string) *acr.Repositories); ok {
+		r0 = rf(ctx, last)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*acr.Repositories)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, last)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetAcrRepositoryAttributes provides a mock function with given fields: ctx, repoName
+func (_m *AcrCLIClientInterface) GetAcrRepositoryAttributes(ctx context.Context, repoName string) (*acr.RepositoryAttributes, error) {
+	ret := _m.Called(ctx, repoName)
+
+	var r0 *acr.RepositoryAttributes
+	if rf, ok := ret.Get(0).(func(context.Context, string) *acr.RepositoryAttributes); ok {
+		r0 = rf(ctx, repoName)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*acr.RepositoryAttributes)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, repoName)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetAcrTags provides a mock function with given fields: ctx, repoName, orderBy, last
 func (_m *AcrCLIClientInterface) GetAcrTags(ctx context.Context, repoName string, orderBy string, last string) (*acr.RepositoryTagsType, error) {
 	ret := _m.Called(ctx, repoName, orderBy, last)
@@ -105,6 +197,29 @@ func (_m *AcrCLIClientInterface) GetAcrTags(ctx context.Context, repoName string
 	return r0, r1
 }
 
+// GetBlob provides a mock function with given fields: ctx, repoName, digest
+func (_m *AcrCLIClientInterface) GetBlob(ctx context.Context, repoName string, digest string) ([]byte, error) {
+	ret := _m.Called(ctx, repoName, digest)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) []byte); ok {
+		r0 = rf(ctx, repoName, digest)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, repoName, digest)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetManifest provides a mock function with given fields: ctx, repoName, reference
 func (_m *AcrCLIClientInterface) GetManifest(ctx context.Context, repoName string, reference string) ([]byte, error) {
 	ret := _m.Called(ctx, repoName, reference)
@@ -127,3 +242,151 @@ func (_m *AcrCLIClientInterface) GetManifest(ctx context.Context, repoName strin
 
 	return r0, r1
 }
+
+// GetManifestMetadata provides a mock function with given fields: ctx, repoName, reference, metadata
+func (_m *AcrCLIClientInterface) GetManifestMetadata(ctx context.Context, repoName string, reference string, metadata string) (interface{}, error) {
+	ret := _m.Called(ctx, repoName, reference, metadata)
+
+	var r0 interface{}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) interface{}); ok {
+		r0 = rf(ctx, repoName, reference, metadata)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(interface{})
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, repoName, reference, metadata)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetReferrers provides a mock function with given fields: ctx, repoName, digest
+func (_m *AcrCLIClientInterface) GetReferrers(ctx context.Context, repoName string, digest string) ([]byte, error) {
+	ret := _m.Called(ctx, repoName, digest)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) []byte); ok {
+		r0 = rf(ctx, repoName, digest)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, repoName, digest)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// HeadManifest provides a mock function with given fields: ctx, repoName, reference
+func (_m *AcrCLIClientInterface) HeadManifest(ctx context.Context, repoName string, reference string) (string, error) {
+	ret := _m.Called(ctx, repoName, reference)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) string); ok {
+		r0 = rf(ctx, repoName, reference)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, repoName, reference)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PutBlob provides a mock function with given fields: ctx, repoName, digest, content
+func (_m *AcrCLIClientInterface) PutBlob(ctx context.Context, repoName string, digest string, content []byte) error {
+	ret := _m.Called(ctx, repoName, digest, content)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, []byte) error); ok {
+		r0 = rf(ctx, repoName, digest, content)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PutManifest provides a mock function with given fields: ctx, repoName, reference, mediaType, manifestBytes
+func (_m *AcrCLIClientInterface) PutManifest(ctx context.Context, repoName string, reference string, mediaType string, manifestBytes []byte) (*autorest.Response, error) {
+	ret := _m.Called(ctx, repoName, reference, mediaType, manifestBytes)
+
+	var r0 *autorest.Response
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, []byte) *autorest.Response); ok {
+		r0 = rf(ctx, repoName, reference, mediaType, manifestBytes)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*autorest.Response)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, []byte) error); ok {
+		r1 = rf(ctx, repoName, reference, mediaType, manifestBytes)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SupportsBatchTagDelete provides a mock function with given fields: ctx
+func (_m *AcrCLIClientInterface) SupportsBatchTagDelete(ctx context.Context) (bool, error) {
+	ret := _m.Called(ctx)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context) bool); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateAcrRepositoryAttributes provides a mock function with given fields: ctx, repoName, value
+func (_m *AcrCLIClientInterface) UpdateAcrRepositoryAttributes(ctx context.Context, repoName string, value *acr.ChangeableAttributes) (*autorest.Response, error) {
+	ret := _m.Called(ctx, repoName, value)
+
+	var r0 *autorest.Response
+	if rf, ok := ret.Get(0).(func(context.Context, string, *acr.ChangeableAttributes) *autorest.Response); ok {
+		r0 = rf(ctx, repoName, value)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*autorest.Response)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, *acr.ChangeableAttributes) error); ok {
+		r1 = rf(ctx, repoName, value)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,177 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package notify sends the result of a purge to a webhook so that a team can follow scheduled purges in Teams, Slack or
+// its own tooling.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Statuses of a purge.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// maxAttempts is the number of times a notification is sent before giving up.
+const maxAttempts = 3
+
+// retryDelay is the delay before the first retry, it doubles after every attempt.
+var retryDelay = time.Second
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// RepositoryResult is the result of the purge of a single repository.
+type RepositoryResult struct {
+	Name             string `json:"name"`
+	DeletedTags      int    `json:"deletedTags"`
+	DeletedManifests int    `json:"deletedManifests"`
+	TrimmedTags      int    `json:"trimmedTags,omitempty"`
+	// MarkedTags is the number of tags scheduled for deletion instead of being deleted.
+	MarkedTags int `json:"markedTags,omitempty"`
+	// Deleted is set if the repository was deleted because it was empty.
+	Deleted bool   `json:"deleted,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Report is the body of the notification. Text is a human readable summary, Teams and Slack webhooks display it and
+// ignore the rest of the fields.
+type Report struct {
+	Text             string             `json:"text"`
+	Registry         string             `json:"registry"`
+	Status           string             `json:"status"`
+	Error            string             `json:"error,omitempty"`
+	DryRun           bool               `json:"dryRun"`
+	DeletedTags      int                `json:"deletedTags"`
+	DeletedManifests int                `json:"deletedManifests"`
+	TrimmedTags      int                `json:"trimmedTags,omitempty"`
+	MarkedTags       int                `json:"markedTags,omitempty"`
+	DeletedRepos     int                `json:"deletedRepositories,omitempty"`
+	StartTime        time.Time          `json:"startTime"`
+	EndTime          time.Time          `json:"endTime"`
+	Repositories     []RepositoryResult `json:"repositories"`
+}
+
+// NewReport creates the report of a purge that starts now.
+func NewReport(registry string, dryRun bool) *Report {
+	return &Report{Registry: registry, DryRun: dryRun, StartTime: time.Now().UTC(), Repositories: []RepositoryResult{}}
+}
+
+// AddRepository adds the result of a repository to the report and to its totals.
+func (r *Report) AddRepository(result RepositoryResult) {
+	r.Repositories = append(r.Repositories, result)
+	r.DeletedTags += result.DeletedTags
+	r.DeletedManifests += result.DeletedManifests
+	r.TrimmedTags += result.TrimmedTags
+	r.MarkedTags += result.MarkedTags
+	if result.Deleted {
+		r.DeletedRepos++
+	}
+}
+
+// Changed returns the number of tags, manifests and repositories deleted, trimmed or scheduled for deletion so far.
+func (r *Report) Changed() int {
+	return r.DeletedTags + r.DeletedManifests + r.TrimmedTags + r.MarkedTags + r.DeletedRepos
+}
+
+// Fail adds a repository whose purge failed and returns the error, the result keeps what was deleted before the
+// failure.
+func (r *Report) Fail(result RepositoryResult, err error) error {
+	result.Error = err.Error()
+	r.AddRepository(result)
+	return err
+}
+
+// Finish sets the status and the summary of the report, err is the error the purge returned.
+func (r *Report) Finish(err error) {
+	r.EndTime = time.Now().UTC()
+	r.Status = StatusSucceeded
+	if err != nil {
+		r.Status = StatusFailed
+		r.Error = err.Error()
+	}
+	verb := "deleted"
+	if r.DryRun {
+		verb = "would delete"
+	}
+	r.Text = fmt.Sprintf("Purge of %s %s: %s %d tags and %d manifests in %d repositories", r.Registry, r.Status, verb, r.DeletedTags, r.DeletedManifests, len(r.Repositories))
+	if r.TrimmedTags > 0 {
+		r.Text += fmt.Sprintf(", trimmed %d tags", r.TrimmedTags)
+	}
+	if r.MarkedTags > 0 {
+		r.Text += fmt.Sprintf(", scheduled %d tags for deletion", r.MarkedTags)
+	}
+	if r.DeletedRepos > 0 {
+		r.Text += fmt.Sprintf(", %s %d empty repositories", verb, r.DeletedRepos)
+	}
+	if err != nil {
+		r.Text += fmt.Sprintf(" (error: %s)", r.Error)
+	}
+}
+
+// Send posts the report as JSON to the webhook. Requests that fail, are throttled or get a server error are retried
+// with an exponential backoff.
+func Send(ctx context.Context, webhook string, report *Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		err = post(ctx, webhook, body)
+		if err == nil || attempt == maxAttempts {
+			break
+		}
+		if errors.As(err, &permanentError{}) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send the notification: %w", err)
+	}
+	return nil
+}
+
+// permanentError is an error that is not retried because sending the notification again would fail the same way.
+type permanentError struct {
+	error
+}
+
+// post sends the body once.
+func post(ctx context.Context, webhook string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	err = fmt.Errorf("the webhook answered with status %s: %s", resp.Status, bytes.TrimSpace(message))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return permanentError{err}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNotify contains the tests for the report of a purge and its delivery to a webhook.
+func TestNotify(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = 0
+	ctx := context.Background()
+	// First test, the totals include every repository, also what was deleted before a failure, and the summary tells
+	// the error.
+	t.Run("ReportTest", func(t *testing.T) {
+		assert := assert.New(t)
+		report := NewReport("foo.azurecr.io", false)
+		report.AddRepository(RepositoryResult{Name: "hello", DeletedTags: 3, DeletedManifests: 1})
+		err := report.Fail(RepositoryResult{Name: "world", DeletedTags: 2}, errors.New("failed to purge tags"))
+		report.Finish(err)
+		assert.Equal(6, report.Changed())
+		assert.Equal(StatusFailed, report.Status)
+		assert.Equal("failed to purge tags", report.Repositories[1].Error)
+		assert.Equal("Purge of foo.azurecr.io failed: deleted 5 tags and 1 manifests in 2 repositories (error: failed to purge tags)", report.Text)
+	})
+	// Second test, server errors are retried until the webhook accepts the report.
+	t.Run("RetryTest", func(t *testing.T) {
+		assert := assert.New(t)
+		attempts := 0
+		var received Report
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&received)
+		}))
+		defer server.Close()
+		report := NewReport("foo.azurecr.io", true)
+		report.AddRepository(RepositoryResult{Name: "hello", DeletedTags: 2})
+		report.Finish(nil)
+		assert.Equal(nil, Send(ctx, server.URL, report), "Error should be nil")
+		assert.Equal(3, attempts)
+		assert.Equal(StatusSucceeded, received.Status)
+		assert.Equal("Purge of foo.azurecr.io succeeded: would delete 2 tags and 0 manifests in 1 repositories", received.Text)
+	})
+	// Third test, client errors are not retried.
+	t.Run("PermanentErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+		err := Send(ctx, server.URL, NewReport("foo.azurecr.io", false))
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Equal(1, attempts)
+	})
+}
@@ -0,0 +1,178 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// SetAliasDetection makes the run look for the other tags (the aliases) of the digests of the tags it deletes.
+// Deleting only some of the aliases of a digest leaves its manifest reachable through the others, such tags are
+// deleted with a warning unless keepPartial is set, in which case they are kept with a warning.
+func (o *Options) SetAliasDetection(enabled bool, keepPartial bool) {
+	o.aliasDetection = enabled
+	o.keepPartialUntag = keepPartial
+}
+
+// tagAliases finds the co-tags of the tags to delete of a repository. The tags of a digest are first read from the
+// attributes of its manifest when the client can return them, all the tags of the repository are only listed once a
+// digest has more than one tag, to know which of them are selected too.
+type tagAliases struct {
+	acrClient     api.TagLister
+	repoName      string
+	filter        *regexp.Regexp
+	matchOn       string
+	timeToCompare time.Time
+	superseded    *supersededTags
+	keptByGroup   map[string]bool
+	opts          *Options
+	// manifestTags are the tags of the digests read from the attributes of their manifest.
+	manifestTags map[string][]string
+	// tags are the tags of every digest and selected the tags selected by the filter and the cutoff, they are nil
+	// until all the tags of the repository are listed.
+	tags     map[string][]string
+	selected map[string]bool
+}
+
+// getTagAliases returns the aliases of the tags of a repository, or nil if the alias detection is not enabled. A tag
+// is selected if it matches the filter, was last updated before the cutoff and is not kept for a reason of its own
+// (e.g. locked), the reasons that apply to a digest keep all its tags alike. Nothing is listed until a co-tag is needed.
+func (o *Options) getTagAliases(acrClient api.TagLister, repoName string, filter *regexp.Regexp, matchOn string, timeToCompare time.Time, superseded *supersededTags, keptByGroup map[string]bool) *tagAliases {
+	if !o.aliasDetection {
+		return nil
+	}
+	return &tagAliases{
+		acrClient:     acrClient,
+		repoName:      repoName,
+		filter:        filter,
+		matchOn:       matchOn,
+		timeToCompare: timeToCompare,
+		superseded:    superseded,
+		keptByGroup:   keptByGroup,
+		opts:          o,
+		manifestTags:  map[string][]string{},
+	}
+}
+
+// hasOtherTags returns false if the attributes of the manifest of the digest show that it has at most one tag, it
+// returns true if it has more or if the client cannot return the attributes of a manifest.
+func (a *tagAliases) hasOtherTags(ctx context.Context, digest string) (bool, error) {
+	getter, ok := a.acrClient.(api.ManifestAttributesGetter)
+	if !ok {
+		return true, nil
+	}
+	tags, ok := a.manifestTags[digest]
+	if !ok {
+		attributes, err := getter.GetAcrManifestAttributes(ctx, a.repoName, digest)
+		if err != nil && !api.IsNotFound(err) {
+			return false, fmt.Errorf("failed to get the tags of %s@%s: %w", a.repoName, digest, err)
+		}
+		// A manifest that is not found has no tags left.
+		if err == nil && attributes.ManifestAttributes != nil && attributes.ManifestAttributes.Tags != nil {
+			tags = *attributes.ManifestAttributes.Tags
+		}
+		a.manifestTags[digest] = tags
+	}
+	return len(tags) > 1, nil
+}
+
+// listTags lists all the tags of the repository, once, to find the tags of every digest and the selected tags.
+func (a *tagAliases) listTags(ctx context.Context) error {
+	if a.tags != nil {
+		return nil
+	}
+	tags, selected := map[string][]string{}, map[string]bool{}
+	// The aliases do not have to match the filter, so the tags are not filtered by prefix.
+	tagPager := api.NewTagPager(a.acrClient, a.repoName, "")
+	resultTags, err := tagPager.Next(ctx)
+	if err != nil {
+		if !errors.Is(err, api.ErrNotFound) {
+			return err
+		}
+		// The repository not found case is reported when the tags to delete are obtained.
+		resultTags = nil
+	}
+	for resultTags != nil && resultTags.TagsAttributes != nil {
+		for _, tag := range *resultTags.TagsAttributes {
+			tags[*tag.Digest] = append(tags[*tag.Digest], *tag.Name)
+			matches, err := a.opts.matchesFilter(tag, a.filter, a.matchOn)
+			if err != nil {
+				return err
+			}
+			if !matches || a.keptByGroup[*tag.Name] {
+				continue
+			}
+			lastUpdateTime, err := time.Parse(time.RFC3339Nano, *tag.LastUpdateTime)
+			if err != nil {
+				return err
+			}
+			if lastUpdateTime.Before(a.timeToCompare) && len(a.opts.tagKeepReason(tag, lastUpdateTime, a.superseded)) == 0 {
+				selected[*tag.Name] = true
+			}
+		}
+		resultTags, err = tagPager.Next(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	a.tags, a.selected = tags, selected
+	return nil
+}
+
+// coTags returns the tags that reference the same digest as the tag and are not selected, the manifest stays reachable
+// through them once the tag is deleted.
+func (a *tagAliases) coTags(ctx context.Context, tag acr.TagAttributesBase) ([]string, error) {
+	if a == nil {
+		return nil, nil
+	}
+	if a.tags == nil {
+		hasOtherTags, err := a.hasOtherTags(ctx, *tag.Digest)
+		if err != nil || !hasOtherTags {
+			return nil, err
+		}
+		if err := a.listTags(ctx); err != nil {
+			return nil, err
+		}
+	}
+	var coTags []string
+	for _, name := range a.tags[*tag.Digest] {
+		if name != *tag.Name && !a.selected[name] {
+			coTags = append(coTags, name)
+		}
+	}
+	return coTags, nil
+}
+
+// withoutPartialUntags warns about the tags whose manifest stays reachable through their co-tags and removes them if
+// partial untags are kept, like the pages of tags a nil slice stays nil.
+func (o *Options) withoutPartialUntags(ctx context.Context, repoName string, tags *[]acr.TagAttributesBase, aliases *tagAliases) (*[]acr.TagAttributesBase, error) {
+	if tags == nil || aliases == nil {
+		return tags, nil
+	}
+	filtered := []acr.TagAttributesBase{}
+	for _, tag := range *tags {
+		coTags, err := aliases.coTags(ctx, tag)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(coTags) == 0:
+			filtered = append(filtered, tag)
+		case o.keepPartialUntag:
+			o.warnf("keeping %s:%s, %s is also tagged %s which are not deleted\n", repoName, *tag.Name, *tag.Digest, strings.Join(coTags, ", "))
+		default:
+			o.warnf("deleting %s:%s leaves %s reachable through the tags %s\n", repoName, *tag.Name, *tag.Digest, strings.Join(coTags, ", "))
+			filtered = append(filtered, tag)
+		}
+	}
+	return &filtered, nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAliasInventory has a release also tagged latest and a release tagged twice by the filter, all older than a day.
+const testAliasInventory = `now: 2020-01-15T12:00:00Z
+repositories:
+  bar:
+  - {digest: "sha:a", lastUpdateTime: "2020-01-01T00:00:00Z", tags: [{name: v1}, {name: latest}]}
+  - {digest: "sha:b", lastUpdateTime: "2020-01-02T00:00:00Z", tags: [{name: v2}, {name: v2.0}]}
+`
+
+// TestTagAliases contains the tests for the tags whose digest has other tags that are not deleted.
+func TestTagAliases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aliases")
+	assert.Equal(t, nil, err, "Error should be nil")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "inventory.yaml")
+	assert.Equal(t, nil, ioutil.WriteFile(path, []byte(testAliasInventory), 0600))
+	inventory, err := ReadInventory(path)
+	assert.Equal(t, nil, err, "Error should be nil")
+	policy := Policy{Filters: []string{`bar:^v.*`}, Ago: "1d", Untagged: true}
+	snapshotClient := api.NewSnapshotClient(inventory.Snapshot())
+	// tagNames returns the names of the tags.
+	tagNames := func(tags []acr.TagAttributesBase) []string {
+		names := []string{}
+		for _, tag := range tags {
+			names = append(names, *tag.Name)
+		}
+		return names
+	}
+	// First test, with partial untags kept a tag whose digest is also tagged latest is kept, the tags that are all
+	// deleted are not aliases.
+	t.Run("KeepTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetAliasDetection(true, true)
+		plan, err := NewPlan(testCtx, snapshotClient, inventory.Clock(), "inventory", policy, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		repoPlan := plan.Repositories[0]
+		assert.ElementsMatch([]string{"v2", "v2.0"}, tagNames(repoPlan.Tags))
+		assert.Equal(1, len(repoPlan.Kept))
+		assert.Equal("v1", *repoPlan.Kept[0].Tag.Name)
+		assert.Equal(KeepReasonPartialUntag, repoPlan.Kept[0].Reason)
+		assert.Equal(map[string][]string{"v1": {"latest"}}, repoPlan.CoTags)
+		assert.Equal(1, len(repoPlan.Manifests))
+		assert.Equal("sha:b", *repoPlan.Manifests[0].Digest)
+	})
+	// Second test, by default the tag is deleted and its co-tags are reported.
+	t.Run("WarnTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetAliasDetection(true, false)
+		plan, err := NewPlan(testCtx, snapshotClient, inventory.Clock(), "inventory", policy, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		repoPlan := plan.Repositories[0]
+		assert.ElementsMatch([]string{"v1", "v2", "v2.0"}, tagNames(repoPlan.Tags))
+		assert.Equal(0, len(repoPlan.Kept))
+		assert.Equal(map[string][]string{"v1": {"latest"}}, repoPlan.CoTags)
+		assert.Equal(1, len(repoPlan.Manifests))
+	})
+	// Third test, a policy that keeps partial untags enables the alias detection of its plan only, a policy that
+	// allows them disables it and a policy cannot do both.
+	t.Run("PolicyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		keepPolicy := policy
+		keepPolicy.KeepPartialUntag = true
+		plan, err := NewPlan(testCtx, snapshotClient, inventory.Clock(), "inventory", keepPolicy, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.ElementsMatch([]string{"v2", "v2.0"}, tagNames(plan.Repositories[0].Tags))
+		assert.Equal(map[string][]string{"v1": {"latest"}}, plan.Repositories[0].CoTags)
+		assert.False(opts.aliasDetection)
+		opts.SetAliasDetection(true, false)
+		allowPolicy := policy
+		allowPolicy.AllowPartialUntag = true
+		plan, err = NewPlan(testCtx, snapshotClient, inventory.Clock(), "inventory", allowPolicy, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.ElementsMatch([]string{"v1", "v2", "v2.0"}, tagNames(plan.Repositories[0].Tags))
+		assert.Nil(plan.Repositories[0].CoTags)
+		keepPolicy.AllowPartialUntag = true
+		_, err = NewPlan(testCtx, snapshotClient, inventory.Clock(), "inventory", keepPolicy, opts)
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+	// Fourth test, the pages of tags to delete are filtered with a warning for every partial untag.
+	t.Run("WithoutPartialUntagsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		out := &bytes.Buffer{}
+		opts.SetWarningsOutput(out)
+		digest, v1, v2 := "sha:a", "v1", "v2"
+		aliases := &tagAliases{tags: map[string][]string{digest: {v1, v2, "latest"}}, selected: map[string]bool{v1: true, v2: true}}
+		tags := &[]acr.TagAttributesBase{{Name: &v1, Digest: &digest}, {Name: &v2, Digest: &digest}}
+		opts.SetAliasDetection(true, true)
+		filtered, err := opts.withoutPartialUntags(testCtx, testRepo, tags, aliases)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(*filtered))
+		assert.Contains(out.String(), "Warning: keeping bar:v1, sha:a is also tagged latest")
+		opts.SetAliasDetection(true, false)
+		filtered, err = opts.withoutPartialUntags(testCtx, testRepo, tags, aliases)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, len(*filtered))
+		assert.Contains(out.String(), "Warning: deleting bar:v2 leaves sha:a reachable through the tags latest")
+		filtered, err = opts.withoutPartialUntags(testCtx, testRepo, tags, nil)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(tags, filtered)
+		filtered, err = opts.withoutPartialUntags(testCtx, testRepo, nil, aliases)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Nil(filtered)
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// SetCacheRules makes the run skip the repositories cached by the rules, the images of a pull-through cache are
+// pulled again from their source when they are deleted so a broad policy would only make the pulls slower. Nil
+// rules disable it.
+func (o *Options) SetCacheRules(rules []api.CacheRule) {
+	o.cacheRules = rules
+}
+
+// WithoutCachedRepositories removes the repositories cached by the rules of SetCacheRules from the filters of
+// GetTagFilters, a warning is written to warnings for every skipped repository.
+func (o *Options) WithoutCachedRepositories(tagFilters map[string]string, warnings io.Writer) map[string]string {
+	if len(o.cacheRules) == 0 {
+		return tagFilters
+	}
+	result := map[string]string{}
+	for repoName, tagFilter := range tagFilters {
+		if rule, ok := o.cacheRuleOf(repoName); ok {
+			fmt.Fprintf(warnings, "Skipping repository %s, it is a cache of %s (cache rule %s), use --include-cached to purge it\n", repoName, rule.Properties.SourceRepository, rule.Name)
+			continue
+		}
+		result[repoName] = tagFilter
+	}
+	return result
+}
+
+// cacheRuleOf returns the cache rule that caches the repository.
+func (o *Options) cacheRuleOf(repoName string) (api.CacheRule, bool) {
+	for _, rule := range o.cacheRules {
+		if rule.Matches(repoName) {
+			return rule, true
+		}
+	}
+	return api.CacheRule{}, false
+}
@@ -0,0 +1,38 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWithoutCachedRepositories contains the tests for the repositories skipped because of the cache rules.
+func TestWithoutCachedRepositories(t *testing.T) {
+	tagFilters := map[string]string{"library/nginx": ".*", "mcr/dotnet/runtime": "^8.*", "hello-world": ".*"}
+	// First test, without cache rules every repository is kept.
+	t.Run("NoRulesTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		var warnings bytes.Buffer
+		assert.Equal(tagFilters, opts.WithoutCachedRepositories(tagFilters, &warnings))
+		assert.Equal("", warnings.String())
+	})
+	// Second test, the repositories cached by a rule or a wildcard rule are skipped with a warning.
+	t.Run("RulesTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetCacheRules([]api.CacheRule{
+			{Name: "nginx", Properties: api.CacheRuleProperties{SourceRepository: "docker.io/library/nginx", TargetRepository: "library/nginx"}},
+			{Name: "mcr", Properties: api.CacheRuleProperties{SourceRepository: "mcr.microsoft.com/*", TargetRepository: "mcr/*"}},
+		})
+		var warnings bytes.Buffer
+		assert.Equal(map[string]string{"hello-world": ".*"}, opts.WithoutCachedRepositories(tagFilters, &warnings))
+		assert.Contains(warnings.String(), "Skipping repository library/nginx, it is a cache of docker.io/library/nginx (cache rule nginx)")
+		assert.Contains(warnings.String(), "Skipping repository mcr/dotnet/runtime, it is a cache of mcr.microsoft.com/* (cache rule mcr)")
+	})
+}
@@ -0,0 +1,38 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import "time"
+
+// Clock provides the current time that the age of the tags is compared against, it allows tests and the now flag
+// to select tags as if the purge ran at a different time.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock reads the time of the system.
+type systemClock struct{}
+
+// Now returns the current system time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// fixedClock always returns the same time.
+type fixedClock time.Time
+
+// Now returns the time the clock was created with.
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// SystemClock returns a Clock that reads the time of the system.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+// FixedClock returns a Clock that always returns the specified time.
+func FixedClock(now time.Time) Clock {
+	return fixedClock(now)
+}
@@ -0,0 +1,194 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/worker"
+	"github.com/Azure/acr-cli/pkg/acrapi"
+)
+
+// The results of the rows of the CSV report.
+const (
+	ResultDeleted     = "deleted"
+	ResultWouldDelete = "would delete"
+	ResultNotFound    = "not found"
+	ResultFailed      = "failed"
+	ResultMoved       = "digest changed"
+)
+
+// csvHeader is the first row of the CSV report.
+var csvHeader = []string{"repository", "tag", "digest", "media type", "size", "last update time", "result"}
+
+// CSVReport writes a row for every tag and manifest the purge deletes, or would delete in a dry run. The size and the
+// media type of a tag are the ones of the manifest it references.
+type CSVReport struct {
+	mu     sync.Mutex
+	writer *csv.Writer
+	// pending are the rows of the tags and manifests queued for deletion whose result is not known yet, by repository
+	// and tag or digest.
+	pending map[string][]string
+	// manifests are the attributes of the manifests of every repository with tags in the report, by digest.
+	manifests map[string]map[string]acr.ManifestAttributesBase
+	// html receives every row too, it is nil unless AddHTMLReport is called.
+	html *HTMLReport
+}
+
+// NewCSVReport creates a report that writes to w and writes its header.
+func NewCSVReport(w io.Writer) (*CSVReport, error) {
+	report := &CSVReport{
+		writer:    csv.NewWriter(w),
+		pending:   map[string][]string{},
+		manifests: map[string]map[string]acr.ManifestAttributesBase{},
+	}
+	if err := report.writer.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// EnableCSVReport makes the run write the tags and manifests it deletes to the report, nil disables it.
+func (o *Options) EnableCSVReport(report *CSVReport) {
+	o.csvReport = report
+}
+
+// AddHTMLReport makes the report pass every row it writes to an HTML report too.
+func (r *CSVReport) AddHTMLReport(html *HTMLReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.html = html
+}
+
+// write writes a row with its result, the caller holds the lock.
+func (r *CSVReport) write(row []string) {
+	r.writer.Write(row)
+	if r.html != nil {
+		r.html.add(row)
+	}
+}
+
+// Flush writes the buffered rows and returns the first error that happened while writing.
+func (r *CSVReport) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writer.Flush()
+	return r.writer.Error()
+}
+
+// expectTags stores the rows of tags that are queued for deletion, they are written when the workers report their
+// result.
+func (r *CSVReport) expectTags(ctx context.Context, acrClient api.ManifestLister, repoName string, tags []acr.TagAttributesBase) {
+	rows := r.tagRows(ctx, acrClient, repoName, tags)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, tag := range tags {
+		r.pending[repoName+":"+*tag.Name] = rows[i]
+	}
+}
+
+// expectManifests stores the rows of manifests that are queued for deletion.
+func (r *CSVReport) expectManifests(repoName string, manifests []acr.ManifestAttributesBase) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, manifest := range manifests {
+		r.pending[repoName+"@"+*manifest.Digest] = manifestRow(repoName, "", manifest)
+	}
+}
+
+// writeTags writes the rows of tags with a result, it is used by the dry run.
+func (r *CSVReport) writeTags(ctx context.Context, acrClient api.ManifestLister, repoName string, tags []acr.TagAttributesBase, result string) {
+	rows := r.tagRows(ctx, acrClient, repoName, tags)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, row := range rows {
+		r.write(append(row, result))
+	}
+}
+
+// writeManifests writes the rows of manifests with a result, it is used by the dry run.
+func (r *CSVReport) writeManifests(repoName string, manifests []acr.ManifestAttributesBase, result string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, manifest := range manifests {
+		r.write(append(manifestRow(repoName, "", manifest), result))
+	}
+}
+
+// handleResult writes the row of a deleted tag or manifest, it is called by the workers.
+func (r *CSVReport) handleResult(result worker.Result) {
+	key := result.RepoName + "@" + result.Digest
+	if len(result.Tag) > 0 {
+		key = result.RepoName + ":" + result.Tag
+	}
+	outcome := ResultDeleted
+	if result.Err != nil {
+		outcome = ResultFailed
+	} else if result.Moved {
+		outcome = ResultMoved
+	} else if result.Skipped {
+		outcome = ResultNotFound
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	row, ok := r.pending[key]
+	if !ok {
+		row = []string{result.RepoName, result.Tag, result.Digest, "", "", ""}
+	}
+	delete(r.pending, key)
+	r.write(append(row, outcome))
+}
+
+// tagRows returns the rows of tags without the result. The attributes of the manifests of the repository are listed
+// the first time one of its tags is added, if they cannot be listed (e.g. in an OCI registry) the size and the media
+// type are left empty.
+func (r *CSVReport) tagRows(ctx context.Context, acrClient api.ManifestLister, repoName string, tags []acr.TagAttributesBase) [][]string {
+	r.mu.Lock()
+	manifests, ok := r.manifests[repoName]
+	r.mu.Unlock()
+	if !ok {
+		manifests = map[string]acr.ManifestAttributesBase{}
+		iterator := acrapi.NewManifestIterator(acrClient, repoName, "")
+		for iterator.Next(ctx) {
+			if manifest := iterator.Manifest(); manifest.Digest != nil {
+				manifests[*manifest.Digest] = manifest
+			}
+		}
+		r.mu.Lock()
+		r.manifests[repoName] = manifests
+		r.mu.Unlock()
+	}
+	rows := [][]string{}
+	for _, tag := range tags {
+		manifest := manifests[*tag.Digest]
+		row := manifestRow(repoName, *tag.Name, manifest)
+		row[2] = *tag.Digest
+		row[5] = stringValue(tag.LastUpdateTime)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// manifestRow returns the row of a manifest, or of a tag if tag is set, without the result.
+func manifestRow(repoName string, tag string, manifest acr.ManifestAttributesBase) []string {
+	size := ""
+	if manifest.ImageSize != nil {
+		size = strconv.FormatInt(*manifest.ImageSize, 10)
+	}
+	return []string{repoName, tag, stringValue(manifest.Digest), stringValue(manifest.MediaType), size, stringValue(manifest.LastUpdateTime)}
+}
+
+// stringValue returns the value of an optional string or an empty string.
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
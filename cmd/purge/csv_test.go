@@ -0,0 +1,70 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/cmd/worker"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCSVReport contains the tests for the CSV report of the deleted tags and manifests.
+func TestCSVReport(t *testing.T) {
+	imageSize := int64(1024)
+	manifests := &acr.Manifests{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+			LastUpdateTime: &lastUpdateTime,
+			Digest:         &digest,
+			MediaType:      &dockerV2MediaType,
+			ImageSize:      &imageSize,
+		}},
+	}
+	tags := []acr.TagAttributesBase{{Name: &tagName, Digest: &digest, LastUpdateTime: &lastUpdateTime}}
+	untagged := []acr.ManifestAttributesBase{{Digest: &digest1, MediaType: &dockerV2MediaType, ImageSize: &imageSize, LastUpdateTime: &lastUpdateTime}}
+	// First test, the rows of the queued tags and manifests are written with the result the workers report.
+	t.Run("DeletedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(manifests, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
+		out := &bytes.Buffer{}
+		report, err := NewCSVReport(out)
+		assert.Equal(nil, err, "Error should be nil")
+		report.expectTags(testCtx, mockClient, testRepo, tags)
+		report.expectManifests(testRepo, untagged)
+		report.handleResult(worker.Result{RepoName: testRepo, Tag: tagName})
+		report.handleResult(worker.Result{RepoName: testRepo, Digest: digest1, Err: errors.New("forbidden")})
+		assert.Equal(nil, report.Flush(), "Error should be nil")
+		expected := "repository,tag,digest,media type,size,last update time,result\n" +
+			testRepo + "," + tagName + "," + digest + "," + dockerV2MediaType + ",1024," + lastUpdateTime + ",deleted\n" +
+			testRepo + ",," + digest1 + "," + dockerV2MediaType + ",1024," + lastUpdateTime + ",failed\n"
+		assert.Equal(expected, out.String())
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, the dry run writes its rows at once and the size of a tag is left empty if the manifests cannot
+	// be listed.
+	t.Run("DryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(nil, errors.New("listing manifests is not supported")).Once()
+		out := &bytes.Buffer{}
+		report, err := NewCSVReport(out)
+		assert.Equal(nil, err, "Error should be nil")
+		report.writeTags(testCtx, mockClient, testRepo, tags, ResultWouldDelete)
+		report.writeManifests(testRepo, untagged, ResultWouldDelete)
+		assert.Equal(nil, report.Flush(), "Error should be nil")
+		expected := "repository,tag,digest,media type,size,last update time,result\n" +
+			testRepo + "," + tagName + "," + digest + ",,," + lastUpdateTime + ",would delete\n" +
+			testRepo + ",," + digest1 + "," + dockerV2MediaType + ",1024," + lastUpdateTime + ",would delete\n"
+		assert.Equal(expected, out.String())
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,184 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/Azure/acr-cli/acr"
+)
+
+// PlanVersion is the version of the plans created by NewPlan.
+const PlanVersion = 1
+
+// WritePlan stores a plan in the specified path. The tags and manifests of every repository are sorted so that the
+// same candidates always produce the same file, which makes saved plans easy to compare with other tools.
+func WritePlan(plan *Plan, path string) error {
+	sorted := *plan
+	sorted.Repositories = make([]RepositoryPlan, len(plan.Repositories))
+	copy(sorted.Repositories, plan.Repositories)
+	sort.Slice(sorted.Repositories, func(i, j int) bool {
+		return sorted.Repositories[i].Name < sorted.Repositories[j].Name
+	})
+	for i := range sorted.Repositories {
+		repoPlan := &sorted.Repositories[i]
+		repoPlan.Tags = append(repoPlan.Tags[:0:0], repoPlan.Tags...)
+		sort.Slice(repoPlan.Tags, func(i, j int) bool {
+			return *repoPlan.Tags[i].Name < *repoPlan.Tags[j].Name
+		})
+		repoPlan.Manifests = append(repoPlan.Manifests[:0:0], repoPlan.Manifests...)
+		sort.Slice(repoPlan.Manifests, func(i, j int) bool {
+			return *repoPlan.Manifests[i].Digest < *repoPlan.Manifests[j].Digest
+		})
+	}
+	planBytes, err := json.MarshalIndent(sorted, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, planBytes, 0644)
+}
+
+// ReadPlan reads a plan previously stored with WritePlan.
+func ReadPlan(path string) (*Plan, error) {
+	planBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(planBytes, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	if plan.Version != PlanVersion {
+		return nil, fmt.Errorf("plan %s has version %d, only version %d is supported", path, plan.Version, PlanVersion)
+	}
+	return &plan, nil
+}
+
+// PlanDiff contains the candidates of two plans, tags are identified as <repository>:<tag> and manifests as
+// <repository>@<digest>. All the lists are sorted.
+type PlanDiff struct {
+	// Added are the candidates that are only in the current plan.
+	Added []string
+	// Removed are the candidates that are only in the previous plan, they were deleted or no longer match the policy.
+	Removed []string
+	// Kept are the candidates that are in both plans.
+	Kept []string
+}
+
+// DiffPlans compares the candidates of a previous plan with the ones of the current plan.
+func DiffPlans(previous *Plan, current *Plan) PlanDiff {
+	previousCandidates := planCandidates(previous)
+	currentCandidates := planCandidates(current)
+	diff := PlanDiff{Added: []string{}, Removed: []string{}, Kept: []string{}}
+	for candidate := range currentCandidates {
+		if previousCandidates[candidate] {
+			diff.Kept = append(diff.Kept, candidate)
+		} else {
+			diff.Added = append(diff.Added, candidate)
+		}
+	}
+	for candidate := range previousCandidates {
+		if !currentCandidates[candidate] {
+			diff.Removed = append(diff.Removed, candidate)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Kept)
+	return diff
+}
+
+// PrintDiff writes the candidates that are new with a +, the ones that disappeared with a - and the ones that
+// remain with a =.
+func PrintDiff(out io.Writer, diff PlanDiff) {
+	fmt.Fprintf(out, "New candidates: %d\n", len(diff.Added))
+	for _, candidate := range diff.Added {
+		fmt.Fprintf(out, "+ %s\n", candidate)
+	}
+	fmt.Fprintf(out, "Disappeared candidates: %d\n", len(diff.Removed))
+	for _, candidate := range diff.Removed {
+		fmt.Fprintf(out, "- %s\n", candidate)
+	}
+	fmt.Fprintf(out, "Remaining candidates: %d\n", len(diff.Kept))
+	for _, candidate := range diff.Kept {
+		fmt.Fprintf(out, "= %s\n", candidate)
+	}
+}
+
+// planCandidates returns the set of candidates of a plan.
+func planCandidates(plan *Plan) map[string]bool {
+	candidates := map[string]bool{}
+	for _, repoPlan := range plan.Repositories {
+		for _, tag := range repoPlan.Tags {
+			candidates[repoPlan.Name+":"+*tag.Name] = true
+		}
+		for _, manifest := range repoPlan.Manifests {
+			candidates[repoPlan.Name+"@"+*manifest.Digest] = true
+		}
+	}
+	return candidates
+}
+
+// ApprovedPlan returns the candidates of the current plan that the approved plan contains with the same digest and
+// last update time, so that a tag moved to another digest or pushed again and a manifest updated since the approval
+// are kept. A manifest is only kept if all its referrers in the current plan are kept too, so that deleting it never
+// leaves a referrer without its subject.
+func ApprovedPlan(approved *Plan, current *Plan) *Plan {
+	approvedCandidates := map[string]bool{}
+	for _, repoPlan := range approved.Repositories {
+		for _, tag := range repoPlan.Tags {
+			approvedCandidates[tagCandidate(repoPlan.Name, tag)] = true
+		}
+		for _, manifest := range repoPlan.Manifests {
+			approvedCandidates[manifestCandidate(repoPlan.Name, manifest)] = true
+		}
+	}
+	plan := &Plan{Version: current.Version, LoginURL: current.LoginURL, Repositories: []RepositoryPlan{}, windows: current.windows}
+	for _, repoPlan := range current.Repositories {
+		kept := RepositoryPlan{
+			Name:      repoPlan.Name,
+			Tags:      []acr.TagAttributesBase{},
+			Manifests: []acr.ManifestAttributesBase{},
+			Referrers: repoPlan.Referrers,
+		}
+		for _, tag := range repoPlan.Tags {
+			if approvedCandidates[tagCandidate(repoPlan.Name, tag)] {
+				kept.Tags = append(kept.Tags, tag)
+			}
+		}
+		// The referrers come before the manifests they refer to, so they have already been checked.
+		keptDigests := map[string]bool{}
+		for _, manifest := range repoPlan.Manifests {
+			if !approvedCandidates[manifestCandidate(repoPlan.Name, manifest)] {
+				continue
+			}
+			referrersKept := true
+			for _, referrer := range repoPlan.Referrers[*manifest.Digest] {
+				referrersKept = referrersKept && keptDigests[referrer]
+			}
+			if referrersKept {
+				kept.Manifests = append(kept.Manifests, manifest)
+				keptDigests[*manifest.Digest] = true
+			}
+		}
+		if len(kept.Tags) > 0 || len(kept.Manifests) > 0 {
+			plan.Repositories = append(plan.Repositories, kept)
+		}
+	}
+	return plan
+}
+
+// tagCandidate identifies a tag of a plan by its repository, name, digest and last update time.
+func tagCandidate(repoName string, tag acr.TagAttributesBase) string {
+	return repoName + ":" + *tag.Name + "@" + stringValue(tag.Digest) + " " + stringValue(tag.LastUpdateTime)
+}
+
+// manifestCandidate identifies a manifest of a plan by its repository, digest and last update time.
+func manifestCandidate(repoName string, manifest acr.ManifestAttributesBase) string {
+	return repoName + "@" + *manifest.Digest + " " + stringValue(manifest.LastUpdateTime)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPlan creates a plan of a single repository with the specified tags and manifest digests.
+func testPlan(repoName string, tagNames []string, digests []string) *Plan {
+	repoPlan := RepositoryPlan{Name: repoName, Tags: []acr.TagAttributesBase{}, Manifests: []acr.ManifestAttributesBase{}}
+	for i := range tagNames {
+		repoPlan.Tags = append(repoPlan.Tags, acr.TagAttributesBase{Name: &tagNames[i]})
+	}
+	for i := range digests {
+		repoPlan.Manifests = append(repoPlan.Manifests, acr.ManifestAttributesBase{Digest: &digests[i]})
+	}
+	return &Plan{Version: PlanVersion, LoginURL: testLoginURL, Repositories: []RepositoryPlan{repoPlan}}
+}
+
+// TestSavedPlan contains the tests for storing and comparing plans.
+func TestSavedPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// First test, a stored plan is sorted and can be read back, the stored plan does not depend on the order of the candidates.
+	t.Run("WriteAndReadTest", func(t *testing.T) {
+		assert := assert.New(t)
+		first := filepath.Join(dir, "first.json")
+		second := filepath.Join(dir, "second.json")
+		assert.Equal(nil, WritePlan(testPlan(testRepo, []string{"v2", "v1"}, []string{"sha:b", "sha:a"}), first))
+		assert.Equal(nil, WritePlan(testPlan(testRepo, []string{"v1", "v2"}, []string{"sha:a", "sha:b"}), second))
+		firstBytes, _ := ioutil.ReadFile(first)
+		secondBytes, _ := ioutil.ReadFile(second)
+		assert.Equal(string(firstBytes), string(secondBytes))
+		plan, err := ReadPlan(first)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("v1", *plan.Repositories[0].Tags[0].Name)
+		assert.Equal("sha:a", *plan.Repositories[0].Manifests[0].Digest)
+	})
+	// Second test, plans with another version or that are not plans should return an error.
+	t.Run("InvalidPlanTest", func(t *testing.T) {
+		assert := assert.New(t)
+		path := filepath.Join(dir, "invalid.json")
+		assert.Equal(nil, ioutil.WriteFile(path, []byte(`{"version":2}`), 0644))
+		_, err := ReadPlan(path)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Equal(nil, ioutil.WriteFile(path, []byte(`not a plan`), 0644))
+		_, err = ReadPlan(path)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		_, err = ReadPlan(filepath.Join(dir, "missing.json"))
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+	// Third test, the candidates are split in the ones that are new, the ones that disappeared and the ones that remain.
+	t.Run("DiffTest", func(t *testing.T) {
+		assert := assert.New(t)
+		previous := testPlan(testRepo, []string{"v1", "v2"}, []string{"sha:a"})
+		current := testPlan(testRepo, []string{"v2", "v3"}, []string{"sha:a", "sha:b"})
+		diff := DiffPlans(previous, current)
+		assert.Equal([]string{"bar:v3", "bar@sha:b"}, diff.Added)
+		assert.Equal([]string{"bar:v1"}, diff.Removed)
+		assert.Equal([]string{"bar:v2", "bar@sha:a"}, diff.Kept)
+	})
+	// Fourth test, only the candidates of the current plan that were approved with the same digest and last update time are kept,
+	// and a manifest whose referrer is not kept is not deleted.
+	t.Run("ApprovedPlanTest", func(t *testing.T) {
+		assert := assert.New(t)
+		approved := testPlan(testRepo, []string{"v1", "v2", "v3"}, []string{"sha:a", "sha:b", "sha:c"})
+		approved.Repositories[0].Tags[1].Digest = &digest
+		current := testPlan(testRepo, []string{"v1", "v2", "v3", "v4"}, []string{"sha:d", "sha:a", "sha:b", "sha:c"})
+		current.Repositories[0].Tags[1].Digest = &multiArchDigest
+		current.Repositories[0].Tags[2].LastUpdateTime = &lastUpdateTime
+		current.Repositories[0].Referrers = map[string][]string{"sha:a": {"sha:d"}}
+		plan := ApprovedPlan(approved, current)
+		assert.Equal(1, len(plan.Repositories))
+		assert.Equal(1, len(plan.Repositories[0].Tags))
+		assert.Equal("v1", *plan.Repositories[0].Tags[0].Name)
+		assert.Equal(2, len(plan.Repositories[0].Manifests))
+		assert.Equal("sha:b", *plan.Repositories[0].Manifests[0].Digest)
+		assert.Equal("sha:c", *plan.Repositories[0].Manifests[1].Digest)
+		// Nothing is deleted if none of the current candidates were approved.
+		assert.Equal(0, len(ApprovedPlan(testPlan(testRepo, []string{"v5"}, []string{}), current).Repositories))
+	})
+}
@@ -0,0 +1,206 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/fakeacr"
+	"github.com/Azure/acr-cli/cmd/worker"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEndToEnd purges a repository of the fake registry through the real client, the pages are small so that the
+// tags and manifests are listed in several pages while they are deleted.
+func TestEndToEnd(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	registry := fakeacr.NewRegistry("user", "password")
+	defer registry.Close()
+	registry.SetPageSize(2)
+	now := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-72 * time.Hour)
+	registry.PushImage("hello", "v1", old)
+	registry.PushImage("hello", "v2", old)
+	registry.PushImage("hello", "v3", old)
+	recent := registry.PushImage("hello", "v4", now.Add(-time.Hour))
+	// The children of a tagged index are kept even though they have no tags.
+	amd64 := registry.PushImage("hello", "", old)
+	arm64 := registry.PushImage("hello", "", old)
+	multiArch := registry.PushIndex("hello", "multi", old, amd64, arm64)
+	registry.PushImage("hello", "", old)
+
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), "user", "password", nil)
+	assert.Equal(nil, err, "Error should be nil")
+	acrClient.AutorestClient.Sender = registry.HTTPClient()
+	StartDispatcher(ctx, acrClient, 6)
+	defer StopDispatcher()
+
+	summary, err := Tags(ctx, acrClient, FixedClock(now), registry.LoginURL(), "hello", Cutoff{Ago: "1d"}, "^v.*", MatchOnTag, false, NewOptions())
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(3, summary.Deleted)
+	assert.Equal([]string{"multi", "v4"}, registry.Tags("hello"))
+
+	summary, err = DanglingManifests(ctx, acrClient, registry.LoginURL(), "hello", NewOptions())
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(4, summary.Deleted)
+	remaining := registry.Manifests("hello")
+	assert.Equal(4, len(remaining))
+	for _, digest := range []string{recent, amd64, arm64, multiArch} {
+		assert.Contains(remaining, digest)
+	}
+}
+
+// TestEndToEndPrefixFilter purges the tags of a registry that filters the tags by name, only the tags that start with
+// the prefix of the filter are listed.
+func TestEndToEndPrefixFilter(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	registry := fakeacr.NewRegistry("user", "password")
+	defer registry.Close()
+	registry.SetAPIVersions("2021-07-01")
+	now := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-72 * time.Hour)
+	for _, tag := range []string{"dev-1", "dev-2", "v1.0", "v1.1", "v2.0"} {
+		registry.PushImage("hello", tag, old)
+	}
+
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), "user", "password", nil)
+	assert.Equal(nil, err, "Error should be nil")
+	acrClient.AutorestClient.Sender = registry.HTTPClient()
+	version, err := acrClient.NegotiateAPIVersion(ctx)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal("2021-07-01", version)
+	StartDispatcher(ctx, acrClient, 6)
+	defer StopDispatcher()
+
+	summary, err := Tags(ctx, acrClient, FixedClock(now), registry.LoginURL(), "hello", Cutoff{Ago: "1d"}, "^v1\\..*", MatchOnTag, false, NewOptions())
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(2, summary.Deleted)
+	assert.Equal(2, summary.Scanned)
+	assert.Equal([]string{"dev-1", "dev-2", "v2.0"}, registry.Tags("hello"))
+}
+
+// TestEndToEndAliases purges the tags of a registry with the alias detection and the partial untags kept, the tags of
+// a repository are only listed a second time when the manifest of a tag to delete has other tags.
+func TestEndToEndAliases(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	registry := fakeacr.NewRegistry("user", "password")
+	defer registry.Close()
+	now := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-72 * time.Hour)
+	registry.PushImage("single", "v1", old)
+	registry.PushImage("single", "v2", old)
+	registry.PushImage("shared", "v1", old)
+	shared := registry.PushImage("shared", "v2", old)
+	registry.Tag("shared", "latest", shared, now)
+
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), "user", "password", nil)
+	assert.Equal(nil, err, "Error should be nil")
+	acrClient.AutorestClient.Sender = registry.HTTPClient()
+	StartDispatcher(ctx, acrClient, 6)
+	defer StopDispatcher()
+
+	// tagListings returns the number of times the tags of a repository were listed.
+	tagListings := func(repoName string) int {
+		count := 0
+		for _, request := range registry.Requests() {
+			if request == "GET /acr/v1/"+repoName+"/_tags" {
+				count++
+			}
+		}
+		return count
+	}
+	opts := NewOptions()
+	opts.SetAliasDetection(true, true)
+	summary, err := Tags(ctx, acrClient, FixedClock(now), registry.LoginURL(), "single", Cutoff{Ago: "1d"}, "^v.*", MatchOnTag, false, opts)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(2, summary.Deleted)
+	assert.Equal(1, tagListings("single"))
+
+	summary, err = Tags(ctx, acrClient, FixedClock(now), registry.LoginURL(), "shared", Cutoff{Ago: "1d"}, "^v.*", MatchOnTag, false, opts)
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(1, summary.Deleted)
+	assert.Equal(1, summary.Skipped)
+	assert.Equal(2, tagListings("shared"))
+	assert.Equal([]string{"latest", "v2"}, registry.Tags("shared"))
+}
+
+// TestEndToEndConcurrentSettings purges two repositories of a slow registry at the same time, each run with its own
+// dispatcher, concurrency, slow request threshold and digest verification. The settings of a run must not change the
+// ones of the other, it is meant to be run with the race detector.
+func TestEndToEndConcurrentSettings(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	registry := fakeacr.NewRegistry("user", "password")
+	defer registry.Close()
+	now := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-72 * time.Hour)
+	repoNames := []string{"verified", "unverified"}
+	for _, repoName := range repoNames {
+		for i := 0; i < 10; i++ {
+			registry.PushImage(repoName, fmt.Sprintf("v%d", i), old)
+		}
+	}
+	registry.SetLatency(2 * time.Millisecond)
+
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), "user", "password", nil)
+	assert.Equal(nil, err, "Error should be nil")
+	acrClient.AutorestClient.Sender = registry.HTTPClient()
+
+	settings := []worker.DispatcherOptions{
+		{Workers: 4, SlowRequestThreshold: time.Nanosecond},
+		{MaxConcurrency: 1},
+	}
+	dispatchers := make([]*worker.Dispatcher, len(repoNames))
+	outs := make([]*bytes.Buffer, len(repoNames))
+	summaries := make([]Summary, len(repoNames))
+	errs := make([]error, len(repoNames))
+	var wg sync.WaitGroup
+	for i, repoName := range repoNames {
+		dispatchers[i] = worker.NewDispatcherWithOptions(ctx, acrClient, settings[i])
+		defer dispatchers[i].Stop()
+		outs[i] = &bytes.Buffer{}
+		opts := NewOptions()
+		opts.SetDispatcher(dispatchers[i])
+		opts.SetOutput(outs[i])
+		opts.SetVerifyDigest(i == 0)
+		wg.Add(1)
+		go func(i int, repoName string, opts *Options) {
+			defer wg.Done()
+			summaries[i], errs[i] = Tags(ctx, acrClient, FixedClock(now), registry.LoginURL(), repoName, Cutoff{Ago: "1d"}, "^v.*", MatchOnTag, false, opts)
+		}(i, repoName, opts)
+	}
+	wg.Wait()
+	// headRequests returns the number of manifests of a repository whose digest was verified.
+	headRequests := func(repoName string) int {
+		count := 0
+		for _, request := range registry.Requests() {
+			if strings.HasPrefix(request, "HEAD /v2/"+repoName+"/manifests/") {
+				count++
+			}
+		}
+		return count
+	}
+	for i, repoName := range repoNames {
+		assert.Equal(nil, errs[i], "Error should be nil")
+		assert.Equal(10, summaries[i].Deleted, repoName)
+		assert.Equal(0, len(registry.Tags(repoName)), repoName)
+		assert.Equal(10, dispatchers[i].Stats().Jobs, repoName)
+	}
+	assert.Equal(10, headRequests("verified"))
+	assert.Equal(0, headRequests("unverified"))
+	assert.Contains(outs[0].String(), "Slow request: ")
+	assert.NotContains(outs[1].String(), "Slow request: ")
+	assert.Equal(0, dispatchers[0].Stats().PeakConcurrency)
+	assert.Equal(1, dispatchers[1].Stats().PeakConcurrency)
+}
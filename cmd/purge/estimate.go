@@ -0,0 +1,150 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// registryTier contains the write operations per minute a registry SKU allows before throttling, deletions count as
+// write operations.
+type registryTier struct {
+	Name              string
+	WriteOpsPerMinute int
+}
+
+// registryTiers are the ACR SKUs from the most to the least restrictive.
+var registryTiers = []registryTier{
+	{Name: "Basic", WriteOpsPerMinute: 100},
+	{Name: "Standard", WriteOpsPerMinute: 500},
+	{Name: "Premium", WriteOpsPerMinute: 2000},
+}
+
+// RequestCounter wraps an AcrCLIClientInterface and counts the requests that read the registry and the time spent on
+// them, it is used to measure the metadata scan of an estimate.
+type RequestCounter struct {
+	api.AcrCLIClientInterface
+	mu       sync.Mutex
+	requests int
+	duration time.Duration
+}
+
+// NewRequestCounter creates a RequestCounter in front of the client.
+func NewRequestCounter(client api.AcrCLIClientInterface) *RequestCounter {
+	return &RequestCounter{AcrCLIClientInterface: client}
+}
+
+// GetAcrRepositories counts the request and forwards it.
+func (c *RequestCounter) GetAcrRepositories(ctx context.Context, last string) (*acr.Repositories, error) {
+	defer c.count(time.Now())
+	return c.AcrCLIClientInterface.GetAcrRepositories(ctx, last)
+}
+
+// GetAcrTags counts the request and forwards it.
+func (c *RequestCounter) GetAcrTags(ctx context.Context, repoName string, orderBy string, last string) (*acr.RepositoryTagsType, error) {
+	defer c.count(time.Now())
+	return c.AcrCLIClientInterface.GetAcrTags(ctx, repoName, orderBy, last)
+}
+
+// GetAcrManifests counts the request and forwards it.
+func (c *RequestCounter) GetAcrManifests(ctx context.Context, repoName string, orderBy string, last string) (*acr.Manifests, error) {
+	defer c.count(time.Now())
+	return c.AcrCLIClientInterface.GetAcrManifests(ctx, repoName, orderBy, last)
+}
+
+// GetManifest counts the request and forwards it.
+func (c *RequestCounter) GetManifest(ctx context.Context, repoName string, reference string) ([]byte, error) {
+	defer c.count(time.Now())
+	return c.AcrCLIClientInterface.GetManifest(ctx, repoName, reference)
+}
+
+// Requests returns the number of requests counted so far and the time spent on them.
+func (c *RequestCounter) Requests() (int, time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests, c.duration
+}
+
+// count adds a request that started at start.
+func (c *RequestCounter) count(start time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests++
+	c.duration += time.Since(start)
+}
+
+// Estimate contains the expected cost of executing a plan.
+type Estimate struct {
+	// ScanRequests is the number of requests that were needed to create the plan and ScanDuration the time spent on them.
+	ScanRequests int
+	ScanDuration time.Duration
+	// DeleteRequests is the number of requests that executing the plan would send.
+	DeleteRequests int
+	// Concurrency is the number of deletions sent at the same time.
+	Concurrency int
+	// Latency is the average latency of the scan requests, the deletions are expected to take as long.
+	Latency time.Duration
+	// DeleteDuration is the projected time the deletions take.
+	DeleteDuration time.Duration
+	// WritesPerMinute is the projected rate of the deletions.
+	WritesPerMinute float64
+}
+
+// NewEstimate projects the cost of executing a plan from the requests and the time the scan took. Tags are counted
+// in batches if batch deletion is enabled in the options.
+func NewEstimate(plan *Plan, scanRequests int, scanDuration time.Duration, concurrency int, opts *Options) Estimate {
+	estimate := Estimate{ScanRequests: scanRequests, ScanDuration: scanDuration, Concurrency: concurrency}
+	for _, repoPlan := range plan.Repositories {
+		if opts.batchSize > 1 {
+			estimate.DeleteRequests += (len(repoPlan.Tags) + opts.batchSize - 1) / opts.batchSize
+		} else {
+			estimate.DeleteRequests += len(repoPlan.Tags)
+		}
+		estimate.DeleteRequests += len(repoPlan.Manifests)
+	}
+	if scanRequests > 0 {
+		estimate.Latency = scanDuration / time.Duration(scanRequests)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	rounds := (estimate.DeleteRequests + concurrency - 1) / concurrency
+	estimate.DeleteDuration = time.Duration(rounds) * estimate.Latency
+	if estimate.DeleteDuration > 0 {
+		estimate.WritesPerMinute = float64(estimate.DeleteRequests) / estimate.DeleteDuration.Minutes()
+	}
+	return estimate
+}
+
+// ThrottledTiers returns the names of the registry SKUs whose write limit the projected rate exceeds, throttling
+// only happens if the deletions last long enough to reach the limit in a minute.
+func (e Estimate) ThrottledTiers() []string {
+	tiers := []string{}
+	for _, tier := range registryTiers {
+		if e.DeleteRequests > tier.WriteOpsPerMinute && e.WritesPerMinute > float64(tier.WriteOpsPerMinute) {
+			tiers = append(tiers, tier.Name)
+		}
+	}
+	return tiers
+}
+
+// PrintEstimate writes the expected number of requests and the projected runtime, and warns about throttling.
+func PrintEstimate(out io.Writer, e Estimate) {
+	fmt.Fprintf(out, "Scan requests: %d (took %s, average latency %s)\n", e.ScanRequests, e.ScanDuration.Round(time.Millisecond), e.Latency.Round(time.Millisecond))
+	fmt.Fprintf(out, "Delete requests: %d\n", e.DeleteRequests)
+	fmt.Fprintf(out, "Total requests: %d\n", e.ScanRequests+e.DeleteRequests)
+	fmt.Fprintf(out, "Projected runtime: %s (%s scanning, %s deleting with %d concurrent requests)\n",
+		(e.ScanDuration + e.DeleteDuration).Round(time.Second), e.ScanDuration.Round(time.Second), e.DeleteDuration.Round(time.Second), e.Concurrency)
+	if tiers := e.ThrottledTiers(); len(tiers) > 0 {
+		fmt.Fprintf(out, "Warning: about %.0f deletions per minute would exceed the write limits of %s registries, expect throttling and a longer runtime\n", e.WritesPerMinute, strings.Join(tiers, ", "))
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEstimate contains the tests for the projection of the requests and the runtime of a purge.
+func TestEstimate(t *testing.T) {
+	tags := make([]acr.TagAttributesBase, 250)
+	manifests := make([]acr.ManifestAttributesBase, 50)
+	plan := &Plan{Repositories: []RepositoryPlan{{Name: testRepo, Tags: tags, Manifests: manifests}}}
+	// First test, every tag and manifest is a request and the requests are spread over the workers.
+	t.Run("ProjectionTest", func(t *testing.T) {
+		assert := assert.New(t)
+		estimate := NewEstimate(plan, 10, time.Second, 6, NewOptions())
+		assert.Equal(300, estimate.DeleteRequests)
+		assert.Equal(100*time.Millisecond, estimate.Latency)
+		assert.Equal(5*time.Second, estimate.DeleteDuration)
+		assert.Equal(3600.0, estimate.WritesPerMinute)
+		assert.Equal([]string{"Basic"}, estimate.ThrottledTiers())
+	})
+	// Second test, the tags are counted in batches if batch deletion is enabled.
+	t.Run("BatchTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.batchSize = 100
+		estimate := NewEstimate(plan, 10, time.Minute, 1, opts)
+		assert.Equal(53, estimate.DeleteRequests)
+		assert.Equal([]string{}, estimate.ThrottledTiers())
+	})
+	// Third test, the requests of the scan are counted and the warning is printed.
+	t.Run("PrintTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, digest).Return([]byte("{}"), nil).Once()
+		counter := NewRequestCounter(mockClient)
+		counter.GetAcrTags(testCtx, testRepo, "", "")
+		counter.GetManifest(testCtx, testRepo, digest)
+		requests, _ := counter.Requests()
+		assert.Equal(2, requests)
+		out := &bytes.Buffer{}
+		PrintEstimate(out, NewEstimate(plan, 10, time.Second, 6, NewOptions()))
+		assert.Contains(out.String(), "Delete requests: 300\nTotal requests: 310\n")
+		assert.Contains(out.String(), "Projected runtime: 6s (1s scanning, 5s deleting with 6 concurrent requests)\n")
+		assert.Contains(out.String(), "exceed the write limits of Basic registries")
+		mockClient.AssertExpectations(t)
+	})
+}
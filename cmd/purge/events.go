@@ -0,0 +1,26 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"github.com/Azure/acr-cli/cmd/events"
+	"github.com/Azure/acr-cli/cmd/worker"
+)
+
+// EnableEvents makes the run publish an event for every tag and manifest it deletes, nil disables it.
+func (o *Options) EnableEvents(publisher *events.Publisher) {
+	o.eventPublisher = publisher
+}
+
+// publishResult publishes the event of a successful deletion, the items that were not found were already gone.
+func publishResult(publisher *events.Publisher, result worker.Result) {
+	if result.Err != nil || result.Skipped {
+		return
+	}
+	if len(result.Tag) > 0 {
+		publisher.Publish(events.OpDeleteTag, result.RepoName, result.Tag, "")
+	} else {
+		publisher.Publish(events.OpDeleteManifest, result.RepoName, "", result.Digest)
+	}
+}
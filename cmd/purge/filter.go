@@ -0,0 +1,119 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// SlowFilterThreshold is the average time to match a tag above which a filter is reported as slow, at this cost a
+// repository with a million tags spends more than 20 seconds only evaluating the filter.
+const SlowFilterThreshold = 20 * time.Microsecond
+
+// SetFilterTimeout limits the time the evaluation of the filters can take during the whole run, so that a filter
+// that is too expensive for the number of tags fails with a clear error instead of making the purge seem to hang.
+// A timeout of 0 removes the limit.
+func (o *Options) SetFilterTimeout(timeout time.Duration) {
+	o.filterTimeout = timeout
+	atomic.StoreInt64(o.filterTime, 0)
+}
+
+// FilterTimeoutError is returned when the evaluation of the filters takes longer than the filter timeout.
+type FilterTimeoutError struct {
+	Timeout time.Duration
+	Filter  string
+}
+
+func (e *FilterTimeoutError) Error() string {
+	return fmt.Sprintf("evaluating the filters took longer than the filter timeout of %s (last filter %q), "+
+		"make the filter more specific (e.g. anchor it with ^ and $) or increase the filter-timeout value", e.Timeout, e.Filter)
+}
+
+// matchFilter matches the filter against a tag name or digest and charges the time it took to the filter timeout.
+func (o *Options) matchFilter(filter *regexp.Regexp, value string) (bool, error) {
+	if o.filterTimeout == 0 {
+		return filter.MatchString(value), nil
+	}
+	start := time.Now()
+	matched := filter.MatchString(value)
+	if time.Duration(atomic.AddInt64(o.filterTime, int64(time.Since(start)))) > o.filterTimeout {
+		return false, &FilterTimeoutError{Timeout: o.filterTimeout, Filter: filter.String()}
+	}
+	return matched, nil
+}
+
+// sampleTagNames returns tag names of different shapes and lengths (versions, build ids, commits, dates) to measure
+// how long a filter takes to match a tag.
+func sampleTagNames() []string {
+	names := []string{}
+	for i := 0; i < 100; i++ {
+		names = append(names,
+			fmt.Sprintf("%d.%d.%d", i%10, i%7, i),
+			fmt.Sprintf("v%d.%d.%d-rc.%d", i%3, i%10, i, i%5),
+			fmt.Sprintf("build-%08d", i*7919),
+			fmt.Sprintf("%040x", i*104729),
+			fmt.Sprintf("main-%d-%s", i, strings.Repeat("ab", 4+i%50)),
+			fmt.Sprintf("2020%02d%02d-%s", 1+i%12, 1+i%28, strings.Repeat("x", i)),
+		)
+	}
+	return names
+}
+
+// MatchCost returns the average time the filter takes to be matched against a tag name, it is used to warn about
+// filters that will be slow over repositories with many tags.
+func MatchCost(filter string) (time.Duration, error) {
+	regex, err := regexp.Compile(filter)
+	if err != nil {
+		return 0, fmt.Errorf("invalid filter %q: %w", filter, err)
+	}
+	names := sampleTagNames()
+	start := time.Now()
+	for _, name := range names {
+		regex.MatchString(name)
+	}
+	return time.Since(start) / time.Duration(len(names)), nil
+}
+
+// tagNamePrefix returns the literal prefix of every tag name the filter matches, e.g. v1. for ^v1\..*, it is empty if
+// the filter is matched against digests, is not anchored to the start of the name or does not start with a literal.
+func tagNamePrefix(filter *regexp.Regexp, matchOn string) string {
+	if matchOn == MatchOnDigest {
+		return ""
+	}
+	re, err := syntax.Parse(filter.String(), syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+	if len(subs) < 2 || subs[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	prefix := ""
+	for _, sub := range subs[1:] {
+		// A case insensitive literal matches names with other prefixes.
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+		prefix += string(sub.Rune)
+	}
+	return prefix
+}
+
+// newTagPager creates a pager that lists the tags of a repository, when the registry supports it only the tags that
+// start with the literal prefix of the filter are listed. The filter still has to be matched against every tag.
+func newTagPager(acrClient api.TagLister, repoName string, orderBy string, filter *regexp.Regexp, matchOn string) *api.TagPager {
+	tagPager := api.NewTagPager(acrClient, repoName, orderBy)
+	tagPager.FilterByPrefix(tagNamePrefix(filter, matchOn))
+	return tagPager
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFilterTimeout contains the tests for the evaluation budget of the filters and the benchmark of a filter.
+func TestFilterTimeout(t *testing.T) {
+	// First test, once the filters took longer than the timeout the listing of the tags fails with a timeout error.
+	t.Run("TimeoutTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetFilterTimeout(time.Nanosecond)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		tagPager := api.NewTagPager(mockClient, testRepo, "")
+		tagsToDelete, err := opts.getTagsToDelete(testCtx, tagPager, regexp.MustCompile("(a|b|c)*latest"), MatchOnTag, testNow, nil, nil, nil)
+		assert.Equal((*[]acr.TagAttributesBase)(nil), tagsToDelete)
+		assert.IsType(&FilterTimeoutError{}, err)
+		assert.Contains(err.Error(), "filter-timeout")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, without a timeout the same filter is evaluated.
+	t.Run("NoTimeoutTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		tagPager := api.NewTagPager(mockClient, testRepo, "")
+		tagsToDelete, err := NewOptions().getTagsToDelete(testCtx, tagPager, regexp.MustCompile("(a|b|c)*latest"), MatchOnTag, testNow, nil, nil, nil)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, len(*tagsToDelete))
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, the cost of a valid filter is measured and an invalid filter is an error.
+	t.Run("MatchCostTest", func(t *testing.T) {
+		assert := assert.New(t)
+		cost, err := MatchCost("^v[0-9]+$")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.True(cost > 0)
+		_, err = MatchCost("(v1")
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+}
+
+// TestTagNamePrefix contains the tests for the prefixes of the filters that are pushed to the registry.
+func TestTagNamePrefix(t *testing.T) {
+	assert := assert.New(t)
+	tests := []struct {
+		filter   string
+		matchOn  string
+		expected string
+	}{
+		{"^v1\\..*", MatchOnTag, "v1."},
+		{"^latest$", MatchOnTag, "latest"},
+		{"^release-[0-9]+", MatchOnTag, "release-"},
+		// Filters that are not anchored, start with a class or an alternation or ignore the case have no prefix.
+		{"v1.*", MatchOnTag, ""},
+		{"^[a-z]+", MatchOnTag, ""},
+		{"^dev|^test", MatchOnTag, ""},
+		{"(?i)^v1", MatchOnTag, ""},
+		{"^sha256:", MatchOnDigest, ""},
+	}
+	for _, test := range tests {
+		assert.Equal(test.expected, tagNamePrefix(regexp.MustCompile(test.filter), test.matchOn), test.filter)
+	}
+}
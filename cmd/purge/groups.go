@@ -0,0 +1,123 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// SetKeepPerGroup keeps the n most recently updated tags of every group of matching tags, the tags are grouped by the
+// values of the named capture groups of the filter, or of all its capture groups if none is named, e.g.
+// ^(?P<branch>.+)-\d+$ keeps n tags per branch. A filter without capture groups has a single group. 0 keeps none.
+func (o *Options) SetKeepPerGroup(n int) error {
+	if n < 0 {
+		return errors.New("the keep-per-group value cannot be negative")
+	}
+	o.keepPerGroup = n
+	return nil
+}
+
+// groupedTag is a matching tag with its update time.
+type groupedTag struct {
+	name           string
+	lastUpdateTime time.Time
+}
+
+// groupKey returns the values of the named capture groups of the filter in the match, or of all the capture groups if
+// none is named.
+func groupKey(filter *regexp.Regexp, value string) string {
+	submatches := filter.FindStringSubmatch(value)
+	if len(submatches) < 2 {
+		return ""
+	}
+	named := []string{}
+	for i, name := range filter.SubexpNames() {
+		if i > 0 && len(name) > 0 {
+			named = append(named, submatches[i])
+		}
+	}
+	if len(named) > 0 {
+		return strings.Join(named, "\x00")
+	}
+	return strings.Join(submatches[1:], "\x00")
+}
+
+// getKeptByGroup lists all the tags of a repository that match the filter and returns the names of the tags kept by
+// the keep-per-group setting, or nil if it is not set.
+func (o *Options) getKeptByGroup(ctx context.Context, acrClient api.TagLister, repoName string, filter *regexp.Regexp, matchOn string) (map[string]bool, error) {
+	if o.keepPerGroup == 0 {
+		return nil, nil
+	}
+	groups := map[string][]groupedTag{}
+	tagPager := newTagPager(acrClient, repoName, "", filter, matchOn)
+	resultTags, err := tagPager.Next(ctx)
+	if err != nil {
+		if errors.Is(err, api.ErrNotFound) {
+			// The repository not found case is reported when the tags to delete are obtained.
+			return map[string]bool{}, nil
+		}
+		return nil, err
+	}
+	for resultTags != nil && resultTags.TagsAttributes != nil {
+		for _, tag := range *resultTags.TagsAttributes {
+			matches, err := o.matchesFilter(tag, filter, matchOn)
+			if err != nil {
+				return nil, err
+			}
+			if !matches {
+				continue
+			}
+			lastUpdateTime, err := time.Parse(time.RFC3339Nano, *tag.LastUpdateTime)
+			if err != nil {
+				return nil, err
+			}
+			value := *tag.Name
+			if matchOn == MatchOnDigest {
+				value = *tag.Digest
+			}
+			key := groupKey(filter, value)
+			groups[key] = append(groups[key], groupedTag{name: *tag.Name, lastUpdateTime: lastUpdateTime})
+		}
+		resultTags, err = tagPager.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	kept := map[string]bool{}
+	for _, tags := range groups {
+		// The most recent tags come first, tags updated at the same time are ordered by name to be deterministic.
+		sort.Slice(tags, func(i, j int) bool {
+			if !tags[i].lastUpdateTime.Equal(tags[j].lastUpdateTime) {
+				return tags[i].lastUpdateTime.After(tags[j].lastUpdateTime)
+			}
+			return tags[i].name > tags[j].name
+		})
+		for i := 0; i < len(tags) && i < o.keepPerGroup; i++ {
+			kept[tags[i].name] = true
+		}
+	}
+	return kept, nil
+}
+
+// withoutKeptByGroup removes the tags kept by the keep-per-group setting, like the pages of tags a nil slice stays nil.
+func withoutKeptByGroup(tags *[]acr.TagAttributesBase, keptByGroup map[string]bool) *[]acr.TagAttributesBase {
+	if tags == nil || keptByGroup == nil {
+		return tags
+	}
+	filtered := []acr.TagAttributesBase{}
+	for _, tag := range *tags {
+		if !keptByGroup[*tag.Name] {
+			filtered = append(filtered, tag)
+		}
+	}
+	return &filtered
+}
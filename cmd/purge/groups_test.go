@@ -0,0 +1,59 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testBranchInventory has four builds of the main branch and two of the dev branch, all older than a day.
+const testBranchInventory = `now: 2020-01-15T12:00:00Z
+repositories:
+  bar:
+  - {digest: "sha:m1", lastUpdateTime: "2020-01-01T00:00:00Z", tags: [{name: main-1, expect: delete}]}
+  - {digest: "sha:m2", lastUpdateTime: "2020-01-02T00:00:00Z", tags: [{name: main-2, expect: delete}]}
+  - {digest: "sha:m3", lastUpdateTime: "2020-01-03T00:00:00Z", tags: [{name: main-3, expect: keep}]}
+  - {digest: "sha:m4", lastUpdateTime: "2020-01-04T00:00:00Z", tags: [{name: main-4, expect: keep}]}
+  - {digest: "sha:d1", lastUpdateTime: "2019-12-01T00:00:00Z", tags: [{name: dev-1, expect: keep}]}
+  - {digest: "sha:d2", lastUpdateTime: "2019-12-02T00:00:00Z", tags: [{name: dev-2, expect: keep}]}
+`
+
+// TestKeepPerGroup contains the tests for keeping the most recent tags of every capture group of the filter.
+func TestKeepPerGroup(t *testing.T) {
+	// First test, the tags are grouped by the named capture groups, or by all of them if none is named.
+	t.Run("GroupKeyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.Equal("main", groupKey(regexp.MustCompile(`^(?P<branch>.+)-(\d+)$`), "main-12"))
+		assert.Equal("main\x0012", groupKey(regexp.MustCompile(`^(.+)-(\d+)$`), "main-12"))
+		assert.Equal("", groupKey(regexp.MustCompile(`^.+-\d+$`), "main-12"))
+		assert.NotEqual(nil, opts.SetKeepPerGroup(-1), "Error should not be nil")
+	})
+	// Second test, the two most recent tags of every branch are kept even if they are older than the cutoff.
+	t.Run("KeepTest", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "groups")
+		assert.Equal(nil, err, "Error should be nil")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "inventory.yaml")
+		assert.Equal(nil, ioutil.WriteFile(path, []byte(testBranchInventory), 0600))
+		inventory, err := ReadInventory(path)
+		assert.Equal(nil, err, "Error should be nil")
+		policy := Policy{Filters: []string{`bar:^(?P<branch>.+)-\d+$`}, Ago: "1d", KeepPerGroup: 2}
+		plan, failures, err := EvaluatePolicy(testCtx, policy, inventory)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{}, failures)
+		assert.Equal(2, plan.TagCount())
+		assert.Equal(4, len(plan.Repositories[0].Kept))
+		for _, kept := range plan.Repositories[0].Kept {
+			assert.Equal(KeepReasonGroup, kept.Reason)
+		}
+	})
+}
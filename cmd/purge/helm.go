@@ -0,0 +1,214 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/pkg/acrapi"
+)
+
+// ArtifactTypeHelm restricts the purge to Helm charts.
+const ArtifactTypeHelm = "helm"
+
+// HelmChartConfigMediaType is the config media type of the manifests of Helm charts stored in a registry.
+const HelmChartConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
+
+// artifactConfigMediaTypes are the config media types of the supported artifact types.
+var artifactConfigMediaTypes = map[string]string{
+	ArtifactTypeHelm: HelmChartConfigMediaType,
+}
+
+// SetArtifactType restricts the run to the tags and manifests of an artifact type (e.g. helm), repositories often
+// mix Helm charts with images. An empty type removes the restriction.
+func (o *Options) SetArtifactType(artifactType string) error {
+	if len(artifactType) == 0 {
+		o.artifactConfigMediaType = ""
+		return nil
+	}
+	configMediaType, ok := artifactConfigMediaTypes[artifactType]
+	if !ok {
+		return fmt.Errorf("unsupported artifact type %q, the supported artifact types are %s", artifactType, ArtifactTypeHelm)
+	}
+	o.artifactConfigMediaType = configMediaType
+	return nil
+}
+
+// isArtifactType returns true if the manifest is of the artifact type the run is restricted to.
+func (o *Options) isArtifactType(manifest acr.ManifestAttributesBase) bool {
+	return len(o.artifactConfigMediaType) == 0 || (manifest.ConfigMediaType != nil && *manifest.ConfigMediaType == o.artifactConfigMediaType)
+}
+
+// artifactDigests returns the digests of the manifests of a repository that are of the artifact type the purge is
+// restricted to, it returns nil if the purge is not restricted.
+func (o *Options) artifactDigests(ctx context.Context, acrClient api.ManifestLister, repoName string) (map[string]bool, error) {
+	if len(o.artifactConfigMediaType) == 0 {
+		return nil, nil
+	}
+	digests := map[string]bool{}
+	manifests := acrapi.NewManifestIterator(acrClient, repoName, "")
+	for manifests.Next(ctx) {
+		if manifest := manifests.Manifest(); manifest.Digest != nil && o.isArtifactType(manifest) {
+			digests[*manifest.Digest] = true
+		}
+	}
+	if manifests.Err() != nil && !manifests.NotFound() {
+		return nil, manifests.Err()
+	}
+	return digests, nil
+}
+
+// ofArtifactType removes the tags that do not reference one of the digests, digests is nil if the purge is not
+// restricted to an artifact type.
+func ofArtifactType(tags *[]acr.TagAttributesBase, digests map[string]bool) *[]acr.TagAttributesBase {
+	if tags == nil || digests == nil {
+		return tags
+	}
+	filtered := []acr.TagAttributesBase{}
+	for _, tag := range *tags {
+		if digests[*tag.Digest] {
+			filtered = append(filtered, tag)
+		}
+	}
+	return &filtered
+}
+
+// ChartVersion is a version of a Helm chart. The chart is stored in a repository named after it and every version is
+// a tag, Helm replaces the + of the build metadata with _ because tags cannot contain it.
+type ChartVersion struct {
+	Chart          string `json:"chart"`
+	Version        string `json:"version"`
+	Tag            string `json:"tag"`
+	Digest         string `json:"digest"`
+	LastUpdateTime string `json:"lastUpdateTime"`
+	// Tags are all the tags that reference the digest of the version.
+	Tags []string `json:"-"`
+}
+
+// HelmChartVersions returns the versions of the Helm chart stored in a repository from the newest to the oldest by
+// semantic version, the tags that are not semantic versions are at the end sorted by name.
+func HelmChartVersions(ctx context.Context, acrClient api.ManifestLister, repoName string) ([]ChartVersion, error) {
+	versions := []ChartVersion{}
+	manifests := acrapi.NewManifestIterator(acrClient, repoName, "")
+	for manifests.Next(ctx) {
+		manifest := manifests.Manifest()
+		if manifest.Tags == nil || manifest.ConfigMediaType == nil || *manifest.ConfigMediaType != HelmChartConfigMediaType {
+			continue
+		}
+		for _, tag := range *manifest.Tags {
+			versions = append(versions, ChartVersion{
+				Chart:          path.Base(repoName),
+				Version:        strings.Replace(tag, "_", "+", -1),
+				Tag:            tag,
+				Digest:         *manifest.Digest,
+				LastUpdateTime: stringValue(manifest.LastUpdateTime),
+				Tags:           *manifest.Tags,
+			})
+		}
+	}
+	if err := manifests.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list the charts of repository %s: %w", repoName, err)
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		vi, iok := parseSemver(versions[i].Version)
+		vj, jok := parseSemver(versions[j].Version)
+		if iok != jok {
+			return iok
+		}
+		if !iok {
+			return versions[i].Version < versions[j].Version
+		}
+		return compareSemver(vi, vj) > 0
+	})
+	return versions, nil
+}
+
+// ChartVersionsToDelete returns the versions that are not among the keep newest ones. Versions that are not semantic
+// versions cannot be ordered, so they are never selected.
+func ChartVersionsToDelete(versions []ChartVersion, keep int) []ChartVersion {
+	toDelete := []ChartVersion{}
+	kept := 0
+	for _, version := range versions {
+		if _, ok := parseSemver(version.Version); !ok {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		toDelete = append(toDelete, version)
+	}
+	return toDelete
+}
+
+// semver is a parsed semantic version, the build metadata is ignored because it does not affect the precedence.
+type semver struct {
+	numbers    [3]int
+	prerelease []string
+}
+
+// parseSemver parses a MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD] version, a leading v is accepted.
+func parseSemver(version string) (semver, bool) {
+	v := semver{}
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.Index(version, "+"); i >= 0 {
+		version = version[:i]
+	}
+	if i := strings.Index(version, "-"); i >= 0 {
+		v.prerelease = strings.Split(version[i+1:], ".")
+		version = version[:i]
+	}
+	numbers := strings.Split(version, ".")
+	if len(numbers) != 3 {
+		return v, false
+	}
+	for i, number := range numbers {
+		n, err := strconv.Atoi(number)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.numbers[i] = n
+	}
+	return v, true
+}
+
+// compareSemver returns a positive number if a has a higher precedence than b, a negative one if it has a lower one
+// and 0 if they are equal, as defined by the semantic versioning specification.
+func compareSemver(a semver, b semver) int {
+	for i := range a.numbers {
+		if a.numbers[i] != b.numbers[i] {
+			return a.numbers[i] - b.numbers[i]
+		}
+	}
+	// A prerelease has a lower precedence than the release.
+	if len(a.prerelease) == 0 || len(b.prerelease) == 0 {
+		return len(b.prerelease) - len(a.prerelease)
+	}
+	for i := 0; i < len(a.prerelease) && i < len(b.prerelease); i++ {
+		if a.prerelease[i] == b.prerelease[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(a.prerelease[i])
+		bn, bErr := strconv.Atoi(b.prerelease[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			return an - bn
+		case aErr == nil:
+			// Numeric identifiers have a lower precedence than alphanumeric ones.
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			return strings.Compare(a.prerelease[i], b.prerelease[i])
+		}
+	}
+	return len(a.prerelease) - len(b.prerelease)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHelm contains the tests for the Helm chart versions and the artifact type restriction of the purge.
+func TestHelm(t *testing.T) {
+	helmConfigMediaType := HelmChartConfigMediaType
+	imageConfigMediaType := "application/vnd.docker.container.image.v1+json"
+	imageDigest := "sha:345"
+	chartsResult := &acr.Manifests{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest1,
+			ConfigMediaType:      &helmConfigMediaType,
+			Tags:                 &[]string{"1.0.0", "1.10.0-rc.1", "latest"},
+		}, {
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest2,
+			ConfigMediaType:      &helmConfigMediaType,
+			Tags:                 &[]string{"1.2.0_build.1"},
+		}, {
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &imageDigest,
+			ConfigMediaType:      &imageConfigMediaType,
+			Tags:                 &[]string{"1.9.9"},
+		}},
+	}
+	// First test, the versions of the charts are ordered by semantic version and the images are left out.
+	t.Run("ChartVersionsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.ManifestLister{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(chartsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", imageDigest).Return(EmptyListManifestsResult, nil).Once()
+		versions, err := HelmChartVersions(testCtx, mockClient, testRepo)
+		assert.Equal(nil, err, "Error should be nil")
+		names := []string{}
+		for _, version := range versions {
+			names = append(names, version.Version)
+		}
+		assert.Equal([]string{"1.10.0-rc.1", "1.2.0+build.1", "1.0.0", "latest"}, names)
+		assert.Equal("1.2.0_build.1", versions[1].Tag)
+		assert.Equal(testRepo, versions[0].Chart)
+		// The versions that are not semantic versions are never deleted to keep the newest ones.
+		toDelete := ChartVersionsToDelete(versions, 1)
+		assert.Equal(2, len(toDelete))
+		assert.Equal("1.2.0+build.1", toDelete[0].Version)
+		assert.Equal("1.0.0", toDelete[1].Version)
+		assert.Equal(0, len(ChartVersionsToDelete(versions, 3)))
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, the precedence of semantic versions.
+	t.Run("CompareSemverTest", func(t *testing.T) {
+		assert := assert.New(t)
+		ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "v1.0.1", "1.1.0", "2.0.0"}
+		for i := 1; i < len(ordered); i++ {
+			a, aok := parseSemver(ordered[i-1])
+			b, bok := parseSemver(ordered[i])
+			assert.True(aok && bok)
+			assert.True(compareSemver(a, b) < 0, "%s should be lower than %s", ordered[i-1], ordered[i])
+		}
+		for _, invalid := range []string{"latest", "1.0", "1.0.x"} {
+			_, ok := parseSemver(invalid)
+			assert.False(ok, invalid)
+		}
+	})
+	// Third test, when the purge is restricted to Helm charts only the untagged charts are deleted.
+	t.Run("ArtifactTypeTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.NotEqual(nil, opts.SetArtifactType("docker"), "Error should not be nil")
+		assert.Equal(nil, opts.SetArtifactType(ArtifactTypeHelm))
+		untaggedResult := &acr.Manifests{
+			Registry:  &testLoginURL,
+			ImageName: &testRepo,
+			ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+				LastUpdateTime:       &lastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+				Digest:               &digest1,
+				MediaType:            &dockerV2MediaType,
+				ConfigMediaType:      &helmConfigMediaType,
+			}, {
+				LastUpdateTime:       &lastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+				Digest:               &digest2,
+				MediaType:            &dockerV2MediaType,
+				ConfigMediaType:      &imageConfigMediaType,
+			}},
+		}
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(untaggedResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", digest2).Return(EmptyListManifestsResult, nil).Once()
+		manifests, err := GetManifestsToDelete(testCtx, mockClient, testRepo, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, len(*manifests))
+		assert.Equal(digest1, *(*manifests)[0].Digest)
+		mockClient.AssertExpectations(t)
+	})
+}
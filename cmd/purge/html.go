@@ -0,0 +1,233 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	units "github.com/docker/go-units"
+)
+
+// HTMLReport is a static web page of the tags and manifests a purge deleted, or would delete in a dry run, to share
+// with the people who do not read the logs. It has a table per repository and charts of the age of the deleted items
+// and of the size of the deleted images, it is made of the rows of a CSV report and needs nothing but a browser.
+type HTMLReport struct {
+	mu       sync.Mutex
+	loginURL string
+	dryRun   bool
+	rows     [][]string
+}
+
+// NewHTMLReport creates an empty report of a purge of the registry.
+func NewHTMLReport(loginURL string, dryRun bool) *HTMLReport {
+	return &HTMLReport{loginURL: loginURL, dryRun: dryRun}
+}
+
+// add adds a row of the CSV report, with its result.
+func (r *HTMLReport) add(row []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rows = append(r.rows, append([]string{}, row...))
+}
+
+// htmlAgeBuckets are the bars of the age chart, an item is in the first bucket whose maximum age is greater than its
+// age, the last bucket has no maximum.
+var htmlAgeBuckets = []struct {
+	label  string
+	maxAge time.Duration
+}{
+	{"less than a week", 7 * 24 * time.Hour},
+	{"1 week to 1 month", 30 * 24 * time.Hour},
+	{"1 to 3 months", 90 * 24 * time.Hour},
+	{"3 to 12 months", 365 * 24 * time.Hour},
+	{"more than a year", 0},
+}
+
+// htmlBar is a bar of a chart, Percent is its width relative to the longest bar.
+type htmlBar struct {
+	Label   string
+	Value   string
+	Percent int
+}
+
+// htmlRow is a deleted tag or manifest.
+type htmlRow struct {
+	Tag            string
+	Digest         string
+	MediaType      string
+	Size           string
+	LastUpdateTime string
+	Result         string
+}
+
+// htmlRepository is the table of a repository.
+type htmlRepository struct {
+	Name      string
+	Tags      int
+	Manifests int
+	Size      string
+	Rows      []htmlRow
+}
+
+// htmlReportData is what the template renders.
+type htmlReportData struct {
+	LoginURL     string
+	DryRun       bool
+	Generated    string
+	Tags         int
+	Manifests    int
+	Failed       int
+	Size         string
+	Ages         []htmlBar
+	Sizes        []htmlBar
+	Repositories []htmlRepository
+}
+
+// Render writes the page, the ages are relative to now. The size of a repository is the sum of the sizes of the
+// distinct images of its deleted tags and manifests, it is what can be reclaimed once nothing else references them.
+func (r *HTMLReport) Render(w io.Writer, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data := htmlReportData{LoginURL: r.loginURL, DryRun: r.dryRun, Generated: now.UTC().Format(time.RFC3339)}
+	ages := make([]int, len(htmlAgeBuckets))
+	repositories := map[string]*htmlRepository{}
+	sizes := map[string]int64{}
+	counted := map[string]bool{}
+	var total int64
+	for _, row := range r.rows {
+		repoName, tag, digest, mediaType, size, lastUpdateTime, result := row[0], row[1], row[2], row[3], row[4], row[5], row[6]
+		repository, ok := repositories[repoName]
+		if !ok {
+			repository = &htmlRepository{Name: repoName}
+			repositories[repoName] = repository
+		}
+		repository.Rows = append(repository.Rows, htmlRow{Tag: tag, Digest: digest, MediaType: mediaType, Size: formatHTMLSize(size), LastUpdateTime: lastUpdateTime, Result: result})
+		if result != ResultDeleted && result != ResultWouldDelete {
+			if result == ResultFailed {
+				data.Failed++
+			}
+			continue
+		}
+		if len(tag) > 0 {
+			repository.Tags++
+			data.Tags++
+		} else {
+			repository.Manifests++
+			data.Manifests++
+		}
+		if updated, err := time.Parse(time.RFC3339Nano, lastUpdateTime); err == nil {
+			ages[htmlAgeBucket(now.Sub(updated))]++
+		}
+		if bytes, err := strconv.ParseInt(size, 10, 64); err == nil && !counted[repoName+"@"+digest] {
+			counted[repoName+"@"+digest] = true
+			sizes[repoName] += bytes
+			total += bytes
+		}
+	}
+	data.Size = units.HumanSize(float64(total))
+	maxAge := 0
+	for _, count := range ages {
+		if count > maxAge {
+			maxAge = count
+		}
+	}
+	for i, bucket := range htmlAgeBuckets {
+		data.Ages = append(data.Ages, htmlBar{Label: bucket.label, Value: strconv.Itoa(ages[i]), Percent: percentOf(int64(ages[i]), int64(maxAge))})
+	}
+	repoNames := []string{}
+	for repoName := range repositories {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+	var maxSize int64
+	for _, repoName := range repoNames {
+		if sizes[repoName] > maxSize {
+			maxSize = sizes[repoName]
+		}
+	}
+	for _, repoName := range repoNames {
+		repository := repositories[repoName]
+		repository.Size = units.HumanSize(float64(sizes[repoName]))
+		data.Repositories = append(data.Repositories, *repository)
+		data.Sizes = append(data.Sizes, htmlBar{Label: repoName, Value: repository.Size, Percent: percentOf(sizes[repoName], maxSize)})
+	}
+	return htmlTemplate.Execute(w, data)
+}
+
+// htmlAgeBucket returns the index of the bucket of an age.
+func htmlAgeBucket(age time.Duration) int {
+	for i, bucket := range htmlAgeBuckets {
+		if bucket.maxAge > 0 && age < bucket.maxAge {
+			return i
+		}
+	}
+	return len(htmlAgeBuckets) - 1
+}
+
+// percentOf returns value as a percentage of max, 0 if max is 0.
+func percentOf(value int64, max int64) int {
+	if max == 0 {
+		return 0
+	}
+	return int(value * 100 / max)
+}
+
+// formatHTMLSize returns a size in bytes of the CSV report in a human readable form, or - if it is not known.
+func formatHTMLSize(size string) string {
+	bytes, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return "-"
+	}
+	return units.HumanSize(float64(bytes))
+}
+
+// htmlTemplate is the page of the report, the style is inline so that the page can be sent as a single file.
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{if .DryRun}}Dry run{{else}}Purge{{end}} report of {{.LoginURL}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; font-size: 0.9em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #f3f3f3; }
+.chart td { border: none; }
+.bar { background: #0078d4; height: 1em; min-width: 1px; }
+.failed { color: #c00; }
+code { font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>{{if .DryRun}}Dry run{{else}}Purge{{end}} report of {{.LoginURL}}</h1>
+<p>Generated at {{.Generated}}.{{if .DryRun}} Nothing was deleted, the tables contain what the purge would delete.{{end}}</p>
+<table>
+<tr><th>{{if .DryRun}}Tags to delete{{else}}Deleted tags{{end}}</th><td>{{.Tags}}</td></tr>
+<tr><th>{{if .DryRun}}Manifests to delete{{else}}Deleted manifests{{end}}</th><td>{{.Manifests}}</td></tr>
+<tr><th>Size of the images</th><td>{{.Size}}</td></tr>
+{{if .Failed}}<tr><th>Failed deletions</th><td class="failed">{{.Failed}}</td></tr>{{end}}
+</table>
+<h2>Age of the {{if .DryRun}}tags and manifests to delete{{else}}deleted tags and manifests{{end}}</h2>
+<table class="chart">
+{{range .Ages}}<tr><td>{{.Label}}</td><td style="width: 20em"><div class="bar" style="width: {{.Percent}}%"></div></td><td>{{.Value}}</td></tr>
+{{end}}</table>
+<h2>Size of the images by repository</h2>
+<table class="chart">
+{{range .Sizes}}<tr><td>{{.Label}}</td><td style="width: 20em"><div class="bar" style="width: {{.Percent}}%"></div></td><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{range .Repositories}}<h2>{{.Name}}</h2>
+<p>{{.Tags}} tags, {{.Manifests}} manifests, {{.Size}}</p>
+<table>
+<tr><th>Tag</th><th>Digest</th><th>Media type</th><th>Size</th><th>Last update time</th><th>Result</th></tr>
+{{range .Rows}}<tr><td>{{.Tag}}</td><td><code>{{.Digest}}</code></td><td>{{.MediaType}}</td><td>{{.Size}}</td><td>{{.LastUpdateTime}}</td><td{{if eq .Result "failed"}} class="failed"{{end}}>{{.Result}}</td></tr>
+{{end}}</table>
+{{else}}<p>No tags or manifests {{if $.DryRun}}would be deleted{{else}}were deleted{{end}}.</p>
+{{end}}</body>
+</html>
+`))
@@ -0,0 +1,62 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/worker"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHTMLReport contains the tests for the web page of the deleted tags and manifests.
+func TestHTMLReport(t *testing.T) {
+	// First test, the rows of the CSV report are passed to the HTML report with their result.
+	t.Run("RowsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		report, err := NewCSVReport(ioutil.Discard)
+		assert.Equal(nil, err, "Error should be nil")
+		html := NewHTMLReport(testLoginURL, false)
+		report.AddHTMLReport(html)
+		imageSize := int64(1024)
+		report.expectManifests(testRepo, []acr.ManifestAttributesBase{{Digest: &digest1, MediaType: &dockerV2MediaType, ImageSize: &imageSize, LastUpdateTime: &lastUpdateTime}})
+		report.handleResult(worker.Result{RepoName: testRepo, Digest: digest1})
+		assert.Equal([][]string{{testRepo, "", digest1, dockerV2MediaType, "1024", lastUpdateTime, ResultDeleted}}, html.rows)
+	})
+	// Second test, the page has the totals, the charts and a table per repository, the size of an image referenced by
+	// several deleted tags is counted once and the failed deletions are not counted as deleted.
+	t.Run("RenderTest", func(t *testing.T) {
+		assert := assert.New(t)
+		html := NewHTMLReport(testLoginURL, true)
+		old := testNow.AddDate(-2, 0, 0).Format("2006-01-02T15:04:05Z")
+		html.add([]string{"app", "v1", "sha:1", dockerV2MediaType, "2048", lastUpdateTime, ResultWouldDelete})
+		html.add([]string{"app", "v1-alias", "sha:1", dockerV2MediaType, "2048", lastUpdateTime, ResultWouldDelete})
+		html.add([]string{"app", "", "sha:2", dockerV2MediaType, "1024", old, ResultWouldDelete})
+		html.add([]string{"<script>", "v2", "sha:3", dockerV2MediaType, "", old, ResultFailed})
+		out := &bytes.Buffer{}
+		assert.Equal(nil, html.Render(out, testNow), "Error should be nil")
+		page := out.String()
+		assert.Contains(page, "<title>Dry run report of "+testLoginURL+"</title>")
+		assert.Contains(page, "<tr><th>Tags to delete</th><td>2</td></tr>")
+		assert.Contains(page, "<tr><th>Manifests to delete</th><td>1</td></tr>")
+		assert.Contains(page, "<tr><th>Size of the images</th><td>3.072kB</td></tr>")
+		assert.Contains(page, `<td class="failed">1</td>`)
+		assert.Contains(page, `<tr><td>less than a week</td><td style="width: 20em"><div class="bar" style="width: 100%"></div></td><td>2</td></tr>`)
+		assert.Contains(page, `<tr><td>more than a year</td><td style="width: 20em"><div class="bar" style="width: 50%"></div></td><td>1</td></tr>`)
+		assert.Contains(page, "<h2>app</h2>\n<p>2 tags, 1 manifests, 3.072kB</p>")
+		// The names are escaped.
+		assert.Contains(page, "<h2>&lt;script&gt;</h2>")
+		assert.NotContains(page, "<h2><script></h2>")
+	})
+	// Third test, a report without rows says that nothing was deleted.
+	t.Run("EmptyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		assert.Equal(nil, NewHTMLReport(testLoginURL, false).Render(out, testNow), "Error should be nil")
+		assert.Contains(out.String(), "<p>No tags or manifests were deleted.</p>")
+	})
+}
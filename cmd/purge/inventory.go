@@ -0,0 +1,318 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The expectations of an inventory entry, what the policy should do with the tag or untagged manifest.
+const (
+	ExpectDelete = "delete"
+	ExpectKeep   = "keep"
+)
+
+// Inventory is a hand written description of the tags and manifests of some repositories, it is used to test a purge
+// policy without any registry.
+type Inventory struct {
+	// Now is the time the policy is evaluated at, the current time is used if it is empty.
+	Now          string                         `json:"now,omitempty"`
+	Repositories map[string][]InventoryManifest `json:"repositories"`
+}
+
+// InventoryManifest is a manifest of an inventory with its tags.
+type InventoryManifest struct {
+	Digest          string `json:"digest"`
+	LastUpdateTime  string `json:"lastUpdateTime"`
+	MediaType       string `json:"mediaType,omitempty"`
+	ConfigMediaType string `json:"configMediaType,omitempty"`
+	// Locked manifests and tags cannot be deleted, like the ones whose deleteEnabled attribute is false.
+	Locked bool `json:"locked,omitempty"`
+	// References are the digests of the manifests of a manifest list.
+	References []string       `json:"references,omitempty"`
+	Tags       []InventoryTag `json:"tags,omitempty"`
+	// Expect is what the policy should do with the manifest when it is untagged, delete or keep.
+	Expect string `json:"expect,omitempty"`
+}
+
+// InventoryTag is a tag of an inventory, its last update time defaults to the one of its manifest.
+type InventoryTag struct {
+	Name           string `json:"name"`
+	LastUpdateTime string `json:"lastUpdateTime,omitempty"`
+	Locked         bool   `json:"locked,omitempty"`
+	// Expect is what the policy should do with the tag, delete or keep.
+	Expect string `json:"expect,omitempty"`
+}
+
+// ReadInventory reads an inventory from a YAML (or JSON) file.
+func ReadInventory(path string) (*Inventory, error) {
+	var inventory Inventory
+	if err := readYAML(path, &inventory); err != nil {
+		return nil, fmt.Errorf("failed to read inventory %s: %w", path, err)
+	}
+	if len(inventory.Now) > 0 {
+		if _, err := time.Parse(time.RFC3339, inventory.Now); err != nil {
+			return nil, fmt.Errorf("invalid inventory %s, invalid now value: %w", path, err)
+		}
+	}
+	for repoName, manifests := range inventory.Repositories {
+		for _, manifest := range manifests {
+			if len(manifest.Digest) == 0 {
+				return nil, fmt.Errorf("invalid inventory %s, a manifest of %s has no digest", path, repoName)
+			}
+			references := []string{fmt.Sprintf("%s@%s", repoName, manifest.Digest)}
+			times := []string{manifest.LastUpdateTime}
+			expects := []string{manifest.Expect}
+			for _, tag := range manifest.Tags {
+				references = append(references, fmt.Sprintf("%s:%s", repoName, tag.Name))
+				times = append(times, tag.LastUpdateTime)
+				expects = append(expects, tag.Expect)
+			}
+			for i, reference := range references {
+				if len(times[i]) > 0 {
+					if _, err := time.Parse(time.RFC3339Nano, times[i]); err != nil {
+						return nil, fmt.Errorf("invalid inventory %s, invalid last update time of %s: %w", path, reference, err)
+					}
+				}
+				if len(expects[i]) > 0 && expects[i] != ExpectDelete && expects[i] != ExpectKeep {
+					return nil, fmt.Errorf("invalid inventory %s, the expectation of %s must be %q or %q", path, reference, ExpectDelete, ExpectKeep)
+				}
+			}
+			if len(manifest.LastUpdateTime) == 0 {
+				return nil, fmt.Errorf("invalid inventory %s, %s has no last update time", path, references[0])
+			}
+		}
+	}
+	return &inventory, nil
+}
+
+// Clock returns the clock the policies are evaluated with, it is fixed to the now value of the inventory if it has
+// one.
+func (i *Inventory) Clock() Clock {
+	if now, err := time.Parse(time.RFC3339, i.Now); err == nil {
+		return FixedClock(now)
+	}
+	return SystemClock()
+}
+
+// ReadPolicy reads a purge policy from a YAML (or JSON) file, its fields are named like in a saved plan.
+func ReadPolicy(path string) (Policy, error) {
+	var policy Policy
+	if err := readYAML(path, &policy); err != nil {
+		return Policy{}, fmt.Errorf("failed to read policy %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// readYAML decodes a YAML file into a value with json field tags, unknown fields are rejected so that a typo in a
+// policy does not silently change what it deletes.
+func readYAML(path string, value interface{}) error {
+	yamlBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var document interface{}
+	if err := yaml.Unmarshal(yamlBytes, &document); err != nil {
+		return err
+	}
+	document, err = jsonValue(document)
+	if err != nil {
+		return err
+	}
+	jsonBytes, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(value)
+}
+
+// jsonValue converts the maps decoded by the YAML parser, whose keys can be of any type, to maps that can be encoded
+// to JSON.
+func jsonValue(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for key, item := range value {
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid key %v, the keys must be strings", key)
+			}
+			convertedItem, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			converted[keyString] = convertedItem
+		}
+		return converted, nil
+	case []interface{}:
+		converted := make([]interface{}, len(value))
+		for i, item := range value {
+			convertedItem, err := jsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = convertedItem
+		}
+		return converted, nil
+	}
+	return value, nil
+}
+
+// Snapshot returns a snapshot with the tags and manifests of the inventory, the purge evaluates a policy against it
+// like against a snapshot of a registry.
+func (i *Inventory) Snapshot() *api.Snapshot {
+	snapshot := &api.Snapshot{LoginURL: "inventory", CreatedTime: i.Now, Repositories: map[string]*api.RepositorySnapshot{}}
+	for repoName, manifests := range i.Repositories {
+		repoSnapshot := &api.RepositorySnapshot{
+			Tags:          []acr.TagAttributesBase{},
+			Manifests:     []acr.ManifestAttributesBase{},
+			ManifestLists: map[string][]byte{},
+		}
+		for _, inventoryManifest := range manifests {
+			inventoryManifest := inventoryManifest
+			attributes := acr.ManifestAttributesBase{
+				Digest:               &inventoryManifest.Digest,
+				LastUpdateTime:       &inventoryManifest.LastUpdateTime,
+				ChangeableAttributes: changeableAttributes(inventoryManifest.Locked),
+			}
+			// The media type defaults to an image, or to a manifest list if the manifest references other manifests.
+			if len(inventoryManifest.MediaType) == 0 {
+				inventoryManifest.MediaType = ociManifestMediaType
+				if len(inventoryManifest.References) > 0 {
+					inventoryManifest.MediaType = manifestListContentType
+				}
+			}
+			attributes.MediaType = &inventoryManifest.MediaType
+			if len(inventoryManifest.ConfigMediaType) > 0 {
+				attributes.ConfigMediaType = &inventoryManifest.ConfigMediaType
+			}
+			if len(inventoryManifest.References) > 0 {
+				manifestList := multiArchManifest{MediaType: inventoryManifest.MediaType, SchemaVersion: 2}
+				for _, reference := range inventoryManifest.References {
+					manifestList.Manifests = append(manifestList.Manifests, manifest{Digest: reference})
+				}
+				// The manifest list only contains strings, it cannot fail to be encoded.
+				repoSnapshot.ManifestLists[inventoryManifest.Digest], _ = json.Marshal(manifestList)
+			}
+			tagNames := []string{}
+			for _, inventoryTag := range inventoryManifest.Tags {
+				inventoryTag := inventoryTag
+				if len(inventoryTag.LastUpdateTime) == 0 {
+					inventoryTag.LastUpdateTime = inventoryManifest.LastUpdateTime
+				}
+				repoSnapshot.Tags = append(repoSnapshot.Tags, acr.TagAttributesBase{
+					Name:                 &inventoryTag.Name,
+					Digest:               &inventoryManifest.Digest,
+					LastUpdateTime:       &inventoryTag.LastUpdateTime,
+					ChangeableAttributes: changeableAttributes(inventoryTag.Locked),
+				})
+				tagNames = append(tagNames, inventoryTag.Name)
+			}
+			if len(tagNames) > 0 {
+				attributes.Tags = &tagNames
+			}
+			repoSnapshot.Manifests = append(repoSnapshot.Manifests, attributes)
+		}
+		// The registry lists the tags by name and the manifests by digest.
+		sort.Slice(repoSnapshot.Tags, func(i, j int) bool {
+			return *repoSnapshot.Tags[i].Name < *repoSnapshot.Tags[j].Name
+		})
+		sort.Slice(repoSnapshot.Manifests, func(i, j int) bool {
+			return *repoSnapshot.Manifests[i].Digest < *repoSnapshot.Manifests[j].Digest
+		})
+		snapshot.Repositories[repoName] = repoSnapshot
+	}
+	return snapshot
+}
+
+// changeableAttributes returns the attributes of a tag or manifest that can or cannot be deleted.
+func changeableAttributes(locked bool) *acr.ChangeableAttributes {
+	deleteEnabled := !locked
+	return &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled}
+}
+
+// Check compares the plan of a policy with the expectations of the inventory, it returns a message for every tag or
+// manifest the plan does not treat as expected.
+func (i *Inventory) Check(plan *Plan) []string {
+	deleted := map[string]bool{}
+	for _, repoPlan := range plan.Repositories {
+		for _, tag := range repoPlan.Tags {
+			deleted[fmt.Sprintf("%s:%s", repoPlan.Name, *tag.Name)] = true
+		}
+		for _, manifest := range repoPlan.Manifests {
+			deleted[fmt.Sprintf("%s@%s", repoPlan.Name, *manifest.Digest)] = true
+		}
+	}
+	failures := []string{}
+	check := func(reference string, expect string) {
+		switch {
+		case expect == ExpectDelete && !deleted[reference]:
+			failures = append(failures, fmt.Sprintf("%s is expected to be deleted but is kept", reference))
+		case expect == ExpectKeep && deleted[reference]:
+			failures = append(failures, fmt.Sprintf("%s is expected to be kept but is deleted", reference))
+		}
+	}
+	for repoName, manifests := range i.Repositories {
+		for _, manifest := range manifests {
+			check(fmt.Sprintf("%s@%s", repoName, manifest.Digest), manifest.Expect)
+			for _, tag := range manifest.Tags {
+				check(fmt.Sprintf("%s:%s", repoName, tag.Name), tag.Expect)
+			}
+		}
+	}
+	sort.Strings(failures)
+	return failures
+}
+
+// offlinePolicyError returns an error if the policy needs data an inventory does not contain, e.g. the labels of the
+// images or their signatures.
+func offlinePolicyError(policy Policy) error {
+	unsupported := []string{}
+	if len(policy.ExcludeLabels) > 0 {
+		unsupported = append(unsupported, "excludeLabels")
+	}
+	if len(policy.Signatures) > 0 {
+		unsupported = append(unsupported, "signatures")
+	}
+	if len(policy.PushedBy) > 0 {
+		unsupported = append(unsupported, "pushedBy")
+	}
+	if len(policy.KeepIfPresentIn) > 0 {
+		unsupported = append(unsupported, "keepIfPresentIn")
+	}
+	if policy.IncludeReferrers {
+		unsupported = append(unsupported, "includeReferrers")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("the policy cannot be tested against an inventory because it uses %s, which need the registry", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// EvaluatePolicy evaluates a policy against an inventory, it returns the plan of the policy and the expectations of
+// the inventory that are not met.
+func EvaluatePolicy(ctx context.Context, policy Policy, inventory *Inventory) (*Plan, []string, error) {
+	if err := offlinePolicyError(policy); err != nil {
+		return nil, nil, err
+	}
+	// The tags of an inventory are listed by name, like the tags of a snapshot, so the options keep the default order.
+	plan, err := NewPlan(ctx, api.NewSnapshotClient(inventory.Snapshot()), inventory.Clock(), "inventory", policy, NewOptions())
+	if err != nil {
+		return nil, nil, err
+	}
+	return plan, inventory.Check(plan), nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testInventory has an expired tag, a recent tag, a manifest list that keeps its image and untagged manifests.
+const testInventory = `now: 2020-01-15T12:00:00Z
+repositories:
+  bar:
+  - digest: sha:old
+    lastUpdateTime: 2019-11-01T00:00:00Z
+    tags:
+    - name: v1
+      expect: delete
+  - digest: sha:new
+    lastUpdateTime: "2020-01-14T00:00:00Z"
+    tags:
+    - name: v2
+      expect: keep
+    - name: v0
+      lastUpdateTime: "2019-01-01T00:00:00Z"
+      locked: true
+      expect: keep
+  - digest: sha:list
+    lastUpdateTime: "2019-01-01T00:00:00Z"
+    references: [sha:image]
+    tags:
+    - name: latest
+  - digest: sha:image
+    lastUpdateTime: "2019-01-01T00:00:00Z"
+    expect: keep
+  - digest: sha:untagged
+    lastUpdateTime: "2019-01-01T00:00:00Z"
+    expect: delete
+`
+
+// TestInventory contains the tests for the evaluation of policies against an inventory.
+func TestInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	inventoryPath := write("inventory.yaml", testInventory)
+	// First test, the plan of the policy meets every expectation of the inventory.
+	t.Run("ExpectationsMetTest", func(t *testing.T) {
+		assert := assert.New(t)
+		policy, err := ReadPolicy(write("policy.yaml", "filters: [\"bar:^v.*\"]\nago: 30d\nuntagged: true\n"))
+		assert.Equal(nil, err, "Error should be nil")
+		inventory, err := ReadInventory(inventoryPath)
+		assert.Equal(nil, err, "Error should be nil")
+		plan, failures, err := EvaluatePolicy(testCtx, policy, inventory)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{}, failures)
+		assert.Equal(1, plan.TagCount())
+		assert.Equal(2, plan.ManifestCount())
+		assert.Equal("sha:old", *plan.Repositories[0].Manifests[0].Digest)
+		assert.Equal("sha:untagged", *plan.Repositories[0].Manifests[1].Digest)
+	})
+	// Second test, the expectations the plan does not meet are returned.
+	t.Run("ExpectationsNotMetTest", func(t *testing.T) {
+		assert := assert.New(t)
+		inventory, err := ReadInventory(inventoryPath)
+		assert.Equal(nil, err, "Error should be nil")
+		_, failures, err := EvaluatePolicy(testCtx, Policy{Filters: []string{"bar:.*"}, Ago: "0d"}, inventory)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{
+			"bar:v2 is expected to be kept but is deleted",
+			"bar@sha:untagged is expected to be deleted but is kept",
+		}, failures)
+	})
+	// Third test, invalid files and policies that need the registry should return an error.
+	t.Run("InvalidTest", func(t *testing.T) {
+		assert := assert.New(t)
+		_, err := ReadPolicy(write("typo.yaml", "filter: [\"bar:.*\"]\n"))
+		assert.NotEqual(nil, err, "Error should not be nil")
+		_, err = ReadInventory(write("expect.yaml", "repositories:\n  bar:\n  - digest: sha:a\n    lastUpdateTime: \"2019-01-01T00:00:00Z\"\n    expect: maybe\n"))
+		assert.NotEqual(nil, err, "Error should not be nil")
+		_, err = ReadInventory(write("time.yaml", "repositories:\n  bar:\n  - digest: sha:a\n"))
+		assert.NotEqual(nil, err, "Error should not be nil")
+		inventory, err := ReadInventory(inventoryPath)
+		assert.Equal(nil, err, "Error should be nil")
+		_, _, err = EvaluatePolicy(testCtx, Policy{Filters: []string{"bar:.*"}, Ago: "0d", Signatures: SignaturesProtect}, inventory)
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// The config media types of the images whose labels are read, the configs of other artifacts have no labels.
+const (
+	dockerImageConfigMediaType = "application/vnd.docker.container.image.v1+json"
+	ociImageConfigMediaType    = "application/vnd.oci.image.config.v1+json"
+)
+
+// labelSelector matches a label of an image config, any value matches if anyValue is set.
+type labelSelector struct {
+	key      string
+	value    string
+	anyValue bool
+}
+
+// SetExcludeLabels keeps the images whose config contains one of the labels, either as key=value or as a key that
+// matches any value, from being purged. A manifest list is kept if any of its images is. Nil removes the exclusion.
+func (o *Options) SetExcludeLabels(labels []string) error {
+	selectors := []labelSelector{}
+	for _, label := range labels {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts[0]) == 0 {
+			return fmt.Errorf("invalid exclude label %q, expected key=value or key", label)
+		}
+		if len(parts) == 1 {
+			selectors = append(selectors, labelSelector{key: parts[0], anyValue: true})
+		} else {
+			selectors = append(selectors, labelSelector{key: parts[0], value: parts[1]})
+		}
+	}
+	if len(selectors) == 0 {
+		selectors = nil
+	}
+	o.excludeLabels = selectors
+	o.excludedDigests = newDigestCache()
+	return nil
+}
+
+// matchesLabels returns true if one of the labels matches an excluded label.
+func (o *Options) matchesLabels(labels map[string]string) bool {
+	for _, selector := range o.excludeLabels {
+		if value, ok := labels[selector.key]; ok && (selector.anyValue || value == selector.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasExcludedLabel returns true if the image referenced by the digest, or any image of the manifest list, has one of
+// the excluded labels.
+func (o *Options) hasExcludedLabel(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digest string) (bool, error) {
+	if o.excludeLabels == nil {
+		return false, nil
+	}
+	excluded, ok := o.excludedDigests.get(digest)
+	if ok {
+		return excluded, nil
+	}
+	manifestBytes, err := acrClient.GetManifest(ctx, repoName, digest)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch %s@%s to read its labels: %w", repoName, digest, err)
+	}
+	var parsed struct {
+		Config struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+		} `json:"config"`
+		Manifests []manifest `json:"manifests"`
+	}
+	if err := json.Unmarshal(manifestBytes, &parsed); err != nil {
+		return false, fmt.Errorf("failed to parse %s@%s: %w", repoName, digest, err)
+	}
+	for _, child := range parsed.Manifests {
+		if excluded, err = o.hasExcludedLabel(ctx, acrClient, repoName, child.Digest); err != nil || excluded {
+			break
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+	if !excluded && (parsed.Config.MediaType == dockerImageConfigMediaType || parsed.Config.MediaType == ociImageConfigMediaType) {
+		configBytes, err := acrClient.GetBlob(ctx, repoName, parsed.Config.Digest)
+		if err != nil {
+			return false, fmt.Errorf("failed to fetch the config of %s@%s to read its labels: %w", repoName, digest, err)
+		}
+		var config struct {
+			Config struct {
+				Labels map[string]string `json:"Labels"`
+			} `json:"config"`
+		}
+		if err := json.Unmarshal(configBytes, &config); err != nil {
+			return false, fmt.Errorf("failed to parse the config of %s@%s: %w", repoName, digest, err)
+		}
+		excluded = o.matchesLabels(config.Config.Labels)
+	}
+	o.excludedDigests.set(digest, excluded)
+	return excluded, nil
+}
+
+// withoutExcludedLabels removes the tags whose image has one of the excluded labels, like the pages of tags a nil
+// slice stays nil.
+func (o *Options) withoutExcludedLabels(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, tags *[]acr.TagAttributesBase) (*[]acr.TagAttributesBase, error) {
+	if tags == nil || o.excludeLabels == nil {
+		return tags, nil
+	}
+	filtered := []acr.TagAttributesBase{}
+	for _, tag := range *tags {
+		excluded, err := o.hasExcludedLabel(ctx, acrClient, repoName, *tag.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
+			filtered = append(filtered, tag)
+		}
+	}
+	return &filtered, nil
+}
+
+// withoutExcludedManifests removes the untagged manifests that have one of the excluded labels.
+func (o *Options) withoutExcludedManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, manifests []acr.ManifestAttributesBase) ([]acr.ManifestAttributesBase, error) {
+	if o.excludeLabels == nil {
+		return manifests, nil
+	}
+	filtered := []acr.ManifestAttributesBase{}
+	for _, manifest := range manifests {
+		excluded, err := o.hasExcludedLabel(ctx, acrClient, repoName, *manifest.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
+			filtered = append(filtered, manifest)
+		}
+	}
+	return filtered, nil
+}
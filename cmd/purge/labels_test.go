@@ -0,0 +1,59 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExcludeLabels contains the tests for the exclusion of the images that have a label.
+func TestExcludeLabels(t *testing.T) {
+	// First test, labels without a key are rejected.
+	t.Run("InvalidLabelTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.NotEqual(nil, opts.SetExcludeLabels([]string{"=true"}), "Error should not be nil")
+		assert.Equal(nil, opts.SetExcludeLabels([]string{"retain"}), "Error should be nil")
+		assert.Equal(nil, opts.SetExcludeLabels(nil), "Error should be nil")
+	})
+	// Second test, the tags of the image with the label are kept and its config is only fetched once even if three
+	// tags reference it, the manifest list is deleted because none of its images has the label.
+	t.Run("KeptTagDryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.Equal(nil, opts.SetExcludeLabels([]string{"retain=true", "owner"}))
+		image := []byte(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.docker.container.image.v1+json","digest":"sha:config"}}`)
+		otherImage := []byte(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha:config1"}}`)
+		index := []byte(`{"schemaVersion":2,"manifests":[{"digest":"sha:123"}]}`)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, digest).Return(image, nil).Once()
+		mockClient.On("GetBlob", testCtx, testRepo, "sha:config").Return([]byte(`{"config":{"Labels":{"retain":"true"}}}`), nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, multiArchDigest).Return(index, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, digest1).Return(otherImage, nil).Once()
+		mockClient.On("GetBlob", testCtx, testRepo, "sha:config1").Return([]byte(`{"config":{"Labels":{"retain":"false"}}}`), nil).Once()
+		repoPlan, err := DryRunPlan(testCtx, mockClient, testClock, testRepo, Cutoff{Ago: "0m"}, "[\\s\\S]*", MatchOnTag, false, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, len(repoPlan.Tags))
+		assert.Equal(multiArchDigest, *repoPlan.Tags[0].Digest)
+		assert.Equal(3, len(repoPlan.Kept))
+		for _, kept := range repoPlan.Kept {
+			assert.Equal(KeepReasonLabel, kept.Reason)
+		}
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, a label without a value matches any value.
+	t.Run("AnyValueTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.Equal(nil, opts.SetExcludeLabels([]string{"owner"}))
+		assert.True(opts.matchesLabels(map[string]string{"owner": "team"}))
+		assert.False(opts.matchesLabels(map[string]string{"retain": "true"}))
+		assert.False(opts.matchesLabels(nil))
+	})
+}
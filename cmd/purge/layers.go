@@ -0,0 +1,156 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// LayerEstimate is the layer storage that only the manifests of a plan reference, it becomes garbage-collectable once
+// they are deleted. The config of an image is counted as one of its layers.
+type LayerEstimate struct {
+	// CandidateManifests are the manifests of the plan, CandidateLayers and CandidateBytes the distinct layers they
+	// reference.
+	CandidateManifests int   `json:"candidateManifests"`
+	CandidateLayers    int   `json:"candidateLayers"`
+	CandidateBytes     int64 `json:"candidateBytes"`
+	// OrphanedLayers and OrphanedBytes are the layers of the candidates that no other manifest of the registry
+	// references.
+	OrphanedLayers int   `json:"orphanedLayers"`
+	OrphanedBytes  int64 `json:"orphanedBytes"`
+	// ScannedManifests are the manifests of the registry that were read to know their layers.
+	ScannedManifests int                       `json:"scannedManifests"`
+	Repositories     []RepositoryLayerEstimate `json:"repositories"`
+}
+
+// RepositoryLayerEstimate is the part of a LayerEstimate of a single repository, a layer that is only referenced by
+// the candidates of several repositories is counted in each of them.
+type RepositoryLayerEstimate struct {
+	Name               string `json:"name"`
+	CandidateManifests int    `json:"candidateManifests"`
+	OrphanedLayers     int    `json:"orphanedLayers"`
+	OrphanedBytes      int64  `json:"orphanedBytes"`
+}
+
+// layersManifest contains the layers of an image manifest, a manifest list has none.
+type layersManifest struct {
+	Config descriptor   `json:"config"`
+	Layers []descriptor `json:"layers"`
+}
+
+// EstimateOrphanedLayers reads the manifests of every repository of the registry and returns the layers that are only
+// referenced by the manifests of the plan. The registry stores a layer once for all its repositories, so the manifests
+// of every repository are read, and every digest is only read once. Nothing is deleted.
+func EstimateOrphanedLayers(ctx context.Context, acrClient api.AcrCLIClientInterface, plan *Plan) (*LayerEstimate, error) {
+	estimate := &LayerEstimate{Repositories: []RepositoryLayerEstimate{}}
+	candidates := map[string]map[string]bool{}
+	for _, repoPlan := range plan.Repositories {
+		if len(repoPlan.Manifests) == 0 {
+			continue
+		}
+		candidates[repoPlan.Name] = map[string]bool{}
+		for _, manifest := range repoPlan.Manifests {
+			candidates[repoPlan.Name][*manifest.Digest] = true
+		}
+	}
+	repoNames, err := listCatalog(ctx, acrClient)
+	if err != nil {
+		return nil, err
+	}
+	// The layers of every digest are kept, the same image is often pushed to several repositories.
+	digestLayers := map[string][]descriptor{}
+	surviving := map[string]bool{}
+	candidateLayers := map[string]map[string]int64{}
+	for _, repoName := range repoNames {
+		manifestPager := api.NewManifestPager(acrClient, repoName, "")
+		resultManifests, err := manifestPager.Next(ctx)
+		if err != nil {
+			if errors.Is(err, api.ErrNotFound) {
+				// The repository was deleted after the catalog was listed.
+				continue
+			}
+			return nil, fmt.Errorf("failed to list manifests of %s: %w", repoName, err)
+		}
+		for resultManifests != nil && resultManifests.ManifestsAttributes != nil {
+			for _, manifest := range *resultManifests.ManifestsAttributes {
+				layers, ok := digestLayers[*manifest.Digest]
+				if !ok {
+					layers, err = getLayers(ctx, acrClient, repoName, *manifest.Digest)
+					if err != nil {
+						return nil, err
+					}
+					digestLayers[*manifest.Digest] = layers
+					estimate.ScannedManifests++
+				}
+				if !candidates[repoName][*manifest.Digest] {
+					for _, layer := range layers {
+						surviving[layer.Digest] = true
+					}
+					continue
+				}
+				if _, ok := candidateLayers[repoName]; !ok {
+					candidateLayers[repoName] = map[string]int64{}
+				}
+				for _, layer := range layers {
+					candidateLayers[repoName][layer.Digest] = layer.Size
+				}
+			}
+			resultManifests, err = manifestPager.Next(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list manifests of %s: %w", repoName, err)
+			}
+		}
+	}
+	allCandidateLayers := map[string]int64{}
+	for repoName, layers := range candidateLayers {
+		repoEstimate := RepositoryLayerEstimate{Name: repoName, CandidateManifests: len(candidates[repoName])}
+		for digest, size := range layers {
+			allCandidateLayers[digest] = size
+			if !surviving[digest] {
+				repoEstimate.OrphanedLayers++
+				repoEstimate.OrphanedBytes += size
+			}
+		}
+		estimate.CandidateManifests += repoEstimate.CandidateManifests
+		estimate.Repositories = append(estimate.Repositories, repoEstimate)
+	}
+	for digest, size := range allCandidateLayers {
+		estimate.CandidateLayers++
+		estimate.CandidateBytes += size
+		if !surviving[digest] {
+			estimate.OrphanedLayers++
+			estimate.OrphanedBytes += size
+		}
+	}
+	sort.Slice(estimate.Repositories, func(i, j int) bool {
+		if estimate.Repositories[i].OrphanedBytes != estimate.Repositories[j].OrphanedBytes {
+			return estimate.Repositories[i].OrphanedBytes > estimate.Repositories[j].OrphanedBytes
+		}
+		return estimate.Repositories[i].Name < estimate.Repositories[j].Name
+	})
+	return estimate, nil
+}
+
+// getLayers returns the config and the layers of a manifest, a manifest list has none.
+func getLayers(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digest string) ([]descriptor, error) {
+	manifestBytes, err := acrClient.GetManifest(ctx, repoName, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s@%s: %w", repoName, digest, err)
+	}
+	var manifest layersManifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s@%s: %w", repoName, digest, err)
+	}
+	layers := manifest.Layers
+	if len(manifest.Config.Digest) > 0 {
+		layers = append(layers, manifest.Config)
+	}
+	return layers, nil
+}
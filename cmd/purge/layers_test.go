@@ -0,0 +1,96 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestEstimateOrphanedLayers contains the tests for the estimate of the layers only referenced by the candidates.
+func TestEstimateOrphanedLayers(t *testing.T) {
+	// imageBytes returns the manifest of an image with a config of 1 byte and layers of the given sizes.
+	imageBytes := func(config string, layers map[string]int64) []byte {
+		body := fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":%q,"size":1},"layers":[`, config)
+		first := true
+		for layer, size := range layers {
+			if !first {
+				body += ","
+			}
+			first = false
+			body += fmt.Sprintf(`{"digest":%q,"size":%d}`, layer, size)
+		}
+		return []byte(body + "]}")
+	}
+	// manifestsResult returns a page of manifests with the given digests.
+	manifestsResult := func(digests ...string) *acr.Manifests {
+		manifests := []acr.ManifestAttributesBase{}
+		for i := range digests {
+			manifests = append(manifests, acr.ManifestAttributesBase{Digest: &digests[i]})
+		}
+		return &acr.Manifests{ManifestsAttributes: &manifests}
+	}
+	candidate := "sha256:1"
+	plan := &Plan{Repositories: []RepositoryPlan{{Name: "a", Manifests: []acr.ManifestAttributesBase{{Digest: &candidate}}}}}
+	// First test, the layers of the candidate that no other manifest of the registry references are orphaned.
+	t.Run("OrphanedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositories", testCtx, "").Return(&acr.Repositories{Names: &[]string{"a", "b"}}, nil).Once()
+		mockClient.On("GetAcrRepositories", testCtx, "b").Return(&acr.Repositories{}, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "a", "", "").Return(manifestsResult("sha256:1", "sha256:2"), nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "a", "", "sha256:2").Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "b", "", "").Return(manifestsResult("sha256:3"), nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "b", "", "sha256:3").Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, "a", "sha256:1").Return(imageBytes("sha256:c1", map[string]int64{"sha256:l1": 10, "sha256:l2": 20}), nil).Once()
+		mockClient.On("GetManifest", testCtx, "a", "sha256:2").Return(imageBytes("sha256:c2", map[string]int64{"sha256:l2": 20}), nil).Once()
+		mockClient.On("GetManifest", testCtx, "b", "sha256:3").Return(imageBytes("sha256:c2", map[string]int64{"sha256:l3": 5}), nil).Once()
+		estimate, err := EstimateOrphanedLayers(testCtx, mockClient, plan)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, estimate.CandidateManifests)
+		assert.Equal(3, estimate.CandidateLayers)
+		assert.Equal(int64(31), estimate.CandidateBytes)
+		assert.Equal(2, estimate.OrphanedLayers)
+		assert.Equal(int64(11), estimate.OrphanedBytes)
+		assert.Equal(3, estimate.ScannedManifests)
+		assert.Equal([]RepositoryLayerEstimate{{Name: "a", CandidateManifests: 1, OrphanedLayers: 2, OrphanedBytes: 11}}, estimate.Repositories)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, a candidate that is kept in another repository orphans nothing and is only read once.
+	t.Run("SharedDigestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositories", testCtx, "").Return(&acr.Repositories{Names: &[]string{"a", "b"}}, nil).Once()
+		mockClient.On("GetAcrRepositories", testCtx, "b").Return(&acr.Repositories{}, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "a", "", "").Return(manifestsResult("sha256:1"), nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "a", "", "sha256:1").Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "b", "", "").Return(manifestsResult("sha256:1"), nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "b", "", "sha256:1").Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, "a", "sha256:1").Return(imageBytes("sha256:c1", map[string]int64{"sha256:l1": 10}), nil).Once()
+		estimate, err := EstimateOrphanedLayers(testCtx, mockClient, plan)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, estimate.CandidateLayers)
+		assert.Equal(0, estimate.OrphanedLayers)
+		assert.Equal(int64(0), estimate.OrphanedBytes)
+		assert.Equal(1, estimate.ScannedManifests)
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, if a manifest cannot be read an error should be returned.
+	t.Run("GetManifestErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositories", testCtx, "").Return(&acr.Repositories{Names: &[]string{"a"}}, nil).Once()
+		mockClient.On("GetAcrRepositories", testCtx, "a").Return(&acr.Repositories{}, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, "a", "", "").Return(manifestsResult("sha256:1"), nil).Once()
+		mockClient.On("GetManifest", testCtx, "a", "sha256:1").Return(nil, errors.New("unauthorized")).Once()
+		_, err := EstimateOrphanedLayers(testCtx, mockClient, plan)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,69 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/acr-cli/cmd/worker"
+)
+
+// ErrMaxDeletes is returned once the number of deletions set with SetMaxDeletes has been queued and there were
+// more tags or manifests to delete, the purge stops without queueing them.
+var ErrMaxDeletes = errors.New("the maximum number of deletions was reached")
+
+// deleteLimit contains the maximum number of tags and manifests a run deletes, it is 0 unless SetMaxDeletes is
+// called, and the number of tags and manifests queued for deletion since SetMaxDeletes was called. The repositories
+// can be purged at the same time, so they are guarded by the mutex.
+type deleteLimit struct {
+	sync.Mutex
+	maxDeletes    int
+	queuedDeletes int
+}
+
+// SetMaxDeletes limits the number of tags and manifests the run deletes, it protects a registry against a filter
+// that matches much more than expected. A limit of 0 disables it.
+func (o *Options) SetMaxDeletes(limit int) {
+	o.limit.Lock()
+	defer o.limit.Unlock()
+	o.limit.maxDeletes = limit
+	o.limit.queuedDeletes = 0
+}
+
+// QueuedDeletes returns the number of tags and manifests queued for deletion since SetMaxDeletes was called.
+func (o *Options) QueuedDeletes() int {
+	o.limit.Lock()
+	defer o.limit.Unlock()
+	return o.limit.queuedDeletes
+}
+
+// allowDeletes returns how many of count deletions can still be queued and counts them as queued.
+func (o *Options) allowDeletes(count int) int {
+	o.limit.Lock()
+	defer o.limit.Unlock()
+	if o.limit.maxDeletes <= 0 {
+		return count
+	}
+	if allowed := o.limit.maxDeletes - o.limit.queuedDeletes; count > allowed {
+		count = allowed
+	}
+	o.limit.queuedDeletes += count
+	return count
+}
+
+// maxDeletesError returns the error of a purge that stopped with notDeleted candidates of the repository left.
+func (o *Options) maxDeletesError(repoName string, notDeleted int) error {
+	return fmt.Errorf("%w: %d deletions were queued, %d more tags or manifests of %s matched and were not deleted", ErrMaxDeletes, o.QueuedDeletes(), notDeleted, repoName)
+}
+
+// waitForLimitedWorkers waits for the queued jobs like waitForWorkers, if they succeed but notDeleted tags or manifests
+// were not queued because of the maximum number of deletions ErrMaxDeletes is returned.
+func (o *Options) waitForLimitedWorkers(batch *worker.Batch, repoName string, notDeleted int, summary *Summary) error {
+	if err := waitForWorkers(batch, summary); err != nil || notDeleted == 0 {
+		return err
+	}
+	return o.maxDeletesError(repoName, notDeleted)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMaxDeletes contains the tests for the maximum number of deletions of a purge.
+func TestMaxDeletes(t *testing.T) {
+	// First test, the tags after the maximum are not deleted and the next page is not listed.
+	t.Run("TagsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetMaxDeletes(3)
+		mockClient := mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, &mockClient, 6)
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(FourTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "latest").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v1").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v2").Return(&deletedResponse, nil).Once()
+		summary, err := Tags(testCtx, &mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "[\\s\\S]*", MatchOnTag, false, opts)
+		StopDispatcher()
+		assert.Equal(3, summary.Deleted, "Number of deleted elements should be 3")
+		assert.True(errors.Is(err, ErrMaxDeletes), "Error should be ErrMaxDeletes")
+		assert.Equal(3, opts.QueuedDeletes())
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, once the maximum is reached no manifest is deleted.
+	t.Run("ManifestsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetMaxDeletes(1)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, mockClient, 6)
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Twice()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:abc").Return(doubleManifestV2WithoutTagsResult, nil).Twice()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Twice()
+		mockClient.On("DeleteManifest", workerCtx, testRepo, "sha:123").Return(nil, nil).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, opts)
+		assert.Equal(1, summary.Deleted, "Number of deleted elements should be 1")
+		assert.True(errors.Is(err, ErrMaxDeletes), "Error should be ErrMaxDeletes")
+		summary, err = DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, opts)
+		StopDispatcher()
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.True(errors.Is(err, ErrMaxDeletes), "Error should be ErrMaxDeletes")
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, a purge that deletes exactly the maximum finishes without an error.
+	t.Run("ExactlyMaxTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetMaxDeletes(1)
+		mockClient := mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, &mockClient, 6)
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "latest").Return(&deletedResponse, nil).Once()
+		summary, err := Tags(testCtx, &mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, opts)
+		StopDispatcher()
+		assert.Equal(1, summary.Deleted, "Number of deleted elements should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
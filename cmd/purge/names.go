@@ -0,0 +1,65 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// The grammar of the repository and tag names of the OCI distribution specification.
+var (
+	repositoryNameRegex = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*(/[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*)*$`)
+	tagNameRegex        = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+)
+
+// ValidateRepositoryName returns an error that explains why the name is not a valid repository name.
+func ValidateRepositoryName(name string) error {
+	if err := checkASCII(name); err != nil {
+		return err
+	}
+	if !repositoryNameRegex.MatchString(name) {
+		return errors.New("repository names are made of lowercase letters, digits and the separators '.', '_', '__', '-' and '/'")
+	}
+	return nil
+}
+
+// ValidateTagName returns an error that explains why the name is not a valid tag name.
+func ValidateTagName(name string) error {
+	if err := checkASCII(name); err != nil {
+		return err
+	}
+	if len(name) > 128 {
+		return fmt.Errorf("tag names have at most 128 characters, this one has %d", len(name))
+	}
+	if !tagNameRegex.MatchString(name) {
+		return errors.New("tag names are made of letters, digits, '_', '.' and '-' and cannot start with '.' or '-'")
+	}
+	return nil
+}
+
+// checkASCII returns an error if the name contains bytes that are not ASCII. Such names usually contain characters
+// that look like ASCII ones (e.g. a cyrillic 'е'), filters are matched against the exact bytes of the names without any
+// normalization or case folding so these names are not matched by filters written with the ASCII characters.
+func checkASCII(name string) error {
+	if !utf8.ValidString(name) {
+		return errors.New("the name is not valid UTF-8")
+	}
+	for i, r := range name {
+		if r >= utf8.RuneSelf {
+			return fmt.Errorf("the name contains the non-ASCII character %U at byte %d", r, i)
+		}
+	}
+	return nil
+}
+
+// warnUnexpectedTagName writes a warning if a tag of the repository does not follow the tag name grammar. The name is
+// quoted with only ASCII characters so that look-alike characters can be told apart.
+func (o *Options) warnUnexpectedTagName(repoName string, tagName string) {
+	if err := ValidateTagName(tagName); err != nil {
+		o.warnf("tag %+q of repository %s is not a valid tag name: %v\n", tagName, repoName, err)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNames contains the tests for the validation of the repository and tag names.
+func TestNames(t *testing.T) {
+	// First test, the names of the OCI distribution grammar are valid and the others are reported with the reason.
+	t.Run("ValidateTest", func(t *testing.T) {
+		assert := assert.New(t)
+		for _, name := range []string{"bar", "foo/bar", "foo-bar/b.a__r", "a--b/c_d"} {
+			assert.Equal(nil, ValidateRepositoryName(name), name)
+		}
+		for _, name := range []string{"Bar", "foo//bar", "-bar", "bar-", "fоo"} {
+			assert.NotEqual(nil, ValidateRepositoryName(name), name)
+		}
+		for _, name := range []string{"latest", "v1.0.0-rc.1", "_build", "A1"} {
+			assert.Equal(nil, ValidateTagName(name), name)
+		}
+		for _, name := range []string{"", ".hidden", "-v1", "v1+build", string(make([]byte, 129)), "latеst", "v1\xff"} {
+			assert.NotEqual(nil, ValidateTagName(name), name)
+		}
+		assert.Contains(ValidateTagName("latеst").Error(), "U+0435")
+	})
+	// Second test, a filter on an invalid repository name is accepted with a warning.
+	t.Run("FilterWarningTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		opts := NewOptions()
+		opts.SetWarningsOutput(out)
+		tagFilters, err := opts.GetTagFilters([]string{"Foo:.*", "Foo:v1", "bar:.*"}, MatchOnTag)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(".*|v1", tagFilters["Foo"])
+		assert.Equal(1, bytes.Count(out.Bytes(), []byte("Warning")))
+		assert.Contains(out.String(), `"Foo" in filter "Foo:.*" is not a valid repository name`)
+	})
+	// Third test, a tag with a look-alike character is reported and not matched by a filter written in ASCII.
+	t.Run("LookAlikeTagTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		opts := NewOptions()
+		opts.SetWarningsOutput(out)
+		lookAlike := "latеst"
+		tagsResult := &acr.RepositoryTagsType{
+			Registry:  &testLoginURL,
+			ImageName: &testRepo,
+			TagsAttributes: &[]acr.TagAttributesBase{{
+				Name:                 &lookAlike,
+				Digest:               &digest1,
+				LastUpdateTime:       &lastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			}},
+		}
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(tagsResult, nil).Once()
+		tagPager := api.NewTagPager(mockClient, testRepo, "")
+		tagsToDelete, err := opts.getTagsToDelete(testCtx, tagPager, regexp.MustCompile("^latest$"), MatchOnTag, testNow, nil, nil, nil)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(*tagsToDelete))
+		assert.Contains(out.String(), `tag "lat\u0435st" of repository bar is not a valid tag name`)
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,239 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/events"
+	"github.com/Azure/acr-cli/cmd/worker"
+)
+
+// Options is the configuration of a purge run, it is passed to every function of the run. Every run (e.g. a purge
+// command or a job of the server) has its own options, so runs with different settings can happen at the same time.
+// The options are set before the run starts and are not changed while it runs.
+type Options struct {
+	// batchSize is the maximum amount of tags deleted with a single request, tags are deleted one by one if it is at
+	// most 1.
+	batchSize int
+	// orderBy is the order the tags are listed in to select the ones to delete, it is empty for the default order.
+	orderBy string
+	// minUpdateTime is the most recent last update time a tag or a manifest can have to be deleted, whatever the
+	// cutoff is. It is zero unless SetMinAge is called.
+	minUpdateTime time.Time
+	// untaggedUpdateTime is the most recent last update time an untagged manifest can have to be deleted. It is zero
+	// unless SetUntaggedAgo is called.
+	untaggedUpdateTime time.Time
+	// collectSizes is set to list the manifests of every repository during a dry run, even without the untagged flag,
+	// so that the size of the tags that would be deleted is known.
+	collectSizes bool
+	// filterTimeout is the time all the filters can take to be evaluated during the run, 0 means no limit.
+	filterTimeout time.Duration
+	// filterTime is the time, in nanoseconds, spent evaluating the filters during the run.
+	filterTime *int64
+	// keepPerGroup is the number of most recent matching tags kept for every value of the capture groups of the
+	// filter, 0 unless SetKeepPerGroup is called.
+	keepPerGroup int
+	// artifactConfigMediaType is the config media type of the only manifests the run deletes, it is empty unless
+	// SetArtifactType is called.
+	artifactConfigMediaType string
+	// excludeLabels are the labels that keep an image from being purged, they are empty unless SetExcludeLabels is
+	// called.
+	excludeLabels []labelSelector
+	// pushedBy are the identities whose manifests can be purged, it is nil unless SetPushedBy is called.
+	pushedBy []string
+	// signaturePolicy is how the signed images are treated, the signatures are not checked unless
+	// SetSignaturePolicy is called.
+	signaturePolicy string
+	// pinnedDigests are the digests of every repository that are never purged, it is nil unless SetPinned is called.
+	pinnedDigests map[string]map[string]bool
+	// referenceRegistry is the registry whose images are never purged (e.g. the production registry the images are
+	// promoted to), it is nil unless SetReferenceRegistry is called. referenceLoginURL is only used in the messages.
+	referenceRegistry api.ManifestHeader
+	referenceLoginURL string
+	// includeReferrers makes the untagged purge delete the referrers of the deleted manifests.
+	includeReferrers bool
+	// aliasDetection makes the run look for the other tags of the digests of the tags it deletes, keepPartialUntag
+	// keeps the tags whose digest keeps other tags, they are deleted with a warning otherwise.
+	aliasDetection   bool
+	keepPartialUntag bool
+	// windows are the time windows of the run, nil unless SetTimeWindows is called.
+	windows *timeWindows
+	// clock is the clock the run reads the current time from while it deletes, the system clock unless SetClock is
+	// called.
+	clock Clock
+	// cacheRules are the cache rules of the registry, the repositories they cache are not purged.
+	cacheRules []api.CacheRule
+	// limit counts the deletions queued by the run against the maximum of SetMaxDeletes.
+	limit *deleteLimit
+	// dispatched are the manifests whose deletion was dispatched by the run, they are not deleted twice.
+	dispatched *worker.DispatchedManifests
+	// dispatcher runs the deletions of the run, it is the dispatcher of StartDispatcher unless SetDispatcher is
+	// called.
+	dispatcher *worker.Dispatcher
+	// verifyDigest makes the workers check the digest of every tag of the run right before deleting it.
+	verifyDigest bool
+	// calls counts the requests of the deletions of the run, it is nil unless SetCallCounter is called.
+	calls *api.CallCounter
+	// The caches of the checks of the manifests, by digest (and repository for the reference registry). Manifests are
+	// immutable, so every manifest is only checked once during a run no matter how many tags reference it.
+	excludedDigests *digestCache
+	pushedByDigests *digestCache
+	signedDigests   *digestCache
+	presentDigests  *digestCache
+	// The consumers of the results of the deletions, they are nil unless they are enabled.
+	csvReport      *CSVReport
+	eventPublisher *events.Publisher
+	progress       *Progress
+	verifier       *Verifier
+	// state is the progress the run checkpoints, it is nil unless EnableState is called.
+	state *State
+	// out is where the run prints what it deletes and keeps, the standard output unless SetOutput is called.
+	out *lockedWriter
+	// warnings is where the run warns about unexpected names and filters, the standard error unless
+	// SetWarningsOutput is called.
+	warnings *lockedWriter
+}
+
+// NewOptions returns the options of a run that deletes everything its filters and cutoff select, with the default
+// order of the tags and without any of the optional checks.
+func NewOptions() *Options {
+	return &Options{
+		filterTime:      new(int64),
+		limit:           &deleteLimit{},
+		dispatched:      worker.NewDispatchedManifests(),
+		excludedDigests: newDigestCache(),
+		pushedByDigests: newDigestCache(),
+		signedDigests:   newDigestCache(),
+		presentDigests:  newDigestCache(),
+		clock:           SystemClock(),
+		out:             &lockedWriter{out: os.Stdout},
+		warnings:        &lockedWriter{out: os.Stderr},
+	}
+}
+
+// SetOutput sets where the run prints the tags and manifests it deletes and keeps, e.g. the standard error when the
+// standard output is used for something else.
+func (o *Options) SetOutput(out io.Writer) {
+	o.out = &lockedWriter{out: out}
+}
+
+// SetWarningsOutput sets where the run warns about unexpected repository and tag names, filters that match no
+// repository and partial untags.
+func (o *Options) SetWarningsOutput(out io.Writer) {
+	o.warnings = &lockedWriter{out: out}
+}
+
+// SetClock sets the clock the run reads the current time from while it deletes, e.g. to check whether its time
+// windows are still open or to log when an empty repository was deleted.
+func (o *Options) SetClock(clock Clock) {
+	o.clock = clock
+}
+
+// SetDispatcher sets the dispatcher that runs the deletions of the run, e.g. one with the concurrency and the pacing
+// of the SKU of the registry of the run. The dispatcher of StartDispatcher is used otherwise.
+func (o *Options) SetDispatcher(d *worker.Dispatcher) {
+	o.dispatcher = d
+}
+
+// SetVerifyDigest makes the workers check that every tag still references the digest it referenced when it was
+// listed right before deleting it, a tag that was pushed again in the meantime is skipped.
+func (o *Options) SetVerifyDigest(enabled bool) {
+	o.verifyDigest = enabled
+}
+
+// SetCallCounter counts the requests of the deletions of the run with the counter, the requests sent with the
+// contexts of the run are counted if the counter is attached to them with api.WithCallCounter.
+func (o *Options) SetCallCounter(calls *api.CallCounter) {
+	o.calls = calls
+}
+
+// printf prints a message of the run to its output.
+func (o *Options) printf(format string, a ...interface{}) {
+	fmt.Fprintf(o.out, format, a...)
+}
+
+// warnf writes a warning of the run to its warnings output.
+func (o *Options) warnf(format string, a ...interface{}) {
+	fmt.Fprintf(o.warnings, "Warning: "+format, a...)
+}
+
+// lockedWriter writes to out one message at a time, the repositories of a run print at the same time.
+type lockedWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// Write writes p to the writer.
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Write(p)
+}
+
+// digestCache caches a boolean by manifest digest, it is shared by the repositories that are purged at the same time.
+type digestCache struct {
+	mu     sync.Mutex
+	values map[string]bool
+}
+
+// newDigestCache returns an empty cache.
+func newDigestCache() *digestCache {
+	return &digestCache{values: map[string]bool{}}
+}
+
+// get returns the cached value of the key and whether there is one.
+func (c *digestCache) get(key string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.values[key]
+	return value, ok
+}
+
+// set caches the value of the key.
+func (c *digestCache) set(key string, value bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+}
+
+// newBatch returns a batch of deletions that runs on the dispatcher of the run, that prints to its output, that does
+// not delete the manifests the run already deleted and whose results are passed to the CSV report, to the verifier, to the event publisher and to
+// the progress stream of the run, when they are enabled.
+func (o *Options) newBatch() *worker.Batch {
+	var batch *worker.Batch
+	if o.dispatcher != nil {
+		batch = o.dispatcher.NewBatch()
+	} else {
+		batch = worker.NewBatch()
+	}
+	batch.SetOutput(o.out)
+	batch.SetDispatchedManifests(o.dispatched)
+	batch.SetVerifyDigest(o.verifyDigest)
+	batch.SetCallCounter(o.calls)
+	if o.csvReport == nil && o.verifier == nil && o.eventPublisher == nil && o.progress == nil {
+		return batch
+	}
+	report, v, publisher, p := o.csvReport, o.verifier, o.eventPublisher, o.progress
+	batch.SetResultHandler(func(result worker.Result) {
+		if report != nil {
+			report.handleResult(result)
+		}
+		if v != nil {
+			v.handleResult(result)
+		}
+		if publisher != nil {
+			publishResult(publisher, result)
+		}
+		if p != nil {
+			p.handleResult(result)
+		}
+	})
+	return batch
+}
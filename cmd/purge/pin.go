@@ -0,0 +1,162 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LockfileVersion is the version of the format of the lockfiles.
+const LockfileVersion = 1
+
+// The formats a lockfile can be written in, both can be read back.
+const (
+	LockfileFormatJSON = "json"
+	LockfileFormatYAML = "yaml"
+)
+
+// Lockfile pins the tags of some repositories to the digests they referenced when it was created, so that GitOps
+// repositories can deploy the digests and the purge can keep them.
+type Lockfile struct {
+	Version     int    `json:"version" yaml:"version"`
+	Registry    string `json:"registry" yaml:"registry"`
+	CreatedTime string `json:"createdTime" yaml:"createdTime"`
+	// Repositories maps every repository to its pinned tags and their digests.
+	Repositories map[string]map[string]string `json:"repositories" yaml:"repositories"`
+}
+
+// NewLockfile pins the tags that match the filters to their current digest, the filters are parsed with the options.
+func NewLockfile(ctx context.Context, acrClient api.TagLister, clock Clock, loginURL string, filters []string, opts *Options) (*Lockfile, error) {
+	tagFilters, err := opts.GetTagFilters(filters, MatchOnTag)
+	if err != nil {
+		return nil, err
+	}
+	lockfile := &Lockfile{
+		Version:      LockfileVersion,
+		Registry:     loginURL,
+		CreatedTime:  clock.Now().UTC().Format(time.RFC3339),
+		Repositories: map[string]map[string]string{},
+	}
+	for repoName, tagFilter := range tagFilters {
+		regex, err := regexp.Compile(tagFilter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter of %s: %w", repoName, err)
+		}
+		pins := map[string]string{}
+		tagPager := newTagPager(acrClient, repoName, "", regex, MatchOnTag)
+		for !tagPager.Done() {
+			resultTags, err := tagPager.Next(ctx)
+			if err != nil {
+				if errors.Is(err, api.ErrNotFound) {
+					break
+				}
+				return nil, fmt.Errorf("failed to list the tags of %s: %w", repoName, err)
+			}
+			if resultTags == nil || resultTags.TagsAttributes == nil {
+				break
+			}
+			for _, tag := range *resultTags.TagsAttributes {
+				if tag.Name != nil && tag.Digest != nil && regex.MatchString(*tag.Name) {
+					pins[*tag.Name] = *tag.Digest
+				}
+			}
+		}
+		lockfile.Repositories[repoName] = pins
+	}
+	return lockfile, nil
+}
+
+// WriteLockfile writes a lockfile in JSON or YAML, the keys are sorted so that a lockfile only changes when a pin
+// does.
+func WriteLockfile(out io.Writer, lockfile *Lockfile, format string) error {
+	var lockfileBytes []byte
+	var err error
+	switch format {
+	case LockfileFormatJSON, "":
+		lockfileBytes, err = json.MarshalIndent(lockfile, "", "  ")
+		lockfileBytes = append(lockfileBytes, '\n')
+	case LockfileFormatYAML:
+		lockfileBytes, err = yaml.Marshal(lockfile)
+	default:
+		return fmt.Errorf("invalid lockfile format %q, supported values are %q and %q", format, LockfileFormatJSON, LockfileFormatYAML)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(lockfileBytes)
+	return err
+}
+
+// ReadLockfile reads a lockfile written by WriteLockfile in either format.
+func ReadLockfile(path string) (*Lockfile, error) {
+	var lockfile Lockfile
+	if err := readYAML(path, &lockfile); err != nil {
+		return nil, fmt.Errorf("failed to read lockfile %s: %w", path, err)
+	}
+	if lockfile.Version != LockfileVersion {
+		return nil, fmt.Errorf("lockfile %s has version %d, only version %d is supported", path, lockfile.Version, LockfileVersion)
+	}
+	return &lockfile, nil
+}
+
+// SetPinned makes the run keep the digests pinned by a lockfile, both their tags and the manifests themselves. A
+// nil lockfile disables it.
+func (o *Options) SetPinned(lockfile *Lockfile) {
+	if lockfile == nil {
+		o.pinnedDigests = nil
+		return
+	}
+	o.pinnedDigests = map[string]map[string]bool{}
+	for repoName, pins := range lockfile.Repositories {
+		o.pinnedDigests[repoName] = map[string]bool{}
+		for _, digest := range pins {
+			o.pinnedDigests[repoName][digest] = true
+		}
+	}
+}
+
+// isPinned returns true if the digest is pinned by the lockfile of the run.
+func (o *Options) isPinned(repoName string, digest string) bool {
+	return o.pinnedDigests[repoName][digest]
+}
+
+// withoutPinned removes the tags whose digest is pinned, like the pages of tags a nil slice stays nil.
+func (o *Options) withoutPinned(repoName string, tags *[]acr.TagAttributesBase) *[]acr.TagAttributesBase {
+	if tags == nil || o.pinnedDigests == nil {
+		return tags
+	}
+	filtered := []acr.TagAttributesBase{}
+	for _, tag := range *tags {
+		if o.isPinned(repoName, *tag.Digest) {
+			o.printf("Keeping %s:%s, its digest %s is pinned\n", repoName, *tag.Name, *tag.Digest)
+			continue
+		}
+		filtered = append(filtered, tag)
+	}
+	return &filtered
+}
+
+// withoutPinnedManifests removes the untagged manifests that are pinned.
+func (o *Options) withoutPinnedManifests(repoName string, manifests []acr.ManifestAttributesBase) []acr.ManifestAttributesBase {
+	if o.pinnedDigests == nil {
+		return manifests
+	}
+	filtered := []acr.ManifestAttributesBase{}
+	for _, manifest := range manifests {
+		if !o.isPinned(repoName, *manifest.Digest) {
+			filtered = append(filtered, manifest)
+		}
+	}
+	return filtered
+}
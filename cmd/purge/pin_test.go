@@ -0,0 +1,87 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPin contains the tests for the lockfiles of acr pin and the pinned digests of the purge.
+func TestPin(t *testing.T) {
+	testLockfile := &Lockfile{
+		Version:      LockfileVersion,
+		Registry:     testLoginURL,
+		CreatedTime:  "2020-01-15T12:00:00Z",
+		Repositories: map[string]map[string]string{testRepo: {tagName: digest}},
+	}
+	// First test, the tags that match the filter are pinned to their digest.
+	t.Run("NewLockfileTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		lockfile, err := NewLockfile(testCtx, mockClient, testClock, testLoginURL, []string{testRepo + ":^la.*"}, NewOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(testLockfile.Repositories, lockfile.Repositories)
+		assert.Equal(testClock.Now().UTC().Format(time.RFC3339), lockfile.CreatedTime)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, a lockfile is read back in both formats and other formats are rejected.
+	t.Run("WriteReadTest", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "pin")
+		assert.Equal(nil, err, "Error should be nil")
+		defer os.RemoveAll(dir)
+		for _, format := range []string{LockfileFormatJSON, LockfileFormatYAML} {
+			var buffer bytes.Buffer
+			assert.Equal(nil, WriteLockfile(&buffer, testLockfile, format), "Error should be nil")
+			path := filepath.Join(dir, "pins."+format)
+			assert.Equal(nil, ioutil.WriteFile(path, buffer.Bytes(), 0600))
+			lockfile, err := ReadLockfile(path)
+			assert.Equal(nil, err, "Error should be nil")
+			assert.Equal(testLockfile, lockfile, format)
+		}
+		assert.NotEqual(nil, WriteLockfile(&bytes.Buffer{}, testLockfile, "toml"), "Error should not be nil")
+		path := filepath.Join(dir, "future.yaml")
+		assert.Equal(nil, ioutil.WriteFile(path, []byte("version: 2\n"), 0600))
+		_, err = ReadLockfile(path)
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+	// Third test, a tag whose digest is pinned is kept by the purge and by the dry run.
+	t.Run("KeepPinnedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetPinned(testLockfile)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Twice()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Twice()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(Summary{Scanned: 1, Skipped: 1}, summary)
+		repoPlan, err := DryRunPlan(testCtx, mockClient, testClock, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(repoPlan.Tags))
+		assert.Equal(1, len(repoPlan.Kept))
+		assert.Equal(KeepReasonPinned, repoPlan.Kept[0].Reason)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, an untagged manifest that is pinned is not deleted.
+	t.Run("PinnedManifestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetPinned(&Lockfile{Repositories: map[string]map[string]string{testRepo: {"v1": digest}}})
+		manifests := []acr.ManifestAttributesBase{{Digest: &digest}}
+		assert.Equal(0, len(opts.withoutPinnedManifests(testRepo, manifests)))
+		assert.Equal(1, len(opts.withoutPinnedManifests("other", manifests)))
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// placeholderRegex matches a placeholder of the repository of a filter, e.g. {team} in {team}/app:^pr-.*.
+var placeholderRegex = regexp.MustCompile(`\{([a-zA-Z][a-zA-Z0-9_]*)\}`)
+
+// placeholderComponent is what a placeholder without values matches in the names of the repositories of the catalog,
+// a single path component.
+const placeholderComponent = `[a-z0-9._-]+`
+
+// ParsePlaceholders parses the values of the placeholders of the filters, every value is in the form
+// <name>=<value>[,<value>...] and a name can be specified multiple times.
+func ParsePlaceholders(values []string) (map[string][]string, error) {
+	placeholders := map[string][]string{}
+	for _, value := range values {
+		nameAndValues := strings.SplitN(value, "=", 2)
+		if len(nameAndValues) != 2 || !placeholderRegex.MatchString("{"+nameAndValues[0]+"}") {
+			return nil, fmt.Errorf("invalid placeholder %q, the format is <name>=<value>[,<value>...]", value)
+		}
+		for _, placeholderValue := range strings.Split(nameAndValues[1], ",") {
+			if len(placeholderValue) == 0 || strings.Contains(placeholderValue, "/") {
+				return nil, fmt.Errorf("invalid placeholder %q, the values cannot be empty or contain '/'", value)
+			}
+			placeholders[nameAndValues[0]] = append(placeholders[nameAndValues[0]], placeholderValue)
+		}
+	}
+	// No placeholders are nil like in a policy read from a file.
+	if len(placeholders) == 0 {
+		return nil, nil
+	}
+	return placeholders, nil
+}
+
+// ExpandFilters returns the filters with the placeholders of their repository (e.g. {team}/app:^pr-.*) replaced, a
+// filter is repeated for every repository it expands to. A placeholder is replaced by every one of its values, the
+// placeholders without values match a path component of the repositories of the catalog, which is only listed if
+// needed. Filters without placeholders are returned as they are, the ones that match no repository are dropped with a
+// warning of the options.
+func (o *Options) ExpandFilters(ctx context.Context, acrClient api.AcrCLIClientInterface, filters []string, placeholders map[string][]string, matchOn string) ([]string, error) {
+	expanded := []string{}
+	var catalog []string
+	for _, filter := range filters {
+		var repoName, tagRegex string
+		var err error
+		if matchOn == MatchOnDigest {
+			repoName, tagRegex, err = getRepositoryAndDigestRegex(filter)
+		} else {
+			repoName, tagRegex, err = getRepositoryAndTagRegex(filter)
+		}
+		if err != nil || !placeholderRegex.MatchString(repoName) {
+			expanded = append(expanded, filter)
+			continue
+		}
+		repoNames := expandRepository(repoName, placeholders)
+		if repoNames == nil {
+			// Some placeholders have no values, so the repository is matched against the catalog.
+			if catalog == nil {
+				catalog, err = listCatalog(ctx, acrClient)
+				if err != nil {
+					return nil, err
+				}
+			}
+			repoNames = matchCatalog(repoName, placeholders, catalog)
+			if len(repoNames) == 0 {
+				o.warnf("no repository matches %q of filter %q\n", repoName, filter)
+			}
+		}
+		for _, expandedName := range repoNames {
+			expanded = append(expanded, expandedName+":"+tagRegex)
+		}
+	}
+	return expanded, nil
+}
+
+// expandRepository returns every repository name the placeholders expand to, nil if a placeholder has no values.
+func expandRepository(repoName string, placeholders map[string][]string) []string {
+	match := placeholderRegex.FindStringSubmatchIndex(repoName)
+	if match == nil {
+		return []string{repoName}
+	}
+	values := placeholders[repoName[match[2]:match[3]]]
+	if len(values) == 0 {
+		return nil
+	}
+	repoNames := []string{}
+	for _, value := range values {
+		rest := expandRepository(repoName[match[1]:], placeholders)
+		if rest == nil {
+			return nil
+		}
+		for _, suffix := range rest {
+			repoNames = append(repoNames, repoName[:match[0]]+value+suffix)
+		}
+	}
+	return repoNames
+}
+
+// matchCatalog returns the sorted repositories of the catalog that match the repository with placeholders.
+func matchCatalog(repoName string, placeholders map[string][]string, catalog []string) []string {
+	pattern := "^"
+	last := 0
+	for _, match := range placeholderRegex.FindAllStringSubmatchIndex(repoName, -1) {
+		pattern += regexp.QuoteMeta(repoName[last:match[0]])
+		values := placeholders[repoName[match[2]:match[3]]]
+		if len(values) == 0 {
+			pattern += placeholderComponent
+		} else {
+			quoted := []string{}
+			for _, value := range values {
+				quoted = append(quoted, regexp.QuoteMeta(value))
+			}
+			pattern += "(?:" + strings.Join(quoted, "|") + ")"
+		}
+		last = match[1]
+	}
+	pattern += regexp.QuoteMeta(repoName[last:]) + "$"
+	regex := regexp.MustCompile(pattern)
+	repoNames := []string{}
+	for _, name := range catalog {
+		if regex.MatchString(name) {
+			repoNames = append(repoNames, name)
+		}
+	}
+	sort.Strings(repoNames)
+	return repoNames
+}
+
+// listCatalog returns the names of all the repositories of the registry.
+func listCatalog(ctx context.Context, acrClient api.AcrCLIClientInterface) ([]string, error) {
+	repoNames := []string{}
+	repoPager := api.NewRepositoryPager(acrClient)
+	resultRepos, err := repoPager.Next(ctx)
+	for err == nil && resultRepos != nil && resultRepos.Names != nil && len(*resultRepos.Names) > 0 {
+		repoNames = append(repoNames, *resultRepos.Names...)
+		resultRepos, err = repoPager.Next(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the repositories to expand the placeholders: %w", err)
+	}
+	return repoNames, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParsePlaceholders contains the tests for the parsing of the values of the placeholders.
+func TestParsePlaceholders(t *testing.T) {
+	// First test, the values of a name specified multiple times are added up.
+	t.Run("ValuesTest", func(t *testing.T) {
+		assert := assert.New(t)
+		placeholders, err := ParsePlaceholders([]string{"team=frontend,backend", "env=dev", "team=data"})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(map[string][]string{"team": {"frontend", "backend", "data"}, "env": {"dev"}}, placeholders)
+	})
+	// Second test, no placeholders are nil.
+	t.Run("EmptyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		placeholders, err := ParsePlaceholders(nil)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Nil(placeholders)
+	})
+	// Third test, invalid names and values return an error.
+	t.Run("InvalidTest", func(t *testing.T) {
+		assert := assert.New(t)
+		for _, value := range []string{"team", "1team=a", "team=", "team=a,,b", "team=a/b"} {
+			_, err := ParsePlaceholders([]string{value})
+			assert.NotEqual(nil, err, "Error should not be nil for %q", value)
+		}
+	})
+}
+
+// TestExpandFilters contains the tests for the expansion of the placeholders of the filters.
+func TestExpandFilters(t *testing.T) {
+	ctx := context.Background()
+	catalog := &acr.Repositories{Names: &[]string{"backend/app", "frontend/app", "frontend/app/cache", "frontend/web", "team.data/app"}}
+	// First test, the placeholders with values are replaced by every combination of their values and the catalog is
+	// not listed, filters without placeholders and the quantifiers of the tag regex are kept.
+	t.Run("ValuesTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		placeholders := map[string][]string{"team": {"frontend", "backend"}, "env": {"dev", "prod"}}
+		filters, err := NewOptions().ExpandFilters(ctx, mockClient, []string{"{team}/{env}-app:^pr-[0-9]{3}$", "other:.*"}, placeholders, MatchOnTag)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{
+			"frontend/dev-app:^pr-[0-9]{3}$",
+			"frontend/prod-app:^pr-[0-9]{3}$",
+			"backend/dev-app:^pr-[0-9]{3}$",
+			"backend/prod-app:^pr-[0-9]{3}$",
+			"other:.*",
+		}, filters)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, the placeholders without values match a path component of the repositories of the catalog, which
+	// is listed once.
+	t.Run("CatalogTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositories", ctx, "").Return(catalog, nil).Once()
+		mockClient.On("GetAcrRepositories", ctx, "team.data/app").Return(&acr.Repositories{}, nil).Once()
+		filters, err := NewOptions().ExpandFilters(ctx, mockClient, []string{"{team}/app:^pr-.*", "frontend/{name}:latest"}, nil, MatchOnTag)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{"backend/app:^pr-.*", "frontend/app:^pr-.*", "team.data/app:^pr-.*", "frontend/app:latest", "frontend/web:latest"}, filters)
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, the values of a placeholder restrict the repositories of the catalog matched by the others, and a
+	// filter that matches no repository is dropped with a warning.
+	t.Run("MixedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		opts := NewOptions()
+		opts.SetWarningsOutput(out)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositories", ctx, "").Return(catalog, nil).Once()
+		mockClient.On("GetAcrRepositories", ctx, "team.data/app").Return(&acr.Repositories{}, nil).Once()
+		placeholders := map[string][]string{"team": {"frontend"}}
+		filters, err := opts.ExpandFilters(ctx, mockClient, []string{"{team}/{name}:.*", "{unknown}/db:.*"}, placeholders, MatchOnTag)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{"frontend/app:.*", "frontend/web:.*"}, filters)
+		assert.Contains(out.String(), `no repository matches "{unknown}/db"`)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, the digest filters are expanded too.
+	t.Run("DigestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		filters, err := NewOptions().ExpandFilters(ctx, mockClient, []string{"{team}/app:sha256:abc.*"}, map[string][]string{"team": {"data"}}, MatchOnDigest)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{"data/app:sha256:abc.*"}, filters)
+	})
+	// Fifth test, an error listing the catalog is returned.
+	t.Run("CatalogErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrRepositories", ctx, "").Return(nil, errors.New("unauthorized")).Once()
+		_, err := NewOptions().ExpandFilters(ctx, mockClient, []string{"{team}/app:.*"}, nil, MatchOnTag)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
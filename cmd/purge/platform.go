@@ -0,0 +1,242 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// ociIndexContentType is the media type used to push trimmed indexes that do not specify their own.
+const ociIndexContentType = "application/vnd.oci.image.index.v1+json"
+
+// Platform identifies the platform of the child manifests of an index, an empty variant matches any variant.
+type Platform struct {
+	OS           string
+	Architecture string
+	Variant      string
+}
+
+// ParsePlatform parses a platform in the os/architecture[/variant] format, e.g. windows/amd64 or linux/arm/v7.
+func ParsePlatform(platform string) (Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Platform{}, fmt.Errorf("invalid platform %q, the format is os/architecture[/variant]", platform)
+	}
+	for _, part := range parts {
+		if len(part) == 0 {
+			return Platform{}, fmt.Errorf("invalid platform %q, the format is os/architecture[/variant]", platform)
+		}
+	}
+	result := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		result.Variant = parts[2]
+	}
+	return result, nil
+}
+
+// String returns the platform in the os/architecture[/variant] format.
+func (p Platform) String() string {
+	if len(p.Variant) > 0 {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// matches returns true if the platform of a child manifest is the same as p.
+func (p Platform) matches(child indexPlatform) bool {
+	return p.OS == child.OS && p.Architecture == child.Architecture && (len(p.Variant) == 0 || p.Variant == child.Variant)
+}
+
+// indexPlatform is the platform of a child manifest, only the fields that are compared are parsed.
+type indexPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// indexChild is a child manifest of an index, only the fields needed to decide whether it is removed are parsed.
+type indexChild struct {
+	Digest   string         `json:"digest"`
+	Platform *indexPlatform `json:"platform,omitempty"`
+}
+
+// TrimmedIndex is the result of removing the child manifests of some platforms from an index.
+type TrimmedIndex struct {
+	// Manifest is the body of the trimmed index and MediaType its media type.
+	Manifest  []byte
+	MediaType string
+	// Digest is the digest of the trimmed index.
+	Digest string
+	// Removed contains the digests of the child manifests that were removed.
+	Removed []string
+	// Kept is the number of child manifests that remain in the index.
+	Kept int
+}
+
+// TrimIndex removes the child manifests of the specified platforms from an index (either an OCI index or a Docker
+// manifest list). Every other field of the index and of the remaining children is preserved. If the manifest is not
+// an index or none of its children match, nil is returned.
+func TrimIndex(manifestBytes []byte, platforms []Platform) (*TrimmedIndex, error) {
+	var index map[string]json.RawMessage
+	if err := json.Unmarshal(manifestBytes, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	rawChildren, ok := index["manifests"]
+	if !ok {
+		return nil, nil
+	}
+	var children []json.RawMessage
+	if err := json.Unmarshal(rawChildren, &children); err != nil {
+		return nil, fmt.Errorf("failed to parse the manifests of the index: %w", err)
+	}
+	kept := []json.RawMessage{}
+	removed := []string{}
+	for _, rawChild := range children {
+		var child indexChild
+		if err := json.Unmarshal(rawChild, &child); err != nil {
+			return nil, fmt.Errorf("failed to parse the manifests of the index: %w", err)
+		}
+		if child.Platform != nil && matchesAnyPlatform(*child.Platform, platforms) {
+			removed = append(removed, child.Digest)
+		} else {
+			kept = append(kept, rawChild)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	keptBytes, err := json.Marshal(kept)
+	if err != nil {
+		return nil, err
+	}
+	index["manifests"] = keptBytes
+	trimmedBytes, err := json.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+	mediaType := ociIndexContentType
+	if rawMediaType, ok := index["mediaType"]; ok {
+		if err := json.Unmarshal(rawMediaType, &mediaType); err != nil {
+			return nil, fmt.Errorf("failed to parse the media type of the index: %w", err)
+		}
+	}
+	return &TrimmedIndex{
+		Manifest:  trimmedBytes,
+		MediaType: mediaType,
+		Digest:    api.ManifestDigest(trimmedBytes),
+		Removed:   removed,
+		Kept:      len(kept),
+	}, nil
+}
+
+// matchesAnyPlatform returns true if the platform of a child manifest matches any of the platforms.
+func matchesAnyPlatform(child indexPlatform, platforms []Platform) bool {
+	for _, platform := range platforms {
+		if platform.matches(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// Platforms removes the child manifests of the specified platforms from the indexes referenced by the tags that
+// match the filter and are older than the cutoff, the trimmed index is pushed with the same tag. If every child of an
+// index matches, the tag is deleted instead of pushing an empty index. The removed child manifests are left without
+// references, so they are deleted by DanglingManifests. If dryRun is set nothing is pushed or deleted. The tags that
+// were trimmed or deleted are counted as deleted in the summary. The rest of the configuration of the run is in the
+// options.
+func Platforms(ctx context.Context, acrClient api.AcrCLIClientInterface, clock Clock, loginURL string, repoName string, cutoff Cutoff, tagFilter string, matchOn string, platforms []Platform, dryRun bool, opts *Options) (Summary, error) {
+	summary := Summary{}
+	timeToCompare, err := cutoff.Time(clock)
+	if err != nil {
+		return summary, err
+	}
+	tagRegex, err := regexp.Compile(tagFilter)
+	if err != nil {
+		return summary, err
+	}
+	// Tags that reference the same index share the trimmed index, so every index is only fetched once.
+	trimmed := map[string]*TrimmedIndex{}
+	tagPager := newTagPager(acrClient, repoName, opts.orderBy, tagRegex, matchOn)
+	kept := []KeptTag{}
+	tags, err := opts.getTagsToDelete(ctx, tagPager, tagRegex, matchOn, timeToCompare, nil, nil, &kept)
+	if err != nil {
+		return summary, err
+	}
+	for tags != nil {
+		summary.Scanned = tagPager.Listed()
+		summary.Skipped += len(kept)
+		kept = kept[:0]
+		tagsToDelete := []acr.TagAttributesBase{}
+		for _, tag := range *tags {
+			// The platforms of an image with an excluded label are kept like the image itself.
+			excluded, err := opts.hasExcludedLabel(ctx, acrClient, repoName, *tag.Digest)
+			if err != nil {
+				return summary, err
+			}
+			if excluded {
+				summary.Skipped++
+				continue
+			}
+			matched, err := opts.isPushedBy(ctx, acrClient, repoName, *tag.Digest)
+			if err != nil {
+				return summary, err
+			}
+			if !matched {
+				summary.Skipped++
+				continue
+			}
+			index, ok := trimmed[*tag.Digest]
+			if !ok {
+				manifestBytes, err := acrClient.GetManifest(ctx, repoName, *tag.Digest)
+				if err != nil {
+					return summary, err
+				}
+				index, err = TrimIndex(manifestBytes, platforms)
+				if err != nil {
+					return summary, fmt.Errorf("failed to trim %s@%s: %w", repoName, *tag.Digest, err)
+				}
+				trimmed[*tag.Digest] = index
+			}
+			if index == nil {
+				continue
+			}
+			if index.Kept == 0 {
+				// An index without children is useless, the tag is deleted instead.
+				if dryRun {
+					opts.printf("%s/%s:%s\n", loginURL, repoName, *tag.Name)
+					summary.Deleted++
+				} else {
+					tagsToDelete = append(tagsToDelete, tag)
+				}
+				continue
+			}
+			if !dryRun {
+				if _, err := acrClient.PutManifest(ctx, repoName, *tag.Name, index.MediaType, index.Manifest); err != nil {
+					summary.Failed++
+					return summary, fmt.Errorf("failed to push the trimmed index of %s:%s: %w", repoName, *tag.Name, err)
+				}
+			}
+			summary.Deleted++
+			opts.printf("%s/%s:%s trimmed to %s, removed %s\n", loginURL, repoName, *tag.Name, index.Digest, strings.Join(index.Removed, ", "))
+		}
+		if len(tagsToDelete) > 0 {
+			if err := opts.deleteTagsAndWait(loginURL, repoName, tagsToDelete, &summary); err != nil {
+				return summary, err
+			}
+		}
+		tags, err = opts.getTagsToDelete(ctx, tagPager, tagRegex, matchOn, timeToCompare, nil, nil, &kept)
+		if err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
@@ -0,0 +1,122 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestParsePlatform contains the tests for the parsing of the platform flag.
+func TestParsePlatform(t *testing.T) {
+	assert := assert.New(t)
+	platform, err := ParsePlatform("windows/amd64")
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal(Platform{OS: "windows", Architecture: "amd64"}, platform)
+	platform, err = ParsePlatform("linux/arm/v7")
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal("linux/arm/v7", platform.String())
+	_, err = ParsePlatform("amd64")
+	assert.NotEqual(nil, err, "Error should not be nil")
+	_, err = ParsePlatform("linux//v7")
+	assert.NotEqual(nil, err, "Error should not be nil")
+}
+
+// TestTrimIndex contains the tests for the removal of child manifests from an index.
+func TestTrimIndex(t *testing.T) {
+	windows := []Platform{{OS: "windows", Architecture: "amd64"}}
+	// First test, the windows child is removed and the rest of the index is preserved.
+	t.Run("TrimTest", func(t *testing.T) {
+		assert := assert.New(t)
+		trimmed, err := TrimIndex(platformIndexBytes, windows)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{"sha256:win"}, trimmed.Removed)
+		assert.Equal(2, trimmed.Kept)
+		assert.Equal(manifestListContentType, trimmed.MediaType)
+		var index map[string]interface{}
+		assert.Equal(nil, json.Unmarshal(trimmed.Manifest, &index))
+		assert.Equal("bar", index["annotations"].(map[string]interface{})["foo"])
+		assert.Equal(2, len(index["manifests"].([]interface{})))
+	})
+	// Second test, a variant only matches the children of that variant while no variant matches all of them.
+	t.Run("VariantTest", func(t *testing.T) {
+		assert := assert.New(t)
+		trimmed, err := TrimIndex(platformIndexBytes, []Platform{{OS: "linux", Architecture: "arm", Variant: "v6"}})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal((*TrimmedIndex)(nil), trimmed)
+		trimmed, err = TrimIndex(platformIndexBytes, []Platform{{OS: "linux", Architecture: "arm"}, windows[0]})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{"sha256:arm", "sha256:win"}, trimmed.Removed)
+	})
+	// Third test, manifests that are not indexes are not trimmed and invalid manifests return an error.
+	t.Run("NotIndexTest", func(t *testing.T) {
+		assert := assert.New(t)
+		trimmed, err := TrimIndex([]byte(`{"schemaVersion":2,"config":{}}`), windows)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal((*TrimmedIndex)(nil), trimmed)
+		_, err = TrimIndex([]byte("invalid"), windows)
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+}
+
+// TestPlatforms contains the tests for the trimming of the indexes referenced by tags.
+func TestPlatforms(t *testing.T) {
+	// First test, the trimmed index is pushed with the same tag.
+	t.Run("PushTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, digest).Return(platformIndexBytes, nil).Once()
+		mockClient.On("PutManifest", testCtx, testRepo, tagName, manifestListContentType, mock.Anything).Return(&deletedResponse, nil).Once()
+		summary, err := Platforms(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, []Platform{{OS: "windows", Architecture: "amd64"}}, false, NewOptions())
+		assert.Equal(1, summary.Deleted, "Number of trimmed tags should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, in a dry run nothing is pushed.
+	t.Run("DryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, digest).Return(platformIndexBytes, nil).Once()
+		summary, err := Platforms(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, []Platform{{OS: "windows", Architecture: "amd64"}}, true, NewOptions())
+		assert.Equal(1, summary.Deleted, "Number of trimmed tags should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, if every child matches the tag is deleted instead of pushing an empty index.
+	t.Run("DeleteTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, &mockClient, 6)
+		defer StopDispatcher()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, digest).Return(platformIndexBytes, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, tagName).Return(&deletedResponse, nil).Once()
+		platforms := []Platform{{OS: "windows", Architecture: "amd64"}, {OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm"}}
+		summary, err := Platforms(testCtx, &mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, platforms, false, NewOptions())
+		assert.Equal(1, summary.Deleted, "Number of trimmed tags should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// platformIndexBytes is a manifest list with a windows, a linux and a linux arm child manifest.
+var platformIndexBytes = []byte(`{
+	"schemaVersion": 2,
+	"mediaType": "application/vnd.docker.distribution.manifest.list.v2+json",
+	"manifests": [
+		{"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "size": 100, "digest": "sha256:linux", "platform": {"architecture": "amd64", "os": "linux"}},
+		{"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "size": 100, "digest": "sha256:arm", "platform": {"architecture": "arm", "os": "linux", "variant": "v7"}},
+		{"mediaType": "application/vnd.docker.distribution.manifest.v2+json", "size": 100, "digest": "sha256:win", "platform": {"architecture": "amd64", "os": "windows", "os.version": "10.0.17763.1"}}
+	],
+	"annotations": {"foo": "bar"}
+}`)
@@ -0,0 +1,72 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// preflightTagPrefix is the prefix of the tag the permission check deletes, a random suffix is added so that the
+// deletion never matches a tag that was pushed and is a no-op.
+const preflightTagPrefix = "acr-cli-permission-check-"
+
+// CheckPermissions makes sure that the identity can read the metadata of the repositories and delete from them before
+// the purge starts, so that an identity with only pull rights fails at once instead of with a 403 from every worker.
+// The delete permission is checked by deleting a tag that does not exist, the registry answers 404 if the deletion is
+// allowed. Repositories that do not exist are skipped because there is nothing to purge in them.
+func CheckPermissions(ctx context.Context, acrClient api.AcrCLIClientInterface, repoNames []string) error {
+	sorted := append([]string{}, repoNames...)
+	sort.Strings(sorted)
+	for _, repoName := range sorted {
+		if _, err := acrClient.GetAcrTags(ctx, repoName, "", ""); err != nil {
+			if api.IsNotFound(err) {
+				continue
+			}
+			if isPermissionDenied(err) {
+				return fmt.Errorf("the identity cannot read the metadata of repository %s, grant it the %s permission (e.g. the AcrPull role): %w", repoName, api.PermissionMetadataRead, err)
+			}
+			return fmt.Errorf("failed to check the permissions on repository %s: %w", repoName, err)
+		}
+		tag, err := preflightTag()
+		if err != nil {
+			return err
+		}
+		_, err = acrClient.DeleteAcrTag(ctx, repoName, tag)
+		if err == nil || api.IsNotFound(err) {
+			continue
+		}
+		if isPermissionDenied(err) {
+			return fmt.Errorf("the identity cannot delete from repository %s, it seems to only have pull rights. Grant it the %s permission (e.g. the AcrDelete role) or use the dry-run flag: %w", repoName, api.PermissionDelete, err)
+		}
+		// Other errors (e.g. registries that cannot delete a tag on its own) do not tell anything about the
+		// permissions, the purge reports them if they happen again.
+		if api.IsThrottled(err) {
+			return fmt.Errorf("failed to check the permissions on repository %s: %w", repoName, err)
+		}
+	}
+	return nil
+}
+
+// isPermissionDenied returns true if the registry rejected a request because of the permissions of the identity, ACR
+// answers 401 when the token lacks the action the request needs.
+func isPermissionDenied(err error) bool {
+	statusCode := api.StatusCode(err)
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+}
+
+// preflightTag returns a tag name that no one pushed.
+func preflightTag() (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return preflightTagPrefix + hex.EncodeToString(suffix), nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestCheckPermissions contains the tests for the permission check that runs before a purge.
+func TestCheckPermissions(t *testing.T) {
+	preflightTagArg := mock.MatchedBy(func(tag string) bool { return strings.HasPrefix(tag, preflightTagPrefix) })
+	// First test, the deletion of a tag that does not exist is allowed so the check passes.
+	t.Run("AllowedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("DeleteAcrTag", testCtx, testRepo, preflightTagArg).Return(nil, &api.StatusError{StatusCode: http.StatusNotFound, Message: "tag unknown"}).Once()
+		err := CheckPermissions(testCtx, mockClient, []string{testRepo})
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, an identity with only pull rights fails with an auth error that names the missing permission.
+	t.Run("PullOnlyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("DeleteAcrTag", testCtx, testRepo, preflightTagArg).Return(nil, &api.StatusError{StatusCode: http.StatusUnauthorized, Message: "insufficient scope"}).Once()
+		err := CheckPermissions(testCtx, mockClient, []string{testRepo})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), "only have pull rights")
+		assert.True(api.IsAuthError(err))
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, a missing metadata read permission is reported before the deletion is tried.
+	t.Run("MetadataReadTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(nil, &api.StatusError{StatusCode: http.StatusForbidden, Message: "denied"}).Once()
+		err := CheckPermissions(testCtx, mockClient, []string{testRepo})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), api.PermissionMetadataRead)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, repositories that do not exist are skipped.
+	t.Run("RepositoryNotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(nil, &api.StatusError{StatusCode: http.StatusNotFound, Message: "repository unknown"}).Once()
+		err := CheckPermissions(testCtx, mockClient, []string{testRepo})
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/worker"
+)
+
+// The events of the progress stream.
+const (
+	ProgressItemDeleted = "item-deleted"
+	ProgressPageScanned = "page-scanned"
+	ProgressError       = "error"
+)
+
+// The kinds of the pages of the page-scanned events.
+const (
+	progressKindTags      = "tags"
+	progressKindManifests = "manifests"
+)
+
+// ProgressEvent is a line of the progress stream. Count is the number of items of a scanned page and Scanned the
+// number of items of the repository scanned so far.
+type ProgressEvent struct {
+	Event      string `json:"event"`
+	Time       string `json:"time"`
+	Repository string `json:"repository,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Count      int    `json:"count,omitempty"`
+	Scanned    int    `json:"scanned,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Progress writes the progress events of a purge as newline delimited JSON, one event per line as soon as it happens,
+// so that the tools that wrap the CLI can follow a purge without parsing its text output.
+type Progress struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	clock   Clock
+	err     error
+}
+
+// NewProgress creates a stream of progress events that writes to w, the events are stamped with the time of the clock.
+func NewProgress(w io.Writer, clock Clock) *Progress {
+	return &Progress{encoder: json.NewEncoder(w), clock: clock}
+}
+
+// EnableProgress makes the run write its progress events to the stream, nil disables it.
+func (o *Options) EnableProgress(p *Progress) {
+	o.progress = p
+}
+
+// Emit writes an event, the events are written in the order they are emitted even by concurrent workers.
+func (p *Progress) Emit(event ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	event.Time = p.clock.Now().UTC().Format(time.RFC3339Nano)
+	if err := p.encoder.Encode(event); err != nil && p.err == nil {
+		p.err = err
+	}
+}
+
+// Err returns the first error that happened while writing the events.
+func (p *Progress) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// handleResult writes the event of a deleted tag or manifest, or of a deletion that failed. The items that were not
+// found were already gone and the tags that moved were not deleted.
+func (p *Progress) handleResult(result worker.Result) {
+	event := ProgressEvent{Event: ProgressItemDeleted, Repository: result.RepoName, Tag: result.Tag, Digest: result.Digest}
+	switch {
+	case result.Err != nil:
+		event.Event = ProgressError
+		event.Error = result.Err.Error()
+	case result.Skipped || result.Moved:
+		return
+	}
+	p.Emit(event)
+}
+
+// emitPageScanned writes the event of a page of tags or manifests of a repository, if the progress is enabled.
+func (o *Options) emitPageScanned(repoName string, kind string, count int, scanned int) {
+	if o.progress != nil {
+		o.progress.Emit(ProgressEvent{Event: ProgressPageScanned, Repository: repoName, Kind: kind, Count: count, Scanned: scanned})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/cmd/worker"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestProgress contains the tests for the progress events written as NDJSON.
+func TestProgress(t *testing.T) {
+	clock := FixedClock(time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC))
+	// First test, the results of the workers are written as item-deleted and error events, one per line.
+	t.Run("ResultTest", func(t *testing.T) {
+		assert := assert.New(t)
+		out := &bytes.Buffer{}
+		progress := NewProgress(out, clock)
+		progress.handleResult(worker.Result{RepoName: testRepo, Tag: tagName, Digest: digest})
+		progress.handleResult(worker.Result{RepoName: testRepo, Digest: digest1})
+		progress.handleResult(worker.Result{RepoName: testRepo, Tag: "v1", Skipped: true})
+		progress.handleResult(worker.Result{RepoName: testRepo, Tag: "v2", Moved: true})
+		progress.handleResult(worker.Result{RepoName: testRepo, Digest: digest2, Err: errors.New("forbidden")})
+		expected := `{"event":"item-deleted","time":"2021-03-01T10:00:00Z","repository":"` + testRepo + `","tag":"` + tagName + `","digest":"` + digest + `"}
+{"event":"item-deleted","time":"2021-03-01T10:00:00Z","repository":"` + testRepo + `","digest":"` + digest1 + `"}
+{"event":"error","time":"2021-03-01T10:00:00Z","repository":"` + testRepo + `","digest":"` + digest2 + `","error":"forbidden"}
+`
+		assert.Equal(expected, out.String())
+		assert.Equal(nil, progress.Err(), "Error should be nil")
+	})
+	// Second test, a page-scanned event is written for every page of manifests listed while the progress is enabled.
+	t.Run("PageScannedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		out := &bytes.Buffer{}
+		opts.EnableProgress(NewProgress(out, clock))
+		manifests := &acr.Manifests{
+			Registry:  &testLoginURL,
+			ImageName: &testRepo,
+			ManifestsAttributes: &[]acr.ManifestAttributesBase{
+				{Digest: &digest, MediaType: &dockerV2MediaType, LastUpdateTime: &lastUpdateTime},
+				{Digest: &digest1, MediaType: &dockerV2MediaType, LastUpdateTime: &lastUpdateTime},
+			},
+		}
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(manifests, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", digest1).Return(EmptyListManifestsResult, nil).Once()
+		listing, err := opts.listUntaggedManifests(testCtx, mockClient, testRepo, false)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, len(listing.candidates))
+		expected := `{"event":"page-scanned","time":"2021-03-01T10:00:00Z","repository":"` + testRepo + `","kind":"manifests","count":2,"scanned":2}
+`
+		assert.Equal(expected, out.String())
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,1566 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package purge contains the logic to select and delete old tags and dangling manifests, it is used by the
+// purge command and by the serve command.
+package purge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/worker"
+	"github.com/Azure/acr-cli/pkg/acrapi"
+)
+
+// The constants for this package are defined here.
+const (
+	manifestListContentType = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// MatchOnTag and MatchOnDigest are the supported values for matching filters against tags.
+	MatchOnTag    = "tag"
+	MatchOnDigest = "digest"
+
+	// DefaultMinAge is the age under which tags and manifests are never deleted unless a run explicitly allows it.
+	DefaultMinAge = time.Hour
+)
+
+// StartDispatcher starts the workers that execute the deletions, it has to be called before Tags, DanglingManifests
+// or Execute are used. Every call of these functions waits for its own deletions, so they can run at the same time.
+func StartDispatcher(ctx context.Context, acrClient api.AcrCLIClientInterface, nWorkers int) {
+	worker.StartDispatcher(ctx, acrClient, nWorkers)
+}
+
+// StartAutoscalingDispatcher starts the workers like StartDispatcher, the number of concurrent deletions adapts to the
+// latency and the throttling of the registry.
+func StartAutoscalingDispatcher(ctx context.Context, acrClient api.AcrCLIClientInterface) {
+	worker.StartAutoscalingDispatcher(ctx, acrClient)
+}
+
+// StopDispatcher stops the workers started by StartDispatcher or StartAutoscalingDispatcher.
+func StopDispatcher() {
+	worker.StopDispatcher()
+}
+
+// EnableBatchDeletion makes the workers delete up to maxTags tags of a repository with a single request if the
+// registry supports it, and returns whether it does. The tags are deleted one by one otherwise.
+func (o *Options) EnableBatchDeletion(ctx context.Context, acrClient api.AcrCLIClientInterface, maxTags int) (bool, error) {
+	o.batchSize = 0
+	if maxTags <= 1 {
+		return false, nil
+	}
+	supported, err := acrClient.SupportsBatchTagDelete(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to detect whether the registry supports batch deletion: %w", err)
+	}
+	if supported {
+		o.batchSize = maxTags
+	}
+	return supported, nil
+}
+
+// Policy describes what should be purged, it mirrors the flags of the purge command.
+type Policy struct {
+	Filters  []string `json:"filters"`
+	Ago      string   `json:"ago,omitempty"`
+	Before   string   `json:"before,omitempty"`
+	Untagged bool     `json:"untagged"`
+	MatchOn  string   `json:"matchOn,omitempty"`
+	// OnlySuperseded restricts the purge to tags for which a more recent matching tag references a different digest.
+	OnlySuperseded bool `json:"onlySuperseded,omitempty"`
+	// ArtifactType restricts the purge to the tags and manifests of an artifact type (e.g. helm).
+	ArtifactType string `json:"artifactType,omitempty"`
+	// ExcludeLabels keeps the images whose config contains one of the labels (key=value or key).
+	ExcludeLabels []string `json:"excludeLabels,omitempty"`
+	// PushedBy restricts the purge to the images pushed by one of the identities.
+	PushedBy []string `json:"pushedBy,omitempty"`
+	// KeepPerGroup keeps the most recent tags of every value of the capture groups of the filters.
+	KeepPerGroup int `json:"keepPerGroup,omitempty"`
+	// Signatures is how the signed images are treated (protect, allow or only-unsigned), empty if they are not checked.
+	Signatures string `json:"signatures,omitempty"`
+	// KeepPinned is the path of a lockfile written by acr pin whose digests are kept.
+	KeepPinned string `json:"keepPinned,omitempty"`
+	// KeepIfPresentIn is the registry whose digests are kept, e.g. the production registry.
+	KeepIfPresentIn string `json:"keepIfPresentIn,omitempty"`
+	// Placeholders are the values of the placeholders of the repositories of the filters, e.g. team for
+	// {team}/app:^pr-.*, the placeholders without values match the repositories of the catalog.
+	Placeholders map[string][]string `json:"placeholders,omitempty"`
+	// IncludeReferrers deletes the referrer chains of the untagged manifests with them.
+	IncludeReferrers bool `json:"includeReferrers,omitempty"`
+	// AllowPartialUntag deletes the tags whose digest has other tags that are not deleted without looking for them.
+	AllowPartialUntag bool `json:"allowPartialUntag,omitempty"`
+	// KeepPartialUntag keeps the tags whose digest has other tags that are not deleted.
+	KeepPartialUntag bool `json:"keepPartialUntag,omitempty"`
+	// Windows restrict when the repositories are purged and which tags are deleted by the time they were created.
+	Windows []TimeWindow `json:"windows,omitempty"`
+	// Timezone is the IANA name of the timezone of the days and hours of the windows, UTC if it is empty.
+	Timezone string `json:"timezone,omitempty"`
+	// UntaggedAgo only deletes the untagged manifests that were last updated before this duration ago (e.g. 1d).
+	UntaggedAgo string `json:"untaggedAgo,omitempty"`
+}
+
+// OrderByTimeAsc lists the tags from the least to the most recently updated.
+const OrderByTimeAsc = api.OrderByTimeAsc
+
+// EnableTimeOrdering makes the run list the tags from the least recently updated and stop listing them once it
+// reaches a tag updated after the cutoff, so that only the expired tags are listed. Only the ACR API can order the
+// tags, it must not be enabled for other registries or snapshots.
+func (o *Options) EnableTimeOrdering(enabled bool) {
+	o.orderBy = ""
+	if enabled {
+		o.orderBy = OrderByTimeAsc
+	}
+}
+
+// SetMinAge protects the tags and manifests updated less than minAge before the time of the clock, so that images
+// pushed while the run goes on are never deleted even if the cutoff is the current time. A minAge of 0 disables it.
+// It returns the most recent last update time that can still be deleted.
+func (o *Options) SetMinAge(clock Clock, minAge time.Duration) time.Time {
+	o.minUpdateTime = time.Time{}
+	if minAge > 0 {
+		o.minUpdateTime = clock.Now().UTC().Add(-minAge)
+	}
+	return o.minUpdateTime
+}
+
+// isTooRecent returns true if the last update time is more recent than the minimum age allows. A time that cannot be
+// parsed is considered too recent so that nothing is deleted by mistake.
+func (o *Options) isTooRecent(lastUpdateTime *string) bool {
+	if o.minUpdateTime.IsZero() {
+		return false
+	}
+	if lastUpdateTime == nil {
+		return true
+	}
+	updated, err := time.Parse(time.RFC3339Nano, *lastUpdateTime)
+	return err != nil || updated.After(o.minUpdateTime)
+}
+
+// SetUntaggedAgo only deletes the untagged manifests last updated more than ago (e.g. 1d) before the time of the
+// clock, because the manifests of a pipeline are briefly untagged between their push and their tagging. An empty ago
+// disables it. It returns the most recent last update time an untagged manifest can have to be deleted.
+func (o *Options) SetUntaggedAgo(clock Clock, ago string) (time.Time, error) {
+	updateTime, err := untaggedCutoff(clock, ago)
+	if err != nil {
+		return time.Time{}, err
+	}
+	o.untaggedUpdateTime = updateTime
+	return o.untaggedUpdateTime, nil
+}
+
+// untaggedCutoff parses the untagged ago value into a last update time, zero if it is empty.
+func untaggedCutoff(clock Clock, ago string) (time.Time, error) {
+	if len(ago) == 0 {
+		return time.Time{}, nil
+	}
+	updateTime, err := Cutoff{Ago: ago}.Time(clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid untagged-ago value %q: %w", ago, err)
+	}
+	return updateTime, nil
+}
+
+// isUntaggedTooRecent returns true if an untagged manifest is too recent to be deleted, because of the minimum age or
+// because it was updated after the untagged cutoff of SetUntaggedAgo.
+func (o *Options) isUntaggedTooRecent(lastUpdateTime *string) bool {
+	if o.isTooRecent(lastUpdateTime) {
+		return true
+	}
+	updateTime := o.untaggedUpdateTime
+	if updateTime.IsZero() {
+		return false
+	}
+	if lastUpdateTime == nil {
+		return true
+	}
+	updated, err := time.Parse(time.RFC3339Nano, *lastUpdateTime)
+	return err != nil || !updated.Before(updateTime)
+}
+
+// GetTagFilters parses filters in the form <repository>:<regex filter> and returns a map that for every repository
+// contains a single regex made of all the filters of that repository. The filters on invalid repository names are
+// accepted with a warning of the options.
+func (o *Options) GetTagFilters(filters []string, matchOn string) (map[string]string, error) {
+	if matchOn != MatchOnTag && matchOn != MatchOnDigest {
+		return nil, fmt.Errorf("invalid match-on value %q, supported values are %q and %q", matchOn, MatchOnTag, MatchOnDigest)
+	}
+	// A map is used to keep the regex tags for every repository.
+	tagFilters := map[string][]string{}
+	for _, filter := range filters {
+		var repoName, tagRegex string
+		var err error
+		if matchOn == MatchOnDigest {
+			repoName, tagRegex, err = getRepositoryAndDigestRegex(filter)
+		} else {
+			repoName, tagRegex, err = getRepositoryAndTagRegex(filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := ValidateRepositoryName(repoName); err != nil && len(tagFilters[repoName]) == 0 {
+			o.warnf("%+q in filter %q is not a valid repository name: %v\n", repoName, filter, err)
+		}
+		tagFilters[repoName] = append(tagFilters[repoName], tagRegex)
+	}
+	result := map[string]string{}
+	for repoName, listOfTagRegex := range tagFilters {
+		// To only iterate through a repo once a big regex filter is made of all the filters of a particular repo.
+		result[repoName] = strings.Join(listOfTagRegex, "|")
+	}
+	return result, nil
+}
+
+// ReadFilters reads one <repository>:<regex filter> per line, blank lines and lines that start with # are ignored. Every
+// filter is parsed and its regular expression compiled so that a mistake is reported with its line number before any
+// tag is deleted.
+func ReadFilters(r io.Reader, matchOn string) ([]string, error) {
+	filters := []string{}
+	scanner := bufio.NewScanner(r)
+	// Generated filters can have very long regular expressions, so lines of up to 1MB are allowed.
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var tagRegex string
+		var err error
+		if matchOn == MatchOnDigest {
+			_, tagRegex, err = getRepositoryAndDigestRegex(line)
+		} else {
+			_, tagRegex, err = getRepositoryAndTagRegex(line)
+		}
+		if err == nil {
+			_, err = regexp.Compile(tagRegex)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter on line %d: %w", lineNumber, err)
+		}
+		filters = append(filters, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read filters after line %d: %w", lineNumber, err)
+	}
+	return filters, nil
+}
+
+// Summary counts the tags or manifests a purge of a repository went through. It is returned together with the error
+// of a failed purge, so the deletions made before the failure are still counted.
+type Summary struct {
+	// Scanned is the number of tags or manifests listed.
+	Scanned int `json:"scanned"`
+	// Deleted is the number of tags or manifests deleted.
+	Deleted int `json:"deleted"`
+	// Skipped is the number of tags or manifests that matched the filter and were older than the cutoff but were kept
+	// (e.g. locked or too recent), or were already deleted when the purge tried to delete them.
+	Skipped int `json:"skipped"`
+	// Failed is the number of tags or manifests whose deletion failed.
+	Failed int `json:"failed"`
+}
+
+// Add adds the counts of another summary, e.g. the one of another repository.
+func (s *Summary) Add(other Summary) {
+	s.Scanned += other.Scanned
+	s.Deleted += other.Deleted
+	s.Skipped += other.Skipped
+	s.Failed += other.Failed
+}
+
+// Tags deletes all tags that were last updated before the cutoff and that match the tagFilter string, depending on matchOn
+// the filter is applied to the tag name or to the digest the tag references. The age of the tags is measured from the
+// time the clock returns. If onlySuperseded is set a tag is only deleted when a more recent matching tag references
+// a different digest. The rest of the configuration of the run is in the options.
+func Tags(ctx context.Context, acrClient api.AcrCLIClientInterface, clock Clock, loginURL string, repoName string, cutoff Cutoff, tagFilter string, matchOn string, onlySuperseded bool, opts *Options) (Summary, error) {
+	opts.printf("Deleting tags for repository: %s\n", repoName)
+	summary := Summary{}
+	timeToCompare, err := cutoff.Time(clock)
+	if err != nil {
+		return summary, err
+	}
+	tagRegex, err := regexp.Compile(tagFilter)
+	if err != nil {
+		return summary, err
+	}
+	var superseded *supersededTags
+	if onlySuperseded {
+		superseded, err = opts.getSupersededTags(ctx, acrClient, repoName, tagRegex, matchOn)
+		if err != nil {
+			return summary, err
+		}
+	}
+	keptByGroup, err := opts.getKeptByGroup(ctx, acrClient, repoName, tagRegex, matchOn)
+	if err != nil {
+		return summary, err
+	}
+	aliases := opts.getTagAliases(acrClient, repoName, tagRegex, matchOn, timeToCompare, superseded, keptByGroup)
+	// When the purge is restricted to an artifact type only the tags that reference one of its manifests are deleted.
+	digests, err := opts.artifactDigests(ctx, acrClient, repoName)
+	if err != nil {
+		return summary, err
+	}
+	tagPager := newTagPager(acrClient, repoName, opts.orderBy, tagRegex, matchOn)
+	// A purge that was aborted continues listing the tags after the last page it purged.
+	if opts.state != nil {
+		repoState := opts.state.Repository(repoName)
+		if repoState.TagsDone {
+			opts.printf("Skipping the tags of repository %s, they were purged before\n", repoName)
+			return summary, nil
+		}
+		tagPager.Seek(repoState.TagsLast)
+	}
+	// nextTags lists the next page of tags to delete, the tags that are kept are counted as skipped.
+	nextTags := func() (*[]acr.TagAttributesBase, error) {
+		kept := []KeptTag{}
+		tags, err := opts.getTagsToDelete(ctx, tagPager, tagRegex, matchOn, timeToCompare, superseded, nil, &kept)
+		summary.Scanned = tagPager.Listed()
+		summary.Skipped += len(kept)
+		if err != nil || tags == nil {
+			return tags, err
+		}
+		filtered, err := opts.onlyPushedBy(ctx, acrClient, repoName, withoutKeptByGroup(ofArtifactType(tags, digests), keptByGroup))
+		if err != nil {
+			return nil, err
+		}
+		filtered, err = opts.withoutExcludedLabels(ctx, acrClient, repoName, filtered)
+		if err != nil {
+			return nil, err
+		}
+		filtered, err = opts.withoutSigned(ctx, acrClient, repoName, opts.withoutPinned(repoName, filtered))
+		if err != nil {
+			return nil, err
+		}
+		filtered, err = opts.withoutPresentInReference(ctx, repoName, filtered)
+		if err != nil {
+			return nil, err
+		}
+		filtered, err = opts.withoutPartialUntags(ctx, repoName, opts.withoutOutsideCreatedWindows(repoName, filtered), aliases)
+		if err != nil {
+			return nil, err
+		}
+		summary.Skipped += len(*tags) - len(*filtered)
+		return filtered, nil
+	}
+	tagsToDelete, err := nextTags()
+	if err != nil {
+		return summary, err
+	}
+	// getTagsToDelete will return nil when there are no more tags.
+	for tagsToDelete != nil {
+		if opts.csvReport != nil {
+			opts.csvReport.expectTags(ctx, acrClient, repoName, *tagsToDelete)
+		}
+		// To not overflow the error channel capacity the Tags function waits for a whole block of
+		// 100 jobs to be finished before continuing.
+		if err := opts.deleteTagsAndWait(loginURL, repoName, *tagsToDelete, &summary); err != nil {
+			return summary, err
+		}
+		if opts.state != nil {
+			if err := opts.state.tagsPurged(repoName, tagPager.Cursor(), false); err != nil {
+				return summary, err
+			}
+		}
+		tagsToDelete, err = nextTags()
+		if err != nil {
+			return summary, err
+		}
+	}
+	if opts.state != nil {
+		if err := opts.state.tagsPurged(repoName, "", true); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+// deleteTagsAndWait queues the deletion of a block of at most 100 tags and waits until all of them are processed.
+// If batch deletion is enabled the tags are grouped in batches of at most batchSize tags. Once the maximum number of
+// deletions is reached the rest of the tags are not queued and ErrMaxDeletes is returned.
+func (o *Options) deleteTagsAndWait(loginURL string, repoName string, tags []acr.TagAttributesBase, summary *Summary) error {
+	notDeleted := len(tags) - o.allowDeletes(len(tags))
+	tags = tags[:len(tags)-notDeleted]
+	batch := o.newBatch()
+	if o.batchSize > 1 {
+		for start := 0; start < len(tags); start += o.batchSize {
+			end := start + o.batchSize
+			if end > len(tags) {
+				end = len(tags)
+			}
+			names := []string{}
+			digests := []string{}
+			for _, tag := range tags[start:end] {
+				names = append(names, *tag.Name)
+				digests = append(digests, *tag.Digest)
+			}
+			batch.QueuePurgeTagBatch(loginURL, repoName, names, digests)
+		}
+		return o.waitForLimitedWorkers(batch, repoName, notDeleted, summary)
+	}
+	for _, tag := range tags {
+		// The purge job is queued, after a purge worker picks it up the tag will be deleted.
+		batch.QueuePurgeTag(loginURL, repoName, *tag.Name, *tag.Digest)
+	}
+	return o.waitForLimitedWorkers(batch, repoName, notDeleted, summary)
+}
+
+// deleteManifestsAndWait queues the deletion of a set of manifests, it periodically waits for the workers and checks
+// for errors so that a purge that fails stops early. Once the maximum number of deletions is reached the rest of the
+// manifests are not queued and ErrMaxDeletes is returned.
+func (o *Options) deleteManifestsAndWait(loginURL string, repoName string, manifests []acr.ManifestAttributesBase, summary *Summary) error {
+	notDeleted := len(manifests) - o.allowDeletes(len(manifests))
+	manifests = manifests[:len(manifests)-notDeleted]
+	batch := o.newBatch()
+	for i, manifest := range manifests {
+		batch.QueuePurgeManifest(loginURL, repoName, *manifest.Digest)
+		if math.Mod(float64(i), 100) == 0 {
+			if err := waitForWorkers(batch, summary); err != nil {
+				return err
+			}
+		}
+	}
+	// Wait for all the worker jobs to finish.
+	return o.waitForLimitedWorkers(batch, repoName, notDeleted, summary)
+}
+
+// waitForWorkers waits for all the jobs queued by the batch to finish, adds their results to the summary unless it is
+// nil and returns the first error reported by a worker.
+func waitForWorkers(batch *worker.Batch, summary *Summary) error {
+	result := batch.Wait()
+	if summary != nil {
+		summary.Deleted += result.Deleted
+		summary.Skipped += result.Skipped
+		summary.Failed += result.Failed
+	}
+	return result.Err
+}
+
+// getRepositoryAndTagRegex splits the strings that are in the form <repository>:<regex filter>
+func getRepositoryAndTagRegex(filter string) (string, string, error) {
+	repoAndRegex := strings.Split(filter, ":")
+	if len(repoAndRegex) != 2 {
+		return "", "", errors.New("unable to correctly parse filter flag")
+	}
+	return repoAndRegex[0], repoAndRegex[1], nil
+}
+
+// getRepositoryAndDigestRegex splits the strings that are in the form <repository>:<regex filter>, contrary to
+// getRepositoryAndTagRegex the regex filter can contain colons because digests are in the form <algorithm>:<hex>.
+func getRepositoryAndDigestRegex(filter string) (string, string, error) {
+	repoAndRegex := strings.SplitN(filter, ":", 2)
+	if len(repoAndRegex) != 2 {
+		return "", "", errors.New("unable to correctly parse filter flag")
+	}
+	return repoAndRegex[0], repoAndRegex[1], nil
+}
+
+// Cutoff defines how old a tag has to be to be purged, either relative to the current time with Ago or as a fixed
+// date with Before, only one of them can be set.
+type Cutoff struct {
+	Ago    string
+	Before string
+}
+
+// Time returns the time tags have to be last updated before in order to be purged.
+func (c Cutoff) Time(clock Clock) (time.Time, error) {
+	if len(c.Before) > 0 {
+		if len(c.Ago) > 0 {
+			return time.Time{}, errors.New("the ago and before values are mutually exclusive")
+		}
+		return ParseBefore(c.Before)
+	}
+	ago, err := ParseAgo(c.Ago)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ago.Before(clock.Now().UTC()), nil
+}
+
+// ParseBefore parses a date cutoff, it can be an RFC3339 time (e.g. 2024-01-31T08:00:00Z) or a date (e.g. 2024-01-31)
+// which is interpreted as midnight UTC.
+func ParseBefore(before string) (time.Time, error) {
+	if beforeTime, err := time.Parse(time.RFC3339Nano, before); err == nil {
+		return beforeTime.UTC(), nil
+	}
+	beforeTime, err := time.Parse("2006-01-02", before)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid before value %q, the format is 2006-01-02 or RFC3339", before)
+	}
+	return beforeTime, nil
+}
+
+// Ago is a time relative to the current time, the years, months, weeks and days are calendar units that are
+// subtracted with time.AddDate so that 1mo is always the same day of the previous month whatever the length of the
+// months, the rest is a Go duration.
+type Ago struct {
+	Years    int
+	Months   int
+	Days     int
+	Duration time.Duration
+}
+
+// calendarUnitRegex matches a calendar unit at the beginning of an ago value, mo is matched before the m of minutes.
+var calendarUnitRegex = regexp.MustCompile(`^([0-9]+)(y|mo|w|d)`)
+
+// ParseAgo parses an ago value made of calendar units, y (years), mo (months), w (weeks) and d (days), followed by a
+// Go duration (e.g. 1y6mo, 2w3d or 1d12h).
+func ParseAgo(ago string) (Ago, error) {
+	result := Ago{}
+	if len(ago) == 0 {
+		return result, errors.New("the ago value cannot be empty")
+	}
+	rest := ago
+	for {
+		match := calendarUnitRegex.FindStringSubmatch(rest)
+		if match == nil {
+			break
+		}
+		rest = rest[len(match[0]):]
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			return Ago{}, fmt.Errorf("invalid ago value %q: %w", ago, err)
+		}
+		switch match[2] {
+		case "y":
+			result.Years += n
+		case "mo":
+			result.Months += n
+		case "w":
+			result.Days += 7 * n
+		case "d":
+			result.Days += n
+		}
+	}
+	if len(rest) > 0 {
+		duration, err := time.ParseDuration(rest)
+		if err != nil {
+			return Ago{}, err
+		}
+		result.Duration = duration
+	}
+	return result, nil
+}
+
+// Before returns the time that is the ago value before t.
+func (a Ago) Before(t time.Time) time.Time {
+	return t.AddDate(-a.Years, -a.Months, -a.Days).Add(-a.Duration)
+}
+
+// ParseDuration analog to time.ParseDuration() but with days and weeks added, the duration is negative. Months and
+// years do not have a fixed duration so they are only supported by ParseAgo.
+func ParseDuration(ago string) (time.Duration, error) {
+	parsed, err := ParseAgo(ago)
+	if err != nil {
+		return time.Duration(0), err
+	}
+	if parsed.Years != 0 || parsed.Months != 0 {
+		return time.Duration(0), fmt.Errorf("months and years in %q do not have a fixed duration", ago)
+	}
+	// The number of days gets converted to hours.
+	duration := time.Duration(parsed.Days)*24*time.Hour + parsed.Duration
+	return (-1 * duration), nil
+}
+
+// getTagsToDelete gets all tags that should be deleted according to the ago flag and the filter flag, the filter is matched against
+// the tag name or the tag digest depending on the matchOn value, this will at most return one page of tags from the tagPager,
+// returns a pointer to a slice that contains the tags that will be deleted, the pointer is nil when there are no more tags,
+// and an error in case it occurred. If superseded is not nil only the tags it reports as superseded are returned.
+// If countMap is not nil the number of tags that reference every digest is added to it, this way the tags only have
+// to be listed once to also know which manifests would be left without tags. If kept is not nil the tags that match
+// the filter and were last updated before the cutoff but are kept anyway are added to it with the reason.
+func (o *Options) getTagsToDelete(ctx context.Context,
+	tagPager *api.TagPager,
+	filter *regexp.Regexp,
+	matchOn string,
+	timeToCompare time.Time,
+	superseded *supersededTags,
+	countMap map[string]int,
+	kept *[]KeptTag) (*[]acr.TagAttributesBase, error) {
+
+	var lastUpdateTime time.Time
+	resultTags, err := tagPager.Next(ctx)
+	if err != nil {
+		if errors.Is(err, api.ErrNotFound) {
+			o.printf("%s repository not found\n", tagPager.RepoName())
+			return nil, nil
+		}
+		// A nil slice is returned so there will not be any tag purged.
+		return nil, err
+	}
+	if resultTags != nil && resultTags.TagsAttributes != nil && len(*resultTags.TagsAttributes) > 0 {
+		tags := *resultTags.TagsAttributes
+		o.emitPageScanned(tagPager.RepoName(), progressKindTags, len(tags), tagPager.Listed())
+		tagsToDelete := []acr.TagAttributesBase{}
+		// When the tags are listed from the least recently updated the rest of the tags are newer than the first tag
+		// updated after the cutoff, so the listing stops there. The counts of the tags of every digest need all of them.
+		ordered := tagPager.OrderBy() == OrderByTimeAsc && countMap == nil
+		for _, tag := range tags {
+			if ordered {
+				if updated, err := time.Parse(time.RFC3339Nano, *tag.LastUpdateTime); err == nil && !updated.Before(timeToCompare) {
+					tagPager.Stop()
+					break
+				}
+			}
+			if countMap != nil {
+				countMap[*tag.Digest]++
+			}
+			o.warnUnexpectedTagName(tagPager.RepoName(), *tag.Name)
+			matches, err := o.matchesFilter(tag, filter, matchOn)
+			if err != nil {
+				return nil, err
+			}
+			if !matches {
+				// If a tag does not match the regex then it not added to the list no matter the LastUpdateTime
+				continue
+			}
+			lastUpdateTime, err = time.Parse(time.RFC3339Nano, *tag.LastUpdateTime)
+			if err != nil {
+				return nil, err
+			}
+			if !lastUpdateTime.Before(timeToCompare) {
+				continue
+			}
+			keepReason := o.tagKeepReason(tag, lastUpdateTime, superseded)
+			// If a tag did match the regex filter, is older than the specified duration and can be deleted then it is returned
+			// as a tag to delete.
+			if len(keepReason) == 0 {
+				tagsToDelete = append(tagsToDelete, tag)
+			} else if kept != nil {
+				*kept = append(*kept, KeptTag{Tag: tag, Reason: keepReason})
+			}
+		}
+		return &tagsToDelete, nil
+	}
+	// In case there are no more tags return nil so that the Tags function stops
+	return nil, nil
+}
+
+// tagKeepReason returns why a tag that matches the filter and was last updated before the cutoff is kept, or an empty
+// string if it can be deleted.
+func (o *Options) tagKeepReason(tag acr.TagAttributesBase, lastUpdateTime time.Time, superseded *supersededTags) string {
+	switch {
+	case superseded != nil && !superseded.isSuperseded(*tag.Digest, lastUpdateTime):
+		// The tag is the most recent build of the matching tags so it is kept.
+		return KeepReasonNotSuperseded
+	case !*(*tag.ChangeableAttributes).DeleteEnabled:
+		return KeepReasonLocked
+	case o.isTooRecent(tag.LastUpdateTime):
+		return KeepReasonMinAge
+	}
+	return ""
+}
+
+// matchesFilter returns true if the tag name or the tag digest, depending on matchOn, matches the filter. The filter is
+// matched against the name exactly as the registry returns it, without normalization or case folding. An error is
+// returned if the filters exceeded the filter timeout.
+func (o *Options) matchesFilter(tag acr.TagAttributesBase, filter *regexp.Regexp, matchOn string) (bool, error) {
+	if matchOn == MatchOnDigest {
+		return o.matchFilter(filter, *tag.Digest)
+	}
+	return o.matchFilter(filter, *tag.Name)
+}
+
+// supersededTags keeps track of the most recent matching tag and of the most recent matching tag that references a
+// different digest, with them it can be determined if a newer tag references a different digest than a given tag.
+type supersededTags struct {
+	newestDigest string
+	newestTime   time.Time
+	// runnerUpTime is the most recent update time of the tags that do not reference newestDigest.
+	runnerUpTime time.Time
+	hasRunnerUp  bool
+}
+
+// add registers a matching tag.
+func (s *supersededTags) add(digest string, lastUpdateTime time.Time) {
+	switch {
+	case len(s.newestDigest) == 0:
+		s.newestDigest = digest
+		s.newestTime = lastUpdateTime
+	case digest == s.newestDigest:
+		if lastUpdateTime.After(s.newestTime) {
+			s.newestTime = lastUpdateTime
+		}
+	case lastUpdateTime.After(s.newestTime):
+		// The previous newest digest is now the most recent of the other digests.
+		s.runnerUpTime = s.newestTime
+		s.hasRunnerUp = true
+		s.newestDigest = digest
+		s.newestTime = lastUpdateTime
+	case !s.hasRunnerUp || lastUpdateTime.After(s.runnerUpTime):
+		s.runnerUpTime = lastUpdateTime
+		s.hasRunnerUp = true
+	}
+}
+
+// isSuperseded returns true if a matching tag more recent than lastUpdateTime references a digest other than digest.
+func (s *supersededTags) isSuperseded(digest string, lastUpdateTime time.Time) bool {
+	if len(s.newestDigest) == 0 {
+		return false
+	}
+	if digest != s.newestDigest {
+		return s.newestTime.After(lastUpdateTime)
+	}
+	return s.hasRunnerUp && s.runnerUpTime.After(lastUpdateTime)
+}
+
+// getSupersededTags lists all the tags of a repository that match the filter to find out which ones are superseded.
+func (o *Options) getSupersededTags(ctx context.Context, acrClient api.TagLister, repoName string, filter *regexp.Regexp, matchOn string) (*supersededTags, error) {
+	superseded := &supersededTags{}
+	tagPager := newTagPager(acrClient, repoName, "", filter, matchOn)
+	resultTags, err := tagPager.Next(ctx)
+	if err != nil {
+		if errors.Is(err, api.ErrNotFound) {
+			// The repository not found case is reported when the tags to delete are obtained.
+			return superseded, nil
+		}
+		return nil, err
+	}
+	for resultTags != nil && resultTags.TagsAttributes != nil {
+		for _, tag := range *resultTags.TagsAttributes {
+			matches, err := o.matchesFilter(tag, filter, matchOn)
+			if err != nil {
+				return nil, err
+			}
+			if !matches {
+				continue
+			}
+			lastUpdateTime, err := time.Parse(time.RFC3339Nano, *tag.LastUpdateTime)
+			if err != nil {
+				return nil, err
+			}
+			superseded.add(*tag.Digest, lastUpdateTime)
+		}
+		resultTags, err = tagPager.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return superseded, nil
+}
+
+// DanglingManifests deletes all manifests that do not have any tags associated with them, the rest of the
+// configuration of the run is in the options.
+func DanglingManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string, opts *Options) (Summary, error) {
+	opts.printf("Deleting manifests for repository: %s\n", repoName)
+	summary := Summary{}
+	// Contrary to getTagsToDelete, all the Manifests are listed before any is deleted, this was done because if there is a manifest that has no
+	// tag but is referenced by a multiarch manifest that has tags then it should not be deleted. The referrer chains need all the manifests too,
+	// otherwise a repository with too many untagged manifests to keep in memory is listed again and purged page by page.
+	listing, err := opts.listUntaggedManifests(ctx, acrClient, repoName, !opts.includeReferrers)
+	if err != nil {
+		return summary, err
+	}
+	if listing.streamed {
+		err := opts.streamDanglingManifests(ctx, acrClient, loginURL, repoName, listing.doNotDelete, &summary)
+		return summary, err
+	}
+	manifestsToDelete, referrers, err := opts.listedManifestsToDelete(ctx, acrClient, repoName, listing, &summary)
+	if err != nil {
+		return summary, err
+	}
+	// The referrers are deleted before the manifests they refer to, so the manifests are deleted in waves.
+	for _, wave := range referrerWaves(*manifestsToDelete, referrers) {
+		if err := opts.deleteManifestWave(loginURL, repoName, wave, &summary); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+// deleteManifestWave deletes manifests that can be deleted at the same time. With a state the manifests it records
+// as deleted are skipped and the rest are deleted in blocks, every block is checkpointed.
+func (o *Options) deleteManifestWave(loginURL string, repoName string, wave []acr.ManifestAttributesBase, summary *Summary) error {
+	if o.state == nil {
+		if o.csvReport != nil {
+			o.csvReport.expectManifests(repoName, wave)
+		}
+		return o.deleteManifestsAndWait(loginURL, repoName, wave, summary)
+	}
+	manifests := o.state.withoutDeleted(repoName, wave)
+	for start := 0; start < len(manifests); start += stateBlockSize {
+		end := start + stateBlockSize
+		if end > len(manifests) {
+			end = len(manifests)
+		}
+		if o.csvReport != nil {
+			o.csvReport.expectManifests(repoName, manifests[start:end])
+		}
+		if err := o.deleteManifestsAndWait(loginURL, repoName, manifests[start:end], summary); err != nil {
+			return err
+		}
+		if err := o.state.manifestsDeleted(repoName, manifests[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmptyRepository deletes the repository if it has no manifests left, every deletion is logged with the time of the
+// clock of the options so that it can be audited. A repository that is not found is skipped. If dryRun is set nothing
+// was deleted before, so the repository is only reported if the plan of its dry run deletes every manifest it has and
+// keeps none of the tags that matched.
+func EmptyRepository(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string, dryRun bool, plan *RepositoryPlan, opts *Options) (bool, error) {
+	if dryRun {
+		emptied, err := emptiedByPlan(ctx, acrClient, repoName, plan)
+		if emptied {
+			opts.printf("Empty repository %s/%s would be deleted\n", loginURL, repoName)
+		}
+		return emptied, err
+	}
+	resultManifests, err := api.NewManifestPager(acrClient, repoName, "").Next(ctx)
+	if err != nil {
+		if errors.Is(err, api.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if resultManifests.ManifestsAttributes != nil && len(*resultManifests.ManifestsAttributes) > 0 {
+		return false, nil
+	}
+	resp, err := acrClient.DeleteAcrRepository(ctx, repoName)
+	if err != nil {
+		if errors.Is(api.ResponseError(err, resp, api.PermissionDelete, repoName), api.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	opts.printf("Deleted empty repository %s/%s at %s\n", loginURL, repoName, opts.clock.Now().UTC().Format(time.RFC3339))
+	return true, nil
+}
+
+// emptiedByPlan returns true if the plan deletes every manifest of the repository and keeps none of its tags, i.e.
+// the repository would be empty once the plan is executed.
+func emptiedByPlan(ctx context.Context, acrClient api.ManifestLister, repoName string, plan *RepositoryPlan) (bool, error) {
+	if plan == nil || len(plan.Kept) > 0 {
+		return false, nil
+	}
+	planned := map[string]bool{}
+	for _, manifest := range plan.Manifests {
+		planned[*manifest.Digest] = true
+	}
+	manifests := acrapi.NewManifestIterator(acrClient, repoName, "")
+	for manifests.Next(ctx) {
+		if manifest := manifests.Manifest(); manifest.Digest != nil && !planned[*manifest.Digest] {
+			return false, nil
+		}
+	}
+	if manifests.NotFound() {
+		return false, nil
+	}
+	return manifests.Err() == nil, manifests.Err()
+}
+
+// GetManifestsToDelete gets all the manifests that should be deleted, this means that do not have any tag and that do not form part
+// of a manifest list that has tags referencing it.
+func GetManifestsToDelete(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, opts *Options) (*[]acr.ManifestAttributesBase, error) {
+	manifestsToDelete, _, err := opts.getManifestsToDelete(ctx, acrClient, repoName, nil)
+	return manifestsToDelete, err
+}
+
+// getManifestsToDelete is GetManifestsToDelete but if summary is not nil the listed manifests are counted as scanned
+// and the untagged manifests that are kept (e.g. locked or too recent) as skipped. If the referrers are included the
+// referrers of every manifest are returned too.
+func (o *Options) getManifestsToDelete(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, summary *Summary) (*[]acr.ManifestAttributesBase, map[string][]string, error) {
+	listing, err := o.listUntaggedManifests(ctx, acrClient, repoName, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return o.listedManifestsToDelete(ctx, acrClient, repoName, listing, summary)
+}
+
+// listedManifestsToDelete is getManifestsToDelete for the manifests of a listing that is not streamed.
+func (o *Options) listedManifestsToDelete(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, listing *untaggedListing, summary *Summary) (*[]acr.ManifestAttributesBase, map[string][]string, error) {
+	manifestsToDelete, unreferenced, err := o.selectManifestsToDelete(ctx, acrClient, repoName, listing.candidates, listing.doNotDelete)
+	if err != nil {
+		return nil, nil, err
+	}
+	if summary != nil {
+		summary.Scanned += listing.scanned
+		summary.Skipped += unreferenced - len(manifestsToDelete)
+	}
+	manifestsToDelete, referrers, err := o.withReferrerChains(ctx, acrClient, repoName, manifestsToDelete, listing.listed, func(manifest acr.ManifestAttributesBase) bool {
+		return manifest.Tags != nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &manifestsToDelete, referrers, nil
+}
+
+// untaggedListing is the result of the listing of the manifests of a repository by the untagged purge.
+type untaggedListing struct {
+	// doNotDelete acts as a set, the manifests referenced by a manifest list that has tags must not be deleted.
+	doNotDelete map[string]bool
+	// candidates are the manifests without tags, they are nil if the listing is streamed.
+	candidates []acr.ManifestAttributesBase
+	// listed are all the manifests by digest, they are nil if the listing is streamed.
+	listed  map[string]acr.ManifestAttributesBase
+	scanned int
+	// streamed is true if there were too many candidates to keep them in memory, they have to be listed again.
+	streamed bool
+}
+
+// listUntaggedManifests lists all the manifests of a repository to find the ones without tags and the ones referenced
+// by a manifest list that has tags. If stream is set and there are more than streamThreshold candidates they are
+// dropped and only the manifests that must not be deleted are kept. A repository that is not found has no manifests.
+func (o *Options) listUntaggedManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, stream bool) (*untaggedListing, error) {
+	listing := &untaggedListing{
+		doNotDelete: map[string]bool{},
+		candidates:  []acr.ManifestAttributesBase{},
+		listed:      map[string]acr.ManifestAttributesBase{},
+	}
+	manifestPager := api.NewManifestPager(acrClient, repoName, "")
+	resultManifests, err := manifestPager.Next(ctx)
+	if err != nil {
+		if errors.Is(err, api.ErrNotFound) {
+			o.printf("%s repository not found\n", repoName)
+			return listing, nil
+		}
+		return nil, err
+	}
+	// Iterate over all manifests to discover multiarchitecture manifests
+	for resultManifests != nil && resultManifests.ManifestsAttributes != nil {
+		manifests := *resultManifests.ManifestsAttributes
+		o.emitPageScanned(repoName, progressKindManifests, len(manifests), manifestPager.Listed())
+		for _, manifest := range manifests {
+			if !listing.streamed {
+				listing.listed[*manifest.Digest] = manifest
+			}
+			if *manifest.MediaType == manifestListContentType && manifest.Tags != nil {
+				// If a manifest list is found and it has tags then all the dependent digests are
+				// marked to not be deleted.
+				var manifestListBytes []byte
+				manifestListBytes, err = acrClient.GetManifest(ctx, repoName, *manifest.Digest)
+				if err != nil {
+					return nil, err
+				}
+				var manifestList multiArchManifest
+				err = json.Unmarshal(manifestListBytes, &manifestList)
+				if err != nil {
+					return nil, err
+				}
+				for _, dependentDigest := range manifestList.Manifests {
+					listing.doNotDelete[dependentDigest.Digest] = true
+				}
+			} else if manifest.Tags == nil && !listing.streamed {
+				// If the manifest has no tags left it is a candidate for deletion
+				listing.candidates = append(listing.candidates, manifest)
+			}
+		}
+		if stream && !listing.streamed && len(listing.candidates) > streamThreshold {
+			o.printf("Repository %s has more than %d untagged manifests, they are deleted page by page\n", repoName, streamThreshold)
+			listing.streamed = true
+			listing.candidates = nil
+			listing.listed = nil
+		}
+		resultManifests, err = manifestPager.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	listing.scanned = manifestPager.Listed()
+	return listing, nil
+}
+
+// selectManifestsToDelete returns the candidates that are not referenced by a manifest list with tags and can be
+// deleted, and the number of candidates that are not referenced.
+func (o *Options) selectManifestsToDelete(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, candidates []acr.ManifestAttributesBase, doNotDelete map[string]bool) ([]acr.ManifestAttributesBase, int, error) {
+	manifestsToDelete := []acr.ManifestAttributesBase{}
+	// Remove all manifests that should not be deleted
+	unreferenced := 0
+	for i := 0; i < len(candidates); i++ {
+		if _, ok := doNotDelete[*candidates[i].Digest]; !ok {
+			unreferenced++
+			// if a manifest has no tags, is not part of a manifest list and can be deleted then it is added to the
+			// manifestToDelete array.
+			if *(*candidates[i].ChangeableAttributes).DeleteEnabled && !o.isUntaggedTooRecent(candidates[i].LastUpdateTime) && o.isArtifactType(candidates[i]) && !isTombstone(candidates[i]) {
+				manifestsToDelete = append(manifestsToDelete, candidates[i])
+			}
+		}
+	}
+	manifestsToDelete, err := o.onlyPushedByManifests(ctx, acrClient, repoName, manifestsToDelete)
+	if err != nil {
+		return nil, 0, err
+	}
+	manifestsToDelete, err = o.withoutExcludedManifests(ctx, acrClient, repoName, manifestsToDelete)
+	if err != nil {
+		return nil, 0, err
+	}
+	manifestsToDelete, err = o.withoutSignedManifests(ctx, acrClient, repoName, o.withoutPinnedManifests(repoName, manifestsToDelete))
+	if err != nil {
+		return nil, 0, err
+	}
+	manifestsToDelete, err = o.withoutPresentInReferenceManifests(ctx, repoName, manifestsToDelete)
+	if err != nil {
+		return nil, 0, err
+	}
+	return manifestsToDelete, unreferenced, nil
+}
+
+// DryRun outputs everything that would be deleted if the purge command was executed.
+// The summaries of the tags and of the manifests count what would be deleted as deleted.
+func DryRun(ctx context.Context, acrClient api.AcrCLIClientInterface, clock Clock, loginURL string, repoName string, cutoff Cutoff, filter string, matchOn string, onlySuperseded bool, untagged bool, opts *Options) (Summary, Summary, error) {
+	opts.printf("Deleting tags for repository: %s\n", repoName)
+	repoPlan, err := DryRunPlan(ctx, acrClient, clock, repoName, cutoff, filter, matchOn, onlySuperseded, untagged, opts)
+	if err != nil {
+		return Summary{}, Summary{}, err
+	}
+	printRepositoryPlan(opts.out, loginURL, repoPlan, untagged)
+	return repoPlan.TagSummary(), repoPlan.ManifestSummary(), nil
+}
+
+// DryRunPlan returns everything that would be deleted from a repository if the purge command was executed, and the
+// tags that would be kept, so that the caller can print it. The CSV report is written if it is enabled.
+func DryRunPlan(ctx context.Context, acrClient api.AcrCLIClientInterface, clock Clock, repoName string, cutoff Cutoff, filter string, matchOn string, onlySuperseded bool, untagged bool, opts *Options) (*RepositoryPlan, error) {
+	repoPlan, err := opts.planRepository(ctx, acrClient, clock, repoName, cutoff, filter, matchOn, onlySuperseded, untagged)
+	if err != nil {
+		return nil, err
+	}
+	if opts.csvReport != nil {
+		opts.csvReport.writeTags(ctx, acrClient, repoName, repoPlan.Tags, ResultWouldDelete)
+		opts.csvReport.writeManifests(repoName, repoPlan.Manifests, ResultWouldDelete)
+	}
+	return repoPlan, nil
+}
+
+// PrintPlan prints a plan to out the same way DryRun prints the plan of every repository.
+func PrintPlan(out io.Writer, plan *Plan, untagged bool) {
+	for i := range plan.Repositories {
+		fmt.Fprintf(out, "Deleting tags for repository: %s\n", plan.Repositories[i].Name)
+		printRepositoryPlan(out, plan.LoginURL, &plan.Repositories[i], untagged)
+	}
+}
+
+// printRepositoryPlan prints the tags and, if untagged is set, the manifests of a repository plan.
+func printRepositoryPlan(out io.Writer, loginURL string, repoPlan *RepositoryPlan, untagged bool) {
+	for _, tag := range repoPlan.Tags {
+		if coTags, ok := repoPlan.CoTags[*tag.Name]; ok {
+			fmt.Fprintf(out, "%s/%s:%s (%s is also tagged %s)\n", loginURL, repoPlan.Name, *tag.Name, *tag.Digest, strings.Join(coTags, ", "))
+			continue
+		}
+		fmt.Fprintf(out, "%s/%s:%s\n", loginURL, repoPlan.Name, *tag.Name)
+	}
+	for _, kept := range repoPlan.Kept {
+		if kept.Reason == KeepReasonPartialUntag {
+			fmt.Fprintf(out, "Keeping %s/%s:%s, %s is also tagged %s\n", loginURL, repoPlan.Name, *kept.Tag.Name, *kept.Tag.Digest, strings.Join(repoPlan.CoTags[*kept.Tag.Name], ", "))
+		}
+	}
+	if untagged {
+		fmt.Fprintf(out, "Deleting manifests for repository: %s\n", repoPlan.Name)
+		for _, manifest := range repoPlan.Manifests {
+			fmt.Fprintf(out, "%s/%s@%s\n", loginURL, repoPlan.Name, *manifest.Digest)
+		}
+	}
+}
+
+// planRepository returns the tags and manifests that would be deleted from a repository without deleting anything.
+func (o *Options) planRepository(ctx context.Context, acrClient api.AcrCLIClientInterface, clock Clock, repoName string, cutoff Cutoff, filter string, matchOn string, onlySuperseded bool, untagged bool) (*RepositoryPlan, error) {
+	repoPlan := &RepositoryPlan{
+		Name:      repoName,
+		Tags:      []acr.TagAttributesBase{},
+		Manifests: []acr.ManifestAttributesBase{},
+		Kept:      []KeptTag{},
+		Sizes:     map[string]int64{},
+	}
+	// In order to keep track if a manifest would get deleted a map is defined that as a  key has the manifest
+	// digest and as the value the number of tags (referencing said manifests) that were deleted.
+	deletedTags := map[string]int{}
+	// The countMap contains a map that for every digest contains how many tags are referencing it, it is filled while
+	// the tags to delete are obtained.
+	countMap := map[string]int{}
+	timeToCompare, err := cutoff.Time(clock)
+	if err != nil {
+		return nil, err
+	}
+	regex, err := regexp.Compile(filter)
+	if err != nil {
+		return nil, err
+	}
+	var superseded *supersededTags
+	if onlySuperseded {
+		superseded, err = o.getSupersededTags(ctx, acrClient, repoName, regex, matchOn)
+		if err != nil {
+			return nil, err
+		}
+	}
+	keptByGroup, err := o.getKeptByGroup(ctx, acrClient, repoName, regex, matchOn)
+	if err != nil {
+		return nil, err
+	}
+	aliases := o.getTagAliases(acrClient, repoName, regex, matchOn, timeToCompare, superseded, keptByGroup)
+	// The untagged manifests are found by counting the tags of every digest, so all the tags are listed.
+	orderBy := o.orderBy
+	if untagged {
+		orderBy = ""
+	}
+	digests, err := o.artifactDigests(ctx, acrClient, repoName)
+	if err != nil {
+		return nil, err
+	}
+	tagPager := api.NewTagPager(acrClient, repoName, orderBy)
+	if !untagged {
+		tagPager.FilterByPrefix(tagNamePrefix(regex, matchOn))
+	}
+	tagsToDelete, err := o.getTagsToDelete(ctx, tagPager, regex, matchOn, timeToCompare, superseded, countMap, &repoPlan.Kept)
+	if err != nil {
+		return nil, err
+	}
+	// The loop to get the deleted tags follows the same logic as the one in the Tags function
+	for tagsToDelete != nil {
+		for _, tag := range *tagsToDelete {
+			if keptByGroup[*tag.Name] {
+				repoPlan.Kept = append(repoPlan.Kept, KeptTag{Tag: tag, Reason: KeepReasonGroup})
+				continue
+			}
+			if digests != nil && !digests[*tag.Digest] {
+				repoPlan.Kept = append(repoPlan.Kept, KeptTag{Tag: tag, Reason: KeepReasonArtifactType})
+				continue
+			}
+			matched, err := o.isPushedBy(ctx, acrClient, repoName, *tag.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				repoPlan.Kept = append(repoPlan.Kept, KeptTag{Tag: tag, Reason: KeepReasonPushedBy})
+				continue
+			}
+			excluded, err := o.hasExcludedLabel(ctx, acrClient, repoName, *tag.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if excluded {
+				repoPlan.Kept = append(repoPlan.Kept, KeptTag{Tag: tag, Reason: KeepReasonLabel})
+				continue
+			}
+			if o.isPinned(repoName, *tag.Digest) {
+				repoPlan.Kept = append(repoPlan.Kept, KeptTag{Tag: tag, Reason: KeepReasonPinned})
+				continue
+			}
+			signed, err := o.keepsSigned(ctx, acrClient, repoName, *tag.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if signed {
+				repoPlan.Kept = append(repoPlan.Kept, KeptTag{Tag: tag, Reason: KeepReasonSigned})
+				continue
+			}
+			present, err := o.isPresentInReference(ctx, repoName, *tag.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if present {
+				repoPlan.Kept = append(repoPlan.Kept, KeptTag{Tag: tag, Reason: KeepReasonReference})
+				continue
+			}
+			if !o.inCreatedWindows(repoName, tag) {
+				repoPlan.Kept = append(repoPlan.Kept, KeptTag{Tag: tag, Reason: KeepReasonTimeWindow})
+				continue
+			}
+			// Deleting only some of the tags of a digest leaves its manifest reachable through the others.
+			coTags, err := aliases.coTags(ctx, tag)
+			if err != nil {
+				return nil, err
+			}
+			if len(coTags) > 0 {
+				if repoPlan.CoTags == nil {
+					repoPlan.CoTags = map[string][]string{}
+				}
+				repoPlan.CoTags[*tag.Name] = coTags
+				if o.keepPartialUntag {
+					repoPlan.Kept = append(repoPlan.Kept, KeptTag{Tag: tag, Reason: KeepReasonPartialUntag})
+					continue
+				}
+			}
+			// For every tag that would be deleted first check if it exists in the map, if it doesn't add a new key
+			// with value 1 and if it does just add 1 to the existent value.
+			deletedTags[*tag.Digest]++
+			repoPlan.Tags = append(repoPlan.Tags, tag)
+		}
+		tagsToDelete, err = o.getTagsToDelete(ctx, tagPager, regex, matchOn, timeToCompare, superseded, countMap, &repoPlan.Kept)
+		if err != nil {
+			return nil, err
+		}
+	}
+	repoPlan.ScannedTags = tagPager.Listed()
+	if o.collectSizes && !untagged {
+		if err := addManifestSizes(ctx, acrClient, repoName, repoPlan.Sizes); err != nil {
+			return nil, err
+		}
+	}
+	if untagged {
+		manifestPager := api.NewManifestPager(acrClient, repoName, "")
+		resultManifests, err := manifestPager.Next(ctx)
+		if err != nil {
+			if errors.Is(err, api.ErrNotFound) {
+				o.printf("%s repository not found\n", repoName)
+				return repoPlan, nil
+			}
+			return nil, err
+		}
+		// This will act as a set if a key is present then it should not be deleted because it is referenced by a multiarch manifest
+		// that will not be deleted
+		doNotDelete := map[string]bool{}
+		candidatesToDelete := []acr.ManifestAttributesBase{}
+		listed := map[string]acr.ManifestAttributesBase{}
+		// Iterate over all manifests to discover multiarchitecture manifests
+		for resultManifests != nil && resultManifests.ManifestsAttributes != nil {
+			manifests := *resultManifests.ManifestsAttributes
+			o.emitPageScanned(repoName, progressKindManifests, len(manifests), manifestPager.Listed())
+			for _, manifest := range manifests {
+				listed[*manifest.Digest] = manifest
+				if manifest.ImageSize != nil {
+					repoPlan.Sizes[*manifest.Digest] = *manifest.ImageSize
+				}
+				// If the manifest is manifest list and would not get deleted then mark it's dependant manifests as not deletable.
+				if *manifest.MediaType == manifestListContentType && countMap[*manifest.Digest] != deletedTags[*manifest.Digest] {
+					var manifestListBytes []byte
+					manifestListBytes, err = acrClient.GetManifest(ctx, repoName, *manifest.Digest)
+					if err != nil {
+						return nil, err
+					}
+					var manifestList multiArchManifest
+					err = json.Unmarshal(manifestListBytes, &manifestList)
+					if err != nil {
+						return nil, err
+					}
+					for _, dependentDigest := range manifestList.Manifests {
+						doNotDelete[dependentDigest.Digest] = true
+					}
+				} else if countMap[*manifest.Digest] == deletedTags[*manifest.Digest] {
+					// If the manifest has the same amount of tags as the amount of tags deleted then it is a candidate for deletion.
+					candidatesToDelete = append(candidatesToDelete, manifest)
+				}
+			}
+			resultManifests, err = manifestPager.Next(ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// Only the manifests that are not referenced by a remaining manifest list are part of the plan.
+		unreferenced := 0
+		for i := 0; i < len(candidatesToDelete); i++ {
+			if _, ok := doNotDelete[*candidatesToDelete[i].Digest]; ok {
+				continue
+			}
+			unreferenced++
+			if *(*candidatesToDelete[i].ChangeableAttributes).DeleteEnabled && !o.isUntaggedTooRecent(candidatesToDelete[i].LastUpdateTime) && o.isArtifactType(candidatesToDelete[i]) && !isTombstone(candidatesToDelete[i]) {
+				repoPlan.Manifests = append(repoPlan.Manifests, candidatesToDelete[i])
+			}
+		}
+		repoPlan.Manifests, err = o.onlyPushedByManifests(ctx, acrClient, repoName, repoPlan.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		repoPlan.Manifests, err = o.withoutExcludedManifests(ctx, acrClient, repoName, repoPlan.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		repoPlan.Manifests, err = o.withoutSignedManifests(ctx, acrClient, repoName, o.withoutPinnedManifests(repoName, repoPlan.Manifests))
+		if err != nil {
+			return nil, err
+		}
+		repoPlan.Manifests, err = o.withoutPresentInReferenceManifests(ctx, repoName, repoPlan.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		repoPlan.ScannedManifests = manifestPager.Listed()
+		repoPlan.SkippedManifests = unreferenced - len(repoPlan.Manifests)
+		// A referrer is tagged if some of its tags are not deleted.
+		repoPlan.Manifests, repoPlan.Referrers, err = o.withReferrerChains(ctx, acrClient, repoName, repoPlan.Manifests, listed, func(manifest acr.ManifestAttributesBase) bool {
+			return countMap[*manifest.Digest] != deletedTags[*manifest.Digest]
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return repoPlan, nil
+}
+
+// Plan contains the tags and manifests that a policy would delete, grouped by repository.
+type Plan struct {
+	// Version is the version of the format of the plan, it is changed whenever a saved plan could be misread.
+	Version      int              `json:"version"`
+	LoginURL     string           `json:"loginUrl"`
+	Repositories []RepositoryPlan `json:"repositories"`
+	// windows are the time windows of the policy of the plan, Execute stops when they close.
+	windows *timeWindows
+}
+
+// RepositoryPlan contains the tags and manifests that would be deleted from a single repository.
+type RepositoryPlan struct {
+	Name      string                       `json:"name"`
+	Tags      []acr.TagAttributesBase      `json:"tags"`
+	Manifests []acr.ManifestAttributesBase `json:"manifests"`
+	// Kept are the tags that match the filter and were last updated before the cutoff but are not deleted, they are
+	// only used to explain a dry run so they are not saved with the plan.
+	Kept []KeptTag `json:"-"`
+	// Referrers are the referrers of the manifests that are deleted with them, the manifests are sorted so that every
+	// referrer comes before the manifest it refers to.
+	Referrers map[string][]string `json:"referrers,omitempty"`
+	// CoTags are the tags that are not deleted of the digests of the tags that only have some of their tags deleted,
+	// by tag name. They are only used to explain a dry run.
+	CoTags map[string][]string `json:"-"`
+	// Sizes are the sizes of the manifests by digest, they are known when the manifests were listed.
+	Sizes map[string]int64 `json:"-"`
+	// ScannedTags and ScannedManifests are the number of tags and manifests listed, the manifests are only listed for
+	// the untagged manifests. SkippedManifests are the untagged manifests that are kept (e.g. locked or too recent).
+	ScannedTags      int `json:"-"`
+	ScannedManifests int `json:"-"`
+	SkippedManifests int `json:"-"`
+}
+
+// TagSummary returns the summary of the tags of the plan, the tags that would be deleted are counted as deleted.
+func (p *RepositoryPlan) TagSummary() Summary {
+	return Summary{Scanned: p.ScannedTags, Deleted: len(p.Tags), Skipped: len(p.Kept)}
+}
+
+// ManifestSummary returns the summary of the untagged manifests of the plan, the manifests that would be deleted are
+// counted as deleted.
+func (p *RepositoryPlan) ManifestSummary() Summary {
+	return Summary{Scanned: p.ScannedManifests, Deleted: len(p.Manifests), Skipped: p.SkippedManifests}
+}
+
+// The reasons a tag that matches the filter and is older than the cutoff is kept.
+const (
+	KeepReasonLocked        = "locked"
+	KeepReasonMinAge        = "min-age"
+	KeepReasonNotSuperseded = "latest build"
+	KeepReasonArtifactType  = "artifact type"
+	KeepReasonLabel         = "label"
+	KeepReasonSigned        = "signed"
+	KeepReasonPinned        = "pinned"
+	KeepReasonPushedBy      = "pushed by"
+	KeepReasonGroup         = "kept per group"
+	KeepReasonReference     = "in reference registry"
+	KeepReasonPartialUntag  = "partial untag"
+	KeepReasonTimeWindow    = "time window"
+)
+
+// KeptTag is a tag that matches the filter and was last updated before the cutoff but is not deleted.
+type KeptTag struct {
+	Tag    acr.TagAttributesBase
+	Reason string
+}
+
+// EnableDryRunSizes makes the dry runs list the manifests of every repository to know the size of every tag.
+func (o *Options) EnableDryRunSizes(enabled bool) {
+	o.collectSizes = enabled
+}
+
+// addManifestSizes adds the size of every manifest of the repository to sizes.
+func addManifestSizes(ctx context.Context, acrClient api.ManifestLister, repoName string, sizes map[string]int64) error {
+	manifests := acrapi.NewManifestIterator(acrClient, repoName, "")
+	for manifests.Next(ctx) {
+		if manifest := manifests.Manifest(); manifest.Digest != nil && manifest.ImageSize != nil {
+			sizes[*manifest.Digest] = *manifest.ImageSize
+		}
+	}
+	if manifests.NotFound() {
+		return nil
+	}
+	return manifests.Err()
+}
+
+// TagCount returns the number of tags that the plan would delete.
+func (p *Plan) TagCount() int {
+	count := 0
+	for _, repoPlan := range p.Repositories {
+		count += len(repoPlan.Tags)
+	}
+	return count
+}
+
+// ManifestCount returns the number of manifests that the plan would delete.
+func (p *Plan) ManifestCount() int {
+	count := 0
+	for _, repoPlan := range p.Repositories {
+		count += len(repoPlan.Manifests)
+	}
+	return count
+}
+
+// applyPolicy sets the options of the fields of the policy that are set, they take precedence over the ones the
+// options already have. The reference registry of the policy cannot be reached without its credentials, it has to be
+// the one of the options.
+func (o *Options) applyPolicy(clock Clock, policy Policy) error {
+	if len(policy.ArtifactType) > 0 {
+		if err := o.SetArtifactType(policy.ArtifactType); err != nil {
+			return err
+		}
+	}
+	if len(policy.ExcludeLabels) > 0 {
+		if err := o.SetExcludeLabels(policy.ExcludeLabels); err != nil {
+			return err
+		}
+	}
+	if len(policy.PushedBy) > 0 {
+		if err := o.SetPushedBy(policy.PushedBy); err != nil {
+			return err
+		}
+	}
+	if policy.KeepPerGroup != 0 {
+		if err := o.SetKeepPerGroup(policy.KeepPerGroup); err != nil {
+			return err
+		}
+	}
+	if len(policy.Signatures) > 0 {
+		if err := o.SetSignaturePolicy(policy.Signatures); err != nil {
+			return err
+		}
+	}
+	if len(policy.KeepPinned) > 0 {
+		lockfile, err := ReadLockfile(policy.KeepPinned)
+		if err != nil {
+			return err
+		}
+		o.SetPinned(lockfile)
+	}
+	if len(policy.KeepIfPresentIn) > 0 && (o.referenceRegistry == nil || api.LoginURL(policy.KeepIfPresentIn) != o.referenceLoginURL) {
+		return fmt.Errorf("the policy keeps the images present in %s but the run cannot reach that registry", policy.KeepIfPresentIn)
+	}
+	if policy.IncludeReferrers {
+		o.SetIncludeReferrers(true)
+	}
+	if policy.AllowPartialUntag && policy.KeepPartialUntag {
+		return errors.New("a policy cannot both allow and keep the partial untags")
+	}
+	if policy.AllowPartialUntag {
+		o.SetAliasDetection(false, false)
+	}
+	if policy.KeepPartialUntag {
+		o.SetAliasDetection(true, true)
+	}
+	if len(policy.Windows) > 0 {
+		if err := o.SetTimeWindows(policy.Windows, policy.Timezone); err != nil {
+			return err
+		}
+	}
+	if len(policy.UntaggedAgo) > 0 {
+		if _, err := o.SetUntaggedAgo(clock, policy.UntaggedAgo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewPlan evaluates a policy against the registry at the time the clock returns and returns everything that would be
+// deleted, nothing is deleted. The fields of the policy that are set take precedence over the options, which are not
+// changed.
+func NewPlan(ctx context.Context, acrClient api.AcrCLIClientInterface, clock Clock, loginURL string, policy Policy, opts *Options) (*Plan, error) {
+	matchOn := policy.MatchOn
+	if len(matchOn) == 0 {
+		matchOn = MatchOnTag
+	}
+	filters, err := opts.ExpandFilters(ctx, acrClient, policy.Filters, policy.Placeholders, matchOn)
+	if err != nil {
+		return nil, err
+	}
+	tagFilters, err := opts.GetTagFilters(filters, matchOn)
+	if err != nil {
+		return nil, err
+	}
+	// The policy is applied to a copy of the options so that the plans of several policies can be made at the same
+	// time, the fields that are shared between copies are pointers.
+	planOpts := *opts
+	if err := planOpts.applyPolicy(clock, policy); err != nil {
+		return nil, err
+	}
+	// The purge command already warned about the skipped repositories when it parsed the same filters.
+	tagFilters = planOpts.WithoutCachedRepositories(tagFilters, ioutil.Discard)
+	tagFilters = planOpts.WithoutClosedRepositories(tagFilters, clock.Now(), ioutil.Discard)
+	repoNames := []string{}
+	for repoName := range tagFilters {
+		repoNames = append(repoNames, repoName)
+	}
+	// The repositories are sorted so that the same policy always produces the same plan.
+	sort.Strings(repoNames)
+	plan := &Plan{Version: PlanVersion, LoginURL: loginURL, Repositories: []RepositoryPlan{}, windows: planOpts.windows}
+	for _, repoName := range repoNames {
+		repoPlan, err := planOpts.planRepository(ctx, acrClient, clock, repoName, Cutoff{Ago: policy.Ago, Before: policy.Before}, tagFilters[repoName], matchOn, policy.OnlySuperseded, policy.Untagged)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan purge of %s: %w", repoName, err)
+		}
+		plan.Repositories = append(plan.Repositories, *repoPlan)
+	}
+	return plan, nil
+}
+
+// Execute deletes every tag and manifest of a plan, the tags of a repository are deleted before its manifests.
+// The progress function (if not nil) is called with the total number of deleted tags and manifests every time
+// a block of deletions finishes. Only the deletions that succeeded are counted, the tags and manifests that were
+// already deleted or whose deletion failed are not. The maximum number of deletions and the consumers of the results
+// are the ones of the options. The time windows of the plan, or the ones of the options if the plan was not created by
+// NewPlan, are checked with the clock of the options before every block and ErrWindowClosed is returned once they do
+// not allow a purge of the repository anymore. The error of the context is returned once it is cancelled, e.g. when
+// the server stops, the block being deleted is finished first.
+func Execute(ctx context.Context, plan *Plan, progress func(deletedTags int, deletedManifests int), opts *Options) (int, int, error) {
+	tagsSummary := Summary{}
+	manifestsSummary := Summary{}
+	windows := plan.windows
+	if windows == nil {
+		windows = opts.windows
+	}
+	for _, repoPlan := range plan.Repositories {
+		for start := 0; start < len(repoPlan.Tags); start += 100 {
+			end := start + 100
+			if end > len(repoPlan.Tags) {
+				end = len(repoPlan.Tags)
+			}
+			if err := opts.checkExecution(ctx, windows, repoPlan.Name); err != nil {
+				return tagsSummary.Deleted, manifestsSummary.Deleted, err
+			}
+			if err := opts.deleteTagsAndWait(plan.LoginURL, repoPlan.Name, repoPlan.Tags[start:end], &tagsSummary); err != nil {
+				return tagsSummary.Deleted, manifestsSummary.Deleted, err
+			}
+			if progress != nil {
+				progress(tagsSummary.Deleted, manifestsSummary.Deleted)
+			}
+		}
+		for _, wave := range referrerWaves(repoPlan.Manifests, repoPlan.Referrers) {
+			if len(wave) > 0 {
+				if err := opts.checkExecution(ctx, windows, repoPlan.Name); err != nil {
+					return tagsSummary.Deleted, manifestsSummary.Deleted, err
+				}
+			}
+			if err := opts.deleteManifestsAndWait(plan.LoginURL, repoPlan.Name, wave, &manifestsSummary); err != nil {
+				return tagsSummary.Deleted, manifestsSummary.Deleted, err
+			}
+			if progress != nil {
+				progress(tagsSummary.Deleted, manifestsSummary.Deleted)
+			}
+		}
+	}
+	return tagsSummary.Deleted, manifestsSummary.Deleted, nil
+}
+
+// In order to parse the content of a mutliarch manifest string the following structs were defined.
+type multiArchManifest struct {
+	Manifests     []manifest `json:"manifests"`
+	MediaType     string     `json:"mediaType"`
+	SchemaVersion int        `json:"schemaVersion"`
+}
+
+type manifest struct {
+	Digest    string   `json:"digest"`
+	MediaType string   `json:"mediaType"`
+	Platform  platform `json:"platform"`
+	Size      int64    `json:"size"`
+}
+
+type platform struct {
+	Architecture string `json:"architecture"`
+	Os           string `json:"os"`
+}
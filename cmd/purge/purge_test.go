@@ -0,0 +1,1412 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestPurgeTags contains all the tests regarding the Tags function which is called when the --dry-run flag is
+// not set.
+func TestPurgeTags(t *testing.T) {
+	// First test if repository is not known Tags should only call GetAcrTags and return no error.
+	t.Run("RepositoryNotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(notFoundTagResponse, errors.New("testRepo not found")).Once()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "1d"}, "[\\s\\S]*", MatchOnTag, false, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, if there are no tags on a registry no error should show and no other methods should be called.
+	t.Run("EmptyRepositoryTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(EmptyListTagsResult, nil).Once()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "1d"}, "[\\s\\S]*", MatchOnTag, false, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Third test there is only one tag and it should not be deleted (according to the ago flag), GetAcrTags should be called twice
+	// and no other methods should be called.
+	t.Run("NoDeletionAgoTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "1d"}, "[\\s\\S]*", MatchOnTag, false, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test there is only one tag and it should be deleted according to the ago flag but it does not match a regex filter
+	// so no other method should be called
+	t.Run("NoDeletionFilterTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^hello.*", MatchOnTag, false, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Fifth test, invalid regex filter, an error should be returned.
+	t.Run("InvalidRegexTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "[", MatchOnTag, false, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Sixth test, if a passed duration is invalid an error should be returned.
+	t.Run("InvalidDurationTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0e"}, "^la.*", MatchOnTag, false, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Seventh test, if there is an error during a call to GetAcrTags (other than a 404) an error should be returned.
+	t.Run("GetAcrTagsErrorSinglePageTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(nil, errors.New("unauthorized")).Once()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "1d"}, "[\\s\\S]*", MatchOnTag, false, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Eighth test, if there is an error during a call to GetAcrTags (other than a 404) an error should be returned.
+	// similar to the previous test but the error occurs not on the first GetAcrTags call.
+	t.Run("GetAcrTagsErrorMultiplePageTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(nil, errors.New("unauthorized")).Once()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "1d"}, "[\\s\\S]*", MatchOnTag, false, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Ninth test, if a tag should be deleted but the delete enabled attribute is set to true it should not be deleted
+	// and no error should show on the CLI output.
+	t.Run("OperationNotAllowedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(DeleteDisabledOneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Tenth test, if a tag has an invalid last update time attribute an error should be returned.
+	t.Run("InvalidDurationTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(InvalidDateOneTagResult, nil).Once()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// The following tests involve deleting tags.
+	// Eleventh test, there is only one tag and it should be deleted, the DeleteAcrTag method should be called once.
+	t.Run("OneTagDeletionTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, &mockClient, 6)
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "latest").Return(&deletedResponse, nil).Once()
+		summary, err := Tags(testCtx, &mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, NewOptions())
+		StopDispatcher()
+		assert.Equal(1, summary.Deleted, "Number of deleted elements should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Twelfth test, all tags should be deleted, 5 tags in total, separated into two GetAcrTags calls, there should be
+	// 5 DeleteAcrTag calls.
+	t.Run("FiveTagDeletionTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, &mockClient, 6)
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "latest").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v1").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v2").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v3").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v4").Return(&deletedResponse, nil).Once()
+		summary, err := Tags(testCtx, &mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "[\\s\\S]*", MatchOnTag, false, NewOptions())
+		StopDispatcher()
+		assert.Equal(5, summary.Deleted, "Number of deleted elements should be 5")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Thirteenth test, if an there is a 404 error while deleting a tag an error should not be returned.
+	t.Run("DeleteNotFoundErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, &mockClient, 6)
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(nil, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "latest").Return(&notFoundResponse, errors.New("not found")).Once()
+		summary, err := Tags(testCtx, &mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, NewOptions())
+		StopDispatcher()
+		// If it is not found it was already deleted, it is reported as skipped.
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(1, summary.Skipped, "Number of skipped elements should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Fourteenth test, if an error (other than a 404 error) occurs during delete, an error should be returned.
+	t.Run("DeleteErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, &mockClient, 6)
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "latest").Return(nil, errors.New("error during delete")).Once()
+		summary, err := Tags(testCtx, &mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, NewOptions())
+		StopDispatcher()
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(1, summary.Failed, "Number of failed elements should be 1")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestPurgeManifests contains the tests for the DanglingManifests function, it is invoked when the --untagged flag is set
+// and the --dry-run flag is not set
+func TestPurgeManifests(t *testing.T) {
+	// First test if repository is not known DanglingManifests should only call GetAcrManifests once and return no error
+	t.Run("RepositoryNotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(notFoundManifestResponse, errors.New("testRepo not found")).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test if there is an error (different to a 404 error) getting the first set of manifests an error should be returned.
+	t.Run("GetAcrManifestsErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(nil, errors.New("unauthorized")).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, no manifest shoud be deleted, if all the manifests have at least one tag they should not be deleted,
+	// so no DeleteManifest calls should be made.
+	t.Run("NoDeletionManifestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:abc").Return(EmptyListManifestsResult, nil).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test if there is an error (different to a 404 error) getting the second set of manifests an error should be returned.
+	t.Run("GetAcrManifestsErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:abc").Return(nil, errors.New("error getting manifests")).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// The following tests involve multiarch manifests
+	// Fifth test, if there is an error while getting the multiarch manifest an error should be returned.
+	t.Run("MultiArchErrorGettingManifestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleMultiArchWithTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha:356").Return(nil, errors.New("error getting manifest")).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error not should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Sixth test, if a MultiArch manifest returns an invalid JSON an error should be returned.
+	t.Run("MultiArchInvalidJsonTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleMultiArchWithTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha:356").Return([]byte("invalid manifest"), nil).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error not should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// The following tests involve deleting manifests.
+	// Seventh test, there are three manifests split into two GetAcrManifests calls, and one is linked to a tag so there should
+	// only be 2 deletions, hence the 2 DeleteManifest calls
+	t.Run("DeleteTwoManifestsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, mockClient, 6)
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:abc").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("DeleteManifest", workerCtx, testRepo, "sha:123").Return(nil, nil).Once()
+		mockClient.On("DeleteManifest", workerCtx, testRepo, "sha:234").Return(nil, nil).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		StopDispatcher()
+		assert.Equal(2, summary.Deleted, "Number of deleted elements should be 2")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Eighth test, if there is an error while deleting the manifest but it is a 404 the manifest was already deleted, it is
+	// reported as skipped and there should be no error.
+	t.Run("ErrorManifestDeleteNotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, mockClient, 6)
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:abc").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("DeleteManifest", workerCtx, testRepo, "sha:123").Return(nil, nil).Once()
+		mockClient.On("DeleteManifest", workerCtx, testRepo, "sha:234").Return(&notFoundResponse, errors.New("manifest not found")).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		StopDispatcher()
+		assert.Equal(Summary{Scanned: 3, Deleted: 1, Skipped: 1}, summary)
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Ninth, if there is an error while deleting a manifest and it is different that a 404 error an error should be returned.
+	t.Run("ErrorManifestDeleteTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, mockClient, 6)
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:abc").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("DeleteManifest", workerCtx, testRepo, "sha:123").Return(nil, nil).Once()
+		mockClient.On("DeleteManifest", workerCtx, testRepo, "sha:234").Return(nil, errors.New("error deleting manifest")).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		StopDispatcher()
+		// The manifest deleted before the error is still counted.
+		assert.Equal(Summary{Scanned: 3, Deleted: 1, Failed: 1}, summary)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Tenth test, if there is an error while deleting a manifest and it is different that a 404 error an error should be returned.
+	// similar to the previous test but the error occurs in the second manifest that should be deleted.
+	t.Run("ErrorManifestDelete2Test", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, mockClient, 6)
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:abc").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("DeleteManifest", workerCtx, testRepo, "sha:123").Return(nil, errors.New("error deleting manifest")).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		StopDispatcher()
+		assert.Equal(0, summary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Eleventh, there are three manifests, two of them have no tags, but one belongs to a multiarch image that has tags so it
+	// should not be deleted, only one call to DeleteManifest should be made because the manifest that does not belong to the
+	// multiarch manifest and has no tags should be deleted.
+	t.Run("MultiArchDeleteTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, mockClient, 6)
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleMultiArchWithTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha:356").Return(multiArchBytes, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:356").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("DeleteManifest", workerCtx, testRepo, "sha:234").Return(nil, nil).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		StopDispatcher()
+		assert.Equal(1, summary.Deleted, "Number of deleted elements should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestDryRun contains the tests for the DryRun function, it is called when the --dry-run flag is set.
+func TestDryRun(t *testing.T) {
+	// First test if repository is not know DryRun should not return an error, and there should not be any tags or manifest deleted.
+	t.Run("RepositoryNotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(notFoundManifestResponse, errors.New("testRepo not found")).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(notFoundTagResponse, errors.New("testRepo not found")).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "1d"}, "[\\s\\S]*", MatchOnTag, false, true, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, if an invalid duration is passed an error should be returned, and the invalid counters should be returned.
+	t.Run("InvalidDurationTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0e"}, "[\\s\\S]*", MatchOnTag, false, true, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, if there is an invalid regex an error should be returned as well as the invalid counters.
+	t.Run("InvalidRegexTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "[", MatchOnTag, false, true, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, there are 4 tags that should be deleted, note how there are no DeleteAcrTag calls because this is a dry-run.
+	t.Run("FourTagDeletionDryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "[\\s\\S]*", MatchOnTag, false, false, NewOptions())
+		assert.Equal(4, tagSummary.Deleted, "Number of deleted elements should be 4")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Fifth test, if there is an error on the first GetAcrTags call (different to a 404) an error should be returned.
+	t.Run("GetAcrTagsErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(nil, errors.New("error fetching tags")).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "[\\s\\S]*", MatchOnTag, false, false, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Sixth test, if there is an error on the second GetAcrTags call (different to a 404) an error should be returned.
+	t.Run("GetAcrTagsError2Test", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(nil, errors.New("error fetching tags")).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "[\\s\\S]*", MatchOnTag, false, false, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Seventh test, if there is an error on the first GetAcrManifests call (different to a 404) an error should be returned.
+	t.Run("GetAcrManifestsErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(nil, errors.New("testRepo not found")).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "[\\s\\S]*", MatchOnTag, false, true, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Eighth test, if there is an error on the second GetAcrManifests call (different to a 404) an error should be returned.
+	t.Run("GetAcrManifestsError2Test", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(nil, errors.New("error fetching manifests")).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "[\\s\\S]*", MatchOnTag, false, true, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Ninth test, if there is a GetManifest error for the MultiArch scenario an error should be returned.
+	t.Run("MultiArchGetManifestErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleMultiArchWithTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha:356").Return(nil, errors.New("error getting manifest")).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^lat.*", MatchOnTag, false, true, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Tenth test, if the returned multiarch manifest json is invalid an error should be returned.
+	t.Run("MultiArchInvalidJSONTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleMultiArchWithTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha:356").Return([]byte("invalid json"), nil).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^lat.*", MatchOnTag, false, true, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Eleventh test, error on the second getAcrTags when untagged is set, an error should be returned
+	t.Run("MultiArchGetAcrTagsErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(nil, errors.New("error fetching tags")).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^lat.*", MatchOnTag, false, true, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Twelfth test, if there is an error during the second call of GetAcrManifests an error should be returned.
+	t.Run("MultiArchGetAcrTagsError2Test", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleMultiArchWithTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha:356").Return(multiArchBytes, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:356").Return(nil, errors.New("error fetching manifests")).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^lat.*", MatchOnTag, false, true, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.NotEqual(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Thirteenth test, one image that has no tags belongs to a multiarch image that has tags so it should not be deleted, but there is one manifest
+	// that should be deleted,
+	t.Run("MultiArchDryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleMultiArchWithTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha:356").Return(multiArchBytes, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:356").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^lat.*", MatchOnTag, false, true, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(1, manifestSummary.Deleted, "Number of deleted elements should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Fourteenth test, when matching on digests only the tags that reference a matching digest should be deleted.
+	t.Run("DigestFilterDryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^sha:3", MatchOnDigest, false, false, NewOptions())
+		assert.Equal(1, tagSummary.Deleted, "Number of deleted elements should be 1")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Fifteenth test, with only-superseded the most recent matching tag is kept and the older tags that reference a
+	// different digest are deleted.
+	t.Run("OnlySupersededDryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(supersededTagsResult, nil).Twice()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v3").Return(EmptyListTagsResult, nil).Twice()
+		tagSummary, manifestSummary, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^v.*", MatchOnTag, true, false, NewOptions())
+		assert.Equal(2, tagSummary.Deleted, "Number of deleted elements should be 2")
+		assert.Equal(0, manifestSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Sixteenth test, a tag that is exactly as old as the ago duration should not be deleted, one nanosecond later it should.
+	t.Run("AgeBoundaryDryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Twice()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Twice()
+		tagSummary, _, err := DryRun(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "15m"}, "^la.*", MatchOnTag, false, false, NewOptions())
+		assert.Equal(0, tagSummary.Deleted, "Number of deleted elements should be 0")
+		assert.Equal(nil, err, "Error should be nil")
+		laterClock := FixedClock(testNow.Add(time.Nanosecond))
+		tagSummary, _, err = DryRun(testCtx, mockClient, laterClock, testLoginURL, testRepo, Cutoff{Ago: "15m"}, "^la.*", MatchOnTag, false, false, NewOptions())
+		assert.Equal(1, tagSummary.Deleted, "Number of deleted elements should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Seventeenth test, a locked tag is reported as kept and the sizes of the manifests are listed when enabled.
+	t.Run("KeptTagDryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.EnableDryRunSizes(true)
+		imageSize := int64(2048)
+		sizedManifestsResult := &acr.Manifests{
+			Registry:  &testLoginURL,
+			ImageName: &testRepo,
+			ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+				LastUpdateTime:       &lastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+				Digest:               &digest,
+				ImageSize:            &imageSize,
+				MediaType:            &dockerV2MediaType,
+				Tags:                 &[]string{"latest"},
+			}},
+		}
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(DeleteDisabledOneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(sizedManifestsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
+		repoPlan, err := DryRunPlan(testCtx, mockClient, testClock, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(repoPlan.Tags))
+		assert.Equal(1, len(repoPlan.Kept))
+		assert.Equal(KeepReasonLocked, repoPlan.Kept[0].Reason)
+		assert.Equal(imageSize, repoPlan.Sizes[digest])
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestPlan contains the tests for NewPlan and Execute, they are used by the serve command to separate the planning
+// of a purge from its execution.
+func TestPlan(t *testing.T) {
+	// First test, an invalid filter should return an error without calling the registry.
+	t.Run("InvalidFilterTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		plan, err := NewPlan(testCtx, mockClient, testClock, testLoginURL, Policy{Filters: []string{"bar"}, Ago: "0m"}, NewOptions())
+		assert.Equal((*Plan)(nil), plan)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, the plan should contain the matching tags and executing it should delete them.
+	t.Run("PlanAndExecuteTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v1").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v2").Return(&deletedResponse, nil).Once()
+		plan, err := NewPlan(testCtx, mockClient, testClock, testLoginURL, Policy{Filters: []string{"bar:v1", "bar:v2"}, Ago: "0m"}, NewOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, plan.TagCount())
+		assert.Equal(0, plan.ManifestCount())
+		progressCalls := 0
+		StartDispatcher(testCtx, mockClient, 6)
+		deletedTags, deletedManifests, err := Execute(testCtx, plan, func(deletedTags int, deletedManifests int) {
+			progressCalls++
+		}, NewOptions())
+		StopDispatcher()
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, deletedTags, "Number of deleted elements should be 2")
+		assert.Equal(0, deletedManifests, "Number of deleted elements should be 0")
+		assert.Equal(2, progressCalls)
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, the invalid fields of a policy return an error without calling the registry and the options passed
+	// to NewPlan are not changed by the fields of the policy.
+	t.Run("PolicyFieldsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		opts := NewOptions()
+		invalid := []Policy{
+			{Filters: []string{"bar:.*"}, Ago: "0m", ArtifactType: "unknown"},
+			{Filters: []string{"bar:.*"}, Ago: "0m", ExcludeLabels: []string{"=value"}},
+			{Filters: []string{"bar:.*"}, Ago: "0m", PushedBy: []string{" "}},
+			{Filters: []string{"bar:.*"}, Ago: "0m", KeepPerGroup: -1},
+			{Filters: []string{"bar:.*"}, Ago: "0m", Signatures: "unknown"},
+			{Filters: []string{"bar:.*"}, Ago: "0m", KeepPinned: "missing.lock"},
+			{Filters: []string{"bar:.*"}, Ago: "0m", KeepIfPresentIn: "prod"},
+		}
+		for _, policy := range invalid {
+			plan, err := NewPlan(testCtx, mockClient, testClock, testLoginURL, policy, opts)
+			assert.Equal((*Plan)(nil), plan)
+			assert.NotEqual(nil, err, "Error should not be nil")
+		}
+		// The tags are listed once to group them and once to select the ones to delete.
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Twice()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Twice()
+		plan, err := NewPlan(testCtx, mockClient, testClock, testLoginURL, Policy{Filters: []string{"bar:v.*"}, Ago: "0m", KeepPerGroup: 1, IncludeReferrers: true}, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(3, plan.TagCount())
+		assert.Equal(0, opts.keepPerGroup)
+		assert.False(opts.includeReferrers)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, a tag of the plan that was deleted after the plan was created is not counted as deleted by Execute.
+	t.Run("AlreadyDeletedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v1").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v2").Return(&notFoundResponse, errors.New("not found")).Once()
+		plan, err := NewPlan(testCtx, mockClient, testClock, testLoginURL, Policy{Filters: []string{"bar:v1", "bar:v2"}, Ago: "0m"}, NewOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, plan.TagCount())
+		StartDispatcher(testCtx, mockClient, 6)
+		deletedTags, deletedManifests, err := Execute(testCtx, plan, nil, NewOptions())
+		StopDispatcher()
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, deletedTags, "Number of deleted elements should be 1")
+		assert.Equal(0, deletedManifests, "Number of deleted elements should be 0")
+		mockClient.AssertExpectations(t)
+	})
+	// Fifth test, the time windows of the policy are checked again when the plan is executed, nothing is deleted once
+	// they closed.
+	t.Run("WindowClosedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v1").Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "v2").Return(&deletedResponse, nil).Once()
+		policy := Policy{Filters: []string{"bar:v1", "bar:v2"}, Ago: "0m", Windows: []TimeWindow{{Mode: WindowModeInclude, Hours: "11:00-13:00"}}}
+		plan, err := NewPlan(testCtx, mockClient, testClock, testLoginURL, policy, NewOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, plan.TagCount())
+		StartDispatcher(testCtx, mockClient, 6)
+		defer StopDispatcher()
+		opts := NewOptions()
+		opts.SetClock(FixedClock(testNow.Add(90 * time.Minute)))
+		deletedTags, _, err := Execute(testCtx, plan, nil, opts)
+		assert.True(errors.Is(err, ErrWindowClosed))
+		assert.Equal(0, deletedTags)
+		mockClient.AssertNotCalled(t, "DeleteAcrTag", workerCtx, testRepo, "v1")
+		opts.SetClock(testClock)
+		deletedTags, _, err = Execute(testCtx, plan, nil, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, deletedTags)
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestBatchDeletion contains the tests for the deletion of tags in batches.
+func TestBatchDeletion(t *testing.T) {
+	// First test, the registry does not support batch deletion so tags are deleted one by one.
+	t.Run("UnsupportedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("SupportsBatchTagDelete", testCtx).Return(false, nil).Once()
+		enabled, err := opts.EnableBatchDeletion(testCtx, mockClient, 3)
+		assert.Equal(false, enabled)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, opts.batchSize)
+		enabled, err = opts.EnableBatchDeletion(testCtx, mockClient, 1)
+		assert.Equal(false, enabled)
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, the tags of every page are grouped in batches of at most 3 tags.
+	t.Run("BatchTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		mockClient := mocks.AcrCLIClientInterface{}
+		mockClient.On("SupportsBatchTagDelete", testCtx).Return(true, nil).Once()
+		enabled, err := opts.EnableBatchDeletion(testCtx, &mockClient, 3)
+		assert.Equal(true, enabled)
+		assert.Equal(nil, err, "Error should be nil")
+		StartDispatcher(testCtx, &mockClient, 6)
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(FourTagsResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v4").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTags", workerCtx, testRepo, []string{"latest"}).Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTags", workerCtx, testRepo, []string{"v1", "v2", "v3"}).Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteAcrTags", workerCtx, testRepo, []string{"v4"}).Return(&deletedResponse, nil).Once()
+		summary, err := Tags(testCtx, &mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "[\\s\\S]*", MatchOnTag, false, opts)
+		StopDispatcher()
+		assert.Equal(5, summary.Deleted, "Number of deleted elements should be 5")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, if the registry rejects a batch its tags are deleted one by one.
+	t.Run("FallbackTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		mockClient := mocks.AcrCLIClientInterface{}
+		opts.batchSize = 3
+		StartDispatcher(testCtx, &mockClient, 6)
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("DeleteAcrTags", workerCtx, testRepo, []string{"latest"}).Return(&notFoundResponse, errors.New("error")).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, "latest").Return(&deletedResponse, nil).Once()
+		summary, err := Tags(testCtx, &mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, opts)
+		StopDispatcher()
+		assert.Equal(1, summary.Deleted, "Number of deleted elements should be 1")
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestOutput verifies that a run prints to the output set with SetOutput.
+func TestOutput(t *testing.T) {
+	assert := assert.New(t)
+	opts := NewOptions()
+	out := &bytes.Buffer{}
+	opts.SetOutput(out)
+	mockClient := mocks.AcrCLIClientInterface{}
+	StartDispatcher(testCtx, &mockClient, 6)
+	mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+	mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+	mockClient.On("DeleteAcrTag", workerCtx, testRepo, "latest").Return(&deletedResponse, nil).Once()
+	summary, err := Tags(testCtx, &mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, opts)
+	StopDispatcher()
+	assert.Equal(1, summary.Deleted, "Number of deleted elements should be 1")
+	assert.Equal(nil, err, "Error should be nil")
+	assert.Equal("Deleting tags for repository: bar\nfoo.azurecr.io/bar:latest\n", out.String())
+	mockClient.AssertExpectations(t)
+}
+
+// TestEmptyRepository verifies that only repositories without manifests are deleted.
+func TestEmptyRepository(t *testing.T) {
+	// First test, a repository with manifests is kept and a missing repository is skipped.
+	t.Run("NotEmptyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		deleted, err := EmptyRepository(testCtx, mockClient, testLoginURL, testRepo, false, nil, NewOptions())
+		assert.Equal(false, deleted)
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(notFoundManifestResponse, errors.New("testRepo not found")).Once()
+		deleted, err = EmptyRepository(testCtx, mockClient, testLoginURL, testRepo, false, nil, NewOptions())
+		assert.Equal(false, deleted)
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, an empty repository is deleted unless it is a dry run.
+	t.Run("EmptyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(EmptyListManifestsResult, nil).Twice()
+		deleted, err := EmptyRepository(testCtx, mockClient, testLoginURL, testRepo, true, &RepositoryPlan{Name: testRepo}, NewOptions())
+		assert.Equal(true, deleted)
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.On("DeleteAcrRepository", testCtx, testRepo).Return(&deletedResponse, nil).Once()
+		opts := NewOptions()
+		opts.SetClock(testClock)
+		out := &bytes.Buffer{}
+		opts.SetOutput(out)
+		deleted, err = EmptyRepository(testCtx, mockClient, testLoginURL, testRepo, false, nil, opts)
+		assert.Equal(true, deleted)
+		assert.Equal(nil, err, "Error should be nil")
+		// The deletion is logged with the time of the clock of the run.
+		assert.Equal("Deleted empty repository foo.azurecr.io/bar at 2020-01-15T12:00:00Z\n", out.String())
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, a dry run reports the repository if its plan deletes every manifest and keeps none of its tags,
+	// nothing has been deleted so the repository still has its manifests.
+	t.Run("DryRunTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Times(2)
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Maybe()
+		plan := &RepositoryPlan{
+			Name:      testRepo,
+			Tags:      []acr.TagAttributesBase{{Name: &tagName, Digest: &digest}},
+			Manifests: []acr.ManifestAttributesBase{{Digest: &digest}},
+		}
+		out := &bytes.Buffer{}
+		opts := NewOptions()
+		opts.SetOutput(out)
+		deleted, err := EmptyRepository(testCtx, mockClient, testLoginURL, testRepo, true, plan, opts)
+		assert.Equal(true, deleted)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("Empty repository foo.azurecr.io/bar would be deleted\n", out.String())
+		// A manifest that is not planned stays in the repository.
+		deleted, err = EmptyRepository(testCtx, mockClient, testLoginURL, testRepo, true, &RepositoryPlan{Name: testRepo}, opts)
+		assert.Equal(false, deleted)
+		assert.Equal(nil, err, "Error should be nil")
+		// A kept tag keeps its manifest, the listing is not needed.
+		plan.Kept = []KeptTag{{}}
+		deleted, err = EmptyRepository(testCtx, mockClient, testLoginURL, testRepo, true, plan, opts)
+		assert.Equal(false, deleted)
+		assert.Equal(nil, err, "Error should be nil")
+		mockClient.AssertNotCalled(t, "DeleteAcrRepository", testCtx, testRepo)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, an error deleting the repository is returned.
+	t.Run("DeleteErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("DeleteAcrRepository", testCtx, testRepo).Return(nil, errors.New("forbidden")).Once()
+		deleted, err := EmptyRepository(testCtx, mockClient, testLoginURL, testRepo, false, nil, NewOptions())
+		assert.Equal(false, deleted)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestSupersededTags verifies that a tag is only superseded by a more recent tag that references another digest.
+func TestSupersededTags(t *testing.T) {
+	assert := assert.New(t)
+	superseded := &supersededTags{}
+	assert.Equal(false, superseded.isSuperseded("sha:a", testNow))
+	superseded.add("sha:a", testNow.Add(-3*time.Hour))
+	superseded.add("sha:b", testNow.Add(-2*time.Hour))
+	superseded.add("sha:b", testNow.Add(-1*time.Hour))
+	superseded.add("sha:a", testNow.Add(-90*time.Minute))
+	// sha:b is the newest digest and sha:a is the runner up.
+	assert.Equal(true, superseded.isSuperseded("sha:a", testNow.Add(-90*time.Minute)))
+	assert.Equal(false, superseded.isSuperseded("sha:b", testNow.Add(-1*time.Hour)))
+	assert.Equal(true, superseded.isSuperseded("sha:b", testNow.Add(-2*time.Hour)))
+	assert.Equal(false, superseded.isSuperseded("sha:b", testNow.Add(-90*time.Minute)))
+}
+
+// TestGetRepositoryAndTagRegex returns the repository and the regex from a string in the form <repository>:<regex filter>
+func TestGetRepositoryAndTagRegex(t *testing.T) {
+	// First test normal functionality
+	t.Run("NormalFunctionalityTest", func(t *testing.T) {
+		assert := assert.New(t)
+		testString := "foo:bar"
+		repository, filter, err := getRepositoryAndTagRegex(testString)
+		assert.Equal("foo", repository)
+		assert.Equal("bar", filter)
+		assert.Equal(nil, err, "Error should be nil")
+	})
+	// Second test no colon
+	t.Run("NoColonTest", func(t *testing.T) {
+		assert := assert.New(t)
+		testString := "foo"
+		repository, filter, err := getRepositoryAndTagRegex(testString)
+		assert.Equal("", repository)
+		assert.Equal("", filter)
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+	// Third test more than one colon
+	t.Run("TwoColonsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		testString := "foo:bar:zzz"
+		repository, filter, err := getRepositoryAndTagRegex(testString)
+		assert.Equal("", repository)
+		assert.Equal("", filter)
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+}
+
+// TestGetRepositoryAndDigestRegex returns the repository and the regex from a string in the form <repository>:<regex filter>
+// where the regex filter can contain colons.
+func TestGetRepositoryAndDigestRegex(t *testing.T) {
+	// First test, the colons after the repository name are part of the filter.
+	t.Run("DigestWithColonTest", func(t *testing.T) {
+		assert := assert.New(t)
+		repository, filter, err := getRepositoryAndDigestRegex("foo:^sha256:abc")
+		assert.Equal("foo", repository)
+		assert.Equal("^sha256:abc", filter)
+		assert.Equal(nil, err, "Error should be nil")
+	})
+	// Second test no colon
+	t.Run("NoColonTest", func(t *testing.T) {
+		assert := assert.New(t)
+		repository, filter, err := getRepositoryAndDigestRegex("foo")
+		assert.Equal("", repository)
+		assert.Equal("", filter)
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+}
+
+// TestReadFilters reads the filters of a file with one filter per line.
+func TestReadFilters(t *testing.T) {
+	// First test, blank lines and comments are ignored and the filters are trimmed.
+	t.Run("ValidFiltersTest", func(t *testing.T) {
+		assert := assert.New(t)
+		filters, err := ReadFilters(strings.NewReader("# generated\nfoo:^v1.*\n\n  bar:latest  \n"), MatchOnTag)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{"foo:^v1.*", "bar:latest"}, filters)
+	})
+	// Second test, a filter without a repository or with an invalid regex reports its line number.
+	t.Run("InvalidFilterTest", func(t *testing.T) {
+		assert := assert.New(t)
+		_, err := ReadFilters(strings.NewReader("foo:^v1.*\nbar\n"), MatchOnTag)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), "line 2")
+		_, err = ReadFilters(strings.NewReader("# comment\n\nfoo:^v1.(*\n"), MatchOnTag)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), "line 3")
+	})
+	// Third test, digest filters can contain colons.
+	t.Run("DigestFiltersTest", func(t *testing.T) {
+		assert := assert.New(t)
+		filters, err := ReadFilters(strings.NewReader("foo:^sha256:abc\n"), MatchOnDigest)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{"foo:^sha256:abc"}, filters)
+	})
+}
+
+// TestParseDuration returns an extended duration from a string.
+func TestParseDuration(t *testing.T) {
+	tables := []struct {
+		durationString string
+		duration       time.Duration
+		hasError       bool
+	}{
+		{"15m", -15 * time.Minute, false},
+		{"1d1h3m", -25*time.Hour - 3*time.Minute, false},
+		{"3d", -3 * 24 * time.Hour, false},
+		{"2w1d", -15 * 24 * time.Hour, false},
+		{"", 0, true},
+		{"15p", 0, true},
+		{"15", 0 * time.Minute, true},
+		{"1mo", 0, true},
+		{"1y", 0, true},
+	}
+	assert := assert.New(t)
+	for _, table := range tables {
+		durationResult, errorResult := ParseDuration(table.durationString)
+		assert.Equal(table.duration, durationResult, table.durationString)
+		assert.Equal(table.hasError, errorResult != nil, table.durationString)
+	}
+}
+
+// TestParseAgo contains the tests for the calendar units of the ago values.
+func TestParseAgo(t *testing.T) {
+	// First test, the calendar units are subtracted with the calendar arithmetic.
+	t.Run("CalendarTest", func(t *testing.T) {
+		tables := []struct {
+			ago      string
+			now      time.Time
+			expected time.Time
+		}{
+			{"1mo", time.Date(2020, time.March, 15, 10, 0, 0, 0, time.UTC), time.Date(2020, time.February, 15, 10, 0, 0, 0, time.UTC)},
+			{"1y", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC), time.Date(2019, time.March, 1, 0, 0, 0, 0, time.UTC)},
+			{"1y6mo", time.Date(2020, time.July, 1, 0, 0, 0, 0, time.UTC), time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)},
+			{"2w12h", time.Date(2020, time.March, 15, 12, 0, 0, 0, time.UTC), time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)},
+			{"1mo1d", time.Date(2020, time.March, 31, 0, 0, 0, 0, time.UTC), time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)},
+			{"90m", time.Date(2020, time.March, 15, 12, 0, 0, 0, time.UTC), time.Date(2020, time.March, 15, 10, 30, 0, 0, time.UTC)},
+		}
+		assert := assert.New(t)
+		for _, table := range tables {
+			ago, err := ParseAgo(table.ago)
+			assert.Equal(nil, err, "Error should be nil")
+			assert.Equal(table.expected, ago.Before(table.now), table.ago)
+		}
+	})
+	// Second test, the values that are not made of calendar units followed by a Go duration are rejected.
+	t.Run("InvalidTest", func(t *testing.T) {
+		assert := assert.New(t)
+		for _, ago := range []string{"", "mo", "1h1d", "1m1o", "-1d", "1.5d", "1x"} {
+			_, err := ParseAgo(ago)
+			assert.NotEqual(nil, err, ago)
+		}
+	})
+	// Third test, properties of the calendar units for random values and times.
+	t.Run("PropertyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		before := func(ago string, now time.Time) time.Time {
+			parsed, err := ParseAgo(ago)
+			assert.Equal(nil, err, "Error should be nil")
+			return parsed.Before(now)
+		}
+		randomTime := func(seconds uint32) time.Time { return time.Unix(int64(seconds), 0).UTC() }
+		weeksAreSevenDays := func(n uint8, seconds uint32) bool {
+			now := randomTime(seconds)
+			return before(fmt.Sprintf("%dw", n), now).Equal(before(fmt.Sprintf("%dd", 7*int(n)), now))
+		}
+		yearsAreTwelveMonths := func(n uint8, seconds uint32) bool {
+			now := randomTime(seconds)
+			return before(fmt.Sprintf("%dy", n), now).Equal(before(fmt.Sprintf("%dmo", 12*int(n)), now))
+		}
+		daysMatchHoursInUTC := func(n uint16, seconds uint32) bool {
+			now := randomTime(seconds)
+			return before(fmt.Sprintf("%dd", n), now).Equal(now.Add(-time.Duration(n) * 24 * time.Hour))
+		}
+		monthsAreMonotonic := func(n uint8, seconds uint32) bool {
+			now := randomTime(seconds)
+			return !before(fmt.Sprintf("%dmo", int(n)+1), now).After(before(fmt.Sprintf("%dmo", n), now))
+		}
+		unitsAreAdditive := func(months uint8, days uint8, seconds uint32) bool {
+			now := randomTime(seconds)
+			combined := before(fmt.Sprintf("%dmo%dd", months, days), now)
+			return combined.Equal(now.AddDate(0, -int(months), -int(days)))
+		}
+		for _, property := range []interface{}{weeksAreSevenDays, yearsAreTwelveMonths, daysMatchHoursInUTC, monthsAreMonotonic, unitsAreAdditive} {
+			assert.Equal(nil, quick.Check(property, nil))
+		}
+	})
+}
+
+// TestCutoff returns the time tags have to be last updated before to be purged.
+func TestCutoff(t *testing.T) {
+	tables := []struct {
+		cutoff   Cutoff
+		expected time.Time
+		hasError bool
+	}{
+		{Cutoff{Ago: "1d"}, testNow.Add(-24 * time.Hour), false},
+		{Cutoff{Before: "2019-12-31"}, time.Date(2019, time.December, 31, 0, 0, 0, 0, time.UTC), false},
+		{Cutoff{Before: "2019-12-31T10:00:00+02:00"}, time.Date(2019, time.December, 31, 8, 0, 0, 0, time.UTC), false},
+		{Cutoff{Before: "31/12/2019"}, time.Time{}, true},
+		{Cutoff{Ago: "1d", Before: "2019-12-31"}, time.Time{}, true},
+		{Cutoff{}, time.Time{}, true},
+	}
+	assert := assert.New(t)
+	for _, table := range tables {
+		result, err := table.cutoff.Time(testClock)
+		assert.Equal(table.expected, result)
+		assert.Equal(table.hasError, err != nil)
+	}
+}
+
+// TestMinAge contains the tests for the protection of the tags and manifests updated recently.
+func TestMinAge(t *testing.T) {
+	// First test, a tag updated 15 minutes ago is kept with a minimum age of 1 hour even if the cutoff is now.
+	t.Run("TagTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.Equal(testNow.Add(-time.Hour), opts.SetMinAge(testClock, time.Hour))
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "[\\s\\S]*", MatchOnTag, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, summary.Deleted)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, manifests without tags updated 15 minutes ago are kept with a minimum age of 1 hour and deleted
+	// with a minimum age of 10 minutes.
+	t.Run("ManifestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(doubleManifestV2WithoutTagsResult, nil).Twice()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", digest2).Return(EmptyListManifestsResult, nil).Twice()
+		opts.SetMinAge(testClock, time.Hour)
+		manifests, err := GetManifestsToDelete(testCtx, mockClient, testRepo, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(*manifests))
+		opts.SetMinAge(testClock, 10*time.Minute)
+		manifests, err = GetManifestsToDelete(testCtx, mockClient, testRepo, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, len(*manifests))
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestUntaggedAgo contains the tests for the age condition of the untagged manifests.
+func TestUntaggedAgo(t *testing.T) {
+	// First test, manifests without tags updated 15 minutes ago are kept with an untagged ago of 1 hour and deleted
+	// with an untagged ago of 10 minutes.
+	t.Run("ManifestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(doubleManifestV2WithoutTagsResult, nil).Twice()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", digest2).Return(EmptyListManifestsResult, nil).Twice()
+		updateTime, err := opts.SetUntaggedAgo(testClock, "1h")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(testNow.Add(-time.Hour), updateTime)
+		manifests, err := GetManifestsToDelete(testCtx, mockClient, testRepo, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(*manifests))
+		_, err = opts.SetUntaggedAgo(testClock, "10m")
+		assert.Equal(nil, err, "Error should be nil")
+		manifests, err = GetManifestsToDelete(testCtx, mockClient, testRepo, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, len(*manifests))
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, an invalid duration returns an error and an empty one disables the condition.
+	t.Run("InvalidTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		_, err := opts.SetUntaggedAgo(testClock, "yesterday")
+		assert.NotEqual(nil, err, "Error should not be nil")
+		updateTime, err := opts.SetUntaggedAgo(testClock, "")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.True(updateTime.IsZero())
+	})
+	// Third test, the untagged cutoff of a policy is set on a copy of the options, the options it was copied from
+	// keep their own.
+	t.Run("CopyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		updated := testNow.Add(-30 * time.Minute).Format(time.RFC3339Nano)
+		_, err := opts.SetUntaggedAgo(testClock, "1h")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.True(opts.isUntaggedTooRecent(&updated))
+		planOpts := *opts
+		_, err = planOpts.SetUntaggedAgo(testClock, "10m")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.False(planOpts.isUntaggedTooRecent(&updated))
+		assert.True(opts.isUntaggedTooRecent(&updated))
+	})
+}
+
+// TestTimeOrdering contains the tests for the listing of the tags from the least recently updated.
+func TestTimeOrdering(t *testing.T) {
+	oldTag, newTag := "old", "new"
+	oldTime, newTime := testNow.Add(-48*time.Hour).Format(time.RFC3339Nano), testNow.Add(-time.Minute).Format(time.RFC3339Nano)
+	orderedTags := &acr.RepositoryTagsType{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{
+			{Name: &oldTag, Digest: &digest1, LastUpdateTime: &oldTime, ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled}},
+			{Name: &newTag, Digest: &digest2, LastUpdateTime: &newTime, ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled}},
+		},
+	}
+	// First test, the listing stops at the first tag updated after the cutoff without requesting the next page.
+	t.Run("StopTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.EnableTimeOrdering(true)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, OrderByTimeAsc, "").Return(orderedTags, nil).Once()
+		tagPager := api.NewTagPager(mockClient, testRepo, opts.orderBy)
+		filter := regexp.MustCompile(".*")
+		tagsToDelete, err := opts.getTagsToDelete(testCtx, tagPager, filter, MatchOnTag, testNow.Add(-24*time.Hour), nil, nil, nil)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, len(*tagsToDelete))
+		assert.Equal(oldTag, *(*tagsToDelete)[0].Name)
+		assert.Equal(true, tagPager.Done())
+		tagsToDelete, err = opts.getTagsToDelete(testCtx, tagPager, filter, MatchOnTag, testNow.Add(-24*time.Hour), nil, nil, nil)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal((*[]acr.TagAttributesBase)(nil), tagsToDelete)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, a dry run of the untagged manifests counts all the tags so it lists them in the default order.
+	t.Run("UntaggedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.EnableTimeOrdering(true)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(orderedTags, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", newTag).Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(EmptyListManifestsResult, nil).Once()
+		repoPlan, err := opts.planRepository(testCtx, mockClient, testClock, testRepo, Cutoff{Ago: "1d"}, ".*", MatchOnTag, false, true)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, len(repoPlan.Tags))
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// All the variables used in the tests are defined here.
+var (
+	testCtx          = context.Background()
+	testNow          = time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	testClock        = FixedClock(testNow)
+	testLoginURL     = "foo.azurecr.io"
+	testRepo         = "bar"
+	notFoundResponse = autorest.Response{
+		Response: &http.Response{
+			StatusCode: 404,
+		},
+	}
+	deletedResponse = autorest.Response{
+		Response: &http.Response{
+			StatusCode: 200,
+		},
+	}
+	// Response for the GetAcrTags when the repository is not found.
+	notFoundTagResponse = &acr.RepositoryTagsType{
+		Response: notFoundResponse,
+	}
+	// Response for the GetAcrTags when there are no tags on the testRepo.
+	EmptyListTagsResult = &acr.RepositoryTagsType{
+		Registry:       &testLoginURL,
+		ImageName:      &testRepo,
+		TagsAttributes: nil,
+	}
+	tagName               = "latest"
+	digest                = "sha:abc"
+	multiArchDigest       = "sha:356"
+	deleteEnabled         = true
+	deleteDisabled        = false
+	lastUpdateTime        = testNow.Add(-15 * time.Minute).UTC().Format(time.RFC3339Nano) //Creation time -15minutes from the test clock time
+	invalidLastUpdateTime = "date"
+
+	OneTagResult = &acr.RepositoryTagsType{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{
+			{
+				Name:                 &tagName,
+				LastUpdateTime:       &lastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+				Digest:               &digest,
+			},
+		},
+	}
+
+	InvalidDateOneTagResult = &acr.RepositoryTagsType{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{
+			{
+				Name:                 &tagName,
+				LastUpdateTime:       &invalidLastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+				Digest:               &digest,
+			},
+		},
+	}
+
+	DeleteDisabledOneTagResult = &acr.RepositoryTagsType{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{
+			{
+				Name:                 &tagName,
+				LastUpdateTime:       &lastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteDisabled},
+				Digest:               &digest,
+			},
+		},
+	}
+	tagName1 = "v1"
+	tagName2 = "v2"
+	tagName3 = "v3"
+	tagName4 = "v4"
+
+	FourTagsResult = &acr.RepositoryTagsType{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{{
+			Name:                 &tagName1,
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest,
+		}, {
+			Name:                 &tagName2,
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest,
+		}, {
+			Name:                 &tagName3,
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &multiArchDigest,
+		}, {
+			Name:                 &tagName4,
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest,
+		}},
+	}
+
+	olderUpdateTime      = testNow.Add(-3 * time.Hour).UTC().Format(time.RFC3339Nano)
+	oldUpdateTime        = testNow.Add(-2 * time.Hour).UTC().Format(time.RFC3339Nano)
+	recentUpdateTime     = testNow.Add(-1 * time.Hour).UTC().Format(time.RFC3339Nano)
+	supersededTagsResult = &acr.RepositoryTagsType{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{{
+			Name:                 &tagName1,
+			LastUpdateTime:       &olderUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest,
+		}, {
+			Name:                 &tagName2,
+			LastUpdateTime:       &oldUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest,
+		}, {
+			Name:                 &tagName3,
+			LastUpdateTime:       &recentUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &multiArchDigest,
+		}},
+	}
+
+	// Response for the GetAcrManifests when the repository is not found.
+	notFoundManifestResponse = &acr.Manifests{
+		Response: notFoundResponse,
+	}
+	// Response for the GetAcrManifests when there are no manifests on the testRepo.
+	EmptyListManifestsResult = &acr.Manifests{
+		Registry:            &testLoginURL,
+		ImageName:           &testRepo,
+		ManifestsAttributes: nil,
+	}
+	dockerV2MediaType     = "application/vnd.docker.distribution.manifest.v2+json"
+	manifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	singleManifestV2WithTagsResult = &acr.Manifests{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest,
+			MediaType:            &dockerV2MediaType,
+			Tags:                 &[]string{"latest"},
+		}},
+	}
+	digest1 = "sha:123"
+	digest2 = "sha:234"
+
+	doubleManifestV2WithoutTagsResult = &acr.Manifests{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest1,
+			MediaType:            &dockerV2MediaType,
+			Tags:                 nil,
+		}, {
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &digest2,
+			MediaType:            &dockerV2MediaType,
+			Tags:                 nil,
+		}},
+	}
+
+	singleMultiArchWithTagsResult = &acr.Manifests{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+			LastUpdateTime:       &lastUpdateTime,
+			ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+			Digest:               &multiArchDigest,
+			MediaType:            &manifestListMediaType,
+			Tags:                 &[]string{"v3"},
+		}},
+	}
+	multiArchBytes = []byte(`{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.docker.distribution.manifest.list.v2+json",
+		"manifests": [
+			{
+				"mediaType": "application/vnd.docker.image.manifest.v2+json",
+				"size": 7143,
+				"digest": "sha:123",
+				"platform": {
+					"architecture": "ppc64le",
+					"os": "linux"
+				}
+			}
+		]
+	}`)
+	// workerCtx matches the context the workers derive from testCtx to count the retries of every deletion.
+	workerCtx = mock.Anything
+)
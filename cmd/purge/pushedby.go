@@ -0,0 +1,98 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// pushedByMetadata is the manifest metadata in which ACR records the identity that pushed a manifest, it is only
+// recorded for the pushes authenticated with an Azure AD identity.
+const pushedByMetadata = "pushedBy"
+
+// SetPushedBy restricts the run to the tags and manifests pushed by one of the identities (e.g. the user principal
+// name of a CI service), they are compared without case. Nil removes the restriction.
+func (o *Options) SetPushedBy(identities []string) error {
+	for _, identity := range identities {
+		if len(strings.TrimSpace(identity)) == 0 {
+			return errors.New("invalid pushed-by value, the identity cannot be empty")
+		}
+	}
+	if len(identities) == 0 {
+		identities = nil
+	}
+	o.pushedBy = identities
+	o.pushedByDigests = newDigestCache()
+	return nil
+}
+
+// isPushedBy returns true if the manifest was pushed by one of the identities, or if the purge is not restricted to
+// any identity. Manifests without the metadata (e.g. pushed with the admin user) are never matched.
+func (o *Options) isPushedBy(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digest string) (bool, error) {
+	if o.pushedBy == nil {
+		return true, nil
+	}
+	matched, ok := o.pushedByDigests.get(digest)
+	if ok {
+		return matched, nil
+	}
+	value, err := acrClient.GetManifestMetadata(ctx, repoName, digest, pushedByMetadata)
+	if err != nil && !api.IsNotFound(err) {
+		return false, fmt.Errorf("failed to read who pushed %s@%s: %w", repoName, digest, err)
+	}
+	matched = false
+	if identity, ok := value.(string); ok {
+		for _, expected := range o.pushedBy {
+			if strings.EqualFold(identity, expected) {
+				matched = true
+				break
+			}
+		}
+	}
+	o.pushedByDigests.set(digest, matched)
+	return matched, nil
+}
+
+// onlyPushedBy removes the tags whose manifest was not pushed by one of the identities, like the pages of tags a nil
+// slice stays nil.
+func (o *Options) onlyPushedBy(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, tags *[]acr.TagAttributesBase) (*[]acr.TagAttributesBase, error) {
+	if tags == nil || o.pushedBy == nil {
+		return tags, nil
+	}
+	filtered := []acr.TagAttributesBase{}
+	for _, tag := range *tags {
+		matched, err := o.isPushedBy(ctx, acrClient, repoName, *tag.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			filtered = append(filtered, tag)
+		}
+	}
+	return &filtered, nil
+}
+
+// onlyPushedByManifests removes the untagged manifests that were not pushed by one of the identities.
+func (o *Options) onlyPushedByManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, manifests []acr.ManifestAttributesBase) ([]acr.ManifestAttributesBase, error) {
+	if o.pushedBy == nil {
+		return manifests, nil
+	}
+	filtered := []acr.ManifestAttributesBase{}
+	for _, manifest := range manifests {
+		matched, err := o.isPushedBy(ctx, acrClient, repoName, *manifest.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			filtered = append(filtered, manifest)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPushedBy contains the tests for the restriction of the purge to the images pushed by some identities.
+func TestPushedBy(t *testing.T) {
+	notFound := &api.StatusError{StatusCode: http.StatusNotFound, Message: "not found"}
+	// First test, empty identities are rejected.
+	t.Run("SetPushedByTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.NotEqual(nil, opts.SetPushedBy([]string{" "}), "Error should not be nil")
+		assert.Equal(nil, opts.SetPushedBy(nil), "Error should be nil")
+	})
+	// Second test, a tag pushed by the identity is deleted whatever the case of the recorded identity.
+	t.Run("MatchTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.Equal(nil, opts.SetPushedBy([]string{"ci-bot@contoso.com"}))
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetManifestMetadata", testCtx, testRepo, digest, pushedByMetadata).Return("CI-Bot@contoso.com", nil).Once()
+		repoPlan, err := DryRunPlan(testCtx, mockClient, testClock, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, len(repoPlan.Tags))
+		assert.Equal(0, len(repoPlan.Kept))
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, a tag without a recorded identity is kept.
+	t.Run("NoMetadataTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.Equal(nil, opts.SetPushedBy([]string{"ci-bot@contoso.com"}))
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetManifestMetadata", testCtx, testRepo, digest, pushedByMetadata).Return(nil, notFound).Once()
+		repoPlan, err := DryRunPlan(testCtx, mockClient, testClock, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(repoPlan.Tags))
+		assert.Equal(1, len(repoPlan.Kept))
+		assert.Equal(KeepReasonPushedBy, repoPlan.Kept[0].Reason)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, the metadata of a manifest is only read once and other errors fail the purge.
+	t.Run("ManifestsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.Equal(nil, opts.SetPushedBy([]string{"ci-bot@contoso.com"}))
+		otherDigest := "sha:other"
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetManifestMetadata", testCtx, testRepo, digest, pushedByMetadata).Return("ci-bot@contoso.com", nil).Once()
+		mockClient.On("GetManifestMetadata", testCtx, testRepo, otherDigest, pushedByMetadata).Return("dev@contoso.com", nil).Once()
+		manifests := []acr.ManifestAttributesBase{{Digest: &digest}, {Digest: &otherDigest}, {Digest: &digest}}
+		filtered, err := opts.onlyPushedByManifests(testCtx, mockClient, testRepo, manifests)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]acr.ManifestAttributesBase{{Digest: &digest}, {Digest: &digest}}, filtered)
+		mockClient.AssertExpectations(t)
+		failingClient := &mocks.AcrCLIClientInterface{}
+		failingClient.On("GetManifestMetadata", testCtx, testRepo, "sha:new", pushedByMetadata).Return(nil, &api.StatusError{StatusCode: http.StatusForbidden, Message: "forbidden"}).Once()
+		newDigest := "sha:new"
+		_, err = opts.onlyPushedByManifests(testCtx, failingClient, testRepo, []acr.ManifestAttributesBase{{Digest: &newDigest}})
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// SetReferenceRegistry makes the run keep the tags and manifests whose digest is present in the same repository of
+// another registry, the client has the credentials of that registry. A nil client disables it.
+func (o *Options) SetReferenceRegistry(loginURL string, client api.ManifestHeader) {
+	o.referenceRegistry = client
+	o.referenceLoginURL = loginURL
+	o.presentDigests = newDigestCache()
+}
+
+// isPresentInReference returns true if the manifest is present in the same repository of the reference registry, a
+// repository that does not exist there has no manifests.
+func (o *Options) isPresentInReference(ctx context.Context, repoName string, digest string) (bool, error) {
+	if o.referenceRegistry == nil {
+		return false, nil
+	}
+	key := repoName + "@" + digest
+	present, ok := o.presentDigests.get(key)
+	if ok {
+		return present, nil
+	}
+	referenceDigest, err := o.referenceRegistry.HeadManifest(ctx, repoName, digest)
+	if err != nil && !api.IsNotFound(err) {
+		return false, fmt.Errorf("failed to check if %s@%s is present in %s: %w", repoName, digest, o.referenceLoginURL, err)
+	}
+	present = len(referenceDigest) > 0
+	o.presentDigests.set(key, present)
+	return present, nil
+}
+
+// withoutPresentInReference removes the tags whose digest is present in the reference registry, like the pages of
+// tags a nil slice stays nil.
+func (o *Options) withoutPresentInReference(ctx context.Context, repoName string, tags *[]acr.TagAttributesBase) (*[]acr.TagAttributesBase, error) {
+	if tags == nil || o.referenceRegistry == nil {
+		return tags, nil
+	}
+	filtered := []acr.TagAttributesBase{}
+	for _, tag := range *tags {
+		present, err := o.isPresentInReference(ctx, repoName, *tag.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if present {
+			o.printf("Keeping %s:%s, its digest %s is present in %s\n", repoName, *tag.Name, *tag.Digest, o.referenceLoginURL)
+			continue
+		}
+		filtered = append(filtered, tag)
+	}
+	return &filtered, nil
+}
+
+// withoutPresentInReferenceManifests removes the untagged manifests that are present in the reference registry.
+func (o *Options) withoutPresentInReferenceManifests(ctx context.Context, repoName string, manifests []acr.ManifestAttributesBase) ([]acr.ManifestAttributesBase, error) {
+	if o.referenceRegistry == nil {
+		return manifests, nil
+	}
+	filtered := []acr.ManifestAttributesBase{}
+	for _, manifest := range manifests {
+		present, err := o.isPresentInReference(ctx, repoName, *manifest.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if !present {
+			filtered = append(filtered, manifest)
+		}
+	}
+	return filtered, nil
+}
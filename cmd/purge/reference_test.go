@@ -0,0 +1,79 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeReferenceRegistry returns the digest of the manifests it contains and counts the requests, err is returned for
+// every manifest if set.
+type fakeReferenceRegistry struct {
+	digests  map[string]bool
+	err      error
+	requests int
+}
+
+func (f *fakeReferenceRegistry) HeadManifest(ctx context.Context, repoName string, reference string) (string, error) {
+	f.requests++
+	if f.err != nil || !f.digests[repoName+"@"+reference] {
+		return "", f.err
+	}
+	return reference, nil
+}
+
+// TestReferenceRegistry contains the tests for the tags and manifests kept because they are present in a reference
+// registry.
+func TestReferenceRegistry(t *testing.T) {
+	// First test, a tag whose digest is present in the reference registry is kept by the purge and by the dry run, the
+	// reference registry is only asked once.
+	t.Run("KeepPresentTagTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		reference := &fakeReferenceRegistry{digests: map[string]bool{testRepo + "@" + digest: true}}
+		opts.SetReferenceRegistry("prod.azurecr.io", reference)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Twice()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Twice()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(Summary{Scanned: 1, Skipped: 1}, summary)
+		repoPlan, err := DryRunPlan(testCtx, mockClient, testClock, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(repoPlan.Tags))
+		assert.Equal(1, len(repoPlan.Kept))
+		assert.Equal(KeepReasonReference, repoPlan.Kept[0].Reason)
+		assert.Equal(1, reference.requests)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, only the untagged manifests that are present in the same repository of the reference registry are
+	// kept.
+	t.Run("KeepPresentManifestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetReferenceRegistry("prod.azurecr.io", &fakeReferenceRegistry{digests: map[string]bool{"other@" + digest: true}})
+		manifests := []acr.ManifestAttributesBase{{Digest: &digest}}
+		filtered, err := opts.withoutPresentInReferenceManifests(testCtx, testRepo, manifests)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(1, len(filtered))
+		filtered, err = opts.withoutPresentInReferenceManifests(testCtx, "other", manifests)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(filtered))
+	})
+	// Third test, if the reference registry cannot be checked nothing is deleted.
+	t.Run("ReferenceErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetReferenceRegistry("prod.azurecr.io", &fakeReferenceRegistry{err: errors.New("unauthorized")})
+		manifests := []acr.ManifestAttributesBase{{Digest: &digest}}
+		_, err := opts.withoutPresentInReferenceManifests(testCtx, testRepo, manifests)
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+}
@@ -0,0 +1,164 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// SetIncludeReferrers makes the untagged purge delete the referrer chain of every manifest it deletes (e.g. a
+// signature of an SBOM attached to an image), the referrers are deleted before the manifests they refer to.
+func (o *Options) SetIncludeReferrers(enabled bool) {
+	o.includeReferrers = enabled
+}
+
+// withReferrerChains adds the referrers of the manifests, and their referrers recursively, to the manifests to delete.
+// The referrers are in the same repository as their subject and only untagged referrers that can be deleted are
+// added, the manifests whose chain has a referrer that is kept (tagged is true for it, it is locked or too recent)
+// are kept with their whole chain so that no referrer is left without its subject. The returned manifests are sorted
+// so that every referrer comes before its subject, and the map contains the referrers of every manifest that has any.
+func (o *Options) withReferrerChains(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, manifests []acr.ManifestAttributesBase, listed map[string]acr.ManifestAttributesBase, tagged func(acr.ManifestAttributesBase) bool) ([]acr.ManifestAttributesBase, map[string][]string, error) {
+	if !o.includeReferrers || len(manifests) == 0 {
+		return manifests, nil, nil
+	}
+	referrers := map[string][]string{}
+	depths := map[string]int{}
+	order := []string{}
+	kept := map[string]bool{}
+	// shiftDepth moves a chain deeper, a selected manifest can also be a referrer of another selected manifest.
+	var shiftDepth func(digest string, delta int)
+	shiftDepth = func(digest string, delta int) {
+		depths[digest] += delta
+		for _, referrer := range referrers[digest] {
+			shiftDepth(referrer, delta)
+		}
+	}
+	// discover finds the chain of a manifest and returns false if the manifest has to be kept.
+	var discover func(digest string, depth int) (bool, error)
+	discover = func(digest string, depth int) (bool, error) {
+		if previous, ok := depths[digest]; ok {
+			if depth > previous {
+				shiftDepth(digest, depth-previous)
+			}
+			return !kept[digest], nil
+		}
+		depths[digest] = depth
+		order = append(order, digest)
+		referrerDigests, err := getReferrerDigests(ctx, acrClient, repoName, digest)
+		if err != nil {
+			return false, err
+		}
+		for _, referrer := range referrerDigests {
+			attributes, ok := listed[referrer]
+			if !ok {
+				// The referrer was deleted after the manifests were listed.
+				continue
+			}
+			if tagged(attributes) || !*(*attributes.ChangeableAttributes).DeleteEnabled || o.isUntaggedTooRecent(attributes.LastUpdateTime) {
+				o.printf("Keeping %s@%s, its referrer %s is tagged, locked or too recent\n", repoName, digest, referrer)
+				kept[digest] = true
+				continue
+			}
+			referrers[digest] = append(referrers[digest], referrer)
+			deletable, err := discover(referrer, depth+1)
+			if err != nil {
+				return false, err
+			}
+			if !deletable {
+				kept[digest] = true
+			}
+		}
+		return !kept[digest], nil
+	}
+	for _, manifest := range manifests {
+		if _, err := discover(*manifest.Digest, 0); err != nil {
+			return nil, nil, err
+		}
+	}
+	// The referrers of a kept manifest are kept too, they would be deleted without their subject otherwise.
+	var keepChain func(digest string)
+	keepChain = func(digest string) {
+		kept[digest] = true
+		for _, referrer := range referrers[digest] {
+			keepChain(referrer)
+		}
+		delete(referrers, digest)
+	}
+	for _, digest := range order {
+		if kept[digest] {
+			keepChain(digest)
+		}
+	}
+	attributes := map[string]acr.ManifestAttributesBase{}
+	for _, digest := range order {
+		attributes[digest] = listed[digest]
+	}
+	for _, manifest := range manifests {
+		attributes[*manifest.Digest] = manifest
+	}
+	chains := []acr.ManifestAttributesBase{}
+	for _, digest := range order {
+		if !kept[digest] {
+			chains = append(chains, attributes[digest])
+		}
+	}
+	// The deepest referrers are deleted first and the selected manifests last.
+	sort.SliceStable(chains, func(i, j int) bool {
+		return depths[*chains[i].Digest] > depths[*chains[j].Digest]
+	})
+	return chains, referrers, nil
+}
+
+// getReferrerDigests returns the digests of the manifests whose subject is the digest, registries without the referrers
+// API have none.
+func getReferrerDigests(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digest string) ([]string, error) {
+	referrersBytes, err := acrClient.GetReferrers(ctx, repoName, digest)
+	if err != nil {
+		if api.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list the referrers of %s@%s: %w", repoName, digest, err)
+	}
+	var referrers struct {
+		Manifests []descriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(referrersBytes, &referrers); err != nil {
+		return nil, fmt.Errorf("failed to parse the referrers of %s@%s: %w", repoName, digest, err)
+	}
+	digests := []string{}
+	for _, referrer := range referrers.Manifests {
+		digests = append(digests, referrer.Digest)
+	}
+	return digests, nil
+}
+
+// referrerWaves splits the manifests to delete, sorted by withReferrerChains, in groups that can be deleted
+// concurrently: a group only starts after the referrers of its manifests were deleted.
+func referrerWaves(manifests []acr.ManifestAttributesBase, referrers map[string][]string) [][]acr.ManifestAttributesBase {
+	if len(referrers) == 0 {
+		return [][]acr.ManifestAttributesBase{manifests}
+	}
+	waves := [][]acr.ManifestAttributesBase{}
+	wave := []acr.ManifestAttributesBase{}
+	inWave := map[string]bool{}
+	for _, manifest := range manifests {
+		for _, referrer := range referrers[*manifest.Digest] {
+			if inWave[referrer] {
+				waves = append(waves, wave)
+				wave = []acr.ManifestAttributesBase{}
+				inWave = map[string]bool{}
+				break
+			}
+		}
+		wave = append(wave, manifest)
+		inWave[*manifest.Digest] = true
+	}
+	return append(waves, wave)
+}
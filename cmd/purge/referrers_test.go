@@ -0,0 +1,115 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReferrerChains contains the tests for the referrer chains deleted with the untagged manifests.
+func TestReferrerChains(t *testing.T) {
+	notFound := &api.StatusError{StatusCode: http.StatusNotFound, Message: "not found"}
+	// untaggedManifest returns the attributes of an untagged manifest that can be deleted.
+	untaggedManifest := func(digest string) acr.ManifestAttributesBase {
+		return acr.ManifestAttributesBase{Digest: &digest, LastUpdateTime: &lastUpdateTime, ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled}}
+	}
+	// referrersIndex returns the index the referrers API returns for the digests.
+	referrersIndex := func(digests ...string) []byte {
+		manifests := []string{}
+		for _, digest := range digests {
+			manifests = append(manifests, fmt.Sprintf(`{"digest":%q}`, digest))
+		}
+		return []byte(`{"manifests":[` + strings.Join(manifests, ",") + `]}`)
+	}
+	// digestsOf returns the digests of the manifests.
+	digestsOf := func(manifests []acr.ManifestAttributesBase) []string {
+		digests := []string{}
+		for _, manifest := range manifests {
+			digests = append(digests, *manifest.Digest)
+		}
+		return digests
+	}
+	untagged := func(manifest acr.ManifestAttributesBase) bool { return false }
+	// First test, the chain of a manifest is deleted before it, the deepest referrers first.
+	t.Run("ChainTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetIncludeReferrers(true)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetReferrers", testCtx, testRepo, "sha:subject").Return(referrersIndex("sha:signature", "sha:sbom"), nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, "sha:signature").Return(nil, notFound).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, "sha:sbom").Return(referrersIndex("sha:sbom-signature"), nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, "sha:sbom-signature").Return(referrersIndex(), nil).Once()
+		listed := map[string]acr.ManifestAttributesBase{}
+		for _, digest := range []string{"sha:subject", "sha:signature", "sha:sbom", "sha:sbom-signature"} {
+			listed[digest] = untaggedManifest(digest)
+		}
+		manifests, referrers, err := opts.withReferrerChains(testCtx, mockClient, testRepo, []acr.ManifestAttributesBase{listed["sha:subject"]}, listed, untagged)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{"sha:sbom-signature", "sha:signature", "sha:sbom", "sha:subject"}, digestsOf(manifests))
+		assert.Equal(map[string][]string{"sha:subject": {"sha:signature", "sha:sbom"}, "sha:sbom": {"sha:sbom-signature"}}, referrers)
+		waves := [][]string{}
+		for _, wave := range referrerWaves(manifests, referrers) {
+			waves = append(waves, digestsOf(wave))
+		}
+		assert.Equal([][]string{{"sha:sbom-signature", "sha:signature"}, {"sha:sbom"}, {"sha:subject"}}, waves)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, a tagged referrer keeps the manifest and the rest of its chain.
+	t.Run("TaggedReferrerTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetIncludeReferrers(true)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetReferrers", testCtx, testRepo, "sha:subject").Return(referrersIndex("sha:signature", "sha:sbom"), nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, "sha:signature").Return(referrersIndex(), nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, "sha:other").Return(referrersIndex(), nil).Once()
+		listed := map[string]acr.ManifestAttributesBase{}
+		for _, digest := range []string{"sha:subject", "sha:signature", "sha:sbom", "sha:other"} {
+			listed[digest] = untaggedManifest(digest)
+		}
+		tagged := func(manifest acr.ManifestAttributesBase) bool { return *manifest.Digest == "sha:sbom" }
+		manifests, referrers, err := opts.withReferrerChains(testCtx, mockClient, testRepo, []acr.ManifestAttributesBase{listed["sha:subject"], listed["sha:other"]}, listed, tagged)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{"sha:other"}, digestsOf(manifests))
+		assert.Equal(0, len(referrers))
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, a selected manifest that refers to another selected manifest is deleted before it.
+	t.Run("SelectedReferrerTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetIncludeReferrers(true)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetReferrers", testCtx, testRepo, "sha:signature").Return(referrersIndex(), nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, "sha:subject").Return(referrersIndex("sha:signature"), nil).Once()
+		listed := map[string]acr.ManifestAttributesBase{"sha:subject": untaggedManifest("sha:subject"), "sha:signature": untaggedManifest("sha:signature")}
+		manifests, _, err := opts.withReferrerChains(testCtx, mockClient, testRepo, []acr.ManifestAttributesBase{listed["sha:subject"], listed["sha:signature"]}, listed, untagged)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]string{"sha:signature", "sha:subject"}, digestsOf(manifests))
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, without the setting the referrers are not listed.
+	t.Run("DisabledTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		opts.SetIncludeReferrers(false)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		selected := []acr.ManifestAttributesBase{untaggedManifest("sha:subject")}
+		manifests, referrers, err := opts.withReferrerChains(testCtx, mockClient, testRepo, selected, nil, untagged)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(selected, manifests)
+		assert.Nil(referrers)
+		assert.Equal([][]acr.ManifestAttributesBase{selected}, referrerWaves(manifests, referrers))
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// The signature policies of the purge. SignaturesProtect keeps the signed images and prints a message for each of
+// them, SignaturesAllow deletes them but prints which ones were signed, and SignaturesOnlyUnsigned quietly restricts
+// the purge to the unsigned images.
+const (
+	SignaturesProtect      = "protect"
+	SignaturesAllow        = "allow"
+	SignaturesOnlyUnsigned = "only-unsigned"
+)
+
+// The artifact types of the signatures attached to an image through the referrers API, cosign also stores its
+// signatures in a tag named after the digest of the image (sha256-<hex>.sig).
+const (
+	NotationSignatureArtifactType = "application/vnd.cncf.notary.signature"
+	CosignSignatureArtifactType   = "application/vnd.dev.cosign.artifact.sig.v1+json"
+	cosignSignatureTagSuffix      = ".sig"
+)
+
+// signatureArtifactTypes are the artifact types that make an image signed.
+var signatureArtifactTypes = map[string]bool{
+	NotationSignatureArtifactType: true,
+	CosignSignatureArtifactType:   true,
+}
+
+// SetSignaturePolicy makes the run check whether the candidates are signed with Notation or cosign before deleting
+// them, an empty policy disables the check.
+func (o *Options) SetSignaturePolicy(policy string) error {
+	switch policy {
+	case "", SignaturesProtect, SignaturesAllow, SignaturesOnlyUnsigned:
+	default:
+		return fmt.Errorf("invalid signature policy %q, supported values are %q, %q and %q", policy, SignaturesProtect, SignaturesAllow, SignaturesOnlyUnsigned)
+	}
+	o.signaturePolicy = policy
+	o.signedDigests = newDigestCache()
+	return nil
+}
+
+// isSigned returns true if a Notation or cosign signature refers to the digest, the result is cached by digest for
+// the rest of the run.
+func (o *Options) isSigned(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digest string) (bool, error) {
+	if signed, ok := o.signedDigests.get(digest); ok {
+		return signed, nil
+	}
+	signed, err := IsSigned(ctx, acrClient, repoName, digest)
+	if err != nil {
+		return false, err
+	}
+	o.signedDigests.set(digest, signed)
+	return signed, nil
+}
+
+// IsSigned returns true if a Notation or cosign signature refers to the digest. Registries without the referrers
+// API are only checked for the cosign signature tag.
+func IsSigned(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digest string) (bool, error) {
+	signed := false
+	referrersBytes, err := acrClient.GetReferrers(ctx, repoName, digest)
+	if err != nil && !api.IsNotFound(err) {
+		return false, fmt.Errorf("failed to list the referrers of %s@%s to find its signatures: %w", repoName, digest, err)
+	}
+	if err == nil {
+		var referrers struct {
+			Manifests []struct {
+				ArtifactType string `json:"artifactType"`
+			} `json:"manifests"`
+		}
+		if err := json.Unmarshal(referrersBytes, &referrers); err != nil {
+			return false, fmt.Errorf("failed to parse the referrers of %s@%s: %w", repoName, digest, err)
+		}
+		for _, referrer := range referrers.Manifests {
+			if signatureArtifactTypes[referrer.ArtifactType] {
+				signed = true
+				break
+			}
+		}
+	}
+	if !signed {
+		signatureTag := strings.Replace(digest, ":", "-", 1) + cosignSignatureTagSuffix
+		if _, err := acrClient.GetManifest(ctx, repoName, signatureTag); err == nil {
+			signed = true
+		} else if !api.IsNotFound(err) {
+			return false, fmt.Errorf("failed to fetch the cosign signature of %s@%s: %w", repoName, digest, err)
+		}
+	}
+	return signed, nil
+}
+
+// keepsSigned returns true if the image is signed and the signature policy keeps the signed images.
+func (o *Options) keepsSigned(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digest string) (bool, error) {
+	if len(o.signaturePolicy) == 0 || o.signaturePolicy == SignaturesAllow {
+		return false, nil
+	}
+	return o.isSigned(ctx, acrClient, repoName, digest)
+}
+
+// withoutSigned removes the tags whose image is signed according to the signature policy, like the pages of tags a
+// nil slice stays nil.
+func (o *Options) withoutSigned(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, tags *[]acr.TagAttributesBase) (*[]acr.TagAttributesBase, error) {
+	if tags == nil || len(o.signaturePolicy) == 0 {
+		return tags, nil
+	}
+	filtered := []acr.TagAttributesBase{}
+	for _, tag := range *tags {
+		signed, err := o.isSigned(ctx, acrClient, repoName, *tag.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if o.keepSigned(signed, fmt.Sprintf("%s:%s", repoName, *tag.Name)) {
+			continue
+		}
+		filtered = append(filtered, tag)
+	}
+	return &filtered, nil
+}
+
+// withoutSignedManifests removes the untagged manifests that are signed according to the signature policy.
+func (o *Options) withoutSignedManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, manifests []acr.ManifestAttributesBase) ([]acr.ManifestAttributesBase, error) {
+	if len(o.signaturePolicy) == 0 {
+		return manifests, nil
+	}
+	filtered := []acr.ManifestAttributesBase{}
+	for _, manifest := range manifests {
+		signed, err := o.isSigned(ctx, acrClient, repoName, *manifest.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if o.keepSigned(signed, fmt.Sprintf("%s@%s", repoName, *manifest.Digest)) {
+			continue
+		}
+		filtered = append(filtered, manifest)
+	}
+	return filtered, nil
+}
+
+// keepSigned returns true if the image has to be kept because it is signed, and prints why it is kept or that a
+// signed image is deleted.
+func (o *Options) keepSigned(signed bool, reference string) bool {
+	if !signed {
+		return false
+	}
+	switch o.signaturePolicy {
+	case SignaturesProtect:
+		o.printf("Keeping signed image %s, use --allow-signed to delete it\n", reference)
+		return true
+	case SignaturesAllow:
+		o.printf("Signed image %s is selected for deletion because signed images are allowed\n", reference)
+		return false
+	}
+	return true
+}
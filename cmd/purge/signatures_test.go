@@ -0,0 +1,85 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// notationReferrers is the referrers index of an image signed with Notation.
+var notationReferrers = []byte(`{"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/vnd.cncf.notary.signature","digest":"sha:signature","size":10}]}`)
+
+// TestSignatures contains the tests for the signature policies of the purge.
+func TestSignatures(t *testing.T) {
+	notFound := &api.StatusError{StatusCode: http.StatusNotFound, Message: "not found"}
+	// First test, only the known policies are accepted.
+	t.Run("SetSignaturePolicyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.NotEqual(nil, opts.SetSignaturePolicy("strict"), "Error should not be nil")
+		assert.Equal(nil, opts.SetSignaturePolicy(SignaturesProtect), "Error should be nil")
+		assert.Equal(nil, opts.SetSignaturePolicy(""), "Error should be nil")
+	})
+	// Second test, a tag of an image signed with Notation is kept.
+	t.Run("ProtectTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.Equal(nil, opts.SetSignaturePolicy(SignaturesProtect))
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, digest).Return(notationReferrers, nil).Once()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(Summary{Scanned: 1, Skipped: 1}, summary)
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, registries without the referrers API are checked for the cosign signature tag.
+	t.Run("CosignTagTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.Equal(nil, opts.SetSignaturePolicy(SignaturesOnlyUnsigned))
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, digest).Return(nil, notFound).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha-abc.sig").Return([]byte(`{}`), nil).Once()
+		repoPlan, err := DryRunPlan(testCtx, mockClient, testClock, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(repoPlan.Tags))
+		assert.Equal(1, len(repoPlan.Kept))
+		assert.Equal(KeepReasonSigned, repoPlan.Kept[0].Reason)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, unsigned images and, with the allow policy, signed images are deleted.
+	t.Run("AllowTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		for _, policy := range []string{SignaturesProtect, SignaturesAllow} {
+			assert.Equal(nil, opts.SetSignaturePolicy(policy))
+			mockClient := &mocks.AcrCLIClientInterface{}
+			StartDispatcher(testCtx, mockClient, 6)
+			mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+			mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+			if policy == SignaturesProtect {
+				mockClient.On("GetReferrers", testCtx, testRepo, digest).Return([]byte(`{"manifests":[]}`), nil).Once()
+				mockClient.On("GetManifest", testCtx, testRepo, "sha-abc.sig").Return(nil, notFound).Once()
+			} else {
+				mockClient.On("GetReferrers", testCtx, testRepo, digest).Return(notationReferrers, nil).Once()
+			}
+			mockClient.On("DeleteAcrTag", workerCtx, testRepo, tagName).Return(&deletedResponse, nil).Once()
+			summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, opts)
+			StopDispatcher()
+			assert.Equal(nil, err, "Error should be nil")
+			assert.Equal(Summary{Scanned: 1, Deleted: 1}, summary, policy)
+			mockClient.AssertExpectations(t)
+		}
+		opts.SetSignaturePolicy("")
+	})
+}
@@ -0,0 +1,141 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+
+	"github.com/Azure/acr-cli/acr"
+)
+
+// stateBlockSize is the number of manifests deleted between two checkpoints of the state.
+const stateBlockSize = 100
+
+// State is the progress of a purge, it is stored in a file after every block of deletions so that a purge that was
+// aborted (e.g. after being throttled for too long) resumes where it left off instead of listing everything again.
+type State struct {
+	path string
+	// Policy is the policy of the purge that wrote the state, a state is only resumed by a purge with the same policy.
+	Policy       Policy                      `json:"policy"`
+	Repositories map[string]*RepositoryState `json:"repositories"`
+}
+
+// RepositoryState is the progress of the purge of a repository.
+type RepositoryState struct {
+	// TagsLast is where the listing of the tags continues, the matching tags of the previous pages were purged.
+	TagsLast string `json:"tagsLast,omitempty"`
+	// TagsDone is set once all the tags of the repository were purged.
+	TagsDone bool `json:"tagsDone,omitempty"`
+	// DeletedDigests are the manifests that were already deleted.
+	DeletedDigests []string `json:"deletedDigests,omitempty"`
+	// Done is set once the repository was completely purged.
+	Done bool `json:"done,omitempty"`
+}
+
+// LoadState reads the state stored in path by a purge with the same policy, a new state is returned if the file does
+// not exist.
+func LoadState(path string, policy Policy) (*State, error) {
+	s := &State{path: path, Policy: policy, Repositories: map[string]*RepositoryState{}}
+	stateBytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the state file: %w", err)
+	}
+	stored := State{}
+	if err := json.Unmarshal(stateBytes, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse the state file %s: %w", path, err)
+	}
+	if !reflect.DeepEqual(stored.Policy, policy) {
+		return nil, fmt.Errorf("the state file %s was written by a purge with different filters or flags, remove it to start a new purge", path)
+	}
+	if stored.Repositories != nil {
+		s.Repositories = stored.Repositories
+	}
+	return s, nil
+}
+
+// EnableState makes the run checkpoint its progress in the state and resume from it, nil disables it.
+func (o *Options) EnableState(s *State) {
+	o.state = s
+}
+
+// Save writes the state to its file, it is written to a temporary file first so that an abort while writing does not
+// leave a truncated state.
+func (s *State) Save() error {
+	stateBytes, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(s.path+".tmp", stateBytes, 0600); err != nil {
+		return fmt.Errorf("failed to write the state file: %w", err)
+	}
+	if err := os.Rename(s.path+".tmp", s.path); err != nil {
+		return fmt.Errorf("failed to write the state file: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the state file, it is called when the purge finishes so that the next purge starts from the
+// beginning.
+func (s *State) Remove() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove the state file: %w", err)
+	}
+	return nil
+}
+
+// Repository returns the progress of a repository, it is created if the repository was not started.
+func (s *State) Repository(repoName string) *RepositoryState {
+	repoState, ok := s.Repositories[repoName]
+	if !ok {
+		repoState = &RepositoryState{}
+		s.Repositories[repoName] = repoState
+	}
+	return repoState
+}
+
+// FinishRepository marks a repository as completely purged and saves the state.
+func (s *State) FinishRepository(repoName string) error {
+	s.Repository(repoName).Done = true
+	return s.Save()
+}
+
+// tagsPurged saves where the listing of the tags of a repository continues, done is set after the last page.
+func (s *State) tagsPurged(repoName string, last string, done bool) error {
+	repoState := s.Repository(repoName)
+	repoState.TagsLast = last
+	repoState.TagsDone = done
+	return s.Save()
+}
+
+// manifestsDeleted adds deleted manifests to the state and saves it.
+func (s *State) manifestsDeleted(repoName string, manifests []acr.ManifestAttributesBase) error {
+	repoState := s.Repository(repoName)
+	for _, manifest := range manifests {
+		repoState.DeletedDigests = append(repoState.DeletedDigests, *manifest.Digest)
+	}
+	return s.Save()
+}
+
+// withoutDeleted removes the manifests that the state records as deleted, the registry might still list them for a
+// short time after their deletion.
+func (s *State) withoutDeleted(repoName string, manifests []acr.ManifestAttributesBase) []acr.ManifestAttributesBase {
+	deleted := map[string]bool{}
+	for _, digest := range s.Repository(repoName).DeletedDigests {
+		deleted[digest] = true
+	}
+	remaining := []acr.ManifestAttributesBase{}
+	for _, manifest := range manifests {
+		if !deleted[*manifest.Digest] {
+			remaining = append(remaining, manifest)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestState contains the tests for the checkpoints of the progress of a purge.
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	policy := Policy{Filters: []string{testRepo + ":.*"}, Ago: "1d"}
+	// First test, a state is stored and loaded again by a purge with the same policy but not with a different one.
+	t.Run("LoadTest", func(t *testing.T) {
+		assert := assert.New(t)
+		path := filepath.Join(dir, "load.json")
+		s, err := LoadState(path, policy)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(nil, s.tagsPurged(testRepo, "v2", false))
+		assert.Equal(nil, s.FinishRepository("other"))
+		loaded, err := LoadState(path, policy)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("v2", loaded.Repository(testRepo).TagsLast)
+		assert.Equal(true, loaded.Repository("other").Done)
+		_, err = LoadState(path, Policy{Filters: policy.Filters, Ago: "2d"})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Equal(nil, loaded.Remove())
+		_, err = os.Stat(path)
+		assert.True(os.IsNotExist(err))
+	})
+	// Second test, the tags are listed again after the last page that was purged and the state records that all of
+	// them were purged.
+	t.Run("ResumeTagsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		s, err := LoadState(filepath.Join(dir, "resume.json"), policy)
+		assert.Equal(nil, err, "Error should be nil")
+		s.Repository(testRepo).TagsLast = "v1"
+		opts.EnableState(s)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "v1").Return(EmptyListTagsResult, nil).Once()
+		summary, err := Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "1d"}, "[\\s\\S]*", MatchOnTag, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, summary.Deleted)
+		assert.Equal(true, s.Repository(testRepo).TagsDone)
+		// The tags are not listed again once they were all purged.
+		summary, err = Tags(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "1d"}, "[\\s\\S]*", MatchOnTag, false, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, summary.Deleted)
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, the manifests the state records as deleted are not deleted again.
+	t.Run("ResumeManifestsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		s, err := LoadState(filepath.Join(dir, "manifests.json"), policy)
+		assert.Equal(nil, err, "Error should be nil")
+		s.Repository(testRepo).DeletedDigests = []string{digest1, digest2}
+		opts.EnableState(s)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", digest2).Return(EmptyListManifestsResult, nil).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, opts)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, summary.Deleted)
+		mockClient.AssertExpectations(t)
+	})
+}
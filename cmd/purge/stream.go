@@ -0,0 +1,54 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// streamThreshold is the number of untagged manifests of a repository above which the untagged purge stops keeping
+// them in memory and deletes them page by page instead.
+var streamThreshold = 10000
+
+// streamDanglingManifests lists the manifests of a repository again and deletes the untagged ones of every page
+// before listing the next one, so the memory does not grow with the number of untagged manifests and the deletions
+// start after the first page. doNotDelete are the manifests referenced by a manifest list with tags, found by the
+// first listing. The deleted manifests are behind the cursor of the listing, so they do not move the next pages.
+func (o *Options) streamDanglingManifests(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, repoName string, doNotDelete map[string]bool, summary *Summary) error {
+	manifestPager := api.NewManifestPager(acrClient, repoName, "")
+	for !manifestPager.Done() {
+		resultManifests, err := manifestPager.Next(ctx)
+		if err != nil {
+			if errors.Is(err, api.ErrNotFound) {
+				// The repository was deleted since the first listing.
+				return nil
+			}
+			return err
+		}
+		if resultManifests == nil || resultManifests.ManifestsAttributes == nil {
+			break
+		}
+		summary.Scanned = manifestPager.Listed()
+		o.emitPageScanned(repoName, progressKindManifests, len(*resultManifests.ManifestsAttributes), summary.Scanned)
+		candidates := []acr.ManifestAttributesBase{}
+		for _, manifest := range *resultManifests.ManifestsAttributes {
+			if manifest.Tags == nil {
+				candidates = append(candidates, manifest)
+			}
+		}
+		manifests, unreferenced, err := o.selectManifestsToDelete(ctx, acrClient, repoName, candidates, doNotDelete)
+		if err != nil {
+			return err
+		}
+		summary.Skipped += unreferenced - len(manifests)
+		if err := o.deleteManifestWave(loginURL, repoName, manifests, summary); err != nil {
+			return err
+		}
+	}
+	return nil
+}
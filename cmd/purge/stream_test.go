@@ -0,0 +1,80 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStreamDanglingManifests contains the tests for the untagged purge of the repositories with too many untagged
+// manifests to keep them in memory.
+func TestStreamDanglingManifests(t *testing.T) {
+	defer func(threshold int) { streamThreshold = threshold }(streamThreshold)
+	streamThreshold = 1
+	// First test, the listing drops the candidates once there are too many of them but keeps the manifests referenced
+	// by a manifest list with tags.
+	t.Run("ListingTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleMultiArchWithTagsResult, nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha:356").Return(multiArchBytes, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:356").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Once()
+		listing, err := opts.listUntaggedManifests(testCtx, mockClient, testRepo, true)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.True(listing.streamed)
+		assert.Nil(listing.candidates)
+		assert.Nil(listing.listed)
+		assert.True(listing.doNotDelete["sha:123"])
+		assert.Equal(3, listing.scanned)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, the manifests are listed again and the untagged ones that are not referenced by the manifest list
+	// with tags are deleted page by page.
+	t.Run("DeleteTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, mockClient, 6)
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleMultiArchWithTagsResult, nil).Twice()
+		mockClient.On("GetManifest", testCtx, testRepo, "sha:356").Return(multiArchBytes, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:356").Return(doubleManifestV2WithoutTagsResult, nil).Twice()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Twice()
+		mockClient.On("DeleteManifest", workerCtx, testRepo, "sha:234").Return(nil, nil).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		StopDispatcher()
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(Summary{Scanned: 3, Deleted: 1}, summary)
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, an error while listing the manifests again is returned.
+	t.Run("ListAgainErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(nil, errors.New("error getting manifests")).Once()
+		summary, err := DanglingManifests(testCtx, mockClient, testLoginURL, testRepo, NewOptions())
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Equal(0, summary.Deleted)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, the referrer chains need all the manifests so the listing is not streamed when they are included.
+	t.Run("IncludeReferrersTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(doubleManifestV2WithoutTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "sha:234").Return(EmptyListManifestsResult, nil).Once()
+		listing, err := opts.listUntaggedManifests(testCtx, mockClient, testRepo, false)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.False(listing.streamed)
+		assert.Equal(2, len(listing.candidates))
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,162 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+//go:build stress
+// +build stress
+
+package purge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/fakeacr"
+	"github.com/stretchr/testify/assert"
+)
+
+// The size of the registry of the stress tests and the latency of its requests.
+const (
+	stressRepositories = 16
+	stressTags         = 25
+	stressUntagged     = 5
+	stressLatency      = 5 * time.Millisecond
+)
+
+// TestStressConcurrentPurges purges the repositories of a slow registry at the same time through the same workers,
+// half of them like the purge command and half like the jobs of acr serve. Every purge must only count its own
+// deletions. It is run with make stress, which enables the race detector.
+func TestStressConcurrentPurges(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	registry := fakeacr.NewRegistry("user", "password")
+	defer registry.Close()
+	registry.SetPageSize(10)
+	now := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-72 * time.Hour)
+	repoNames := []string{}
+	for i := 0; i < stressRepositories; i++ {
+		repoName := fmt.Sprintf("stress/repo%d", i)
+		repoNames = append(repoNames, repoName)
+		for j := 0; j < stressTags; j++ {
+			registry.PushImage(repoName, fmt.Sprintf("v%d", j), old)
+		}
+		for j := 0; j < stressUntagged; j++ {
+			registry.PushImage(repoName, "", old)
+		}
+		registry.PushImage(repoName, "latest", now)
+	}
+	registry.SetLatency(stressLatency)
+
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), "user", "password", nil)
+	assert.Equal(nil, err, "Error should be nil")
+	acrClient.AutorestClient.Sender = registry.HTTPClient()
+	StartDispatcher(ctx, acrClient, 8)
+	defer StopDispatcher()
+
+	deletedTags := make([]int, len(repoNames))
+	deletedManifests := make([]int, len(repoNames))
+	errs := make([]error, len(repoNames))
+	var wg sync.WaitGroup
+	for i, repoName := range repoNames {
+		wg.Add(1)
+		go func(i int, repoName string) {
+			defer wg.Done()
+			if i%2 == 0 {
+				tagSummary, err := Tags(ctx, acrClient, FixedClock(now), registry.LoginURL(), repoName, Cutoff{Ago: "1d"}, "^v.*", MatchOnTag, false, NewOptions())
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				manifestSummary, err := DanglingManifests(ctx, acrClient, registry.LoginURL(), repoName, NewOptions())
+				deletedTags[i], deletedManifests[i], errs[i] = tagSummary.Deleted, manifestSummary.Deleted, err
+				return
+			}
+			policy := Policy{Filters: []string{repoName + ":^v.*"}, Ago: "1d", Untagged: true}
+			plan, err := NewPlan(ctx, acrClient, FixedClock(now), registry.LoginURL(), policy, NewOptions())
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			deletedTags[i], deletedManifests[i], errs[i] = Execute(ctx, plan, nil, NewOptions())
+		}(i, repoName)
+	}
+	wg.Wait()
+	for i, repoName := range repoNames {
+		assert.Equal(nil, errs[i], "Error should be nil")
+		assert.Equal(stressTags, deletedTags[i], repoName)
+		assert.Equal(stressTags+stressUntagged, deletedManifests[i], repoName)
+		assert.Equal([]string{"latest"}, registry.Tags(repoName))
+		assert.Equal(1, len(registry.Manifests(repoName)))
+	}
+}
+
+// TestStressConcurrentSettings purges the repositories of a slow registry at the same time through the same workers,
+// every purge with its own options: a third of them stop at a maximum number of deletions that is different for each
+// repository, a third protect every tag with a minimum age and the others use the defaults. The settings of a purge
+// must not change what the others delete.
+func TestStressConcurrentSettings(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	registry := fakeacr.NewRegistry("user", "password")
+	defer registry.Close()
+	registry.SetPageSize(10)
+	now := time.Date(2020, time.January, 15, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-72 * time.Hour)
+	repoNames := []string{}
+	for i := 0; i < stressRepositories; i++ {
+		repoName := fmt.Sprintf("stress/repo%d", i)
+		repoNames = append(repoNames, repoName)
+		for j := 0; j < stressTags; j++ {
+			registry.PushImage(repoName, fmt.Sprintf("v%d", j), old)
+		}
+		registry.PushImage(repoName, "latest", now)
+	}
+	registry.SetLatency(stressLatency)
+
+	acrClient, err := api.GetAcrCLIClientWithAuth(registry.LoginURL(), "user", "password", nil)
+	assert.Equal(nil, err, "Error should be nil")
+	acrClient.AutorestClient.Sender = registry.HTTPClient()
+	StartDispatcher(ctx, acrClient, 8)
+	defer StopDispatcher()
+
+	deletedTags := make([]int, len(repoNames))
+	errs := make([]error, len(repoNames))
+	var wg sync.WaitGroup
+	for i, repoName := range repoNames {
+		wg.Add(1)
+		go func(i int, repoName string) {
+			defer wg.Done()
+			opts := NewOptions()
+			switch i % 3 {
+			case 0:
+				opts.SetMaxDeletes(i + 1)
+			case 1:
+				opts.SetMinAge(FixedClock(now), 100*time.Hour)
+			}
+			summary, err := Tags(ctx, acrClient, FixedClock(now), registry.LoginURL(), repoName, Cutoff{Ago: "1d"}, "^v.*", MatchOnTag, false, opts)
+			deletedTags[i], errs[i] = summary.Deleted, err
+		}(i, repoName)
+	}
+	wg.Wait()
+	for i, repoName := range repoNames {
+		switch i % 3 {
+		case 0:
+			assert.True(errors.Is(errs[i], ErrMaxDeletes), repoName)
+			assert.Equal(i+1, deletedTags[i], repoName)
+			assert.Equal(stressTags-i, len(registry.Tags(repoName)), repoName)
+		case 1:
+			assert.Equal(nil, errs[i], "Error should be nil")
+			assert.Equal(0, deletedTags[i], repoName)
+			assert.Equal(stressTags+1, len(registry.Tags(repoName)), repoName)
+		default:
+			assert.Equal(nil, errs[i], "Error should be nil")
+			assert.Equal(stressTags, deletedTags[i], repoName)
+			assert.Equal([]string{"latest"}, registry.Tags(repoName))
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// A tag is scheduled for deletion by attaching a tombstone to the manifest it references with the OCI referrers API.
+// The tombstone is an artifact of type TombstoneArtifactType whose annotations name the tag and the time it was
+// scheduled, it can be deleted to object to the deletion.
+const (
+	TombstoneArtifactType          = "application/vnd.acr-cli.tombstone.v1+json"
+	AnnotationScheduledForDeletion = "scheduled-for-deletion"
+	AnnotationTombstoneTag         = "org.opencontainers.image.ref.name"
+	ociManifestMediaType           = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// tombstoneConfig is the config of every tombstone, the tombstones carry no data besides their annotations.
+var tombstoneConfig = []byte("{}")
+
+// tombstoneConfigDigest is the digest of tombstoneConfig.
+var tombstoneConfigDigest = fmt.Sprintf("sha256:%x", sha256.Sum256(tombstoneConfig))
+
+// descriptor is an OCI content descriptor.
+type descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// tombstoneManifest is the manifest of a tombstone.
+type tombstoneManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType"`
+	Config        descriptor        `json:"config"`
+	Layers        []descriptor      `json:"layers"`
+	Subject       descriptor        `json:"subject"`
+	Annotations   map[string]string `json:"annotations"`
+}
+
+// tombstone is a tombstone attached to a manifest, scheduled is the time the tag was scheduled for deletion.
+type tombstone struct {
+	digest    string
+	scheduled time.Time
+}
+
+// isTombstone returns true if the manifest is a tombstone, tombstones have no tags but they are kept by the purge of
+// the untagged manifests until the tag they schedule is swept.
+func isTombstone(manifest acr.ManifestAttributesBase) bool {
+	return manifest.ConfigMediaType != nil && *manifest.ConfigMediaType == TombstoneArtifactType
+}
+
+// getTombstones returns the tombstones attached to a manifest by the name of the tag they schedule for deletion.
+func getTombstones(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, digest string) (map[string]tombstone, error) {
+	referrersBytes, err := acrClient.GetReferrers(ctx, repoName, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the tombstones of %s@%s: %w", repoName, digest, err)
+	}
+	var referrers struct {
+		Manifests []descriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(referrersBytes, &referrers); err != nil {
+		return nil, fmt.Errorf("failed to parse the referrers of %s@%s: %w", repoName, digest, err)
+	}
+	tombstones := map[string]tombstone{}
+	for _, referrer := range referrers.Manifests {
+		if referrer.ArtifactType != TombstoneArtifactType {
+			continue
+		}
+		scheduled, err := time.Parse(time.RFC3339, referrer.Annotations[AnnotationScheduledForDeletion])
+		if err != nil {
+			// A tombstone that cannot be read does not schedule anything.
+			continue
+		}
+		tag := referrer.Annotations[AnnotationTombstoneTag]
+		// If a tag was scheduled more than once the earliest tombstone counts.
+		if existing, ok := tombstones[tag]; !ok || scheduled.Before(existing.scheduled) {
+			tombstones[tag] = tombstone{digest: referrer.Digest, scheduled: scheduled}
+		}
+	}
+	return tombstones, nil
+}
+
+// pushTombstone attaches a tombstone that schedules the deletion of the tag at the given time to the manifest the tag
+// references.
+func pushTombstone(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string, tag acr.TagAttributesBase, scheduled time.Time) (string, error) {
+	subjectBytes, err := acrClient.GetManifest(ctx, repoName, *tag.Digest)
+	if err != nil {
+		return "", err
+	}
+	var subject struct {
+		MediaType string `json:"mediaType"`
+	}
+	if err := json.Unmarshal(subjectBytes, &subject); err != nil {
+		return "", fmt.Errorf("failed to parse %s@%s: %w", repoName, *tag.Digest, err)
+	}
+	if len(subject.MediaType) == 0 {
+		subject.MediaType = ociManifestMediaType
+	}
+	config := descriptor{MediaType: TombstoneArtifactType, Digest: tombstoneConfigDigest, Size: int64(len(tombstoneConfig))}
+	manifestBytes, err := json.Marshal(tombstoneManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  TombstoneArtifactType,
+		Config:        config,
+		Layers:        []descriptor{config},
+		Subject:       descriptor{MediaType: subject.MediaType, Digest: *tag.Digest, Size: int64(len(subjectBytes))},
+		Annotations: map[string]string{
+			AnnotationScheduledForDeletion: scheduled.UTC().Format(time.RFC3339),
+			AnnotationTombstoneTag:         *tag.Name,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	digest := api.ManifestDigest(manifestBytes)
+	if _, err := acrClient.PutManifest(ctx, repoName, digest, ociManifestMediaType, manifestBytes); err != nil {
+		return "", fmt.Errorf("failed to push the tombstone of %s:%s: %w", repoName, *tag.Name, err)
+	}
+	return digest, nil
+}
+
+// Mark schedules the deletion of the tags Tags would delete instead of deleting them, a tombstone annotated with the
+// current time is attached to every tag so that Sweep deletes it once the grace period is over. The tags that were
+// already scheduled keep their tombstone. The scheduled tags are counted as deleted in the summary.
+func Mark(ctx context.Context, acrClient api.AcrCLIClientInterface, clock Clock, loginURL string, repoName string, cutoff Cutoff, tagFilter string, matchOn string, onlySuperseded bool, opts *Options) (Summary, error) {
+	opts.printf("Scheduling the deletion of tags for repository: %s\n", repoName)
+	summary := Summary{}
+	pushedConfig := false
+	err := opts.forEachTagPage(ctx, acrClient, clock, repoName, cutoff, tagFilter, matchOn, onlySuperseded, &summary, func(tags []acr.TagAttributesBase) error {
+		for _, tag := range tags {
+			tombstones, err := getTombstones(ctx, acrClient, repoName, *tag.Digest)
+			if err != nil {
+				return err
+			}
+			if _, ok := tombstones[*tag.Name]; ok {
+				summary.Skipped++
+				continue
+			}
+			// The config is shared by all the tombstones of the repository, so it is only pushed once.
+			if !pushedConfig {
+				if err := acrClient.PutBlob(ctx, repoName, tombstoneConfigDigest, tombstoneConfig); err != nil {
+					return fmt.Errorf("failed to push the tombstone config to %s: %w", repoName, err)
+				}
+				pushedConfig = true
+			}
+			digest, err := pushTombstone(ctx, acrClient, repoName, tag, clock.Now())
+			if err != nil {
+				summary.Failed++
+				return err
+			}
+			summary.Deleted++
+			opts.printf("%s/%s:%s scheduled for deletion by %s\n", loginURL, repoName, *tag.Name, digest)
+		}
+		return nil
+	})
+	return summary, err
+}
+
+// Sweep deletes the tags Tags would delete that were scheduled for deletion by Mark before the grace cutoff, the
+// other tags are counted as skipped. The tombstone of every deleted tag is deleted too.
+func Sweep(ctx context.Context, acrClient api.AcrCLIClientInterface, clock Clock, loginURL string, repoName string, cutoff Cutoff, tagFilter string, matchOn string, onlySuperseded bool, grace Cutoff, opts *Options) (Summary, error) {
+	opts.printf("Deleting scheduled tags for repository: %s\n", repoName)
+	summary := Summary{}
+	graceTime, err := grace.Time(clock)
+	if err != nil {
+		return summary, err
+	}
+	err = opts.forEachTagPage(ctx, acrClient, clock, repoName, cutoff, tagFilter, matchOn, onlySuperseded, &summary, func(tags []acr.TagAttributesBase) error {
+		tagsToDelete := []acr.TagAttributesBase{}
+		tombstoneDigests := []string{}
+		for _, tag := range tags {
+			tombstones, err := getTombstones(ctx, acrClient, repoName, *tag.Digest)
+			if err != nil {
+				return err
+			}
+			// A tag that was not scheduled, was scheduled recently or whose tombstone was deleted is kept.
+			t, ok := tombstones[*tag.Name]
+			if !ok || t.scheduled.After(graceTime) {
+				summary.Skipped++
+				continue
+			}
+			tagsToDelete = append(tagsToDelete, tag)
+			tombstoneDigests = append(tombstoneDigests, t.digest)
+		}
+		if len(tagsToDelete) == 0 {
+			return nil
+		}
+		if opts.csvReport != nil {
+			opts.csvReport.expectTags(ctx, acrClient, repoName, tagsToDelete)
+		}
+		if err := opts.deleteTagsAndWait(loginURL, repoName, tagsToDelete, &summary); err != nil {
+			return err
+		}
+		for _, digest := range tombstoneDigests {
+			if resp, err := acrClient.DeleteManifest(ctx, repoName, digest); err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+				return fmt.Errorf("failed to delete the tombstone %s@%s: %w", repoName, digest, err)
+			}
+		}
+		return nil
+	})
+	return summary, err
+}
+
+// forEachTagPage calls fn with every page of the tags Tags would delete, the tags that are kept are counted as skipped
+// and the listed tags as scanned.
+func (o *Options) forEachTagPage(ctx context.Context, acrClient api.AcrCLIClientInterface, clock Clock, repoName string, cutoff Cutoff, tagFilter string, matchOn string, onlySuperseded bool, summary *Summary, fn func(tags []acr.TagAttributesBase) error) error {
+	timeToCompare, err := cutoff.Time(clock)
+	if err != nil {
+		return err
+	}
+	tagRegex, err := regexp.Compile(tagFilter)
+	if err != nil {
+		return err
+	}
+	var superseded *supersededTags
+	if onlySuperseded {
+		superseded, err = o.getSupersededTags(ctx, acrClient, repoName, tagRegex, matchOn)
+		if err != nil {
+			return err
+		}
+	}
+	keptByGroup, err := o.getKeptByGroup(ctx, acrClient, repoName, tagRegex, matchOn)
+	if err != nil {
+		return err
+	}
+	digests, err := o.artifactDigests(ctx, acrClient, repoName)
+	if err != nil {
+		return err
+	}
+	tagPager := newTagPager(acrClient, repoName, o.orderBy, tagRegex, matchOn)
+	for {
+		kept := []KeptTag{}
+		tags, err := o.getTagsToDelete(ctx, tagPager, tagRegex, matchOn, timeToCompare, superseded, nil, &kept)
+		summary.Scanned = tagPager.Listed()
+		summary.Skipped += len(kept)
+		if err != nil || tags == nil {
+			return err
+		}
+		filtered, err := o.onlyPushedBy(ctx, acrClient, repoName, withoutKeptByGroup(ofArtifactType(tags, digests), keptByGroup))
+		if err != nil {
+			return err
+		}
+		filtered, err = o.withoutExcludedLabels(ctx, acrClient, repoName, filtered)
+		if err != nil {
+			return err
+		}
+		filtered, err = o.withoutSigned(ctx, acrClient, repoName, o.withoutPinned(repoName, filtered))
+		if err != nil {
+			return err
+		}
+		filtered, err = o.withoutPresentInReference(ctx, repoName, filtered)
+		if err != nil {
+			return err
+		}
+		filtered = o.withoutOutsideCreatedWindows(repoName, filtered)
+		summary.Skipped += len(*tags) - len(*filtered)
+		if err := fn(*filtered); err != nil {
+			return err
+		}
+	}
+}
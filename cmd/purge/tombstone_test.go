@@ -0,0 +1,111 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// tombstoneReferrers returns the referrers of a manifest with a tombstone of the latest tag scheduled at the time.
+func tombstoneReferrers(scheduled time.Time) []byte {
+	return []byte(fmt.Sprintf(`{"manifests":[{"mediaType":%q,"artifactType":%q,"digest":"sha:tombstone","size":10,"annotations":{%q:%q,%q:%q}}]}`,
+		ociManifestMediaType, TombstoneArtifactType, AnnotationScheduledForDeletion, scheduled.Format(time.RFC3339), AnnotationTombstoneTag, tagName))
+}
+
+// TestTombstones contains the tests for the two-phase purge, the tags are scheduled for deletion by Mark and deleted
+// by Sweep once the grace period is over.
+func TestTombstones(t *testing.T) {
+	image := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+	// First test, a tombstone annotated with the time of the clock is attached to the manifest of the tag.
+	t.Run("MarkTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, digest).Return([]byte(`{"manifests":[]}`), nil).Once()
+		mockClient.On("PutBlob", testCtx, testRepo, tombstoneConfigDigest, tombstoneConfig).Return(nil).Once()
+		mockClient.On("GetManifest", testCtx, testRepo, digest).Return(image, nil).Once()
+		var pushed tombstoneManifest
+		mockClient.On("PutManifest", testCtx, testRepo, mock.Anything, ociManifestMediaType, mock.Anything).Run(func(args mock.Arguments) {
+			json.Unmarshal(args.Get(4).([]byte), &pushed)
+		}).Return(nil, nil).Once()
+		summary, err := Mark(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, NewOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(Summary{Scanned: 1, Deleted: 1}, summary)
+		assert.Equal(digest, pushed.Subject.Digest)
+		assert.Equal(int64(len(image)), pushed.Subject.Size)
+		assert.Equal(TombstoneArtifactType, pushed.Config.MediaType)
+		assert.Equal(testNow.Format(time.RFC3339), pushed.Annotations[AnnotationScheduledForDeletion])
+		assert.Equal(tagName, pushed.Annotations[AnnotationTombstoneTag])
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, a tag that was already scheduled keeps its tombstone.
+	t.Run("AlreadyMarkedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, digest).Return(tombstoneReferrers(testNow.Add(-time.Hour)), nil).Once()
+		summary, err := Mark(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, NewOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(Summary{Scanned: 1, Skipped: 1}, summary)
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, a tag scheduled before the grace period is deleted together with its tombstone.
+	t.Run("SweepTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		StartDispatcher(testCtx, mockClient, 6)
+		defer StopDispatcher()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, digest).Return(tombstoneReferrers(testNow.Add(-8*24*time.Hour)), nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, tagName).Return(&deletedResponse, nil).Once()
+		mockClient.On("DeleteManifest", testCtx, testRepo, "sha:tombstone").Return(&deletedResponse, nil).Once()
+		summary, err := Sweep(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, Cutoff{Ago: "7d"}, NewOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(Summary{Scanned: 1, Deleted: 1}, summary)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, a tag scheduled during the grace period is kept.
+	t.Run("SweepGracePeriodTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "latest").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetReferrers", testCtx, testRepo, digest).Return(tombstoneReferrers(testNow.Add(-24*time.Hour)), nil).Once()
+		summary, err := Sweep(testCtx, mockClient, testClock, testLoginURL, testRepo, Cutoff{Ago: "0m"}, "^la.*", MatchOnTag, false, Cutoff{Ago: "7d"}, NewOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(Summary{Scanned: 1, Skipped: 1}, summary)
+		mockClient.AssertExpectations(t)
+	})
+	// Fifth test, the tombstones are not deleted with the untagged manifests.
+	t.Run("UntaggedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		tombstoneType := TombstoneArtifactType
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(&acr.Manifests{
+			ManifestsAttributes: &[]acr.ManifestAttributesBase{{
+				LastUpdateTime:       &lastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+				Digest:               &digest1,
+				MediaType:            &dockerV2MediaType,
+				ConfigMediaType:      &tombstoneType,
+			}},
+		}, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", digest1).Return(EmptyListManifestsResult, nil).Once()
+		manifests, err := GetManifestsToDelete(testCtx, mockClient, testRepo, NewOptions())
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(*manifests))
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,213 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/worker"
+	"github.com/Azure/acr-cli/pkg/acrapi"
+)
+
+// The reasons why a deleted tag or manifest is still present.
+const (
+	ReasonPending  = "still listed, the registry may not have finished the deletion"
+	ReasonLocked   = "locked, it cannot be deleted"
+	ReasonRepushed = "pushed again after the deletion"
+	ReasonTagged   = "tagged again after the deletion"
+)
+
+// The registry can accept a deletion (e.g. with a 202) and finish it later, so the verification lists the
+// repositories up to verifyAttempts times, verifyInterval apart, until every deleted item is gone.
+var (
+	verifyAttempts = 3
+	verifyInterval = 5 * time.Second
+)
+
+// Verifier records the tags and manifests the purge deleted to check afterwards that they are gone.
+type Verifier struct {
+	mu sync.Mutex
+	// tags and manifests are the time every tag and manifest was deleted, by repository and tag or digest.
+	tags      map[string]map[string]time.Time
+	manifests map[string]map[string]time.Time
+	// deleted is the number of recorded deletions.
+	deleted int
+}
+
+// Remaining is a deleted tag or manifest that is still present, Tag is empty for a manifest.
+type Remaining struct {
+	RepoName string `json:"repository"`
+	Tag      string `json:"tag,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// NewVerifier creates a verifier without deletions.
+func NewVerifier() *Verifier {
+	return &Verifier{tags: map[string]map[string]time.Time{}, manifests: map[string]map[string]time.Time{}}
+}
+
+// EnableVerify makes the run record the tags and manifests it deletes to the verifier, nil disables it.
+func (o *Options) EnableVerify(v *Verifier) {
+	o.verifier = v
+}
+
+// Deleted returns the number of deletions that were recorded.
+func (v *Verifier) Deleted() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.deleted
+}
+
+// handleResult records a successful deletion, it is called by the workers. The items that were not found were
+// already gone and the ones that failed are reported by the purge itself.
+func (v *Verifier) handleResult(result worker.Result) {
+	if result.Err != nil || result.Skipped {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	items, key := v.manifests, result.Digest
+	if len(result.Tag) > 0 {
+		items, key = v.tags, result.Tag
+	}
+	if _, ok := items[result.RepoName]; !ok {
+		items[result.RepoName] = map[string]time.Time{}
+	}
+	items[result.RepoName][key] = time.Now().UTC()
+	v.deleted++
+}
+
+// Verify lists the repositories with deletions and returns the deleted tags and manifests that are still present
+// with the reason, sorted by repository. The repositories are listed again while items remain, up to verifyAttempts
+// times, because the registry can finish the deletions after it accepted them. The attempts are reported to out.
+func (v *Verifier) Verify(ctx context.Context, acrClient api.AcrCLIClientInterface, out io.Writer) ([]Remaining, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	repoNames := map[string]bool{}
+	for repoName := range v.tags {
+		repoNames[repoName] = true
+	}
+	for repoName := range v.manifests {
+		repoNames[repoName] = true
+	}
+	sortedRepoNames := []string{}
+	for repoName := range repoNames {
+		sortedRepoNames = append(sortedRepoNames, repoName)
+	}
+	sort.Strings(sortedRepoNames)
+	remaining := []Remaining{}
+	for attempt := 1; attempt <= verifyAttempts; attempt++ {
+		remaining = []Remaining{}
+		for _, repoName := range sortedRepoNames {
+			repoRemaining, err := v.verifyRepository(ctx, acrClient, repoName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to verify the deletions of %s: %w", repoName, err)
+			}
+			remaining = append(remaining, repoRemaining...)
+		}
+		if len(remaining) == 0 || attempt == verifyAttempts || !pendingOnly(remaining) {
+			break
+		}
+		fmt.Fprintf(out, "%d deleted tags or manifests are still listed, verifying again in %s\n", len(remaining), verifyInterval)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(verifyInterval):
+		}
+	}
+	return remaining, nil
+}
+
+// pendingOnly returns true if all the remaining items may still be deleted by the registry, the locked or pushed
+// again ones will not change by waiting.
+func pendingOnly(remaining []Remaining) bool {
+	for _, item := range remaining {
+		if item.Reason != ReasonPending {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyRepository returns the deleted tags and manifests of a repository that are still present.
+func (v *Verifier) verifyRepository(ctx context.Context, acrClient api.AcrCLIClientInterface, repoName string) ([]Remaining, error) {
+	remaining := []Remaining{}
+	if deletedTags := v.tags[repoName]; len(deletedTags) > 0 {
+		tags := acrapi.NewTagIterator(acrClient, repoName, "")
+		for tags.Next(ctx) {
+			tag := tags.Tag()
+			deletedAt, ok := deletedTags[*tag.Name]
+			if !ok {
+				continue
+			}
+			remaining = append(remaining, Remaining{RepoName: repoName, Tag: *tag.Name, Digest: stringValue(tag.Digest),
+				Reason: remainingReason(tag.ChangeableAttributes, tag.LastUpdateTime, deletedAt, nil)})
+		}
+		// A repository that is not found is gone together with its tags.
+		if tags.Err() != nil && !tags.NotFound() {
+			return nil, tags.Err()
+		}
+	}
+	deletedManifests := v.manifests[repoName]
+	if len(deletedManifests) == 0 {
+		return remaining, nil
+	}
+	found := map[string]bool{}
+	manifests := acrapi.NewManifestIterator(acrClient, repoName, "")
+	for manifests.Next(ctx) {
+		manifest := manifests.Manifest()
+		deletedAt, ok := deletedManifests[stringValue(manifest.Digest)]
+		if !ok || found[*manifest.Digest] {
+			continue
+		}
+		found[*manifest.Digest] = true
+		remaining = append(remaining, Remaining{RepoName: repoName, Digest: *manifest.Digest,
+			Reason: remainingReason(manifest.ChangeableAttributes, manifest.LastUpdateTime, deletedAt, manifest.Tags)})
+	}
+	if manifests.Err() != nil && !manifests.NotFound() {
+		// Registries that cannot list the manifests (e.g. OCI registries) are asked for every deleted manifest.
+		return append(remaining, fetchRemainingManifests(ctx, acrClient, repoName, deletedManifests)...), nil
+	}
+	return remaining, nil
+}
+
+// fetchRemainingManifests returns the deleted manifests that can still be fetched.
+func fetchRemainingManifests(ctx context.Context, acrClient api.ManifestFetcher, repoName string, deletedManifests map[string]time.Time) []Remaining {
+	digests := []string{}
+	for digest := range deletedManifests {
+		digests = append(digests, digest)
+	}
+	sort.Strings(digests)
+	remaining := []Remaining{}
+	for _, digest := range digests {
+		if _, err := acrClient.GetManifest(ctx, repoName, digest); err == nil {
+			remaining = append(remaining, Remaining{RepoName: repoName, Digest: digest, Reason: ReasonPending})
+		}
+	}
+	return remaining
+}
+
+// remainingReason explains why a deleted tag or manifest is still present from its attributes.
+func remainingReason(attributes *acr.ChangeableAttributes, lastUpdateTime *string, deletedAt time.Time, tags *[]string) string {
+	if attributes != nil && attributes.DeleteEnabled != nil && !*attributes.DeleteEnabled {
+		return ReasonLocked
+	}
+	if lastUpdateTime != nil {
+		if updated, err := time.Parse(time.RFC3339Nano, *lastUpdateTime); err == nil && updated.After(deletedAt) {
+			return ReasonRepushed
+		}
+	}
+	if tags != nil && len(*tags) > 0 {
+		return ReasonTagged
+	}
+	return ReasonPending
+}
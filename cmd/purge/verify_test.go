@@ -0,0 +1,72 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/cmd/worker"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestVerifier contains the tests for the verification of the deleted tags and manifests.
+func TestVerifier(t *testing.T) {
+	defer func(attempts int, interval time.Duration) {
+		verifyAttempts, verifyInterval = attempts, interval
+	}(verifyAttempts, verifyInterval)
+	verifyAttempts, verifyInterval = 2, 0
+	// First test, the deleted tags and manifests are not listed anymore, the failed and skipped ones are not checked.
+	t.Run("GoneTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		v := NewVerifier()
+		v.handleResult(worker.Result{RepoName: testRepo, Tag: tagName})
+		v.handleResult(worker.Result{RepoName: testRepo, Digest: digest1})
+		v.handleResult(worker.Result{RepoName: testRepo, Digest: digest2, Skipped: true})
+		v.handleResult(worker.Result{RepoName: "failed", Tag: tagName, Err: errors.New("unauthorized")})
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(EmptyListManifestsResult, nil).Once()
+		remaining, err := v.Verify(testCtx, mockClient, ioutil.Discard)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(0, len(remaining))
+		assert.Equal(2, v.Deleted())
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, a tag that is still listed is checked again before it is reported as pending.
+	t.Run("PendingTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		v := NewVerifier()
+		v.handleResult(worker.Result{RepoName: testRepo, Tag: tagName})
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(OneTagResult, nil).Twice()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", tagName).Return(EmptyListTagsResult, nil).Twice()
+		remaining, err := v.Verify(testCtx, mockClient, ioutil.Discard)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]Remaining{{RepoName: testRepo, Tag: tagName, Digest: digest, Reason: ReasonPending}}, remaining)
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, a locked tag and a manifest that was tagged again are reported right away.
+	t.Run("LockedTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		v := NewVerifier()
+		v.handleResult(worker.Result{RepoName: testRepo, Tag: tagName})
+		v.handleResult(worker.Result{RepoName: testRepo, Digest: digest})
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(DeleteDisabledOneTagResult, nil).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", tagName).Return(EmptyListTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", "").Return(singleManifestV2WithTagsResult, nil).Once()
+		mockClient.On("GetAcrManifests", testCtx, testRepo, "", digest).Return(EmptyListManifestsResult, nil).Once()
+		remaining, err := v.Verify(testCtx, mockClient, ioutil.Discard)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]Remaining{
+			{RepoName: testRepo, Tag: tagName, Digest: digest, Reason: ReasonLocked},
+			{RepoName: testRepo, Digest: digest, Reason: ReasonTagged},
+		}, remaining)
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,334 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+)
+
+// What the time of a time window is compared with.
+const (
+	// WindowOnPurge compares the time the purge runs, e.g. to never purge a repository during business hours.
+	WindowOnPurge = "purge"
+	// WindowOnCreated compares the time the tags were created, e.g. to only purge the tags created on weekends.
+	WindowOnCreated = "created"
+)
+
+// The modes of a time window.
+const (
+	// WindowModeInclude only purges inside the window.
+	WindowModeInclude = "include"
+	// WindowModeExclude never purges inside the window.
+	WindowModeExclude = "exclude"
+)
+
+// TimeWindow is a schedule-like constraint of a policy. Every window applies to the repositories that match one of
+// its regular expressions (all of them if there are none) and is made of days of the week and a range of hours of
+// the timezone of the purge. A time passes the include windows of a repository if it is inside one of them and its
+// exclude windows if it is inside none of them.
+type TimeWindow struct {
+	Repositories []string `json:"repositories,omitempty"`
+	// On is purge (the default) or created.
+	On string `json:"on,omitempty"`
+	// Mode is include or exclude.
+	Mode string `json:"mode"`
+	// Days are the days of the week, e.g. monday or mon, or weekdays and weekend. Every day if it is empty.
+	Days []string `json:"days,omitempty"`
+	// Hours is a range like 09:00-17:00, the end is excluded and a range like 22:00-06:00 spans midnight. The whole
+	// day if it is empty.
+	Hours string `json:"hours,omitempty"`
+}
+
+// ErrWindowClosed is returned by Execute when the time windows of a repository stop allowing a purge while the plan is
+// executed, the rest of the plan is not deleted.
+var ErrWindowClosed = errors.New("the time windows closed")
+
+// timeWindow is a parsed TimeWindow, the hours are minutes since midnight.
+type timeWindow struct {
+	repositories []*regexp.Regexp
+	on           string
+	include      bool
+	days         map[time.Weekday]bool
+	start, end   int
+	allDay       bool
+}
+
+// timeWindows are the parsed windows of a purge and the location their days and hours are in.
+type timeWindows struct {
+	windows  []timeWindow
+	location *time.Location
+}
+
+// SetTimeWindows restricts the run to the time windows, their days and hours are in the timezone (an IANA name
+// like Europe/Paris, UTC if it is empty). Nil windows remove the restriction.
+func (o *Options) SetTimeWindows(windows []TimeWindow, timezone string) error {
+	parsed, err := parseTimeWindows(windows, timezone)
+	if err != nil {
+		return err
+	}
+	o.windows = parsed
+	return nil
+}
+
+// CheckTimeWindows returns an error if the windows or the timezone are not valid.
+func CheckTimeWindows(windows []TimeWindow, timezone string) error {
+	_, err := parseTimeWindows(windows, timezone)
+	return err
+}
+
+// ReadTimeWindows reads a list of time windows from a YAML (or JSON) file.
+func ReadTimeWindows(path string) ([]TimeWindow, error) {
+	var windows []TimeWindow
+	if err := readYAML(path, &windows); err != nil {
+		return nil, fmt.Errorf("failed to read time windows %s: %w", path, err)
+	}
+	return windows, nil
+}
+
+// parseTimeWindows parses the windows, nil is returned if there are none.
+func parseTimeWindows(windows []TimeWindow, timezone string) (*timeWindows, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	if len(windows) == 0 {
+		return nil, nil
+	}
+	parsed := &timeWindows{location: location}
+	for i, window := range windows {
+		w, err := parseTimeWindow(window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time window %d: %w", i+1, err)
+		}
+		parsed.windows = append(parsed.windows, w)
+	}
+	return parsed, nil
+}
+
+// parseTimeWindow parses a single window.
+func parseTimeWindow(window TimeWindow) (timeWindow, error) {
+	w := timeWindow{on: window.On, allDay: len(window.Hours) == 0}
+	switch w.on {
+	case "":
+		w.on = WindowOnPurge
+	case WindowOnPurge, WindowOnCreated:
+	default:
+		return w, fmt.Errorf("invalid on value %q, supported values are %q and %q", window.On, WindowOnPurge, WindowOnCreated)
+	}
+	switch window.Mode {
+	case WindowModeInclude:
+		w.include = true
+	case WindowModeExclude:
+	default:
+		return w, fmt.Errorf("invalid mode %q, supported values are %q and %q", window.Mode, WindowModeInclude, WindowModeExclude)
+	}
+	for _, repository := range window.Repositories {
+		// The expressions match the whole name, like the ones of the placeholders.
+		regex, err := regexp.Compile("^(?:" + repository + ")$")
+		if err != nil {
+			return w, fmt.Errorf("invalid repository %q: %w", repository, err)
+		}
+		w.repositories = append(w.repositories, regex)
+	}
+	if len(window.Days) > 0 {
+		w.days = map[time.Weekday]bool{}
+		for _, day := range window.Days {
+			days, err := parseWeekdays(day)
+			if err != nil {
+				return w, err
+			}
+			for _, d := range days {
+				w.days[d] = true
+			}
+		}
+	}
+	if !w.allDay {
+		bounds := strings.Split(window.Hours, "-")
+		if len(bounds) != 2 {
+			return w, fmt.Errorf("invalid hours %q, expected a range like 09:00-17:00", window.Hours)
+		}
+		var err error
+		if w.start, err = parseClock(bounds[0]); err != nil {
+			return w, fmt.Errorf("invalid hours %q: %w", window.Hours, err)
+		}
+		if w.end, err = parseClock(bounds[1]); err != nil {
+			return w, fmt.Errorf("invalid hours %q: %w", window.Hours, err)
+		}
+		if w.start == w.end {
+			return w, fmt.Errorf("invalid hours %q, the range is empty", window.Hours)
+		}
+	}
+	return w, nil
+}
+
+// parseWeekdays parses a day of the week by its English name or its first three letters, weekdays and weekend are
+// the days from Monday to Friday and Saturday and Sunday.
+func parseWeekdays(day string) ([]time.Weekday, error) {
+	name := strings.ToLower(strings.TrimSpace(day))
+	switch name {
+	case "weekdays":
+		return []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, nil
+	case "weekend":
+		return []time.Weekday{time.Saturday, time.Sunday}, nil
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		full := strings.ToLower(d.String())
+		if name == full || (len(name) == 3 && strings.HasPrefix(full, name)) {
+			return []time.Weekday{d}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid day %q", day)
+}
+
+// parseClock parses a time of the day like 09:30 into minutes since midnight, 24:00 is the end of the day.
+func parseClock(value string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("%q is not a time like 09:30", value)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time like 09:30", value)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes > 0) {
+		return 0, fmt.Errorf("%q is not a time like 09:30", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// appliesTo returns true if the window applies to the repository.
+func (w timeWindow) appliesTo(repoName string) bool {
+	if len(w.repositories) == 0 {
+		return true
+	}
+	for _, regex := range w.repositories {
+		if regex.MatchString(repoName) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns true if the time, in the location of the windows, is inside the window. The days of a range that
+// spans midnight are the days it starts on.
+func (w timeWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if !w.allDay && w.end < w.start && minute < w.end {
+		// The early hours belong to the range that started the day before.
+		day = (day + 6) % 7
+	}
+	if w.days != nil && !w.days[day] {
+		return false
+	}
+	switch {
+	case w.allDay:
+		return true
+	case w.start < w.end:
+		return minute >= w.start && minute < w.end
+	default:
+		return minute >= w.start || minute < w.end
+	}
+}
+
+// allows returns true if the time passes the windows of the repository that are compared with on.
+func (s *timeWindows) allows(repoName string, on string, t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	t = t.In(s.location)
+	included, hasInclude := false, false
+	for _, w := range s.windows {
+		if w.on != on || !w.appliesTo(repoName) {
+			continue
+		}
+		inside := w.contains(t)
+		if !w.include && inside {
+			return false
+		}
+		if w.include {
+			hasInclude = true
+			included = included || inside
+		}
+	}
+	return !hasInclude || included
+}
+
+// WithoutClosedRepositories removes the repositories whose windows do not allow a purge at the time now from the
+// filters of GetTagFilters, a message is written to out for every skipped repository.
+func (o *Options) WithoutClosedRepositories(tagFilters map[string]string, now time.Time, out io.Writer) map[string]string {
+	windows := o.windows
+	if windows == nil {
+		return tagFilters
+	}
+	result := map[string]string{}
+	for repoName, tagFilter := range tagFilters {
+		if !windows.allows(repoName, WindowOnPurge, now) {
+			fmt.Fprintf(out, "Skipping repository %s, its time windows do not allow a purge at %s\n", repoName, now.In(windows.location).Format("Mon 15:04 MST"))
+			continue
+		}
+		result[repoName] = tagFilter
+	}
+	return result
+}
+
+// checkExecution returns the error of the context if it is cancelled and ErrWindowClosed if the windows do not allow
+// a purge of the repository at the time of the clock of the run anymore.
+func (o *Options) checkExecution(ctx context.Context, windows *timeWindows, repoName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if now := o.clock.Now(); !windows.allows(repoName, WindowOnPurge, now) {
+		return fmt.Errorf("%w: the time windows of %s do not allow a purge at %s", ErrWindowClosed, repoName, now.In(windows.location).Format("Mon 15:04 MST"))
+	}
+	return nil
+}
+
+// inCreatedWindows returns true if the creation time of the tag, or its last update time if the registry does not
+// return it, passes the windows of the repository.
+func (o *Options) inCreatedWindows(repoName string, tag acr.TagAttributesBase) bool {
+	windows := o.windows
+	if windows == nil {
+		return true
+	}
+	value := tag.CreatedTime
+	if value == nil {
+		value = tag.LastUpdateTime
+	}
+	if value == nil {
+		return true
+	}
+	created, err := time.Parse(time.RFC3339Nano, *value)
+	if err != nil {
+		return true
+	}
+	return windows.allows(repoName, WindowOnCreated, created)
+}
+
+// withoutOutsideCreatedWindows removes the tags created outside the windows of the repository, like the pages of tags
+// a nil slice stays nil.
+func (o *Options) withoutOutsideCreatedWindows(repoName string, tags *[]acr.TagAttributesBase) *[]acr.TagAttributesBase {
+	if tags == nil || o.windows == nil {
+		return tags
+	}
+	filtered := []acr.TagAttributesBase{}
+	for _, tag := range *tags {
+		if !o.inCreatedWindows(repoName, tag) {
+			o.printf("Keeping %s:%s, it was created outside the time windows of the repository\n", repoName, *tag.Name)
+			continue
+		}
+		filtered = append(filtered, tag)
+	}
+	return &filtered
+}
@@ -0,0 +1,155 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package purge
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseTimeWindows contains the tests for the validation of the time windows.
+func TestParseTimeWindows(t *testing.T) {
+	// First test, no windows and a valid timezone result in no restriction.
+	t.Run("NoWindowsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		windows, err := parseTimeWindows(nil, "Europe/Paris")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Nil(windows)
+	})
+	// Second test, invalid values return an error.
+	t.Run("InvalidTest", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.NotEqual(nil, CheckTimeWindows(nil, "Mars/Olympus"), "Error should not be nil")
+		assert.NotEqual(nil, CheckTimeWindows([]TimeWindow{{Mode: "sometimes"}}, ""), "Error should not be nil")
+		assert.NotEqual(nil, CheckTimeWindows([]TimeWindow{{Mode: WindowModeExclude, On: "deleted"}}, ""), "Error should not be nil")
+		assert.NotEqual(nil, CheckTimeWindows([]TimeWindow{{Mode: WindowModeExclude, Days: []string{"funday"}}}, ""), "Error should not be nil")
+		assert.NotEqual(nil, CheckTimeWindows([]TimeWindow{{Mode: WindowModeExclude, Hours: "09:00"}}, ""), "Error should not be nil")
+		assert.NotEqual(nil, CheckTimeWindows([]TimeWindow{{Mode: WindowModeExclude, Hours: "09:00-25:00"}}, ""), "Error should not be nil")
+		assert.NotEqual(nil, CheckTimeWindows([]TimeWindow{{Mode: WindowModeExclude, Hours: "09:00-09:00"}}, ""), "Error should not be nil")
+		assert.NotEqual(nil, CheckTimeWindows([]TimeWindow{{Mode: WindowModeExclude, Repositories: []string{"("}}}, ""), "Error should not be nil")
+	})
+	// Third test, the windows are read from a YAML file.
+	t.Run("ReadTest", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "windows")
+		assert.Equal(nil, err, "Error should be nil")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "windows.yaml")
+		content := "- repositories: [\"prod/.*\"]\n  mode: exclude\n  days: [weekdays]\n  hours: 09:00-17:00\n"
+		assert.Equal(nil, ioutil.WriteFile(path, []byte(content), 0600), "Error should be nil")
+		windows, err := ReadTimeWindows(path)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal([]TimeWindow{{Repositories: []string{"prod/.*"}, Mode: WindowModeExclude, Days: []string{"weekdays"}, Hours: "09:00-17:00"}}, windows)
+	})
+}
+
+// TestTimeWindowsAllow contains the tests for the times that pass the windows.
+func TestTimeWindowsAllow(t *testing.T) {
+	// Monday 2021-03-01 10:00 UTC is 11:00 in Paris.
+	monday := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	// First test, an exclude window of business hours only applies to the matching repositories on weekdays.
+	t.Run("BusinessHoursTest", func(t *testing.T) {
+		assert := assert.New(t)
+		windows, err := parseTimeWindows([]TimeWindow{{Repositories: []string{"prod/.*"}, Mode: WindowModeExclude, Days: []string{"weekdays"}, Hours: "09:00-17:00"}}, "")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.False(windows.allows("prod/app", WindowOnPurge, monday))
+		assert.True(windows.allows("dev/app", WindowOnPurge, monday))
+		assert.True(windows.allows("prod/app", WindowOnPurge, monday.Add(8*time.Hour)))
+		assert.True(windows.allows("prod/app", WindowOnPurge, monday.AddDate(0, 0, 5)))
+		// The created windows are not compared with the purge time.
+		assert.True(windows.allows("prod/app", WindowOnCreated, monday))
+	})
+	// Second test, the days and hours are in the timezone of the windows.
+	t.Run("TimezoneTest", func(t *testing.T) {
+		assert := assert.New(t)
+		windows, err := parseTimeWindows([]TimeWindow{{Mode: WindowModeInclude, Hours: "11:00-12:00"}}, "Europe/Paris")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.True(windows.allows("app", WindowOnPurge, monday))
+		windows, err = parseTimeWindows([]TimeWindow{{Mode: WindowModeInclude, Hours: "11:00-12:00"}}, "")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.False(windows.allows("app", WindowOnPurge, monday))
+	})
+	// Third test, a range that spans midnight belongs to the day it starts on.
+	t.Run("OvernightTest", func(t *testing.T) {
+		assert := assert.New(t)
+		windows, err := parseTimeWindows([]TimeWindow{{Mode: WindowModeInclude, Days: []string{"fri"}, Hours: "22:00-06:00"}}, "")
+		assert.Equal(nil, err, "Error should be nil")
+		friday := time.Date(2021, 3, 5, 23, 0, 0, 0, time.UTC)
+		assert.True(windows.allows("app", WindowOnPurge, friday))
+		assert.True(windows.allows("app", WindowOnPurge, friday.Add(4*time.Hour)))
+		assert.False(windows.allows("app", WindowOnPurge, friday.Add(8*time.Hour)))
+		assert.False(windows.allows("app", WindowOnPurge, friday.AddDate(0, 0, -1).Add(4*time.Hour)))
+	})
+}
+
+// TestWithoutClosedRepositories contains the tests for the repositories skipped because of their windows.
+func TestWithoutClosedRepositories(t *testing.T) {
+	tagFilters := map[string]string{"prod/app": ".*", "dev/app": ".*"}
+	monday := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	// First test, without windows every repository is kept.
+	t.Run("NoWindowsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		var out bytes.Buffer
+		assert.Equal(tagFilters, opts.WithoutClosedRepositories(tagFilters, monday, &out))
+		assert.Equal("", out.String())
+	})
+	// Second test, the repositories excluded at the time of the purge are skipped with a message.
+	t.Run("ExcludeTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		err := opts.SetTimeWindows([]TimeWindow{{Repositories: []string{"prod/.*"}, Mode: WindowModeExclude, Days: []string{"weekdays"}, Hours: "09:00-17:00"}}, "")
+		assert.Equal(nil, err, "Error should be nil")
+		var out bytes.Buffer
+		assert.Equal(map[string]string{"dev/app": ".*"}, opts.WithoutClosedRepositories(tagFilters, monday, &out))
+		assert.Contains(out.String(), "Skipping repository prod/app, its time windows do not allow a purge at Mon 10:00 UTC")
+	})
+}
+
+// TestWithoutOutsideCreatedWindows contains the tests for the tags kept because of the time they were created.
+func TestWithoutOutsideCreatedWindows(t *testing.T) {
+	name := func(value string) *string { return &value }
+	// 2021-03-06 is a Saturday and 2021-03-08 a Monday.
+	tags := []acr.TagAttributesBase{
+		{Name: name("weekend"), CreatedTime: name("2021-03-06T10:00:00Z"), LastUpdateTime: name("2021-03-08T10:00:00Z")},
+		{Name: name("monday"), CreatedTime: name("2021-03-08T10:00:00Z")},
+		{Name: name("updated"), LastUpdateTime: name("2021-03-07T10:00:00Z")},
+	}
+	// First test, without windows the tags are returned as they are.
+	t.Run("NoWindowsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		assert.Equal(&tags, opts.withoutOutsideCreatedWindows("app", &tags))
+		assert.Nil(opts.withoutOutsideCreatedWindows("app", nil))
+	})
+	// Second test, only the tags created on weekends are kept for deletion, the last update time is the fallback.
+	t.Run("WeekendTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		err := opts.SetTimeWindows([]TimeWindow{{On: WindowOnCreated, Mode: WindowModeInclude, Days: []string{"weekend"}}}, "")
+		assert.Equal(nil, err, "Error should be nil")
+		filtered := opts.withoutOutsideCreatedWindows("app", &tags)
+		assert.Equal(2, len(*filtered))
+		assert.Equal("weekend", *(*filtered)[0].Name)
+		assert.Equal("updated", *(*filtered)[1].Name)
+	})
+	// Third test, the windows of a policy are set on a copy of the options, the options it was copied from keep
+	// their own.
+	t.Run("CopyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := NewOptions()
+		planOpts := *opts
+		err := planOpts.SetTimeWindows([]TimeWindow{{On: WindowOnCreated, Mode: WindowModeInclude, Days: []string{"weekend"}}}, "")
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(2, len(*planOpts.withoutOutsideCreatedWindows("app", &tags)))
+		assert.Equal(&tags, opts.withoutOutsideCreatedWindows("app", &tags))
+	})
+}
@@ -0,0 +1,397 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package server exposes the purge planner and executor through an HTTP API. A purge is submitted as a job that
+// is first planned, the plan can then be reviewed and has to be approved before anything is deleted.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/purge"
+)
+
+// The statuses a job goes through, a job that fails while planning or executing ends in StatusFailed.
+const (
+	StatusPlanning  = "planning"
+	StatusPlanned   = "planned"
+	StatusExecuting = "executing"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// DefaultPlanTTL is the time a plan can be approved for unless specified otherwise, the older plans have to be
+// submitted again because the registry may have changed too much since they were planned.
+const DefaultPlanTTL = time.Hour
+
+// Job is a purge request submitted to the server.
+type Job struct {
+	ID                string       `json:"id"`
+	Status            string       `json:"status"`
+	Policy            purge.Policy `json:"policy"`
+	TagsToDelete      int          `json:"tagsToDelete"`
+	ManifestsToDelete int          `json:"manifestsToDelete"`
+	DeletedTags       int          `json:"deletedTags"`
+	DeletedManifests  int          `json:"deletedManifests"`
+	Error             string       `json:"error,omitempty"`
+	CreatedTime       string       `json:"createdTime"`
+	PlannedTime       string       `json:"plannedTime,omitempty"`
+	FinishedTime      string       `json:"finishedTime,omitempty"`
+	plan              *purge.Plan
+	plannedTime       time.Time
+	finishedTime      time.Time
+}
+
+// finish ends the job with the error, or as completed if it is nil. The lock of the server has to be held.
+func (job *Job) finish(err error) {
+	job.Status = StatusCompleted
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	}
+	job.finishedTime = time.Now().UTC()
+	job.FinishedTime = job.finishedTime.Format(time.RFC3339Nano)
+}
+
+// expired returns true if the job finished, or was planned and not approved, longer than ttl before now.
+func (job *Job) expired(now time.Time, ttl time.Duration) bool {
+	switch job.Status {
+	case StatusCompleted, StatusFailed:
+		return now.Sub(job.finishedTime) > ttl
+	case StatusPlanned:
+		return now.Sub(job.plannedTime) > ttl
+	}
+	return false
+}
+
+// Server keeps the submitted jobs in memory and runs them against a single registry. The jobs that finished, or whose
+// plan can no longer be approved, are evicted once they are older than the plan TTL so that the memory of a server
+// that runs for a long time stays bounded.
+type Server struct {
+	ctx       context.Context
+	acrClient api.AcrCLIClientInterface
+	loginURL  string
+	token     string
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	nextID    int
+	planTTL   time.Duration
+	// running keeps track of the jobs that are being planned or executed in the background.
+	running sync.WaitGroup
+}
+
+// New creates a server for the registry the acrClient points to, purge.StartDispatcher has to be called before
+// any job is approved. Every request has to send the token as a bearer token, the requests without it are rejected
+// with a 401, the token cannot be empty because the server deletes from the registry with its own credentials.
+// The jobs are planned and executed with ctx, cancelling it stops them after the block being deleted.
+func New(ctx context.Context, acrClient api.AcrCLIClientInterface, loginURL string, token string) (*Server, error) {
+	if len(token) == 0 {
+		return nil, errors.New("the server requires a token")
+	}
+	return &Server{
+		ctx:       ctx,
+		acrClient: acrClient,
+		loginURL:  loginURL,
+		token:     token,
+		jobs:      map[string]*Job{},
+		planTTL:   DefaultPlanTTL,
+	}, nil
+}
+
+// SetPlanTTL sets the time a plan can be approved for, a plan approved later is rejected with a 409. It is also the
+// time the finished jobs are kept for.
+func (s *Server) SetPlanTTL(ttl time.Duration) {
+	s.planTTL = ttl
+}
+
+// Wait waits until the jobs being planned or executed in the background end, the context of the server has to be
+// cancelled first for the jobs to stop early.
+func (s *Server) Wait() {
+	s.running.Wait()
+}
+
+// evictJobs removes the expired jobs. The lock of the server has to be held.
+func (s *Server) evictJobs(now time.Time) {
+	for id, job := range s.jobs {
+		if job.expired(now, s.planTTL) {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// newJobOptions returns the options of a purge of the server, they have the defaults of the purge command so that
+// the images updated in the last hour are never deleted and the tags that leave their digest reachable through
+// other tags are reported. Every purge gets its own so that jobs do not share their settings.
+func newJobOptions() *purge.Options {
+	opts := purge.NewOptions()
+	opts.SetMinAge(purge.SystemClock(), purge.DefaultMinAge)
+	opts.SetAliasDetection(true, false)
+	return opts
+}
+
+// ServeHTTP routes the requests of the API:
+//
+//	POST /jobs                submits a policy and starts planning it
+//	GET  /jobs                lists all the jobs
+//	GET  /jobs/{id}           returns a job, it can be polled to watch the progress
+//	GET  /jobs/{id}/plan      returns the tags and manifests a planned job would delete
+//	POST /jobs/{id}/approve   starts deleting what the plan contains
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "jobs" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("path %s not found", r.URL.Path))
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		s.submitJob(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.listJobs(w)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		s.getJob(w, parts[1])
+	case len(parts) == 3 && parts[2] == "plan" && r.Method == http.MethodGet:
+		s.getPlan(w, parts[1])
+	case len(parts) == 3 && parts[2] == "approve" && r.Method == http.MethodPost:
+		s.approveJob(w, parts[1])
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s %s is not supported", r.Method, r.URL.Path))
+	}
+}
+
+// authorized returns true if the request sends the token of the server as a bearer token, the tokens are compared in
+// constant time so that the response time does not tell how much of a guess is right.
+func (s *Server) authorized(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// unsupportedPolicyError returns an error if the policy uses a field the server cannot apply: it has no credentials
+// for another registry and it does not read the files of its host for its clients.
+func unsupportedPolicyError(policy purge.Policy) error {
+	unsupported := []string{}
+	if len(policy.KeepIfPresentIn) > 0 {
+		unsupported = append(unsupported, "keepIfPresentIn")
+	}
+	if len(policy.KeepPinned) > 0 {
+		unsupported = append(unsupported, "keepPinned")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("the server does not support %s in a policy", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// submitJob creates a job from the policy in the request body and plans it in the background.
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request) {
+	var policy purge.Policy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid policy: %w", err))
+		return
+	}
+	if len(policy.Filters) == 0 || (len(policy.Ago) == 0 && len(policy.Before) == 0) {
+		writeError(w, http.StatusBadRequest, errors.New("the policy requires at least one filter and an ago or before value"))
+		return
+	}
+	if err := unsupportedPolicyError(policy); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(policy.MatchOn) == 0 {
+		policy.MatchOn = purge.MatchOnTag
+	}
+	// The filters are validated before accepting the job so that malformed policies are reported right away.
+	if _, err := newJobOptions().GetTagFilters(policy.Filters, policy.MatchOn); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := purge.CheckTimeWindows(policy.Windows, policy.Timezone); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	cutoff := purge.Cutoff{Ago: policy.Ago, Before: policy.Before}
+	if _, err := cutoff.Time(purge.SystemClock()); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid cutoff: %w", err))
+		return
+	}
+	if len(policy.UntaggedAgo) > 0 {
+		if _, err := (purge.Cutoff{Ago: policy.UntaggedAgo}).Time(purge.SystemClock()); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid untagged ago: %w", err))
+			return
+		}
+	}
+	s.mu.Lock()
+	s.evictJobs(time.Now())
+	s.nextID++
+	job := &Job{
+		ID:          strconv.Itoa(s.nextID),
+		Status:      StatusPlanning,
+		Policy:      policy,
+		CreatedTime: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	s.jobs[job.ID] = job
+	response := *job
+	s.mu.Unlock()
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		plan, err := purge.NewPlan(s.ctx, s.acrClient, purge.SystemClock(), s.loginURL, policy, newJobOptions())
+		plannedTime := time.Now().UTC()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err != nil {
+			job.finish(err)
+			return
+		}
+		job.plan = plan
+		job.plannedTime = plannedTime
+		job.PlannedTime = plannedTime.Format(time.RFC3339Nano)
+		job.TagsToDelete = plan.TagCount()
+		job.ManifestsToDelete = plan.ManifestCount()
+		job.Status = StatusPlanned
+	}()
+	writeJSON(w, http.StatusAccepted, response)
+}
+
+// listJobs returns all the jobs sorted by the order they were submitted.
+func (s *Server) listJobs(w http.ResponseWriter) {
+	s.mu.Lock()
+	jobs := []Job{}
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	s.mu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool {
+		iID, _ := strconv.Atoi(jobs[i].ID)
+		jID, _ := strconv.Atoi(jobs[j].ID)
+		return iID < jID
+	})
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// getJob returns the current state of a job.
+func (s *Server) getJob(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	var response Job
+	if ok {
+		response = *job
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getPlan returns the plan of a job once the planning finished.
+func (s *Server) getPlan(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	var plan *purge.Plan
+	if ok {
+		plan = job.plan
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+		return
+	}
+	if plan == nil {
+		writeError(w, http.StatusConflict, fmt.Errorf("job %s does not have a plan", id))
+		return
+	}
+	// Once created a plan is never modified so it can be encoded without holding the lock.
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// approveJob starts executing a planned job in the background. The registry may have changed since the job was
+// planned, so the policy is planned again and only the candidates of the approved plan that are still candidates with
+// the same digest and last update time are deleted, and the plans older than the TTL of the server are rejected.
+func (s *Server) approveJob(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	job, ok := s.jobs[id]
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+		return
+	}
+	if job.Status != StatusPlanned {
+		status := job.Status
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, fmt.Errorf("job %s cannot be approved, its status is %s", id, status))
+		return
+	}
+	if age := time.Since(job.plannedTime); age > s.planTTL {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, fmt.Errorf("the plan of job %s was created %s ago, plans older than %s have to be submitted again", id, age.Round(time.Second), s.planTTL))
+		return
+	}
+	job.Status = StatusExecuting
+	approved := job.plan
+	policy := job.Policy
+	response := *job
+	s.mu.Unlock()
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		opts := newJobOptions()
+		current, err := purge.NewPlan(s.ctx, s.acrClient, purge.SystemClock(), s.loginURL, policy, opts)
+		if err != nil {
+			s.mu.Lock()
+			job.finish(err)
+			s.mu.Unlock()
+			return
+		}
+		// The digests are checked again right before every deletion in case a tag is moved while the job executes.
+		opts.SetVerifyDigest(true)
+		// The approved jobs are executed at the same time, they share the workers but every job waits for its own
+		// deletions.
+		deletedTags, deletedManifests, err := purge.Execute(s.ctx, purge.ApprovedPlan(approved, current), func(deletedTags int, deletedManifests int) {
+			s.mu.Lock()
+			job.DeletedTags = deletedTags
+			job.DeletedManifests = deletedManifests
+			s.mu.Unlock()
+		}, opts)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		job.DeletedTags = deletedTags
+		job.DeletedManifests = deletedManifests
+		job.finish(err)
+	}()
+	writeJSON(w, http.StatusAccepted, response)
+}
+
+// writeJSON writes the value as the JSON body of the response.
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError writes the error as a JSON object with a single error field.
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	writeJSON(w, statusCode, map[string]string{"error": err.Error()})
+}
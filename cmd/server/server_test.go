@@ -0,0 +1,285 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/acr-cli/cmd/purge"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestServer contains the tests for the job lifecycle of the HTTP API.
+func TestServer(t *testing.T) {
+	// First test, a job is planned, approved and executed, the plan contains the single old tag of the repository.
+	t.Run("PlanAndApproveTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		// The tags are listed to plan the job and again when it is approved, the tags of the digest are listed to find
+		// its other tags every time too.
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(oneTagResult, nil).Times(4)
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", tagName).Return(&acr.RepositoryTagsType{}, nil).Times(4)
+		mockClient.On("HeadManifest", workerCtx, testRepo, tagName).Return(digest, nil).Once()
+		mockClient.On("DeleteAcrTag", workerCtx, testRepo, tagName).Return(&deletedResponse, nil).Once()
+		purge.StartDispatcher(testCtx, mockClient, 2)
+		defer purge.StopDispatcher()
+		s, _ := New(testCtx, mockClient, testLoginURL, testToken)
+
+		recorder := doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "0m"}`)
+		assert.Equal(http.StatusAccepted, recorder.Code)
+		var job Job
+		assert.Equal(nil, json.Unmarshal(recorder.Body.Bytes(), &job), "Error should be nil")
+		assert.Equal("1", job.ID)
+		assert.Equal(StatusPlanning, job.Status)
+		s.running.Wait()
+
+		recorder = doRequest(s, http.MethodGet, "/jobs/1", "")
+		assert.Equal(nil, json.Unmarshal(recorder.Body.Bytes(), &job), "Error should be nil")
+		assert.Equal(StatusPlanned, job.Status)
+		assert.NotEqual("", job.PlannedTime)
+		assert.Equal(1, job.TagsToDelete)
+		assert.Equal(0, job.ManifestsToDelete)
+
+		recorder = doRequest(s, http.MethodGet, "/jobs/1/plan", "")
+		assert.Equal(http.StatusOK, recorder.Code)
+		var plan purge.Plan
+		assert.Equal(nil, json.Unmarshal(recorder.Body.Bytes(), &plan), "Error should be nil")
+		assert.Equal(1, len(plan.Repositories))
+		assert.Equal(tagName, *plan.Repositories[0].Tags[0].Name)
+
+		recorder = doRequest(s, http.MethodPost, "/jobs/1/approve", "")
+		assert.Equal(http.StatusAccepted, recorder.Code)
+		s.running.Wait()
+		recorder = doRequest(s, http.MethodGet, "/jobs/1", "")
+		assert.Equal(nil, json.Unmarshal(recorder.Body.Bytes(), &job), "Error should be nil")
+		assert.Equal(StatusCompleted, job.Status)
+		assert.Equal(1, job.DeletedTags)
+
+		// A job can only be approved once.
+		recorder = doRequest(s, http.MethodPost, "/jobs/1/approve", "")
+		assert.Equal(http.StatusConflict, recorder.Code)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, if the registry returns an error while planning the job fails and it cannot be approved.
+	t.Run("PlanErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(nil, errors.New("error fetching tags")).Once()
+		s, _ := New(testCtx, mockClient, testLoginURL, testToken)
+		doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "0m"}`)
+		s.running.Wait()
+		recorder := doRequest(s, http.MethodGet, "/jobs", "")
+		var jobs []Job
+		assert.Equal(nil, json.Unmarshal(recorder.Body.Bytes(), &jobs), "Error should be nil")
+		assert.Equal(1, len(jobs))
+		assert.Equal(StatusFailed, jobs[0].Status)
+		assert.NotEqual("", jobs[0].Error)
+		assert.Equal(http.StatusConflict, doRequest(s, http.MethodGet, "/jobs/1/plan", "").Code)
+		assert.Equal(http.StatusConflict, doRequest(s, http.MethodPost, "/jobs/1/approve", "").Code)
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, invalid policies and unknown jobs or paths are rejected without calling the registry.
+	t.Run("InvalidRequestsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		s, _ := New(testCtx, mockClient, testLoginURL, testToken)
+		assert.Equal(http.StatusBadRequest, doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"]}`).Code)
+		assert.Equal(http.StatusBadRequest, doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar"], "ago": "1d"}`).Code)
+		assert.Equal(http.StatusBadRequest, doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "1p"}`).Code)
+		assert.Equal(http.StatusBadRequest, doRequest(s, http.MethodPost, "/jobs", `not json`).Code)
+		// The server cannot reach another registry and does not read its own files for the clients.
+		assert.Equal(http.StatusBadRequest, doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "1d", "keepIfPresentIn": "prod"}`).Code)
+		assert.Equal(http.StatusBadRequest, doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "1d", "keepPinned": "/etc/pins.lock"}`).Code)
+		assert.Equal(http.StatusNotFound, doRequest(s, http.MethodGet, "/jobs/7", "").Code)
+		assert.Equal(http.StatusNotFound, doRequest(s, http.MethodPost, "/jobs/7/approve", "").Code)
+		assert.Equal(http.StatusNotFound, doRequest(s, http.MethodGet, "/tags", "").Code)
+		assert.Equal(http.StatusMethodNotAllowed, doRequest(s, http.MethodDelete, "/jobs/7", "").Code)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, a server cannot be created without a token and the requests without the right token are rejected.
+	t.Run("TokenTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		s, err := New(testCtx, mockClient, testLoginURL, "")
+		assert.Equal((*Server)(nil), s)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		s, err = New(testCtx, mockClient, testLoginURL, testToken)
+		assert.Equal(nil, err, "Error should be nil")
+		for _, header := range []string{"", "Bearer", "Bearer wrong", "Basic " + testToken, testToken} {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(`{"filters": ["bar:.*"], "ago": "0m"}`))
+			if len(header) > 0 {
+				request.Header.Set("Authorization", header)
+			}
+			s.ServeHTTP(recorder, request)
+			assert.Equal(http.StatusUnauthorized, recorder.Code)
+			assert.Equal("Bearer", recorder.Header().Get("WWW-Authenticate"))
+		}
+		assert.Equal(0, len(s.jobs))
+		assert.Equal(http.StatusOK, doRequest(s, http.MethodGet, "/jobs", "").Code)
+		mockClient.AssertExpectations(t)
+	})
+	// Fifth test, the tags updated in the last hour are not planned even if the policy selects them, like with the
+	// default min age of the purge command.
+	t.Run("MinAgeTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(recentTagResult, nil)
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", tagName).Return(&acr.RepositoryTagsType{}, nil)
+		s, _ := New(testCtx, mockClient, testLoginURL, testToken)
+		doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "0m"}`)
+		s.running.Wait()
+		var job Job
+		assert.Equal(nil, json.Unmarshal(doRequest(s, http.MethodGet, "/jobs/1", "").Body.Bytes(), &job), "Error should be nil")
+		assert.Equal(StatusPlanned, job.Status)
+		assert.Equal(0, job.TagsToDelete)
+	})
+	// Sixth test, a tag that references another digest when the job is approved is not deleted.
+	t.Run("MovedTagTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(oneTagResult, nil).Twice()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(movedTagResult, nil).Twice()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", tagName).Return(&acr.RepositoryTagsType{}, nil)
+		purge.StartDispatcher(testCtx, mockClient, 2)
+		defer purge.StopDispatcher()
+		s, _ := New(testCtx, mockClient, testLoginURL, testToken)
+		doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "0m"}`)
+		s.running.Wait()
+		assert.Equal(http.StatusAccepted, doRequest(s, http.MethodPost, "/jobs/1/approve", "").Code)
+		s.running.Wait()
+		var job Job
+		assert.Equal(nil, json.Unmarshal(doRequest(s, http.MethodGet, "/jobs/1", "").Body.Bytes(), &job), "Error should be nil")
+		assert.Equal(StatusCompleted, job.Status)
+		assert.Equal(1, job.TagsToDelete)
+		assert.Equal(0, job.DeletedTags)
+		mockClient.AssertNotCalled(t, "DeleteAcrTag", workerCtx, testRepo, tagName)
+	})
+	// Seventh test, a plan older than the TTL of the server cannot be approved and nothing is deleted.
+	t.Run("ExpiredPlanTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(oneTagResult, nil).Twice()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", tagName).Return(&acr.RepositoryTagsType{}, nil).Twice()
+		s, _ := New(testCtx, mockClient, testLoginURL, testToken)
+		s.SetPlanTTL(time.Nanosecond)
+		doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "0m"}`)
+		s.running.Wait()
+		time.Sleep(time.Millisecond)
+		assert.Equal(http.StatusConflict, doRequest(s, http.MethodPost, "/jobs/1/approve", "").Code)
+		var job Job
+		assert.Equal(nil, json.Unmarshal(doRequest(s, http.MethodGet, "/jobs/1", "").Body.Bytes(), &job), "Error should be nil")
+		assert.Equal(StatusPlanned, job.Status)
+		mockClient.AssertExpectations(t)
+	})
+	// Eighth test, the failed jobs and the plans that can no longer be approved are evicted once they are older than
+	// the TTL of the server.
+	t.Run("EvictionTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(nil, errors.New("error fetching tags")).Once()
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", "").Return(oneTagResult, nil)
+		mockClient.On("GetAcrTags", testCtx, testRepo, "", tagName).Return(&acr.RepositoryTagsType{}, nil)
+		s, _ := New(testCtx, mockClient, testLoginURL, testToken)
+		doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "0m"}`)
+		s.running.Wait()
+		doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "0m"}`)
+		s.running.Wait()
+		var job Job
+		assert.Equal(nil, json.Unmarshal(doRequest(s, http.MethodGet, "/jobs/1", "").Body.Bytes(), &job), "Error should be nil")
+		assert.Equal(StatusFailed, job.Status)
+		assert.NotEqual("", job.FinishedTime)
+		s.SetPlanTTL(time.Nanosecond)
+		time.Sleep(time.Millisecond)
+		doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "0m"}`)
+		s.running.Wait()
+		assert.Equal(http.StatusNotFound, doRequest(s, http.MethodGet, "/jobs/1", "").Code)
+		assert.Equal(http.StatusNotFound, doRequest(s, http.MethodGet, "/jobs/2", "").Code)
+		assert.Equal(http.StatusOK, doRequest(s, http.MethodGet, "/jobs/3", "").Code)
+	})
+	// Ninth test, once the context of the server is cancelled an approved job fails without deleting anything and
+	// Wait returns.
+	t.Run("ShutdownTest", func(t *testing.T) {
+		assert := assert.New(t)
+		ctx, cancel := context.WithCancel(testCtx)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "", "").Return(oneTagResult, nil)
+		mockClient.On("GetAcrTags", mock.Anything, testRepo, "", tagName).Return(&acr.RepositoryTagsType{}, nil)
+		purge.StartDispatcher(testCtx, mockClient, 2)
+		defer purge.StopDispatcher()
+		s, _ := New(ctx, mockClient, testLoginURL, testToken)
+		doRequest(s, http.MethodPost, "/jobs", `{"filters": ["bar:.*"], "ago": "0m"}`)
+		s.running.Wait()
+		cancel()
+		assert.Equal(http.StatusAccepted, doRequest(s, http.MethodPost, "/jobs/1/approve", "").Code)
+		s.Wait()
+		var job Job
+		assert.Equal(nil, json.Unmarshal(doRequest(s, http.MethodGet, "/jobs/1", "").Body.Bytes(), &job), "Error should be nil")
+		assert.Equal(StatusFailed, job.Status)
+		assert.Equal(0, job.DeletedTags)
+		mockClient.AssertNotCalled(t, "DeleteAcrTag", workerCtx, testRepo, tagName)
+	})
+}
+
+// doRequest sends a request to the server and returns the recorded response.
+func doRequest(s *Server, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+testToken)
+	s.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// tagResult returns a listing of the single tag of the test repository with the specified last update time and digest.
+func tagResult(lastUpdateTime *string, digest *string) *acr.RepositoryTagsType {
+	return &acr.RepositoryTagsType{
+		Registry:  &testLoginURL,
+		ImageName: &testRepo,
+		TagsAttributes: &[]acr.TagAttributesBase{
+			{
+				Name:                 &tagName,
+				LastUpdateTime:       lastUpdateTime,
+				ChangeableAttributes: &acr.ChangeableAttributes{DeleteEnabled: &deleteEnabled},
+				Digest:               digest,
+			},
+		},
+	}
+}
+
+// All the variables used in the tests are defined here.
+var (
+	testCtx        = context.Background()
+	testLoginURL   = "foo.azurecr.io"
+	testToken      = "secret"
+	testRepo       = "bar"
+	tagName        = "latest"
+	digest         = "sha:abc"
+	deleteEnabled  = true
+	movedDigest    = "sha:def"
+	lastUpdateTime = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339Nano)
+	recentTime     = time.Now().Add(-15 * time.Minute).UTC().Format(time.RFC3339Nano)
+	oneTagResult   = tagResult(&lastUpdateTime, &digest)
+	// recentTagResult contains the tag updated less than the minimum age ago.
+	recentTagResult = tagResult(&recentTime, &digest)
+	// movedTagResult contains the tag after it was pushed again with another digest.
+	movedTagResult  = tagResult(&lastUpdateTime, &movedDigest)
+	deletedResponse = autorest.Response{
+		Response: &http.Response{
+			StatusCode: 200,
+		},
+	}
+	// workerCtx matches the context the workers derive from testCtx to count the retries of every deletion.
+	workerCtx = mock.Anything
+)
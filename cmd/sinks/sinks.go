@@ -0,0 +1,113 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package sinks opens the destination of a report of a command: the standard output, a local file or an Azure Storage
+// blob, so that a command running in a container without a persistent volume can still keep its reports.
+package sinks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// Stdout is the target of the standard output.
+	Stdout = "-"
+	// TimestampPlaceholder is replaced in a target by the time the report is opened, so that every run of a scheduled
+	// command writes a different report.
+	TimestampPlaceholder = "{timestamp}"
+	// timestampFormat is the format of the time that replaces the timestamp placeholder.
+	timestampFormat = "20060102T150405Z"
+	// blobAPIVersion is the version of the Azure Storage API used to upload the blobs.
+	blobAPIVersion = "2019-12-12"
+)
+
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// now returns the time of the timestamp placeholder, it is replaced by the tests.
+var now = time.Now
+
+// Open returns the writer of a target, either - for stdout, the URL of an Azure Storage blob with a shared access
+// signature that allows writing it (https://<account>.blob.core.windows.net/<container>/<blob>?<sas>) or the path of a
+// local file. The report is only complete once Close returns without an error, a blob is uploaded by Close with the
+// content type.
+func Open(target string, contentType string, stdout io.Writer) (io.WriteCloser, error) {
+	target = strings.Replace(target, TimestampPlaceholder, now().UTC().Format(timestampFormat), -1)
+	if target == Stdout {
+		return nopCloser{stdout}, nil
+	}
+	if strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "http://") {
+		blobURL, err := url.Parse(target)
+		if err != nil || len(strings.Trim(blobURL.Path, "/")) == 0 {
+			return nil, errors.New("invalid report target, expected the URL of an Azure Storage blob")
+		}
+		if len(blobURL.Query().Get("sig")) == 0 {
+			return nil, errors.New("invalid report target, the URL of an Azure Storage blob must contain a shared access signature")
+		}
+		return &blobWriter{url: blobURL.String(), contentType: contentType}, nil
+	}
+	file, err := os.Create(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the report: %w", err)
+	}
+	return file, nil
+}
+
+// nopCloser writes to the standard output, which is not closed.
+type nopCloser struct {
+	io.Writer
+}
+
+// Close does nothing.
+func (nopCloser) Close() error {
+	return nil
+}
+
+// blobWriter keeps the report in memory and uploads it as a block blob when it is closed, the reports are small
+// enough to be uploaded with a single request.
+type blobWriter struct {
+	url         string
+	contentType string
+	buffer      bytes.Buffer
+}
+
+// Write adds the bytes to the report.
+func (w *blobWriter) Write(p []byte) (int, error) {
+	return w.buffer.Write(p)
+}
+
+// Close uploads the report, replacing the blob if it exists.
+func (w *blobWriter) Close() error {
+	req, err := http.NewRequest(http.MethodPut, w.url, bytes.NewReader(w.buffer.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-version", blobAPIVersion)
+	if len(w.contentType) > 0 {
+		req.Header.Set("x-ms-blob-content-type", w.contentType)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// The error of the request contains its URL, which must not be logged with its shared access signature.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to upload the report: %w", err)
+	}
+	defer resp.Body.Close()
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to upload the report, the Storage account answered with status %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package sinks
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOpen contains the tests for the targets of the reports.
+func TestOpen(t *testing.T) {
+	defer func() { now = time.Now }()
+	now = func() time.Time { return time.Date(2020, time.January, 15, 12, 30, 0, 0, time.UTC) }
+	// write writes the report to the writer and closes it.
+	write := func(w io.WriteCloser, report string) error {
+		if _, err := w.Write([]byte(report)); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+	// First test, - writes to stdout.
+	t.Run("StdoutTest", func(t *testing.T) {
+		assert := assert.New(t)
+		stdout := &bytes.Buffer{}
+		w, err := Open(Stdout, "application/json", stdout)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(nil, write(w, "{}"))
+		assert.Equal("{}", stdout.String())
+	})
+	// Second test, a path is a local file and the timestamp placeholder is replaced.
+	t.Run("FileTest", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "sinks")
+		assert.Equal(nil, err, "Error should be nil")
+		defer os.RemoveAll(dir)
+		w, err := Open(filepath.Join(dir, "report-"+TimestampPlaceholder+".json"), "application/json", nil)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(nil, write(w, "{}"))
+		content, err := ioutil.ReadFile(filepath.Join(dir, "report-20200115T123000Z.json"))
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("{}", string(content))
+	})
+	// Third test, the URL of a blob is uploaded as a block blob when the writer is closed.
+	t.Run("BlobTest", func(t *testing.T) {
+		assert := assert.New(t)
+		var method, path, blobType, contentType, body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, path = r.Method, r.URL.Path
+			blobType, contentType = r.Header.Get("x-ms-blob-type"), r.Header.Get("x-ms-blob-content-type")
+			bodyBytes, _ := ioutil.ReadAll(r.Body)
+			body = string(bodyBytes)
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer server.Close()
+		w, err := Open(server.URL+"/reports/purge-"+TimestampPlaceholder+".csv?sv=2019-12-12&sig=token", "text/csv", nil)
+		assert.Equal(nil, err, "Error should be nil")
+		_, err = w.Write([]byte("repository,tag\n"))
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal("", path, "The blob should only be uploaded when it is closed")
+		assert.Equal(nil, w.Close())
+		assert.Equal(http.MethodPut, method)
+		assert.Equal("/reports/purge-20200115T123000Z.csv", path)
+		assert.Equal("BlockBlob", blobType)
+		assert.Equal("text/csv", contentType)
+		assert.Equal("repository,tag\n", body)
+	})
+	// Fourth test, a blob that cannot be uploaded returns an error without the shared access signature.
+	t.Run("BlobErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("AuthorizationFailure"))
+		}))
+		w, err := Open(server.URL+"/reports/purge.json?sig=secret", "application/json", nil)
+		assert.Equal(nil, err, "Error should be nil")
+		err = w.Close()
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.Contains(err.Error(), "AuthorizationFailure")
+		server.Close()
+		err = w.Close()
+		assert.NotEqual(nil, err, "Error should not be nil")
+		assert.NotContains(err.Error(), "secret")
+	})
+	// Fifth test, the URL of a blob without a shared access signature is rejected.
+	t.Run("InvalidBlobTest", func(t *testing.T) {
+		assert := assert.New(t)
+		_, err := Open("https://account.blob.core.windows.net/reports/purge.json", "application/json", nil)
+		assert.NotEqual(nil, err, "Error should not be nil")
+		_, err = Open("https://account.blob.core.windows.net/?sig=token", "application/json", nil)
+		assert.NotEqual(nil, err, "Error should not be nil")
+	})
+}
@@ -0,0 +1,270 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package telemetry sends anonymous usage metrics of the commands to Application Insights so that the maintainers
+// can understand how the acr-cli is used. Nothing is sent unless the user opts in with acr telemetry enable, the
+// --telemetry flag or the ACR_TELEMETRY environment variable. The events only contain the command, the names of the
+// flags that were set, the duration, counts and the class of the error, never registry, repository or tag names.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// EnvVar enables (true) or disables (false) the telemetry, it takes precedence over the saved setting.
+const EnvVar = "ACR_TELEMETRY"
+
+// KeyEnvVar overrides the instrumentation key the events are sent with, e.g. to send them to a resource of a fork.
+const KeyEnvVar = "ACR_TELEMETRY_KEY"
+
+// DefaultEndpoint is the Application Insights ingestion endpoint the events are sent to.
+const DefaultEndpoint = "https://dc.services.visualstudio.com/v2/track"
+
+// InstrumentationKey is the key of the Application Insights resource of the maintainers. Filled in at linking time,
+// nothing is sent without a key.
+var InstrumentationKey = ""
+
+// timeout bounds the time a command waits for its event to be sent, the telemetry must never slow down a purge.
+const timeout = 3 * time.Second
+
+// newHTTPClient returns the client the events are sent with, it shares the transport of the registry clients so that
+// the proxy, the CA certificate and the TLS settings of the flags apply to the telemetry too.
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: api.HTTPClient().Transport, Timeout: timeout}
+}
+
+// settingsFile is the file the opt-in is saved to, empty means the default file in the user config directory.
+var settingsFile = ""
+
+// SetSettingsFile changes the file the opt-in is saved to, an empty path restores the default one.
+func SetSettingsFile(path string) {
+	settingsFile = path
+}
+
+// SettingsFile returns the file the opt-in is saved to, acr-cli/telemetry.json in the user config directory.
+func SettingsFile() (string, error) {
+	if len(settingsFile) > 0 {
+		return settingsFile, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the user config directory: %w", err)
+	}
+	return filepath.Join(dir, "acr-cli", "telemetry.json"), nil
+}
+
+// Settings is the saved opt-in. ID is a random identifier of the installation, it is only used to count the users.
+type Settings struct {
+	Enabled bool   `json:"enabled"`
+	ID      string `json:"id,omitempty"`
+}
+
+// Load reads the saved settings, the zero value is returned if they were never saved.
+func Load() (Settings, error) {
+	settings := Settings{}
+	path, err := SettingsFile()
+	if err != nil {
+		return settings, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return settings, fmt.Errorf("failed to read the telemetry settings: %w", err)
+	}
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return settings, fmt.Errorf("failed to parse the telemetry settings %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Save writes the settings, a random ID is generated the first time the telemetry is enabled.
+func Save(settings Settings) (Settings, error) {
+	if settings.Enabled && len(settings.ID) == 0 {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return settings, fmt.Errorf("failed to generate the telemetry id: %w", err)
+		}
+		settings.ID = hex.EncodeToString(id)
+	}
+	path, err := SettingsFile()
+	if err != nil {
+		return settings, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return settings, fmt.Errorf("failed to create the telemetry settings directory: %w", err)
+	}
+	content, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return settings, err
+	}
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		return settings, fmt.Errorf("failed to save the telemetry settings: %w", err)
+	}
+	return settings, nil
+}
+
+// Sources of the decision returned by Enabled.
+const (
+	SourceFlag     = "--telemetry flag"
+	SourceEnv      = EnvVar + " environment variable"
+	SourceSettings = "acr telemetry enable"
+	SourceDefault  = "default"
+)
+
+// Enabled tells whether the events are sent and why. The environment variable takes precedence so that telemetry can
+// be turned off on a machine regardless of the saved setting, then the --telemetry flag and the saved setting.
+func Enabled(flag bool, settings Settings) (bool, string, error) {
+	if value, ok := os.LookupEnv(EnvVar); ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, SourceEnv, fmt.Errorf("invalid %s value: %w", EnvVar, err)
+		}
+		return enabled, SourceEnv, nil
+	}
+	if flag {
+		return true, SourceFlag, nil
+	}
+	if settings.Enabled {
+		return true, SourceSettings, nil
+	}
+	return false, SourceDefault, nil
+}
+
+// Key returns the instrumentation key the events are sent with.
+func Key() string {
+	if key, ok := os.LookupEnv(KeyEnvVar); ok {
+		return key
+	}
+	return InstrumentationKey
+}
+
+// Event is the usage of a command. Only the names of the flags are reported, not their values.
+type Event struct {
+	// Command is the path of the command without the root, e.g. purge or tag list.
+	Command  string
+	Flags    []string
+	Duration time.Duration
+	// ErrorClass is empty if the command succeeded, otherwise a class like auth or throttled, never the message.
+	ErrorClass string
+	Counts     map[string]int
+	Version    string
+	Platform   string
+}
+
+var (
+	countsMu sync.Mutex
+	counts   = map[string]int{}
+)
+
+// Count adds n to a count of the running command, e.g. the number of deleted tags, it is sent with its event.
+func Count(name string, n int) {
+	countsMu.Lock()
+	defer countsMu.Unlock()
+	counts[name] += n
+}
+
+// Counts returns the counts of the running command and resets them.
+func Counts() map[string]int {
+	countsMu.Lock()
+	defer countsMu.Unlock()
+	current := counts
+	counts = map[string]int{}
+	return current
+}
+
+// envelope is the Application Insights representation of a custom event.
+type envelope struct {
+	Name string            `json:"name"`
+	Time string            `json:"time"`
+	IKey string            `json:"iKey"`
+	Tags map[string]string `json:"tags"`
+	Data envelopeData      `json:"data"`
+}
+
+type envelopeData struct {
+	BaseType string    `json:"baseType"`
+	BaseData eventData `json:"baseData"`
+}
+
+type eventData struct {
+	Ver          int                `json:"ver"`
+	Name         string             `json:"name"`
+	Properties   map[string]string  `json:"properties"`
+	Measurements map[string]float64 `json:"measurements"`
+}
+
+// Send sends an event to the endpoint (DefaultEndpoint if it is empty) with the key, id identifies the installation.
+// It is sent once, a lost event is not worth delaying the command.
+func Send(ctx context.Context, endpoint string, key string, id string, event Event) error {
+	if len(key) == 0 {
+		return errors.New("no instrumentation key")
+	}
+	if len(endpoint) == 0 {
+		endpoint = DefaultEndpoint
+	}
+	properties := map[string]string{
+		"command":  event.Command,
+		"flags":    strings.Join(event.Flags, ","),
+		"version":  event.Version,
+		"platform": event.Platform,
+		"result":   "success",
+	}
+	if len(event.ErrorClass) > 0 {
+		properties["result"] = "failure"
+		properties["errorClass"] = event.ErrorClass
+	}
+	measurements := map[string]float64{"durationMs": float64(event.Duration.Milliseconds())}
+	for name, count := range event.Counts {
+		measurements[name] = float64(count)
+	}
+	body, err := json.Marshal([]envelope{{
+		Name: "Microsoft.ApplicationInsights." + strings.ReplaceAll(key, "-", "") + ".Event",
+		Time: time.Now().UTC().Format(time.RFC3339Nano),
+		IKey: key,
+		Tags: map[string]string{
+			"ai.user.id":             id,
+			"ai.internal.sdkVersion": "acr-cli:" + event.Version,
+		},
+		Data: envelopeData{
+			BaseType: "EventData",
+			BaseData: eventData{Ver: 2, Name: "command", Properties: properties, Measurements: measurements},
+		},
+	}})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := newHTTPClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to send the telemetry: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to send the telemetry: unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTelemetry contains the tests for the opt-in and the events sent to Application Insights.
+func TestTelemetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telemetry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetSettingsFile("")
+	SetSettingsFile(filepath.Join(dir, "acr-cli", "telemetry.json"))
+	defer func(value string, ok bool) {
+		if ok {
+			os.Setenv(EnvVar, value)
+		}
+	}(os.LookupEnv(EnvVar))
+	os.Unsetenv(EnvVar)
+	// First test, the telemetry is disabled until it is enabled, the id is generated once and kept when it is
+	// disabled.
+	t.Run("SettingsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		settings, err := Load()
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(Settings{}, settings)
+		enabled, source, _ := Enabled(false, settings)
+		assert.False(enabled)
+		assert.Equal(SourceDefault, source)
+		settings, err = Save(Settings{Enabled: true})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Len(settings.ID, 32)
+		loaded, _ := Load()
+		assert.Equal(settings, loaded)
+		enabled, source, _ = Enabled(false, loaded)
+		assert.True(enabled)
+		assert.Equal(SourceSettings, source)
+		loaded.Enabled = false
+		disabled, err := Save(loaded)
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Equal(settings.ID, disabled.ID)
+	})
+	// Second test, the environment variable takes precedence over the flag and the saved setting.
+	t.Run("EnvTest", func(t *testing.T) {
+		assert := assert.New(t)
+		defer os.Unsetenv(EnvVar)
+		os.Setenv(EnvVar, "false")
+		enabled, source, err := Enabled(true, Settings{Enabled: true})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.False(enabled)
+		assert.Equal(SourceEnv, source)
+		os.Setenv(EnvVar, "1")
+		enabled, _, _ = Enabled(false, Settings{})
+		assert.True(enabled)
+		os.Setenv(EnvVar, "sometimes")
+		_, _, err = Enabled(false, Settings{})
+		assert.NotEqual(nil, err, "Error should not be nil")
+		os.Unsetenv(EnvVar)
+		enabled, source, _ = Enabled(true, Settings{})
+		assert.True(enabled)
+		assert.Equal(SourceFlag, source)
+	})
+	// Third test, the event is sent as an Application Insights custom event with the counts as measurements.
+	t.Run("SendTest", func(t *testing.T) {
+		assert := assert.New(t)
+		var received []envelope
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewDecoder(r.Body).Decode(&received)
+		}))
+		defer server.Close()
+		err := Send(context.Background(), server.URL, "0000-1111", "id", Event{
+			Command:    "purge",
+			Flags:      []string{"ago", "filter"},
+			Duration:   1500 * time.Millisecond,
+			ErrorClass: "throttled",
+			Counts:     map[string]int{"deletedTags": 3},
+			Version:    "1.0.0",
+		})
+		assert.Equal(nil, err, "Error should be nil")
+		assert.Len(received, 1)
+		assert.Equal("Microsoft.ApplicationInsights.00001111.Event", received[0].Name)
+		assert.Equal("0000-1111", received[0].IKey)
+		assert.Equal("id", received[0].Tags["ai.user.id"])
+		data := received[0].Data.BaseData
+		assert.Equal("command", data.Name)
+		assert.Equal("purge", data.Properties["command"])
+		assert.Equal("ago,filter", data.Properties["flags"])
+		assert.Equal("failure", data.Properties["result"])
+		assert.Equal("throttled", data.Properties["errorClass"])
+		assert.Equal(1500.0, data.Measurements["durationMs"])
+		assert.Equal(3.0, data.Measurements["deletedTags"])
+	})
+	// Fourth test, nothing is sent without an instrumentation key and a rejected event is an error.
+	t.Run("ErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+		assert.NotEqual(nil, Send(context.Background(), server.URL, "", "", Event{}), "Error should not be nil")
+		assert.Equal(0, requests)
+		assert.NotEqual(nil, Send(context.Background(), server.URL, "key", "", Event{}), "Error should not be nil")
+		assert.Equal(1, requests)
+	})
+	// Fifth test, the counts are summed and reset once they are read.
+	t.Run("CountsTest", func(t *testing.T) {
+		assert := assert.New(t)
+		Count("deletedTags", 2)
+		Count("deletedTags", 3)
+		assert.Equal(map[string]int{"deletedTags": 5}, Counts())
+		assert.Equal(map[string]int{}, Counts())
+	})
+	// Sixth test, the events are sent through the proxy of the transport of the registry clients with its credentials.
+	t.Run("ProxyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		var proxied []string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxied = append(proxied, r.Host, r.Header.Get("Proxy-Authorization"))
+		}))
+		defer proxy.Close()
+		options := api.DefaultTransportOptions()
+		options.Proxy = proxy.URL
+		options.ProxyUsername = "user"
+		options.ProxyPassword = "password"
+		assert.Equal(nil, api.ConfigureTransport(options), "Error should be nil")
+		defer api.ConfigureTransport(api.DefaultTransportOptions())
+		assert.Equal(nil, Send(context.Background(), "http://telemetry.example.com/v2/track", "key", "", Event{}), "Error should be nil")
+		assert.Equal([]string{"telemetry.example.com", "Basic dXNlcjpwYXNzd29yZA=="}, proxied)
+	})
+}
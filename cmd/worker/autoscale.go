@@ -0,0 +1,139 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// The number of jobs that run at the same time with the automatic concurrency starts at autoInitialConcurrency and
+// stays between autoMinConcurrency and autoMaxConcurrency, a worker is started for every job that can run.
+const (
+	autoInitialConcurrency = 2
+	autoMinConcurrency     = 1
+	autoMaxConcurrency     = 32
+)
+
+// maxConcurrency returns the highest number of jobs the automatic concurrency runs at the same time with the bound of
+// DispatcherOptions, it is lower than autoMaxConcurrency for the registries that cannot serve as many concurrent
+// deletions.
+func maxConcurrency(bound int) int {
+	if bound <= 0 || bound > autoMaxConcurrency {
+		return autoMaxConcurrency
+	}
+	return bound
+}
+
+// latencyTolerance is how many times slower than the fastest window a window of jobs can be before the registry is
+// considered loaded and the concurrency is reduced.
+const latencyTolerance = 2
+
+// concurrencyLimiter limits the number of jobs that run at the same time and adapts the limit to the registry. The
+// limit grows by one after a window of as many jobs as the limit whose average latency stays close to the fastest
+// window seen so far, it shrinks by one if the latency increases and it is halved as soon as a job is throttled.
+type concurrencyLimiter struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	min     int
+	max     int
+	peak    int
+	running int
+	// generation changes every time the limit changes, the jobs that started before a change do not change the limit
+	// again so that a burst of throttled jobs only halves it once.
+	generation int
+	// window and windowLatency are the number and the total latency of the jobs finished in the current generation.
+	window        int
+	windowLatency time.Duration
+	// baseline is the lowest average latency of a window, the latency of the registry when it is not loaded.
+	baseline time.Duration
+}
+
+// newConcurrencyLimiter creates a limiter that lets initial jobs run at the same time.
+func newConcurrencyLimiter(initial int, min int, max int) *concurrencyLimiter {
+	l := &concurrencyLimiter{limit: initial, min: min, max: max, peak: initial}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire blocks until the job can run or its context is cancelled and returns the generation the job started in.
+func (l *concurrencyLimiter) acquire(ctx context.Context) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// A job whose context is cancelled stops waiting, its request fails right away. The waiting jobs are woken up
+	// when the context is done since the condition is only signalled by the jobs that finish.
+	if l.running >= l.limit && ctx.Done() != nil {
+		acquired := make(chan struct{})
+		defer close(acquired)
+		go func() {
+			select {
+			case <-ctx.Done():
+				l.mu.Lock()
+				l.cond.Broadcast()
+				l.mu.Unlock()
+			case <-acquired:
+			}
+		}()
+	}
+	for l.running >= l.limit && ctx.Err() == nil {
+		l.cond.Wait()
+	}
+	l.running++
+	return l.generation
+}
+
+// release records the latency of a finished job and whether it was throttled, and adjusts the limit.
+func (l *concurrencyLimiter) release(generation int, latency time.Duration, throttled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	defer l.cond.Broadcast()
+	if generation != l.generation {
+		return
+	}
+	if throttled {
+		l.setLimit(l.limit / 2)
+		return
+	}
+	l.window++
+	l.windowLatency += latency
+	if l.window < l.limit {
+		return
+	}
+	average := l.windowLatency / time.Duration(l.window)
+	if l.baseline == 0 || average < l.baseline {
+		l.baseline = average
+	}
+	if average <= l.baseline*latencyTolerance {
+		l.setLimit(l.limit + 1)
+	} else {
+		l.setLimit(l.limit - 1)
+	}
+}
+
+// setLimit changes the limit within the bounds and starts a new generation.
+func (l *concurrencyLimiter) setLimit(limit int) {
+	if limit < l.min {
+		limit = l.min
+	}
+	if limit > l.max {
+		limit = l.max
+	}
+	l.limit = limit
+	if limit > l.peak {
+		l.peak = limit
+	}
+	l.generation++
+	l.window = 0
+	l.windowLatency = 0
+}
+
+// limits returns the current and the highest limit.
+func (l *concurrencyLimiter) limits() (int, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit, l.peak
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConcurrencyLimiter contains the tests for the automatic concurrency of the workers.
+func TestConcurrencyLimiter(t *testing.T) {
+	ctx := context.Background()
+	// First test, the limit grows by one after a window of fast jobs and never goes over the maximum.
+	t.Run("GrowTest", func(t *testing.T) {
+		assert := assert.New(t)
+		l := newConcurrencyLimiter(2, 1, 3)
+		for i := 0; i < 10; i++ {
+			generation := l.acquire(ctx)
+			l.release(generation, 10*time.Millisecond, false)
+		}
+		limit, peak := l.limits()
+		assert.Equal(3, limit)
+		assert.Equal(3, peak)
+	})
+	// Second test, a burst of throttled jobs that started together only halves the limit once.
+	t.Run("ThrottledTest", func(t *testing.T) {
+		assert := assert.New(t)
+		l := newConcurrencyLimiter(8, 1, 8)
+		generations := []int{}
+		for i := 0; i < 3; i++ {
+			generations = append(generations, l.acquire(ctx))
+		}
+		for _, generation := range generations {
+			l.release(generation, time.Second, true)
+		}
+		limit, _ := l.limits()
+		assert.Equal(4, limit)
+	})
+	// Third test, the limit shrinks when the latency grows over the tolerance and stays over the minimum.
+	t.Run("SlowTest", func(t *testing.T) {
+		assert := assert.New(t)
+		l := newConcurrencyLimiter(1, 1, 4)
+		l.release(l.acquire(ctx), 10*time.Millisecond, false)
+		limit, _ := l.limits()
+		assert.Equal(2, limit)
+		l.release(l.acquire(ctx), time.Second, false)
+		l.release(l.acquire(ctx), time.Second, false)
+		limit, _ = l.limits()
+		assert.Equal(1, limit)
+		l.release(l.acquire(ctx), 0, true)
+		limit, _ = l.limits()
+		assert.Equal(1, limit)
+	})
+	// Fourth test, a job waits until a running job finishes when the limit is reached.
+	t.Run("WaitTest", func(t *testing.T) {
+		assert := assert.New(t)
+		l := newConcurrencyLimiter(1, 1, 1)
+		generation := l.acquire(ctx)
+		acquired := make(chan int)
+		go func() {
+			acquired <- l.acquire(ctx)
+		}()
+		select {
+		case <-acquired:
+			assert.Fail("The job should wait for the running job")
+		case <-time.After(20 * time.Millisecond):
+		}
+		l.release(generation, time.Millisecond, false)
+		select {
+		case <-acquired:
+		case <-time.After(time.Second):
+			assert.Fail("The job should run once the running job finished")
+		}
+	})
+	// Fifth test, a waiting job stops waiting as soon as its context is cancelled, while the running job still runs.
+	t.Run("CancelTest", func(t *testing.T) {
+		l := newConcurrencyLimiter(1, 1, 1)
+		l.acquire(ctx)
+		cancelCtx, cancel := context.WithCancel(ctx)
+		acquired := make(chan int)
+		go func() {
+			acquired <- l.acquire(cancelCtx)
+		}()
+		// The job is waiting for the running job when the context is cancelled.
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		select {
+		case <-acquired:
+		case <-time.After(time.Second):
+			assert.Fail(t, "The job should stop waiting once its context is cancelled")
+		}
+	})
+	// Sixth test, the bound of the options limits the workers and the limit of the automatic concurrency of a single
+	// dispatcher.
+	t.Run("MaxConcurrencyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		d := NewDispatcherWithOptions(ctx, nil, DispatcherOptions{MaxConcurrency: 1})
+		defer d.Stop()
+		assert.Equal(1, len(d.workers))
+		limit, _ := d.limiter.limits()
+		assert.Equal(1, limit)
+		assert.Equal(1, d.limiter.max)
+		other := NewAutoscalingDispatcher(ctx, nil)
+		defer other.Stop()
+		assert.Equal(autoMaxConcurrency, len(other.workers))
+		assert.Equal(autoMaxConcurrency, maxConcurrency(0))
+	})
+}
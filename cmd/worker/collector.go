@@ -3,36 +3,115 @@
 
 package worker
 
-import "time"
+import (
+	"io"
+	"sync"
+	"time"
 
-// JobQueue is the queue that holds all the jobs that are going to be executed.
-var JobQueue = make(chan PurgeJob, 100)
+	"github.com/Azure/acr-cli/cmd/api"
+)
 
-// ErrorChannel is a channel for communication with the cobra command to verify
-// that no errors have happened so far.
-var ErrorChannel = make(chan workerError, 100)
+// Batch is a group of jobs queued by a caller that waits for all of them at once, the results of the jobs of other
+// batches of the same dispatcher are not mixed with its own. A batch can be used by a single goroutine at a time.
+type Batch struct {
+	dispatcher *Dispatcher
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	result     workerError
+	// handler receives the result of every deletion of the batch, it is nil unless SetResultHandler is called.
+	handler func(Result)
+	// out is where the deletions of the batch are printed, it is nil for the standard output unless SetOutput is
+	// called.
+	out io.Writer
+	// dispatched are the manifests already dispatched by the run of the batch, it is nil unless
+	// SetDispatchedManifests is called.
+	dispatched *DispatchedManifests
+	// verifyDigest makes the jobs check the digest of every tag right before deleting it, it is false unless
+	// SetVerifyDigest is called.
+	verifyDigest bool
+	// calls counts the requests of the jobs, it is nil unless SetCallCounter is called.
+	calls *api.CallCounter
+}
+
+// BatchResult counts the tags and manifests of the jobs of a batch that were deleted, skipped because they were
+// already deleted and failed to be deleted, Err is the first error of the jobs.
+type BatchResult struct {
+	Deleted int
+	Skipped int
+	Failed  int
+	Err     error
+}
+
+// SetDispatchedManifests sets the manifests already dispatched by the run of the batch, the manifests of the set are
+// not deleted again by the batch. It is set before the jobs are queued, nil deletes every queued manifest.
+func (b *Batch) SetDispatchedManifests(dispatched *DispatchedManifests) {
+	b.dispatched = dispatched
+}
+
+// SetCallCounter sets the counter of the requests sent by the jobs of the batch, e.g. the counter of the run that
+// queues them. It is set before the jobs are queued, nil does not count them.
+func (b *Batch) SetCallCounter(calls *api.CallCounter) {
+	b.calls = calls
+}
 
 // QueuePurgeTag creates a PurgeTag job and queues it.
-func QueuePurgeTag(loginURL string, repoName string, tag string, digest string) {
-	newJob := PurgeJob{
+func (b *Batch) QueuePurgeTag(loginURL string, repoName string, tag string, digest string) {
+	b.queue(PurgeJob{
 		LoginURL:    loginURL,
 		RepoName:    repoName,
 		Tag:         tag,
 		JobType:     PurgeTag,
 		Digest:      digest,
 		TimeCreated: time.Now().UTC(),
-	}
-	JobQueue <- newJob
+	})
 }
 
 // QueuePurgeManifest creates a new PurgeManifest job and queues it.
-func QueuePurgeManifest(loginURL string, repoName string, digest string) {
-	newJob := PurgeJob{
+func (b *Batch) QueuePurgeManifest(loginURL string, repoName string, digest string) {
+	b.queue(PurgeJob{
 		LoginURL:    loginURL,
 		RepoName:    repoName,
 		Digest:      digest,
 		JobType:     PurgeManifest,
 		TimeCreated: time.Now().UTC(),
-	}
-	JobQueue <- newJob
+	})
+}
+
+// QueuePurgeTagBatch creates a PurgeTagBatch job that deletes several tags of a repository and queues it, digests are
+// the digests the tags referenced when they were listed.
+func (b *Batch) QueuePurgeTagBatch(loginURL string, repoName string, tags []string, digests []string) {
+	b.queue(PurgeJob{
+		LoginURL:    loginURL,
+		RepoName:    repoName,
+		Tags:        tags,
+		Digests:     digests,
+		JobType:     PurgeTagBatch,
+		TimeCreated: time.Now().UTC(),
+	})
+}
+
+// queue counts the job as pending and queues it, it blocks while the queue of the dispatcher is full.
+func (b *Batch) queue(job PurgeJob) {
+	job.batch = b
+	b.wg.Add(1)
+	b.dispatcher.jobs <- job
+}
+
+// done records the result of a job of the batch.
+func (b *Batch) done(result workerError) {
+	b.mu.Lock()
+	b.result.add(result)
+	b.mu.Unlock()
+	b.wg.Done()
+}
+
+// Wait waits until all the queued jobs are done and returns their results, the results are only returned once so
+// that the batch can queue more jobs and wait for them again.
+func (b *Batch) Wait() BatchResult {
+	b.wg.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := BatchResult{Deleted: b.result.Deleted, Skipped: b.result.Skipped, Failed: b.result.Failed, Err: b.result.Error}
+	b.result = workerError{}
+	return result
 }
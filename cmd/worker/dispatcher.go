@@ -6,40 +6,234 @@ package worker
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/Azure/acr-cli/cmd/api"
 )
 
-// WorkerQueue represents the queue of the workers
-var WorkerQueue chan chan PurgeJob
-var workers []PurgeWorker
+// jobQueueSize is the number of jobs that can be queued before the batches wait for the workers to take them.
+const jobQueueSize = 100
 
-// StartDispatcher creates the workers and a goroutine to continuously fetch jobs for them.
-func StartDispatcher(ctx context.Context, wg *sync.WaitGroup, acrClient api.AcrCLIClientInterface, nWorkers int) {
-	WorkerQueue = make(chan chan PurgeJob, nWorkers)
-	workers = []PurgeWorker{}
+// Dispatcher runs the jobs queued by its batches on a pool of workers. Several batches, e.g. the purges of the jobs of
+// a server or of commands running in parallel, can queue jobs at the same time, every batch only waits for and
+// collects the results of its own jobs.
+type Dispatcher struct {
+	jobs        chan PurgeJob
+	workerQueue chan chan PurgeJob
+	workers     []PurgeWorker
+	stop        chan struct{}
+	stopOnce    sync.Once
+	// limiter limits how many workers run a job at the same time, it is nil if the concurrency is fixed.
+	limiter *concurrencyLimiter
+	stats   *statsCollector
+}
+
+// manifestKey identifies the manifest deleted by a PurgeManifest job.
+type manifestKey struct {
+	loginURL string
+	repoName string
+	digest   string
+}
+
+// DispatchedManifests is the set of the manifests whose deletion was dispatched by the batches of a run. A manifest
+// queued again by the same run, e.g. after the deletion of its tags and then with the untagged manifests, is only
+// deleted once so that the second deletion does not fail with a 404 and count the manifest as skipped. Every run has
+// its own set, so a manifest deleted by a run is deleted again by the next one if it was pushed again.
+type DispatchedManifests struct {
+	mu      sync.Mutex
+	digests map[manifestKey]bool
+}
+
+// NewDispatchedManifests returns an empty set of dispatched manifests.
+func NewDispatchedManifests() *DispatchedManifests {
+	return &DispatchedManifests{digests: map[manifestKey]bool{}}
+}
+
+// isDuplicate returns true if the job deletes a manifest whose deletion was already dispatched, otherwise the manifest
+// is marked as dispatched. A nil set has no duplicates.
+func (m *DispatchedManifests) isDuplicate(job PurgeJob) bool {
+	if m == nil || job.JobType != PurgeManifest {
+		return false
+	}
+	key := manifestKey{loginURL: job.LoginURL, repoName: job.RepoName, digest: job.Digest}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.digests[key] {
+		return true
+	}
+	m.digests[key] = true
+	return false
+}
+
+// forget removes the manifest of a job whose deletion failed, so that it is deleted if the run queues it again.
+func (m *DispatchedManifests) forget(job PurgeJob) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.digests, manifestKey{loginURL: job.LoginURL, repoName: job.RepoName, digest: job.Digest})
+}
+
+// DispatcherOptions are the settings of the jobs of a dispatcher. Every dispatcher has its own, so dispatchers with
+// different settings, e.g. for registries of different SKUs, can run at the same time.
+type DispatcherOptions struct {
+	// Workers is the number of jobs that run at the same time, 0 adapts it to the registry like
+	// NewAutoscalingDispatcher.
+	Workers int
+	// MaxConcurrency bounds the automatic concurrency, e.g. with the limits of the SKU of the registry, 0 is the
+	// default bound.
+	MaxConcurrency int
+	// CallsPerSecond is the number of calls per second an ACR allows, e.g. from the limits of its SKU, so that the jobs
+	// are paced once a share of the calls remain instead of a fixed number. It is 0 if it is not known.
+	CallsPerSecond float64
+	// SlowRequestThreshold is the latency over which a job is logged, 0 disables the logging.
+	SlowRequestThreshold time.Duration
+}
+
+// NewDispatcher creates nWorkers workers and a goroutine to continuously dispatch the queued jobs to them.
+func NewDispatcher(ctx context.Context, acrClient api.AcrCLIClientInterface, nWorkers int) *Dispatcher {
+	return NewDispatcherWithOptions(ctx, acrClient, DispatcherOptions{Workers: nWorkers})
+}
+
+// NewAutoscalingDispatcher creates the workers like NewDispatcher but, instead of a fixed number of jobs, starts
+// running a few jobs at the same time and runs more while the latency of the registry stays low and it does not
+// throttle the requests, and fewer as soon as it does.
+func NewAutoscalingDispatcher(ctx context.Context, acrClient api.AcrCLIClientInterface) *Dispatcher {
+	return NewDispatcherWithOptions(ctx, acrClient, DispatcherOptions{})
+}
+
+// NewDispatcherWithOptions creates the workers and the goroutine that dispatches the queued jobs to them with the
+// specified settings, the automatic concurrency never runs more jobs than the bound of the options.
+func NewDispatcherWithOptions(ctx context.Context, acrClient api.AcrCLIClientInterface, options DispatcherOptions) *Dispatcher {
+	nWorkers := options.Workers
+	var l *concurrencyLimiter
+	if nWorkers <= 0 {
+		nWorkers = maxConcurrency(options.MaxConcurrency)
+		initial := autoInitialConcurrency
+		if initial > nWorkers {
+			initial = nWorkers
+		}
+		l = newConcurrencyLimiter(initial, autoMinConcurrency, nWorkers)
+	}
+	d := &Dispatcher{
+		jobs:        make(chan PurgeJob, jobQueueSize),
+		workerQueue: make(chan chan PurgeJob, nWorkers),
+		stop:        make(chan struct{}),
+		limiter:     l,
+		stats:       &statsCollector{slowThreshold: options.SlowRequestThreshold},
+	}
+	jobPacer := newPacer(options.CallsPerSecond)
 	for i := 0; i < nWorkers; i++ {
-		worker := NewPurgeWorker(wg, WorkerQueue, acrClient)
+		worker := NewPurgeWorker(d.workerQueue, acrClient)
+		worker.ID = i
+		worker.limiter = l
+		worker.stats = d.stats
+		worker.pacer = jobPacer
 		worker.Start(ctx)
-		workers = append(workers, worker)
-	}
-
-	go func() {
-		for job := range JobQueue {
-			// Get a job from the JobQueue
-			go func(job PurgeJob) {
-				// Get a worker (block if there are none available) to process the job
-				worker := <-WorkerQueue
-				// Assign the job to the worker
-				worker <- job
-			}(job)
+		d.workers = append(d.workers, worker)
+	}
+	go d.dispatch()
+	return d
+}
+
+// dispatch passes every queued job to a free worker until the dispatcher is stopped.
+func (d *Dispatcher) dispatch() {
+	for {
+		var job PurgeJob
+		select {
+		case job = <-d.jobs:
+		case <-d.stop:
+			return
+		}
+		// A duplicate job of the run of the batch is done without reaching a worker and without a result.
+		if job.batch.dispatched.isDuplicate(job) {
+			d.stats.recordDeduplicated()
+			job.batch.done(workerError{})
+			continue
 		}
-	}()
+		go func(job PurgeJob) {
+			// Get a worker (block if there are none available) to process the job
+			worker := <-d.workerQueue
+			// Assign the job to the worker
+			worker <- job
+		}(job)
+	}
+}
+
+// NewBatch returns an empty batch whose jobs are run by the dispatcher.
+func (d *Dispatcher) NewBatch() *Batch {
+	return &Batch{dispatcher: d}
+}
+
+// Stop stops all the workers and the dispatch of the jobs, it can be called more than once.
+func (d *Dispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		for _, worker := range d.workers {
+			worker.Stop()
+		}
+		close(d.stop)
+	})
+}
+
+// Stats returns the statistics of the jobs processed by the dispatcher so far.
+func (d *Dispatcher) Stats() Stats {
+	return d.stats.snapshot(d.limiter)
+}
+
+// current is the dispatcher of the commands, started with StartDispatcher or StartAutoscalingDispatcher. It is kept
+// once it is stopped so that its statistics can still be read.
+var current struct {
+	sync.Mutex
+	dispatcher *Dispatcher
+}
+
+// StartDispatcher starts the dispatcher of the commands with nWorkers workers, see NewDispatcher. A dispatcher that
+// was started before is stopped.
+func StartDispatcher(ctx context.Context, acrClient api.AcrCLIClientInterface, nWorkers int) {
+	setCurrent(NewDispatcher(ctx, acrClient, nWorkers))
+}
+
+// StartAutoscalingDispatcher starts the dispatcher of the commands with the automatic concurrency, see
+// NewAutoscalingDispatcher. A dispatcher that was started before is stopped.
+func StartAutoscalingDispatcher(ctx context.Context, acrClient api.AcrCLIClientInterface) {
+	setCurrent(NewAutoscalingDispatcher(ctx, acrClient))
 }
 
-// StopDispatcher stops all the workers.
+// setCurrent replaces the dispatcher of the commands and stops the previous one.
+func setCurrent(d *Dispatcher) {
+	current.Lock()
+	previous := current.dispatcher
+	current.dispatcher = d
+	current.Unlock()
+	if previous != nil {
+		previous.Stop()
+	}
+}
+
+// currentDispatcher returns the dispatcher of the commands, or nil if none was started.
+func currentDispatcher() *Dispatcher {
+	current.Lock()
+	defer current.Unlock()
+	return current.dispatcher
+}
+
+// StopDispatcher stops the dispatcher of the commands.
 func StopDispatcher() {
-	for _, worker := range workers {
-		worker.Stop()
+	if d := currentDispatcher(); d != nil {
+		d.Stop()
+	}
+}
+
+// NewBatch returns an empty batch whose jobs are run by the dispatcher of the commands, it has to be started first.
+func NewBatch() *Batch {
+	return currentDispatcher().NewBatch()
+}
+
+// GetStats returns the statistics of the jobs processed by the dispatcher of the commands so far.
+func GetStats() Stats {
+	if d := currentDispatcher(); d != nil {
+		return d.Stats()
 	}
+	return (&statsCollector{}).snapshot(nil)
 }
@@ -0,0 +1,186 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestDispatcher contains the tests for the dispatch of the jobs to the workers.
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	deleted := &autorest.Response{Response: &http.Response{StatusCode: http.StatusAccepted}}
+	// First test, a manifest queued twice by the batches of a run is only deleted once and the duplicate is not
+	// counted as skipped.
+	t.Run("DuplicateManifestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("DeleteManifest", mock.Anything, "bar", "sha256:abc").Return(deleted, nil).Once()
+		mockClient.On("DeleteManifest", mock.Anything, "baz", "sha256:abc").Return(deleted, nil).Once()
+		d := NewDispatcher(ctx, mockClient, 2)
+		defer d.Stop()
+		dispatched := NewDispatchedManifests()
+		batch := d.NewBatch()
+		batch.SetDispatchedManifests(dispatched)
+		batch.QueuePurgeManifest("foo.azurecr.io", "bar", "sha256:abc")
+		batch.QueuePurgeManifest("foo.azurecr.io", "bar", "sha256:abc")
+		// The same digest in another repository is another manifest.
+		batch.QueuePurgeManifest("foo.azurecr.io", "baz", "sha256:abc")
+		result := batch.Wait()
+		assert.Equal(nil, result.Err)
+		assert.Equal(2, result.Deleted)
+		assert.Equal(0, result.Skipped)
+		batch = d.NewBatch()
+		batch.SetDispatchedManifests(dispatched)
+		batch.QueuePurgeManifest("foo.azurecr.io", "bar", "sha256:abc")
+		assert.Equal(0, batch.Wait().Deleted)
+		assert.Equal(2, d.Stats().Deduplicated)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, the manifests dispatched by a run are deleted again by the next runs of the same dispatcher, and by
+	// the batches without a set of dispatched manifests. A non-manifest job is never a duplicate.
+	t.Run("ResetTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("DeleteManifest", mock.Anything, "bar", "sha256:def").Return(deleted, nil).Times(4)
+		d := NewDispatcher(ctx, mockClient, 1)
+		defer d.Stop()
+		for i := 0; i < 2; i++ {
+			batch := d.NewBatch()
+			batch.SetDispatchedManifests(NewDispatchedManifests())
+			batch.QueuePurgeManifest("foo.azurecr.io", "bar", "sha256:def")
+			assert.Equal(1, batch.Wait().Deleted)
+		}
+		batch := d.NewBatch()
+		batch.QueuePurgeManifest("foo.azurecr.io", "bar", "sha256:def")
+		batch.QueuePurgeManifest("foo.azurecr.io", "bar", "sha256:def")
+		assert.Equal(2, batch.Wait().Deleted)
+		assert.Equal(0, d.Stats().Deduplicated)
+		manifests := NewDispatchedManifests()
+		assert.False(manifests.isDuplicate(PurgeJob{LoginURL: "foo.azurecr.io", RepoName: "bar", Tag: "latest", Digest: "sha256:def", JobType: PurgeTag}))
+		assert.False(manifests.isDuplicate(PurgeJob{LoginURL: "foo.azurecr.io", RepoName: "bar", Tag: "latest", Digest: "sha256:def", JobType: PurgeTag}))
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, a manifest whose deletion failed is deleted if the run queues it again.
+	t.Run("FailedManifestTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("DeleteManifest", mock.Anything, "bar", "sha256:abc").Return(nil, errors.New("unavailable")).Once()
+		mockClient.On("DeleteManifest", mock.Anything, "bar", "sha256:abc").Return(deleted, nil).Once()
+		d := NewDispatcher(ctx, mockClient, 1)
+		defer d.Stop()
+		dispatched := NewDispatchedManifests()
+		batch := d.NewBatch()
+		batch.SetDispatchedManifests(dispatched)
+		batch.QueuePurgeManifest("foo.azurecr.io", "bar", "sha256:abc")
+		result := batch.Wait()
+		assert.Equal(1, result.Failed)
+		assert.NotEqual(nil, result.Err)
+		batch = d.NewBatch()
+		batch.SetDispatchedManifests(dispatched)
+		batch.QueuePurgeManifest("foo.azurecr.io", "bar", "sha256:abc")
+		assert.Equal(1, batch.Wait().Deleted)
+		assert.Equal(0, d.Stats().Deduplicated)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, the batches that run at the same time on the same workers only collect the results of their jobs.
+	t.Run("ConcurrentBatchesTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("DeleteAcrTag", mock.Anything, "ok", mock.Anything).After(time.Millisecond).Return(deleted, nil)
+		mockClient.On("DeleteAcrTag", mock.Anything, "failing", mock.Anything).After(time.Millisecond).Return(nil, errors.New("unauthorized"))
+		d := NewDispatcher(ctx, mockClient, 4)
+		defer d.Stop()
+		// More jobs than the size of the queue are queued by every batch.
+		results := make([]BatchResult, 4)
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				repoName := "ok"
+				if i%2 == 1 {
+					repoName = "failing"
+				}
+				batch := d.NewBatch()
+				for j := 0; j < 2*jobQueueSize; j++ {
+					batch.QueuePurgeTag("foo.azurecr.io", repoName, fmt.Sprintf("v%d-%d", i, j), "")
+				}
+				results[i] = batch.Wait()
+			}(i)
+		}
+		wg.Wait()
+		for i, result := range results {
+			if i%2 == 1 {
+				assert.NotEqual(nil, result.Err, "Error should not be nil")
+				assert.Equal(BatchResult{Failed: 2 * jobQueueSize, Err: result.Err}, result)
+			} else {
+				assert.Equal(BatchResult{Deleted: 2 * jobQueueSize}, result)
+			}
+		}
+		assert.Equal(8*jobQueueSize, d.Stats().Jobs)
+	})
+	// Fifth test, the requests of the jobs of a batch are sent with the call counter of the batch.
+	t.Run("CallCounterTest", func(t *testing.T) {
+		assert := assert.New(t)
+		counted, other := api.NewCallCounter(), api.NewCallCounter()
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("DeleteAcrTag", mock.MatchedBy(func(ctx context.Context) bool {
+			return api.CallCounterFrom(ctx) == counted
+		}), "bar", "v1").Return(deleted, nil).Once()
+		mockClient.On("DeleteAcrTag", mock.MatchedBy(func(ctx context.Context) bool {
+			return api.CallCounterFrom(ctx) == other
+		}), "bar", "v2").Return(deleted, nil).Once()
+		d := NewDispatcher(ctx, mockClient, 2)
+		defer d.Stop()
+		batch := d.NewBatch()
+		batch.SetCallCounter(counted)
+		batch.QueuePurgeTag("foo.azurecr.io", "bar", "v1", "")
+		otherBatch := d.NewBatch()
+		otherBatch.SetCallCounter(other)
+		otherBatch.QueuePurgeTag("foo.azurecr.io", "bar", "v2", "")
+		assert.Equal(1, batch.Wait().Deleted)
+		assert.Equal(1, otherBatch.Wait().Deleted)
+		mockClient.AssertExpectations(t)
+	})
+	// Sixth test, a dispatcher with a fixed number of workers never sends more requests at the same time.
+	t.Run("FixedConcurrencyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		var mu sync.Mutex
+		running, peak := 0, 0
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("DeleteAcrTag", mock.Anything, "bar", mock.Anything).Run(func(mock.Arguments) {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+			time.Sleep(2 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+		}).Return(deleted, nil)
+		d := NewDispatcher(ctx, mockClient, 2)
+		defer d.Stop()
+		batch := d.NewBatch()
+		for i := 0; i < 20; i++ {
+			batch.QueuePurgeTag("foo.azurecr.io", "bar", fmt.Sprintf("v%d", i), "")
+		}
+		assert.Equal(20, batch.Wait().Deleted)
+		assert.Equal(2, peak)
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// pacer spreads the jobs of all the workers when the registry reports that its rate limit quota is low, so that the
+// remaining calls last until the quota is reset instead of the requests being throttled with 429s and retried.
+type pacer struct {
+	mu sync.Mutex
+	// next is the earliest time the next paced job can start.
+	next time.Time
+	// rateLimit returns the quota reported by the registry, it is replaced in the tests.
+	rateLimit func() api.RateLimit
+	// callsPerSecond is the number of calls per second the registry allows, 0 if it is not known.
+	callsPerSecond float64
+}
+
+// newPacer returns a pacer of the quota reported by the registry, callsPerSecond is the limit of an ACR or 0.
+func newPacer(callsPerSecond float64) *pacer {
+	return &pacer{rateLimit: api.GetRateLimit, callsPerSecond: callsPerSecond}
+}
+
+// wait blocks until the job can be sent, it returns false right away if the quota is not low.
+func (p *pacer) wait(ctx context.Context) bool {
+	now := time.Now()
+	delay := p.rateLimit().WithCallsPerSecond(p.callsPerSecond).Pace(now)
+	if delay <= 0 {
+		return false
+	}
+	// Every worker takes the next free slot so that the paced jobs do not all start at the same time.
+	p.mu.Lock()
+	start := now.Add(delay)
+	if p.next.After(start) {
+		start = p.next
+	}
+	p.next = start.Add(delay)
+	p.mu.Unlock()
+	timer := time.NewTimer(start.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return true
+}
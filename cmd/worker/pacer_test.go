@@ -0,0 +1,49 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPacer contains the tests for the pacing of the jobs when the rate limit quota of the registry is low.
+func TestPacer(t *testing.T) {
+	// First test, the jobs are not delayed while the quota is not low.
+	t.Run("PlentyTest", func(t *testing.T) {
+		assert := assert.New(t)
+		p := &pacer{rateLimit: func() api.RateLimit {
+			return api.RateLimit{Remaining: 90, Limit: 100, Window: time.Second, Observed: time.Now()}
+		}}
+		assert.False(p.wait(context.Background()))
+	})
+	// Second test, with a low quota the jobs take consecutive slots.
+	t.Run("LowQuotaTest", func(t *testing.T) {
+		assert := assert.New(t)
+		observed := time.Now()
+		p := &pacer{rateLimit: func() api.RateLimit {
+			return api.RateLimit{Remaining: 1, Limit: 100, Window: 100 * time.Millisecond, Observed: observed}
+		}}
+		start := time.Now()
+		assert.True(p.wait(context.Background()))
+		assert.True(p.wait(context.Background()))
+		assert.True(time.Since(start) >= 40*time.Millisecond)
+	})
+	// Third test, a cancelled context stops the wait.
+	t.Run("CancelTest", func(t *testing.T) {
+		assert := assert.New(t)
+		p := &pacer{rateLimit: func() api.RateLimit {
+			return api.RateLimit{Remaining: 0, Window: time.Hour, Observed: time.Now()}
+		}}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		start := time.Now()
+		assert.True(p.wait(ctx))
+		assert.True(time.Since(start) < time.Second)
+	})
+}
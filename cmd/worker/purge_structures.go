@@ -7,12 +7,17 @@ import "time"
 
 // PurgeJob describes a purge job, contains all necessary parameters to execute job.
 type PurgeJob struct {
-	LoginURL    string
-	RepoName    string
-	Tag         string
+	LoginURL string
+	RepoName string
+	Tag      string
+	// Tags are the tags deleted by a PurgeTagBatch job and Digests the digests they referenced when they were listed.
+	Tags        []string
+	Digests     []string
 	Digest      string
 	TimeCreated time.Time
 	JobType     JobTypeEnum
+	// batch is the batch that queued the job, it receives the result of the job.
+	batch *Batch
 }
 
 // JobTypeEnum describes the type of PurgeJob.
@@ -24,10 +29,27 @@ const (
 
 	//PurgeManifest refers to a manifest deletion job
 	PurgeManifest JobTypeEnum = "purgemanifest"
+
+	// PurgeTagBatch refers to the deletion of several tags of a repository with a single request
+	PurgeTagBatch JobTypeEnum = "purgetagbatch"
 )
 
-// workerError describes an error which occurred inside a worker.
+// workerError describes an error which occurred inside a worker and counts the tags or manifests of the job that were
+// deleted, skipped because they were already deleted and failed to be deleted.
 type workerError struct {
 	JobType JobTypeEnum
 	Error   error
+	Deleted int
+	Skipped int
+	Failed  int
+}
+
+// add adds the counts of the result of another deletion and keeps the first error.
+func (e *workerError) add(other workerError) {
+	if e.Error == nil {
+		e.JobType, e.Error = other.JobType, other.Error
+	}
+	e.Deleted += other.Deleted
+	e.Skipped += other.Skipped
+	e.Failed += other.Failed
 }
@@ -0,0 +1,52 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"fmt"
+	"io"
+)
+
+// Result is the outcome of the deletion of a single tag or manifest. Tag is empty for a manifest and Digest is empty
+// for a tag, Skipped is set if it was not found and had already been deleted. Moved is set together with Skipped if a
+// tag was not deleted because it references another digest than when it was listed, Digest is then the one it
+// references.
+type Result struct {
+	RepoName string
+	Tag      string
+	Digest   string
+	Skipped  bool
+	Moved    bool
+	Err      error
+}
+
+// SetResultHandler sets the function that receives the result of every tag and manifest deleted by the jobs of the
+// batch, the workers call it concurrently. It is set before the jobs are queued, a nil handler disables it.
+func (b *Batch) SetResultHandler(handler func(Result)) {
+	b.handler = handler
+}
+
+// SetOutput sets where the jobs of the batch print the tags and manifests they delete or skip, it is set before the
+// jobs are queued. The jobs print one at a time, a nil writer prints to the standard output.
+func (b *Batch) SetOutput(out io.Writer) {
+	b.out = out
+}
+
+// printf prints a message of a job of the batch to the output of the batch.
+func (b *Batch) printf(format string, a ...interface{}) {
+	if b == nil || b.out == nil {
+		fmt.Printf(format, a...)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fmt.Fprintf(b.out, format, a...)
+}
+
+// report passes a result to the handler of the batch if there is one.
+func (b *Batch) report(result Result) {
+	if b.handler != nil {
+		b.handler(result)
+	}
+}
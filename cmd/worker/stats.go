@@ -0,0 +1,194 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// jobStat is the latency, the amount of retries and the outcome of a single job.
+type jobStat struct {
+	worker  int
+	latency time.Duration
+	retries int
+	failed  bool
+}
+
+// statsCollector keeps the jobStat of every job processed by a dispatcher.
+type statsCollector struct {
+	mu           sync.Mutex
+	jobs         []jobStat
+	paced        int
+	deduplicated int
+	mismatches   int
+	// slowThreshold is the latency over which a job is logged, 0 if the jobs are not logged.
+	slowThreshold time.Duration
+}
+
+// Latencies contains the percentiles of the latency of a set of jobs.
+type Latencies struct {
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// WorkerStats contains the statistics of the jobs processed by a single worker.
+type WorkerStats struct {
+	ID      int
+	Jobs    int
+	Retries int
+	Latencies
+}
+
+// Stats contains the statistics of all the jobs processed since the dispatcher was started, and the ones of every
+// worker ordered by their ID. Failed is the number of jobs that returned an error.
+type Stats struct {
+	Jobs    int
+	Failed  int
+	Retries int
+	// Paced is the number of jobs that waited because the rate limit quota of the registry was low.
+	Paced int
+	// Deduplicated is the number of manifest deletions that were dropped because the manifest was already deleted by
+	// another job.
+	Deduplicated int
+	// DigestMismatches is the number of tags that were not deleted because they were pushed again after they were
+	// listed, they are only checked by the batches whose SetVerifyDigest is called.
+	DigestMismatches int
+	// Concurrency and PeakConcurrency are the final and the highest number of jobs that could run at the same time
+	// with the automatic concurrency, they are 0 if the concurrency is fixed.
+	Concurrency     int
+	PeakConcurrency int
+	Latencies
+	Workers []WorkerStats
+}
+
+// snapshot returns the statistics of the jobs recorded so far, l is the limiter of the dispatcher or nil if the
+// concurrency is fixed.
+func (c *statsCollector) snapshot(l *concurrencyLimiter) Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := Stats{Workers: []WorkerStats{}, Paced: c.paced, Deduplicated: c.deduplicated, DigestMismatches: c.mismatches}
+	if l != nil {
+		result.Concurrency, result.PeakConcurrency = l.limits()
+	}
+	all := []time.Duration{}
+	perWorker := map[int][]time.Duration{}
+	workerStats := map[int]*WorkerStats{}
+	for _, job := range c.jobs {
+		result.Jobs++
+		if job.failed {
+			result.Failed++
+		}
+		result.Retries += job.retries
+		all = append(all, job.latency)
+		perWorker[job.worker] = append(perWorker[job.worker], job.latency)
+		if _, ok := workerStats[job.worker]; !ok {
+			workerStats[job.worker] = &WorkerStats{ID: job.worker}
+		}
+		workerStats[job.worker].Jobs++
+		workerStats[job.worker].Retries += job.retries
+	}
+	result.Latencies = latencies(all)
+	for id, ws := range workerStats {
+		ws.Latencies = latencies(perWorker[id])
+		result.Workers = append(result.Workers, *ws)
+	}
+	sort.Slice(result.Workers, func(i, j int) bool {
+		return result.Workers[i].ID < result.Workers[j].ID
+	})
+	return result
+}
+
+// recordPaced counts a job that waited for the rate limit quota.
+func (c *statsCollector) recordPaced() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paced++
+}
+
+// recordDeduplicated counts a manifest deletion dropped because it was a duplicate.
+func (c *statsCollector) recordDeduplicated() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deduplicated++
+}
+
+// recordDigestMismatch counts a tag that was not deleted because it references another digest.
+func (c *statsCollector) recordDigestMismatch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mismatches++
+}
+
+// record stores the statistics of a job and logs it if it was slower than the threshold.
+func (c *statsCollector) record(workerID int, job PurgeJob, latency time.Duration, retries int, failed bool) {
+	c.mu.Lock()
+	c.jobs = append(c.jobs, jobStat{worker: workerID, latency: latency, retries: retries, failed: failed})
+	c.mu.Unlock()
+	if c.slowThreshold > 0 && latency > c.slowThreshold {
+		job.batch.printf("Slow request: %s took %s (%d retries)\n", jobDescription(job), latency.Round(time.Millisecond), retries)
+	}
+}
+
+// jobDescription returns the image a job deletes.
+func jobDescription(job PurgeJob) string {
+	switch job.JobType {
+	case PurgeTag:
+		return fmt.Sprintf("%s/%s:%s", job.LoginURL, job.RepoName, job.Tag)
+	case PurgeTagBatch:
+		return fmt.Sprintf("%s/%s (%d tags)", job.LoginURL, job.RepoName, len(job.Tags))
+	}
+	return fmt.Sprintf("%s/%s@%s", job.LoginURL, job.RepoName, job.Digest)
+}
+
+// withAttemptCounter returns a context that counts the connections requested by the http requests sent with it. The
+// autorest senders retry throttled and failed requests with the same context, so every attempt after the first one
+// is a retry.
+func withAttemptCounter(ctx context.Context) (context.Context, *int32) {
+	attempts := new(int32)
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			atomic.AddInt32(attempts, 1)
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), attempts
+}
+
+// attemptRetries returns the amount of retries counted by withAttemptCounter.
+func attemptRetries(attempts *int32) int {
+	retries := int(atomic.LoadInt32(attempts)) - 1
+	if retries < 0 {
+		return 0
+	}
+	return retries
+}
+
+// latencies returns the percentiles of a set of latencies using the nearest-rank method.
+func latencies(values []time.Duration) Latencies {
+	if len(values) == 0 {
+		return Latencies{}
+	}
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return Latencies{
+		P50: percentile(sorted, 50),
+		P95: percentile(sorted, 95),
+		P99: percentile(sorted, 99),
+	}
+}
+
+// percentile returns the value below which p percent of the sorted values fall.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
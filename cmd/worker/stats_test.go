@@ -0,0 +1,68 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestStats contains the tests for the statistics recorded by the workers.
+func TestStats(t *testing.T) {
+	// First test, the percentiles use the nearest rank of the sorted latencies.
+	t.Run("PercentilesTest", func(t *testing.T) {
+		assert := assert.New(t)
+		values := []time.Duration{}
+		for i := 100; i > 0; i-- {
+			values = append(values, time.Duration(i)*time.Millisecond)
+		}
+		result := latencies(values)
+		assert.Equal(50*time.Millisecond, result.P50)
+		assert.Equal(95*time.Millisecond, result.P95)
+		assert.Equal(99*time.Millisecond, result.P99)
+		single := latencies([]time.Duration{time.Second})
+		assert.Equal(time.Second, single.P50)
+		assert.Equal(time.Second, single.P99)
+		assert.Equal(Latencies{}, latencies(nil))
+	})
+	// Second test, the jobs are aggregated overall and for every worker.
+	t.Run("SnapshotTest", func(t *testing.T) {
+		assert := assert.New(t)
+		stats := &statsCollector{}
+		job := PurgeJob{LoginURL: "foo.azurecr.io", RepoName: "bar", Tag: "latest", JobType: PurgeTag}
+		stats.record(1, job, 3*time.Second, 2, true)
+		stats.record(0, job, time.Second, 0, false)
+		stats.record(0, job, 2*time.Second, 1, false)
+		result := stats.snapshot(nil)
+		assert.Equal(3, result.Jobs)
+		assert.Equal(1, result.Failed)
+		assert.Equal(3, result.Retries)
+		assert.Equal(2*time.Second, result.P50)
+		assert.Equal(3*time.Second, result.P99)
+		assert.Equal(2, len(result.Workers))
+		assert.Equal(WorkerStats{ID: 0, Jobs: 2, Retries: 1, Latencies: Latencies{P50: time.Second, P95: 2 * time.Second, P99: 2 * time.Second}}, result.Workers[0])
+		assert.Equal(1, result.Workers[1].ID)
+		assert.Equal(2, result.Workers[1].Retries)
+	})
+	// Third test, every request sent with the context is counted and the ones after the first are retries.
+	t.Run("AttemptCounterTest", func(t *testing.T) {
+		assert := assert.New(t)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+		ctx, attempts := withAttemptCounter(context.Background())
+		assert.Equal(0, attemptRetries(attempts))
+		for i := 0; i < 3; i++ {
+			req, _ := http.NewRequest(http.MethodDelete, server.URL, nil)
+			resp, err := server.Client().Do(req.WithContext(ctx))
+			assert.Equal(nil, err, "Error should be nil")
+			resp.Body.Close()
+		}
+		assert.Equal(2, attemptRetries(attempts))
+	})
+}
@@ -0,0 +1,64 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// SetVerifyDigest makes the jobs of the batch check that every tag still references the digest it referenced when it
+// was listed right before deleting it, a tag that was pushed again in the meantime is skipped. It is set before the
+// jobs are queued.
+func (b *Batch) SetVerifyDigest(enabled bool) {
+	b.verifyDigest = enabled
+}
+
+// checkTagDigest returns true if the tag can be deleted, i.e. the digest check is disabled, the digest of the tag is
+// not known or the tag still references it. Otherwise the tag is reported as skipped and the result of the job is
+// returned.
+func (pw *PurgeWorker) checkTagDigest(ctx context.Context, job PurgeJob, tag string, digest string) (bool, workerError) {
+	if !job.batch.verifyDigest || len(digest) == 0 {
+		return true, workerError{}
+	}
+	loginURL, repoName := job.LoginURL, job.RepoName
+	current, err := pw.acrClient.HeadManifest(ctx, repoName, tag)
+	if err != nil {
+		err = fmt.Errorf("failed to verify the digest of %s:%s: %w", repoName, tag, err)
+		job.batch.report(Result{RepoName: repoName, Tag: tag, Err: err})
+		return false, workerError{JobType: PurgeTag, Error: err, Failed: 1}
+	}
+	if len(current) == 0 {
+		job.batch.printf("Skipped %s/%s:%s, HTTP status: %d\n", loginURL, repoName, tag, http.StatusNotFound)
+		job.batch.report(Result{RepoName: repoName, Tag: tag, Skipped: true})
+		return false, workerError{Skipped: 1}
+	}
+	if current != digest {
+		job.batch.printf("Skipped %s/%s:%s, it references %s instead of %s since it was listed\n", loginURL, repoName, tag, current, digest)
+		job.batch.report(Result{RepoName: repoName, Tag: tag, Digest: current, Skipped: true, Moved: true})
+		pw.stats.recordDigestMismatch()
+		return false, workerError{Skipped: 1}
+	}
+	return true, workerError{}
+}
+
+// verifiedBatch returns the tags of a PurgeTagBatch job that still reference the digest they were listed with and
+// the result of the ones that do not.
+func (pw *PurgeWorker) verifiedBatch(ctx context.Context, job PurgeJob) ([]string, workerError) {
+	if !job.batch.verifyDigest || len(job.Digests) != len(job.Tags) {
+		return job.Tags, workerError{}
+	}
+	var wErr workerError
+	tags := []string{}
+	for i, tag := range job.Tags {
+		ok, tagErr := pw.checkTagDigest(ctx, job, tag, job.Digests[i])
+		if ok {
+			tags = append(tags, tag)
+		} else {
+			wErr.add(tagErr)
+		}
+	}
+	return tags, wErr
+}
@@ -0,0 +1,111 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestVerifyDigest contains the tests for the check of the digest of the tags right before they are deleted.
+func TestVerifyDigest(t *testing.T) {
+	ctx := context.Background()
+	deleted := &autorest.Response{Response: &http.Response{StatusCode: http.StatusAccepted}}
+	// First test, a tag that still references its digest is deleted, a tag pushed again and a tag already deleted
+	// are skipped and only the first one counts as a mismatch.
+	t.Run("TagTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("HeadManifest", mock.Anything, "bar", "v1").Return("sha256:1", nil).Once()
+		mockClient.On("HeadManifest", mock.Anything, "bar", "v2").Return("sha256:new", nil).Once()
+		mockClient.On("HeadManifest", mock.Anything, "bar", "v3").Return("", nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, "bar", "v1").Return(deleted, nil).Once()
+		results := []Result{}
+		var mu sync.Mutex
+		d := NewDispatcher(ctx, mockClient, 2)
+		defer d.Stop()
+		batch := d.NewBatch()
+		batch.SetVerifyDigest(true)
+		batch.SetResultHandler(func(result Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, result)
+		})
+		out := &bytes.Buffer{}
+		batch.SetOutput(out)
+		batch.QueuePurgeTag("foo.azurecr.io", "bar", "v1", "sha256:1")
+		batch.QueuePurgeTag("foo.azurecr.io", "bar", "v2", "sha256:2")
+		batch.QueuePurgeTag("foo.azurecr.io", "bar", "v3", "sha256:3")
+		result := batch.Wait()
+		assert.Equal(nil, result.Err)
+		assert.Equal(1, result.Deleted)
+		assert.Equal(2, result.Skipped)
+		assert.Equal(1, d.Stats().DigestMismatches)
+		assert.Contains(results, Result{RepoName: "bar", Tag: "v2", Digest: "sha256:new", Skipped: true, Moved: true})
+		assert.Contains(out.String(), "foo.azurecr.io/bar:v1\n")
+		assert.Contains(out.String(), "Skipped foo.azurecr.io/bar:v2, it references sha256:new instead of sha256:2 since it was listed\n")
+		assert.Contains(out.String(), "Skipped foo.azurecr.io/bar:v3, HTTP status: 404\n")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, only the tags of a batch that still reference their digest are deleted.
+	t.Run("BatchTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("HeadManifest", mock.Anything, "bar", "v1").Return("sha256:1", nil).Once()
+		mockClient.On("HeadManifest", mock.Anything, "bar", "v2").Return("sha256:new", nil).Once()
+		mockClient.On("DeleteAcrTags", mock.Anything, "bar", []string{"v1"}).Return(deleted, nil).Once()
+		d := NewDispatcher(ctx, mockClient, 2)
+		defer d.Stop()
+		batch := d.NewBatch()
+		batch.SetVerifyDigest(true)
+		batch.QueuePurgeTagBatch("foo.azurecr.io", "bar", []string{"v1", "v2"}, []string{"sha256:1", "sha256:2"})
+		result := batch.Wait()
+		assert.Equal(nil, result.Err)
+		assert.Equal(1, result.Deleted)
+		assert.Equal(1, result.Skipped)
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, if the digest cannot be checked the tag is not deleted and the job fails.
+	t.Run("HeadErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("HeadManifest", mock.Anything, "bar", "v1").Return("", errors.New("connection reset")).Once()
+		d := NewDispatcher(ctx, mockClient, 2)
+		defer d.Stop()
+		batch := d.NewBatch()
+		batch.SetVerifyDigest(true)
+		batch.QueuePurgeTag("foo.azurecr.io", "bar", "v1", "sha256:1")
+		result := batch.Wait()
+		assert.NotEqual(nil, result.Err)
+		assert.Equal(1, result.Failed)
+		mockClient.AssertExpectations(t)
+	})
+	// Fourth test, the digests are only checked by the batches that enable it, a batch of the same dispatcher that
+	// does not deletes the tag right away.
+	t.Run("PerBatchTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.AcrCLIClientInterface{}
+		mockClient.On("HeadManifest", mock.Anything, "bar", "v1").Return("sha256:new", nil).Once()
+		mockClient.On("DeleteAcrTag", mock.Anything, "bar", "v2").Return(deleted, nil).Once()
+		d := NewDispatcher(ctx, mockClient, 2)
+		defer d.Stop()
+		verified := d.NewBatch()
+		verified.SetVerifyDigest(true)
+		unverified := d.NewBatch()
+		verified.QueuePurgeTag("foo.azurecr.io", "bar", "v1", "sha256:1")
+		unverified.QueuePurgeTag("foo.azurecr.io", "bar", "v2", "sha256:2")
+		assert.Equal(1, verified.Wait().Skipped)
+		assert.Equal(1, unverified.Wait().Deleted)
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -5,30 +5,38 @@ package worker
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
-	"sync"
+	"time"
 
 	"github.com/Azure/acr-cli/cmd/api"
 )
 
 // PurgeWorker defines a worker that can process PurgeJobs.
 type PurgeWorker struct {
+	// ID identifies the worker in the statistics.
+	ID          int
 	Job         chan PurgeJob
 	WorkerQueue chan chan PurgeJob
 	StopChan    chan bool
-	wg          *sync.WaitGroup
 	acrClient   api.AcrCLIClientInterface
+	// limiter adapts the number of jobs that run at the same time, it is nil if the concurrency is fixed.
+	limiter *concurrencyLimiter
+	// stats records the jobs of the dispatcher of the worker.
+	stats *statsCollector
+	// pacer spreads the jobs of the dispatcher of the worker when the rate limit quota of the registry is low.
+	pacer *pacer
 }
 
 // NewPurgeWorker creates a new worker.
-func NewPurgeWorker(wg *sync.WaitGroup, workerQueue chan chan PurgeJob, acrClient api.AcrCLIClientInterface) PurgeWorker {
+func NewPurgeWorker(workerQueue chan chan PurgeJob, acrClient api.AcrCLIClientInterface) PurgeWorker {
 	worker := PurgeWorker{
 		Job:         make(chan PurgeJob),
 		StopChan:    make(chan bool),
 		WorkerQueue: workerQueue,
-		wg:          wg,
 		acrClient:   acrClient,
+		stats:       &statsCollector{},
+		pacer:       newPacer(0),
 	}
 	return worker
 }
@@ -38,7 +46,7 @@ func (pw *PurgeWorker) Start(ctx context.Context) {
 	go func() {
 		for {
 			// Free worker, insert worker into worker queue.
-			WorkerQueue <- pw.Job
+			pw.WorkerQueue <- pw.Job
 			select {
 			// If the worker has a job assigned begin processing it.
 			case job := <-pw.Job:
@@ -56,45 +64,106 @@ func (pw *PurgeWorker) Stop() {
 	pw.StopChan <- true
 }
 
-// ProcessJob processes any job (currently PurgeTag and PurgeManifest)
+// ProcessJob processes any job (currently PurgeTag, PurgeTagBatch and PurgeManifest), the worker only takes its next
+// job once it returns so that a dispatcher never runs more jobs at the same time than it has workers.
 func (pw *PurgeWorker) ProcessJob(ctx context.Context, job PurgeJob) {
-	go func() {
-		defer pw.wg.Done()
-		var wErr workerError
-		switch job.JobType {
-		case PurgeTag:
-			// In case a tag is going to be purged DeleteAcrTag method is used.
-			resp, err := pw.acrClient.DeleteAcrTag(ctx, job.RepoName, job.Tag)
-			if err != nil {
-				if resp != nil && resp.StatusCode == http.StatusNotFound {
-					// If the tag is not found it can be assumed to have been deleted.
-					fmt.Printf("Skipped %s/%s:%s, HTTP status: %d\n", job.LoginURL, job.RepoName, job.Tag, resp.StatusCode)
-				} else {
-					wErr = workerError{
-						JobType: PurgeTag,
-						Error:   err,
-					}
-				}
-			} else {
-				fmt.Printf("%s/%s:%s\n", job.LoginURL, job.RepoName, job.Tag)
+	var wErr workerError
+	// The result is recorded in the batch of the job, the batch waits for all its jobs.
+	defer func() { job.batch.done(wErr) }()
+	// With the automatic concurrency the job waits until fewer jobs than the current limit are running.
+	generation := 0
+	if pw.limiter != nil {
+		generation = pw.limiter.acquire(ctx)
+	}
+	// The job waits for its turn if the registry is close to throttling the requests.
+	if pw.pacer.wait(ctx) {
+		pw.stats.recordPaced()
+	}
+	// The requests of the job are counted with the ones of the run that queued it.
+	if job.batch.calls != nil {
+		ctx = api.WithCallCounter(ctx, job.batch.calls)
+	}
+	// The latency and the retries of every job are recorded to diagnose a slow registry.
+	ctx, attempts := withAttemptCounter(ctx)
+	start := time.Now()
+	switch job.JobType {
+	case PurgeTag:
+		// In case a tag is going to be purged DeleteAcrTag method is used, a tag that was pushed again after it
+		// was listed is kept if the digests are verified.
+		var ok bool
+		if ok, wErr = pw.checkTagDigest(ctx, job, job.Tag, job.Digest); ok {
+			wErr = pw.deleteTag(ctx, job, job.Tag)
+		}
+	case PurgeTagBatch:
+		// The tags are deleted with a single request, if the registry rejects the batch they are deleted one by one
+		// so that a single tag that cannot be deleted does not prevent the deletion of the rest.
+		var tags []string
+		tags, wErr = pw.verifiedBatch(ctx, job)
+		if len(tags) == 0 {
+			break
+		}
+		if _, err := pw.acrClient.DeleteAcrTags(ctx, job.RepoName, tags); err == nil {
+			for _, tag := range tags {
+				job.batch.printf("%s/%s:%s\n", job.LoginURL, job.RepoName, tag)
+				job.batch.report(Result{RepoName: job.RepoName, Tag: tag})
 			}
-		case PurgeManifest:
-			// In case a manifest is going to be purged DeleteManifest method is used.
-			resp, err := pw.acrClient.DeleteManifest(ctx, job.RepoName, job.Digest)
-			if err != nil {
-				if resp != nil && resp.StatusCode == http.StatusNotFound {
-					// If the manifest is not found it can be assumed to have been deleted.
-					fmt.Printf("Skipped %s/%s@%s, HTTP status: %d\n", job.LoginURL, job.RepoName, job.Digest, resp.StatusCode)
-				} else {
-					wErr = workerError{
-						JobType: PurgeTag,
-						Error:   err,
-					}
-				}
+			wErr.Deleted += len(tags)
+		} else {
+			for _, tag := range tags {
+				wErr.add(pw.deleteTag(ctx, job, tag))
+			}
+		}
+	case PurgeManifest:
+		// In case a manifest is going to be purged DeleteManifest method is used.
+		resp, err := pw.acrClient.DeleteManifest(ctx, job.RepoName, job.Digest)
+		if err = api.ResponseError(err, resp, api.PermissionDelete, job.RepoName); err != nil {
+			if errors.Is(err, api.ErrNotFound) {
+				// If the manifest is not found it can be assumed to have been deleted.
+				job.batch.printf("Skipped %s/%s@%s, HTTP status: %d\n", job.LoginURL, job.RepoName, job.Digest, http.StatusNotFound)
+				job.batch.report(Result{RepoName: job.RepoName, Digest: job.Digest, Skipped: true})
+				wErr.Skipped = 1
 			} else {
-				fmt.Printf("%s/%s@%s\n", job.LoginURL, job.RepoName, job.Digest)
+				// The manifest was not deleted, so the run deletes it if it queues it again.
+				job.batch.dispatched.forget(job)
+				wErr = workerError{
+					JobType: PurgeTag,
+					Error:   err,
+					Failed:  1,
+				}
+				job.batch.report(Result{RepoName: job.RepoName, Digest: job.Digest, Err: err})
 			}
+		} else {
+			job.batch.printf("%s/%s@%s\n", job.LoginURL, job.RepoName, job.Digest)
+			job.batch.report(Result{RepoName: job.RepoName, Digest: job.Digest})
+			wErr.Deleted = 1
 		}
-		ErrorChannel <- wErr
-	}()
+	}
+	latency, retries := time.Since(start), attemptRetries(attempts)
+	pw.stats.record(pw.ID, job, latency, retries, wErr.Error != nil)
+	if pw.limiter != nil {
+		// The autorest senders retry the throttled requests, so a retry means the registry is overloaded.
+		pw.limiter.release(generation, latency, retries > 0 || api.IsThrottled(wErr.Error))
+	}
+}
+
+// deleteTag deletes a single tag, a tag that is not found is skipped because it can be assumed to have been deleted.
+func (pw *PurgeWorker) deleteTag(ctx context.Context, job PurgeJob, tag string) workerError {
+	loginURL, repoName := job.LoginURL, job.RepoName
+	resp, err := pw.acrClient.DeleteAcrTag(ctx, repoName, tag)
+	if err = api.ResponseError(err, resp, api.PermissionDelete, repoName); err != nil {
+		if errors.Is(err, api.ErrNotFound) {
+			job.batch.printf("Skipped %s/%s:%s, HTTP status: %d\n", loginURL, repoName, tag, http.StatusNotFound)
+			job.batch.report(Result{RepoName: repoName, Tag: tag, Skipped: true})
+			return workerError{Skipped: 1}
+		}
+		job.batch.report(Result{RepoName: repoName, Tag: tag, Err: err})
+		return workerError{
+			JobType: PurgeTag,
+			Error:   err,
+			Failed:  1,
+		}
+	}
+	job.batch.printf("%s/%s:%s\n", loginURL, repoName, tag)
+	job.batch.report(Result{RepoName: repoName, Tag: tag})
+	return workerError{Deleted: 1}
 }
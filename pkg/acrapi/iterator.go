@@ -0,0 +1,211 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package acrapi lets Go programs list the contents of a registry the same way the acr-cli does. The iterators hide
+// the pagination of the ACR API, the clients returned by NewClient authenticate like the acr-cli commands, refresh
+// their tokens and retry the throttled requests.
+//
+//	client, err := acrapi.NewClient("example.azurecr.io", "", "", nil)
+//	if err != nil {
+//		return err
+//	}
+//	tags := acrapi.NewTagIterator(client, "hello-world", "")
+//	for tags.Next(ctx) {
+//		fmt.Println(*tags.Tag().Name)
+//	}
+//	return tags.Err()
+package acrapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+)
+
+// Client is the client the iterators list from, it is implemented by the clients returned by NewClient and by the
+// other clients of the acr-cli (e.g. the OCI client and the snapshot client).
+type Client = api.AcrCLIClientInterface
+
+// TagLister and ManifestLister are the parts of a Client the iterators need, e.g. to iterate over a mock that only
+// lists tags.
+type (
+	TagLister      = api.TagLister
+	ManifestLister = api.ManifestLister
+)
+
+// NewClient returns a client for the registry. The credential is resolved like in the acr-cli commands: the username
+// and password, an ACR refresh token if the username is empty, or the docker config files if both are empty.
+func NewClient(loginURL string, username string, password string, configs []string) (Client, error) {
+	return api.GetAcrCLIClientWithAuth(loginURL, username, password, configs)
+}
+
+// IsNotFound returns true if the error of an iterator means that the repository does not exist.
+func IsNotFound(err error) bool {
+	return api.IsNotFound(err)
+}
+
+// TagIterator iterates over the tags of a repository, one tag at a time, the pages are requested as needed.
+type TagIterator struct {
+	pager *api.TagPager
+	page  []acr.TagAttributesBase
+	tag   acr.TagAttributesBase
+	err   error
+	// notFound is set if the error means that the repository does not exist, done when the registry returned an
+	// empty page.
+	notFound bool
+	done     bool
+}
+
+// NewTagIterator creates an iterator over the tags of a repository, orderBy is empty for the default order of the
+// registry or timeasc or timedesc to order them by their last update.
+func NewTagIterator(client TagLister, repoName string, orderBy string) *TagIterator {
+	return &TagIterator{pager: api.NewTagPager(client, repoName, orderBy)}
+}
+
+// Next moves to the next tag, it returns false when there are no more tags or an error occurred.
+func (it *TagIterator) Next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.done || it.pager.Done() {
+			return false
+		}
+		resultTags, err := it.pager.Next(ctx)
+		if err != nil {
+			it.err = err
+			it.notFound = errors.Is(err, api.ErrNotFound)
+			return false
+		}
+		if resultTags == nil || resultTags.TagsAttributes == nil {
+			it.done = true
+			return false
+		}
+		it.page = *resultTags.TagsAttributes
+	}
+	it.tag, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Tag returns the current tag, it is only valid after Next returned true.
+func (it *TagIterator) Tag() acr.TagAttributesBase {
+	return it.tag
+}
+
+// Err returns the error that stopped the iteration, nil if every tag was listed.
+func (it *TagIterator) Err() error {
+	return it.err
+}
+
+// NotFound returns true if the iteration stopped because the repository does not exist.
+func (it *TagIterator) NotFound() bool {
+	return it.notFound
+}
+
+// Listed returns the number of tags received from the registry so far.
+func (it *TagIterator) Listed() int {
+	return it.pager.Listed()
+}
+
+// ManifestIterator iterates over the manifests of a repository, one manifest at a time, the pages are requested as
+// needed.
+type ManifestIterator struct {
+	pager    *api.ManifestPager
+	page     []acr.ManifestAttributesBase
+	manifest acr.ManifestAttributesBase
+	err      error
+	notFound bool
+	done     bool
+}
+
+// NewManifestIterator creates an iterator over the manifests of a repository, orderBy is empty for the default order
+// of the registry or timeasc or timedesc to order them by their last update.
+func NewManifestIterator(client ManifestLister, repoName string, orderBy string) *ManifestIterator {
+	return &ManifestIterator{pager: api.NewManifestPager(client, repoName, orderBy)}
+}
+
+// Next moves to the next manifest, it returns false when there are no more manifests or an error occurred.
+func (it *ManifestIterator) Next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.done || it.pager.Done() {
+			return false
+		}
+		resultManifests, err := it.pager.Next(ctx)
+		if err != nil {
+			it.err = err
+			it.notFound = errors.Is(err, api.ErrNotFound)
+			return false
+		}
+		if resultManifests == nil || resultManifests.ManifestsAttributes == nil {
+			it.done = true
+			return false
+		}
+		it.page = *resultManifests.ManifestsAttributes
+	}
+	it.manifest, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Manifest returns the current manifest, it is only valid after Next returned true.
+func (it *ManifestIterator) Manifest() acr.ManifestAttributesBase {
+	return it.manifest
+}
+
+// Err returns the error that stopped the iteration, nil if every manifest was listed.
+func (it *ManifestIterator) Err() error {
+	return it.err
+}
+
+// NotFound returns true if the iteration stopped because the repository does not exist.
+func (it *ManifestIterator) NotFound() bool {
+	return it.notFound
+}
+
+// Listed returns the number of manifests received from the registry so far.
+func (it *ManifestIterator) Listed() int {
+	return it.pager.Listed()
+}
+
+// RepositoryIterator iterates over the repositories of a registry, one repository at a time.
+type RepositoryIterator struct {
+	pager    *api.RepositoryPager
+	page     []string
+	repoName string
+	err      error
+	done     bool
+}
+
+// NewRepositoryIterator creates an iterator over the repositories of a registry, in lexical order.
+func NewRepositoryIterator(client Client) *RepositoryIterator {
+	return &RepositoryIterator{pager: api.NewRepositoryPager(client)}
+}
+
+// Next moves to the next repository, it returns false when there are no more repositories or an error occurred.
+func (it *RepositoryIterator) Next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.done || it.pager.Done() {
+			return false
+		}
+		resultRepos, err := it.pager.Next(ctx)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if resultRepos == nil || resultRepos.Names == nil {
+			it.done = true
+			return false
+		}
+		it.page = *resultRepos.Names
+	}
+	it.repoName, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// RepoName returns the current repository, it is only valid after Next returned true.
+func (it *RepositoryIterator) RepoName() string {
+	return it.repoName
+}
+
+// Err returns the error that stopped the iteration, nil if every repository was listed.
+func (it *RepositoryIterator) Err() error {
+	return it.err
+}
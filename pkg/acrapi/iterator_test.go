@@ -0,0 +1,134 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package acrapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/acr-cli/acr"
+	"github.com/Azure/acr-cli/cmd/api"
+	"github.com/Azure/acr-cli/cmd/mocks"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/stretchr/testify/assert"
+)
+
+// tagsPage returns a page of tags that does not come from an http response, the next page starts after its last tag.
+func tagsPage(names ...string) *acr.RepositoryTagsType {
+	tags := []acr.TagAttributesBase{}
+	for _, name := range names {
+		name := name
+		tags = append(tags, acr.TagAttributesBase{Name: &name})
+	}
+	return &acr.RepositoryTagsType{TagsAttributes: &tags}
+}
+
+// manifestsPage returns a page of manifests that does not come from an http response.
+func manifestsPage(digests ...string) *acr.Manifests {
+	manifests := []acr.ManifestAttributesBase{}
+	for _, digest := range digests {
+		digest := digest
+		manifests = append(manifests, acr.ManifestAttributesBase{Digest: &digest})
+	}
+	return &acr.Manifests{ManifestsAttributes: &manifests}
+}
+
+// TestTagIterator contains the tests for the iteration over the tags of a repository.
+func TestTagIterator(t *testing.T) {
+	ctx := context.Background()
+	// First test, the tags of every page are returned one at a time until an empty page.
+	t.Run("MultiplePagesTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", ctx, "foo", "", "").Return(tagsPage("v1", "v2"), nil).Once()
+		mockClient.On("GetAcrTags", ctx, "foo", "", "v2").Return(tagsPage("v3"), nil).Once()
+		mockClient.On("GetAcrTags", ctx, "foo", "", "v3").Return(tagsPage(), nil).Once()
+		tags := NewTagIterator(mockClient, "foo", "")
+		names := []string{}
+		for tags.Next(ctx) {
+			names = append(names, *tags.Tag().Name)
+		}
+		assert.Equal(nil, tags.Err(), "Error should be nil")
+		assert.Equal([]string{"v1", "v2", "v3"}, names)
+		assert.Equal(3, tags.Listed())
+		assert.Equal(false, tags.Next(ctx), "No page should be requested after the end")
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, a repository that does not exist stops the iteration with a not found error.
+	t.Run("NotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		notFound := &acr.RepositoryTagsType{Response: autorest.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}}
+		mockClient.On("GetAcrTags", ctx, "foo", "", "").Return(notFound, errors.New("repository not found")).Once()
+		tags := NewTagIterator(mockClient, "foo", "")
+		assert.Equal(false, tags.Next(ctx))
+		assert.NotEqual(nil, tags.Err(), "Error should not be nil")
+		assert.Equal(true, tags.NotFound())
+		mockClient.AssertExpectations(t)
+	})
+	// Third test, other errors are returned without being mistaken for a missing repository.
+	t.Run("ErrorTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.TagLister{}
+		mockClient.On("GetAcrTags", ctx, "foo", "", "").Return(tagsPage("v1"), nil).Once()
+		mockClient.On("GetAcrTags", ctx, "foo", "", "v1").Return(nil, errors.New("unauthorized")).Once()
+		tags := NewTagIterator(mockClient, "foo", "")
+		assert.Equal(true, tags.Next(ctx))
+		assert.Equal(false, tags.Next(ctx))
+		assert.NotEqual(nil, tags.Err(), "Error should not be nil")
+		assert.Equal(false, tags.NotFound())
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestManifestIterator contains the tests for the iteration over the manifests of a repository.
+func TestManifestIterator(t *testing.T) {
+	ctx := context.Background()
+	// First test, the manifests of every page are returned one at a time until an empty page.
+	t.Run("MultiplePagesTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.ManifestLister{}
+		mockClient.On("GetAcrManifests", ctx, "foo", "timedesc", "").Return(manifestsPage("sha:1", "sha:2"), nil).Once()
+		mockClient.On("GetAcrManifests", ctx, "foo", "timedesc", "sha:2").Return(manifestsPage(), nil).Once()
+		manifests := NewManifestIterator(mockClient, "foo", "timedesc")
+		digests := []string{}
+		for manifests.Next(ctx) {
+			digests = append(digests, *manifests.Manifest().Digest)
+		}
+		assert.Equal(nil, manifests.Err(), "Error should be nil")
+		assert.Equal([]string{"sha:1", "sha:2"}, digests)
+		mockClient.AssertExpectations(t)
+	})
+	// Second test, the not found errors of the clients that are not generated are recognized.
+	t.Run("NotFoundTest", func(t *testing.T) {
+		assert := assert.New(t)
+		mockClient := &mocks.ManifestLister{}
+		mockClient.On("GetAcrManifests", ctx, "foo", "", "").Return(nil, &api.StatusError{StatusCode: http.StatusNotFound}).Once()
+		manifests := NewManifestIterator(mockClient, "foo", "")
+		assert.Equal(false, manifests.Next(ctx))
+		assert.Equal(true, manifests.NotFound())
+		assert.Equal(true, IsNotFound(manifests.Err()))
+		mockClient.AssertExpectations(t)
+	})
+}
+
+// TestRepositoryIterator contains the tests for the iteration over the repositories of a registry.
+func TestRepositoryIterator(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	firstPage := []string{"bar", "foo"}
+	mockClient := &mocks.AcrCLIClientInterface{}
+	mockClient.On("GetAcrRepositories", ctx, "").Return(&acr.Repositories{Names: &firstPage}, nil).Once()
+	mockClient.On("GetAcrRepositories", ctx, "foo").Return(&acr.Repositories{Names: &[]string{}}, nil).Once()
+	repositories := NewRepositoryIterator(mockClient)
+	names := []string{}
+	for repositories.Next(ctx) {
+		names = append(names, repositories.RepoName())
+	}
+	assert.Equal(nil, repositories.Err(), "Error should be nil")
+	assert.Equal(firstPage, names)
+	mockClient.AssertExpectations(t)
+}
@@ -3,6 +3,11 @@
 
 package version
 
+import (
+	"runtime"
+	"strings"
+)
+
 var (
 	// Version holds the semantic version. Filled in at linking time.
 	Version = ""
@@ -10,3 +15,41 @@ var (
 	// Revision is filled with the VCS revision. Filled in at linking time.
 	Revision = ""
 )
+
+// unknown is reported instead of the values that were not filled in at linking time (e.g. when using go build).
+const unknown = "unknown"
+
+// Info contains the build information of the binary.
+type Info struct {
+	Version   string
+	Revision  string
+	GoVersion string
+	Platform  string
+}
+
+// Get returns the build information of the binary.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Revision:  Revision,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if len(info.Version) == 0 {
+		info.Version = unknown
+	}
+	if len(info.Revision) == 0 {
+		info.Revision = unknown
+	}
+	return info
+}
+
+// UserAgent returns the User-Agent that identifies the requests made by a command, e.g. acr-cli/1.0.0 purge. The
+// command path is joined with dashes so that subcommands like manifest list remain a single token.
+func UserAgent(command string) string {
+	userAgent := "acr-cli/" + Get().Version
+	if command = strings.Join(strings.Fields(command), "-"); len(command) > 0 {
+		userAgent += " " + command
+	}
+	return userAgent
+}
@@ -0,0 +1,20 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserAgent(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	assert := assert.New(t)
+	Version = ""
+	assert.Equal("acr-cli/unknown", UserAgent(""))
+	Version = "1.0.0"
+	assert.Equal("acr-cli/1.0.0 purge", UserAgent("purge"))
+	assert.Equal("acr-cli/1.0.0 manifest-create-index", UserAgent("manifest create-index"))
+}